@@ -0,0 +1,188 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strconv"
+	"time"
+)
+
+// ACTIVITY_DELIVERY is the name of the attribute recording the time a message was last delivered to a subscriber.
+const ACTIVITY_DELIVERY string = "last_delivery"
+
+// ACTIVITY_OPEN is the name of the attribute recording the time a subscriber last opened a message.
+const ACTIVITY_OPEN string = "last_open"
+
+// ACTIVITY_CLICK is the name of the attribute recording the time a subscriber last followed a link in a message.
+const ACTIVITY_CLICK string = "last_click"
+
+// SubscriptionActivity records the last time (as a Unix timestamp) of each kind of activity for a subscription.
+// Times are zero if that activity has never been recorded.
+type SubscriptionActivity struct {
+	Address      string `json:"address"`
+	LastDelivery int64  `json:"last_delivery"`
+	LastOpen     int64  `json:"last_open"`
+	LastClick    int64  `json:"last_click"`
+}
+
+func isActivity(activity string) bool {
+
+	switch activity {
+	case ACTIVITY_DELIVERY, ACTIVITY_OPEN, ACTIVITY_CLICK:
+		return true
+	default:
+		return false
+	}
+}
+
+// RecordActivity records 't' as the time of the last 'activity' (one of ACTIVITY_DELIVERY, ACTIVITY_OPEN or
+// ACTIVITY_CLICK) for the subscription for 'addr' using a single UpdateItem request. Times earlier than the
+// one already recorded are ignored. It returns a `database.NoRecordError` if there is no subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) RecordActivity(ctx context.Context, addr string, activity string, t time.Time) error {
+
+	ctx = withOperation(ctx, "RecordActivity")
+
+	if !isActivity(activity) {
+		return fmt.Errorf("Invalid activity '%s'", activity)
+	}
+
+	req := &aws_dynamodb.UpdateItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"address": {
+				S: aws.String(db.options.addressKey(addr)),
+			},
+		},
+		UpdateExpression:    aws.String("SET #activity = :t"),
+		ConditionExpression: aws.String("attribute_exists(#address) AND (attribute_not_exists(#activity) OR #activity < :t)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address":  aws.String("address"),
+			"#activity": aws.String(activity),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":t": {
+				N: aws.String(strconv.FormatInt(t.Unix(), 10)),
+			},
+		},
+	}
+
+	_, err := db.client.UpdateItemWithContext(ctx, req)
+
+	if err == nil {
+		return nil
+	}
+
+	err = wrapError(err)
+
+	if !errors.Is(err, ErrConditionFailed) {
+		return err
+	}
+
+	// the condition fails both when there is no subscription and when a later time has already been
+	// recorded so check which it was
+
+	_, get_err := db.getSubscriptionWithAddress(ctx, addr)
+
+	if get_err != nil {
+		return get_err
+	}
+
+	return nil
+}
+
+// GetSubscriptionActivity returns the activity recorded for the subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) GetSubscriptionActivity(ctx context.Context, addr string) (*SubscriptionActivity, error) {
+
+	ctx = withOperation(ctx, "GetSubscriptionActivity")
+
+	req := &aws_dynamodb.GetItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"address": {
+				S: aws.String(db.options.addressKey(addr)),
+			},
+		},
+		ProjectionExpression: aws.String("#address, #delivery, #open, #click"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address":  aws.String("address"),
+			"#delivery": aws.String(ACTIVITY_DELIVERY),
+			"#open":     aws.String(ACTIVITY_OPEN),
+			"#click":    aws.String(ACTIVITY_CLICK),
+		},
+	}
+
+	rsp, err := db.client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	if rsp.Item == nil {
+		return nil, new(database.NoRecordError)
+	}
+
+	a := &SubscriptionActivity{
+		Address:      addr,
+		LastDelivery: activityTime(rsp.Item, ACTIVITY_DELIVERY),
+		LastOpen:     activityTime(rsp.Item, ACTIVITY_OPEN),
+		LastClick:    activityTime(rsp.Item, ACTIVITY_CLICK),
+	}
+
+	return a, nil
+}
+
+func activityTime(item map[string]*aws_dynamodb.AttributeValue, activity string) int64 {
+
+	v, ok := item[activity]
+
+	if !ok || v.N == nil {
+		return 0
+	}
+
+	t, err := strconv.ParseInt(*v.N, 10, 64)
+
+	if err != nil {
+		return 0
+	}
+
+	return t
+}
+
+// ListInactiveSubscriptions invokes 'callback' for each subscription with no 'activity' (one of ACTIVITY_DELIVERY,
+// ACTIVITY_OPEN or ACTIVITY_CLICK) since 'since'. Subscriptions with no recorded activity at all are only
+// included if they were created before 'since'. This is a filtered scan of the entire table.
+func (db *DynamoDBSubscriptionsDatabase) ListInactiveSubscriptions(ctx context.Context, activity string, since time.Time, callback database.ListSubscriptionsFunc) error {
+
+	ctx = withOperation(ctx, "ListInactiveSubscriptions")
+
+	if !isActivity(activity) {
+		return fmt.Errorf("Invalid activity '%s'", activity)
+	}
+
+	req := &aws_dynamodb.ScanInput{
+		TableName:        aws.String(db.options.FullTableName()),
+		FilterExpression: aws.String("#activity < :since OR (attribute_not_exists(#activity) AND #created < :since)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#activity": aws.String(activity),
+			"#created":  aws.String("created"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":since": {
+				N: aws.String(strconv.FormatInt(since.Unix(), 10)),
+			},
+		},
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
+	}
+
+	callback = limitSubscriptionsCallback(db.options.MaxResults, callback)
+
+	err := scanSubscriptions(ctx, db.client, db.options, req, callback)
+	return stopListingError(err)
+}
@@ -0,0 +1,219 @@
+package dynamodb
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	aws_cloudwatch "github.com/aws/aws-sdk-go/service/cloudwatch"
+	aws_cloudwatchiface "github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+)
+
+// ALARMS_DEFAULT_PERIOD is the default period, in seconds, over which the metrics for table alarms are evaluated.
+const ALARMS_DEFAULT_PERIOD int64 = 300
+
+// ALARMS_DEFAULT_EVALUATION_PERIODS is the default number of periods which must breach before a table alarm is raised.
+const ALARMS_DEFAULT_EVALUATION_PERIODS int64 = 1
+
+// ALARMS_DEFAULT_ANOMALY_BAND is the default width, in standard deviations, of the anomaly detection band used by
+// the TTL deletions alarm.
+const ALARMS_DEFAULT_ANOMALY_BAND float64 = 2
+
+// alarmOperations are the DynamoDB operations this package uses, whose system errors are counted by the system
+// errors alarm. CloudWatch only reports SystemErrors per operation and an alarm may use at most ten metrics, so
+// this is the whole list rather than every operation DynamoDB supports.
+var alarmOperations = []string{
+	"GetItem",
+	"PutItem",
+	"UpdateItem",
+	"DeleteItem",
+	"Query",
+	"Scan",
+	"BatchGetItem",
+	"BatchWriteItem",
+	"TransactWriteItems",
+}
+
+// TableAlarmsOptions are the settings used to create CloudWatch alarms for a table.
+type TableAlarmsOptions struct {
+	// Actions are the ARNs, for example of SNS topics, notified when an alarm is raised and when it recovers.
+	Actions []string
+	// Period is the period, in seconds, over which metrics are evaluated. If zero ALARMS_DEFAULT_PERIOD is used.
+	Period int64
+	// EvaluationPeriods is the number of periods which must breach before an alarm is raised. If zero
+	// ALARMS_DEFAULT_EVALUATION_PERIODS is used.
+	EvaluationPeriods int64
+	// ThrottleThreshold is the number of throttled read and write requests in a period which raises the throttling alarm.
+	ThrottleThreshold float64
+	// SystemErrorsThreshold is the number of system errors in a period which raises the system errors alarm.
+	SystemErrorsThreshold float64
+	// AnomalyBand is the width, in standard deviations, of the anomaly detection band outside of which the number
+	// of items deleted by TTL raises the TTL deletions alarm. If zero ALARMS_DEFAULT_ANOMALY_BAND is used.
+	AnomalyBand float64
+}
+
+// DefaultTableAlarmsOptions returns a `TableAlarmsOptions` which raises an alarm for any throttled request or
+// system error in a five minute period.
+func DefaultTableAlarmsOptions() *TableAlarmsOptions {
+
+	opts := &TableAlarmsOptions{
+		Actions:               make([]string, 0),
+		Period:                ALARMS_DEFAULT_PERIOD,
+		EvaluationPeriods:     ALARMS_DEFAULT_EVALUATION_PERIODS,
+		ThrottleThreshold:     1,
+		SystemErrorsThreshold: 1,
+		AnomalyBand:           ALARMS_DEFAULT_ANOMALY_BAND,
+	}
+
+	return opts
+}
+
+// CreateTableAlarms creates, or replaces, the CloudWatch alarms returned by `TableAlarms` for the table in 'def'.
+func CreateTableAlarms(client aws_cloudwatchiface.CloudWatchAPI, def *TableDefinition, opts *TableAlarmsOptions) error {
+
+	for _, req := range TableAlarms(def, opts) {
+
+		_, err := client.PutMetricAlarm(req)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create %s alarm, %w", *req.AlarmName, err)
+		}
+	}
+
+	return nil
+}
+
+// TableAlarms returns the requests used to create the CloudWatch alarms for the table in 'def': one for throttled
+// read and write requests, one for system errors and, if TTL is enabled for the table, one for the number of items
+// deleted by TTL falling outside of its expected (anomaly detection) band. Alarms are named after the table, for
+// example "prod_subscriptions-throttles", and periods without data are not treated as breaching.
+func TableAlarms(def *TableDefinition, opts *TableAlarmsOptions) []*aws_cloudwatch.PutMetricAlarmInput {
+
+	// alarms are named after, and their metrics dimensioned by, the table's name even if it is identified by an ARN
+
+	table := tableNameFromArn(*def.Input.TableName)
+
+	period := opts.Period
+
+	if period == 0 {
+		period = ALARMS_DEFAULT_PERIOD
+	}
+
+	evaluation_periods := opts.EvaluationPeriods
+
+	if evaluation_periods == 0 {
+		evaluation_periods = ALARMS_DEFAULT_EVALUATION_PERIODS
+	}
+
+	band := opts.AnomalyBand
+
+	if band == 0 {
+		band = ALARMS_DEFAULT_ANOMALY_BAND
+	}
+
+	metric := func(id string, name string, dimensions map[string]string) *aws_cloudwatch.MetricDataQuery {
+
+		dims := []*aws_cloudwatch.Dimension{
+			{
+				Name:  aws.String("TableName"),
+				Value: aws.String(table),
+			},
+		}
+
+		for k, v := range dimensions {
+			dims = append(dims, &aws_cloudwatch.Dimension{
+				Name:  aws.String(k),
+				Value: aws.String(v),
+			})
+		}
+
+		q := &aws_cloudwatch.MetricDataQuery{
+			Id: aws.String(id),
+			MetricStat: &aws_cloudwatch.MetricStat{
+				Metric: &aws_cloudwatch.Metric{
+					Namespace:  aws.String("AWS/DynamoDB"),
+					MetricName: aws.String(name),
+					Dimensions: dims,
+				},
+				Period: aws.Int64(period),
+				Stat:   aws.String(aws_cloudwatch.StatisticSum),
+			},
+			ReturnData: aws.Bool(false),
+		}
+
+		return q
+	}
+
+	expression := func(id string, expr string, label string) *aws_cloudwatch.MetricDataQuery {
+
+		q := &aws_cloudwatch.MetricDataQuery{
+			Id:         aws.String(id),
+			Expression: aws.String(expr),
+			Label:      aws.String(label),
+			ReturnData: aws.Bool(true),
+		}
+
+		return q
+	}
+
+	alarm := func(name string, description string, metrics []*aws_cloudwatch.MetricDataQuery) *aws_cloudwatch.PutMetricAlarmInput {
+
+		req := &aws_cloudwatch.PutMetricAlarmInput{
+			AlarmName:         aws.String(table + "-" + name),
+			AlarmDescription:  aws.String(fmt.Sprintf("%s for the %s table", description, table)),
+			Metrics:           metrics,
+			EvaluationPeriods: aws.Int64(evaluation_periods),
+			TreatMissingData:  aws.String("notBreaching"),
+		}
+
+		if len(opts.Actions) > 0 {
+			req.AlarmActions = aws.StringSlice(opts.Actions)
+			req.OKActions = aws.StringSlice(opts.Actions)
+		}
+
+		return req
+	}
+
+	alarms := make([]*aws_cloudwatch.PutMetricAlarmInput, 0)
+
+	throttles := alarm("throttles", "Throttled read and write requests", []*aws_cloudwatch.MetricDataQuery{
+		metric("reads", "ReadThrottleEvents", nil),
+		metric("writes", "WriteThrottleEvents", nil),
+		expression("throttles", "FILL(reads, 0) + FILL(writes, 0)", "Throttled requests"),
+	})
+
+	throttles.ComparisonOperator = aws.String(aws_cloudwatch.ComparisonOperatorGreaterThanOrEqualToThreshold)
+	throttles.Threshold = aws.Float64(opts.ThrottleThreshold)
+
+	alarms = append(alarms, throttles)
+
+	errors_metrics := make([]*aws_cloudwatch.MetricDataQuery, 0)
+
+	for i, op := range alarmOperations {
+		errors_metrics = append(errors_metrics, metric(fmt.Sprintf("op%d", i), "SystemErrors", map[string]string{"Operation": op}))
+	}
+
+	errors_metrics = append(errors_metrics, expression("errors", "SUM(FILL(METRICS(), 0))", "System errors"))
+
+	system_errors := alarm("system-errors", "System errors", errors_metrics)
+	system_errors.ComparisonOperator = aws.String(aws_cloudwatch.ComparisonOperatorGreaterThanOrEqualToThreshold)
+	system_errors.Threshold = aws.Float64(opts.SystemErrorsThreshold)
+
+	alarms = append(alarms, system_errors)
+
+	if def.TimeToLiveAttribute != "" {
+
+		ttl := alarm("ttl-deletions", "Unexpected numbers of items deleted by TTL", []*aws_cloudwatch.MetricDataQuery{
+			metric("deleted", "TimeToLiveDeletedItemCount", nil),
+			expression("band", fmt.Sprintf("ANOMALY_DETECTION_BAND(deleted, %v)", band), "Expected TTL deletions"),
+		})
+
+		// anomaly detection alarms compare the metric itself, rather than the band, so it must be returned too
+
+		ttl.Metrics[0].ReturnData = aws.Bool(true)
+		ttl.ComparisonOperator = aws.String(aws_cloudwatch.ComparisonOperatorLessThanLowerOrGreaterThanUpperThreshold)
+		ttl.ThresholdMetricId = aws.String("band")
+
+		alarms = append(alarms, ttl)
+	}
+
+	return alarms
+}
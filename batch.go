@@ -0,0 +1,118 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"time"
+)
+
+// BATCH_GET_MAX_KEYS is the maximum number of keys DynamoDB allows in a single BatchGetItem request.
+const BATCH_GET_MAX_KEYS int = 100
+
+// BATCH_MAX_RETRIES is the maximum number of times unprocessed items in a batch request will be retried.
+const BATCH_MAX_RETRIES int = 8
+
+// batchGetItems retrieves the items for 'keys' (which must not exceed BATCH_GET_MAX_KEYS) from 'table',
+// retrying any unprocessed keys with exponential backoff.
+func batchGetItems(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, table string, keys []map[string]*aws_dynamodb.AttributeValue) ([]map[string]*aws_dynamodb.AttributeValue, error) {
+
+	items := make([]map[string]*aws_dynamodb.AttributeValue, 0)
+
+	req := &aws_dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*aws_dynamodb.KeysAndAttributes{
+			table: {
+				Keys: keys,
+			},
+		},
+	}
+
+	for attempt := 0; ; attempt++ {
+
+		rsp, err := client.BatchGetItemWithContext(ctx, req)
+
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		items = append(items, rsp.Responses[table]...)
+
+		unprocessed, ok := rsp.UnprocessedKeys[table]
+
+		if !ok || len(unprocessed.Keys) == 0 {
+			break
+		}
+
+		if attempt >= BATCH_MAX_RETRIES {
+			return nil, fmt.Errorf("Failed to retrieve %d unprocessed keys after %d attempts, %w", len(unprocessed.Keys), attempt+1, ErrThrottled)
+		}
+
+		err = batchBackoff(ctx, attempt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		req.RequestItems = rsp.UnprocessedKeys
+	}
+
+	return items, nil
+}
+
+// batchBackoff waits before retrying unprocessed batch items, doubling the delay for each 'attempt'
+// up to a maximum of five seconds. It returns early with an error if 'ctx' is cancelled.
+func batchBackoff(ctx context.Context, attempt int) error {
+
+	delay := 50 * time.Millisecond * time.Duration(1<<attempt)
+
+	if delay > 5*time.Second {
+		delay = 5 * time.Second
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// BATCH_WRITE_MAX_ITEMS is the maximum number of items DynamoDB allows in a single BatchWriteItem request.
+const BATCH_WRITE_MAX_ITEMS int = 25
+
+// batchWriteItems performs 'requests' (which must not exceed BATCH_WRITE_MAX_ITEMS in total) in a single
+// BatchWriteItem request, retrying any unprocessed items with exponential backoff.
+func batchWriteItems(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, requests map[string][]*aws_dynamodb.WriteRequest) error {
+
+	req := &aws_dynamodb.BatchWriteItemInput{
+		RequestItems: requests,
+	}
+
+	for attempt := 0; ; attempt++ {
+
+		rsp, err := client.BatchWriteItemWithContext(ctx, req)
+
+		if err != nil {
+			return wrapError(err)
+		}
+
+		if len(rsp.UnprocessedItems) == 0 {
+			break
+		}
+
+		if attempt >= BATCH_MAX_RETRIES {
+			return fmt.Errorf("Failed to write unprocessed items after %d attempts, %w", attempt+1, ErrThrottled)
+		}
+
+		err = batchBackoff(ctx, attempt)
+
+		if err != nil {
+			return err
+		}
+
+		req.RequestItems = rsp.UnprocessedItems
+	}
+
+	return nil
+}
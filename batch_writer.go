@@ -0,0 +1,291 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"sync"
+	"time"
+)
+
+// BATCH_WRITER_DEFAULT_FLUSH_INTERVAL is the default maximum time a write is buffered by `BatchWriter`.
+const BATCH_WRITER_DEFAULT_FLUSH_INTERVAL time.Duration = time.Second
+
+// BatchWriterOptions are the settings used to buffer writes with `BatchWriter`.
+type BatchWriterOptions struct {
+	// MaxItems is the number of buffered writes which causes them to be flushed. It may not exceed
+	// BATCH_WRITE_MAX_ITEMS. If zero BATCH_WRITE_MAX_ITEMS is used.
+	MaxItems int
+	// FlushInterval is the maximum time a write is buffered before it is flushed. If zero writes are only
+	// flushed when MaxItems writes are buffered or when `Flush` or `Close` is called.
+	FlushInterval time.Duration
+}
+
+// DefaultBatchWriterOptions returns a `BatchWriterOptions` which flushes writes in batches of
+// BATCH_WRITE_MAX_ITEMS, or after BATCH_WRITER_DEFAULT_FLUSH_INTERVAL, whichever comes first.
+func DefaultBatchWriterOptions() *BatchWriterOptions {
+
+	opts := &BatchWriterOptions{
+		MaxItems:      BATCH_WRITE_MAX_ITEMS,
+		FlushInterval: BATCH_WRITER_DEFAULT_FLUSH_INTERVAL,
+	}
+
+	return opts
+}
+
+// BatchWriter buffers subscription puts and deletes and writes them to a subscriptions database with
+// BatchWriteItem requests, retrying unprocessed items, so that bulk jobs like imports and syncs make up
+// to BATCH_WRITE_MAX_ITEMS times fewer requests. Puts replace the entire item, like `AddSubscription`, so
+// attributes which are not part of `subscription.Subscription` (for example activity times, tags and
+// metadata) are not preserved, and neither puts nor deletes are conditional. Once a batch has been
+// written each put is recorded as an update, and each delete as a removal, with the database's History
+// and Publisher options and deletes remove the address's unsubscribe tokens and confirmations if the
+// UnsubscribeTokens and Confirmations options are set. A BatchWriter is safe for concurrent use.
+type BatchWriter struct {
+	db      *DynamoDBSubscriptionsDatabase
+	options *BatchWriterOptions
+	mu      sync.Mutex
+	pending []*batchWrite
+	keys    map[string]bool
+	timer   *time.Timer
+	err     error
+}
+
+// batchWrite is a write buffered by `BatchWriter` and the subscription it changes.
+type batchWrite struct {
+	request *aws_dynamodb.WriteRequest
+	change  string
+	sub     *subscription.Subscription
+}
+
+// NewBatchWriter returns a new `BatchWriter` for 'db' configured by 'opts'. `Close` must be called to
+// flush any writes which are still buffered.
+func NewBatchWriter(db *DynamoDBSubscriptionsDatabase, opts *BatchWriterOptions) (*BatchWriter, error) {
+
+	if opts.MaxItems < 0 || opts.MaxItems > BATCH_WRITE_MAX_ITEMS {
+		return nil, optionsError("batch writer", "MaxItems", opts.MaxItems, fmt.Sprintf("must be between 0 and %d", BATCH_WRITE_MAX_ITEMS))
+	}
+
+	if opts.FlushInterval < 0 {
+		return nil, optionsError("batch writer", "FlushInterval", opts.FlushInterval, "must not be negative")
+	}
+
+	w_opts := *opts
+
+	if w_opts.MaxItems == 0 {
+		w_opts.MaxItems = BATCH_WRITE_MAX_ITEMS
+	}
+
+	w := &BatchWriter{
+		db:      db,
+		options: &w_opts,
+		pending: make([]*batchWrite, 0, w_opts.MaxItems),
+		keys:    make(map[string]bool),
+	}
+
+	return w, nil
+}
+
+// Put buffers a write of 'sub', which replaces any existing subscription for the same address.
+func (w *BatchWriter) Put(ctx context.Context, sub *subscription.Subscription) error {
+
+	ctx = withOperation(ctx, "BatchWriter")
+
+	item, err := subscriptionToItem(ctx, w.db.options, sub)
+
+	if err != nil {
+		return err
+	}
+
+	req := &aws_dynamodb.WriteRequest{
+		PutRequest: &aws_dynamodb.PutRequest{
+			Item: item,
+		},
+	}
+
+	return w.add(ctx, &batchWrite{request: req, change: HISTORY_CHANGE_UPDATED, sub: sub})
+}
+
+// Delete buffers the removal of 'sub'. Removing a subscription which does not exist is not an error.
+func (w *BatchWriter) Delete(ctx context.Context, sub *subscription.Subscription) error {
+
+	ctx = withOperation(ctx, "BatchWriter")
+
+	req := &aws_dynamodb.WriteRequest{
+		DeleteRequest: &aws_dynamodb.DeleteRequest{
+			Key: map[string]*aws_dynamodb.AttributeValue{
+				"address": {
+					S: aws.String(w.db.options.addressKey(sub.Address)),
+				},
+			},
+		},
+	}
+
+	return w.add(ctx, &batchWrite{request: req, change: HISTORY_CHANGE_REMOVED, sub: sub})
+}
+
+func (w *BatchWriter) add(ctx context.Context, write *batchWrite) error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.takeError()
+
+	if err != nil {
+		return err
+	}
+
+	key := w.db.options.addressKey(write.sub.Address)
+
+	// a BatchWriteItem request may not contain more than one write for the same key so an earlier
+	// write for the address is flushed first, which also keeps writes to an address in order; so are
+	// writes left buffered by a flush which failed once there are MaxItems of them
+
+	if w.keys[key] || len(w.pending) >= w.options.MaxItems {
+
+		err := w.flush(ctx)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	w.pending = append(w.pending, write)
+	w.keys[key] = true
+
+	if len(w.pending) >= w.options.MaxItems {
+		return w.flush(ctx)
+	}
+
+	if w.timer == nil && w.options.FlushInterval > 0 {
+		w.timer = time.AfterFunc(w.options.FlushInterval, w.flushInterval)
+	}
+
+	return nil
+}
+
+// Flush writes every buffered write. If the writes fail they remain buffered, so that `Flush` may be called
+// again, since puts and deletes can safely be repeated.
+func (w *BatchWriter) Flush(ctx context.Context) error {
+
+	ctx = withOperation(ctx, "BatchWriter")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.flush(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return w.takeError()
+}
+
+// Close flushes every buffered write and stops the timer used to flush writes after the FlushInterval option.
+func (w *BatchWriter) Close(ctx context.Context) error {
+
+	ctx = withOperation(ctx, "BatchWriter")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+
+	err := w.flush(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return w.takeError()
+}
+
+// flushInterval flushes the buffered writes once the FlushInterval option has elapsed. Since there is no caller
+// to return an error to it is kept, and returned by the next call to `Put`, `Delete`, `Flush` or `Close`.
+func (w *BatchWriter) flushInterval() {
+
+	ctx := withOperation(context.Background(), "BatchWriter")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timer = nil
+
+	err := w.flush(ctx)
+
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *BatchWriter) takeError() error {
+
+	err := w.err
+	w.err = nil
+
+	return err
+}
+
+// flush writes the buffered writes in a single BatchWriteItem request and then records each change, returning
+// every error recording the changes. It must be called with the lock held.
+func (w *BatchWriter) flush(ctx context.Context) error {
+
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	table := w.db.options.FullTableName()
+	requests := make([]*aws_dynamodb.WriteRequest, len(w.pending))
+
+	for i, write := range w.pending {
+		requests[i] = write.request
+	}
+
+	err := batchWriteItems(ctx, w.db.client, map[string][]*aws_dynamodb.WriteRequest{table: requests})
+
+	if err != nil {
+		return fmt.Errorf("Failed to write batch of %d subscriptions, %w", len(requests), err)
+	}
+
+	pending := w.pending
+
+	w.pending = make([]*batchWrite, 0, w.options.MaxItems)
+	w.keys = make(map[string]bool)
+
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+
+	// the batch has been written so every write's changes are recorded, even if recording an earlier one
+	// failed, since the writes are no longer buffered and would otherwise never be recorded
+
+	errs := make([]error, 0)
+
+	for _, write := range pending {
+
+		if write.change == HISTORY_CHANGE_REMOVED {
+
+			err := w.db.removeRelated(ctx, write.sub.Address)
+
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		err := recordChange(ctx, w.db.options, write.change, write.sub)
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,111 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"github.com/aaronland/go-mailinglist/subscription"
+	"github.com/aws/aws-sdk-go/aws/request"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"testing"
+)
+
+// batchWriteClient accepts every BatchWriteItem request.
+type batchWriteClient struct {
+	aws_dynamodbiface.DynamoDBAPI
+	requests int
+}
+
+func (c *batchWriteClient) BatchWriteItemWithContext(ctx context.Context, req *aws_dynamodb.BatchWriteItemInput, opts ...request.Option) (*aws_dynamodb.BatchWriteItemOutput, error) {
+	c.requests += 1
+	return &aws_dynamodb.BatchWriteItemOutput{}, nil
+}
+
+// failingPublisher records each published change and fails for the addresses in fail.
+type failingPublisher struct {
+	fail      map[string]bool
+	published []string
+}
+
+func (p *failingPublisher) PublishChange(ctx context.Context, e *HistoryEntry) error {
+
+	p.published = append(p.published, e.Address)
+
+	if p.fail[e.Address] {
+		return errors.New("publish failed")
+	}
+
+	return nil
+}
+
+func TestBatchWriterFlushRecordsEveryChange(t *testing.T) {
+
+	ctx := context.Background()
+
+	client := &batchWriteClient{}
+
+	publisher := &failingPublisher{
+		fail: map[string]bool{
+			"a@example.com": true,
+			"c@example.com": true,
+		},
+	}
+
+	opts := DefaultDynamoDBSubscriptionsDatabaseOptions()
+	opts.Publisher = publisher
+
+	db := &DynamoDBSubscriptionsDatabase{
+		client:  client,
+		options: opts,
+	}
+
+	w_opts := DefaultBatchWriterOptions()
+	w_opts.FlushInterval = 0
+
+	w, err := NewBatchWriter(db, w_opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create batch writer, %v", err)
+	}
+
+	addrs := []string{"a@example.com", "b@example.com", "c@example.com"}
+
+	for _, addr := range addrs {
+
+		sub, err := subscription.NewSubscription(addr)
+
+		if err != nil {
+			t.Fatalf("Failed to create subscription, %v", err)
+		}
+
+		err = w.Put(ctx, sub)
+
+		if err != nil {
+			t.Fatalf("Failed to buffer %s, %v", addr, err)
+		}
+	}
+
+	err = w.Close(ctx)
+
+	if err == nil {
+		t.Fatalf("Expected an error publishing changes")
+	}
+
+	if client.requests != 1 {
+		t.Fatalf("Expected a single batch write, got %d", client.requests)
+	}
+
+	if len(publisher.published) != len(addrs) {
+		t.Fatalf("Expected every change to be published, got %v", publisher.published)
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+
+	if !ok || len(joined.Unwrap()) != 2 {
+		t.Fatalf("Expected both publishing errors to be returned, got %v", err)
+	}
+
+	if len(w.pending) != 0 {
+		t.Fatalf("Expected written changes to no longer be buffered, got %d", len(w.pending))
+	}
+}
@@ -0,0 +1,133 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"golang.org/x/net/idna"
+	"strings"
+)
+
+// SUBSCRIPTIONS_CANONICAL_INDEX is the name of the global secondary index used by `ListSubscriptionsWithCanonicalAddress`.
+const SUBSCRIPTIONS_CANONICAL_INDEX string = "canonical_address"
+
+// CANONICAL_ADDRESS_ATTRIBUTE is the name of the attribute containing the canonical form of an address, as returned
+// by `CanonicalAddress`. It is the partition key of the SUBSCRIPTIONS_CANONICAL_INDEX index.
+const CANONICAL_ADDRESS_ATTRIBUTE string = "canonical_address"
+
+// ErrCanonicalizationDisabled is returned when `ListSubscriptionsWithCanonicalAddress` is called for a database
+// without the Canonicalize option.
+var ErrCanonicalizationDisabled = errors.New("Address canonicalization is not enabled")
+
+// canonicalProvider describes how a mail provider delivers variations of an address to the same inbox.
+type canonicalProvider struct {
+	// domain is the domain addresses are canonicalized to.
+	domain string
+	// strip_dots is true if the provider ignores dots in the local part of an address.
+	strip_dots bool
+}
+
+// canonicalProviders are the domains, of providers known to deliver "+tag" addresses to the same inbox, for
+// which addresses are canonicalized. Other domains are only lower-cased since their local parts may be significant.
+var canonicalProviders = map[string]canonicalProvider{
+	"gmail.com":      {domain: "gmail.com", strip_dots: true},
+	"googlemail.com": {domain: "gmail.com", strip_dots: true},
+	"outlook.com":    {domain: "outlook.com"},
+	"hotmail.com":    {domain: "hotmail.com"},
+	"live.com":       {domain: "live.com"},
+	"icloud.com":     {domain: "icloud.com"},
+	"me.com":         {domain: "icloud.com"},
+	"mac.com":        {domain: "icloud.com"},
+	"fastmail.com":   {domain: "fastmail.com"},
+	"protonmail.com": {domain: "protonmail.com"},
+	"proton.me":      {domain: "proton.me"},
+	"pm.me":          {domain: "pm.me"},
+}
+
+// CanonicalAddress returns the canonical form of 'addr': lower-cased, with internationalized domain names in their
+// (UTS #46 mapped) Unicode form so that "user@xn--bcher-kva.de" and "user@BÜCHER.de" are both canonicalized to
+// "user@bücher.de", and, for providers known to deliver variations of an address to the same inbox, with any "+tag"
+// suffix (and, for Gmail, dots) removed from the local part. For example "John.Smith+news@googlemail.com" is
+// canonicalized to "johnsmith@gmail.com".
+func CanonicalAddress(addr string) string {
+
+	addr = strings.ToLower(strings.TrimSpace(addr))
+
+	idx := strings.LastIndex(addr, "@")
+
+	if idx == -1 {
+		return addr
+	}
+
+	local := addr[:idx]
+	domain := addr[idx+1:]
+
+	// domains which are not valid IDNs are left as-is, lower-cased
+
+	unicode_domain, err := idna.Lookup.ToUnicode(domain)
+
+	if err == nil {
+		domain = unicode_domain
+	}
+
+	provider, ok := canonicalProviders[domain]
+
+	if !ok {
+		return local + "@" + domain
+	}
+
+	plus := strings.Index(local, "+")
+
+	if plus != -1 {
+		local = local[:plus]
+	}
+
+	if provider.strip_dots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+
+	return local + "@" + provider.domain
+}
+
+// canonicalAttribute returns the value of the CANONICAL_ADDRESS_ATTRIBUTE attribute for 'addr', which is the
+// pseudonym of the canonical address if addresses are pseudonymized, prefixed with the Tenant option if set.
+func (opts *DynamoDBSubscriptionsDatabaseOptions) canonicalAttribute(addr string) string {
+	return opts.addressKey(CanonicalAddress(addr))
+}
+
+// ListSubscriptionsWithCanonicalAddress invokes 'callback' for each subscription whose address has the same
+// canonical form (see `CanonicalAddress`) as 'addr', for example to detect duplicate signups from the same inbox.
+// It requires the Canonicalize option and only finds subscriptions written since it was enabled.
+func (db *DynamoDBSubscriptionsDatabase) ListSubscriptionsWithCanonicalAddress(ctx context.Context, addr string, callback database.ListSubscriptionsFunc) error {
+
+	ctx = withOperation(ctx, "ListSubscriptionsWithCanonicalAddress")
+
+	if !db.options.Canonicalize {
+		return ErrCanonicalizationDisabled
+	}
+
+	req := &aws_dynamodb.QueryInput{
+		TableName:              aws.String(db.options.FullTableName()),
+		IndexName:              aws.String(SUBSCRIPTIONS_CANONICAL_INDEX),
+		KeyConditionExpression: aws.String("#canonical = :canonical"),
+		ExpressionAttributeNames: map[string]*string{
+			"#canonical": aws.String(CANONICAL_ADDRESS_ATTRIBUTE),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":canonical": {
+				S: aws.String(db.options.canonicalAttribute(addr)),
+			},
+		},
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
+	}
+
+	callback = limitSubscriptionsCallback(db.options.MaxResults, callback)
+
+	err := querySubscriptions(ctx, db.client, db.options, req, callback)
+	return stopListingError(err)
+}
@@ -0,0 +1,51 @@
+package dynamodb
+
+import (
+	"testing"
+)
+
+func TestCanonicalAddress(t *testing.T) {
+
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		// case folding and whitespace
+		{"User@Example.com", "user@example.com"},
+		{"  user@example.com\n", "user@example.com"},
+		{"USER@GMAIL.COM", "user@gmail.com"},
+		// dots and "+tag" suffixes are significant for unknown providers
+		{"john.smith+news@example.com", "john.smith+news@example.com"},
+		// dots and "+tag" suffixes are removed for Gmail
+		{"John.Smith+news@gmail.com", "johnsmith@gmail.com"},
+		{"j.o.h.n.smith@googlemail.com", "johnsmith@gmail.com"},
+		{"john.smith+news+more@gmail.com", "johnsmith@gmail.com"},
+		// only "+tag" suffixes are removed for other known providers
+		{"John.Smith+news@Outlook.com", "john.smith@outlook.com"},
+		{"john+news@me.com", "john@icloud.com"},
+		{"john+news@mac.com", "john@icloud.com"},
+		// the last "@" separates the local part from the domain
+		{"\"john@home\"+news@gmail.com", "\"john@home\"@gmail.com"},
+		// internationalized domain names are compared in their Unicode form
+		{"user@BÜCHER.de", "user@bücher.de"},
+		{"user@xn--bcher-kva.de", "user@bücher.de"},
+		{"user@XN--BCHER-KVA.DE", "user@bücher.de"},
+		{"Ünïcode+tag@bücher.de", "ünïcode+tag@bücher.de"},
+		// addresses which are not addresses are only lower-cased
+		{"Not An Address", "not an address"},
+		{"user@bad_domain.example", "user@bad_domain.example"},
+	}
+
+	for _, test := range tests {
+
+		canonical := CanonicalAddress(test.addr)
+
+		if canonical != test.expected {
+			t.Fatalf("Expected %s to be canonicalized to %s, got %s", test.addr, test.expected, canonical)
+		}
+
+		if CanonicalAddress(canonical) != canonical {
+			t.Fatalf("Canonicalizing %s again changed it to %s", canonical, CanonicalAddress(canonical))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package dynamodb
+
+import (
+	"github.com/aws/aws-sdk-go/aws/request"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ConsumedCapacityFunc is a callback function invoked with the capacity consumed by each successful DynamoDB
+// request. 'operation' is the name of the database method, for example "AddSubscription", that issued the request
+// or the name of the DynamoDB API operation if the request wasn't issued by a database method.
+type ConsumedCapacityFunc func(operation string, capacity *aws_dynamodb.ConsumedCapacity)
+
+// addConsumedCapacityHandlers configures 'client' to request 'mode' (TOTAL or INDEXES) consumed capacity details
+// for every request that supports them and to report those details to 'cb'. If 'mode' is empty TOTAL is used.
+func addConsumedCapacityHandlers(client *aws_dynamodb.DynamoDB, mode string, cb ConsumedCapacityFunc) {
+
+	if mode == "" {
+		mode = aws_dynamodb.ReturnConsumedCapacityTotal
+	}
+
+	client.Handlers.Build.PushFront(func(r *request.Request) {
+		setReturnConsumedCapacity(r.Params, mode)
+	})
+
+	client.Handlers.Complete.PushBack(func(r *request.Request) {
+
+		if r.Error != nil {
+			return
+		}
+
+		op, ok := operationFromContext(r.Context())
+
+		if !ok {
+			op = r.Operation.Name
+		}
+
+		for _, c := range consumedCapacity(r.Data) {
+			cb(op, c)
+		}
+	})
+}
+
+func setReturnConsumedCapacity(params interface{}, mode string) {
+
+	switch req := params.(type) {
+	case *aws_dynamodb.GetItemInput:
+		req.ReturnConsumedCapacity = &mode
+	case *aws_dynamodb.PutItemInput:
+		req.ReturnConsumedCapacity = &mode
+	case *aws_dynamodb.UpdateItemInput:
+		req.ReturnConsumedCapacity = &mode
+	case *aws_dynamodb.DeleteItemInput:
+		req.ReturnConsumedCapacity = &mode
+	case *aws_dynamodb.QueryInput:
+		req.ReturnConsumedCapacity = &mode
+	case *aws_dynamodb.ScanInput:
+		req.ReturnConsumedCapacity = &mode
+	case *aws_dynamodb.BatchGetItemInput:
+		req.ReturnConsumedCapacity = &mode
+	case *aws_dynamodb.BatchWriteItemInput:
+		req.ReturnConsumedCapacity = &mode
+	case *aws_dynamodb.TransactGetItemsInput:
+		req.ReturnConsumedCapacity = &mode
+	case *aws_dynamodb.TransactWriteItemsInput:
+		req.ReturnConsumedCapacity = &mode
+	}
+}
+
+func consumedCapacity(data interface{}) []*aws_dynamodb.ConsumedCapacity {
+
+	var capacity []*aws_dynamodb.ConsumedCapacity
+
+	switch rsp := data.(type) {
+	case *aws_dynamodb.GetItemOutput:
+		capacity = []*aws_dynamodb.ConsumedCapacity{rsp.ConsumedCapacity}
+	case *aws_dynamodb.PutItemOutput:
+		capacity = []*aws_dynamodb.ConsumedCapacity{rsp.ConsumedCapacity}
+	case *aws_dynamodb.UpdateItemOutput:
+		capacity = []*aws_dynamodb.ConsumedCapacity{rsp.ConsumedCapacity}
+	case *aws_dynamodb.DeleteItemOutput:
+		capacity = []*aws_dynamodb.ConsumedCapacity{rsp.ConsumedCapacity}
+	case *aws_dynamodb.QueryOutput:
+		capacity = []*aws_dynamodb.ConsumedCapacity{rsp.ConsumedCapacity}
+	case *aws_dynamodb.ScanOutput:
+		capacity = []*aws_dynamodb.ConsumedCapacity{rsp.ConsumedCapacity}
+	case *aws_dynamodb.BatchGetItemOutput:
+		capacity = rsp.ConsumedCapacity
+	case *aws_dynamodb.BatchWriteItemOutput:
+		capacity = rsp.ConsumedCapacity
+	case *aws_dynamodb.TransactGetItemsOutput:
+		capacity = rsp.ConsumedCapacity
+	case *aws_dynamodb.TransactWriteItemsOutput:
+		capacity = rsp.ConsumedCapacity
+	}
+
+	results := make([]*aws_dynamodb.ConsumedCapacity, 0)
+
+	for _, c := range capacity {
+
+		if c != nil {
+			results = append(results, c)
+		}
+	}
+
+	return results
+}
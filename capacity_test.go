@@ -0,0 +1,114 @@
+package dynamodb
+
+import (
+	"context"
+	"encoding/json"
+	aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConsumedCapacityFunc(t *testing.T) {
+
+	ctx := context.Background()
+
+	var requested []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+
+		var body map[string]interface{}
+
+		err := json.NewDecoder(req.Body).Decode(&body)
+
+		if err != nil {
+			http.Error(rsp, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mode, _ := body["ReturnConsumedCapacity"].(string)
+		requested = append(requested, mode)
+
+		rsp.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		rsp.Write([]byte(`{"ConsumedCapacity":{"TableName":"subscriptions","CapacityUnits":0.5}}`))
+	}))
+
+	defer srv.Close()
+
+	sess, err := aws_session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(srv.URL),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create session, %v", err)
+	}
+
+	var operations []string
+	var units float64
+
+	cb := func(operation string, capacity *aws_dynamodb.ConsumedCapacity) {
+		operations = append(operations, operation)
+		units += aws.Float64Value(capacity.CapacityUnits)
+	}
+
+	db, err := NewSubscriptionsDatabase(ctx, WithSession(sess), WithConsumedCapacityFunc(aws_dynamodb.ReturnConsumedCapacityIndexes, cb))
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	// the subscription does not exist but the request still consumes capacity
+
+	db.GetSubscriptionWithAddress("test@example.com")
+
+	if len(requested) != 1 || requested[0] != aws_dynamodb.ReturnConsumedCapacityIndexes {
+		t.Fatalf("Expected one request for INDEXES consumed capacity, got %v", requested)
+	}
+
+	if len(operations) != 1 || operations[0] != "GetSubscriptionWithAddress" || units != 0.5 {
+		t.Fatalf("Unexpected consumed capacity %v (%f units)", operations, units)
+	}
+}
+
+func TestConsumedCapacityOptions(t *testing.T) {
+
+	// WithConsumedCapacityFunc assigns the settings shared by every options struct
+
+	cb := func(operation string, capacity *aws_dynamodb.ConsumedCapacity) {}
+
+	cfg := &constructorConfig{}
+
+	err := WithConsumedCapacityFunc(aws_dynamodb.ReturnConsumedCapacityTotal, cb)(cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to apply option, %v", err)
+	}
+
+	tests := map[string]tableOptions{
+		"subscriptions":      DefaultDynamoDBSubscriptionsDatabaseOptions(),
+		"confirmations":      DefaultDynamoDBConfirmationsDatabaseOptions(),
+		"event logs":         DefaultDynamoDBEventLogsDatabaseOptions(),
+		"deliveries":         DefaultDynamoDBDeliveriesDatabaseOptions(),
+		"unsubscribe tokens": DefaultDynamoDBUnsubscribeTokensDatabaseOptions(),
+		"send queue":         DefaultDynamoDBSendQueueOptions(),
+		"dead letters":       DefaultDynamoDBDeadLettersDatabaseOptions(),
+		"history":            DefaultDynamoDBHistoryDatabaseOptions(),
+		"stats":              DefaultDynamoDBStatsDatabaseOptions(),
+	}
+
+	for name, opts := range tests {
+
+		cfg.apply(opts.settings())
+
+		s := opts.settings()
+
+		if *s.ReturnConsumedCapacity != aws_dynamodb.ReturnConsumedCapacityTotal || *s.ConsumedCapacityFunc == nil {
+			t.Fatalf("Consumed capacity options not applied to %s options", name)
+		}
+	}
+}
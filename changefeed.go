@@ -0,0 +1,780 @@
+package dynamodb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb/changes"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbstreams "github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	aws_dynamodbstreamsiface "github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CHANGE_FEED_DEFAULT_POLL_INTERVAL is the time a `ChangeFeedIterator` waits, once it has caught up with every
+// shard of the stream, before polling them again unless another PollInterval is assigned.
+const CHANGE_FEED_DEFAULT_POLL_INTERVAL time.Duration = time.Second
+
+// CHANGE_FEED_MAX_PAGE_SIZE is the maximum number of stream records DynamoDB returns per GetRecords request.
+const CHANGE_FEED_MAX_PAGE_SIZE int64 = 1000
+
+// CHANGE_FEED_MAX_BACKOFF is the maximum time a `ChangeFeedIterator` waits before reading a shard again after
+// consecutive requests have been rejected because they exceeded the stream's read limits.
+const CHANGE_FEED_MAX_BACKOFF time.Duration = 30 * time.Second
+
+// ErrStreamNotFound is returned when a change feed is read for a table without an enabled DynamoDB stream.
+var ErrStreamNotFound = errors.New("Table does not have a stream")
+
+// ChangeFeedReader reads the changes to a subscriptions table from its DynamoDB stream (see the StreamViewType
+// option), shard by shard, for applications which replicate subscriptions without a Lambda function or Kinesis
+// data stream between them and the table.
+type ChangeFeedReader struct {
+	client  aws_dynamodbstreamsiface.DynamoDBStreamsAPI
+	options *DynamoDBSubscriptionsDatabaseOptions
+	// PollInterval is the time to wait, once every shard has been read up to its latest record, before polling them
+	// again. If zero CHANGE_FEED_DEFAULT_POLL_INTERVAL is used.
+	PollInterval time.Duration
+	// StartAtLatest starts a change feed without a checkpoint at the latest record of each shard, so that only
+	// changes made after it starts are read, rather than at the oldest record retained by the stream.
+	StartAtLatest bool
+}
+
+func NewChangeFeedReaderWithDSN(dsn string, opts *DynamoDBSubscriptionsDatabaseOptions) (*ChangeFeedReader, error) {
+
+	sess, err := newSessionWithDSNSettings(dsn, DSN_SUBSCRIPTIONS_TABLE_KEY, opts.settings())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewChangeFeedReaderWithSession(sess, opts)
+}
+
+func NewChangeFeedReaderWithSession(sess *aws_session.Session, opts *DynamoDBSubscriptionsDatabaseOptions) (*ChangeFeedReader, error) {
+
+	client := newDynamoDBStreamsClient(sess, opts.settings().clientOptions())
+
+	return NewChangeFeedReaderWithClient(client, opts)
+}
+
+// NewChangeFeedReaderWithClient returns a new `ChangeFeedReader` that uses 'client' to read the stream of the
+// subscriptions table described by 'opts'. Its Tenant, Pseudonymizer and Encryptor options are used to restore
+// the subscriptions in each change, as they are for reads from the table itself.
+func NewChangeFeedReaderWithClient(client aws_dynamodbstreamsiface.DynamoDBStreamsAPI, opts *DynamoDBSubscriptionsDatabaseOptions) (*ChangeFeedReader, error) {
+
+	err := opts.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ChangeFeedReader{
+		client:  client,
+		options: opts,
+	}
+
+	return r, nil
+}
+
+// ChangeFeedCheckpoint is the position of a `ChangeFeedIterator` in each of the shards of a stream, returned by
+// its `Checkpoint` method, from which a later change feed can resume.
+type ChangeFeedCheckpoint struct {
+	// StreamArn is the ARN of the stream the checkpoint is for.
+	StreamArn string `json:"stream_arn"`
+	// Shards maps the ID of each shard changes have been read from to the sequence number of the last change read.
+	Shards map[string]string `json:"shards,omitempty"`
+	// Closed are the IDs of the shards which have been read to their end.
+	Closed []string `json:"closed,omitempty"`
+}
+
+// Token returns the JSON encoding of 'cp', as URL-safe base64, suitable for storing alongside the data a change
+// feed has been replicated to. See `ParseChangeFeedCheckpoint`.
+func (cp *ChangeFeedCheckpoint) Token() (string, error) {
+
+	enc, err := json.Marshal(cp)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode checkpoint, %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(enc), nil
+}
+
+// ParseChangeFeedCheckpoint returns the `ChangeFeedCheckpoint` encoded in 'token' by `ChangeFeedCheckpoint.Token`.
+func ParseChangeFeedCheckpoint(token string) (*ChangeFeedCheckpoint, error) {
+
+	enc, err := base64.RawURLEncoding.DecodeString(token)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid checkpoint, %w", err)
+	}
+
+	var cp *ChangeFeedCheckpoint
+
+	err = json.Unmarshal(enc, &cp)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid checkpoint, %w", err)
+	}
+
+	if cp == nil || !strings.HasPrefix(cp.StreamArn, "arn:") {
+		return nil, errors.New("Invalid checkpoint, missing stream ARN")
+	}
+
+	return cp, nil
+}
+
+// changeFeedShard is the state of a `ChangeFeedIterator` for one shard of a stream.
+type changeFeedShard struct {
+	id       string
+	parent   string
+	open     bool
+	iterator *string
+	acquired bool
+	latest   bool
+}
+
+// ended reports whether 's' has been read to its end. The records of the last page may not have been returned yet.
+func (s *changeFeedShard) ended() bool {
+	return s.acquired && s.iterator == nil
+}
+
+// ChangeFeedIterator returns the changes to a subscriptions table, read from its stream, as they are made. For example:
+//
+//	it := reader.ChangeFeed(ctx, checkpoint)
+//	defer it.Close()
+//
+//	for it.Next() {
+//		ch := it.Change()
+//		checkpoint = it.Checkpoint()
+//	}
+//
+//	err := it.Err()
+//
+// The changes to each address are returned in the order they were made, and a shard is only read once the shard
+// it was split from has been read to its end, but the changes to different addresses may be interleaved.
+type ChangeFeedIterator struct {
+	ctx       context.Context
+	reader    *ChangeFeedReader
+	since     *ChangeFeedCheckpoint
+	stream    string
+	shards    map[string]*changeFeedShard
+	queue     []string
+	positions map[string]string
+	closed    map[string]bool
+	shard     *changeFeedShard
+	records   []*aws_dynamodbstreams.Record
+	offset    int
+	empty     int
+	throttled int
+	started   bool
+	stopped   bool
+	current   *changes.SubscriptionChange
+	err       error
+}
+
+// ChangeFeed returns a new `ChangeFeedIterator` for the changes to the subscriptions table, resuming from 'since'
+// if it is not nil. Otherwise it starts at the oldest record retained by the stream, which is up to 24 hours old,
+// or with the StartAtLatest option at the latest one. Records are only fetched as they are needed.
+func (r *ChangeFeedReader) ChangeFeed(ctx context.Context, since *ChangeFeedCheckpoint) *ChangeFeedIterator {
+
+	it := &ChangeFeedIterator{
+		ctx:       ctx,
+		reader:    r,
+		since:     since,
+		shards:    make(map[string]*changeFeedShard),
+		positions: make(map[string]string),
+		closed:    make(map[string]bool),
+	}
+
+	if since != nil {
+
+		it.stream = since.StreamArn
+
+		for id, seq := range since.Shards {
+			it.positions[id] = seq
+		}
+
+		for _, id := range since.Closed {
+			it.closed[id] = true
+		}
+	}
+
+	return it
+}
+
+// Next advances the iterator to the next change, waiting for one to be made if every shard has been read up to
+// its latest record. It returns false when an error occurs, including the cancellation of its context, or after
+// `Close` has been called.
+func (it *ChangeFeedIterator) Next() bool {
+
+	if it.err != nil || it.stopped {
+		return false
+	}
+
+	if !it.started {
+
+		err := it.start()
+
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.started = true
+	}
+
+	for {
+
+		err := it.ctx.Err()
+
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		for it.offset < len(it.records) {
+
+			rec := it.records[it.offset]
+			it.offset += 1
+
+			it.positions[it.shard.id] = aws.StringValue(rec.Dynamodb.SequenceNumber)
+
+			ch, ok, err := it.change(rec)
+
+			if err != nil {
+				it.err = err
+				return false
+			}
+
+			if !ok {
+				continue
+			}
+
+			it.current = ch
+			return true
+		}
+
+		// a shard is only closed once all of its records have been returned, so that its children are not read
+		// ahead of it and a checkpoint never skips any of its changes
+
+		if it.shard != nil && it.shard.ended() {
+
+			it.closed[it.shard.id] = true
+
+			err := it.describe()
+
+			if err != nil {
+				it.err = err
+				return false
+			}
+		}
+
+		it.shard = nil
+		it.records = nil
+		it.offset = 0
+
+		shard := it.nextShard()
+
+		if shard == nil || it.empty >= len(it.queue) {
+
+			// every shard has been read up to its latest record, or is waiting for its parent, so wait for
+			// more changes and look for shards created since the stream was last described
+
+			it.empty = 0
+
+			err := it.wait()
+
+			if err != nil {
+				it.err = err
+				return false
+			}
+
+			err = it.describe()
+
+			if err != nil {
+				it.err = err
+				return false
+			}
+
+			continue
+		}
+
+		records, err := it.fetch(shard)
+
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		if len(records) == 0 {
+			it.empty += 1
+		} else {
+			it.empty = 0
+		}
+
+		it.shard = shard
+		it.records = records
+	}
+}
+
+// start resolves the stream of the iterator, if it was not started from a checkpoint, and lists its shards.
+func (it *ChangeFeedIterator) start() error {
+
+	if it.stream == "" {
+
+		arn, err := it.reader.streamArn(it.ctx)
+
+		if err != nil {
+			return err
+		}
+
+		it.stream = arn
+	}
+
+	err := it.describe()
+
+	if err != nil {
+		return err
+	}
+
+	if it.since == nil && it.reader.StartAtLatest {
+
+		// shards which have already ended only contain changes made before the feed started, unlike the children
+		// of open shards which are created later and so are read from their oldest record
+
+		for id, shard := range it.shards {
+
+			if shard.open {
+				shard.latest = true
+			} else {
+				it.closed[id] = true
+			}
+		}
+
+		err := it.describe()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// streamArn returns the ARN of the latest stream of the subscriptions table.
+func (r *ChangeFeedReader) streamArn(ctx context.Context) (string, error) {
+
+	req := &aws_dynamodbstreams.ListStreamsInput{
+		TableName: aws.String(tableNameFromArn(r.options.FullTableName())),
+	}
+
+	var latest *aws_dynamodbstreams.Stream
+
+	for {
+
+		rsp, err := r.client.ListStreamsWithContext(ctx, req)
+
+		if err != nil {
+			return "", fmt.Errorf("Failed to list streams for %s, %w", r.options.FullTableName(), wrapError(err))
+		}
+
+		// stream labels are timestamps, so the most recent stream has the greatest label
+
+		for _, s := range rsp.Streams {
+
+			if latest == nil || aws.StringValue(s.StreamLabel) > aws.StringValue(latest.StreamLabel) {
+				latest = s
+			}
+		}
+
+		if rsp.LastEvaluatedStreamArn == nil {
+			break
+		}
+
+		req.ExclusiveStartStreamArn = rsp.LastEvaluatedStreamArn
+	}
+
+	if latest == nil {
+		return "", fmt.Errorf("Failed to read change feed for %s, %w", r.options.FullTableName(), ErrStreamNotFound)
+	}
+
+	return aws.StringValue(latest.StreamArn), nil
+}
+
+// describe lists the shards of the stream, adding any the iterator has not seen before and forgetting the
+// positions, and closed state, of those which have been trimmed from the stream so that checkpoints do not grow.
+func (it *ChangeFeedIterator) describe() error {
+
+	req := &aws_dynamodbstreams.DescribeStreamInput{
+		StreamArn: aws.String(it.stream),
+	}
+
+	listed := make(map[string]bool)
+
+	for {
+
+		rsp, err := it.reader.client.DescribeStreamWithContext(it.ctx, req)
+
+		if err != nil {
+			return fmt.Errorf("Failed to describe stream %s, %w", it.stream, wrapError(err))
+		}
+
+		desc := rsp.StreamDescription
+
+		if aws.StringValue(desc.StreamViewType) == aws_dynamodbstreams.StreamViewTypeKeysOnly {
+			return fmt.Errorf("Failed to read stream %s, change feeds require a stream with item images rather than %s", it.stream, aws_dynamodbstreams.StreamViewTypeKeysOnly)
+		}
+
+		for _, s := range desc.Shards {
+
+			id := aws.StringValue(s.ShardId)
+			listed[id] = true
+
+			_, ok := it.shards[id]
+
+			if ok || it.closed[id] {
+				continue
+			}
+
+			it.shards[id] = &changeFeedShard{
+				id:     id,
+				parent: aws.StringValue(s.ParentShardId),
+				open:   s.SequenceNumberRange == nil || s.SequenceNumberRange.EndingSequenceNumber == nil,
+			}
+
+			it.queue = append(it.queue, id)
+		}
+
+		if desc.LastEvaluatedShardId == nil {
+			break
+		}
+
+		req.ExclusiveStartShardId = desc.LastEvaluatedShardId
+	}
+
+	for id := range it.positions {
+
+		if !listed[id] {
+			delete(it.positions, id)
+		}
+	}
+
+	for id := range it.closed {
+
+		if !listed[id] {
+			delete(it.closed, id)
+		}
+	}
+
+	queue := make([]string, 0, len(it.queue))
+
+	for _, id := range it.queue {
+
+		if it.closed[id] || !listed[id] {
+			delete(it.shards, id)
+			continue
+		}
+
+		queue = append(queue, id)
+	}
+
+	it.queue = queue
+	return nil
+}
+
+// nextShard returns the next shard, in turn, which may be read because the shard it was split from, if any, has
+// been read to its end or trimmed from the stream. It returns nil if there are none.
+func (it *ChangeFeedIterator) nextShard() *changeFeedShard {
+
+	for i := 0; i < len(it.queue); i++ {
+
+		id := it.queue[0]
+		it.queue = append(it.queue[1:], id)
+
+		shard := it.shards[id]
+
+		if shard.ended() {
+			continue
+		}
+
+		_, waiting := it.shards[shard.parent]
+
+		if waiting {
+			continue
+		}
+
+		return shard
+	}
+
+	return nil
+}
+
+// fetch returns the next page of records from 'shard', acquiring a shard iterator for its position first if
+// necessary.
+func (it *ChangeFeedIterator) fetch(shard *changeFeedShard) ([]*aws_dynamodbstreams.Record, error) {
+
+	if !shard.acquired {
+
+		err := it.acquire(shard)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req := &aws_dynamodbstreams.GetRecordsInput{
+		ShardIterator: shard.iterator,
+	}
+
+	page_size := it.reader.options.PageSize
+
+	if page_size > CHANGE_FEED_MAX_PAGE_SIZE {
+		page_size = CHANGE_FEED_MAX_PAGE_SIZE
+	}
+
+	if page_size > 0 {
+		req.Limit = aws.Int64(page_size)
+	}
+
+	for {
+
+		rsp, err := it.reader.client.GetRecordsWithContext(it.ctx, req)
+
+		if err != nil {
+
+			var aws_err awserr.Error
+
+			if errors.As(err, &aws_err) {
+
+				switch aws_err.Code() {
+				case aws_dynamodbstreams.ErrCodeExpiredIteratorException:
+
+					// iterators expire after 15 minutes so the shard is read again from the last change returned
+
+					shard.acquired = false
+					return nil, nil
+
+				case aws_dynamodbstreams.ErrCodeLimitExceededException:
+
+					// the read limits of a stream are shared by all of its readers so rather than polling it again
+					// immediately wait, for longer after each consecutive rejection, before retrying
+
+					err := it.backoff()
+
+					if err != nil {
+						return nil, err
+					}
+
+					continue
+				}
+			}
+
+			return nil, fmt.Errorf("Failed to read shard %s of stream %s, %w", shard.id, it.stream, wrapError(err))
+		}
+
+		it.throttled = 0
+
+		shard.iterator = rsp.NextShardIterator
+		return rsp.Records, nil
+	}
+}
+
+// acquire assigns 'shard' an iterator positioned after the last change read from it, if any.
+func (it *ChangeFeedIterator) acquire(shard *changeFeedShard) error {
+
+	req := &aws_dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(it.stream),
+		ShardId:           aws.String(shard.id),
+		ShardIteratorType: aws.String(aws_dynamodbstreams.ShardIteratorTypeTrimHorizon),
+	}
+
+	seq, ok := it.positions[shard.id]
+
+	switch {
+	case ok:
+		req.ShardIteratorType = aws.String(aws_dynamodbstreams.ShardIteratorTypeAfterSequenceNumber)
+		req.SequenceNumber = aws.String(seq)
+	case shard.latest:
+		req.ShardIteratorType = aws.String(aws_dynamodbstreams.ShardIteratorTypeLatest)
+	}
+
+	rsp, err := it.reader.client.GetShardIteratorWithContext(it.ctx, req)
+
+	if err != nil {
+		return fmt.Errorf("Failed to get iterator for shard %s of stream %s, %w", shard.id, it.stream, wrapError(err))
+	}
+
+	shard.iterator = rsp.ShardIterator
+	shard.acquired = true
+	shard.latest = false
+
+	return nil
+}
+
+// wait waits for the PollInterval option, or until the iterator's context is cancelled.
+func (it *ChangeFeedIterator) wait() error {
+	return it.sleep(it.pollInterval())
+}
+
+// backoff waits for a random delay (full jitter) of up to the PollInterval option doubled for each consecutive
+// time the stream's read limits have been exceeded, capped at CHANGE_FEED_MAX_BACKOFF, or until the iterator's
+// context is cancelled.
+func (it *ChangeFeedIterator) backoff() error {
+
+	d := it.pollInterval()
+
+	for i := 0; i < it.throttled && d < CHANGE_FEED_MAX_BACKOFF; i++ {
+		d = d * 2
+	}
+
+	if d > CHANGE_FEED_MAX_BACKOFF {
+		d = CHANGE_FEED_MAX_BACKOFF
+	}
+
+	it.throttled += 1
+
+	return it.sleep(time.Duration(rand.Int63n(int64(d)) + 1))
+}
+
+func (it *ChangeFeedIterator) pollInterval() time.Duration {
+
+	d := it.reader.PollInterval
+
+	if d <= 0 {
+		d = CHANGE_FEED_DEFAULT_POLL_INTERVAL
+	}
+
+	return d
+}
+
+// sleep waits for 'd', or until the iterator's context is cancelled.
+func (it *ChangeFeedIterator) sleep(d time.Duration) error {
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-it.ctx.Done():
+		return it.ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// change returns the `changes.SubscriptionChange` described by 'rec'. It returns false if 'rec' describes an item
+// belonging to another tenant.
+func (it *ChangeFeedIterator) change(rec *aws_dynamodbstreams.Record) (*changes.SubscriptionChange, bool, error) {
+
+	opts := it.reader.options
+
+	if opts.Tenant != "" {
+
+		v, ok := rec.Dynamodb.Keys["address"]
+
+		if !ok || v.S == nil || !strings.HasPrefix(*v.S, opts.Tenant+TENANT_SEPARATOR) {
+			return nil, false, nil
+		}
+	}
+
+	ch := &changes.SubscriptionChange{
+		EventName: aws.StringValue(rec.EventName),
+		TableName: opts.FullTableName(),
+		Time:      aws.TimeValue(rec.Dynamodb.ApproximateCreationDateTime),
+	}
+
+	if rec.Dynamodb.OldImage != nil {
+
+		sub, err := it.subscription(rec.Dynamodb.OldImage)
+
+		if err != nil {
+			return nil, false, fmt.Errorf("Failed to decode old subscription, %w", err)
+		}
+
+		ch.Old = sub
+	}
+
+	if rec.Dynamodb.NewImage != nil {
+
+		sub, err := it.subscription(rec.Dynamodb.NewImage)
+
+		if err != nil {
+			return nil, false, fmt.Errorf("Failed to decode new subscription, %w", err)
+		}
+
+		ch.New = sub
+	}
+
+	return ch, true, nil
+}
+
+// subscription returns the subscription in the stream image 'item', upgraded and restored in the same way as
+// the items read from the table. Images are never written back to the table.
+func (it *ChangeFeedIterator) subscription(item map[string]*aws_dynamodb.AttributeValue) (*subscription.Subscription, error) {
+
+	err := upgradeSubscriptionItem(it.ctx, nil, it.reader.options, item, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = restoreSubscriptionItem(it.ctx, it.reader.options, item)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return itemToSubscription(item)
+}
+
+// Change returns the current change. Old is nil for new subscriptions and New is nil for removed ones.
+func (it *ChangeFeedIterator) Change() *changes.SubscriptionChange {
+	return it.current
+}
+
+// Checkpoint returns the position of the iterator, up to and including the current change, from which a later
+// change feed can resume with `ChangeFeedReader.ChangeFeed`. Changes are read at least once: a change feed
+// resumed from a checkpoint saved after processing each change returns no change twice, but one resumed from an
+// older checkpoint repeats the changes since it was saved.
+func (it *ChangeFeedIterator) Checkpoint() *ChangeFeedCheckpoint {
+
+	cp := &ChangeFeedCheckpoint{
+		StreamArn: it.stream,
+		Shards:    make(map[string]string, len(it.positions)),
+	}
+
+	for id, seq := range it.positions {
+
+		if !it.closed[id] {
+			cp.Shards[id] = seq
+		}
+	}
+
+	for id := range it.closed {
+		cp.Closed = append(cp.Closed, id)
+	}
+
+	sort.Strings(cp.Closed)
+	return cp
+}
+
+// Err returns the first error encountered while reading the change feed, if any.
+func (it *ChangeFeedIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iterator; no further records will be fetched and subsequent calls to `Next` return false.
+func (it *ChangeFeedIterator) Close() error {
+	it.stopped = true
+	it.records = nil
+	return nil
+}
@@ -0,0 +1,197 @@
+package dynamodb
+
+import (
+	"context"
+	aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	aws_dynamodbstreams "github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	aws_dynamodbstreamsiface "github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testStreamArn string = "arn:aws:dynamodb:us-east-1:123456789012:table/subscriptions/stream/2024-01-01T00:00:00.000"
+
+// testStreamsClient is a `DynamoDBStreamsAPI` whose stream has the shards 'shards' and whose GetRecords requests
+// fail with LimitExceededException 'limited' times before succeeding.
+type testStreamsClient struct {
+	aws_dynamodbstreamsiface.DynamoDBStreamsAPI
+	shards  []*aws_dynamodbstreams.Shard
+	limited int
+	reads   int
+}
+
+func (c *testStreamsClient) DescribeStreamWithContext(ctx context.Context, req *aws_dynamodbstreams.DescribeStreamInput, opts ...request.Option) (*aws_dynamodbstreams.DescribeStreamOutput, error) {
+
+	rsp := &aws_dynamodbstreams.DescribeStreamOutput{
+		StreamDescription: &aws_dynamodbstreams.StreamDescription{
+			StreamArn:      req.StreamArn,
+			StreamViewType: aws.String(aws_dynamodbstreams.StreamViewTypeNewAndOldImages),
+			Shards:         c.shards,
+		},
+	}
+
+	return rsp, nil
+}
+
+func (c *testStreamsClient) GetShardIteratorWithContext(ctx context.Context, req *aws_dynamodbstreams.GetShardIteratorInput, opts ...request.Option) (*aws_dynamodbstreams.GetShardIteratorOutput, error) {
+
+	rsp := &aws_dynamodbstreams.GetShardIteratorOutput{
+		ShardIterator: aws.String("iterator-" + aws.StringValue(req.ShardId)),
+	}
+
+	return rsp, nil
+}
+
+func (c *testStreamsClient) GetRecordsWithContext(ctx context.Context, req *aws_dynamodbstreams.GetRecordsInput, opts ...request.Option) (*aws_dynamodbstreams.GetRecordsOutput, error) {
+
+	c.reads += 1
+
+	if c.reads <= c.limited {
+		return nil, awserr.New(aws_dynamodbstreams.ErrCodeLimitExceededException, "Rate exceeded", nil)
+	}
+
+	rsp := &aws_dynamodbstreams.GetRecordsOutput{
+		Records: []*aws_dynamodbstreams.Record{
+			{
+				EventName: aws.String("INSERT"),
+				Dynamodb: &aws_dynamodbstreams.StreamRecord{
+					SequenceNumber: aws.String("100"),
+				},
+			},
+		},
+		NextShardIterator: req.ShardIterator,
+	}
+
+	return rsp, nil
+}
+
+func testShard(id string, parent string, open bool) *aws_dynamodbstreams.Shard {
+
+	s := &aws_dynamodbstreams.Shard{
+		ShardId: aws.String(id),
+		SequenceNumberRange: &aws_dynamodbstreams.SequenceNumberRange{
+			StartingSequenceNumber: aws.String("1"),
+		},
+	}
+
+	if parent != "" {
+		s.ParentShardId = aws.String(parent)
+	}
+
+	if !open {
+		s.SequenceNumberRange.EndingSequenceNumber = aws.String("99")
+	}
+
+	return s
+}
+
+func TestChangeFeedCheckpointPrunesTrimmedShards(t *testing.T) {
+
+	ctx := context.Background()
+
+	client := &testStreamsClient{
+		shards: []*aws_dynamodbstreams.Shard{
+			testShard("kept", "", false),
+			testShard("child", "kept", true),
+		},
+	}
+
+	reader := &ChangeFeedReader{
+		client:  client,
+		options: DefaultDynamoDBSubscriptionsDatabaseOptions(),
+	}
+
+	since := &ChangeFeedCheckpoint{
+		StreamArn: testStreamArn,
+		Shards: map[string]string{
+			"child":   "50",
+			"trimmed": "10",
+		},
+		Closed: []string{"kept", "trimmed-closed"},
+	}
+
+	it := reader.ChangeFeed(ctx, since)
+
+	err := it.start()
+
+	if err != nil {
+		t.Fatalf("Failed to start change feed, %v", err)
+	}
+
+	cp := it.Checkpoint()
+
+	if !reflect.DeepEqual(cp.Closed, []string{"kept"}) {
+		t.Fatalf("Expected closed shards to be pruned to those in the stream, got %v", cp.Closed)
+	}
+
+	if !reflect.DeepEqual(cp.Shards, map[string]string{"child": "50"}) {
+		t.Fatalf("Expected positions to be pruned to the shards in the stream, got %v", cp.Shards)
+	}
+
+	// the child of a closed shard is read straight away
+
+	shard := it.nextShard()
+
+	if shard == nil || shard.id != "child" {
+		t.Fatalf("Expected child shard to be read next, got %v", shard)
+	}
+}
+
+func TestChangeFeedLimitExceeded(t *testing.T) {
+
+	ctx := context.Background()
+
+	client := &testStreamsClient{
+		shards: []*aws_dynamodbstreams.Shard{
+			testShard("shard", "", true),
+		},
+		limited: 3,
+	}
+
+	reader := &ChangeFeedReader{
+		client:       client,
+		options:      DefaultDynamoDBSubscriptionsDatabaseOptions(),
+		PollInterval: time.Millisecond,
+	}
+
+	it := reader.ChangeFeed(ctx, &ChangeFeedCheckpoint{StreamArn: testStreamArn})
+
+	err := it.start()
+
+	if err != nil {
+		t.Fatalf("Failed to start change feed, %v", err)
+	}
+
+	records, err := it.fetch(it.nextShard())
+
+	if err != nil {
+		t.Fatalf("Failed to fetch records, %v", err)
+	}
+
+	if len(records) != 1 || client.reads != 4 {
+		t.Fatalf("Expected records after 3 rejected reads, got %d records after %d reads", len(records), client.reads)
+	}
+
+	if it.throttled != 0 {
+		t.Fatalf("Expected backoff to be reset after a successful read")
+	}
+
+	// a reader which is always rejected stops waiting when its context is cancelled
+
+	client.reads = 0
+	client.limited = 1000
+
+	cancel_ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	it.ctx = cancel_ctx
+
+	_, err = it.fetch(it.nextShard())
+
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected context deadline error, got %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+// package changes decodes the change records DynamoDB writes to a Kinesis data stream (see the KinesisStreamArn
+// database option) into typed subscription and confirmation change events.
+package changes
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"time"
+)
+
+// EVENT_INSERT is the event name for records describing a newly created item.
+const EVENT_INSERT string = "INSERT"
+
+// EVENT_MODIFY is the event name for records describing an updated item.
+const EVENT_MODIFY string = "MODIFY"
+
+// EVENT_REMOVE is the event name for records describing a deleted item.
+const EVENT_REMOVE string = "REMOVE"
+
+// Record is a change record as written by DynamoDB to a Kinesis data stream.
+type Record struct {
+	AWSRegion    string        `json:"awsRegion"`
+	EventID      string        `json:"eventID"`
+	EventName    string        `json:"eventName"`
+	EventSource  string        `json:"eventSource"`
+	RecordFormat string        `json:"recordFormat"`
+	TableName    string        `json:"tableName"`
+	DynamoDB     *StreamRecord `json:"dynamodb"`
+}
+
+// StreamRecord is the `dynamodb` property of a `Record`, describing the item that changed.
+type StreamRecord struct {
+	// ApproximateCreationDateTime is the time of the change, in the units defined by ApproximateCreationDateTimePrecision.
+	ApproximateCreationDateTime          float64                                 `json:"ApproximateCreationDateTime"`
+	ApproximateCreationDateTimePrecision string                                  `json:"ApproximateCreationDateTimePrecision,omitempty"`
+	Keys                                 map[string]*aws_dynamodb.AttributeValue `json:"Keys"`
+	NewImage                             map[string]*aws_dynamodb.AttributeValue `json:"NewImage,omitempty"`
+	OldImage                             map[string]*aws_dynamodb.AttributeValue `json:"OldImage,omitempty"`
+	SizeBytes                            int64                                   `json:"SizeBytes"`
+}
+
+// SubscriptionChange is a change to a record in the subscriptions table. Old is nil for inserts and New is nil for removals.
+type SubscriptionChange struct {
+	EventName string
+	TableName string
+	Time      time.Time
+	Old       *subscription.Subscription
+	New       *subscription.Subscription
+}
+
+// ConfirmationChange is a change to a record in the confirmations table. Old is nil for inserts and New is nil for removals.
+type ConfirmationChange struct {
+	EventName string
+	TableName string
+	Time      time.Time
+	Old       *confirmation.Confirmation
+	New       *confirmation.Confirmation
+}
+
+// ParseRecord parses the data of a Kinesis record written by DynamoDB.
+func ParseRecord(data []byte) (*Record, error) {
+
+	var r *Record
+
+	err := json.Unmarshal(data, &r)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal record, %w", err)
+	}
+
+	if r == nil || r.DynamoDB == nil {
+		return nil, fmt.Errorf("Record is missing DynamoDB change data")
+	}
+
+	return r, nil
+}
+
+// Time returns the approximate time of the change described by 'r'.
+func (r *Record) Time() time.Time {
+
+	t := int64(r.DynamoDB.ApproximateCreationDateTime)
+
+	switch r.DynamoDB.ApproximateCreationDateTimePrecision {
+	case "MICROSECOND":
+		return time.UnixMicro(t)
+	default:
+		return time.UnixMilli(t)
+	}
+}
+
+// DecodeSubscriptionChange decodes the data of a Kinesis record written for the subscriptions table.
+func DecodeSubscriptionChange(data []byte) (*SubscriptionChange, error) {
+
+	r, err := ParseRecord(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return SubscriptionChangeFromRecord(r)
+}
+
+// SubscriptionChangeFromRecord returns the `SubscriptionChange` described by 'r'.
+func SubscriptionChangeFromRecord(r *Record) (*SubscriptionChange, error) {
+
+	ch := &SubscriptionChange{
+		EventName: r.EventName,
+		TableName: r.TableName,
+		Time:      r.Time(),
+	}
+
+	if r.DynamoDB.OldImage != nil {
+
+		var sub *subscription.Subscription
+
+		err := aws_dynamodbattribute.UnmarshalMap(r.DynamoDB.OldImage, &sub)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal old subscription, %w", err)
+		}
+
+		ch.Old = sub
+	}
+
+	if r.DynamoDB.NewImage != nil {
+
+		var sub *subscription.Subscription
+
+		err := aws_dynamodbattribute.UnmarshalMap(r.DynamoDB.NewImage, &sub)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal new subscription, %w", err)
+		}
+
+		ch.New = sub
+	}
+
+	return ch, nil
+}
+
+// DecodeConfirmationChange decodes the data of a Kinesis record written for the confirmations table.
+func DecodeConfirmationChange(data []byte) (*ConfirmationChange, error) {
+
+	r, err := ParseRecord(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ConfirmationChangeFromRecord(r)
+}
+
+// ConfirmationChangeFromRecord returns the `ConfirmationChange` described by 'r'.
+func ConfirmationChangeFromRecord(r *Record) (*ConfirmationChange, error) {
+
+	ch := &ConfirmationChange{
+		EventName: r.EventName,
+		TableName: r.TableName,
+		Time:      r.Time(),
+	}
+
+	if r.DynamoDB.OldImage != nil {
+
+		var conf *confirmation.Confirmation
+
+		err := aws_dynamodbattribute.UnmarshalMap(r.DynamoDB.OldImage, &conf)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal old confirmation, %w", err)
+		}
+
+		ch.Old = conf
+	}
+
+	if r.DynamoDB.NewImage != nil {
+
+		var conf *confirmation.Confirmation
+
+		err := aws_dynamodbattribute.UnmarshalMap(r.DynamoDB.NewImage, &conf)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal new confirmation, %w", err)
+		}
+
+		ch.New = conf
+	}
+
+	return ch, nil
+}
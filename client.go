@@ -0,0 +1,64 @@
+package dynamodb
+
+import (
+	aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbstreams "github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"net/http"
+)
+
+// clientOptions are the client settings shared by each of the database options.
+type clientOptions struct {
+	HTTPClient           *http.Client
+	Region               string
+	Endpoint             string
+	UseFIPSEndpoint      bool
+	UseDualStackEndpoint bool
+	Retry                *RetryOptions
+}
+
+// newDynamoDBClient returns a new DynamoDB client for 'sess' with 'opts' applied on top of the session's configuration.
+func newDynamoDBClient(sess *aws_session.Session, opts *clientOptions) *aws_dynamodb.DynamoDB {
+	return aws_dynamodb.New(sess, opts.config())
+}
+
+// newDynamoDBStreamsClient returns a new DynamoDB Streams client for 'sess' with 'opts' applied on top of the
+// session's configuration.
+func newDynamoDBStreamsClient(sess *aws_session.Session, opts *clientOptions) *aws_dynamodbstreams.DynamoDBStreams {
+	return aws_dynamodbstreams.New(sess, opts.config())
+}
+
+// config returns the `aws.Config` for 'opts'.
+func (opts *clientOptions) config() *aws.Config {
+
+	cfg := aws.NewConfig()
+
+	if opts.HTTPClient != nil {
+		cfg = cfg.WithHTTPClient(opts.HTTPClient)
+	}
+
+	if opts.Region != "" {
+		cfg = cfg.WithRegion(opts.Region)
+	}
+
+	if opts.Endpoint != "" {
+		cfg = cfg.WithEndpoint(opts.Endpoint)
+	}
+
+	if opts.UseFIPSEndpoint {
+		cfg.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+	}
+
+	if opts.UseDualStackEndpoint {
+		cfg.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+	}
+
+	if opts.Retry != nil {
+		cfg.Retryer = newRetryer(opts.Retry)
+		cfg.EnforceShouldRetryCheck = aws.Bool(true)
+	}
+
+	return cfg
+}
@@ -0,0 +1,277 @@
+// package cloudformation renders the table definitions expected by the go-mailinglist-database-dynamodb
+// package as AWS CloudFormation templates.
+package cloudformation
+
+import (
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"regexp"
+	"strings"
+)
+
+const TEMPLATE_FORMAT_VERSION string = "2010-09-09"
+
+const DYNAMODB_TABLE_RESOURCE string = "AWS::DynamoDB::Table"
+
+var re_logical_id = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+type Template struct {
+	AWSTemplateFormatVersion string               `json:"AWSTemplateFormatVersion"`
+	Description              string               `json:"Description,omitempty"`
+	Resources                map[string]*Resource `json:"Resources"`
+}
+
+type Resource struct {
+	Type       string           `json:"Type"`
+	Properties *TableProperties `json:"Properties"`
+}
+
+type TableProperties struct {
+	TableName                        string                            `json:"TableName"`
+	BillingMode                      string                            `json:"BillingMode,omitempty"`
+	AttributeDefinitions             []*AttributeDefinition            `json:"AttributeDefinitions"`
+	KeySchema                        []*KeySchemaElement               `json:"KeySchema"`
+	GlobalSecondaryIndexes           []*GlobalSecondaryIndex           `json:"GlobalSecondaryIndexes,omitempty"`
+	ProvisionedThroughput            *ProvisionedThroughput            `json:"ProvisionedThroughput,omitempty"`
+	TimeToLiveSpecification          *TimeToLiveSpecification          `json:"TimeToLiveSpecification,omitempty"`
+	PointInTimeRecoverySpecification *PointInTimeRecoverySpecification `json:"PointInTimeRecoverySpecification,omitempty"`
+	DeletionProtectionEnabled        bool                              `json:"DeletionProtectionEnabled,omitempty"`
+	TableClass                       string                            `json:"TableClass,omitempty"`
+	ContributorInsightsSpecification *ContributorInsightsSpecification `json:"ContributorInsightsSpecification,omitempty"`
+	KinesisStreamSpecification       *KinesisStreamSpecification       `json:"KinesisStreamSpecification,omitempty"`
+	StreamSpecification              *StreamSpecification              `json:"StreamSpecification,omitempty"`
+	Tags                             []*Tag                            `json:"Tags,omitempty"`
+}
+
+type AttributeDefinition struct {
+	AttributeName string `json:"AttributeName"`
+	AttributeType string `json:"AttributeType"`
+}
+
+type KeySchemaElement struct {
+	AttributeName string `json:"AttributeName"`
+	KeyType       string `json:"KeyType"`
+}
+
+type GlobalSecondaryIndex struct {
+	IndexName                        string                            `json:"IndexName"`
+	KeySchema                        []*KeySchemaElement               `json:"KeySchema"`
+	Projection                       *Projection                       `json:"Projection"`
+	ProvisionedThroughput            *ProvisionedThroughput            `json:"ProvisionedThroughput,omitempty"`
+	ContributorInsightsSpecification *ContributorInsightsSpecification `json:"ContributorInsightsSpecification,omitempty"`
+}
+
+type Projection struct {
+	ProjectionType   string   `json:"ProjectionType"`
+	NonKeyAttributes []string `json:"NonKeyAttributes,omitempty"`
+}
+
+type ProvisionedThroughput struct {
+	ReadCapacityUnits  int64 `json:"ReadCapacityUnits"`
+	WriteCapacityUnits int64 `json:"WriteCapacityUnits"`
+}
+
+type TimeToLiveSpecification struct {
+	AttributeName string `json:"AttributeName"`
+	Enabled       bool   `json:"Enabled"`
+}
+
+type PointInTimeRecoverySpecification struct {
+	PointInTimeRecoveryEnabled bool `json:"PointInTimeRecoveryEnabled"`
+}
+
+type ContributorInsightsSpecification struct {
+	Enabled bool `json:"Enabled"`
+}
+
+type KinesisStreamSpecification struct {
+	StreamArn string `json:"StreamArn"`
+}
+
+type StreamSpecification struct {
+	StreamViewType string `json:"StreamViewType"`
+}
+
+type Tag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+// NewTemplate returns a new `Template` containing an AWS::DynamoDB::Table resource for each of 'defs'.
+func NewTemplate(defs ...*dynamodb.TableDefinition) (*Template, error) {
+
+	resources := make(map[string]*Resource)
+
+	for _, def := range defs {
+
+		if def.Input == nil || def.Input.TableName == nil {
+			return nil, fmt.Errorf("Table definition is missing a table name")
+		}
+
+		table_name := *def.Input.TableName
+		id := LogicalId(table_name)
+
+		_, exists := resources[id]
+
+		if exists {
+			return nil, fmt.Errorf("Table %s results in a duplicate logical ID (%s)", table_name, id)
+		}
+
+		resources[id] = &Resource{
+			Type:       DYNAMODB_TABLE_RESOURCE,
+			Properties: NewTableProperties(def),
+		}
+	}
+
+	t := &Template{
+		AWSTemplateFormatVersion: TEMPLATE_FORMAT_VERSION,
+		Description:              "DynamoDB tables for go-mailinglist-database-dynamodb",
+		Resources:                resources,
+	}
+
+	return t, nil
+}
+
+// LogicalId derives a CloudFormation logical resource ID from 'table_name', for example
+// "prod_subscriptions" becomes "ProdSubscriptionsTable".
+func LogicalId(table_name string) string {
+
+	parts := re_logical_id.Split(table_name, -1)
+
+	var b strings.Builder
+
+	for _, p := range parts {
+
+		if p == "" {
+			continue
+		}
+
+		b.WriteString(strings.ToUpper(p[0:1]))
+		b.WriteString(p[1:])
+	}
+
+	b.WriteString("Table")
+	return b.String()
+}
+
+// NewTableProperties returns the AWS::DynamoDB::Table properties for 'def'.
+func NewTableProperties(def *dynamodb.TableDefinition) *TableProperties {
+
+	in := def.Input
+
+	props := &TableProperties{
+		TableName:                 aws.StringValue(in.TableName),
+		BillingMode:               aws.StringValue(in.BillingMode),
+		AttributeDefinitions:      make([]*AttributeDefinition, 0),
+		KeySchema:                 newKeySchema(in.KeySchema),
+		DeletionProtectionEnabled: aws.BoolValue(in.DeletionProtectionEnabled),
+		TableClass:                aws.StringValue(in.TableClass),
+	}
+
+	for _, a := range in.AttributeDefinitions {
+
+		props.AttributeDefinitions = append(props.AttributeDefinitions, &AttributeDefinition{
+			AttributeName: aws.StringValue(a.AttributeName),
+			AttributeType: aws.StringValue(a.AttributeType),
+		})
+	}
+
+	for _, idx := range in.GlobalSecondaryIndexes {
+
+		gsi := &GlobalSecondaryIndex{
+			IndexName: aws.StringValue(idx.IndexName),
+			KeySchema: newKeySchema(idx.KeySchema),
+		}
+
+		if idx.Projection != nil {
+
+			gsi.Projection = &Projection{
+				ProjectionType: aws.StringValue(idx.Projection.ProjectionType),
+			}
+
+			for _, a := range idx.Projection.NonKeyAttributes {
+				gsi.Projection.NonKeyAttributes = append(gsi.Projection.NonKeyAttributes, *a)
+			}
+		}
+
+		if idx.ProvisionedThroughput != nil {
+			gsi.ProvisionedThroughput = &ProvisionedThroughput{
+				ReadCapacityUnits:  aws.Int64Value(idx.ProvisionedThroughput.ReadCapacityUnits),
+				WriteCapacityUnits: aws.Int64Value(idx.ProvisionedThroughput.WriteCapacityUnits),
+			}
+		}
+
+		if def.ContributorInsights {
+			gsi.ContributorInsightsSpecification = &ContributorInsightsSpecification{
+				Enabled: true,
+			}
+		}
+
+		props.GlobalSecondaryIndexes = append(props.GlobalSecondaryIndexes, gsi)
+	}
+
+	if in.ProvisionedThroughput != nil {
+		props.ProvisionedThroughput = &ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64Value(in.ProvisionedThroughput.ReadCapacityUnits),
+			WriteCapacityUnits: aws.Int64Value(in.ProvisionedThroughput.WriteCapacityUnits),
+		}
+	}
+
+	if def.TimeToLiveAttribute != "" {
+		props.TimeToLiveSpecification = &TimeToLiveSpecification{
+			AttributeName: def.TimeToLiveAttribute,
+			Enabled:       true,
+		}
+	}
+
+	if def.PointInTimeRecovery {
+		props.PointInTimeRecoverySpecification = &PointInTimeRecoverySpecification{
+			PointInTimeRecoveryEnabled: true,
+		}
+	}
+
+	if def.ContributorInsights {
+		props.ContributorInsightsSpecification = &ContributorInsightsSpecification{
+			Enabled: true,
+		}
+	}
+
+	if def.KinesisStreamArn != "" {
+		props.KinesisStreamSpecification = &KinesisStreamSpecification{
+			StreamArn: def.KinesisStreamArn,
+		}
+	}
+
+	if in.StreamSpecification != nil && aws.BoolValue(in.StreamSpecification.StreamEnabled) {
+		props.StreamSpecification = &StreamSpecification{
+			StreamViewType: aws.StringValue(in.StreamSpecification.StreamViewType),
+		}
+	}
+
+	for _, t := range in.Tags {
+
+		props.Tags = append(props.Tags, &Tag{
+			Key:   aws.StringValue(t.Key),
+			Value: aws.StringValue(t.Value),
+		})
+	}
+
+	return props
+}
+
+func newKeySchema(elements []*aws_dynamodb.KeySchemaElement) []*KeySchemaElement {
+
+	schema := make([]*KeySchemaElement, 0)
+
+	for _, k := range elements {
+
+		schema = append(schema, &KeySchemaElement{
+			AttributeName: aws.StringValue(k.AttributeName),
+			KeyType:       aws.StringValue(k.KeyType),
+		})
+	}
+
+	return schema
+}
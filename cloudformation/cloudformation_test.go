@@ -0,0 +1,70 @@
+package cloudformation
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"github.com/aaronland/go-mailinglist-database-dynamodb/dynamodbtest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files in testdata with the current output.")
+
+func TestNewTemplate(t *testing.T) {
+
+	tpl, err := NewTemplate(dynamodbtest.TableDefinitions("expires")...)
+
+	if err != nil {
+		t.Fatalf("Failed to create template, %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+
+	err = enc.Encode(tpl)
+
+	if err != nil {
+		t.Fatalf("Failed to encode template, %v", err)
+	}
+
+	path := filepath.Join("testdata", "tables.json")
+
+	if *update {
+
+		err = os.WriteFile(path, buf.Bytes(), 0644)
+
+		if err != nil {
+			t.Fatalf("Failed to write %s, %v", path, err)
+		}
+	}
+
+	expected, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("Failed to read %s, %v", path, err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("Template does not match %s, got:\n%s", path, buf.String())
+	}
+}
+
+func TestNewTemplateWithoutTimeToLive(t *testing.T) {
+
+	tpl, err := NewTemplate(dynamodbtest.TableDefinitions("")...)
+
+	if err != nil {
+		t.Fatalf("Failed to create template, %v", err)
+	}
+
+	for id, r := range tpl.Resources {
+
+		if r.Properties.TimeToLiveSpecification != nil {
+			t.Fatalf("Expected no TimeToLiveSpecification for %s, got %v", id, r.Properties.TimeToLiveSpecification)
+		}
+	}
+}
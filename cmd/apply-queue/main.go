@@ -0,0 +1,79 @@
+// apply-queue is a command-line tool to apply the subscription changes enqueued to an SQS queue by a
+// `WriteBehindSubscriptionsDatabase`, until interrupted.
+//
+//	$> ./bin/apply-queue -dsn 'region=us-east-1 credentials=session' -table-prefix prod_ -queue-url https://sqs.us-east-1.amazonaws.com/123456789012/subscriptions.fifo
+//
+// Use `-once` to exit once the queue is empty, for example when run on a schedule.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+	queue_url := flag.String("queue-url", "", "The URL of the SQS queue subscription changes are enqueued to.")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	once := flag.Bool("once", false, "Exit once the queue is empty rather than waiting for more changes.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Apply subscription changes enqueued to an SQS queue by a write-behind subscriptions database.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = *subs_table
+	subs_opts.TablePrefix = *table_prefix
+	subs_opts.TableSuffix = *table_suffix
+
+	subs_db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, subs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create subscriptions database, %v", err)
+	}
+
+	db, err := dynamodb.NewWriteBehindSubscriptionsDatabaseWithDSN(subs_db, *dsn, *queue_url)
+
+	if err != nil {
+		log.Fatalf("Failed to create write-behind database, %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	total := 0
+
+	for ctx.Err() == nil {
+
+		count, err := db.Apply(ctx)
+		total += count
+
+		// failed changes remain on the queue to be retried so keep going
+
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to apply changes, %v", err)
+		}
+
+		if *once && count == 0 && err == nil {
+			break
+		}
+	}
+
+	log.Printf("Applied %d changes\n", total)
+}
@@ -0,0 +1,283 @@
+// bench is a command-line tool to drive a configurable mix of `GetItem`, `PutItem` and `Scan` requests against a
+// subscriptions table, ideally a [DynamoDB Local] instance or a dedicated test table, and report latency percentiles
+// and throttling.
+//
+//	$> ./bin/bench -dsn 'region=us-east-1 credentials=static:local:local:' -endpoint http://localhost:8000 -create-table \
+//		-subscriptions-table bench -duration 60s -get-rate 200 -put-rate 50
+//
+// Requests which can not be started because `-concurrency` requests are already in flight are reported as "dropped".
+//
+// [DynamoDB Local]: https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/DynamoDBLocal.html
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// results collects the latencies and errors for one kind of operation.
+type results struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+	throttled int
+	dropped   int
+}
+
+func (r *results) record(d time.Duration, err error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.latencies = append(r.latencies, d)
+
+	if err != nil {
+
+		r.errors += 1
+
+		if errors.Is(err, dynamodb.ErrThrottled) {
+			r.throttled += 1
+		}
+	}
+}
+
+func (r *results) drop() {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dropped += 1
+}
+
+func (r *results) percentile(p float64) time.Duration {
+
+	if len(r.latencies) == 0 {
+		return 0
+	}
+
+	idx := int(p/100*float64(len(r.latencies))+0.5) - 1
+
+	if idx < 0 {
+		idx = 0
+	}
+
+	if idx >= len(r.latencies) {
+		idx = len(r.latencies) - 1
+	}
+
+	return r.latencies[idx]
+}
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+	endpoint := flag.String("endpoint", "", "An optional DynamoDB endpoint URL, for example http://localhost:8000 for DynamoDB Local.")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	create_table := flag.Bool("create-table", false, "Create the subscriptions table if it does not exist.")
+
+	duration := flag.Duration("duration", 30*time.Second, "How long to run the benchmark for.")
+	concurrency := flag.Int("concurrency", 16, "The maximum number of requests in flight at once.")
+	keyspace := flag.Int("keyspace", 10000, "The number of distinct (bench-N@example.com) addresses to read and write.")
+
+	get_rate := flag.Float64("get-rate", 50, "GetSubscriptionWithAddress requests per second.")
+	put_rate := flag.Float64("put-rate", 10, "UpdateSubscription (PutItem) requests per second.")
+	scan_rate := flag.Float64("scan-rate", 1, "Scans (of up to -scan-limit subscriptions) per second.")
+	scan_limit := flag.Int("scan-limit", 100, "The maximum number of subscriptions each scan reads.")
+
+	flag.Parse()
+
+	sess, err := dynamodb.NewSessionWithDSN(*dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to create session, %v", err)
+	}
+
+	if *endpoint != "" {
+		sess.Config.Endpoint = aws.String(*endpoint)
+	}
+
+	// Count every throttled attempt, including the ones the SDK retries successfully
+
+	var throttled_attempts int64
+
+	sess.Handlers.CompleteAttempt.PushBack(func(r *request.Request) {
+
+		if r.Error != nil && request.IsErrorThrottle(r.Error) {
+			atomic.AddInt64(&throttled_attempts, 1)
+		}
+	})
+
+	opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	opts.TableName = *subs_table
+	opts.CreateTable = *create_table
+
+	db, err := dynamodb.NewSubscriptionsDatabaseWithSession(sess, opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create database, %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+
+	addr := func() string {
+		return fmt.Sprintf("bench-%d@example.com", rand.Intn(*keyspace))
+	}
+
+	ops := []struct {
+		label string
+		rate  float64
+		fn    func() error
+	}{
+		{
+			"get", *get_rate,
+			func() error {
+				_, err := db.GetSubscriptionWithAddress(addr())
+
+				if dynamodb.IsNotExist(err) {
+					return nil
+				}
+
+				return err
+			},
+		},
+		{
+			"put", *put_rate,
+			func() error {
+				sub, err := subscription.NewSubscription(addr())
+
+				if err != nil {
+					return err
+				}
+
+				return db.UpdateSubscription(sub)
+			},
+		},
+		{
+			"scan", *scan_rate,
+			func() error {
+				it := db.Subscriptions(ctx, &dynamodb.SubscriptionsIteratorOptions{MaxResults: *scan_limit})
+				defer it.Close()
+
+				for it.Next() {
+				}
+
+				err := it.Err()
+
+				if errors.Is(err, context.DeadlineExceeded) {
+					return nil
+				}
+
+				return err
+			},
+		},
+	}
+
+	throttle := make(chan bool, *concurrency)
+	wg := new(sync.WaitGroup)
+
+	all_results := make(map[string]*results)
+
+	for _, op := range ops {
+
+		if op.rate <= 0 {
+			continue
+		}
+
+		r := &results{
+			latencies: make([]time.Duration, 0),
+		}
+
+		all_results[op.label] = r
+
+		interval := time.Duration(float64(time.Second) / op.rate)
+		fn := op.fn
+
+		wg.Add(1)
+
+		go func() {
+
+			defer wg.Done()
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+
+					select {
+					case throttle <- true:
+					default:
+						// At the concurrency limit; count the missed request rather than queueing it
+						r.drop()
+						continue
+					}
+
+					wg.Add(1)
+
+					go func() {
+
+						defer func() {
+							<-throttle
+							wg.Done()
+						}()
+
+						t1 := time.Now()
+						err := fn()
+						r.record(time.Since(t1), err)
+					}()
+				}
+			}
+		}()
+	}
+
+	log.Printf("Running benchmark against %s for %v\n", opts.FullTableName(), *duration)
+
+	wg.Wait()
+
+	wr := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(wr, "OPERATION\tREQUESTS\tERRORS\tTHROTTLED\tDROPPED\tP50\tP90\tP99\tMAX")
+
+	labels := make([]string, 0)
+
+	for label := range all_results {
+		labels = append(labels, label)
+	}
+
+	sort.Strings(labels)
+
+	for _, label := range labels {
+
+		r := all_results[label]
+
+		sort.Slice(r.latencies, func(i, j int) bool {
+			return r.latencies[i] < r.latencies[j]
+		})
+
+		fmt.Fprintf(wr, "%s\t%d\t%d\t%d\t%d\t%v\t%v\t%v\t%v\n", label, len(r.latencies), r.errors, r.throttled, r.dropped, r.percentile(50), r.percentile(90), r.percentile(99), r.percentile(100))
+	}
+
+	wr.Flush()
+
+	fmt.Printf("\nThrottled attempts (including those retried successfully by the SDK): %d\n", atomic.LoadInt64(&throttled_attempts))
+
+	os.Exit(0)
+}
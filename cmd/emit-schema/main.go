@@ -0,0 +1,228 @@
+// emit-schema is a command-line tool to emit the definitions of the tables this package expects, as JSON, for external
+// provisioning tools and drift checkers: each table's key attributes and their types, primary key, global secondary
+// indexes, TTL attribute, stream settings, point-in-time recovery, deletion protection and tags. It accepts the same
+// flags as `emit-cloudformation` and the output is derived from the same `TableDefinition` instances, using
+// `dynamodb.NewSchema`.
+//
+//	$> ./bin/emit-schema -table-prefix prod_ -subscriptions-prefix-search | jq '.tables[0].key'
+//	{
+//	  "partition_key": "address"
+//	}
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"log"
+	"os"
+	"strings"
+)
+
+type tagFlags []string
+
+func (t *tagFlags) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *tagFlags) Set(value string) error {
+
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("Invalid tag '%s', expected key=value", value)
+	}
+
+	*t = append(*t, value)
+	return nil
+}
+
+func main() {
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
+	logs_table := flag.String("eventlogs-table", dynamodb.EVENTLOGS_DEFAULT_TABLENAME, "...")
+	dlvr_table := flag.String("deliveries-table", dynamodb.DELIVERIES_DEFAULT_TABLENAME, "...")
+	tokens_table := flag.String("unsubscribe-tokens-table", dynamodb.UNSUBSCRIBE_TOKENS_DEFAULT_TABLENAME, "...")
+	queue_table := flag.String("send-queue-table", dynamodb.SEND_QUEUE_DEFAULT_TABLENAME, "The name of the send queue table.")
+	send_queue := flag.Bool("send-queue", false, "Also set up the send queue table.")
+	dead_table := flag.String("dead-letters-table", dynamodb.DEAD_LETTERS_DEFAULT_TABLENAME, "The name of the dead letters table.")
+	dead_letters := flag.Bool("dead-letters", false, "Also set up the dead letters table.")
+	history_table := flag.String("history-table", dynamodb.HISTORY_DEFAULT_TABLENAME, "The name of the subscription history table.")
+	history := flag.Bool("history", false, "Also set up the subscription history table.")
+	stats_table := flag.String("stats-table", dynamodb.STATS_DEFAULT_TABLENAME, "The name of the subscription stats table.")
+	stats := flag.Bool("stats", false, "Also set up the subscription stats table.")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	billing_mode := flag.String("billing-mode", "PAY_PER_REQUEST", "The billing mode for the tables.")
+	pitr := flag.Bool("point-in-time-recovery", false, "Enable point-in-time recovery for the tables.")
+	deletion_protection := flag.Bool("deletion-protection", false, "Enable deletion protection for the tables.")
+	contributor_insights := flag.Bool("contributor-insights", false, "Enable CloudWatch Contributor Insights for the tables and their indexes.")
+	prefix_search := flag.Bool("subscriptions-prefix-search", false, "Add the index used to search subscriptions by address prefix to the subscriptions table.")
+	canonical := flag.Bool("subscriptions-canonical-index", false, "Add the index used to find subscriptions with the same canonical address to the subscriptions table.")
+	modified_index := flag.Bool("subscriptions-modified-index", false, "Add the index used to list subscriptions modified since a given time to the subscriptions table.")
+	subs_stream := flag.String("subscriptions-kinesis-stream-arn", "", "The ARN of an optional Kinesis data stream to stream subscription changes to.")
+	subs_view_type := flag.String("subscriptions-stream-view-type", "", "The view type, for example NEW_AND_OLD_IMAGES, of an optional DynamoDB stream of subscription changes. If empty no stream is enabled.")
+	conf_stream := flag.String("confirmations-kinesis-stream-arn", "", "The ARN of an optional Kinesis data stream to stream confirmation changes to.")
+	conf_key := flag.String("confirmations-key-attribute", dynamodb.CONFIRMATIONS_DEFAULT_KEY_ATTRIBUTE, "The name of the confirmations table's partition key attribute.")
+	conf_expires := flag.String("confirmations-expires-attribute", "", "The name of the attribute for which TTL is enabled on the confirmations table to remove expired confirmations. If empty TTL is not enabled.")
+	tokens_expires := flag.String("unsubscribe-tokens-expires-attribute", "", "The name of the attribute for which TTL is enabled on the unsubscribe tokens table to remove expired tokens. If empty TTL is not enabled.")
+
+	logs_class := flag.String("eventlogs-table-class", "", "The table class for the event logs table, for example STANDARD_INFREQUENT_ACCESS. If empty STANDARD is used.")
+	dlvr_class := flag.String("deliveries-table-class", "", "The table class for the deliveries table, for example STANDARD_INFREQUENT_ACCESS. If empty STANDARD is used.")
+
+	retention_attr := flag.String("retention-attribute", "", "The name of the attribute for which TTL is enabled on the subscriptions, event logs and deliveries tables to enforce their retention policies, for example \"expires\". If empty TTL is not enabled.")
+
+	var tags tagFlags
+	flag.Var(&tags, "tag", "Zero or more key=value tags to assign to the tables.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Emit the definitions of the tables this package expects (keys, indexes, TTL and stream settings) as JSON, for use by external provisioning tools and drift checkers.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	subscribe_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	confirm_opts := dynamodb.DefaultDynamoDBConfirmationsDatabaseOptions()
+	logs_opts := dynamodb.DefaultDynamoDBEventLogsDatabaseOptions()
+	dlvr_opts := dynamodb.DefaultDynamoDBDeliveriesDatabaseOptions()
+	tokens_opts := dynamodb.DefaultDynamoDBUnsubscribeTokensDatabaseOptions()
+	queue_opts := dynamodb.DefaultDynamoDBSendQueueOptions()
+	dead_opts := dynamodb.DefaultDynamoDBDeadLettersDatabaseOptions()
+	history_opts := dynamodb.DefaultDynamoDBHistoryDatabaseOptions()
+	stats_opts := dynamodb.DefaultDynamoDBStatsDatabaseOptions()
+
+	subscribe_opts.TableName = *subs_table
+	subscribe_opts.TablePrefix = *table_prefix
+	subscribe_opts.TableSuffix = *table_suffix
+	subscribe_opts.BillingMode = *billing_mode
+	subscribe_opts.DeletionProtection = *deletion_protection
+	subscribe_opts.ContributorInsights = *contributor_insights
+	subscribe_opts.KinesisStreamArn = *subs_stream
+	subscribe_opts.StreamViewType = *subs_view_type
+	subscribe_opts.PrefixSearch = *prefix_search
+	subscribe_opts.Canonicalize = *canonical
+	subscribe_opts.ModifiedIndex = *modified_index
+	subscribe_opts.RetentionAttribute = *retention_attr
+
+	confirm_opts.TableName = *conf_table
+	confirm_opts.TablePrefix = *table_prefix
+	confirm_opts.TableSuffix = *table_suffix
+	confirm_opts.BillingMode = *billing_mode
+	confirm_opts.DeletionProtection = *deletion_protection
+	confirm_opts.ContributorInsights = *contributor_insights
+	confirm_opts.KinesisStreamArn = *conf_stream
+	confirm_opts.KeyAttribute = *conf_key
+	confirm_opts.ExpiresAttribute = *conf_expires
+
+	logs_opts.TableName = *logs_table
+	logs_opts.TablePrefix = *table_prefix
+	logs_opts.TableSuffix = *table_suffix
+	logs_opts.BillingMode = *billing_mode
+	logs_opts.DeletionProtection = *deletion_protection
+	logs_opts.ContributorInsights = *contributor_insights
+	logs_opts.TableClass = *logs_class
+	logs_opts.RetentionAttribute = *retention_attr
+
+	dlvr_opts.TableName = *dlvr_table
+	dlvr_opts.TablePrefix = *table_prefix
+	dlvr_opts.TableSuffix = *table_suffix
+	dlvr_opts.BillingMode = *billing_mode
+	dlvr_opts.DeletionProtection = *deletion_protection
+	dlvr_opts.ContributorInsights = *contributor_insights
+	dlvr_opts.TableClass = *dlvr_class
+	dlvr_opts.RetentionAttribute = *retention_attr
+
+	tokens_opts.TableName = *tokens_table
+	tokens_opts.TablePrefix = *table_prefix
+	tokens_opts.TableSuffix = *table_suffix
+	tokens_opts.BillingMode = *billing_mode
+	tokens_opts.DeletionProtection = *deletion_protection
+	tokens_opts.ContributorInsights = *contributor_insights
+	tokens_opts.ExpiresAttribute = *tokens_expires
+
+	queue_opts.TableName = *queue_table
+	queue_opts.TablePrefix = *table_prefix
+	queue_opts.TableSuffix = *table_suffix
+	queue_opts.BillingMode = *billing_mode
+	queue_opts.DeletionProtection = *deletion_protection
+	queue_opts.ContributorInsights = *contributor_insights
+
+	dead_opts.TableName = *dead_table
+	dead_opts.TablePrefix = *table_prefix
+	dead_opts.TableSuffix = *table_suffix
+	dead_opts.BillingMode = *billing_mode
+	dead_opts.DeletionProtection = *deletion_protection
+	dead_opts.ContributorInsights = *contributor_insights
+
+	history_opts.TableName = *history_table
+	history_opts.TablePrefix = *table_prefix
+	history_opts.TableSuffix = *table_suffix
+	history_opts.BillingMode = *billing_mode
+	history_opts.DeletionProtection = *deletion_protection
+	history_opts.ContributorInsights = *contributor_insights
+
+	stats_opts.TableName = *stats_table
+	stats_opts.TablePrefix = *table_prefix
+	stats_opts.TableSuffix = *table_suffix
+	stats_opts.BillingMode = *billing_mode
+	stats_opts.DeletionProtection = *deletion_protection
+	stats_opts.ContributorInsights = *contributor_insights
+
+	defs := []*dynamodb.TableDefinition{
+		dynamodb.SubscriptionsTableDefinition(subscribe_opts),
+		dynamodb.ConfirmationsTableDefinition(confirm_opts),
+		dynamodb.EventLogsTableDefinition(logs_opts),
+		dynamodb.DeliveriesTableDefinition(dlvr_opts),
+		dynamodb.UnsubscribeTokensTableDefinition(tokens_opts),
+	}
+
+	if *send_queue {
+		defs = append(defs, dynamodb.SendQueueTableDefinition(queue_opts))
+	}
+
+	if *dead_letters {
+		defs = append(defs, dynamodb.DeadLettersTableDefinition(dead_opts))
+	}
+
+	if *history {
+		defs = append(defs, dynamodb.HistoryTableDefinition(history_opts))
+	}
+
+	if *stats {
+		defs = append(defs, dynamodb.StatsTableDefinition(stats_opts))
+	}
+
+	for _, def := range defs {
+
+		def.PointInTimeRecovery = *pitr
+
+		for _, t := range tags {
+
+			kv := strings.SplitN(t, "=", 2)
+
+			def.Input.Tags = append(def.Input.Tags, &aws_dynamodb.Tag{
+				Key:   aws.String(kv[0]),
+				Value: aws.String(kv[1]),
+			})
+		}
+	}
+
+	schema := dynamodb.NewSchema(defs...)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(schema)
+
+	if err != nil {
+		log.Fatalf("Failed to encode schema, %v", err)
+	}
+
+	os.Exit(0)
+}
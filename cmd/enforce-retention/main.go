@@ -0,0 +1,165 @@
+// enforce-retention is a command-line tool to remove subscriptions, event logs and deliveries which are older than
+// their retention policy allows. A policy is a comma-separated list of `status=duration` rules, where the status is a
+// subscription status (for example `0` for `subscription.SUBSCRIPTION_STATUS_PENDING`) or an event log event, and `*`
+// matches any status without a rule of its own. Durations may be expressed in days.
+//
+//	$> ./bin/enforce-retention -dsn 'region=us-east-1 credentials=session' -table-prefix prod_ \
+//		-subscriptions-retention '0=30d' -eventlogs-retention '*=365d' -deliveries-retention '*=365d'
+//
+// The same policies may be assigned to the `Retention` option of the subscriptions, event logs and deliveries
+// databases. If the `RetentionAttribute` option is also set (and the table was created with the `-retention-attribute`
+// flag of `setup-tables`) each record's expiry time is written to that attribute and DynamoDB's TTL removes it, without
+// needing to run a sweep. Note that TTL only applies to records written after the policy was assigned, so a one-off
+// sweep is still useful for existing records. Use `-dry-run` to report the number of records that would be removed and
+// `-max-read-units` and `-max-write-units` to limit the capacity the sweep consumes.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	logs_table := flag.String("eventlogs-table", dynamodb.EVENTLOGS_DEFAULT_TABLENAME, "...")
+	dlvr_table := flag.String("deliveries-table", dynamodb.DELIVERIES_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	subs_policy := flag.String("subscriptions-retention", "", "A comma-separated list of status=duration rules for subscriptions, for example \"0=30d\". If empty subscriptions are not swept.")
+	logs_policy := flag.String("eventlogs-retention", "", "A comma-separated list of event=duration rules for event logs, for example \"*=365d\". If empty event logs are not swept.")
+	dlvr_policy := flag.String("deliveries-retention", "", "A duration rule for deliveries, for example \"*=365d\". If empty deliveries are not swept.")
+
+	max_read_units := flag.Float64("max-read-units", 0, "The maximum number of read capacity units per second to consume, across all tables. If zero reads are not limited.")
+	max_write_units := flag.Float64("max-write-units", 0, "The maximum number of write capacity units per second to consume, across all tables. If zero writes are not limited.")
+
+	dry_run := flag.Bool("dry-run", false, "Report the number of records that would be removed without removing them.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Remove subscriptions, event logs and deliveries older than the maximum age declared by their retention policies.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	var limiter *dynamodb.CapacityLimiter
+
+	if *max_read_units > 0 || *max_write_units > 0 {
+		limiter = dynamodb.NewCapacityLimiter(*max_read_units, *max_write_units)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+
+	if *subs_policy != "" {
+
+		policy, err := dynamodb.ParseRetentionPolicy(*subs_policy)
+
+		if err != nil {
+			log.Fatalf("Invalid -subscriptions-retention, %v", err)
+		}
+
+		opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+		opts.TableName = *subs_table
+		opts.TablePrefix = *table_prefix
+		opts.TableSuffix = *table_suffix
+		opts.CapacityLimiter = limiter
+		opts.Retention = policy
+
+		db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, opts)
+
+		if err != nil {
+			log.Fatalf("Failed to create subscriptions database, %v", err)
+		}
+
+		count, err := db.EnforceRetention(ctx, now, *dry_run)
+
+		if err != nil {
+			log.Fatalf("Failed to enforce retention for %s, %v", opts.FullTableName(), err)
+		}
+
+		report(opts.FullTableName(), count, *dry_run)
+	}
+
+	if *logs_policy != "" {
+
+		policy, err := dynamodb.ParseRetentionPolicy(*logs_policy)
+
+		if err != nil {
+			log.Fatalf("Invalid -eventlogs-retention, %v", err)
+		}
+
+		opts := dynamodb.DefaultDynamoDBEventLogsDatabaseOptions()
+		opts.TableName = *logs_table
+		opts.TablePrefix = *table_prefix
+		opts.TableSuffix = *table_suffix
+		opts.CapacityLimiter = limiter
+		opts.Retention = policy
+
+		db, err := dynamodb.NewEventLogsDatabaseWithDSN(*dsn, opts)
+
+		if err != nil {
+			log.Fatalf("Failed to create event logs database, %v", err)
+		}
+
+		count, err := db.EnforceRetention(ctx, now, *dry_run)
+
+		if err != nil {
+			log.Fatalf("Failed to enforce retention for %s, %v", opts.FullTableName(), err)
+		}
+
+		report(opts.FullTableName(), count, *dry_run)
+	}
+
+	if *dlvr_policy != "" {
+
+		policy, err := dynamodb.ParseRetentionPolicy(*dlvr_policy)
+
+		if err != nil {
+			log.Fatalf("Invalid -deliveries-retention, %v", err)
+		}
+
+		opts := dynamodb.DefaultDynamoDBDeliveriesDatabaseOptions()
+		opts.TableName = *dlvr_table
+		opts.TablePrefix = *table_prefix
+		opts.TableSuffix = *table_suffix
+		opts.CapacityLimiter = limiter
+		opts.Retention = policy
+
+		db, err := dynamodb.NewDeliveriesDatabaseWithDSN(*dsn, opts)
+
+		if err != nil {
+			log.Fatalf("Failed to create deliveries database, %v", err)
+		}
+
+		count, err := db.EnforceRetention(ctx, now, *dry_run)
+
+		if err != nil {
+			log.Fatalf("Failed to enforce retention for %s, %v", opts.FullTableName(), err)
+		}
+
+		report(opts.FullTableName(), count, *dry_run)
+	}
+
+	os.Exit(0)
+}
+
+func report(table string, count int, dry_run bool) {
+
+	if dry_run {
+		log.Printf("Would remove %d expired records from %s\n", count, table)
+		return
+	}
+
+	log.Printf("Removed %d expired records from %s\n", count, table)
+}
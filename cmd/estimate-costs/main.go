@@ -0,0 +1,276 @@
+// estimate-costs is a command-line tool to estimate the monthly DynamoDB costs of running a list, for both on-demand
+// and provisioned billing modes. Item counts and sizes are read from the tables themselves (sampling up to
+// `-sample-size` items per table) and combined with the expected number of sends, subscribe/confirm flows and exports
+// each month.
+//
+//	$> ./bin/estimate-costs -dsn 'region=us-east-1 credentials=session' -sends-per-month 4 -signups-per-month 500
+//
+// Prices default to `us-east-1` rates and can be changed with the `-on-demand-*`, `-provisioned-*` and `-storage-price`
+// flags. The figures are estimates: they assume eventually consistent reads and that every global secondary index
+// projects the whole item.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	"github.com/aaronland/go-mailinglist/delivery"
+	"github.com/aaronland/go-mailinglist/eventlog"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"log"
+	"math"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const hours_per_month float64 = 730
+
+const seconds_per_month float64 = hours_per_month * 3600
+
+// table describes the measured (or assumed) size of one of the package's tables.
+type table struct {
+	name      string
+	items     int64
+	bytes     int64
+	item_size float64
+	gsis      int
+}
+
+// usage is the number of read and write request units consumed by an operation.
+type usage struct {
+	reads  float64
+	writes float64
+}
+
+func (u usage) add(other usage) usage {
+	return usage{u.reads + other.reads, u.writes + other.writes}
+}
+
+func (u usage) times(n float64) usage {
+	return usage{u.reads * n, u.writes * n}
+}
+
+// readUnits returns the read request units for an eventually consistent read of 'bytes'.
+func readUnits(bytes float64) float64 {
+	return math.Ceil(math.Max(bytes, 1)/4096) * 0.5
+}
+
+// writeUnits returns the write request units for writing an item of 'bytes' to a table with 'gsis' indexes,
+// assuming every index projects the item.
+func writeUnits(bytes float64, gsis int) float64 {
+	return math.Ceil(math.Max(bytes, 1)/1024) * float64(1+gsis)
+}
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
+	logs_table := flag.String("eventlogs-table", dynamodb.EVENTLOGS_DEFAULT_TABLENAME, "...")
+	dlvr_table := flag.String("deliveries-table", dynamodb.DELIVERIES_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	sample_size := flag.Int64("sample-size", 100, "The number of items to sample from each table to estimate average item sizes.")
+
+	sends := flag.Float64("sends-per-month", 4, "The number of messages sent to the whole list each month.")
+	signups := flag.Float64("signups-per-month", 1000, "The number of subscribe/confirm flows each month.")
+	exports := flag.Float64("exports-per-month", 1, "The number of full exports of every table each month.")
+
+	read_price := flag.Float64("on-demand-read-price", 0.125, "The on-demand price (USD) per million read request units.")
+	write_price := flag.Float64("on-demand-write-price", 0.625, "The on-demand price (USD) per million write request units.")
+	rcu_price := flag.Float64("provisioned-read-price", 0.00013, "The provisioned price (USD) per RCU-hour.")
+	wcu_price := flag.Float64("provisioned-write-price", 0.00065, "The provisioned price (USD) per WCU-hour.")
+	storage_price := flag.Float64("storage-price", 0.25, "The price (USD) per GB-month of storage.")
+	peak_factor := flag.Float64("peak-factor", 5, "The ratio of peak to average throughput used to size provisioned capacity.")
+
+	flag.Parse()
+
+	sess, err := dynamodb.NewSessionWithDSN(*dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to create session, %v", err)
+	}
+
+	client := aws_dynamodb.New(sess)
+
+	full_name := func(name string) string {
+		return *table_prefix + name + *table_suffix
+	}
+
+	now := time.Now().Unix()
+
+	sub := &subscription.Subscription{Address: "someone@example.com", Created: now, Confirmed: now, LastModified: now, Status: subscription.SUBSCRIPTION_STATUS_ENABLED}
+	conf := &confirmation.Confirmation{Action: "subscribe", Created: now, Code: fmt.Sprintf("%064d", 0), Address: sub.Address}
+	l := &eventlog.EventLog{Address: sub.Address, Created: time.Now().UnixNano(), Event: eventlog.EVENTLOG_SEND_OK_EVENT, Message: ""}
+	d := &delivery.Delivery{MessageId: "<00000000000000000000@example.com>", Address: sub.Address, Delivered: now}
+
+	subs, err := measureTable(client, full_name(*subs_table), 1, *sample_size, sub)
+
+	if err != nil {
+		log.Fatalf("Failed to measure subscriptions table, %v", err)
+	}
+
+	confs, err := measureTable(client, full_name(*conf_table), 2, *sample_size, conf)
+
+	if err != nil {
+		log.Fatalf("Failed to measure confirmations table, %v", err)
+	}
+
+	logs, err := measureTable(client, full_name(*logs_table), 2, *sample_size, l)
+
+	if err != nil {
+		log.Fatalf("Failed to measure event logs table, %v", err)
+	}
+
+	dlvrs, err := measureTable(client, full_name(*dlvr_table), 1, *sample_size, d)
+
+	if err != nil {
+		log.Fatalf("Failed to measure deliveries table, %v", err)
+	}
+
+	tables := []*table{subs, confs, logs, dlvrs}
+
+	// Sending a message scans the subscriptions table and records a delivery and an event log for each recipient
+
+	per_recipient := usage{0, writeUnits(dlvrs.item_size, dlvrs.gsis) + writeUnits(logs.item_size, logs.gsis)}
+	per_send := usage{readUnits(float64(subs.bytes)), 0}.add(per_recipient.times(float64(subs.items)))
+
+	// A subscribe/confirm flow checks for, adds and later updates a subscription and adds and consumes a confirmation
+
+	per_signup := usage{
+		readUnits(subs.item_size) * 2,
+		writeUnits(subs.item_size, subs.gsis)*2 + writeUnits(confs.item_size, confs.gsis)*2,
+	}
+
+	// An export scans every table
+
+	per_export := usage{}
+
+	for _, t := range tables {
+		per_export = per_export.add(usage{readUnits(float64(t.bytes)), 0})
+	}
+
+	operations := []struct {
+		label   string
+		count   float64
+		per_op  usage
+		monthly usage
+	}{
+		{"sends", *sends, per_send, per_send.times(*sends)},
+		{"signups", *signups, per_signup, per_signup.times(*signups)},
+		{"exports", *exports, per_export, per_export.times(*exports)},
+	}
+
+	wr := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(wr, "TABLE\tITEMS\tBYTES\tAVG ITEM SIZE")
+
+	storage_bytes := int64(0)
+
+	for _, t := range tables {
+		fmt.Fprintf(wr, "%s\t%d\t%d\t%.0f\n", t.name, t.items, t.bytes, t.item_size)
+		storage_bytes += t.bytes
+	}
+
+	fmt.Fprintln(wr, "")
+	fmt.Fprintln(wr, "OPERATION\tPER MONTH\tRRU EACH\tWRU EACH\tRRU MONTHLY\tWRU MONTHLY\tON-DEMAND USD")
+
+	total := usage{}
+
+	for _, op := range operations {
+		cost := op.monthly.reads/1e6*(*read_price) + op.monthly.writes/1e6*(*write_price)
+		fmt.Fprintf(wr, "%s\t%.0f\t%.1f\t%.1f\t%.0f\t%.0f\t%.2f\n", op.label, op.count, op.per_op.reads, op.per_op.writes, op.monthly.reads, op.monthly.writes, cost)
+		total = total.add(op.monthly)
+	}
+
+	on_demand := total.reads/1e6*(*read_price) + total.writes/1e6*(*write_price)
+
+	rcu := math.Max(1, math.Ceil(total.reads/seconds_per_month*(*peak_factor)))
+	wcu := math.Max(1, math.Ceil(total.writes/seconds_per_month*(*peak_factor)))
+	provisioned := rcu*hours_per_month*(*rcu_price) + wcu*hours_per_month*(*wcu_price)
+
+	storage := float64(storage_bytes) / (1024 * 1024 * 1024) * (*storage_price)
+
+	fmt.Fprintln(wr, "")
+	fmt.Fprintln(wr, "BILLING MODE\tCAPACITY\tREQUESTS USD\tSTORAGE USD\tTOTAL USD")
+	fmt.Fprintf(wr, "%s\t%s\t%.2f\t%.2f\t%.2f\n", aws_dynamodb.BillingModePayPerRequest, "-", on_demand, storage, on_demand+storage)
+	fmt.Fprintf(wr, "%s\t%.0f RCU / %.0f WCU\t%.2f\t%.2f\t%.2f\n", aws_dynamodb.BillingModeProvisioned, rcu, wcu, provisioned, storage, provisioned+storage)
+
+	wr.Flush()
+
+	fmt.Println("")
+	fmt.Println("Provisioned capacity is sized from average throughput multiplied by -peak-factor; bursty sends may need more, or auto scaling.")
+
+	os.Exit(0)
+}
+
+// measureTable reads the item count and size of 'name' and samples up to 'sample_size' items to derive an average
+// item size. If the table is empty the size of 'example', marshaled as a DynamoDB item, is used instead.
+func measureTable(client *aws_dynamodb.DynamoDB, name string, gsis int, sample_size int64, example interface{}) (*table, error) {
+
+	t := &table{
+		name: name,
+		gsis: gsis,
+	}
+
+	rsp, err := client.DescribeTable(&aws_dynamodb.DescribeTableInput{
+		TableName: aws.String(name),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.items = aws.Int64Value(rsp.Table.ItemCount)
+	t.bytes = aws.Int64Value(rsp.Table.TableSizeBytes)
+
+	scan_rsp, err := client.Scan(&aws_dynamodb.ScanInput{
+		TableName: aws.String(name),
+		Limit:     aws.Int64(sample_size),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(scan_rsp.Items) > 0 {
+
+		total := 0
+
+		for _, item := range scan_rsp.Items {
+			total += dynamodb.ItemSize(item)
+		}
+
+		t.item_size = float64(total) / float64(len(scan_rsp.Items))
+
+	} else {
+
+		item, err := aws_dynamodbattribute.MarshalMap(example)
+
+		if err != nil {
+			return nil, err
+		}
+
+		t.item_size = float64(dynamodb.ItemSize(item))
+	}
+
+	// DescribeTable values are only updated every six hours or so; prefer sampled values for small tables
+
+	if t.items == 0 && len(scan_rsp.Items) > 0 {
+		t.items = int64(len(scan_rsp.Items))
+	}
+
+	if t.bytes == 0 {
+		t.bytes = int64(t.item_size * float64(t.items))
+	}
+
+	return t, nil
+}
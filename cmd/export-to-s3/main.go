@@ -0,0 +1,197 @@
+// export-to-s3 is a command-line tool to export the tables to S3 using DynamoDB's native [point-in-time export], which
+// produces a consistent snapshot without consuming read capacity. Point-in-time recovery must be enabled on each table.
+//
+//	$> ./bin/export-to-s3 -dsn 'region=us-east-1 credentials=session' -table-prefix prod_ \
+//		-bucket example-backups -prefix mailinglist/2024-01-01 -format DYNAMODB_JSON -wait
+//
+// Each table is exported beneath `{PREFIX}/{TABLE_NAME}`. Use `-tables` to export a subset of the tables and
+// `-export-time` to export them as of an earlier time.
+//
+// [point-in-time export]: https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/S3DataExport.HowItWorks.html
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
+	logs_table := flag.String("eventlogs-table", dynamodb.EVENTLOGS_DEFAULT_TABLENAME, "...")
+	dlvr_table := flag.String("deliveries-table", dynamodb.DELIVERIES_DEFAULT_TABLENAME, "...")
+	tokens_table := flag.String("unsubscribe-tokens-table", dynamodb.UNSUBSCRIBE_TOKENS_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	tables := flag.String("tables", "subscriptions,confirmations,eventlogs,deliveries,unsubscribe-tokens", "A comma-separated list of the tables to export.")
+
+	bucket := flag.String("bucket", "", "The name of the S3 bucket to export to.")
+	bucket_owner := flag.String("bucket-owner", "", "The optional ID of the AWS account that owns the bucket.")
+	s3_prefix := flag.String("prefix", "", "An optional S3 key prefix for the exports. Each table is exported beneath {PREFIX}/{TABLE_NAME}.")
+
+	format := flag.String("format", aws_dynamodb.ExportFormatDynamodbJson, "The export format. Valid options are: DYNAMODB_JSON, ION.")
+	export_time := flag.String("export-time", "", "An optional RFC3339 time to export the tables as of. If empty the current time is used.")
+
+	wait := flag.Bool("wait", false, "Wait for each export to complete before exiting.")
+	poll := flag.Duration("poll-interval", 30*time.Second, "How often to check the status of exports when -wait is set.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Export tables to S3 using DynamoDB's native point-in-time export. Point-in-time recovery must be enabled for each table.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options]\n\nValid options are:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *bucket == "" {
+		log.Fatalf("Missing -bucket flag")
+	}
+
+	switch *format {
+	case aws_dynamodb.ExportFormatDynamodbJson, aws_dynamodb.ExportFormatIon:
+		// pass
+	default:
+		log.Fatalf("Invalid format '%s'", *format)
+	}
+
+	var t *time.Time
+
+	if *export_time != "" {
+
+		v, err := time.Parse(time.RFC3339, *export_time)
+
+		if err != nil {
+			log.Fatalf("Invalid -export-time, %v", err)
+		}
+
+		t = &v
+	}
+
+	names := map[string]string{
+		"subscriptions":      *subs_table,
+		"confirmations":      *conf_table,
+		"eventlogs":          *logs_table,
+		"deliveries":         *dlvr_table,
+		"unsubscribe-tokens": *tokens_table,
+	}
+
+	sess, err := dynamodb.NewSessionWithDSN(*dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to create session, %v", err)
+	}
+
+	client := aws_dynamodb.New(sess)
+	ctx := context.Background()
+
+	exports := make([]string, 0)
+
+	for _, k := range strings.Split(*tables, ",") {
+
+		k = strings.TrimSpace(k)
+
+		name, ok := names[k]
+
+		if !ok {
+			log.Fatalf("Invalid table '%s'", k)
+		}
+
+		table_name := *table_prefix + name + *table_suffix
+
+		rsp, err := client.DescribeTableWithContext(ctx, &aws_dynamodb.DescribeTableInput{
+			TableName: aws.String(table_name),
+		})
+
+		if err != nil {
+			log.Fatalf("Failed to describe %s table, %v", table_name, err)
+		}
+
+		req := &aws_dynamodb.ExportTableToPointInTimeInput{
+			TableArn:     rsp.Table.TableArn,
+			S3Bucket:     aws.String(*bucket),
+			S3Prefix:     aws.String(path.Join(*s3_prefix, table_name)),
+			ExportFormat: aws.String(*format),
+			ExportTime:   t,
+		}
+
+		if *bucket_owner != "" {
+			req.S3BucketOwner = aws.String(*bucket_owner)
+		}
+
+		export_rsp, err := client.ExportTableToPointInTimeWithContext(ctx, req)
+
+		if err != nil {
+			log.Fatalf("Failed to start export for %s table (is point-in-time recovery enabled?), %v", table_name, err)
+		}
+
+		export_arn := aws.StringValue(export_rsp.ExportDescription.ExportArn)
+		exports = append(exports, export_arn)
+
+		log.Printf("Started export of %s to s3://%s/%s (%s)\n", table_name, *bucket, *req.S3Prefix, export_arn)
+	}
+
+	if !*wait {
+		os.Exit(0)
+	}
+
+	failed := false
+
+	for _, export_arn := range exports {
+
+		desc, err := waitForExport(ctx, client, export_arn, *poll)
+
+		if err != nil {
+			log.Fatalf("Failed to check status of %s, %v", export_arn, err)
+		}
+
+		table_arn := aws.StringValue(desc.TableArn)
+
+		switch aws.StringValue(desc.ExportStatus) {
+		case aws_dynamodb.ExportStatusCompleted:
+			log.Printf("Export of %s completed, %d items (%d bytes billed), manifest s3://%s/%s\n", table_arn, aws.Int64Value(desc.ItemCount), aws.Int64Value(desc.BilledSizeBytes), aws.StringValue(desc.S3Bucket), aws.StringValue(desc.ExportManifest))
+		default:
+			log.Printf("Export of %s failed, %s: %s\n", table_arn, aws.StringValue(desc.FailureCode), aws.StringValue(desc.FailureMessage))
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+func waitForExport(ctx context.Context, client *aws_dynamodb.DynamoDB, export_arn string, poll time.Duration) (*aws_dynamodb.ExportDescription, error) {
+
+	for {
+
+		rsp, err := client.DescribeExportWithContext(ctx, &aws_dynamodb.DescribeExportInput{
+			ExportArn: aws.String(export_arn),
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if aws.StringValue(rsp.ExportDescription.ExportStatus) != aws_dynamodb.ExportStatusInProgress {
+			return rsp.ExportDescription, nil
+		}
+
+		time.Sleep(poll)
+	}
+}
@@ -0,0 +1,196 @@
+// grpc-server is a command-line tool to serve the gRPC services defined in grpc/mailinglist.proto, which mirror the
+// go-mailinglist subscriptions, confirmations, event logs and deliveries database interfaces, so that services written
+// in other languages can use a generated, typed client. List methods are server-streaming. Clients must send the token
+// assigned with `-token`, or the `MAILINGLIST_API_TOKEN` environment variable, as a bearer token in the `authorization`
+// metadata.
+//
+//	$> MAILINGLIST_API_TOKEN=s3cret ./bin/grpc-server -dsn 'region=us-east-1 credentials=session' -table-prefix prod_ -listen localhost:8081
+//
+//	$> grpcurl -plaintext -import-path grpc -proto mailinglist.proto -H 'authorization: Bearer s3cret' \
+//		-d '{"address":"bob@example.com"}' localhost:8081 mailinglist.Subscriptions/GetSubscriptionWithAddress
+//
+// Errors are returned with the gRPC status code for their kind, for example `NOT_FOUND` for missing records,
+// `ALREADY_EXISTS` for existing ones and `ABORTED` for conflicting updates. Use `-tls-certificate` and `-tls-key` to
+// serve requests over TLS and `-read-only` to reject every change. The services themselves, in the `grpc` package,
+// accept any go-mailinglist database and can be registered with your own `grpc.Server`.
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	mailinglist_grpc "github.com/aaronland/go-mailinglist-database-dynamodb/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+	listen := flag.String("listen", "localhost:8081", "The address to listen for requests on.")
+	token := flag.String("token", os.Getenv("MAILINGLIST_API_TOKEN"), "The bearer token clients must send in the authorization metadata. Defaults to the MAILINGLIST_API_TOKEN environment variable.")
+
+	tls_cert := flag.String("tls-certificate", "", "The path to an optional TLS certificate to serve requests with.")
+	tls_key := flag.String("tls-key", "", "The path to the key for -tls-certificate.")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
+	logs_table := flag.String("eventlogs-table", dynamodb.EVENTLOGS_DEFAULT_TABLENAME, "...")
+	deliveries_table := flag.String("deliveries-table", dynamodb.DELIVERIES_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	read_only := flag.Bool("read-only", false, "Reject every request which would change a table.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Serve the gRPC services, defined in grpc/mailinglist.proto, for the subscriptions, confirmations, event logs and deliveries databases.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *token == "" {
+		log.Fatalf("Missing -token flag")
+	}
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = *subs_table
+	subs_opts.TablePrefix = *table_prefix
+	subs_opts.TableSuffix = *table_suffix
+	subs_opts.ReadOnly = *read_only
+
+	subs_db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, subs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create subscriptions database, %v", err)
+	}
+
+	conf_opts := dynamodb.DefaultDynamoDBConfirmationsDatabaseOptions()
+	conf_opts.TableName = *conf_table
+	conf_opts.TablePrefix = *table_prefix
+	conf_opts.TableSuffix = *table_suffix
+	conf_opts.ReadOnly = *read_only
+
+	conf_db, err := dynamodb.NewConfirmationsDatabaseWithDSN(*dsn, conf_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create confirmations database, %v", err)
+	}
+
+	logs_opts := dynamodb.DefaultDynamoDBEventLogsDatabaseOptions()
+	logs_opts.TableName = *logs_table
+	logs_opts.TablePrefix = *table_prefix
+	logs_opts.TableSuffix = *table_suffix
+	logs_opts.ReadOnly = *read_only
+
+	logs_db, err := dynamodb.NewEventLogsDatabaseWithDSN(*dsn, logs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create event logs database, %v", err)
+	}
+
+	deliveries_opts := dynamodb.DefaultDynamoDBDeliveriesDatabaseOptions()
+	deliveries_opts.TableName = *deliveries_table
+	deliveries_opts.TablePrefix = *table_prefix
+	deliveries_opts.TableSuffix = *table_suffix
+	deliveries_opts.ReadOnly = *read_only
+
+	deliveries_db, err := dynamodb.NewDeliveriesDatabaseWithDSN(*dsn, deliveries_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create deliveries database, %v", err)
+	}
+
+	server_opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+			err := authenticate(ctx, *token)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+			err := authenticate(stream.Context(), *token)
+
+			if err != nil {
+				return err
+			}
+
+			return handler(srv, stream)
+		}),
+	}
+
+	if *tls_cert != "" {
+
+		creds, err := credentials.NewServerTLSFromFile(*tls_cert, *tls_key)
+
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate, %v", err)
+		}
+
+		server_opts = append(server_opts, grpc.Creds(creds))
+	}
+
+	server := grpc.NewServer(server_opts...)
+
+	mailinglist_grpc.RegisterSubscriptionsServer(server, mailinglist_grpc.NewSubscriptionsService(subs_db))
+	mailinglist_grpc.RegisterConfirmationsServer(server, mailinglist_grpc.NewConfirmationsService(conf_db))
+	mailinglist_grpc.RegisterEventLogsServer(server, mailinglist_grpc.NewEventLogsService(logs_db))
+	mailinglist_grpc.RegisterDeliveriesServer(server, mailinglist_grpc.NewDeliveriesService(deliveries_db))
+
+	lis, err := net.Listen("tcp", *listen)
+
+	if err != nil {
+		log.Fatalf("Failed to listen on %s, %v", *listen, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	log.Printf("Listening for requests on %s\n", *listen)
+
+	err = server.Serve(lis)
+
+	if err != nil {
+		log.Fatalf("Failed to serve requests, %v", err)
+	}
+}
+
+// authenticate returns an Unauthenticated status error unless the metadata of 'ctx' includes 'token' as a bearer token.
+func authenticate(ctx context.Context, token string) error {
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	for _, v := range md.Get("authorization") {
+
+		t, ok := strings.CutPrefix(v, "Bearer ")
+
+		if ok && subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "Invalid or missing bearer token")
+}
@@ -0,0 +1,270 @@
+// import-from-s3 is a command-line tool to create a new table from an export using DynamoDB's native [import from S3].
+// The table is created with this package's key schema and indexes. Once the import completes, the TTL, point-in-time
+// recovery and deletion protection settings are applied.
+//
+//	$> ./bin/import-from-s3 -dsn 'region=us-east-1 credentials=session' -table subscriptions -table-prefix restored_ \
+//		-export-arn arn:aws:dynamodb:us-east-1:123456789012:table/prod_subscriptions/export/01234567890123-abcdefgh
+//
+// Data which was not produced by `export-to-s3` can be imported using the `-bucket`, `-prefix` and `-format` flags.
+// Imports always create a new table; they can not be used to load data into an existing table.
+//
+// [import from S3]: https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/S3DataImport.HowItWorks.html
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"log"
+	"os"
+	"path"
+	"time"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	table := flag.String("table", "", "The table to import. Valid options are: subscriptions, confirmations, eventlogs, deliveries, unsubscribe-tokens.")
+	table_name := flag.String("table-name", "", "The name of the new table. If empty the package's default name for -table is used.")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to the table name, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to the table name, for example \"_staging\".")
+
+	billing_mode := flag.String("billing-mode", "PAY_PER_REQUEST", "The billing mode for the new table.")
+	pitr := flag.Bool("point-in-time-recovery", false, "Enable point-in-time recovery for the new table.")
+	deletion_protection := flag.Bool("deletion-protection", false, "Enable deletion protection for the new table.")
+
+	export_arn := flag.String("export-arn", "", "The ARN of a completed export (see export-to-s3) to import. The bucket and prefix are derived from the export.")
+
+	bucket := flag.String("bucket", "", "The S3 bucket containing the data to import. Ignored if -export-arn is set.")
+	bucket_owner := flag.String("bucket-owner", "", "The optional ID of the AWS account that owns the bucket.")
+	s3_prefix := flag.String("prefix", "", "The S3 key prefix of the data to import, for example {PREFIX}/AWSDynamoDB/{EXPORT_ID}/data/. Ignored if -export-arn is set.")
+
+	format := flag.String("format", aws_dynamodb.InputFormatDynamodbJson, "The format of the data to import. Valid options are: DYNAMODB_JSON, ION. Ignored if -export-arn is set.")
+	compression := flag.String("compression", aws_dynamodb.InputCompressionTypeGzip, "The compression of the data to import. Valid options are: GZIP, ZSTD, NONE.")
+
+	poll := flag.Duration("poll-interval", 30*time.Second, "How often to check the status of the import.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Create a new table from data in S3 using DynamoDB's native import, then apply the table's TTL and other settings.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options]\n\nValid options are:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	def, err := tableDefinition(*table, *table_name, *table_prefix, *table_suffix, *billing_mode, *deletion_protection)
+
+	if err != nil {
+		log.Fatalf("Failed to derive table definition, %v", err)
+	}
+
+	def.PointInTimeRecovery = *pitr
+
+	sess, err := dynamodb.NewSessionWithDSN(*dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to create session, %v", err)
+	}
+
+	client := aws_dynamodb.New(sess)
+	ctx := context.Background()
+
+	if *export_arn != "" {
+
+		rsp, err := client.DescribeExportWithContext(ctx, &aws_dynamodb.DescribeExportInput{
+			ExportArn: aws.String(*export_arn),
+		})
+
+		if err != nil {
+			log.Fatalf("Failed to describe export, %v", err)
+		}
+
+		desc := rsp.ExportDescription
+
+		if aws.StringValue(desc.ExportStatus) != aws_dynamodb.ExportStatusCompleted {
+			log.Fatalf("Export %s is not complete (%s)", *export_arn, aws.StringValue(desc.ExportStatus))
+		}
+
+		// exported data is written alongside the export's manifest files, in a "data" directory
+
+		*bucket = aws.StringValue(desc.S3Bucket)
+		*bucket_owner = aws.StringValue(desc.S3BucketOwner)
+		*s3_prefix = path.Join(path.Dir(aws.StringValue(desc.ExportManifest)), "data") + "/"
+		*format = aws.StringValue(desc.ExportFormat)
+	}
+
+	if *bucket == "" {
+		log.Fatalf("Missing -bucket or -export-arn flag")
+	}
+
+	in := def.Input
+
+	req := &aws_dynamodb.ImportTableInput{
+		InputFormat:          aws.String(*format),
+		InputCompressionType: aws.String(*compression),
+		S3BucketSource: &aws_dynamodb.S3BucketSource{
+			S3Bucket:    aws.String(*bucket),
+			S3KeyPrefix: aws.String(*s3_prefix),
+		},
+		TableCreationParameters: &aws_dynamodb.TableCreationParameters{
+			TableName:              in.TableName,
+			AttributeDefinitions:   in.AttributeDefinitions,
+			KeySchema:              in.KeySchema,
+			GlobalSecondaryIndexes: in.GlobalSecondaryIndexes,
+			BillingMode:            in.BillingMode,
+			ProvisionedThroughput:  in.ProvisionedThroughput,
+		},
+	}
+
+	if *bucket_owner != "" {
+		req.S3BucketSource.S3BucketOwner = aws.String(*bucket_owner)
+	}
+
+	rsp, err := client.ImportTableWithContext(ctx, req)
+
+	if err != nil {
+		log.Fatalf("Failed to start import, %v", err)
+	}
+
+	import_arn := aws.StringValue(rsp.ImportTableDescription.ImportArn)
+
+	log.Printf("Started import of s3://%s/%s into %s (%s)\n", *bucket, *s3_prefix, *in.TableName, import_arn)
+
+	desc, err := waitForImport(ctx, client, import_arn, *poll)
+
+	if err != nil {
+		log.Fatalf("Failed to check status of %s, %v", import_arn, err)
+	}
+
+	if aws.StringValue(desc.ImportStatus) != aws_dynamodb.ImportStatusCompleted {
+		log.Fatalf("Import %s failed (%s), %s: %s", import_arn, aws.StringValue(desc.ImportStatus), aws.StringValue(desc.FailureCode), aws.StringValue(desc.FailureMessage))
+	}
+
+	log.Printf("Imported %d items into %s (%d errors)\n", aws.Int64Value(desc.ImportedItemCount), *in.TableName, aws.Int64Value(desc.ErrorCount))
+
+	// ImportTable does not accept the settings below so they are applied to the new table once it exists
+
+	err = dynamodb.ConfigureTable(client, def)
+
+	if err != nil {
+		log.Fatalf("Failed to configure %s, %v", *in.TableName, err)
+	}
+
+	if aws.BoolValue(in.DeletionProtectionEnabled) {
+
+		_, err := client.UpdateTableWithContext(ctx, &aws_dynamodb.UpdateTableInput{
+			TableName:                 in.TableName,
+			DeletionProtectionEnabled: aws.Bool(true),
+		})
+
+		if err != nil {
+			log.Fatalf("Failed to enable deletion protection for %s, %v", *in.TableName, err)
+		}
+	}
+
+	os.Exit(0)
+}
+
+func tableDefinition(table string, name string, prefix string, suffix string, billing_mode string, deletion_protection bool) (*dynamodb.TableDefinition, error) {
+
+	switch table {
+	case "subscriptions":
+
+		opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+		opts.TablePrefix = prefix
+		opts.TableSuffix = suffix
+		opts.BillingMode = billing_mode
+		opts.DeletionProtection = deletion_protection
+
+		if name != "" {
+			opts.TableName = name
+		}
+
+		return dynamodb.SubscriptionsTableDefinition(opts), nil
+
+	case "confirmations":
+
+		opts := dynamodb.DefaultDynamoDBConfirmationsDatabaseOptions()
+		opts.TablePrefix = prefix
+		opts.TableSuffix = suffix
+		opts.BillingMode = billing_mode
+		opts.DeletionProtection = deletion_protection
+
+		if name != "" {
+			opts.TableName = name
+		}
+
+		return dynamodb.ConfirmationsTableDefinition(opts), nil
+
+	case "eventlogs":
+
+		opts := dynamodb.DefaultDynamoDBEventLogsDatabaseOptions()
+		opts.TablePrefix = prefix
+		opts.TableSuffix = suffix
+		opts.BillingMode = billing_mode
+		opts.DeletionProtection = deletion_protection
+
+		if name != "" {
+			opts.TableName = name
+		}
+
+		return dynamodb.EventLogsTableDefinition(opts), nil
+
+	case "deliveries":
+
+		opts := dynamodb.DefaultDynamoDBDeliveriesDatabaseOptions()
+		opts.TablePrefix = prefix
+		opts.TableSuffix = suffix
+		opts.BillingMode = billing_mode
+		opts.DeletionProtection = deletion_protection
+
+		if name != "" {
+			opts.TableName = name
+		}
+
+		return dynamodb.DeliveriesTableDefinition(opts), nil
+
+	case "unsubscribe-tokens":
+
+		opts := dynamodb.DefaultDynamoDBUnsubscribeTokensDatabaseOptions()
+		opts.TablePrefix = prefix
+		opts.TableSuffix = suffix
+		opts.BillingMode = billing_mode
+		opts.DeletionProtection = deletion_protection
+
+		if name != "" {
+			opts.TableName = name
+		}
+
+		return dynamodb.UnsubscribeTokensTableDefinition(opts), nil
+
+	default:
+		return nil, fmt.Errorf("Invalid table '%s'", table)
+	}
+}
+
+func waitForImport(ctx context.Context, client *aws_dynamodb.DynamoDB, import_arn string, poll time.Duration) (*aws_dynamodb.ImportTableDescription, error) {
+
+	for {
+
+		rsp, err := client.DescribeImportWithContext(ctx, &aws_dynamodb.DescribeImportInput{
+			ImportArn: aws.String(import_arn),
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch aws.StringValue(rsp.ImportTableDescription.ImportStatus) {
+		case aws_dynamodb.ImportStatusInProgress, aws_dynamodb.ImportStatusCancelling:
+			time.Sleep(poll)
+		default:
+			return rsp.ImportTableDescription, nil
+		}
+	}
+}
@@ -1,3 +1,5 @@
+// list is a command-line tool to print the address of every subscription with the go-mailinglist `-status` (pending,
+// enabled, disabled or blocked).
 package main
 
 import (
@@ -17,12 +19,17 @@ func main() {
 
 	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
 
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
 	flag.Parse()
 
 	opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
 	opts.TableName = *subs_table
+	opts.TablePrefix = *table_prefix
+	opts.TableSuffix = *table_suffix
 
-	db, err := dynamodb.NewDynamoDBSubscriptionsDatabaseWithDSN(*dsn, opts)
+	db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, opts)
 
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,382 @@
+// migrate-from-fs is a command-line tool to copy records from the directories used by the filesystem implementation
+// (`go-mailinglist/database/fs`) into the DynamoDB tables. Records are written in batches of 25, and each migrated
+// record is then read back and compared with the one on disk.
+//
+//	$> ./bin/migrate-from-fs -dsn 'region=us-east-1 credentials=session' \
+//		-subscriptions-root /usr/local/mailinglist/subscriptions -eventlogs-root /usr/local/mailinglist/eventlogs
+//
+// Only the kinds of records whose `-{TYPE}-root` flag is set are migrated. Existing items with the same key are
+// overwritten, so a migration can safely be re-run. Use `-dry-run` to check that every record on disk can be read
+// without writing anything.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	"github.com/aaronland/go-mailinglist/delivery"
+	"github.com/aaronland/go-mailinglist/eventlog"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const batch_write_max_items int = 25
+
+const batch_get_max_keys int = 100
+
+// migration describes the migration of one go-mailinglist-database-fs directory to a DynamoDB table.
+type migration struct {
+	label  string
+	root   string
+	table  string
+	keys   []string
+	record func() interface{}
+}
+
+// item is a record read from disk, marshaled for DynamoDB.
+type item struct {
+	path  string
+	attrs map[string]*aws_dynamodb.AttributeValue
+}
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	subs_root := flag.String("subscriptions-root", "", "The path to a go-mailinglist-database-fs subscriptions directory. If empty subscriptions are not migrated.")
+	conf_root := flag.String("confirmations-root", "", "The path to a go-mailinglist-database-fs confirmations directory. If empty confirmations are not migrated.")
+	logs_root := flag.String("eventlogs-root", "", "The path to a go-mailinglist-database-fs event logs directory. If empty event logs are not migrated.")
+	dlvr_root := flag.String("deliveries-root", "", "The path to a go-mailinglist-database-fs deliveries directory. If empty deliveries are not migrated.")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
+	logs_table := flag.String("eventlogs-table", dynamodb.EVENTLOGS_DEFAULT_TABLENAME, "...")
+	dlvr_table := flag.String("deliveries-table", dynamodb.DELIVERIES_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	progress := flag.Int("progress", 1000, "Report progress every this many records. If zero progress is not reported.")
+	verify := flag.Bool("verify", true, "Read back every migrated record and compare it to the record on disk.")
+	dry_run := flag.Bool("dry-run", false, "Read and validate records on disk without writing them to DynamoDB.")
+
+	flag.Parse()
+
+	full_name := func(name string) string {
+		return *table_prefix + name + *table_suffix
+	}
+
+	migrations := []*migration{
+		{
+			label:  "subscriptions",
+			root:   *subs_root,
+			table:  full_name(*subs_table),
+			keys:   []string{"address"},
+			record: func() interface{} { return new(subscription.Subscription) },
+		},
+		{
+			label:  "confirmations",
+			root:   *conf_root,
+			table:  full_name(*conf_table),
+			keys:   []string{"code"},
+			record: func() interface{} { return new(confirmation.Confirmation) },
+		},
+		{
+			label:  "event logs",
+			root:   *logs_root,
+			table:  full_name(*logs_table),
+			keys:   []string{"address", "created"},
+			record: func() interface{} { return new(eventlog.EventLog) },
+		},
+		{
+			label:  "deliveries",
+			root:   *dlvr_root,
+			table:  full_name(*dlvr_table),
+			keys:   []string{"address", "message_id"},
+			record: func() interface{} { return new(delivery.Delivery) },
+		},
+	}
+
+	sess, err := dynamodb.NewSessionWithDSN(*dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to create session, %v", err)
+	}
+
+	client := aws_dynamodb.New(sess)
+	ctx := context.Background()
+
+	failed := false
+
+	for _, m := range migrations {
+
+		if m.root == "" {
+			continue
+		}
+
+		items, err := readItems(m)
+
+		if err != nil {
+			log.Fatalf("Failed to read %s from %s, %v", m.label, m.root, err)
+		}
+
+		log.Printf("Read %d %s from %s\n", len(items), m.label, m.root)
+
+		if *dry_run {
+			continue
+		}
+
+		t1 := time.Now()
+
+		for i := 0; i < len(items); i += batch_write_max_items {
+
+			j := i + batch_write_max_items
+
+			if j > len(items) {
+				j = len(items)
+			}
+
+			err := writeItems(ctx, client, m.table, items[i:j])
+
+			if err != nil {
+				log.Fatalf("Failed to write %s to %s, %v", m.label, m.table, err)
+			}
+
+			if *progress > 0 && (j/(*progress) > i/(*progress) || j == len(items)) {
+				log.Printf("Wrote %d/%d %s to %s\n", j, len(items), m.label, m.table)
+			}
+		}
+
+		log.Printf("Migrated %d %s to %s in %v\n", len(items), m.label, m.table, time.Since(t1))
+
+		if !*verify {
+			continue
+		}
+
+		mismatches, err := verifyItems(ctx, client, m, items)
+
+		if err != nil {
+			log.Fatalf("Failed to verify %s in %s, %v", m.label, m.table, err)
+		}
+
+		for _, path := range mismatches {
+			log.Printf("Record for %s is missing from, or differs in, %s\n", path, m.table)
+		}
+
+		if len(mismatches) > 0 {
+			failed = true
+		}
+
+		log.Printf("Verified %d %s in %s, %d mismatches\n", len(items), m.label, m.table, len(mismatches))
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// readItems reads every record in 'm.root'. The filesystem implementation stores each record as a JSON file
+// although some kinds of records are nested in per-address (or per-message) subdirectories.
+func readItems(m *migration) ([]*item, error) {
+
+	items := make([]*item, 0)
+
+	walk_func := func(path string, d fs.DirEntry, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+
+		body, err := os.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		rec := m.record()
+
+		err = json.Unmarshal(body, rec)
+
+		if err != nil {
+			return fmt.Errorf("Failed to unmarshal %s, %w", path, err)
+		}
+
+		attrs, err := aws_dynamodbattribute.MarshalMap(rec)
+
+		if err != nil {
+			return fmt.Errorf("Failed to marshal %s, %w", path, err)
+		}
+
+		for _, k := range m.keys {
+
+			v, ok := attrs[k]
+
+			if !ok || (v.S != nil && *v.S == "") {
+				return fmt.Errorf("Record %s is missing its '%s' key", path, k)
+			}
+		}
+
+		items = append(items, &item{path: path, attrs: attrs})
+		return nil
+	}
+
+	err := filepath.WalkDir(m.root, walk_func)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// writeItems writes 'items' to 'table' in a single BatchWriteItem request, retrying any unprocessed items.
+func writeItems(ctx context.Context, client *aws_dynamodb.DynamoDB, table string, items []*item) error {
+
+	requests := make([]*aws_dynamodb.WriteRequest, len(items))
+
+	for i, it := range items {
+		requests[i] = &aws_dynamodb.WriteRequest{
+			PutRequest: &aws_dynamodb.PutRequest{
+				Item: it.attrs,
+			},
+		}
+	}
+
+	pending := map[string][]*aws_dynamodb.WriteRequest{
+		table: requests,
+	}
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+
+		if attempt > 0 {
+
+			if attempt > 8 {
+				return fmt.Errorf("Gave up after %d attempts with unprocessed items", attempt)
+			}
+
+			time.Sleep(time.Duration(50<<attempt) * time.Millisecond)
+		}
+
+		rsp, err := client.BatchWriteItemWithContext(ctx, &aws_dynamodb.BatchWriteItemInput{
+			RequestItems: pending,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		pending = rsp.UnprocessedItems
+	}
+
+	return nil
+}
+
+// verifyItems reads back each of 'items' from 'm.table' and returns the paths of the records which are
+// missing or whose attributes differ from those on disk.
+func verifyItems(ctx context.Context, client *aws_dynamodb.DynamoDB, m *migration, items []*item) ([]string, error) {
+
+	mismatches := make([]string, 0)
+
+	for i := 0; i < len(items); i += batch_get_max_keys {
+
+		j := i + batch_get_max_keys
+
+		if j > len(items) {
+			j = len(items)
+		}
+
+		batch := items[i:j]
+
+		keys := make([]map[string]*aws_dynamodb.AttributeValue, len(batch))
+
+		for idx, it := range batch {
+			keys[idx] = keyFor(m, it.attrs)
+		}
+
+		found := make(map[string]map[string]*aws_dynamodb.AttributeValue)
+
+		pending := map[string]*aws_dynamodb.KeysAndAttributes{
+			m.table: {
+				Keys:           keys,
+				ConsistentRead: aws.Bool(true),
+			},
+		}
+
+		for attempt := 0; len(pending) > 0; attempt++ {
+
+			if attempt > 0 {
+
+				if attempt > 8 {
+					return nil, fmt.Errorf("Gave up after %d attempts with unprocessed keys", attempt)
+				}
+
+				time.Sleep(time.Duration(50<<attempt) * time.Millisecond)
+			}
+
+			rsp, err := client.BatchGetItemWithContext(ctx, &aws_dynamodb.BatchGetItemInput{
+				RequestItems: pending,
+			})
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, attrs := range rsp.Responses[m.table] {
+				found[keyString(m, attrs)] = attrs
+			}
+
+			pending = rsp.UnprocessedKeys
+		}
+
+		for _, it := range batch {
+
+			attrs, ok := found[keyString(m, it.attrs)]
+
+			if !ok || !reflect.DeepEqual(attrs, it.attrs) {
+				mismatches = append(mismatches, it.path)
+			}
+		}
+	}
+
+	return mismatches, nil
+}
+
+func keyFor(m *migration, attrs map[string]*aws_dynamodb.AttributeValue) map[string]*aws_dynamodb.AttributeValue {
+
+	key := make(map[string]*aws_dynamodb.AttributeValue)
+
+	for _, k := range m.keys {
+		key[k] = attrs[k]
+	}
+
+	return key
+}
+
+func keyString(m *migration, attrs map[string]*aws_dynamodb.AttributeValue) string {
+
+	parts := make([]string, len(m.keys))
+
+	for i, k := range m.keys {
+		parts[i] = attrs[k].String()
+	}
+
+	return strings.Join(parts, "#")
+}
@@ -0,0 +1,22 @@
+module github.com/aaronland/go-mailinglist-database-dynamodb/cmd/migrate-from-sql
+
+go 1.21
+
+replace github.com/aaronland/go-mailinglist-database-dynamodb => ../../
+
+require (
+	github.com/aaronland/go-mailinglist v0.0.16
+	github.com/aaronland/go-mailinglist-database-dynamodb v0.0.0-00010101000000-000000000000
+	github.com/aws/aws-sdk-go v1.45.13
+	github.com/go-sql-driver/mysql v1.8.1
+	github.com/lib/pq v1.10.9
+)
+
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/aaronland/go-aws-session v0.2.1 // indirect
+	github.com/aaronland/go-string v1.0.0 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+)
@@ -0,0 +1,409 @@
+// migrate-from-sql is a command-line tool to stream subscriptions and confirmations out of a SQL database (MySQL or
+// Postgres) into the DynamoDB tables, one page of rows at a time.
+//
+//	$> ./bin/migrate-from-sql -dsn 'region=us-east-1 credentials=session' \
+//		-sql-driver mysql -sql-dsn 'user:pass@tcp(localhost:3306)/mailinglist' -checkpoint migrate.json -mode both
+//
+// With `-checkpoint` set, the last key migrated for each table is recorded after every page, so an interrupted
+// migration resumes where it left off. With `-mode verify` (or `both`), every row is read again and compared with its
+// DynamoDB record, and the tool exits non-zero if any records are missing or differ.
+//
+// The default queries assume `subscriptions` and `confirmations` tables whose columns are named after the fields of the
+// `go-mailinglist` types. Use `-subscriptions-query` and `-confirmations-query` for other schemas. Each query must
+// return one page of rows ordered by key, and take a single placeholder for the last key read.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const batch_write_max_items int = 25
+
+const default_subscriptions_query string = "SELECT address, created, confirmed, lastmodified, status FROM subscriptions WHERE address > ? ORDER BY address LIMIT 1000"
+
+const default_confirmations_query string = "SELECT code, address, action, created FROM confirmations WHERE code > ? ORDER BY code LIMIT 1000"
+
+// source describes a table in the SQL database and the DynamoDB table its rows are migrated to.
+type source struct {
+	label string
+	query string
+	table string
+	key   string
+	scan  func(*sql.Rows) (interface{}, error)
+}
+
+// row is a record read from the SQL database, marshaled for DynamoDB.
+type row struct {
+	key   string
+	attrs map[string]*aws_dynamodb.AttributeValue
+}
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	sql_driver := flag.String("sql-driver", "mysql", "The database/sql driver for the SQL database. Valid options are: mysql, postgres.")
+	sql_dsn := flag.String("sql-dsn", "", "The database/sql DSN for the SQL database.")
+
+	subs_query := flag.String("subscriptions-query", "", "The query used to read a page of subscriptions, ordered by address, with a single placeholder for the last address read. If empty a query for the go-mailinglist-database-sql schema is used.")
+	conf_query := flag.String("confirmations-query", "", "The query used to read a page of confirmations, ordered by code, with a single placeholder for the last code read. If empty a query for the go-mailinglist-database-sql schema is used.")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	mode := flag.String("mode", "migrate", "Valid options are: migrate (copy rows to DynamoDB), verify (compare every row with its DynamoDB record), both.")
+	checkpoint_path := flag.String("checkpoint", "", "An optional path to a file recording the last key migrated for each table. If the file exists migration resumes after those keys.")
+
+	flag.Parse()
+
+	switch *mode {
+	case "migrate", "verify", "both":
+		// pass
+	default:
+		log.Fatalf("Invalid mode '%s'", *mode)
+	}
+
+	if *subs_query == "" {
+		*subs_query = defaultQuery(default_subscriptions_query, *sql_driver)
+	}
+
+	if *conf_query == "" {
+		*conf_query = defaultQuery(default_confirmations_query, *sql_driver)
+	}
+
+	sources := []*source{
+		{
+			label: "subscriptions",
+			query: *subs_query,
+			table: *table_prefix + *subs_table + *table_suffix,
+			key:   "address",
+			scan: func(rows *sql.Rows) (interface{}, error) {
+				sub := new(subscription.Subscription)
+				err := rows.Scan(&sub.Address, &sub.Created, &sub.Confirmed, &sub.LastModified, &sub.Status)
+				return sub, err
+			},
+		},
+		{
+			label: "confirmations",
+			query: *conf_query,
+			table: *table_prefix + *conf_table + *table_suffix,
+			key:   "code",
+			scan: func(rows *sql.Rows) (interface{}, error) {
+				conf := new(confirmation.Confirmation)
+				err := rows.Scan(&conf.Code, &conf.Address, &conf.Action, &conf.Created)
+				return conf, err
+			},
+		},
+	}
+
+	db, err := sql.Open(*sql_driver, *sql_dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to open SQL database, %v", err)
+	}
+
+	defer db.Close()
+
+	sess, err := dynamodb.NewSessionWithDSN(*dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to create session, %v", err)
+	}
+
+	client := aws_dynamodb.New(sess)
+	ctx := context.Background()
+
+	if *mode == "migrate" || *mode == "both" {
+
+		checkpoint, err := readCheckpoint(*checkpoint_path)
+
+		if err != nil {
+			log.Fatalf("Failed to read checkpoint, %v", err)
+		}
+
+		for _, src := range sources {
+
+			last := checkpoint[src.label]
+
+			if last != "" {
+				log.Printf("Resuming %s after %s\n", src.label, last)
+			}
+
+			count := 0
+			t1 := time.Now()
+
+			for {
+
+				page, err := readPage(ctx, db, src, last)
+
+				if err != nil {
+					log.Fatalf("Failed to read %s, %v", src.label, err)
+				}
+
+				if len(page) == 0 {
+					break
+				}
+
+				for i := 0; i < len(page); i += batch_write_max_items {
+
+					j := i + batch_write_max_items
+
+					if j > len(page) {
+						j = len(page)
+					}
+
+					err := writeRows(ctx, client, src.table, page[i:j])
+
+					if err != nil {
+						log.Fatalf("Failed to write %s to %s, %v", src.label, src.table, err)
+					}
+				}
+
+				count += len(page)
+				last = page[len(page)-1].key
+
+				checkpoint[src.label] = last
+
+				err = writeCheckpoint(*checkpoint_path, checkpoint)
+
+				if err != nil {
+					log.Fatalf("Failed to write checkpoint, %v", err)
+				}
+
+				log.Printf("Migrated %d %s to %s (last key %s)\n", count, src.label, src.table, last)
+			}
+
+			log.Printf("Finished migrating %d %s to %s in %v\n", count, src.label, src.table, time.Since(t1))
+		}
+	}
+
+	if *mode == "verify" || *mode == "both" {
+
+		mismatches := 0
+
+		for _, src := range sources {
+
+			n, err := verify(ctx, db, client, src)
+
+			if err != nil {
+				log.Fatalf("Failed to verify %s, %v", src.label, err)
+			}
+
+			mismatches += n
+		}
+
+		if mismatches > 0 {
+			os.Exit(1)
+		}
+	}
+
+	os.Exit(0)
+}
+
+func defaultQuery(q string, driver string) string {
+
+	if driver == "postgres" {
+		return strings.Replace(q, "?", "$1", 1)
+	}
+
+	return q
+}
+
+// readPage returns the page of rows read by 'src.query' following 'last'.
+func readPage(ctx context.Context, db *sql.DB, src *source, last string) ([]*row, error) {
+
+	rows, err := db.QueryContext(ctx, src.query, last)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	page := make([]*row, 0)
+
+	for rows.Next() {
+
+		rec, err := src.scan(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		attrs, err := aws_dynamodbattribute.MarshalMap(rec)
+
+		if err != nil {
+			return nil, err
+		}
+
+		page = append(page, &row{
+			key:   aws.StringValue(attrs[src.key].S),
+			attrs: attrs,
+		})
+	}
+
+	return page, rows.Err()
+}
+
+// writeRows writes 'rows' to 'table' in a single BatchWriteItem request, retrying any unprocessed items.
+func writeRows(ctx context.Context, client *aws_dynamodb.DynamoDB, table string, rows []*row) error {
+
+	requests := make([]*aws_dynamodb.WriteRequest, len(rows))
+
+	for i, r := range rows {
+		requests[i] = &aws_dynamodb.WriteRequest{
+			PutRequest: &aws_dynamodb.PutRequest{
+				Item: r.attrs,
+			},
+		}
+	}
+
+	pending := map[string][]*aws_dynamodb.WriteRequest{
+		table: requests,
+	}
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+
+		if attempt > 0 {
+
+			if attempt > 8 {
+				return fmt.Errorf("Gave up after %d attempts with unprocessed items", attempt)
+			}
+
+			time.Sleep(time.Duration(50<<attempt) * time.Millisecond)
+		}
+
+		rsp, err := client.BatchWriteItemWithContext(ctx, &aws_dynamodb.BatchWriteItemInput{
+			RequestItems: pending,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		pending = rsp.UnprocessedItems
+	}
+
+	return nil
+}
+
+// verify reads every row for 'src' from the SQL database and compares it with the corresponding DynamoDB record,
+// logging and returning the number of records which are missing or differ.
+func verify(ctx context.Context, db *sql.DB, client *aws_dynamodb.DynamoDB, src *source) (int, error) {
+
+	count := 0
+	mismatches := 0
+	last := ""
+
+	for {
+
+		page, err := readPage(ctx, db, src, last)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if len(page) == 0 {
+			break
+		}
+
+		for _, r := range page {
+
+			rsp, err := client.GetItemWithContext(ctx, &aws_dynamodb.GetItemInput{
+				TableName: aws.String(src.table),
+				Key: map[string]*aws_dynamodb.AttributeValue{
+					src.key: r.attrs[src.key],
+				},
+				ConsistentRead: aws.Bool(true),
+			})
+
+			if err != nil {
+				return 0, err
+			}
+
+			if rsp.Item == nil {
+				log.Printf("%s %s is missing from %s\n", src.key, r.key, src.table)
+				mismatches += 1
+			} else if !reflect.DeepEqual(rsp.Item, r.attrs) {
+				log.Printf("%s %s differs in %s\n", src.key, r.key, src.table)
+				mismatches += 1
+			}
+		}
+
+		count += len(page)
+		last = page[len(page)-1].key
+	}
+
+	log.Printf("Verified %d %s in %s, %d mismatches\n", count, src.label, src.table, mismatches)
+	return mismatches, nil
+}
+
+func readCheckpoint(path string) (map[string]string, error) {
+
+	checkpoint := make(map[string]string)
+
+	if path == "" {
+		return checkpoint, nil
+	}
+
+	body, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(body, &checkpoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoint, nil
+}
+
+func writeCheckpoint(path string, checkpoint map[string]string) error {
+
+	if path == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(checkpoint)
+
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	err = os.WriteFile(tmp, body, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,126 @@
+// migrate-schema is a command-line tool to upgrade every subscription written with an older schema version (see the
+// Schema versions section of docs/subscriptions.md) to the current one, so that the whole table is upgraded rather
+// than only the subscriptions which happen to be read. This calls the subscriptions database's `MigrateSchema` method,
+// which reads the table `-page-size` items at a time, reports its progress after each page and rewrites each old item
+// conditionally, so subscriptions changed during the migration are left as they are. Use `-max-read-units` and
+// `-max-write-units` to limit the capacity the migration consumes, `-checkpoint` to record its position so that an
+// interrupted migration can be resumed and `-dry-run` to report the number of subscriptions that would be upgraded.
+//
+//	$> ./bin/migrate-schema -dsn 'region=us-east-1 credentials=session' -table-prefix prod_ -max-write-units 100 -checkpoint migrate.token
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	page_size := flag.Int64("page-size", dynamodb.SCAN_BACKOFF_DEFAULT_PAGE_SIZE, "The maximum number of items to read, and then upgrade, at a time.")
+	max_read_units := flag.Float64("max-read-units", 0, "The maximum number of read capacity units per second to consume. If zero reads are not limited.")
+	max_write_units := flag.Float64("max-write-units", 0, "The maximum number of write capacity units per second to consume. If zero writes are not limited.")
+
+	checkpoint := flag.String("checkpoint", "", "The path of an optional file in which to record the position of the migration, so that an interrupted migration can be resumed. If the file exists the migration resumes from the position it records, and it is removed once the migration completes.")
+	dry_run := flag.Bool("dry-run", false, "Report the number of subscriptions that would be upgraded without upgrading them.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Upgrade subscriptions written with an older schema version to the current one.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *page_size <= 0 {
+		log.Fatalf("Invalid -page-size %d", *page_size)
+	}
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = *subs_table
+	subs_opts.TablePrefix = *table_prefix
+	subs_opts.TableSuffix = *table_suffix
+
+	if *max_read_units > 0 || *max_write_units > 0 {
+		subs_opts.CapacityLimiter = dynamodb.NewCapacityLimiter(*max_read_units, *max_write_units)
+	}
+
+	subs_db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, subs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create subscriptions database, %v", err)
+	}
+
+	migrate_opts := &dynamodb.MigrateSchemaOptions{
+		PageSize: *page_size,
+		DryRun:   *dry_run,
+	}
+
+	if *checkpoint != "" {
+
+		token, err := os.ReadFile(*checkpoint)
+
+		switch {
+		case err == nil:
+			migrate_opts.StartToken = strings.TrimSpace(string(token))
+			log.Printf("Resuming migration from %s\n", *checkpoint)
+		case !os.IsNotExist(err):
+			log.Fatalf("Failed to read checkpoint, %v", err)
+		}
+	}
+
+	progress := func(m *dynamodb.SchemaMigration) error {
+
+		log.Printf("Scanned %d subscriptions: %d upgraded, %d skipped\n", m.Scanned, m.Upgraded, m.Skipped)
+
+		// a dry run has not upgraded anything so there is nothing for a later migration to skip
+
+		if *checkpoint == "" || *dry_run || m.Token == "" {
+			return nil
+		}
+
+		err := os.WriteFile(*checkpoint, []byte(m.Token), 0644)
+
+		if err != nil {
+			return fmt.Errorf("Failed to write checkpoint, %w", err)
+		}
+
+		return nil
+	}
+
+	ctx := context.Background()
+
+	m, err := subs_db.MigrateSchema(ctx, migrate_opts, progress)
+
+	if err != nil {
+		log.Fatalf("Failed to migrate %s to schema version %d, %v", subs_opts.FullTableName(), dynamodb.SUBSCRIPTION_SCHEMA_VERSION, err)
+	}
+
+	if *checkpoint != "" && !*dry_run {
+
+		err := os.Remove(*checkpoint)
+
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatalf("Failed to remove checkpoint, %v", err)
+		}
+	}
+
+	if *dry_run {
+		log.Printf("Would upgrade %d of %d subscriptions in %s to schema version %d\n", m.Upgraded, m.Scanned, subs_opts.FullTableName(), dynamodb.SUBSCRIPTION_SCHEMA_VERSION)
+	} else {
+		log.Printf("Upgraded %d of %d subscriptions in %s to schema version %d, %d skipped\n", m.Upgraded, m.Scanned, subs_opts.FullTableName(), dynamodb.SUBSCRIPTION_SCHEMA_VERSION, m.Skipped)
+	}
+
+	os.Exit(0)
+}
@@ -0,0 +1,168 @@
+// purge-address is a command-line tool to remove every record associated with one or more addresses from the
+// subscriptions, confirmations, event logs, deliveries and unsubscribe tokens tables (and, with `-history`, the
+// subscription history table), for example in response to an erasure request. A tab-separated line is printed for each
+// address reporting the number of records removed from each table.
+//
+//	$> ./bin/purge-address -dsn 'region=us-east-1 credentials=session' -table-prefix prod_ bob@example.com
+//	address	subscriptions	confirmations	eventlogs	deliveries	unsubscribe_tokens	history	status
+//	bob@example.com	1	0	4	12	1	0	removed
+//
+// Records are removed in a single transaction unless an address has more than 100 of them, in which case they are
+// removed in batches with the subscription removed last so that a failed purge can safely be retried. The same
+// functionality is available in code using `dynamodb.NewPurger` and its `PurgeAddress` method. Use `-dry-run` to report
+// the records without removing them.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"log"
+	"os"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
+	logs_table := flag.String("eventlogs-table", dynamodb.EVENTLOGS_DEFAULT_TABLENAME, "...")
+	dlvr_table := flag.String("deliveries-table", dynamodb.DELIVERIES_DEFAULT_TABLENAME, "...")
+	tokens_table := flag.String("unsubscribe-tokens-table", dynamodb.UNSUBSCRIBE_TOKENS_DEFAULT_TABLENAME, "...")
+	history_table := flag.String("history-table", dynamodb.HISTORY_DEFAULT_TABLENAME, "The name of the subscription history table.")
+	history := flag.Bool("history", false, "Also remove records from the subscription history table.")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	dry_run := flag.Bool("dry-run", false, "Report the records that would be removed without removing them.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Remove every record associated with one or more addresses.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options] address(N) address(N)\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = *subs_table
+	subs_opts.TablePrefix = *table_prefix
+	subs_opts.TableSuffix = *table_suffix
+
+	subs_db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, subs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create subscriptions database, %v", err)
+	}
+
+	conf_opts := dynamodb.DefaultDynamoDBConfirmationsDatabaseOptions()
+	conf_opts.TableName = *conf_table
+	conf_opts.TablePrefix = *table_prefix
+	conf_opts.TableSuffix = *table_suffix
+
+	conf_db, err := dynamodb.NewConfirmationsDatabaseWithDSN(*dsn, conf_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create confirmations database, %v", err)
+	}
+
+	logs_opts := dynamodb.DefaultDynamoDBEventLogsDatabaseOptions()
+	logs_opts.TableName = *logs_table
+	logs_opts.TablePrefix = *table_prefix
+	logs_opts.TableSuffix = *table_suffix
+
+	logs_db, err := dynamodb.NewEventLogsDatabaseWithDSN(*dsn, logs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create event logs database, %v", err)
+	}
+
+	dlvr_opts := dynamodb.DefaultDynamoDBDeliveriesDatabaseOptions()
+	dlvr_opts.TableName = *dlvr_table
+	dlvr_opts.TablePrefix = *table_prefix
+	dlvr_opts.TableSuffix = *table_suffix
+
+	dlvr_db, err := dynamodb.NewDeliveriesDatabaseWithDSN(*dsn, dlvr_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create deliveries database, %v", err)
+	}
+
+	tokens_opts := dynamodb.DefaultDynamoDBUnsubscribeTokensDatabaseOptions()
+	tokens_opts.TableName = *tokens_table
+	tokens_opts.TablePrefix = *table_prefix
+	tokens_opts.TableSuffix = *table_suffix
+
+	tokens_db, err := dynamodb.NewDynamoDBUnsubscribeTokensDatabaseWithDSN(*dsn, tokens_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create unsubscribe tokens database, %v", err)
+	}
+
+	purge_opts := &dynamodb.PurgeOptions{
+		Subscriptions:     subs_db,
+		Confirmations:     conf_db,
+		EventLogs:         logs_db,
+		Deliveries:        dlvr_db,
+		UnsubscribeTokens: tokens_db,
+	}
+
+	if *history {
+
+		history_opts := dynamodb.DefaultDynamoDBHistoryDatabaseOptions()
+		history_opts.TableName = *history_table
+		history_opts.TablePrefix = *table_prefix
+		history_opts.TableSuffix = *table_suffix
+
+		history_db, err := dynamodb.NewDynamoDBHistoryDatabaseWithDSN(*dsn, history_opts)
+
+		if err != nil {
+			log.Fatalf("Failed to create history database, %v", err)
+		}
+
+		purge_opts.History = history_db
+	}
+
+	purger, err := dynamodb.NewPurger(purge_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create purger, %v", err)
+	}
+
+	ctx := context.Background()
+
+	fmt.Println("address\tsubscriptions\tconfirmations\teventlogs\tdeliveries\tunsubscribe_tokens\thistory\tstatus")
+
+	for _, addr := range flag.Args() {
+
+		var r *dynamodb.PurgeReport
+
+		if *dry_run {
+			r, err = purger.Records(ctx, addr)
+		} else {
+			r, err = purger.PurgeAddress(ctx, addr)
+		}
+
+		if err != nil {
+			log.Fatalf("Failed to purge %s, %v", addr, err)
+		}
+
+		status := "removed"
+
+		switch {
+		case *dry_run:
+			status = "dry-run"
+		case r.Total() == 0:
+			status = "not found"
+		case !r.Transactional:
+			status = "removed (batched)"
+		}
+
+		fmt.Printf("%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", r.Address, r.Subscriptions, r.Confirmations, r.EventLogs, r.Deliveries, r.UnsubscribeTokens, r.History, status)
+	}
+
+	os.Exit(0)
+}
@@ -0,0 +1,95 @@
+// purge-unconfirmed is a command-line tool to remove subscriptions which were never confirmed within `-window` of being
+// created, together with their confirmations, so that addresses which did not complete the double opt-in are not kept.
+// Blocked subscriptions are left in place. This calls the subscriptions database's `RemoveUnconfirmedSubscriptions`
+// method. Use `-dry-run` to report the number of subscriptions that would be removed and `-max-read-units` and
+// `-max-write-units` to limit the capacity the purge consumes.
+//
+//	$> ./bin/purge-unconfirmed -dsn 'region=us-east-1 credentials=session' -table-prefix prod_ -window 72h
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	window := flag.Duration("window", 7*24*time.Hour, "Remove subscriptions which have not been confirmed this long after they were created.")
+	max_read_units := flag.Float64("max-read-units", 0, "The maximum number of read capacity units per second to consume, across all tables. If zero reads are not limited.")
+	max_write_units := flag.Float64("max-write-units", 0, "The maximum number of write capacity units per second to consume, across all tables. If zero writes are not limited.")
+
+	dry_run := flag.Bool("dry-run", false, "Report the number of subscriptions that would be removed without removing them.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Remove subscriptions, and their confirmations, which were never confirmed within a window of time after being created.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *window <= 0 {
+		log.Fatalf("Invalid -window %v", *window)
+	}
+
+	var limiter *dynamodb.CapacityLimiter
+
+	if *max_read_units > 0 || *max_write_units > 0 {
+		limiter = dynamodb.NewCapacityLimiter(*max_read_units, *max_write_units)
+	}
+
+	conf_opts := dynamodb.DefaultDynamoDBConfirmationsDatabaseOptions()
+	conf_opts.TableName = *conf_table
+	conf_opts.TablePrefix = *table_prefix
+	conf_opts.TableSuffix = *table_suffix
+	conf_opts.CapacityLimiter = limiter
+
+	conf_db, err := dynamodb.NewConfirmationsDatabaseWithDSN(*dsn, conf_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create confirmations database, %v", err)
+	}
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = *subs_table
+	subs_opts.TablePrefix = *table_prefix
+	subs_opts.TableSuffix = *table_suffix
+	subs_opts.CapacityLimiter = limiter
+	subs_opts.Confirmations = conf_db
+
+	subs_db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, subs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create subscriptions database, %v", err)
+	}
+
+	ctx := context.Background()
+	before := time.Now().Add(-*window)
+
+	count, err := subs_db.RemoveUnconfirmedSubscriptions(ctx, before, *dry_run)
+
+	if err != nil {
+		log.Fatalf("Failed to remove unconfirmed subscriptions from %s, %v", subs_opts.FullTableName(), err)
+	}
+
+	if *dry_run {
+		log.Printf("Would remove %d unconfirmed subscriptions from %s\n", count, subs_opts.FullTableName())
+	} else {
+		log.Printf("Removed %d unconfirmed subscriptions from %s\n", count, subs_opts.FullTableName())
+	}
+
+	os.Exit(0)
+}
@@ -0,0 +1,145 @@
+// replay-deadletters is a command-line tool to add failed deliveries, recorded in the dead letters table, to the send
+// queue again once the underlying problem is fixed, removing them from the dead letters table. Dead letters are
+// replayed to the queue they were leased from unless `-queue` is set.
+//
+//	$> ./bin/replay-deadletters -dsn 'region=us-east-1 credentials=session' -table-prefix prod_ -message-id 20231005-newsletter
+//
+// Use `-message-id` and `-address` to only replay some dead letters and `-dry-run` to list the dead letters that would
+// be replayed.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"log"
+	"os"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	dead_table := flag.String("dead-letters-table", dynamodb.DEAD_LETTERS_DEFAULT_TABLENAME, "The name of the dead letters table.")
+	queue_table := flag.String("send-queue-table", dynamodb.SEND_QUEUE_DEFAULT_TABLENAME, "The name of the send queue table.")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	queue := flag.String("queue", "", "The name of the send queue to replay dead letters to. If empty each dead letter is replayed to the queue it was leased from.")
+	message_id := flag.String("message-id", "", "Only replay dead letters for this message ID.")
+	addr := flag.String("address", "", "Only replay dead letters for this address.")
+	dry_run := flag.Bool("dry-run", false, "Report the dead letters that would be replayed without replaying them.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Replay failed deliveries, recorded in the dead letters table, by adding them to the send queue again.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	dead_opts := dynamodb.DefaultDynamoDBDeadLettersDatabaseOptions()
+	dead_opts.TableName = *dead_table
+	dead_opts.TablePrefix = *table_prefix
+	dead_opts.TableSuffix = *table_suffix
+
+	dead_db, err := dynamodb.NewDynamoDBDeadLettersDatabaseWithDSN(*dsn, dead_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create dead letters database, %v", err)
+	}
+
+	// send queues are created on demand since the queue name is an option of the queue itself
+
+	queues := make(map[string]*dynamodb.DynamoDBSendQueue)
+
+	getQueue := func(name string) (*dynamodb.DynamoDBSendQueue, error) {
+
+		q, ok := queues[name]
+
+		if ok {
+			return q, nil
+		}
+
+		queue_opts := dynamodb.DefaultDynamoDBSendQueueOptions()
+		queue_opts.TableName = *queue_table
+		queue_opts.TablePrefix = *table_prefix
+		queue_opts.TableSuffix = *table_suffix
+		queue_opts.Queue = name
+
+		q, err := dynamodb.NewDynamoDBSendQueueWithDSN(*dsn, queue_opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		queues[name] = q
+		return q, nil
+	}
+
+	ctx := context.Background()
+	count := 0
+
+	replay := func(dl *dynamodb.DeadLetter) error {
+
+		if *message_id != "" && dl.MessageId != *message_id {
+			return nil
+		}
+
+		if *addr != "" && dl.Address != *addr {
+			return nil
+		}
+
+		name := dl.Queue
+
+		if *queue != "" {
+			name = *queue
+		}
+
+		if *dry_run {
+			fmt.Printf("%s\t%s\t%s\t%d\t%s\n", dl.MessageId, dl.Address, name, dl.Attempts, dl.Error)
+			count += 1
+			return nil
+		}
+
+		q, err := getQueue(name)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create send queue, %w", err)
+		}
+
+		_, err = q.Enqueue(ctx, dl.MessageId, dl.Address)
+
+		// an item which is already queued has been replayed (or re-sent) by some other means
+
+		if err != nil && !errors.Is(err, dynamodb.ErrAlreadyExists) {
+			return fmt.Errorf("Failed to replay %s for %s, %w", dl.MessageId, dl.Address, err)
+		}
+
+		err = dead_db.RemoveDeadLetter(ctx, dl)
+
+		if err != nil {
+			return fmt.Errorf("Failed to remove dead letter for %s (%s), %w", dl.Address, dl.MessageId, err)
+		}
+
+		count += 1
+		return nil
+	}
+
+	err = dead_db.ListDeadLetters(ctx, replay)
+
+	if err != nil {
+		log.Fatalf("Failed to replay dead letters, %v", err)
+	}
+
+	if *dry_run {
+		log.Printf("%d dead letters would be replayed\n", count)
+	} else {
+		log.Printf("Replayed %d dead letters\n", count)
+	}
+
+	os.Exit(0)
+}
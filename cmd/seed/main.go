@@ -0,0 +1,306 @@
+// seed is a command-line tool to add fake, but realistic, subscriptions to a subscriptions table, along with a pending
+// confirmation for each unconfirmed one, so that staging environments and demos have data to work with. Creation dates
+// are spread over the `-days` before now and confirmed subscriptions are confirmed within two days of being created.
+//
+//	$> ./bin/seed -dsn 'region=us-east-1 credentials=session' -table-prefix staging_ -count 5000 -confirmed-ratio 0.9 -domains example.com,example.org -days 730
+//	Added 5000 subscriptions and 493 confirmations (0 addresses already existed, 0 failed, seed 1697040000000000000)
+//
+// Pass the `-seed` reported by a previous run to generate the same data set again and `-endpoint` to seed DynamoDB
+// Local. Addresses which already have a subscription are left unchanged.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var first_names = []string{
+	"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi", "ivan", "judy",
+	"mallory", "niaj", "olivia", "peggy", "rupert", "sybil", "trent", "victor", "walter", "zoe",
+}
+
+var last_names = []string{
+	"anderson", "brown", "chen", "davis", "evans", "garcia", "hughes", "ito", "jones", "kim",
+	"lopez", "martin", "nguyen", "okafor", "patel", "rossi", "smith", "taylor", "walker", "young",
+}
+
+// seed is a fake subscription and, if it is unconfirmed, its confirmation.
+type seed struct {
+	subscription *subscription.Subscription
+	confirmation *confirmation.Confirmation
+}
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+	endpoint := flag.String("endpoint", "", "An optional DynamoDB endpoint URL, for example http://localhost:8000 for DynamoDB Local.")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	count := flag.Int("count", 100, "The number of subscriptions to create.")
+	confirmed_ratio := flag.Float64("confirmed-ratio", 0.8, "The fraction, between 0 and 1, of subscriptions which are confirmed.")
+	domains := flag.String("domains", "example.com,example.org,example.net", "A comma-separated list of domains to create addresses in.")
+	days := flag.Int("days", 365, "Spread the creation dates of subscriptions over this many days before now.")
+	confirmations := flag.Bool("confirmations", true, "Create a pending confirmation for each unconfirmed subscription.")
+	random_seed := flag.Int64("seed", 0, "The seed for the random number generator, so that data sets can be reproduced. If zero the current time is used.")
+	concurrency := flag.Int("concurrency", 10, "The number of records to write concurrently.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Add fake, but realistic, subscriptions and confirmations to a subscriptions table, for staging environments and demos.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *count < 0 {
+		log.Fatalf("Invalid -count %d", *count)
+	}
+
+	if *confirmed_ratio < 0 || *confirmed_ratio > 1 {
+		log.Fatalf("Invalid -confirmed-ratio %f, must be between 0 and 1", *confirmed_ratio)
+	}
+
+	if *days < 0 {
+		log.Fatalf("Invalid -days %d", *days)
+	}
+
+	if *concurrency < 1 {
+		log.Fatalf("Invalid -concurrency %d", *concurrency)
+	}
+
+	domain_list := make([]string, 0)
+
+	for _, d := range strings.Split(*domains, ",") {
+
+		d = strings.TrimSpace(d)
+
+		if d != "" {
+			domain_list = append(domain_list, d)
+		}
+	}
+
+	if len(domain_list) == 0 {
+		log.Fatalf("Missing -domains flag")
+	}
+
+	if *random_seed == 0 {
+		*random_seed = time.Now().UnixNano()
+	}
+
+	sess, err := dynamodb.NewSessionWithDSN(*dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to create session, %v", err)
+	}
+
+	if *endpoint != "" {
+		sess.Config.Endpoint = aws.String(*endpoint)
+	}
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = *subs_table
+	subs_opts.TablePrefix = *table_prefix
+	subs_opts.TableSuffix = *table_suffix
+
+	subs_db, err := dynamodb.NewSubscriptionsDatabaseWithSession(sess, subs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create subscriptions database, %v", err)
+	}
+
+	conf_opts := dynamodb.DefaultDynamoDBConfirmationsDatabaseOptions()
+	conf_opts.TableName = *conf_table
+	conf_opts.TablePrefix = *table_prefix
+	conf_opts.TableSuffix = *table_suffix
+
+	conf_db, err := dynamodb.NewConfirmationsDatabaseWithSession(sess, conf_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create confirmations database, %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	r := rand.New(rand.NewSource(*random_seed))
+	now := time.Now()
+
+	seeds := make(chan *seed)
+
+	go func() {
+
+		defer close(seeds)
+
+		seen := make(map[string]bool)
+
+		for len(seen) < *count {
+
+			s, err := newSeed(r, now, domain_list, *days, *confirmed_ratio, *confirmations)
+
+			if err != nil {
+				log.Fatalf("Failed to create subscription, %v", err)
+			}
+
+			if seen[s.subscription.Address] {
+				continue
+			}
+
+			seen[s.subscription.Address] = true
+
+			select {
+			case <-ctx.Done():
+				return
+			case seeds <- s:
+			}
+		}
+	}()
+
+	var added int64
+	var existing int64
+	var added_confirmations int64
+	var failed int64
+
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < *concurrency; i++ {
+
+		wg.Add(1)
+
+		go func() {
+
+			defer wg.Done()
+
+			for s := range seeds {
+
+				err := subs_db.AddSubscription(s.subscription)
+
+				if errors.Is(err, dynamodb.ErrAlreadyExists) {
+					atomic.AddInt64(&existing, 1)
+					continue
+				}
+
+				if err != nil {
+					log.Printf("Failed to add subscription for %s, %v", s.subscription.Address, err)
+					atomic.AddInt64(&failed, 1)
+					continue
+				}
+
+				atomic.AddInt64(&added, 1)
+
+				if s.confirmation == nil {
+					continue
+				}
+
+				err = conf_db.AddConfirmation(s.confirmation)
+
+				if err != nil {
+					log.Printf("Failed to add confirmation for %s, %v", s.subscription.Address, err)
+					atomic.AddInt64(&failed, 1)
+					continue
+				}
+
+				atomic.AddInt64(&added_confirmations, 1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	fmt.Printf("Added %d subscriptions and %d confirmations (%d addresses already existed, %d failed, seed %d)\n", added, added_confirmations, existing, failed, *random_seed)
+
+	if failed > 0 || ctx.Err() != nil {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// newSeed returns a new fake subscription, created at a random time in the 'days' before 'now' and confirmed
+// (within two days of being created) with a probability of 'confirmed_ratio'. If the subscription is unconfirmed
+// and 'with_confirmation' is true a confirmation, created at the same time as the subscription, is returned too.
+func newSeed(r *rand.Rand, now time.Time, domains []string, days int, confirmed_ratio float64, with_confirmation bool) (*seed, error) {
+
+	first := first_names[r.Intn(len(first_names))]
+	last := last_names[r.Intn(len(last_names))]
+	domain := domains[r.Intn(len(domains))]
+
+	var local string
+
+	switch r.Intn(3) {
+	case 0:
+		local = fmt.Sprintf("%s.%s", first, last)
+	case 1:
+		local = fmt.Sprintf("%s%s", first[0:1], last)
+	default:
+		local = fmt.Sprintf("%s.%s%d", first, last, r.Intn(100000))
+	}
+
+	sub, err := subscription.NewSubscription(fmt.Sprintf("%s@%s", local, domain))
+
+	if err != nil {
+		return nil, err
+	}
+
+	spread := int64(days) * 86400
+	created := now.Unix()
+
+	if spread > 0 {
+		created = created - r.Int63n(spread)
+	}
+
+	sub.Created = created
+	sub.LastModified = created
+
+	s := &seed{
+		subscription: sub,
+	}
+
+	if r.Float64() < confirmed_ratio {
+
+		confirmed := created + r.Int63n(2*86400)
+
+		if confirmed > now.Unix() {
+			confirmed = now.Unix()
+		}
+
+		sub.Confirmed = confirmed
+		sub.LastModified = confirmed
+		sub.Status = subscription.SUBSCRIPTION_STATUS_ENABLED
+
+		return s, nil
+	}
+
+	if with_confirmation {
+
+		conf, err := confirmation.NewConfirmationForSubscription(sub, "subscribe")
+
+		if err != nil {
+			return nil, err
+		}
+
+		conf.Created = created
+		s.confirmation = conf
+	}
+
+	return s, nil
+}
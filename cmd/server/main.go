@@ -0,0 +1,421 @@
+// server is a command-line tool to serve a small REST API for administering a mailing list, so that scripts and
+// dashboards can list, get, add, remove and confirm subscriptions, and read statistics, without AWS credentials of
+// their own. Every request must include the token assigned with `-token`, or the `MAILINGLIST_API_TOKEN` environment
+// variable, as a bearer token.
+//
+//	$> MAILINGLIST_API_TOKEN=s3cret ./bin/server -dsn 'region=us-east-1 credentials=session' -table-prefix prod_ -listen localhost:8080
+//
+//	$> curl -H 'Authorization: Bearer s3cret' http://localhost:8080/subscriptions/bob@example.com
+//	{"address":"bob@example.com","created":1696521600,"confirmed":1696525200,"lastmodified":1696525200,"status":1}
+//
+// The endpoints are:
+//
+//   - `GET /subscriptions`: List subscriptions, optionally only those with the go-mailinglist `?status=`, up to
+//     `-max-results`.
+//   - `POST /subscriptions`: Add the subscription for the `address` in the JSON body, confirmed if `confirmed` is true.
+//   - `GET /subscriptions/{address}`: Get a subscription.
+//   - `DELETE /subscriptions/{address}`: Remove a subscription.
+//   - `POST /subscriptions/{address}/confirm`: Confirm a subscription, using `UpdateSubscriptionStatus`.
+//   - `GET /stats`: Count subscriptions by status, and outstanding and expired confirmations.
+//
+// Errors are returned as JSON, with a status code for their kind: 404 for missing subscriptions, 409 for existing ones
+// and 400 for invalid ones. Use `-read-only` to reject every change. The server does not terminate TLS so it should
+// listen on a private interface or sit behind a proxy which does.
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/subscription"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// statuses are the subscription statuses counted, using the "status" index, by the /stats endpoint.
+var statuses = []struct {
+	label  string
+	status int
+}{
+	{"pending", subscription.SUBSCRIPTION_STATUS_PENDING},
+	{"enabled", subscription.SUBSCRIPTION_STATUS_ENABLED},
+	{"disabled", subscription.SUBSCRIPTION_STATUS_DISABLED},
+	{"blocked", subscription.SUBSCRIPTION_STATUS_BLOCKED},
+}
+
+// addRequest is the body of a POST /subscriptions request.
+type addRequest struct {
+	Address   string `json:"address"`
+	Confirmed bool   `json:"confirmed"`
+}
+
+// statsResponse is the body of a GET /stats response.
+type statsResponse struct {
+	Subscriptions map[string]int64 `json:"subscriptions"`
+	Confirmations map[string]int64 `json:"confirmations"`
+}
+
+type server struct {
+	subscriptions *dynamodb.DynamoDBSubscriptionsDatabase
+	confirmations *dynamodb.DynamoDBConfirmationsDatabase
+	token         string
+}
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+	listen := flag.String("listen", "localhost:8080", "The address to listen for requests on.")
+	token := flag.String("token", os.Getenv("MAILINGLIST_API_TOKEN"), "The bearer token clients must send in the Authorization header. Defaults to the MAILINGLIST_API_TOKEN environment variable.")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	max_results := flag.Int("max-results", 1000, "The maximum number of subscriptions returned by a listing.")
+	read_only := flag.Bool("read-only", false, "Reject requests to add, remove or confirm subscriptions.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Serve an authenticated REST API for administering a mailing list.\n\n")
+		fmt.Fprintf(os.Stderr, "Endpoints:\n")
+		fmt.Fprintf(os.Stderr, "\tGET /subscriptions[?status=N]\n")
+		fmt.Fprintf(os.Stderr, "\tPOST /subscriptions {\"address\": \"...\", \"confirmed\": false}\n")
+		fmt.Fprintf(os.Stderr, "\tGET /subscriptions/{address}\n")
+		fmt.Fprintf(os.Stderr, "\tDELETE /subscriptions/{address}\n")
+		fmt.Fprintf(os.Stderr, "\tPOST /subscriptions/{address}/confirm\n")
+		fmt.Fprintf(os.Stderr, "\tGET /stats\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *token == "" {
+		log.Fatalf("Missing -token flag")
+	}
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = *subs_table
+	subs_opts.TablePrefix = *table_prefix
+	subs_opts.TableSuffix = *table_suffix
+	subs_opts.MaxResults = *max_results
+	subs_opts.ReadOnly = *read_only
+
+	subs_db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, subs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create subscriptions database, %v", err)
+	}
+
+	conf_opts := dynamodb.DefaultDynamoDBConfirmationsDatabaseOptions()
+	conf_opts.TableName = *conf_table
+	conf_opts.TablePrefix = *table_prefix
+	conf_opts.TableSuffix = *table_suffix
+	conf_opts.ReadOnly = true
+
+	conf_db, err := dynamodb.NewConfirmationsDatabaseWithDSN(*dsn, conf_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create confirmations database, %v", err)
+	}
+
+	s := &server{
+		subscriptions: subs_db,
+		confirmations: conf_db,
+		token:         *token,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/subscriptions", s.authenticated(s.handleSubscriptions))
+	mux.HandleFunc("/subscriptions/", s.authenticated(s.handleSubscription))
+	mux.HandleFunc("/stats", s.authenticated(s.handleStats))
+
+	http_server := &http.Server{
+		Addr:              *listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+
+		<-ctx.Done()
+
+		shutdown_ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		http_server.Shutdown(shutdown_ctx)
+	}()
+
+	log.Printf("Listening for requests on %s\n", *listen)
+
+	err = http_server.ListenAndServe()
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Failed to serve requests, %v", err)
+	}
+}
+
+// authenticated wraps 'next' so that it is only invoked for requests with the server's bearer token.
+func (s *server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(rsp http.ResponseWriter, req *http.Request) {
+
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			rsp.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(rsp, http.StatusUnauthorized, errors.New("Invalid or missing bearer token"))
+			return
+		}
+
+		next(rsp, req)
+	}
+}
+
+// handleSubscriptions handles requests to list (GET) and add (POST) subscriptions.
+func (s *server) handleSubscriptions(rsp http.ResponseWriter, req *http.Request) {
+
+	ctx := req.Context()
+
+	switch req.Method {
+	case http.MethodGet:
+
+		subs := make([]*subscription.Subscription, 0)
+
+		cb := func(sub *subscription.Subscription) error {
+			subs = append(subs, sub)
+			return nil
+		}
+
+		var err error
+
+		str_status := req.URL.Query().Get("status")
+
+		if str_status != "" {
+
+			status, conv_err := strconv.Atoi(str_status)
+
+			if conv_err != nil {
+				writeError(rsp, http.StatusBadRequest, fmt.Errorf("Invalid status '%s'", str_status))
+				return
+			}
+
+			err = s.subscriptions.ListSubscriptionsWithStatus(ctx, cb, status)
+
+		} else {
+			err = s.subscriptions.ListSubscriptions(ctx, cb)
+		}
+
+		if err != nil {
+			writeDatabaseError(rsp, err)
+			return
+		}
+
+		writeJSON(rsp, http.StatusOK, subs)
+
+	case http.MethodPost:
+
+		var body addRequest
+
+		err := json.NewDecoder(http.MaxBytesReader(rsp, req.Body, 64*1024)).Decode(&body)
+
+		if err != nil {
+			writeError(rsp, http.StatusBadRequest, fmt.Errorf("Failed to decode request, %w", err))
+			return
+		}
+
+		sub, err := subscription.NewSubscription(body.Address)
+
+		if err != nil {
+			writeError(rsp, http.StatusBadRequest, err)
+			return
+		}
+
+		if body.Confirmed {
+			sub.Confirm()
+		}
+
+		err = s.subscriptions.AddSubscriptionWithContext(ctx, sub)
+
+		if err != nil {
+			writeDatabaseError(rsp, err)
+			return
+		}
+
+		writeJSON(rsp, http.StatusCreated, sub)
+
+	default:
+		writeMethodNotAllowed(rsp, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleSubscription handles requests to get (GET), remove (DELETE) and confirm (POST .../confirm) the
+// subscription for the address in the request path.
+func (s *server) handleSubscription(rsp http.ResponseWriter, req *http.Request) {
+
+	ctx := req.Context()
+
+	addr := strings.TrimPrefix(req.URL.Path, "/subscriptions/")
+	addr, confirm := strings.CutSuffix(addr, "/confirm")
+
+	if addr == "" {
+		writeError(rsp, http.StatusNotFound, errors.New("Missing address"))
+		return
+	}
+
+	if confirm {
+
+		if req.Method != http.MethodPost {
+			writeMethodNotAllowed(rsp, http.MethodPost)
+			return
+		}
+
+		err := s.subscriptions.UpdateSubscriptionStatus(ctx, addr, dynamodb.STATUS_ACTIVE)
+
+		if err != nil {
+			writeDatabaseError(rsp, err)
+			return
+		}
+
+		s.writeSubscription(ctx, rsp, addr)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+
+		s.writeSubscription(ctx, rsp, addr)
+
+	case http.MethodDelete:
+
+		_, err := s.subscriptions.RemoveSubscriptionWithAddress(ctx, addr)
+
+		if err != nil {
+			writeDatabaseError(rsp, err)
+			return
+		}
+
+		rsp.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeMethodNotAllowed(rsp, http.MethodGet, http.MethodDelete)
+	}
+}
+
+// handleStats handles requests (GET) for the number of subscriptions by status and of confirmations.
+func (s *server) handleStats(rsp http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(rsp, http.MethodGet)
+		return
+	}
+
+	ctx := req.Context()
+
+	stats := statsResponse{
+		Subscriptions: make(map[string]int64),
+		Confirmations: make(map[string]int64),
+	}
+
+	for _, st := range statuses {
+
+		count, err := s.subscriptions.CountSubscriptionsWithStatus(ctx, st.status)
+
+		if err != nil {
+			writeDatabaseError(rsp, err)
+			return
+		}
+
+		stats.Subscriptions[st.label] = count
+	}
+
+	outstanding, expired, err := s.confirmations.CountConfirmations(ctx, time.Now())
+
+	if err != nil {
+		writeDatabaseError(rsp, err)
+		return
+	}
+
+	stats.Confirmations["outstanding"] = outstanding
+	stats.Confirmations["expired"] = expired
+
+	writeJSON(rsp, http.StatusOK, stats)
+}
+
+func (s *server) writeSubscription(ctx context.Context, rsp http.ResponseWriter, addr string) {
+
+	sub, err := s.subscriptions.GetSubscriptionWithAddressWithContext(ctx, addr)
+
+	if err != nil {
+		writeDatabaseError(rsp, err)
+		return
+	}
+
+	writeJSON(rsp, http.StatusOK, sub)
+}
+
+// writeDatabaseError writes 'err', returned by one of the databases, with the HTTP status code for its kind.
+func writeDatabaseError(rsp http.ResponseWriter, err error) {
+
+	status := http.StatusInternalServerError
+
+	switch {
+	case dynamodb.IsNotExist(err):
+		status = http.StatusNotFound
+	case errors.Is(err, dynamodb.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, dynamodb.ErrAlreadyExists), errors.Is(err, dynamodb.ErrInvalidTransition), errors.Is(err, dynamodb.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, dynamodb.ErrReadOnly):
+		status = http.StatusForbidden
+	case errors.Is(err, dynamodb.ErrThrottled):
+		status = http.StatusServiceUnavailable
+	}
+
+	if status == http.StatusInternalServerError {
+		log.Printf("Failed to handle request, %v", err)
+	}
+
+	writeError(rsp, status, err)
+}
+
+func writeMethodNotAllowed(rsp http.ResponseWriter, methods ...string) {
+
+	rsp.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(rsp, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+}
+
+func writeError(rsp http.ResponseWriter, status int, err error) {
+
+	body := map[string]string{
+		"error": err.Error(),
+	}
+
+	writeJSON(rsp, status, body)
+}
+
+func writeJSON(rsp http.ResponseWriter, status int, body interface{}) {
+
+	rsp.Header().Set("Content-Type", "application/json")
+	rsp.WriteHeader(status)
+
+	err := json.NewEncoder(rsp).Encode(body)
+
+	if err != nil {
+		log.Printf("Failed to write response, %v", err)
+	}
+}
@@ -1,21 +1,81 @@
+// setup-tables is a command-line tool to create the tables this package expects, with the indexes, TTL settings, streams
+// and table classes selected by its flags, and optionally CloudWatch alarms (`-alarms`) and resource-based policies
+// (`-policy-principal`) for each of them. The send queue, dead letters, subscription history and stats tables are only
+// created if their flags, for example `-send-queue`, are set.
 package main
 
 import (
 	"flag"
 	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	aws_cloudwatch "github.com/aws/aws-sdk-go/service/cloudwatch"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
 	"log"
+	"strings"
 )
 
+type multiFlags []string
+
+func (a *multiFlags) String() string {
+	return strings.Join(*a, ",")
+}
+
+func (a *multiFlags) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
 func main() {
 
 	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
 	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
 	logs_table := flag.String("eventlogs-table", dynamodb.EVENTLOGS_DEFAULT_TABLENAME, "...")
 	dlvr_table := flag.String("deliveries-table", dynamodb.DELIVERIES_DEFAULT_TABLENAME, "...")
+	tokens_table := flag.String("unsubscribe-tokens-table", dynamodb.UNSUBSCRIBE_TOKENS_DEFAULT_TABLENAME, "...")
+	queue_table := flag.String("send-queue-table", dynamodb.SEND_QUEUE_DEFAULT_TABLENAME, "The name of the send queue table.")
+	send_queue := flag.Bool("send-queue", false, "Also set up the send queue table.")
+	dead_table := flag.String("dead-letters-table", dynamodb.DEAD_LETTERS_DEFAULT_TABLENAME, "The name of the dead letters table.")
+	dead_letters := flag.Bool("dead-letters", false, "Also set up the dead letters table.")
+	history_table := flag.String("history-table", dynamodb.HISTORY_DEFAULT_TABLENAME, "The name of the subscription history table.")
+	history := flag.Bool("history", false, "Also set up the subscription history table.")
+	stats_table := flag.String("stats-table", dynamodb.STATS_DEFAULT_TABLENAME, "The name of the subscription stats table.")
+	stats := flag.Bool("stats", false, "Also set up the subscription stats table.")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	deletion_protection := flag.Bool("deletion-protection", false, "Enable deletion protection for newly created tables.")
+	contributor_insights := flag.Bool("contributor-insights", false, "Enable CloudWatch Contributor Insights for the tables and their indexes.")
+	prefix_search := flag.Bool("subscriptions-prefix-search", false, "Add the index used to search subscriptions by address prefix to the subscriptions table.")
+	canonical := flag.Bool("subscriptions-canonical-index", false, "Add the index used to find subscriptions with the same canonical address to the subscriptions table.")
+	modified_index := flag.Bool("subscriptions-modified-index", false, "Add the index used to list subscriptions modified since a given time to the subscriptions table.")
+	subs_stream := flag.String("subscriptions-kinesis-stream-arn", "", "The ARN of an optional Kinesis data stream to stream subscription changes to.")
+	subs_view_type := flag.String("subscriptions-stream-view-type", "", "The view type, for example NEW_AND_OLD_IMAGES, of an optional DynamoDB stream of subscription changes. If empty no stream is enabled.")
+	conf_stream := flag.String("confirmations-kinesis-stream-arn", "", "The ARN of an optional Kinesis data stream to stream confirmation changes to.")
+	conf_key := flag.String("confirmations-key-attribute", dynamodb.CONFIRMATIONS_DEFAULT_KEY_ATTRIBUTE, "The name of the confirmations table's partition key attribute.")
+	conf_expires := flag.String("confirmations-expires-attribute", "", "The name of the attribute for which TTL is enabled on the confirmations table to remove expired confirmations. If empty TTL is not enabled.")
+	tokens_expires := flag.String("unsubscribe-tokens-expires-attribute", "", "The name of the attribute for which TTL is enabled on the unsubscribe tokens table to remove expired tokens. If empty TTL is not enabled.")
+
+	logs_class := flag.String("eventlogs-table-class", "", "The table class for the event logs table, for example STANDARD_INFREQUENT_ACCESS. If empty STANDARD is used.")
+	dlvr_class := flag.String("deliveries-table-class", "", "The table class for the deliveries table, for example STANDARD_INFREQUENT_ACCESS. If empty STANDARD is used.")
+
+	retention_attr := flag.String("retention-attribute", "", "The name of the attribute for which TTL is enabled on the subscriptions, event logs and deliveries tables to enforce their retention policies, for example \"expires\". If empty TTL is not enabled.")
+
+	alarms := flag.Bool("alarms", false, "Also create CloudWatch alarms for throttled requests, system errors and (for tables with TTL enabled) anomalous numbers of TTL deletions on each table.")
+	alarm_period := flag.Int64("alarm-period", dynamodb.ALARMS_DEFAULT_PERIOD, "The period, in seconds, over which alarm metrics are evaluated.")
+
+	var alarm_actions multiFlags
+	flag.Var(&alarm_actions, "alarm-action", "Zero or more ARNs, for example of SNS topics, to notify when an alarm is raised or recovers.")
+
+	var policy_principals multiFlags
+	flag.Var(&policy_principals, "policy-principal", "Zero or more AWS principals, for example account IDs or role ARNs in other accounts, to grant access to each table with a resource-based policy. If empty no policy is attached.")
+
+	var policy_actions multiFlags
+	flag.Var(&policy_actions, "policy-action", "Zero or more DynamoDB actions, for example \"dynamodb:Query\", the -policy-principal principals are allowed to perform. If empty read-only access is granted.")
 
 	dsn := flag.String("dsn", "", "...")
 
-	// table names here... or in dsn
+	// table names may also be assigned in the DSN using the "subscriptions-table=",
+	// "confirmations-table=", "eventlogs-table=", "deliveries-table=" and "unsubscribe-tokens-table=" keys
 
 	flag.Parse()
 
@@ -23,43 +83,225 @@ func main() {
 	confirm_opts := dynamodb.DefaultDynamoDBConfirmationsDatabaseOptions()
 	logs_opts := dynamodb.DefaultDynamoDBEventLogsDatabaseOptions()
 	dlvr_opts := dynamodb.DefaultDynamoDBDeliveriesDatabaseOptions()
+	tokens_opts := dynamodb.DefaultDynamoDBUnsubscribeTokensDatabaseOptions()
+	queue_opts := dynamodb.DefaultDynamoDBSendQueueOptions()
+	dead_opts := dynamodb.DefaultDynamoDBDeadLettersDatabaseOptions()
+	history_opts := dynamodb.DefaultDynamoDBHistoryDatabaseOptions()
+	stats_opts := dynamodb.DefaultDynamoDBStatsDatabaseOptions()
 
 	subscribe_opts.TableName = *subs_table
+	subscribe_opts.TablePrefix = *table_prefix
+	subscribe_opts.TableSuffix = *table_suffix
+	subscribe_opts.DeletionProtection = *deletion_protection
+	subscribe_opts.ContributorInsights = *contributor_insights
+	subscribe_opts.KinesisStreamArn = *subs_stream
+	subscribe_opts.StreamViewType = *subs_view_type
+	subscribe_opts.PrefixSearch = *prefix_search
+	subscribe_opts.Canonicalize = *canonical
+	subscribe_opts.ModifiedIndex = *modified_index
+	subscribe_opts.RetentionAttribute = *retention_attr
 	subscribe_opts.CreateTable = true
 
 	confirm_opts.TableName = *conf_table
+	confirm_opts.TablePrefix = *table_prefix
+	confirm_opts.TableSuffix = *table_suffix
+	confirm_opts.DeletionProtection = *deletion_protection
+	confirm_opts.ContributorInsights = *contributor_insights
+	confirm_opts.KinesisStreamArn = *conf_stream
+	confirm_opts.KeyAttribute = *conf_key
+	confirm_opts.ExpiresAttribute = *conf_expires
 	confirm_opts.CreateTable = true
 
 	logs_opts.TableName = *logs_table
+	logs_opts.TablePrefix = *table_prefix
+	logs_opts.TableSuffix = *table_suffix
+	logs_opts.DeletionProtection = *deletion_protection
+	logs_opts.ContributorInsights = *contributor_insights
+	logs_opts.TableClass = *logs_class
+	logs_opts.RetentionAttribute = *retention_attr
 	logs_opts.CreateTable = true
 
 	dlvr_opts.TableName = *dlvr_table
+	dlvr_opts.TablePrefix = *table_prefix
+	dlvr_opts.TableSuffix = *table_suffix
+	dlvr_opts.DeletionProtection = *deletion_protection
+	dlvr_opts.ContributorInsights = *contributor_insights
+	dlvr_opts.TableClass = *dlvr_class
+	dlvr_opts.RetentionAttribute = *retention_attr
 	dlvr_opts.CreateTable = true
 
+	tokens_opts.TableName = *tokens_table
+	tokens_opts.TablePrefix = *table_prefix
+	tokens_opts.TableSuffix = *table_suffix
+	tokens_opts.DeletionProtection = *deletion_protection
+	tokens_opts.ContributorInsights = *contributor_insights
+	tokens_opts.ExpiresAttribute = *tokens_expires
+	tokens_opts.CreateTable = true
+
+	queue_opts.TableName = *queue_table
+	queue_opts.TablePrefix = *table_prefix
+	queue_opts.TableSuffix = *table_suffix
+	queue_opts.DeletionProtection = *deletion_protection
+	queue_opts.ContributorInsights = *contributor_insights
+	queue_opts.CreateTable = true
+
+	dead_opts.TableName = *dead_table
+	dead_opts.TablePrefix = *table_prefix
+	dead_opts.TableSuffix = *table_suffix
+	dead_opts.DeletionProtection = *deletion_protection
+	dead_opts.ContributorInsights = *contributor_insights
+	dead_opts.CreateTable = true
+
+	history_opts.TableName = *history_table
+	history_opts.TablePrefix = *table_prefix
+	history_opts.TableSuffix = *table_suffix
+	history_opts.DeletionProtection = *deletion_protection
+	history_opts.ContributorInsights = *contributor_insights
+	history_opts.CreateTable = true
+
+	stats_opts.TableName = *stats_table
+	stats_opts.TablePrefix = *table_prefix
+	stats_opts.TableSuffix = *table_suffix
+	stats_opts.DeletionProtection = *deletion_protection
+	stats_opts.ContributorInsights = *contributor_insights
+	stats_opts.CreateTable = true
+
 	var err error
 
-	_, err = dynamodb.NewDynamoDBSubscriptionsDatabaseWithDSN(*dsn, subscribe_opts)
+	_, err = dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, subscribe_opts)
+
+	if err != nil {
+		log.Printf("Failed to set up %s table, %s\n", subscribe_opts.FullTableName(), err)
+	}
+
+	_, err = dynamodb.NewConfirmationsDatabaseWithDSN(*dsn, confirm_opts)
 
 	if err != nil {
-		log.Printf("Failed to set up %s table, %s\n", subscribe_opts.TableName, err)
+		log.Printf("Failed to set up %s table, %s\n", confirm_opts.FullTableName(), err)
 	}
 
-	_, err = dynamodb.NewDynamoDBConfirmationsDatabaseWithDSN(*dsn, confirm_opts)
+	_, err = dynamodb.NewEventLogsDatabaseWithDSN(*dsn, logs_opts)
 
 	if err != nil {
-		log.Printf("Failed to set up %s table, %s\n", confirm_opts.TableName, err)
+		log.Printf("Failed to set up %s table, %s\n", logs_opts.FullTableName(), err)
 	}
 
-	_, err = dynamodb.NewDynamoDBEventLogsDatabaseWithDSN(*dsn, logs_opts)
+	_, err = dynamodb.NewDeliveriesDatabaseWithDSN(*dsn, dlvr_opts)
 
 	if err != nil {
-		log.Printf("Failed to set up %s table, %s\n", logs_opts.TableName, err)
+		log.Printf("Failed to set up %s table, %s\n", dlvr_opts.FullTableName(), err)
 	}
 
-	_, err = dynamodb.NewDynamoDBDeliveriesDatabaseWithDSN(*dsn, dlvr_opts)
+	_, err = dynamodb.NewDynamoDBUnsubscribeTokensDatabaseWithDSN(*dsn, tokens_opts)
 
 	if err != nil {
-		log.Printf("Failed to set up %s table, %s\n", dlvr_opts.TableName, err)
+		log.Printf("Failed to set up %s table, %s\n", tokens_opts.FullTableName(), err)
+	}
+
+	if *send_queue {
+
+		_, err = dynamodb.NewDynamoDBSendQueueWithDSN(*dsn, queue_opts)
+
+		if err != nil {
+			log.Printf("Failed to set up %s table, %s\n", queue_opts.FullTableName(), err)
+		}
+	}
+
+	if *dead_letters {
+
+		_, err = dynamodb.NewDynamoDBDeadLettersDatabaseWithDSN(*dsn, dead_opts)
+
+		if err != nil {
+			log.Printf("Failed to set up %s table, %s\n", dead_opts.FullTableName(), err)
+		}
+	}
+
+	if *history {
+
+		_, err = dynamodb.NewDynamoDBHistoryDatabaseWithDSN(*dsn, history_opts)
+
+		if err != nil {
+			log.Printf("Failed to set up %s table, %s\n", history_opts.FullTableName(), err)
+		}
 	}
 
+	if *stats {
+
+		_, err = dynamodb.NewDynamoDBStatsDatabaseWithDSN(*dsn, stats_opts)
+
+		if err != nil {
+			log.Printf("Failed to set up %s table, %s\n", stats_opts.FullTableName(), err)
+		}
+	}
+
+	if !*alarms && len(policy_principals) == 0 {
+		return
+	}
+
+	sess, err := dynamodb.NewSessionWithDSN(*dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to create session, %v", err)
+	}
+
+	defs := []*dynamodb.TableDefinition{
+		dynamodb.SubscriptionsTableDefinition(subscribe_opts),
+		dynamodb.ConfirmationsTableDefinition(confirm_opts),
+		dynamodb.EventLogsTableDefinition(logs_opts),
+		dynamodb.DeliveriesTableDefinition(dlvr_opts),
+		dynamodb.UnsubscribeTokensTableDefinition(tokens_opts),
+	}
+
+	if *send_queue {
+		defs = append(defs, dynamodb.SendQueueTableDefinition(queue_opts))
+	}
+
+	if *dead_letters {
+		defs = append(defs, dynamodb.DeadLettersTableDefinition(dead_opts))
+	}
+
+	if *history {
+		defs = append(defs, dynamodb.HistoryTableDefinition(history_opts))
+	}
+
+	if *stats {
+		defs = append(defs, dynamodb.StatsTableDefinition(stats_opts))
+	}
+
+	if len(policy_principals) > 0 {
+
+		client := aws_dynamodb.New(sess)
+
+		policy_opts := &dynamodb.ResourcePolicyOptions{
+			Principals: policy_principals,
+			Actions:    policy_actions,
+		}
+
+		for _, def := range defs {
+
+			_, err := dynamodb.PutTableResourcePolicy(client, def, policy_opts)
+
+			if err != nil {
+				log.Printf("Failed to set up resource policy for %s table, %s\n", *def.Input.TableName, err)
+			}
+		}
+	}
+
+	if *alarms {
+
+		client := aws_cloudwatch.New(sess)
+
+		alarms_opts := dynamodb.DefaultTableAlarmsOptions()
+		alarms_opts.Actions = alarm_actions
+		alarms_opts.Period = *alarm_period
+
+		for _, def := range defs {
+
+			err := dynamodb.CreateTableAlarms(client, def, alarms_opts)
+
+			if err != nil {
+				log.Printf("Failed to set up alarms for %s table, %s\n", *def.Input.TableName, err)
+			}
+		}
+	}
 }
@@ -0,0 +1,86 @@
+// snapshot-stats is a command-line tool to write a snapshot of today's (UTC) subscription statistics to the stats table
+// and print it as JSON. This is meant to be run once a day, for example from cron or an EventBridge schedule. Use
+// `-dry-run` to print the snapshot without writing it.
+//
+//	$> ./bin/snapshot-stats -dsn 'region=us-east-1 credentials=session' -table-prefix prod_
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	stats_table := flag.String("stats-table", dynamodb.STATS_DEFAULT_TABLENAME, "The name of the subscription stats table.")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	dry_run := flag.Bool("dry-run", false, "Print the snapshot without writing it to the stats table.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Write a snapshot of today's (UTC) subscription statistics to the subscription stats table, and print it as JSON. Run it once a day to record the growth of a list.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = *subs_table
+	subs_opts.TablePrefix = *table_prefix
+	subs_opts.TableSuffix = *table_suffix
+
+	subs_db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, subs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create subscriptions database, %v", err)
+	}
+
+	stats_opts := dynamodb.DefaultDynamoDBStatsDatabaseOptions()
+	stats_opts.TableName = *stats_table
+	stats_opts.TablePrefix = *table_prefix
+	stats_opts.TableSuffix = *table_suffix
+
+	stats_db, err := dynamodb.NewDynamoDBStatsDatabaseWithDSN(*dsn, stats_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create stats database, %v", err)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+
+	var s *dynamodb.StatsSnapshot
+
+	if *dry_run {
+		s, err = subs_db.StatsSnapshot(ctx, now)
+	} else {
+		s, err = stats_db.WriteSnapshot(ctx, subs_db, now)
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to snapshot %s, %v", subs_opts.FullTableName(), err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	err = enc.Encode(s)
+
+	if err != nil {
+		log.Fatalf("Failed to encode snapshot, %v", err)
+	}
+
+	os.Exit(0)
+}
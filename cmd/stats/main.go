@@ -0,0 +1,231 @@
+// stats is a command-line tool to report the health of a list: subscriptions by status, outstanding and expired
+// confirmations, confirmed and unconfirmed subscriptions, signups per day and the most common address domains.
+//
+//	$> ./bin/stats -dsn 'region=us-east-1 credentials=session' -table-prefix prod_ -days 14 -top-domains 5
+//
+// Counts by status are read using COUNT queries of the `status` index. The remaining subscription statistics require a
+// scan of the subscriptions table, which can be skipped with `-scan=false`, and confirmations are counted with a COUNT
+// scan since there is no index suitable for querying them by age.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/subscription"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// statuses are the subscription statuses counted using the "status" index, in the order they are reported.
+var statuses = []struct {
+	label  string
+	status int
+}{
+	{"pending", subscription.SUBSCRIPTION_STATUS_PENDING},
+	{"enabled", subscription.SUBSCRIPTION_STATUS_ENABLED},
+	{"disabled", subscription.SUBSCRIPTION_STATUS_DISABLED},
+	{"blocked", subscription.SUBSCRIPTION_STATUS_BLOCKED},
+}
+
+// scanStats are the statistics which can only be derived by scanning the subscriptions table.
+type scanStats struct {
+	total       int
+	confirmed   int
+	unconfirmed int
+	signups     map[string]int
+	domains     map[string]int
+}
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	days := flag.Int("days", 30, "The number of days, including today, to report signups for.")
+	top := flag.Int("top-domains", 10, "The number of most common address domains to report.")
+	max_age := flag.Duration("max-age", dynamodb.CONFIRMATIONS_DEFAULT_MAX_AGE, "The age after which confirmations are considered expired.")
+	scan := flag.Bool("scan", true, "Scan the subscriptions table to report confirmed and unconfirmed counts, signups per day and top domains. If false only the statistics available from indexes, and confirmations, are reported.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Report statistics about the health of a mailing list.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = *subs_table
+	subs_opts.TablePrefix = *table_prefix
+	subs_opts.TableSuffix = *table_suffix
+
+	subs_db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, subs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create subscriptions database, %v", err)
+	}
+
+	conf_opts := dynamodb.DefaultDynamoDBConfirmationsDatabaseOptions()
+	conf_opts.TableName = *conf_table
+	conf_opts.TablePrefix = *table_prefix
+	conf_opts.TableSuffix = *table_suffix
+	conf_opts.MaxAge = *max_age
+
+	conf_db, err := dynamodb.NewConfirmationsDatabaseWithDSN(*dsn, conf_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create confirmations database, %v", err)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+
+	wr := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(wr, "SUBSCRIPTIONS BY STATUS")
+
+	for _, s := range statuses {
+
+		count, err := subs_db.CountSubscriptionsWithStatus(ctx, s.status)
+
+		if err != nil {
+			log.Fatalf("Failed to count %s subscriptions, %v", s.label, err)
+		}
+
+		fmt.Fprintf(wr, "%s\t%d\n", s.label, count)
+	}
+
+	outstanding, expired, err := conf_db.CountConfirmations(ctx, now)
+
+	if err != nil {
+		log.Fatalf("Failed to count confirmations, %v", err)
+	}
+
+	fmt.Fprintln(wr, "\nCONFIRMATIONS")
+	fmt.Fprintf(wr, "outstanding\t%d\n", outstanding)
+	fmt.Fprintf(wr, "expired\t%d\n", expired)
+
+	if *scan {
+
+		st, err := scanSubscriptions(ctx, subs_db, now, *days)
+
+		if err != nil {
+			log.Fatalf("Failed to scan subscriptions, %v", err)
+		}
+
+		fmt.Fprintln(wr, "\nSUBSCRIPTIONS")
+		fmt.Fprintf(wr, "total\t%d\n", st.total)
+		fmt.Fprintf(wr, "confirmed\t%d\n", st.confirmed)
+		fmt.Fprintf(wr, "unconfirmed\t%d\n", st.unconfirmed)
+
+		fmt.Fprintf(wr, "\nSIGNUPS PER DAY (LAST %d DAYS)\n", *days)
+
+		for i := *days - 1; i >= 0; i-- {
+			day := now.AddDate(0, 0, -i).UTC().Format("2006-01-02")
+			fmt.Fprintf(wr, "%s\t%d\n", day, st.signups[day])
+		}
+
+		fmt.Fprintf(wr, "\nTOP %d DOMAINS\n", *top)
+
+		for _, d := range topDomains(st.domains, *top) {
+			fmt.Fprintf(wr, "%s\t%d\n", d, st.domains[d])
+		}
+	}
+
+	wr.Flush()
+	os.Exit(0)
+}
+
+// scanSubscriptions scans every subscription in 'db', counting confirmed and unconfirmed subscriptions, signups
+// per (UTC) day during the last 'days' days and subscriptions per address domain.
+func scanSubscriptions(ctx context.Context, db *dynamodb.DynamoDBSubscriptionsDatabase, now time.Time, days int) (*scanStats, error) {
+
+	st := &scanStats{
+		signups: make(map[string]int),
+		domains: make(map[string]int),
+	}
+
+	y, m, d := now.UTC().Date()
+	since := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -(days - 1)).Unix()
+
+	it := db.Subscriptions(ctx, nil)
+	defer it.Close()
+
+	for it.Next() {
+
+		sub := it.Subscription()
+		st.total += 1
+
+		if sub.Confirmed > 0 {
+			st.confirmed += 1
+		} else {
+			st.unconfirmed += 1
+		}
+
+		if days > 0 && sub.Created >= since {
+			day := time.Unix(sub.Created, 0).UTC().Format("2006-01-02")
+			st.signups[day] += 1
+		}
+
+		st.domains[domain(sub.Address)] += 1
+	}
+
+	err := it.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+func domain(addr string) string {
+
+	if dynamodb.IsPseudonym(addr) {
+		return "(pseudonymized)"
+	}
+
+	idx := strings.LastIndex(addr, "@")
+
+	if idx == -1 {
+		return "(invalid)"
+	}
+
+	return strings.ToLower(addr[idx+1:])
+}
+
+// topDomains returns up to 'n' of the domains in 'counts', most common first.
+func topDomains(counts map[string]int, n int) []string {
+
+	domains := make([]string, 0, len(counts))
+
+	for d := range counts {
+		domains = append(domains, d)
+	}
+
+	sort.Slice(domains, func(i, j int) bool {
+
+		if counts[domains[i]] != counts[domains[j]] {
+			return counts[domains[i]] > counts[domains[j]]
+		}
+
+		return domains[i] < domains[j]
+	})
+
+	if len(domains) > n {
+		domains = domains[:n]
+	}
+
+	return domains
+}
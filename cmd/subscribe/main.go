@@ -1,3 +1,4 @@
+// subscribe is a command-line tool to add a subscription for `-address`, confirmed and enabled if `-enabled` is set.
 package main
 
 import (
@@ -16,12 +17,17 @@ func main() {
 
 	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
 
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
 	flag.Parse()
 
 	opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
 	opts.TableName = *subs_table
+	opts.TablePrefix = *table_prefix
+	opts.TableSuffix = *table_suffix
 
-	db, err := dynamodb.NewDynamoDBSubscriptionsDatabaseWithDSN(*dsn, opts)
+	db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, opts)
 
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,244 @@
+// sync-ses-suppression is a command-line tool to reconcile the Amazon SES account-level suppression list with the
+// subscriptions table in both directions. Addresses suppressed by SES because of a bounce (or a complaint) are marked
+// as `bounced` (or `suppressed`) if they have a subscription and `bounced` (or `suppressed`) subscriptions are added to
+// the SES suppression list with the reason `BOUNCE` (or `COMPLAINT`). A complaint on either side takes precedence over
+// a bounce on the other. A tab-separated line is printed for each change.
+//
+//	$> ./bin/sync-ses-suppression -dsn 'region=us-east-1 credentials=session' -table-prefix prod_
+//	from-ses	bob@example.com	BOUNCE	bounced
+//	to-ses	carol@example.com	COMPLAINT	suppressed
+//
+// Use `-direction from-ses` or `-direction to-ses` to only sync in one direction and `-dry-run` to report the changes
+// without making them.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_sesv2 "github.com/aws/aws-sdk-go/service/sesv2"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	direction := flag.String("direction", "both", "The direction to sync in. Valid options are: both, from-ses, to-ses.")
+	dry_run := flag.Bool("dry-run", false, "Report the changes that would be made without making them.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Reconcile the SES account-level suppression list with bounced and suppressed subscriptions.\n\n")
+		fmt.Fprintf(os.Stderr, "Addresses suppressed by SES because of a bounce (or complaint) are marked as bounced (or suppressed) in the\n")
+		fmt.Fprintf(os.Stderr, "subscriptions table and bounced (or suppressed) subscriptions are added to the SES suppression list.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	var from_ses bool
+	var to_ses bool
+
+	switch *direction {
+	case "both":
+		from_ses = true
+		to_ses = true
+	case "from-ses":
+		from_ses = true
+	case "to-ses":
+		to_ses = true
+	default:
+		log.Fatalf("Invalid direction '%s'", *direction)
+	}
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = *subs_table
+	subs_opts.TablePrefix = *table_prefix
+	subs_opts.TableSuffix = *table_suffix
+
+	subs_db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, subs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create subscriptions database, %v", err)
+	}
+
+	sess, err := dynamodb.NewSessionWithDSN(*dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to create session, %v", err)
+	}
+
+	ses := aws_sesv2.New(sess)
+
+	ctx := context.Background()
+
+	// SES suppression list entries, keyed on lower-cased address
+
+	suppressed := make(map[string]string)
+	ses_addresses := make(map[string]string)
+
+	err = ses.ListSuppressedDestinationsPagesWithContext(ctx, &aws_sesv2.ListSuppressedDestinationsInput{}, func(rsp *aws_sesv2.ListSuppressedDestinationsOutput, last bool) bool {
+
+		for _, d := range rsp.SuppressedDestinationSummaries {
+
+			addr := aws.StringValue(d.EmailAddress)
+			k := strings.ToLower(addr)
+
+			suppressed[k] = aws.StringValue(d.Reason)
+			ses_addresses[k] = addr
+		}
+
+		return true
+	})
+
+	if err != nil {
+		log.Fatalf("Failed to list SES suppressed destinations, %v", err)
+	}
+
+	// bounced and suppressed subscriptions, keyed on lower-cased address
+
+	disabled := make(map[string]dynamodb.SubscriptionStatus)
+	addresses := make(map[string]string)
+
+	for _, status := range []dynamodb.SubscriptionStatus{dynamodb.STATUS_BOUNCED, dynamodb.STATUS_SUPPRESSED} {
+
+		err := subs_db.ListSubscriptionsWithSubscriptionStatus(ctx, status, func(sub *subscription.Subscription) error {
+
+			k := strings.ToLower(sub.Address)
+
+			disabled[k] = status
+			addresses[k] = sub.Address
+
+			return nil
+		})
+
+		if err != nil {
+			log.Fatalf("Failed to list %s subscriptions, %v", status, err)
+		}
+	}
+
+	// a complaint outranks a bounce so an address which is suppressed on one side is never
+	// downgraded to bounced by the other
+
+	from_count := 0
+	to_count := 0
+
+	if from_ses {
+
+		for _, k := range sortedKeys(suppressed) {
+
+			reason := suppressed[k]
+
+			status := dynamodb.STATUS_BOUNCED
+
+			if reason == aws_sesv2.SuppressionListReasonComplaint {
+				status = dynamodb.STATUS_SUPPRESSED
+			}
+
+			current, ok := disabled[k]
+
+			if ok && (current == status || current == dynamodb.STATUS_SUPPRESSED) {
+				continue
+			}
+
+			addr := ses_addresses[k]
+
+			if ok {
+				addr = addresses[k]
+			}
+
+			_, err := subs_db.GetSubscriptionStatus(ctx, addr)
+
+			if dynamodb.IsNotExist(err) {
+				continue
+			}
+
+			if err != nil {
+				log.Fatalf("Failed to get subscription status for %s, %v", addr, err)
+			}
+
+			fmt.Printf("from-ses\t%s\t%s\t%s\n", addr, reason, status)
+			from_count += 1
+
+			if *dry_run {
+				continue
+			}
+
+			err = subs_db.SetSubscriptionStatus(ctx, addr, status)
+
+			if err != nil {
+				log.Fatalf("Failed to set subscription status for %s, %v", addr, err)
+			}
+		}
+	}
+
+	if to_ses {
+
+		for _, k := range sortedKeys(disabled) {
+
+			status := disabled[k]
+
+			reason := aws_sesv2.SuppressionListReasonBounce
+
+			if status == dynamodb.STATUS_SUPPRESSED {
+				reason = aws_sesv2.SuppressionListReasonComplaint
+			}
+
+			current, ok := suppressed[k]
+
+			if ok && (current == reason || current == aws_sesv2.SuppressionListReasonComplaint) {
+				continue
+			}
+
+			addr := addresses[k]
+
+			fmt.Printf("to-ses\t%s\t%s\t%s\n", addr, reason, status)
+			to_count += 1
+
+			if *dry_run {
+				continue
+			}
+
+			_, err := ses.PutSuppressedDestinationWithContext(ctx, &aws_sesv2.PutSuppressedDestinationInput{
+				EmailAddress: aws.String(addr),
+				Reason:       aws.String(reason),
+			})
+
+			if err != nil {
+				log.Fatalf("Failed to add %s to SES suppression list, %v", addr, err)
+			}
+		}
+	}
+
+	if *dry_run {
+		log.Printf("%d subscriptions and %d SES suppression list entries would be updated\n", from_count, to_count)
+	} else {
+		log.Printf("Updated %d subscriptions and %d SES suppression list entries\n", from_count, to_count)
+	}
+
+	os.Exit(0)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,370 @@
+// sync-tables is a command-line tool to copy subscriptions from one table to another, for example to move the list to a
+// new region or account. A subscription is only copied if it is missing from the destination table, or if its
+// `lastmodified` time is newer than the destination's copy. This makes the tool suitable for repeated runs during a
+// blue/green migration.
+//
+//	$> ./bin/sync-tables -source-dsn 'region=us-east-1 credentials=session' -destination-dsn 'region=eu-west-1 credentials=session' \
+//		-source-table prod_subscriptions -destination-table prod_subscriptions -create-table
+//
+// Use `-remove` to also remove subscriptions from the destination table which no longer exist in the source table, and
+// `-dry-run` to report changes without making them. Use `-checkpoint` to record the position of the copy in a file, so
+// that an interrupted sync resumes where it stopped, and `-batch-writes` to write changes with a `BatchWriter`, which
+// makes far fewer requests for large tables but replaces entire items in the destination table.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/subscription"
+	"log"
+	"os"
+	"strings"
+)
+
+// sync_batch_size is the number of source subscriptions looked up in the destination table at a time.
+const sync_batch_size int = dynamodb.BATCH_GET_MAX_KEYS
+
+// stats counts the outcome of syncing each subscription.
+type stats struct {
+	read      int
+	created   int
+	updated   int
+	unchanged int
+	removed   int
+}
+
+func main() {
+
+	source_dsn := flag.String("source-dsn", "", "The DSN for the source table's region and credentials.")
+	dest_dsn := flag.String("destination-dsn", "", "The DSN for the destination table's region and credentials. If empty -source-dsn is used.")
+
+	source_table := flag.String("source-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "The full name of the source subscriptions table.")
+	dest_table := flag.String("destination-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "The full name of the destination subscriptions table.")
+
+	create_table := flag.Bool("create-table", false, "Create the destination table if it does not exist.")
+	remove := flag.Bool("remove", false, "Remove subscriptions from the destination table which are not present in the source table.")
+	dry_run := flag.Bool("dry-run", false, "Report what would be changed without writing to the destination table.")
+	checkpoint := flag.String("checkpoint", "", "The path of an optional file in which to record the position of the copy, so that an interrupted sync can be resumed. If the file exists the copy resumes from the position it records, and it is removed once the copy completes.")
+	batch_writes := flag.Bool("batch-writes", false, "Write changes to the destination table in batches, using BatchWriteItem requests. Batched writes replace entire items so attributes which are not part of a subscription, like activity times, tags and metadata, are not preserved.")
+
+	flag.Parse()
+
+	if *dest_dsn == "" {
+		*dest_dsn = *source_dsn
+	}
+
+	source_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	source_opts.TableName = *source_table
+
+	source_db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*source_dsn, source_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create source database, %v", err)
+	}
+
+	dest_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	dest_opts.TableName = *dest_table
+	dest_opts.CreateTable = *create_table
+
+	dest_db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dest_dsn, dest_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create destination database, %v", err)
+	}
+
+	ctx := context.Background()
+
+	st := &stats{}
+
+	var writer *dynamodb.BatchWriter
+
+	if *batch_writes {
+
+		writer, err = dynamodb.NewBatchWriter(dest_db, dynamodb.DefaultBatchWriterOptions())
+
+		if err != nil {
+			log.Fatalf("Failed to create batch writer, %v", err)
+		}
+	}
+
+	err = syncSubscriptions(ctx, source_db, dest_db, writer, *checkpoint, st, *dry_run)
+
+	if err != nil {
+		log.Fatalf("Failed to sync subscriptions, %v", err)
+	}
+
+	if *remove {
+
+		err = removeSubscriptions(ctx, source_db, dest_db, writer, st, *dry_run)
+
+		if err != nil {
+			log.Fatalf("Failed to remove subscriptions, %v", err)
+		}
+	}
+
+	if writer != nil {
+
+		err = writer.Close(ctx)
+
+		if err != nil {
+			log.Fatalf("Failed to flush batched writes, %v", err)
+		}
+	}
+
+	log.Printf("Read %d subscriptions: %d created, %d updated, %d unchanged, %d removed\n", st.read, st.created, st.updated, st.unchanged, st.removed)
+	os.Exit(0)
+}
+
+// syncSubscriptions copies each subscription in 'source_db' to 'dest_db' if it is missing from 'dest_db'
+// or has been modified more recently than the copy in 'dest_db'. If 'writer' is not nil it is used to write
+// the copies. If 'checkpoint' is not empty the position of the copy is written to that file after each batch,
+// and read from it to resume an earlier copy.
+func syncSubscriptions(ctx context.Context, source_db *dynamodb.DynamoDBSubscriptionsDatabase, dest_db *dynamodb.DynamoDBSubscriptionsDatabase, writer *dynamodb.BatchWriter, checkpoint string, st *stats, dry_run bool) error {
+
+	it_opts := &dynamodb.SubscriptionsIteratorOptions{}
+
+	if checkpoint != "" {
+
+		token, err := os.ReadFile(checkpoint)
+
+		switch {
+		case err == nil:
+			it_opts.StartToken = strings.TrimSpace(string(token))
+			log.Printf("Resuming copy from %s\n", checkpoint)
+		case !os.IsNotExist(err):
+			return fmt.Errorf("Failed to read checkpoint, %w", err)
+		}
+	}
+
+	it := source_db.Subscriptions(ctx, it_opts)
+	defer it.Close()
+
+	batch := make([]*subscription.Subscription, 0, sync_batch_size)
+
+	flush := func() error {
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		addrs := make([]string, len(batch))
+
+		for i, sub := range batch {
+			addrs[i] = sub.Address
+		}
+
+		existing, err := dest_db.GetSubscriptionsWithAddresses(ctx, addrs)
+
+		if err != nil {
+			return err
+		}
+
+		lookup := make(map[string]*subscription.Subscription)
+
+		for _, sub := range existing {
+			lookup[sub.Address] = sub
+		}
+
+		for _, sub := range batch {
+
+			dest_sub, ok := lookup[sub.Address]
+
+			switch {
+			case !ok:
+				st.created += 1
+			case dest_sub.LastModified < sub.LastModified:
+				st.updated += 1
+			default:
+				st.unchanged += 1
+				continue
+			}
+
+			if dry_run {
+				log.Printf("Would copy %s\n", sub.Address)
+				continue
+			}
+
+			if writer != nil {
+
+				err := writer.Put(ctx, sub)
+
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// UpdateSubscription writes the record unconditionally so it is used for both new and changed subscriptions
+
+			err := dest_db.UpdateSubscription(sub)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		batch = batch[:0]
+
+		if checkpoint == "" || dry_run {
+			return nil
+		}
+
+		// batched writes are flushed first so that the checkpoint never records a position beyond the
+		// subscriptions which have actually been copied
+
+		if writer != nil {
+
+			err := writer.Flush(ctx)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		token, err := it.Token()
+
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(checkpoint, []byte(token), 0644)
+
+		if err != nil {
+			return fmt.Errorf("Failed to write checkpoint, %w", err)
+		}
+
+		return nil
+	}
+
+	for it.Next() {
+
+		st.read += 1
+		batch = append(batch, it.Subscription())
+
+		if len(batch) == sync_batch_size {
+
+			err := flush()
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := it.Err()
+
+	if err != nil {
+		return err
+	}
+
+	err = flush()
+
+	if err != nil {
+		return err
+	}
+
+	if checkpoint != "" && !dry_run {
+
+		err := os.Remove(checkpoint)
+
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to remove checkpoint, %w", err)
+		}
+	}
+
+	return nil
+}
+
+// removeSubscriptions removes each subscription in 'dest_db' which is not present in 'source_db'. If 'writer'
+// is not nil it is used to remove them.
+func removeSubscriptions(ctx context.Context, source_db *dynamodb.DynamoDBSubscriptionsDatabase, dest_db *dynamodb.DynamoDBSubscriptionsDatabase, writer *dynamodb.BatchWriter, st *stats, dry_run bool) error {
+
+	it := dest_db.Subscriptions(ctx, nil)
+	defer it.Close()
+
+	batch := make([]*subscription.Subscription, 0, sync_batch_size)
+
+	flush := func() error {
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		addrs := make([]string, len(batch))
+
+		for i, sub := range batch {
+			addrs[i] = sub.Address
+		}
+
+		existing, err := source_db.GetSubscriptionsWithAddresses(ctx, addrs)
+
+		if err != nil {
+			return err
+		}
+
+		lookup := make(map[string]bool)
+
+		for _, sub := range existing {
+			lookup[sub.Address] = true
+		}
+
+		for _, sub := range batch {
+
+			if lookup[sub.Address] {
+				continue
+			}
+
+			st.removed += 1
+
+			if dry_run {
+				log.Printf("Would remove %s\n", sub.Address)
+				continue
+			}
+
+			if writer != nil {
+
+				err := writer.Delete(ctx, sub)
+
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			err := dest_db.RemoveSubscription(sub)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		batch = batch[:0]
+		return nil
+	}
+
+	for it.Next() {
+
+		batch = append(batch, it.Subscription())
+
+		if len(batch) == sync_batch_size {
+
+			err := flush()
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := it.Err()
+
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
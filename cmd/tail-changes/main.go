@@ -0,0 +1,131 @@
+// tail-changes is a command-line tool to output the changes to subscriptions, read from the table's DynamoDB stream
+// (see the Change feeds section of docs/scans-and-writes.md), as JSON, one change per line, as they are made. Use
+// `-checkpoint` to record the position of the feed in a file after each change, so that a stopped feed resumes where it
+// stopped, and `-latest` to skip the changes made before it starts.
+//
+//	$> ./bin/tail-changes -dsn 'region=us-east-1 credentials=session' -table-prefix prod_ -checkpoint changes.token
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	checkpoint := flag.String("checkpoint", "", "The path of an optional file in which to record the position of the change feed after each change, so that it can be resumed. If the file exists the change feed resumes from the position it records.")
+	latest := flag.Bool("latest", false, "Only output changes made after the change feed starts, unless it is resumed from a checkpoint.")
+	poll_interval := flag.Duration("poll-interval", dynamodb.CHANGE_FEED_DEFAULT_POLL_INTERVAL, "The time to wait for new changes once every shard of the stream has been read.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Output the changes to subscriptions, read from the DynamoDB stream of the subscriptions table, as JSON, one per line.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = *subs_table
+	subs_opts.TablePrefix = *table_prefix
+	subs_opts.TableSuffix = *table_suffix
+
+	reader, err := dynamodb.NewChangeFeedReaderWithDSN(*dsn, subs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create change feed reader, %v", err)
+	}
+
+	reader.PollInterval = *poll_interval
+	reader.StartAtLatest = *latest
+
+	var since *dynamodb.ChangeFeedCheckpoint
+
+	if *checkpoint != "" {
+
+		token, err := os.ReadFile(*checkpoint)
+
+		switch {
+		case err == nil:
+
+			since, err = dynamodb.ParseChangeFeedCheckpoint(strings.TrimSpace(string(token)))
+
+			if err != nil {
+				log.Fatalf("Failed to parse checkpoint, %v", err)
+			}
+
+			log.Printf("Resuming change feed from %s\n", *checkpoint)
+
+		case !os.IsNotExist(err):
+			log.Fatalf("Failed to read checkpoint, %v", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	it := reader.ChangeFeed(ctx, since)
+	defer it.Close()
+
+	enc := json.NewEncoder(os.Stdout)
+
+	for it.Next() {
+
+		ch := it.Change()
+
+		err := enc.Encode(ch)
+
+		if err != nil {
+			log.Fatalf("Failed to encode change, %v", err)
+		}
+
+		if *checkpoint == "" {
+			continue
+		}
+
+		token, err := it.Checkpoint().Token()
+
+		if err != nil {
+			log.Fatalf("Failed to encode checkpoint, %v", err)
+		}
+
+		// the checkpoint is replaced, rather than truncated and rewritten, so that an interrupted write
+		// never leaves it empty
+
+		tmp := *checkpoint + ".tmp"
+
+		err = os.WriteFile(tmp, []byte(token), 0644)
+
+		if err != nil {
+			log.Fatalf("Failed to write checkpoint, %v", err)
+		}
+
+		err = os.Rename(tmp, *checkpoint)
+
+		if err != nil {
+			log.Fatalf("Failed to write checkpoint, %v", err)
+		}
+	}
+
+	err = it.Err()
+
+	if err != nil && ctx.Err() == nil {
+		log.Fatalf("Failed to read change feed for %s, %v", subs_opts.FullTableName(), err)
+	}
+
+	os.Exit(0)
+}
@@ -1,6 +1,8 @@
+// unsubscribe is a command-line tool to remove the subscription for `-address`.
 package main
 
 import (
+	"context"
 	"flag"
 	"github.com/aaronland/go-mailinglist-database-dynamodb"
 	"log"
@@ -14,24 +16,25 @@ func main() {
 
 	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
 
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
 	flag.Parse()
 
 	opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
 	opts.TableName = *subs_table
+	opts.TablePrefix = *table_prefix
+	opts.TableSuffix = *table_suffix
 
-	db, err := dynamodb.NewDynamoDBSubscriptionsDatabaseWithDSN(*dsn, opts)
+	db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, opts)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sub, err := db.GetSubscriptionWithAddress(*addr)
-
-	if err != nil {
-		log.Fatal(err)
-	}
+	ctx := context.Background()
 
-	err = db.RemoveSubscription(sub)
+	_, err = db.RemoveSubscriptionWithAddress(ctx, *addr)
 
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,308 @@
+// verify is a command-line tool to check the subscriptions and confirmations tables for records which break the
+// package's invariants, and optionally repair them. A tab-separated line is printed for each violation:
+//
+//   - `invalid-timestamps` – a subscription with a missing created time, or one that was confirmed or modified before
+//     it was created. Repair: derive consistent timestamps from the earliest known time.
+//   - `unconfirmed-enabled` – an enabled subscription which was never confirmed. Repair: none, reported only.
+//   - `orphaned-confirmation` – a confirmation for an address with no subscription. Repair: remove the confirmation.
+//   - `expired-confirmation` – a confirmation older than `-max-age`. Repair: remove the confirmation.
+//
+// For example:
+//
+//	$> ./bin/verify -dsn 'region=us-east-1 credentials=session' -table-prefix prod_ -repair
+//
+// The tool exits non-zero if any violations remain unresolved.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	"github.com/aaronland/go-mailinglist/subscription"
+	"log"
+	"os"
+	"time"
+)
+
+// violation is a record which breaks one of the invariants checked by this tool.
+type violation struct {
+	kind   string
+	key    string
+	detail string
+	// repair fixes the violation. It is nil if the violation can only be reported.
+	repair func(context.Context) error
+}
+
+func main() {
+
+	dsn := flag.String("dsn", "", "...")
+
+	subs_table := flag.String("subscriptions-table", dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME, "...")
+	conf_table := flag.String("confirmations-table", dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME, "...")
+
+	table_prefix := flag.String("table-prefix", "", "An optional string to prepend to table names, for example \"prod_\".")
+	table_suffix := flag.String("table-suffix", "", "An optional string to append to table names, for example \"_staging\".")
+
+	max_age := flag.Duration("max-age", dynamodb.CONFIRMATIONS_DEFAULT_MAX_AGE, "The age after which confirmations are considered expired.")
+	repair := flag.Bool("repair", false, "Repair violations where possible, rather than only reporting them.")
+
+	flag.Parse()
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = *subs_table
+	subs_opts.TablePrefix = *table_prefix
+	subs_opts.TableSuffix = *table_suffix
+
+	subs_db, err := dynamodb.NewSubscriptionsDatabaseWithDSN(*dsn, subs_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create subscriptions database, %v", err)
+	}
+
+	conf_opts := dynamodb.DefaultDynamoDBConfirmationsDatabaseOptions()
+	conf_opts.TableName = *conf_table
+	conf_opts.TablePrefix = *table_prefix
+	conf_opts.TableSuffix = *table_suffix
+	conf_opts.MaxAge = *max_age
+
+	conf_db, err := dynamodb.NewConfirmationsDatabaseWithDSN(*dsn, conf_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create confirmations database, %v", err)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+
+	violations, err := checkSubscriptions(ctx, subs_db, now)
+
+	if err != nil {
+		log.Fatalf("Failed to check subscriptions, %v", err)
+	}
+
+	conf_violations, err := checkConfirmations(ctx, subs_db, conf_db, now, *max_age)
+
+	if err != nil {
+		log.Fatalf("Failed to check confirmations, %v", err)
+	}
+
+	violations = append(violations, conf_violations...)
+
+	unresolved := 0
+
+	for _, v := range violations {
+
+		status := "reported"
+
+		if *repair && v.repair != nil {
+
+			err := v.repair(ctx)
+
+			if err != nil {
+				status = fmt.Sprintf("repair failed: %v", err)
+				unresolved += 1
+			} else {
+				status = "repaired"
+			}
+
+		} else {
+			unresolved += 1
+		}
+
+		fmt.Printf("%s\t%s\t%s\t%s\n", v.kind, v.key, v.detail, status)
+	}
+
+	log.Printf("Found %d violations, %d unresolved\n", len(violations), unresolved)
+
+	if unresolved > 0 {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// checkSubscriptions checks that every subscription has a creation time, that it was not confirmed or modified
+// before it was created and that enabled subscriptions have been confirmed.
+func checkSubscriptions(ctx context.Context, subs_db *dynamodb.DynamoDBSubscriptionsDatabase, now time.Time) ([]*violation, error) {
+
+	violations := make([]*violation, 0)
+
+	cb := func(sub *subscription.Subscription) error {
+
+		detail := ""
+
+		switch {
+		case sub.Created <= 0:
+			detail = "missing created time"
+		case sub.Created > now.Unix():
+			detail = fmt.Sprintf("created time %d is in the future", sub.Created)
+		case sub.Confirmed > 0 && sub.Confirmed < sub.Created:
+			detail = fmt.Sprintf("confirmed (%d) before created (%d)", sub.Confirmed, sub.Created)
+		case sub.LastModified > 0 && sub.LastModified < sub.Created:
+			detail = fmt.Sprintf("modified (%d) before created (%d)", sub.LastModified, sub.Created)
+		case sub.Confirmed > 0 && sub.LastModified < sub.Confirmed:
+			detail = fmt.Sprintf("modified (%d) before confirmed (%d)", sub.LastModified, sub.Confirmed)
+		}
+
+		if detail != "" {
+
+			repaired := repairTimestamps(sub, now)
+
+			violations = append(violations, &violation{
+				kind:   "invalid-timestamps",
+				key:    sub.Address,
+				detail: detail,
+				repair: func(ctx context.Context) error {
+					return subs_db.UpdateSubscription(repaired)
+				},
+			})
+		}
+
+		if sub.Status == subscription.SUBSCRIPTION_STATUS_ENABLED && sub.Confirmed == 0 {
+
+			violations = append(violations, &violation{
+				kind:   "unconfirmed-enabled",
+				key:    sub.Address,
+				detail: "subscription is enabled but has not been confirmed",
+			})
+		}
+
+		return nil
+	}
+
+	err := subs_db.ListSubscriptions(ctx, cb)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return violations, nil
+}
+
+// repairTimestamps returns a copy of 'sub' whose created, confirmed and lastmodified times are consistent, using
+// the earliest known time as the creation time.
+func repairTimestamps(sub *subscription.Subscription, now time.Time) *subscription.Subscription {
+
+	repaired := *sub
+
+	created := repaired.Created
+
+	if created <= 0 || created > now.Unix() {
+		created = now.Unix()
+	}
+
+	for _, t := range []int64{repaired.Confirmed, repaired.LastModified} {
+
+		if t > 0 && t < created {
+			created = t
+		}
+	}
+
+	repaired.Created = created
+
+	if repaired.LastModified < repaired.Created {
+		repaired.LastModified = repaired.Created
+	}
+
+	if repaired.LastModified < repaired.Confirmed {
+		repaired.LastModified = repaired.Confirmed
+	}
+
+	return &repaired
+}
+
+// checkConfirmations checks that every confirmation has not expired and references an existing subscription.
+func checkConfirmations(ctx context.Context, subs_db *dynamodb.DynamoDBSubscriptionsDatabase, conf_db *dynamodb.DynamoDBConfirmationsDatabase, now time.Time, max_age time.Duration) ([]*violation, error) {
+
+	violations := make([]*violation, 0)
+	pending := make([]*confirmation.Confirmation, 0)
+
+	remove := func(conf *confirmation.Confirmation) func(context.Context) error {
+		return func(ctx context.Context) error {
+			return conf_db.RemoveConfirmation(conf)
+		}
+	}
+
+	checkAddresses := func() error {
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		addrs := make([]string, len(pending))
+
+		for i, conf := range pending {
+			addrs[i] = conf.Address
+		}
+
+		subs, err := subs_db.GetSubscriptionsWithAddresses(ctx, addrs)
+
+		if err != nil {
+			return err
+		}
+
+		found := make(map[string]bool)
+
+		for _, sub := range subs {
+			found[sub.Address] = true
+		}
+
+		for _, conf := range pending {
+
+			if found[conf.Address] {
+				continue
+			}
+
+			violations = append(violations, &violation{
+				kind:   "orphaned-confirmation",
+				key:    conf.Code,
+				detail: fmt.Sprintf("no subscription for %s", conf.Address),
+				repair: remove(conf),
+			})
+		}
+
+		pending = pending[:0]
+		return nil
+	}
+
+	min_created := now.Add(-max_age).Unix()
+
+	cb := func(conf *confirmation.Confirmation) error {
+
+		if conf.Created < min_created {
+
+			violations = append(violations, &violation{
+				kind:   "expired-confirmation",
+				key:    conf.Code,
+				detail: fmt.Sprintf("created %s for %s", time.Unix(conf.Created, 0).Format(time.RFC3339), conf.Address),
+				repair: remove(conf),
+			})
+
+			return nil
+		}
+
+		pending = append(pending, conf)
+
+		if len(pending) == dynamodb.BATCH_GET_MAX_KEYS {
+			return checkAddresses()
+		}
+
+		return nil
+	}
+
+	err := conf_db.ListConfirmations(ctx, cb)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkAddresses()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return violations, nil
+}
@@ -0,0 +1,69 @@
+package dynamodb
+
+import (
+	"crypto/rand"
+	"errors"
+	"github.com/aaronland/go-string/random"
+	"math/big"
+)
+
+// CODE_ALPHABET_ALPHANUMERIC is the set of characters a-z, A-Z and 0-9.
+const CODE_ALPHABET_ALPHANUMERIC string = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// CODE_ALPHABET_URL_SAFE is the set of characters that can be used in a URL without escaping.
+const CODE_ALPHABET_URL_SAFE string = CODE_ALPHABET_ALPHANUMERIC + "-_"
+
+// CODE_ALPHABET_HUMAN is a set of upper-case characters and digits which excludes easily confused
+// characters (0/O, 1/I/L) for codes that people may need to read or type.
+const CODE_ALPHABET_HUMAN string = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// CodeGeneratorFunc is a function that returns a new confirmation code.
+type CodeGeneratorFunc func() (string, error)
+
+// DefaultCodeGenerator returns a new 64-character alphanumeric code, generated the same way as
+// `confirmation.NewConfirmationForSubscription`.
+func DefaultCodeGenerator() (string, error) {
+
+	opts := random.DefaultOptions()
+	opts.AlphaNumeric = true
+	opts.Chars = 64
+
+	return random.String(opts)
+}
+
+// NewAlphabetCodeGenerator returns a `CodeGeneratorFunc` that produces codes of 'length' characters chosen
+// from 'alphabet' using a cryptographically secure random number generator.
+func NewAlphabetCodeGenerator(length int, alphabet string) (CodeGeneratorFunc, error) {
+
+	if length < 1 {
+		return nil, errors.New("Code length must be greater than zero")
+	}
+
+	chars := []rune(alphabet)
+
+	if len(chars) < 2 {
+		return nil, errors.New("Code alphabet must contain at least two characters")
+	}
+
+	max := big.NewInt(int64(len(chars)))
+
+	fn := func() (string, error) {
+
+		code := make([]rune, length)
+
+		for i := 0; i < length; i++ {
+
+			n, err := rand.Int(rand.Reader, max)
+
+			if err != nil {
+				return "", err
+			}
+
+			code[i] = chars[n.Int64()]
+		}
+
+		return string(code), nil
+	}
+
+	return fn, nil
+}
@@ -3,54 +3,223 @@ package dynamodb
 import (
 	"context"
 	"errors"
-	"github.com/aaronland/go-aws-session"
+	"fmt"
 	"github.com/aaronland/go-mailinglist/confirmation"
 	"github.com/aaronland/go-mailinglist/database"
 	aws "github.com/aws/aws-sdk-go/aws"
 	aws_session "github.com/aws/aws-sdk-go/aws/session"
 	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
 	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
 )
 
 const CONFIRMATIONS_DEFAULT_TABLENAME string = "confirmations"
 
+// CONFIRMATIONS_DEFAULT_MAX_AGE is the default age after which confirmations are considered expired. It matches
+// the value used by `confirmation.Confirmation.IsExpired`.
+const CONFIRMATIONS_DEFAULT_MAX_AGE time.Duration = time.Hour
+
+// CONFIRMATIONS_DEFAULT_KEY_ATTRIBUTE is the default name of the confirmations table's partition key attribute,
+// which holds each confirmation's code.
+const CONFIRMATIONS_DEFAULT_KEY_ATTRIBUTE string = "code"
+
+// CONFIRMATION_CODE_MAX_ATTEMPTS is the maximum number of codes AddConfirmation will try before giving up.
+const CONFIRMATION_CODE_MAX_ATTEMPTS int = 5
+
 type DynamoDBConfirmationsDatabaseOptions struct {
 	TableName   string
+	TablePrefix string
+	TableSuffix string
 	BillingMode string
 	CreateTable bool
+	// DeletionProtection enables deletion protection when the table is created.
+	DeletionProtection bool
+	// TableClass is the table class (STANDARD or STANDARD_INFREQUENT_ACCESS) used when the table is created.
+	// If empty STANDARD is used.
+	TableClass string
+	// ContributorInsights enables CloudWatch Contributor Insights for the table and its indexes when the table is created.
+	ContributorInsights bool
+	// KinesisStreamArn is the ARN of an optional Kinesis data stream to which changes to the table are streamed,
+	// enabled when the table is created. See the changes package for decoding the resulting records.
+	KinesisStreamArn string
+	// Indexes are additional, user-defined, global secondary indexes to include when the table is created.
+	Indexes []SecondaryIndex
+	// MaxAge is the age after which a confirmation is considered expired. If zero CONFIRMATIONS_DEFAULT_MAX_AGE is used.
+	MaxAge time.Duration
+	// KeyAttribute is the name of the table's partition key attribute, which holds each confirmation's code, for
+	// use with existing tables which name it differently. If empty CONFIRMATIONS_DEFAULT_KEY_ATTRIBUTE is used.
+	KeyAttribute string
+	// ExpiresAttribute is the name of an optional attribute each confirmation's expiry time (its created time plus
+	// MaxAge, as a Unix timestamp) is written to, for use with DynamoDB TTL. TTL is enabled for it when the table is
+	// created. If empty no expiry time is written.
+	ExpiresAttribute string
+	// CodeGenerator is an optional function used to generate confirmation codes. If set every confirmation is
+	// assigned a new code from this function when it is added. If nil DefaultCodeGenerator is used to replace
+	// codes that collide with existing confirmations.
+	CodeGenerator CodeGeneratorFunc
+	// ReturnConsumedCapacity is the level of consumed capacity detail (TOTAL or INDEXES) to request when
+	// ConsumedCapacityFunc is set. If empty TOTAL is used.
+	ReturnConsumedCapacity string
+	// ConsumedCapacityFunc is an optional callback invoked with the capacity consumed by each request.
+	ConsumedCapacityFunc ConsumedCapacityFunc
+	// CapacityLimiter is an optional `CapacityLimiter` which caps the read and write capacity consumed per second.
+	CapacityLimiter *CapacityLimiter
+	// Middleware is an optional chain of `Middleware` invoked around each request to DynamoDB, the first of which is outermost.
+	Middleware []Middleware
+	// ReadOnly rejects every request which would write to the table with ErrReadOnly, before it is sent. It may not
+	// be used with CreateTable.
+	ReadOnly bool
+	// HTTPClient is an optional HTTP client used by the session and DSN constructors in place of the session's
+	// default client. See `NewHTTPClient`.
+	HTTPClient *http.Client
+	// Region is the AWS region of the table, used in place of the session's region by the session and DSN constructors.
+	// If empty the region of the table's ARN, if TableName is an ARN, and otherwise the session's region is used.
+	Region string
+	// Endpoint is the URL of the DynamoDB endpoint, for example "http://localhost:8000" for DynamoDB Local, used in place
+	// of the session's endpoint by the session and DSN constructors. It takes precedence over UseFIPSEndpoint and
+	// UseDualStackEndpoint. If empty the session's endpoint is used.
+	Endpoint string
+	// UseFIPSEndpoint selects the FIPS 140-2 validated DynamoDB endpoint for the session's region.
+	UseFIPSEndpoint bool
+	// UseDualStackEndpoint selects the dual-stack (IPv4 and IPv6) DynamoDB endpoint for the session's region.
+	UseDualStackEndpoint bool
+	// Retry is an optional `RetryOptions` used to retry failed requests in place of the AWS SDK's default retryer.
+	Retry *RetryOptions
 }
 
 func DefaultDynamoDBConfirmationsDatabaseOptions() *DynamoDBConfirmationsDatabaseOptions {
 
 	opts := DynamoDBConfirmationsDatabaseOptions{
-		TableName:   CONFIRMATIONS_DEFAULT_TABLENAME,
-		BillingMode: "PAY_PER_REQUEST",
-		CreateTable: false,
+		TableName:    CONFIRMATIONS_DEFAULT_TABLENAME,
+		BillingMode:  "PAY_PER_REQUEST",
+		CreateTable:  false,
+		MaxAge:       CONFIRMATIONS_DEFAULT_MAX_AGE,
+		KeyAttribute: CONFIRMATIONS_DEFAULT_KEY_ATTRIBUTE,
 	}
 
 	return &opts
 }
 
+// FullTableName returns the name of the table with the TablePrefix and TableSuffix options applied.
+func (opts *DynamoDBConfirmationsDatabaseOptions) FullTableName() string {
+	return fullTableName(opts.TablePrefix, opts.TableName, opts.TableSuffix)
+}
+
+func (opts *DynamoDBConfirmationsDatabaseOptions) maxAge() time.Duration {
+
+	if opts.MaxAge <= 0 {
+		return CONFIRMATIONS_DEFAULT_MAX_AGE
+	}
+
+	return opts.MaxAge
+}
+
+// expires returns the time after which 'conf' expires under the MaxAge option.
+func (opts *DynamoDBConfirmationsDatabaseOptions) expires(conf *confirmation.Confirmation) time.Time {
+	return time.Unix(conf.Created, 0).Add(opts.maxAge())
+}
+
+// minCreated returns the oldest created time, in seconds, of a confirmation that is still valid at 'now'.
+func (opts *DynamoDBConfirmationsDatabaseOptions) minCreated(now time.Time) int64 {
+	return now.Add(-opts.maxAge()).Unix()
+}
+
+// isExpired reports whether a confirmation created at 'created' is expired given the oldest valid created time
+// 'min_created', returned by `minCreated`. It agrees with `ConfirmationExpires`: confirmations are valid up to
+// and including their expiry time.
+func isExpired(created int64, min_created int64) bool {
+	return created < min_created
+}
+
+func (opts *DynamoDBConfirmationsDatabaseOptions) keyAttribute() string {
+
+	if opts.KeyAttribute == "" {
+		return CONFIRMATIONS_DEFAULT_KEY_ATTRIBUTE
+	}
+
+	return opts.KeyAttribute
+}
+
 type DynamoDBConfirmationsDatabase struct {
 	database.ConfirmationsDatabase
-	client  *aws_dynamodb.DynamoDB
+	client  aws_dynamodbiface.DynamoDBAPI
 	options *DynamoDBConfirmationsDatabaseOptions
 }
 
+// NewDynamoDBConfirmationsDatabaseWithDSN returns a new `database.ConfirmationsDatabase` for 'dsn'. See
+// `NewConfirmationsDatabaseWithDSN` for a constructor which returns the concrete `DynamoDBConfirmationsDatabase`.
 func NewDynamoDBConfirmationsDatabaseWithDSN(dsn string, opts *DynamoDBConfirmationsDatabaseOptions) (database.ConfirmationsDatabase, error) {
 
-	sess, err := session.NewSessionWithDSN(dsn)
+	db, err := NewConfirmationsDatabaseWithDSN(dsn, opts)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return NewDynamoDBConfirmationsDatabaseWithSession(sess, opts)
+	return db, nil
 }
 
+// NewDynamoDBConfirmationsDatabaseWithSession returns a new `database.ConfirmationsDatabase` for 'sess'. See
+// `NewConfirmationsDatabaseWithSession` for a constructor which returns the concrete `DynamoDBConfirmationsDatabase`.
 func NewDynamoDBConfirmationsDatabaseWithSession(sess *aws_session.Session, opts *DynamoDBConfirmationsDatabaseOptions) (database.ConfirmationsDatabase, error) {
 
-	client := aws_dynamodb.New(sess)
+	db, err := NewConfirmationsDatabaseWithSession(sess, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewDynamoDBConfirmationsDatabaseWithClient returns a new `database.ConfirmationsDatabase` that uses 'client' to talk to
+// DynamoDB. See `NewConfirmationsDatabaseWithClient` for a constructor which returns the concrete `DynamoDBConfirmationsDatabase`.
+func NewDynamoDBConfirmationsDatabaseWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBConfirmationsDatabaseOptions) (database.ConfirmationsDatabase, error) {
+
+	db, err := NewConfirmationsDatabaseWithClient(client, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewConfirmationsDatabaseWithDSN returns a new `DynamoDBConfirmationsDatabase` instance for 'dsn'. Table names and
+// endpoint settings assigned in 'dsn' are assigned to 'opts'.
+func NewConfirmationsDatabaseWithDSN(dsn string, opts *DynamoDBConfirmationsDatabaseOptions) (*DynamoDBConfirmationsDatabase, error) {
+
+	sess, err := newSessionWithDSNSettings(dsn, DSN_CONFIRMATIONS_TABLE_KEY, opts.settings())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConfirmationsDatabaseWithSession(sess, opts)
+}
+
+// NewConfirmationsDatabaseWithSession returns a new `DynamoDBConfirmationsDatabase` instance for 'sess'.
+func NewConfirmationsDatabaseWithSession(sess *aws_session.Session, opts *DynamoDBConfirmationsDatabaseOptions) (*DynamoDBConfirmationsDatabase, error) {
+
+	client := opts.settings().newClient(sess)
+
+	return NewConfirmationsDatabaseWithClient(client, opts)
+}
+
+// NewConfirmationsDatabaseWithClient returns a new `DynamoDBConfirmationsDatabase` instance that uses 'client' to talk to DynamoDB.
+func NewConfirmationsDatabaseWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBConfirmationsDatabaseOptions) (*DynamoDBConfirmationsDatabase, error) {
+
+	err := opts.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	client = withMiddleware(client, opts.settings().middleware())
 
 	if opts.CreateTable {
 
@@ -69,68 +238,577 @@ func NewDynamoDBConfirmationsDatabaseWithSession(sess *aws_session.Session, opts
 	return &db, nil
 }
 
+// AddConfirmation stores 'conf' using a conditional write that fails if its code is already in use. If the code
+// collides with an existing confirmation a new code is generated, and assigned to 'conf', and the write is retried
+// up to CONFIRMATION_CODE_MAX_ATTEMPTS times. If the CodeGenerator option is set 'conf' is always assigned a new
+// code. Callers should therefore always read the code from 'conf' after this method returns.
 func (db *DynamoDBConfirmationsDatabase) AddConfirmation(conf *confirmation.Confirmation) error {
+	return db.AddConfirmationWithContext(context.Background(), conf)
+}
 
-	item, err := aws_dynamodbattribute.MarshalMap(conf)
+// AddConfirmationWithContext is the context-first equivalent of `AddConfirmation`.
+func (db *DynamoDBConfirmationsDatabase) AddConfirmationWithContext(ctx context.Context, conf *confirmation.Confirmation) error {
+
+	ctx = withOperation(ctx, "AddConfirmation")
+	return db.addConfirmation(ctx, conf)
+}
+
+// AddConfirmationWithExpiry stores 'conf', in the same way as `AddConfirmation`, and returns the time after which
+// it expires (see `ConfirmationExpires`), for example so that the message sending its code can say when it stops
+// working. If the ExpiresAttribute option is set the same time is written to that attribute.
+func (db *DynamoDBConfirmationsDatabase) AddConfirmationWithExpiry(ctx context.Context, conf *confirmation.Confirmation) (time.Time, error) {
+
+	ctx = withOperation(ctx, "AddConfirmationWithExpiry")
+
+	err := db.addConfirmation(ctx, conf)
 
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
 
-	req := &aws_dynamodb.PutItemInput{
-		Item:      item,
-		TableName: aws.String(db.options.TableName),
+	return db.ConfirmationExpires(conf), nil
+}
+
+// ConfirmationExpires returns the time after which 'conf' is treated as expired: its created time plus the MaxAge
+// option. Confirmations remain valid up to and including this time, to the second.
+func (db *DynamoDBConfirmationsDatabase) ConfirmationExpires(conf *confirmation.Confirmation) time.Time {
+	return db.options.expires(conf)
+}
+
+func (db *DynamoDBConfirmationsDatabase) addConfirmation(ctx context.Context, conf *confirmation.Confirmation) error {
+
+	if db.options.CodeGenerator != nil {
+
+		code, err := db.options.CodeGenerator()
+
+		if err != nil {
+			return fmt.Errorf("Failed to generate confirmation code, %w", err)
+		}
+
+		conf.Code = code
 	}
 
-	_, err = db.client.PutItem(req)
+	for attempt := 1; ; attempt++ {
+
+		err := putConfirmationIfNotExists(ctx, db.client, db.options, conf)
+
+		if err == nil {
+			return nil
+		}
+
+		if !errors.Is(err, ErrConditionFailed) {
+			return err
+		}
+
+		if attempt >= CONFIRMATION_CODE_MAX_ATTEMPTS {
+			return fmt.Errorf("Failed to generate a unique confirmation code after %d attempts, %w", attempt, ErrAlreadyExists)
+		}
+
+		code, err := db.newCode()
+
+		if err != nil {
+			return fmt.Errorf("Failed to generate new confirmation code, %w", err)
+		}
+
+		conf.Code = code
+	}
+}
+
+func (db *DynamoDBConfirmationsDatabase) RemoveConfirmation(conf *confirmation.Confirmation) error {
+	return db.RemoveConfirmationWithContext(context.Background(), conf)
+}
+
+// RemoveConfirmationWithContext is the context-first equivalent of `RemoveConfirmation`.
+func (db *DynamoDBConfirmationsDatabase) RemoveConfirmationWithContext(ctx context.Context, conf *confirmation.Confirmation) error {
+
+	ctx = withOperation(ctx, "RemoveConfirmation")
+	return db.removeConfirmation(ctx, conf)
+}
+
+func (db *DynamoDBConfirmationsDatabase) removeConfirmation(ctx context.Context, conf *confirmation.Confirmation) error {
+
+	_, err := db.deleteConfirmation(ctx, conf.Code)
+	return err
+}
+
+// RemoveConfirmationWithCode removes the confirmation for 'code', returning the confirmation as it was when it was
+// removed. Unlike `ConsumeConfirmation` expired confirmations are removed too. It returns a `database.NoRecordError`
+// if there was no confirmation for 'code'.
+func (db *DynamoDBConfirmationsDatabase) RemoveConfirmationWithCode(ctx context.Context, code string) (*confirmation.Confirmation, error) {
+
+	ctx = withOperation(ctx, "RemoveConfirmationWithCode")
+
+	removed, err := db.deleteConfirmation(ctx, code)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	if removed == nil {
+		return nil, new(database.NoRecordError)
+	}
+
+	return removed, nil
 }
 
-func (db *DynamoDBConfirmationsDatabase) RemoveConfirmation(conf *confirmation.Confirmation) error {
+// deleteConfirmation deletes the confirmation for 'code' using a DeleteItem request which returns the deleted item.
+// It returns the confirmation as it was before it was deleted, or nil if there was no confirmation for 'code'.
+func (db *DynamoDBConfirmationsDatabase) deleteConfirmation(ctx context.Context, code string) (*confirmation.Confirmation, error) {
 
 	req := &aws_dynamodb.DeleteItemInput{
-		TableName: aws.String(db.options.TableName),
+		TableName: aws.String(db.options.FullTableName()),
 		Key: map[string]*aws_dynamodb.AttributeValue{
-			"code": {
-				S: aws.String(conf.Code),
+			db.options.keyAttribute(): {
+				S: aws.String(code),
 			},
 		},
+		ReturnValues: aws.String(aws_dynamodb.ReturnValueAllOld),
 	}
 
-	_, err := db.client.DeleteItem(req)
+	rsp, err := db.client.DeleteItemWithContext(ctx, req)
 
 	if err != nil {
-		return err
+		return nil, wrapError(err)
 	}
 
-	return nil
+	if len(rsp.Attributes) == 0 {
+		return nil, nil
+	}
+
+	return itemToConfirmation(db.options, rsp.Attributes)
 }
 
+// GetConfirmationWithCode returns the confirmation for 'code'. Confirmations older than the MaxAge option are
+// treated as missing, since TTL may not remove them for some time after they expire, and a `ConfirmationExpiredError`
+// (for which `IsNotExist` reports true) is returned.
 func (db *DynamoDBConfirmationsDatabase) GetConfirmationWithCode(code string) (*confirmation.Confirmation, error) {
+	return db.GetConfirmationWithCodeWithContext(context.Background(), code)
+}
+
+// GetConfirmationWithCodeWithContext is the context-first equivalent of `GetConfirmationWithCode`.
+func (db *DynamoDBConfirmationsDatabase) GetConfirmationWithCodeWithContext(ctx context.Context, code string) (*confirmation.Confirmation, error) {
+
+	ctx = withOperation(ctx, "GetConfirmationWithCode")
+	return db.getConfirmationWithCode(ctx, code)
+}
+
+func (db *DynamoDBConfirmationsDatabase) getConfirmationWithCode(ctx context.Context, code string) (*confirmation.Confirmation, error) {
 
 	req := &aws_dynamodb.GetItemInput{
-		TableName: aws.String(db.options.TableName),
+		TableName: aws.String(db.options.FullTableName()),
 		Key: map[string]*aws_dynamodb.AttributeValue{
-			"code": {
+			db.options.keyAttribute(): {
 				S: aws.String(code),
 			},
 		},
 	}
 
-	rsp, err := db.client.GetItem(req)
+	rsp, err := db.client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	conf, err := itemToConfirmation(db.options, rsp.Item)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// expired confirmations are removed by TTL lazily, if at all, so don't return them
+
+	min_created := db.options.minCreated(time.Now())
+
+	if isExpired(conf.Created, min_created) {
+		return nil, &ConfirmationExpiredError{Code: conf.Code, Created: conf.Created}
+	}
+
+	return conf, nil
+}
+
+// GetConfirmationsWithCodes returns the confirmations for 'codes', in the order they were requested, using
+// BatchGetItem requests of up to BATCH_GET_MAX_KEYS keys each. Duplicate codes are only requested once and codes
+// without a confirmation, or whose confirmation is older than the MaxAge option, are omitted from the results.
+func (db *DynamoDBConfirmationsDatabase) GetConfirmationsWithCodes(ctx context.Context, codes []string) ([]*confirmation.Confirmation, error) {
+
+	ctx = withOperation(ctx, "GetConfirmationsWithCodes")
+
+	seen := make(map[string]bool)
+	unique := make([]string, 0)
+
+	for _, code := range codes {
+
+		if seen[code] {
+			continue
+		}
+
+		seen[code] = true
+		unique = append(unique, code)
+	}
+
+	min_created := db.options.minCreated(time.Now())
+	lookup := make(map[string]*confirmation.Confirmation)
+
+	for start := 0; start < len(unique); start += BATCH_GET_MAX_KEYS {
+
+		end := start + BATCH_GET_MAX_KEYS
+
+		if end > len(unique) {
+			end = len(unique)
+		}
+
+		keys := make([]map[string]*aws_dynamodb.AttributeValue, 0)
+
+		for _, code := range unique[start:end] {
+
+			k := map[string]*aws_dynamodb.AttributeValue{
+				db.options.keyAttribute(): {
+					S: aws.String(code),
+				},
+			}
+
+			keys = append(keys, k)
+		}
+
+		items, err := batchGetItems(ctx, db.client, db.options.FullTableName(), keys)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+
+			conf, err := itemToConfirmation(db.options, item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if isExpired(conf.Created, min_created) {
+				continue
+			}
+
+			lookup[conf.Code] = conf
+		}
+	}
+
+	confs := make([]*confirmation.Confirmation, 0)
+
+	for _, code := range unique {
+
+		conf, ok := lookup[code]
+
+		if ok {
+			confs = append(confs, conf)
+		}
+	}
+
+	return confs, nil
+}
+
+// GetConfirmationsForAddress returns the pending confirmations for 'addr', found using the "address" index, most
+// recent first. Confirmations older than the MaxAge option are omitted from the results.
+func (db *DynamoDBConfirmationsDatabase) GetConfirmationsForAddress(ctx context.Context, addr string) ([]*confirmation.Confirmation, error) {
+
+	ctx = withOperation(ctx, "GetConfirmationsForAddress")
+
+	all, err := db.confirmationsWithAddress(ctx, addr)
 
 	if err != nil {
 		return nil, err
 	}
 
+	min_created := db.options.minCreated(time.Now())
+	confs := make([]*confirmation.Confirmation, 0)
+
+	for i := len(all) - 1; i >= 0; i-- {
+
+		if isExpired(all[i].Created, min_created) {
+			continue
+		}
+
+		confs = append(confs, all[i])
+	}
+
+	return confs, nil
+}
+
+// ConsumeConfirmation atomically deletes and returns the confirmation for 'code', ensuring that a code can only
+// ever be redeemed once. If there is no confirmation for 'code' a `database.NoRecordError` is returned. If the
+// confirmation is older than the MaxAge option it is left in place and a `ConfirmationExpiredError` is returned.
+func (db *DynamoDBConfirmationsDatabase) ConsumeConfirmation(ctx context.Context, code string) (*confirmation.Confirmation, error) {
+
+	ctx = withOperation(ctx, "ConsumeConfirmation")
+
+	return db.consumeConfirmation(ctx, code, "")
+}
+
+// ConsumeConfirmationWithAction is like `ConsumeConfirmation` but the action of the confirmation for 'code' is a
+// condition of deleting it, so that a code issued for another action is never consumed. If the confirmation is for
+// another action it is left in place and an error wrapping ErrConfirmationAction is returned.
+func (db *DynamoDBConfirmationsDatabase) ConsumeConfirmationWithAction(ctx context.Context, code string, action string) (*confirmation.Confirmation, error) {
+
+	ctx = withOperation(ctx, "ConsumeConfirmationWithAction")
+
+	return db.consumeConfirmation(ctx, code, action)
+}
+
+// consumeConfirmation deletes and returns the confirmation for 'code', if it is for 'action' or 'action' is empty.
+func (db *DynamoDBConfirmationsDatabase) consumeConfirmation(ctx context.Context, code string, action string) (*confirmation.Confirmation, error) {
+
+	min_created := db.options.minCreated(time.Now())
+
+	req := &aws_dynamodb.DeleteItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			db.options.keyAttribute(): {
+				S: aws.String(code),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(#code) AND #created >= :min_created"),
+		ExpressionAttributeNames: map[string]*string{
+			"#code":    aws.String(db.options.keyAttribute()),
+			"#created": aws.String("created"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":min_created": {
+				N: aws.String(strconv.FormatInt(min_created, 10)),
+			},
+		},
+		ReturnValues:                        aws.String(aws_dynamodb.ReturnValueAllOld),
+		ReturnValuesOnConditionCheckFailure: aws.String(aws_dynamodb.ReturnValuesOnConditionCheckFailureAllOld),
+	}
+
+	if action != "" {
+
+		req.ConditionExpression = aws.String(*req.ConditionExpression + " AND #type = :type")
+		req.ExpressionAttributeNames["#type"] = aws.String("type")
+
+		req.ExpressionAttributeValues[":type"] = &aws_dynamodb.AttributeValue{
+			S: aws.String(action),
+		}
+	}
+
+	rsp, err := db.client.DeleteItemWithContext(ctx, req)
+
+	if err != nil {
+
+		var check_err *aws_dynamodb.ConditionalCheckFailedException
+
+		if !errors.As(err, &check_err) {
+			return nil, wrapError(err)
+		}
+
+		if len(check_err.Item) == 0 {
+			return nil, new(database.NoRecordError)
+		}
+
+		return nil, consumeConditionError(code, action, min_created, check_err.Item)
+	}
+
+	return itemToConfirmation(db.options, rsp.Attributes)
+}
+
+// consumeConditionError returns the reason the confirmation 'item', for 'code', failed the condition of
+// `consumeConfirmation`: a `ConfirmationExpiredError` if it was created before 'min_created' or otherwise
+// an error wrapping ErrConfirmationAction since its action is not 'action'.
+func consumeConditionError(code string, action string, min_created int64, item map[string]*aws_dynamodb.AttributeValue) error {
+
+	expired := &ConfirmationExpiredError{
+		Code: code,
+	}
+
+	created, ok := item["created"]
+
+	if ok && created.N != nil {
+		expired.Created, _ = strconv.ParseInt(*created.N, 10, 64)
+	}
+
+	if action == "" || isExpired(expired.Created, min_created) {
+		return expired
+	}
+
+	other := ""
+
+	v, ok := item["type"]
+
+	if ok && v.S != nil {
+		other = *v.S
+	}
+
+	return fmt.Errorf("Confirmation %s has action '%s' rather than '%s', %w", code, other, action, ErrConfirmationAction)
+}
+
+// RemoveConfirmationsForAddress removes every confirmation for 'addr', found using the "address" index, with
+// BatchWriteItem requests of up to BATCH_WRITE_MAX_ITEMS items each.
+func (db *DynamoDBConfirmationsDatabase) RemoveConfirmationsForAddress(ctx context.Context, addr string) error {
+
+	ctx = withOperation(ctx, "RemoveConfirmationsForAddress")
+
+	confs, err := db.confirmationsWithAddress(ctx, addr)
+
+	if err != nil {
+		return err
+	}
+
+	table := db.options.FullTableName()
+
+	for start := 0; start < len(confs); start += BATCH_WRITE_MAX_ITEMS {
+
+		end := start + BATCH_WRITE_MAX_ITEMS
+
+		if end > len(confs) {
+			end = len(confs)
+		}
+
+		requests := make([]*aws_dynamodb.WriteRequest, 0)
+
+		for _, conf := range confs[start:end] {
+
+			requests = append(requests, &aws_dynamodb.WriteRequest{
+				DeleteRequest: &aws_dynamodb.DeleteRequest{
+					Key: map[string]*aws_dynamodb.AttributeValue{
+						db.options.keyAttribute(): {
+							S: aws.String(conf.Code),
+						},
+					},
+				},
+			})
+		}
+
+		err := batchWriteItems(ctx, db.client, map[string][]*aws_dynamodb.WriteRequest{table: requests})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// confirmationsWithAddress returns all the confirmations for 'addr', including expired ones, oldest first.
+func (db *DynamoDBConfirmationsDatabase) confirmationsWithAddress(ctx context.Context, addr string) ([]*confirmation.Confirmation, error) {
+
+	req := &aws_dynamodb.QueryInput{
+		TableName:              aws.String(db.options.FullTableName()),
+		IndexName:              aws.String("address"),
+		KeyConditionExpression: aws.String("#address = :address"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address": aws.String("address"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":address": {
+				S: aws.String(addr),
+			},
+		},
+	}
+
+	confs := make([]*confirmation.Confirmation, 0)
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return nil, err
+		}
+
+		rsp, err := db.client.QueryWithContext(ctx, req)
+
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		for _, item := range rsp.Items {
+
+			conf, err := itemToConfirmation(db.options, item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			confs = append(confs, conf)
+		}
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	sort.Slice(confs, func(i, j int) bool {
+		return confs[i].Created < confs[j].Created
+	})
+
+	return confs, nil
+}
+
+func (db *DynamoDBConfirmationsDatabase) ListConfirmations(ctx context.Context, callback database.ListConfirmationsFunc) error {
+
+	ctx = withOperation(ctx, "ListConfirmations")
+
+	req := &aws_dynamodb.ScanInput{
+		TableName: aws.String(db.options.FullTableName()),
+	}
+
+	return scanConfirmations(ctx, db.client, db.options, req, callback)
+}
+
+// confirmationToItem returns the DynamoDB item for 'conf', with its code stored in the KeyAttribute option and its
+// expiry time in the ExpiresAttribute option, if set.
+func confirmationToItem(opts *DynamoDBConfirmationsDatabaseOptions, conf *confirmation.Confirmation) (map[string]*aws_dynamodb.AttributeValue, error) {
+
+	item, err := aws_dynamodbattribute.MarshalMap(conf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := opts.keyAttribute()
+
+	if key != CONFIRMATIONS_DEFAULT_KEY_ATTRIBUTE {
+		item[key] = item[CONFIRMATIONS_DEFAULT_KEY_ATTRIBUTE]
+		delete(item, CONFIRMATIONS_DEFAULT_KEY_ATTRIBUTE)
+	}
+
+	if opts.ExpiresAttribute != "" {
+
+		item[opts.ExpiresAttribute] = &aws_dynamodb.AttributeValue{
+			N: aws.String(strconv.FormatInt(opts.expires(conf).Unix(), 10)),
+		}
+	}
+
+	return item, nil
+}
+
+func itemToConfirmation(opts *DynamoDBConfirmationsDatabaseOptions, item map[string]*aws_dynamodb.AttributeValue) (*confirmation.Confirmation, error) {
+
+	key := opts.keyAttribute()
+
+	if key != CONFIRMATIONS_DEFAULT_KEY_ATTRIBUTE {
+
+		v, ok := item[key]
+
+		if ok {
+
+			renamed := make(map[string]*aws_dynamodb.AttributeValue, len(item))
+
+			for k, v := range item {
+
+				if k != key {
+					renamed[k] = v
+				}
+			}
+
+			renamed[CONFIRMATIONS_DEFAULT_KEY_ATTRIBUTE] = v
+			item = renamed
+		}
+	}
+
 	var conf *confirmation.Confirmation
 
-	err = aws_dynamodbattribute.UnmarshalMap(rsp.Item, &conf)
+	err := aws_dynamodbattribute.UnmarshalMap(item, &conf)
 
 	if err != nil {
 		return nil, err
@@ -143,6 +821,90 @@ func (db *DynamoDBConfirmationsDatabase) GetConfirmationWithCode(code string) (*
 	return conf, nil
 }
 
-func (db *DynamoDBConfirmationsDatabase) ListConfirmations(ctx context.Context, callback database.ListConfirmationsFunc) error {
-	return errors.New("Please write me")
+func scanConfirmations(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBConfirmationsDatabaseOptions, req *aws_dynamodb.ScanInput, callback database.ListConfirmationsFunc) error {
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return err
+		}
+
+		rsp, err := client.ScanWithContext(ctx, req)
+
+		if err != nil {
+			return wrapError(err)
+		}
+
+		for _, item := range rsp.Items {
+
+			err := ctx.Err()
+
+			if err != nil {
+				return err
+			}
+
+			conf, err := itemToConfirmation(opts, item)
+
+			if err != nil {
+				return err
+			}
+
+			err = callback(conf)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+func putConfirmationIfNotExists(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBConfirmationsDatabaseOptions, conf *confirmation.Confirmation) error {
+
+	err := validateConfirmation(conf)
+
+	if err != nil {
+		return err
+	}
+
+	item, err := confirmationToItem(opts, conf)
+
+	if err != nil {
+		return err
+	}
+
+	req := &aws_dynamodb.PutItemInput{
+		Item:                item,
+		TableName:           aws.String(opts.FullTableName()),
+		ConditionExpression: aws.String("attribute_not_exists(#code)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#code": aws.String(opts.keyAttribute()),
+		},
+	}
+
+	_, err = client.PutItemWithContext(ctx, req)
+
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return nil
+}
+
+func (db *DynamoDBConfirmationsDatabase) newCode() (string, error) {
+
+	if db.options.CodeGenerator != nil {
+		return db.options.CodeGenerator()
+	}
+
+	return DefaultCodeGenerator()
 }
@@ -0,0 +1,99 @@
+package dynamodb
+
+import (
+	"errors"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"testing"
+	"time"
+)
+
+func TestConsumeConditionError(t *testing.T) {
+
+	item := func(created string) map[string]*aws_dynamodb.AttributeValue {
+
+		return map[string]*aws_dynamodb.AttributeValue{
+			"code":    {S: aws.String("abc")},
+			"type":    {S: aws.String("unsubscribe")},
+			"created": {N: aws.String(created)},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		action  string
+		created string
+		expired bool
+	}{
+		{name: "expired", created: "100", expired: true},
+		{name: "expired for action", action: "subscribe", created: "100", expired: true},
+		{name: "other action", action: "subscribe", created: "2000"},
+	}
+
+	for _, test := range tests {
+
+		err := consumeConditionError("abc", test.action, 1000, item(test.created))
+
+		var expired_err *ConfirmationExpiredError
+
+		if errors.As(err, &expired_err) != test.expired {
+			t.Fatalf("Expected %s error to be a ConfirmationExpiredError (%t), got %v", test.name, test.expired, err)
+		}
+
+		if test.expired && (expired_err.Created != 100 || !IsNotExist(err)) {
+			t.Fatalf("Unexpected %s error %v", test.name, err)
+		}
+
+		if !test.expired && (!errors.Is(err, ErrConfirmationAction) || IsNotExist(err)) {
+			t.Fatalf("Expected %s error to wrap ErrConfirmationAction, got %v", test.name, err)
+		}
+	}
+}
+
+func TestConfirmationExpiryBoundary(t *testing.T) {
+
+	opts := DefaultDynamoDBConfirmationsDatabaseOptions()
+	opts.MaxAge = time.Hour
+
+	db := &DynamoDBConfirmationsDatabase{
+		options: opts,
+	}
+
+	conf := &confirmation.Confirmation{
+		Code:    "abc",
+		Created: 1000000,
+	}
+
+	expires := db.ConfirmationExpires(conf)
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		expired bool
+	}{
+		{name: "before expiry", now: expires.Add(-time.Second)},
+		{name: "at expiry", now: expires},
+		{name: "after expiry", now: expires.Add(time.Second), expired: true},
+	}
+
+	for _, test := range tests {
+
+		min_created := opts.minCreated(test.now)
+
+		if isExpired(conf.Created, min_created) != test.expired {
+			t.Fatalf("Expected confirmation %s to be expired (%t)", test.name, test.expired)
+		}
+
+		err := consumeConditionError(conf.Code, "subscribe", min_created, map[string]*aws_dynamodb.AttributeValue{
+			"created": {N: aws.String("1000000")},
+			"type":    {S: aws.String("unsubscribe")},
+		})
+
+		var expired_err *ConfirmationExpiredError
+
+		if errors.As(err, &expired_err) != test.expired {
+			t.Fatalf("Expected condition error %s to be a ConfirmationExpiredError (%t), got %v", test.name, test.expired, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/database"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"strconv"
+)
+
+// ErrConflict is returned (wrapped, by a `ConflictError`) when a subscription is updated with
+// `UpdateSubscriptionIfUnchanged` but has been changed since it was read.
+var ErrConflict = errors.New("Record has been changed")
+
+// ConflictError describes an update rejected by `UpdateSubscriptionIfUnchanged` because the subscription had been
+// changed by someone else. It wraps ErrConflict.
+type ConflictError struct {
+	// Address is the address of the subscription.
+	Address string
+	// Expected is the lastmodified time the subscription was expected to have.
+	Expected int64
+	// LastModified is the subscription's current lastmodified time.
+	LastModified int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("Subscription for %s was modified at %d, expected %d", e.Address, e.LastModified, e.Expected)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrConflict
+}
+
+// UpdateSubscriptionIfUnchanged writes 'sub', like `UpdateSubscription`, but only if the stored subscription's
+// lastmodified time is still 'expected', typically the LastModified property of the subscription when it was
+// read, for example to populate an edit form. Otherwise the subscription is not changed and a `ConflictError`
+// is returned. It returns a `database.NoRecordError` if there is no subscription for the address of 'sub'.
+func (db *DynamoDBSubscriptionsDatabase) UpdateSubscriptionIfUnchanged(ctx context.Context, sub *subscription.Subscription, expected int64) error {
+
+	ctx = withOperation(ctx, "UpdateSubscriptionIfUnchanged")
+
+	err := updateSubscription(ctx, db.client, db.options, sub, &expected)
+
+	if err != nil {
+		return err
+	}
+
+	return recordChange(ctx, db.options, HISTORY_CHANGE_UPDATED, sub)
+}
+
+// conflictError returns the error for an update of the subscription with 'key' (for 'addr') conditional on its
+// lastmodified time being 'expected' whose condition failed: a `database.NoRecordError` if there is no subscription,
+// a `ConflictError` if its lastmodified time is not 'expected' or nil if the condition failed for another reason.
+func conflictError(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSubscriptionsDatabaseOptions, addr string, key map[string]*aws_dynamodb.AttributeValue, expected int64) error {
+
+	req := &aws_dynamodb.GetItemInput{
+		TableName:            aws.String(opts.FullTableName()),
+		Key:                  key,
+		ConsistentRead:       aws.Bool(true),
+		ProjectionExpression: aws.String("#lastmodified"),
+		ExpressionAttributeNames: map[string]*string{
+			"#lastmodified": aws.String("lastmodified"),
+		},
+	}
+
+	rsp, err := client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return wrapError(err)
+	}
+
+	if rsp.Item == nil {
+		return new(database.NoRecordError)
+	}
+
+	lastmodified := int64(0)
+
+	v, ok := rsp.Item["lastmodified"]
+
+	if ok && v.N != nil {
+
+		lastmodified, err = strconv.ParseInt(*v.N, 10, 64)
+
+		if err != nil {
+			return fmt.Errorf("Failed to parse lastmodified time for %s, %w", addr, err)
+		}
+	}
+
+	if lastmodified == expected {
+		return nil
+	}
+
+	return &ConflictError{
+		Address:      addr,
+		Expected:     expected,
+		LastModified: lastmodified,
+	}
+}
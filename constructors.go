@@ -0,0 +1,439 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"net/http"
+)
+
+// Option configures a database created by one of the functional options constructors, for example
+// `NewSubscriptionsDatabase`. The same options may be passed to every constructor.
+type Option func(*constructorConfig) error
+
+// tableOptions is implemented by every database options struct.
+type tableOptions interface {
+	settings() *tableSettings
+}
+
+// constructorConfig is the configuration accumulated by a list of `Option` functions.
+type constructorConfig struct {
+	dsn      string
+	session  *aws_session.Session
+	client   aws_dynamodbiface.DynamoDBAPI
+	settings []func(*tableSettings)
+	// custom are the database-specific option functions, for example func(*DynamoDBSubscriptionsDatabaseOptions),
+	// added by options like `WithSubscriptionsOptions`. Each constructor applies those matching its own options type.
+	custom []interface{}
+}
+
+func newConstructorConfig(ctx context.Context, options []Option) (*constructorConfig, error) {
+
+	err := ctx.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &constructorConfig{}
+
+	for _, o := range options {
+
+		err := o(cfg)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	count := 0
+
+	if cfg.dsn != "" {
+		count += 1
+	}
+
+	if cfg.session != nil {
+		count += 1
+	}
+
+	if cfg.client != nil {
+		count += 1
+	}
+
+	if count == 0 {
+		return nil, errors.New("Missing WithDSN, WithSession or WithClient option")
+	}
+
+	if count > 1 {
+		return nil, errors.New("Only one of the WithDSN, WithSession or WithClient options may be used")
+	}
+
+	return cfg, nil
+}
+
+func (cfg *constructorConfig) apply(s *tableSettings) {
+
+	for _, fn := range cfg.settings {
+		fn(s)
+	}
+}
+
+func (cfg *constructorConfig) setting(fn func(*tableSettings)) {
+	cfg.settings = append(cfg.settings, fn)
+}
+
+// WithDSN connects to DynamoDB using a session created from 'dsn'. Table names assigned in the DSN take
+// precedence over WithTable.
+func WithDSN(dsn string) Option {
+
+	return func(cfg *constructorConfig) error {
+
+		if dsn == "" {
+			return errors.New("Empty DSN")
+		}
+
+		cfg.dsn = dsn
+		return nil
+	}
+}
+
+// WithSession connects to DynamoDB using 'sess'.
+func WithSession(sess *aws_session.Session) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.session = sess
+		return nil
+	}
+}
+
+// WithClient uses 'client' to talk to DynamoDB, for example a mock or an instrumented client. WithConsumedCapacityFunc,
+// WithCapacityLimiter, WithRetry, WithRegion and WithEndpoint have no effect with this option.
+func WithClient(client aws_dynamodbiface.DynamoDBAPI) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.client = client
+		return nil
+	}
+}
+
+// WithTable assigns the name of the table. Since it applies to every constructor it should only be passed to one.
+func WithTable(name string) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.TableName = name })
+		return nil
+	}
+}
+
+// WithTablePrefix assigns a string to prepend to the name of the table, for example "prod_".
+func WithTablePrefix(prefix string) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.TablePrefix = prefix })
+		return nil
+	}
+}
+
+// WithTableSuffix assigns a string to append to the name of the table, for example "_staging".
+func WithTableSuffix(suffix string) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.TableSuffix = suffix })
+		return nil
+	}
+}
+
+// WithBillingMode assigns the billing mode (PAY_PER_REQUEST or PROVISIONED) used when the table is created.
+func WithBillingMode(mode string) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.BillingMode = mode })
+		return nil
+	}
+}
+
+// WithCreateTable creates the table, if it does not already exist.
+func WithCreateTable() Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.CreateTable = true })
+		return nil
+	}
+}
+
+// WithDeletionProtection enables deletion protection when the table is created.
+func WithDeletionProtection() Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.DeletionProtection = true })
+		return nil
+	}
+}
+
+// WithTableClass assigns the table class (STANDARD or STANDARD_INFREQUENT_ACCESS) used when the table is created.
+func WithTableClass(class string) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.TableClass = class })
+		return nil
+	}
+}
+
+// WithContributorInsights enables CloudWatch Contributor Insights when the table is created.
+func WithContributorInsights() Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.ContributorInsights = true })
+		return nil
+	}
+}
+
+// WithConsumedCapacityFunc invokes 'cb' with the capacity consumed by each request, at the 'mode' (TOTAL or
+// INDEXES) level of detail. If 'mode' is empty TOTAL is used.
+func WithConsumedCapacityFunc(mode string, cb ConsumedCapacityFunc) Option {
+
+	return func(cfg *constructorConfig) error {
+
+		cfg.setting(func(s *tableSettings) {
+			*s.ReturnConsumedCapacity = mode
+			*s.ConsumedCapacityFunc = cb
+		})
+
+		return nil
+	}
+}
+
+// WithCapacityLimiter caps the read and write capacity consumed per second with 'l'. See `CapacityLimiter`.
+func WithCapacityLimiter(l *CapacityLimiter) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.CapacityLimiter = l })
+		return nil
+	}
+}
+
+// WithMiddleware appends 'middleware' to the chain of `Middleware` invoked around each request.
+func WithMiddleware(middleware ...Middleware) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.Middleware = append(*s.Middleware, middleware...) })
+		return nil
+	}
+}
+
+// WithReadOnly rejects every request which would write to the table with ErrReadOnly. See the ReadOnly option.
+func WithReadOnly() Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.ReadOnly = true })
+		return nil
+	}
+}
+
+// WithHTTPClient uses 'client' in place of the session's default HTTP client. See `NewHTTPClient`.
+func WithHTTPClient(client *http.Client) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.HTTPClient = client })
+		return nil
+	}
+}
+
+// WithRetry retries failed requests using 'opts' in place of the AWS SDK's default retryer. See `RetryOptions`.
+func WithRetry(opts *RetryOptions) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.Retry = opts })
+		return nil
+	}
+}
+
+// WithRegion uses 'region' in place of the session's region. Since it applies to every constructor it should only be
+// passed to one. To assign the region of a single database in a shared list of options set the Region option with
+// its With...Options function instead.
+func WithRegion(region string) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.Region = region })
+		return nil
+	}
+}
+
+// WithEndpoint uses the DynamoDB endpoint 'endpoint', for example "http://localhost:8000" for DynamoDB Local, in place
+// of the session's endpoint. Since it applies to every constructor it should only be passed to one. To assign the
+// endpoint of a single database in a shared list of options set the Endpoint option with its With...Options
+// function instead.
+func WithEndpoint(endpoint string) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.Endpoint = endpoint })
+		return nil
+	}
+}
+
+// WithFIPSEndpoint selects the FIPS 140-2 validated DynamoDB endpoint for the session's region.
+func WithFIPSEndpoint() Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.UseFIPSEndpoint = true })
+		return nil
+	}
+}
+
+// WithDualStackEndpoint selects the dual-stack (IPv4 and IPv6) DynamoDB endpoint for the session's region.
+func WithDualStackEndpoint() Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.setting(func(s *tableSettings) { *s.UseDualStackEndpoint = true })
+		return nil
+	}
+}
+
+func withCustom(fn interface{}) Option {
+
+	return func(cfg *constructorConfig) error {
+		cfg.custom = append(cfg.custom, fn)
+		return nil
+	}
+}
+
+// WithSubscriptionsOptions invokes 'fn' with the options of a subscriptions database, after every other option has
+// been applied, to assign settings which are specific to it. It is ignored by the other constructors.
+func WithSubscriptionsOptions(fn func(*DynamoDBSubscriptionsDatabaseOptions)) Option {
+	return withCustom(fn)
+}
+
+// WithConfirmationsOptions invokes 'fn' with the options of a confirmations database, after every other option has
+// been applied, to assign settings which are specific to it. It is ignored by the other constructors.
+func WithConfirmationsOptions(fn func(*DynamoDBConfirmationsDatabaseOptions)) Option {
+	return withCustom(fn)
+}
+
+// WithEventLogsOptions invokes 'fn' with the options of an event logs database, after every other option has been
+// applied, to assign settings which are specific to it. It is ignored by the other constructors.
+func WithEventLogsOptions(fn func(*DynamoDBEventLogsDatabaseOptions)) Option {
+	return withCustom(fn)
+}
+
+// WithDeliveriesOptions invokes 'fn' with the options of a deliveries database, after every other option has been
+// applied, to assign settings which are specific to it. It is ignored by the other constructors.
+func WithDeliveriesOptions(fn func(*DynamoDBDeliveriesDatabaseOptions)) Option {
+	return withCustom(fn)
+}
+
+// WithUnsubscribeTokensOptions invokes 'fn' with the options of an unsubscribe tokens database, after every other
+// option has been applied, to assign settings which are specific to it. It is ignored by the other constructors.
+func WithUnsubscribeTokensOptions(fn func(*DynamoDBUnsubscribeTokensDatabaseOptions)) Option {
+	return withCustom(fn)
+}
+
+// WithSendQueueOptions invokes 'fn' with the options of a send queue, after every other option has been applied,
+// to assign settings which are specific to it. It is ignored by the other constructors.
+func WithSendQueueOptions(fn func(*DynamoDBSendQueueOptions)) Option {
+	return withCustom(fn)
+}
+
+// WithDeadLettersOptions invokes 'fn' with the options of a dead letters database, after every other option has
+// been applied, to assign settings which are specific to it. It is ignored by the other constructors.
+func WithDeadLettersOptions(fn func(*DynamoDBDeadLettersDatabaseOptions)) Option {
+	return withCustom(fn)
+}
+
+// WithHistoryOptions invokes 'fn' with the options of a history database, after every other option has been
+// applied, to assign settings which are specific to it. It is ignored by the other constructors.
+func WithHistoryOptions(fn func(*DynamoDBHistoryDatabaseOptions)) Option {
+	return withCustom(fn)
+}
+
+// WithStatsOptions invokes 'fn' with the options of a stats database, after every other option has been
+// applied, to assign settings which are specific to it. It is ignored by the other constructors.
+func WithStatsOptions(fn func(*DynamoDBStatsDatabaseOptions)) Option {
+	return withCustom(fn)
+}
+
+// NewSubscriptionsDatabase returns a new `DynamoDBSubscriptionsDatabase` configured by 'options', starting from
+// `DefaultDynamoDBSubscriptionsDatabaseOptions`. One of WithDSN, WithSession or WithClient is required.
+func NewSubscriptionsDatabase(ctx context.Context, options ...Option) (*DynamoDBSubscriptionsDatabase, error) {
+	return newDatabase(ctx, options, DefaultDynamoDBSubscriptionsDatabaseOptions(), NewSubscriptionsDatabaseWithClient, NewSubscriptionsDatabaseWithSession, NewSubscriptionsDatabaseWithDSN)
+}
+
+// NewConfirmationsDatabase returns a new `DynamoDBConfirmationsDatabase` configured by 'options', starting from
+// `DefaultDynamoDBConfirmationsDatabaseOptions`. One of WithDSN, WithSession or WithClient is required.
+func NewConfirmationsDatabase(ctx context.Context, options ...Option) (*DynamoDBConfirmationsDatabase, error) {
+	return newDatabase(ctx, options, DefaultDynamoDBConfirmationsDatabaseOptions(), NewConfirmationsDatabaseWithClient, NewConfirmationsDatabaseWithSession, NewConfirmationsDatabaseWithDSN)
+}
+
+// NewEventLogsDatabase returns a new `DynamoDBEventLogsDatabase` configured by 'options', starting from
+// `DefaultDynamoDBEventLogsDatabaseOptions`. One of WithDSN, WithSession or WithClient is required.
+func NewEventLogsDatabase(ctx context.Context, options ...Option) (*DynamoDBEventLogsDatabase, error) {
+	return newDatabase(ctx, options, DefaultDynamoDBEventLogsDatabaseOptions(), NewEventLogsDatabaseWithClient, NewEventLogsDatabaseWithSession, NewEventLogsDatabaseWithDSN)
+}
+
+// NewDeliveriesDatabase returns a new `DynamoDBDeliveriesDatabase` configured by 'options', starting from
+// `DefaultDynamoDBDeliveriesDatabaseOptions`. One of WithDSN, WithSession or WithClient is required.
+func NewDeliveriesDatabase(ctx context.Context, options ...Option) (*DynamoDBDeliveriesDatabase, error) {
+	return newDatabase(ctx, options, DefaultDynamoDBDeliveriesDatabaseOptions(), NewDeliveriesDatabaseWithClient, NewDeliveriesDatabaseWithSession, NewDeliveriesDatabaseWithDSN)
+}
+
+// NewUnsubscribeTokensDatabase returns a new `DynamoDBUnsubscribeTokensDatabase` configured by 'options', starting
+// from `DefaultDynamoDBUnsubscribeTokensDatabaseOptions`. One of WithDSN, WithSession or WithClient is required.
+func NewUnsubscribeTokensDatabase(ctx context.Context, options ...Option) (*DynamoDBUnsubscribeTokensDatabase, error) {
+	return newDatabase(ctx, options, DefaultDynamoDBUnsubscribeTokensDatabaseOptions(), NewDynamoDBUnsubscribeTokensDatabaseWithClient, NewDynamoDBUnsubscribeTokensDatabaseWithSession, NewDynamoDBUnsubscribeTokensDatabaseWithDSN)
+}
+
+// NewSendQueue returns a new `DynamoDBSendQueue` configured by 'options', starting from
+// `DefaultDynamoDBSendQueueOptions`. One of WithDSN, WithSession or WithClient is required.
+func NewSendQueue(ctx context.Context, options ...Option) (*DynamoDBSendQueue, error) {
+	return newDatabase(ctx, options, DefaultDynamoDBSendQueueOptions(), NewDynamoDBSendQueueWithClient, NewDynamoDBSendQueueWithSession, NewDynamoDBSendQueueWithDSN)
+}
+
+// NewDeadLettersDatabase returns a new `DynamoDBDeadLettersDatabase` configured by 'options', starting from
+// `DefaultDynamoDBDeadLettersDatabaseOptions`. One of WithDSN, WithSession or WithClient is required.
+func NewDeadLettersDatabase(ctx context.Context, options ...Option) (*DynamoDBDeadLettersDatabase, error) {
+	return newDatabase(ctx, options, DefaultDynamoDBDeadLettersDatabaseOptions(), NewDynamoDBDeadLettersDatabaseWithClient, NewDynamoDBDeadLettersDatabaseWithSession, NewDynamoDBDeadLettersDatabaseWithDSN)
+}
+
+// NewHistoryDatabase returns a new `DynamoDBHistoryDatabase` configured by 'options', starting from
+// `DefaultDynamoDBHistoryDatabaseOptions`. One of WithDSN, WithSession or WithClient is required.
+func NewHistoryDatabase(ctx context.Context, options ...Option) (*DynamoDBHistoryDatabase, error) {
+	return newDatabase(ctx, options, DefaultDynamoDBHistoryDatabaseOptions(), NewDynamoDBHistoryDatabaseWithClient, NewDynamoDBHistoryDatabaseWithSession, NewDynamoDBHistoryDatabaseWithDSN)
+}
+
+// NewStatsDatabase returns a new `DynamoDBStatsDatabase` configured by 'options', starting from
+// `DefaultDynamoDBStatsDatabaseOptions`. One of WithDSN, WithSession or WithClient is required.
+func NewStatsDatabase(ctx context.Context, options ...Option) (*DynamoDBStatsDatabase, error) {
+	return newDatabase(ctx, options, DefaultDynamoDBStatsDatabaseOptions(), NewDynamoDBStatsDatabaseWithClient, NewDynamoDBStatsDatabaseWithSession, NewDynamoDBStatsDatabaseWithDSN)
+}
+
+// newDatabase returns a new database, created by whichever of 'with_client', 'with_session' or 'with_dsn' matches
+// the WithClient, WithSession or WithDSN option in 'options', configured by 'opts' once 'options' have been applied.
+func newDatabase[O tableOptions, D any](ctx context.Context, options []Option, opts O, with_client func(aws_dynamodbiface.DynamoDBAPI, O) (D, error), with_session func(*aws_session.Session, O) (D, error), with_dsn func(string, O) (D, error)) (D, error) {
+
+	cfg, err := newConstructorConfig(ctx, options)
+
+	if err != nil {
+		var db D
+		return db, err
+	}
+
+	cfg.apply(opts.settings())
+
+	for _, c := range cfg.custom {
+
+		fn, ok := c.(func(O))
+
+		if ok {
+			fn(opts)
+		}
+	}
+
+	switch {
+	case cfg.client != nil:
+		return with_client(cfg.client, opts)
+	case cfg.session != nil:
+		return with_session(cfg.session, opts)
+	default:
+		return with_dsn(cfg.dsn, opts)
+	}
+}
@@ -0,0 +1,46 @@
+package dynamodb
+
+import (
+	"testing"
+)
+
+func TestNewDatabaseWithClientError(t *testing.T) {
+
+	// invalid options are rejected before the client is used so no client is necessary
+
+	subs_opts := DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TableName = ""
+
+	subs_db, err := NewDynamoDBSubscriptionsDatabaseWithClient(nil, subs_opts)
+
+	if err == nil || subs_db != nil {
+		t.Fatalf("Expected a nil subscriptions database and an error, got %v, %v", subs_db, err)
+	}
+
+	conf_opts := DefaultDynamoDBConfirmationsDatabaseOptions()
+	conf_opts.TableName = ""
+
+	conf_db, err := NewDynamoDBConfirmationsDatabaseWithClient(nil, conf_opts)
+
+	if err == nil || conf_db != nil {
+		t.Fatalf("Expected a nil confirmations database and an error, got %v, %v", conf_db, err)
+	}
+
+	logs_opts := DefaultDynamoDBEventLogsDatabaseOptions()
+	logs_opts.TableName = ""
+
+	logs_db, err := NewDynamoDBEventLogsDatabaseWithClient(nil, logs_opts)
+
+	if err == nil || logs_db != nil {
+		t.Fatalf("Expected a nil event logs database and an error, got %v, %v", logs_db, err)
+	}
+
+	dlvr_opts := DefaultDynamoDBDeliveriesDatabaseOptions()
+	dlvr_opts.TableName = ""
+
+	dlvr_db, err := NewDynamoDBDeliveriesDatabaseWithClient(nil, dlvr_opts)
+
+	if err == nil || dlvr_db != nil {
+		t.Fatalf("Expected a nil deliveries database and an error, got %v, %v", dlvr_db, err)
+	}
+}
@@ -0,0 +1,236 @@
+package dynamodb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strconv"
+	"strings"
+)
+
+// continuationValue is the JSON encoding of a key attribute in a continuation token. Keys may only be strings,
+// numbers or binary values.
+type continuationValue struct {
+	S *string `json:"S,omitempty"`
+	N *string `json:"N,omitempty"`
+	B []byte  `json:"B,omitempty"`
+}
+
+// continuationKeyTypes are the types of the attributes which may make up the key of a continuation token.
+var continuationKeyTypes = map[string]string{
+	"address": aws_dynamodb.ScalarAttributeTypeS,
+	"status":  aws_dynamodb.ScalarAttributeTypeN,
+	"created": aws_dynamodb.ScalarAttributeTypeN,
+}
+
+// Token returns a continuation token for the iterator's position: the key of the current subscription, encoded as
+// an opaque string. Assigning it to the StartToken option of a new iterator, with the same options, resumes iterating
+// with the subscription after the current one, so that long-running jobs can checkpoint their progress and resume
+// after an interruption rather than starting again. If `Next` has not returned a subscription the iterator's own
+// StartToken, if any, is returned and otherwise an empty string.
+func (it *SubscriptionsIterator) Token() (string, error) {
+
+	key := it.current_key
+
+	if key == nil {
+		key = it.start_key
+	}
+
+	if key == nil {
+		return "", nil
+	}
+
+	return encodeContinuationToken(key)
+}
+
+// resume assigns the key encoded in 'token' as the exclusive start key of the iterator's request.
+func (it *SubscriptionsIterator) resume(token string) {
+
+	if token == "" || it.err != nil {
+		return
+	}
+
+	key, err := decodeContinuationToken(token)
+
+	if err == nil {
+		err = it.validateKey(key)
+	}
+
+	if err != nil {
+		it.err = optionsError("subscriptions", "StartToken", token, err.Error())
+		return
+	}
+
+	it.start_key = key
+
+	if it.query != nil {
+		it.query.ExclusiveStartKey = key
+		return
+	}
+
+	it.req.ExclusiveStartKey = key
+}
+
+// itemKey returns a copy of the attributes of 'item' which make up its key in the table, or index, being read.
+// It copies them before the item is restored, since restoring an item changes its address.
+func (it *SubscriptionsIterator) itemKey(item map[string]*aws_dynamodb.AttributeValue) map[string]*aws_dynamodb.AttributeValue {
+
+	key := make(map[string]*aws_dynamodb.AttributeValue)
+
+	for _, a := range it.keyAttributes() {
+
+		v, ok := item[a]
+
+		if !ok {
+			continue
+		}
+
+		key[a] = &aws_dynamodb.AttributeValue{
+			S: v.S,
+			N: v.N,
+			B: v.B,
+		}
+	}
+
+	return key
+}
+
+// keyAttributes returns the names of the attributes which make up the key of the table, or index, being read.
+func (it *SubscriptionsIterator) keyAttributes() []string {
+
+	if len(it.key_attrs) == 0 {
+		return []string{"address"}
+	}
+
+	return it.key_attrs
+}
+
+// validateKey returns an error if 'key', decoded from a continuation token, is not a key of the table or index being
+// read: it must have exactly the iterator's key attributes, each with a single value of that attribute's type, and
+// an address belonging to the Tenant option, if set. Tokens are not signed so this rejects tokens which have been
+// edited, or which belong to another listing, before they are sent to DynamoDB.
+func (it *SubscriptionsIterator) validateKey(key map[string]*aws_dynamodb.AttributeValue) error {
+
+	attrs := it.keyAttributes()
+
+	if len(key) != len(attrs) {
+		return fmt.Errorf("Invalid continuation token, expected key attributes %s", strings.Join(attrs, ", "))
+	}
+
+	for _, a := range attrs {
+
+		v, ok := key[a]
+
+		if !ok {
+			return fmt.Errorf("Invalid continuation token, missing %s", a)
+		}
+
+		count := 0
+
+		if v.S != nil {
+			count += 1
+		}
+
+		if v.N != nil {
+			count += 1
+		}
+
+		if v.B != nil {
+			count += 1
+		}
+
+		if count != 1 {
+			return fmt.Errorf("Invalid continuation token, expected a single value for %s", a)
+		}
+
+		switch continuationKeyTypes[a] {
+		case aws_dynamodb.ScalarAttributeTypeS:
+
+			if v.S == nil {
+				return fmt.Errorf("Invalid continuation token, expected a string for %s", a)
+			}
+
+		case aws_dynamodb.ScalarAttributeTypeN:
+
+			if v.N == nil {
+				return fmt.Errorf("Invalid continuation token, expected a number for %s", a)
+			}
+
+			_, err := strconv.ParseInt(*v.N, 10, 64)
+
+			if err != nil {
+				return fmt.Errorf("Invalid continuation token, expected a number for %s", a)
+			}
+		}
+	}
+
+	tenant := it.options.Tenant
+
+	if tenant != "" && !strings.HasPrefix(*key["address"].S, tenant+TENANT_SEPARATOR) {
+		return errors.New("Invalid continuation token, address does not belong to tenant")
+	}
+
+	return nil
+}
+
+func encodeContinuationToken(key map[string]*aws_dynamodb.AttributeValue) (string, error) {
+
+	values := make(map[string]continuationValue)
+
+	for k, v := range key {
+
+		values[k] = continuationValue{
+			S: v.S,
+			N: v.N,
+			B: v.B,
+		}
+	}
+
+	enc, err := json.Marshal(values)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode continuation token, %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(enc), nil
+}
+
+func decodeContinuationToken(token string) (map[string]*aws_dynamodb.AttributeValue, error) {
+
+	enc, err := base64.RawURLEncoding.DecodeString(token)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid continuation token, %w", err)
+	}
+
+	var values map[string]continuationValue
+
+	err = json.Unmarshal(enc, &values)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid continuation token, %w", err)
+	}
+
+	if len(values) == 0 {
+		return nil, errors.New("Invalid continuation token, no key attributes")
+	}
+
+	key := make(map[string]*aws_dynamodb.AttributeValue)
+
+	for k, v := range values {
+
+		if v.S == nil && v.N == nil && v.B == nil {
+			return nil, fmt.Errorf("Invalid continuation token, no value for %s", k)
+		}
+
+		key[k] = &aws_dynamodb.AttributeValue{
+			S: v.S,
+			N: v.N,
+			B: v.B,
+		}
+	}
+
+	return key, nil
+}
@@ -0,0 +1,161 @@
+package dynamodb
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"reflect"
+	"testing"
+)
+
+func TestContinuationTokenRoundTrip(t *testing.T) {
+
+	keys := []map[string]*aws_dynamodb.AttributeValue{
+		{
+			"address": {S: aws.String("test@example.com")},
+		},
+		{
+			"address": {S: aws.String("test@example.com")},
+			"status":  {N: aws.String("1")},
+			"created": {N: aws.String("1700000000")},
+		},
+		{
+			"address": {B: []byte{0x00, 0xff, 0x10}},
+		},
+	}
+
+	for _, key := range keys {
+
+		token, err := encodeContinuationToken(key)
+
+		if err != nil {
+			t.Fatalf("Failed to encode continuation token, %v", err)
+		}
+
+		decoded, err := decodeContinuationToken(token)
+
+		if err != nil {
+			t.Fatalf("Failed to decode continuation token %s, %v", token, err)
+		}
+
+		if !reflect.DeepEqual(decoded, key) {
+			t.Fatalf("Expected continuation token to decode to %v, got %v", key, decoded)
+		}
+	}
+}
+
+func TestContinuationTokenIterator(t *testing.T) {
+
+	ctx := context.Background()
+
+	db := &DynamoDBSubscriptionsDatabase{
+		options: DefaultDynamoDBSubscriptionsDatabaseOptions(),
+	}
+
+	key := map[string]*aws_dynamodb.AttributeValue{
+		"address": {S: aws.String("test@example.com")},
+		"status":  {N: aws.String("1")},
+	}
+
+	token, err := encodeContinuationToken(key)
+
+	if err != nil {
+		t.Fatalf("Failed to encode continuation token, %v", err)
+	}
+
+	it := db.SubscriptionsInSegment(ctx, &Segment{Status: STATUS_ACTIVE, StartToken: token})
+
+	if it.err != nil {
+		t.Fatalf("Failed to resume from continuation token, %v", it.err)
+	}
+
+	if !reflect.DeepEqual(it.query.ExclusiveStartKey, key) {
+		t.Fatalf("Expected exclusive start key %v, got %v", key, it.query.ExclusiveStartKey)
+	}
+
+	// an iterator which has not returned a subscription returns the token it was started with
+
+	resumed, err := it.Token()
+
+	if err != nil || resumed != token {
+		t.Fatalf("Expected token %s, got %s (%v)", token, resumed, err)
+	}
+}
+
+func TestContinuationTokenTampered(t *testing.T) {
+
+	ctx := context.Background()
+
+	encode := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+
+	tests := []struct {
+		name   string
+		tenant string
+		token  string
+	}{
+		{name: "not base64", token: "not a token!"},
+		{name: "not json", token: encode(`address=test@example.com`)},
+		{name: "truncated", token: encode(`{"address":{"S":"test@example.com"}`)},
+		{name: "empty", token: encode(`{}`)},
+		{name: "no value", token: encode(`{"address":{}}`)},
+		{name: "missing attribute", token: encode(`{"address":{"S":"test@example.com"}}`)},
+		{name: "extra attribute", token: encode(`{"address":{"S":"test@example.com"},"status":{"N":"1"},"secret":{"S":"x"}}`)},
+		{name: "renamed attribute", token: encode(`{"address":{"S":"test@example.com"},"state":{"N":"1"}}`)},
+		{name: "wrong type", token: encode(`{"address":{"N":"1"},"status":{"N":"1"}}`)},
+		{name: "several values", token: encode(`{"address":{"S":"test@example.com","N":"1"},"status":{"N":"1"}}`)},
+		{name: "not a number", token: encode(`{"address":{"S":"test@example.com"},"status":{"N":"one"}}`)},
+		{name: "other tenant", tenant: "acme", token: encode(`{"address":{"S":"other#test@example.com"},"status":{"N":"1"}}`)},
+		{name: "no tenant", tenant: "acme", token: encode(`{"address":{"S":"test@example.com"},"status":{"N":"1"}}`)},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			opts := DefaultDynamoDBSubscriptionsDatabaseOptions()
+			opts.Tenant = test.tenant
+
+			db := &DynamoDBSubscriptionsDatabase{
+				options: opts,
+			}
+
+			it := db.SubscriptionsInSegment(ctx, &Segment{Status: STATUS_ACTIVE, StartToken: test.token})
+
+			var opts_err *OptionsError
+
+			if !errors.As(it.err, &opts_err) || opts_err.Option != "StartToken" {
+				t.Fatalf("Expected StartToken options error, got %v", it.err)
+			}
+
+			if it.Next() {
+				t.Fatalf("Expected iterator with an invalid token to fail")
+			}
+		})
+	}
+
+	// tokens from a scan of the table can not resume a query of an index, whose keys differ
+
+	opts := DefaultDynamoDBSubscriptionsDatabaseOptions()
+
+	db := &DynamoDBSubscriptionsDatabase{
+		options: opts,
+	}
+
+	token := encode(`{"address":{"S":"test@example.com"}}`)
+
+	it := db.Subscriptions(ctx, &SubscriptionsIteratorOptions{StartToken: token})
+
+	if it.err != nil {
+		t.Fatalf("Failed to resume scan from continuation token, %v", it.err)
+	}
+
+	it = db.SubscriptionsInSegment(ctx, &Segment{Status: STATUS_ACTIVE, StartToken: token})
+
+	if it.err == nil {
+		t.Fatalf("Expected scan continuation token to be rejected by a query of the status index")
+	}
+}
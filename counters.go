@@ -0,0 +1,221 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strconv"
+)
+
+// COUNTER_BOUNCE is the name of the attribute counting the messages to a subscriber which have bounced.
+const COUNTER_BOUNCE string = "bounces"
+
+// COUNTER_COMPLAINT is the name of the attribute counting the complaints (for example messages marked as spam)
+// received from a subscriber.
+const COUNTER_COMPLAINT string = "complaints"
+
+// SubscriptionCounters records the value of each counter for a subscription. Counters are zero if they have
+// never been incremented.
+type SubscriptionCounters struct {
+	Address    string `json:"address"`
+	Bounces    int64  `json:"bounces"`
+	Complaints int64  `json:"complaints"`
+}
+
+func isCounter(counter string) bool {
+
+	switch counter {
+	case COUNTER_BOUNCE, COUNTER_COMPLAINT:
+		return true
+	default:
+		return false
+	}
+}
+
+// IncrementBounceCount atomically increments the COUNTER_BOUNCE counter for the subscription for 'addr' and
+// returns its new value.
+func (db *DynamoDBSubscriptionsDatabase) IncrementBounceCount(ctx context.Context, addr string) (int64, error) {
+
+	ctx = withOperation(ctx, "IncrementBounceCount")
+	return db.incrementCounter(ctx, addr, COUNTER_BOUNCE, 1)
+}
+
+// IncrementComplaintCount atomically increments the COUNTER_COMPLAINT counter for the subscription for 'addr' and
+// returns its new value.
+func (db *DynamoDBSubscriptionsDatabase) IncrementComplaintCount(ctx context.Context, addr string) (int64, error) {
+
+	ctx = withOperation(ctx, "IncrementComplaintCount")
+	return db.incrementCounter(ctx, addr, COUNTER_COMPLAINT, 1)
+}
+
+// IncrementCounter atomically adds 'delta', which may be negative, to 'counter' (one of COUNTER_BOUNCE or
+// COUNTER_COMPLAINT) for the subscription for 'addr' using an UpdateItem request with an ADD expression, so
+// that concurrent increments are never lost, and returns its new value. It returns a `database.NoRecordError`
+// if there is no subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) IncrementCounter(ctx context.Context, addr string, counter string, delta int64) (int64, error) {
+
+	ctx = withOperation(ctx, "IncrementCounter")
+	return db.incrementCounter(ctx, addr, counter, delta)
+}
+
+func (db *DynamoDBSubscriptionsDatabase) incrementCounter(ctx context.Context, addr string, counter string, delta int64) (int64, error) {
+
+	if !isCounter(counter) {
+		return 0, fmt.Errorf("Invalid counter '%s'", counter)
+	}
+
+	req := &aws_dynamodb.UpdateItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"address": {
+				S: aws.String(db.options.addressKey(addr)),
+			},
+		},
+		UpdateExpression:    aws.String("ADD #counter :delta"),
+		ConditionExpression: aws.String("attribute_exists(#address)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address": aws.String("address"),
+			"#counter": aws.String(counter),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":delta": {
+				N: aws.String(strconv.FormatInt(delta, 10)),
+			},
+		},
+		ReturnValues: aws.String(aws_dynamodb.ReturnValueUpdatedNew),
+	}
+
+	rsp, err := db.client.UpdateItemWithContext(ctx, req)
+
+	if err != nil {
+
+		err = wrapError(err)
+
+		if errors.Is(err, ErrConditionFailed) {
+			return 0, new(database.NoRecordError)
+		}
+
+		return 0, err
+	}
+
+	return counterValue(rsp.Attributes, counter)
+}
+
+// ResetCounter sets 'counter' (one of COUNTER_BOUNCE or COUNTER_COMPLAINT) for the subscription for 'addr' to
+// zero, for example after a successful delivery following a soft bounce. It returns a `database.NoRecordError`
+// if there is no subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) ResetCounter(ctx context.Context, addr string, counter string) error {
+
+	ctx = withOperation(ctx, "ResetCounter")
+
+	if !isCounter(counter) {
+		return fmt.Errorf("Invalid counter '%s'", counter)
+	}
+
+	req := &aws_dynamodb.UpdateItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"address": {
+				S: aws.String(db.options.addressKey(addr)),
+			},
+		},
+		UpdateExpression:    aws.String("REMOVE #counter"),
+		ConditionExpression: aws.String("attribute_exists(#address)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address": aws.String("address"),
+			"#counter": aws.String(counter),
+		},
+	}
+
+	_, err := db.client.UpdateItemWithContext(ctx, req)
+
+	if err != nil {
+
+		err = wrapError(err)
+
+		if errors.Is(err, ErrConditionFailed) {
+			return new(database.NoRecordError)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// GetSubscriptionCounters returns the counters recorded for the subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) GetSubscriptionCounters(ctx context.Context, addr string) (*SubscriptionCounters, error) {
+
+	ctx = withOperation(ctx, "GetSubscriptionCounters")
+
+	req := &aws_dynamodb.GetItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"address": {
+				S: aws.String(db.options.addressKey(addr)),
+			},
+		},
+		ProjectionExpression: aws.String("#address, #bounces, #complaints"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address":    aws.String("address"),
+			"#bounces":    aws.String(COUNTER_BOUNCE),
+			"#complaints": aws.String(COUNTER_COMPLAINT),
+		},
+	}
+
+	rsp, err := db.client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	if rsp.Item == nil {
+		return nil, new(database.NoRecordError)
+	}
+
+	bounces, err := counterValue(rsp.Item, COUNTER_BOUNCE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	complaints, err := counterValue(rsp.Item, COUNTER_COMPLAINT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &SubscriptionCounters{
+		Address:    addr,
+		Bounces:    bounces,
+		Complaints: complaints,
+	}
+
+	return c, nil
+}
+
+// counterValue returns the value of 'counter' in 'item', or zero if it has never been incremented. It returns an
+// error if the attribute is not a valid number, rather than reporting it as zero.
+func counterValue(item map[string]*aws_dynamodb.AttributeValue, counter string) (int64, error) {
+
+	v, ok := item[counter]
+
+	if !ok {
+		return 0, nil
+	}
+
+	if v.N == nil {
+		return 0, fmt.Errorf("Failed to read %s counter, attribute is not a number", counter)
+	}
+
+	i, err := strconv.ParseInt(*v.N, 10, 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse %s counter, %w", counter, err)
+	}
+
+	return i, nil
+}
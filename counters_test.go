@@ -0,0 +1,105 @@
+package dynamodb
+
+import (
+	"context"
+	aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"testing"
+)
+
+// counterClient records each UpdateItem request and returns 'value' as the updated counter.
+type counterClient struct {
+	aws_dynamodbiface.DynamoDBAPI
+	value string
+	req   *aws_dynamodb.UpdateItemInput
+}
+
+func (c *counterClient) UpdateItemWithContext(ctx context.Context, req *aws_dynamodb.UpdateItemInput, opts ...request.Option) (*aws_dynamodb.UpdateItemOutput, error) {
+
+	c.req = req
+
+	counter := *req.ExpressionAttributeNames["#counter"]
+
+	rsp := &aws_dynamodb.UpdateItemOutput{
+		Attributes: map[string]*aws_dynamodb.AttributeValue{
+			counter: {N: aws.String(c.value)},
+		},
+	}
+
+	return rsp, nil
+}
+
+func TestIncrementBounceCount(t *testing.T) {
+
+	ctx := context.Background()
+
+	client := &counterClient{value: "3"}
+
+	db := &DynamoDBSubscriptionsDatabase{
+		client:  client,
+		options: DefaultDynamoDBSubscriptionsDatabaseOptions(),
+	}
+
+	count, err := db.IncrementBounceCount(ctx, "bob@example.com")
+
+	if err != nil {
+		t.Fatalf("Failed to increment bounce count, %v", err)
+	}
+
+	if count != 3 {
+		t.Fatalf("Expected bounce count 3, got %d", count)
+	}
+
+	req := client.req
+
+	if *req.UpdateExpression != "ADD #counter :delta" || *req.ExpressionAttributeNames["#counter"] != COUNTER_BOUNCE {
+		t.Fatalf("Expected an ADD expression for the bounce counter, got %s", req)
+	}
+
+	if *req.ExpressionAttributeValues[":delta"].N != "1" || *req.ConditionExpression != "attribute_exists(#address)" {
+		t.Fatalf("Unexpected increment request %s", req)
+	}
+
+	client.value = "three"
+
+	_, err = db.IncrementBounceCount(ctx, "bob@example.com")
+
+	if err == nil {
+		t.Fatalf("Expected an error for a malformed counter")
+	}
+}
+
+func TestCounterValue(t *testing.T) {
+
+	item := map[string]*aws_dynamodb.AttributeValue{
+		COUNTER_BOUNCE:    {N: aws.String("12")},
+		COUNTER_COMPLAINT: {S: aws.String("12")},
+		"malformed":       {N: aws.String("1.5")},
+	}
+
+	tests := []struct {
+		counter string
+		value   int64
+		ok      bool
+	}{
+		{counter: COUNTER_BOUNCE, value: 12, ok: true},
+		{counter: "missing", value: 0, ok: true},
+		{counter: COUNTER_COMPLAINT},
+		{counter: "malformed"},
+	}
+
+	for _, test := range tests {
+
+		v, err := counterValue(item, test.counter)
+
+		if test.ok && (err != nil || v != test.value) {
+			t.Fatalf("Expected %s counter to be %d, got %d (%v)", test.counter, test.value, v, err)
+		}
+
+		if !test.ok && err == nil {
+			t.Fatalf("Expected an error parsing %s counter, got %d", test.counter, v)
+		}
+	}
+}
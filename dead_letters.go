@@ -0,0 +1,335 @@
+package dynamodb
+
+import (
+	"context"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"net/http"
+	"time"
+)
+
+const DEAD_LETTERS_DEFAULT_TABLENAME string = "dead_letters"
+
+// DeadLetter records a delivery of a message to an address which failed permanently.
+type DeadLetter struct {
+	Address   string `json:"address"`
+	MessageId string `json:"message_id"`
+	// Queue is the name of the send queue the delivery was leased from, if any.
+	Queue string `json:"queue,omitempty"`
+	// MessageURI is an optional pointer to the raw message, for example an S3 URI, so that it can be sent again.
+	MessageURI string `json:"message_uri,omitempty"`
+	// Error is the error returned by the final attempt to send the message.
+	Error string `json:"error"`
+	// Attempts is the number of times sending the message was attempted.
+	Attempts int `json:"attempts"`
+	// Failed is the Unix time at which the delivery was recorded as failed.
+	Failed int64 `json:"failed"`
+}
+
+// ListDeadLettersFunc is a callback function invoked for each dead letter when listing dead letters.
+type ListDeadLettersFunc func(*DeadLetter) error
+
+// NewDeadLetter returns a new `DeadLetter` for the send queue item 'item' which failed with 'send_err'.
+// 'message_uri' is an optional pointer to the raw message.
+func NewDeadLetter(item *SendQueueItem, send_err error, message_uri string) *DeadLetter {
+
+	dl := &DeadLetter{
+		Address:    item.Address,
+		MessageId:  item.MessageId,
+		Queue:      item.Queue,
+		MessageURI: message_uri,
+		Attempts:   item.Attempts,
+		Failed:     time.Now().Unix(),
+	}
+
+	if send_err != nil {
+		dl.Error = send_err.Error()
+	}
+
+	return dl
+}
+
+type DynamoDBDeadLettersDatabaseOptions struct {
+	TableName   string
+	TablePrefix string
+	TableSuffix string
+	BillingMode string
+	CreateTable bool
+	// DeletionProtection enables deletion protection when the table is created.
+	DeletionProtection bool
+	// TableClass is the table class (STANDARD or STANDARD_INFREQUENT_ACCESS) used when the table is created.
+	// If empty STANDARD is used.
+	TableClass string
+	// ContributorInsights enables CloudWatch Contributor Insights for the table and its indexes when the table is created.
+	ContributorInsights bool
+	// PageSize is the maximum number of items to evaluate in each page of results when listing dead letters.
+	// If zero DynamoDB's default (1MB of data) is used.
+	PageSize int64
+	// ReturnConsumedCapacity is the level of consumed capacity detail (TOTAL or INDEXES) to request when
+	// ConsumedCapacityFunc is set. If empty TOTAL is used.
+	ReturnConsumedCapacity string
+	// ConsumedCapacityFunc is an optional callback invoked with the capacity consumed by each request.
+	ConsumedCapacityFunc ConsumedCapacityFunc
+	// CapacityLimiter is an optional `CapacityLimiter` which caps the read and write capacity consumed per second.
+	CapacityLimiter *CapacityLimiter
+	// Middleware is an optional chain of `Middleware` invoked around each request to DynamoDB, the first of which is outermost.
+	Middleware []Middleware
+	// ReadOnly rejects every request which would write to the table with ErrReadOnly, before it is sent. It may not
+	// be used with CreateTable.
+	ReadOnly bool
+	// HTTPClient is an optional HTTP client used by the session and DSN constructors in place of the session's
+	// default client. See `NewHTTPClient`.
+	HTTPClient *http.Client
+	// Region is the AWS region of the table, used in place of the session's region by the session and DSN constructors.
+	// If empty the region of the table's ARN, if TableName is an ARN, and otherwise the session's region is used.
+	Region string
+	// Endpoint is the URL of the DynamoDB endpoint, for example "http://localhost:8000" for DynamoDB Local, used in place
+	// of the session's endpoint by the session and DSN constructors. It takes precedence over UseFIPSEndpoint and
+	// UseDualStackEndpoint. If empty the session's endpoint is used.
+	Endpoint string
+	// UseFIPSEndpoint selects the FIPS 140-2 validated DynamoDB endpoint for the session's region.
+	UseFIPSEndpoint bool
+	// UseDualStackEndpoint selects the dual-stack (IPv4 and IPv6) DynamoDB endpoint for the session's region.
+	UseDualStackEndpoint bool
+	// Retry is an optional `RetryOptions` used to retry failed requests in place of the AWS SDK's default retryer.
+	Retry *RetryOptions
+}
+
+func DefaultDynamoDBDeadLettersDatabaseOptions() *DynamoDBDeadLettersDatabaseOptions {
+
+	opts := DynamoDBDeadLettersDatabaseOptions{
+		TableName:   DEAD_LETTERS_DEFAULT_TABLENAME,
+		BillingMode: "PAY_PER_REQUEST",
+		CreateTable: false,
+	}
+
+	return &opts
+}
+
+// FullTableName returns the name of the table with the TablePrefix and TableSuffix options applied.
+func (opts *DynamoDBDeadLettersDatabaseOptions) FullTableName() string {
+	return fullTableName(opts.TablePrefix, opts.TableName, opts.TableSuffix)
+}
+
+// DynamoDBDeadLettersDatabase stores deliveries which failed permanently, keyed on address and message ID, so
+// that they can be inspected and replayed (see cmd/replay-deadletters) once the underlying problem is fixed.
+type DynamoDBDeadLettersDatabase struct {
+	client  aws_dynamodbiface.DynamoDBAPI
+	options *DynamoDBDeadLettersDatabaseOptions
+}
+
+func NewDynamoDBDeadLettersDatabaseWithDSN(dsn string, opts *DynamoDBDeadLettersDatabaseOptions) (*DynamoDBDeadLettersDatabase, error) {
+
+	sess, err := newSessionWithDSNSettings(dsn, DSN_DEAD_LETTERS_TABLE_KEY, opts.settings())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDynamoDBDeadLettersDatabaseWithSession(sess, opts)
+}
+
+func NewDynamoDBDeadLettersDatabaseWithSession(sess *aws_session.Session, opts *DynamoDBDeadLettersDatabaseOptions) (*DynamoDBDeadLettersDatabase, error) {
+
+	client := opts.settings().newClient(sess)
+
+	return NewDynamoDBDeadLettersDatabaseWithClient(client, opts)
+}
+
+// NewDynamoDBDeadLettersDatabaseWithClient returns a new `DynamoDBDeadLettersDatabase` instance that uses 'client'
+// to talk to DynamoDB.
+func NewDynamoDBDeadLettersDatabaseWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBDeadLettersDatabaseOptions) (*DynamoDBDeadLettersDatabase, error) {
+
+	err := opts.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	client = withMiddleware(client, opts.settings().middleware())
+
+	if opts.CreateTable {
+
+		_, err := CreateDeadLettersTable(client, opts)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db := DynamoDBDeadLettersDatabase{
+		client:  client,
+		options: opts,
+	}
+
+	return &db, nil
+}
+
+// AddDeadLetter records 'dl', replacing any existing dead letter for the same address and message ID.
+func (db *DynamoDBDeadLettersDatabase) AddDeadLetter(ctx context.Context, dl *DeadLetter) error {
+
+	ctx = withOperation(ctx, "AddDeadLetter")
+
+	item, err := aws_dynamodbattribute.MarshalMap(dl)
+
+	if err != nil {
+		return err
+	}
+
+	req := &aws_dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(db.options.FullTableName()),
+	}
+
+	_, err = db.client.PutItemWithContext(ctx, req)
+
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return nil
+}
+
+// GetDeadLetter returns the dead letter for 'message_id' and 'addr'. It returns a `database.NoRecordError` if
+// there is no dead letter for them.
+func (db *DynamoDBDeadLettersDatabase) GetDeadLetter(ctx context.Context, addr string, message_id string) (*DeadLetter, error) {
+
+	ctx = withOperation(ctx, "GetDeadLetter")
+
+	req := &aws_dynamodb.GetItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key:       deadLetterKey(addr, message_id),
+	}
+
+	rsp, err := db.client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	return itemToDeadLetter(rsp.Item)
+}
+
+// RemoveDeadLetter removes 'dl', for example once it has been replayed.
+func (db *DynamoDBDeadLettersDatabase) RemoveDeadLetter(ctx context.Context, dl *DeadLetter) error {
+
+	ctx = withOperation(ctx, "RemoveDeadLetter")
+
+	req := &aws_dynamodb.DeleteItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key:       deadLetterKey(dl.Address, dl.MessageId),
+	}
+
+	_, err := db.client.DeleteItemWithContext(ctx, req)
+
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return nil
+}
+
+// ListDeadLetters invokes 'callback' for each dead letter. This is a scan of the entire table.
+func (db *DynamoDBDeadLettersDatabase) ListDeadLetters(ctx context.Context, callback ListDeadLettersFunc) error {
+
+	ctx = withOperation(ctx, "ListDeadLetters")
+
+	req := &aws_dynamodb.ScanInput{
+		TableName: aws.String(db.options.FullTableName()),
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
+	}
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return err
+		}
+
+		rsp, err := db.client.ScanWithContext(ctx, req)
+
+		if err != nil {
+			return wrapError(err)
+		}
+
+		for _, item := range rsp.Items {
+
+			err := ctx.Err()
+
+			if err != nil {
+				return err
+			}
+
+			dl, err := itemToDeadLetter(item)
+
+			if err != nil {
+				return err
+			}
+
+			err = callback(dl)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// DeadLetter records 'item', which failed permanently with 'send_err', in 'dead_letters' and removes it from
+// the queue. 'message_uri' is an optional pointer to the raw message. The dead letter is recorded before the
+// item is removed so if the lease on 'item' has been lost ErrLeaseLost is returned and the item remains queued.
+func (q *DynamoDBSendQueue) DeadLetter(ctx context.Context, item *SendQueueItem, dead_letters *DynamoDBDeadLettersDatabase, send_err error, message_uri string) error {
+
+	err := dead_letters.AddDeadLetter(ctx, NewDeadLetter(item, send_err, message_uri))
+
+	if err != nil {
+		return err
+	}
+
+	return q.Complete(ctx, item)
+}
+
+func deadLetterKey(addr string, message_id string) map[string]*aws_dynamodb.AttributeValue {
+
+	return map[string]*aws_dynamodb.AttributeValue{
+		"address": {
+			S: aws.String(addr),
+		},
+		"message_id": {
+			S: aws.String(message_id),
+		},
+	}
+}
+
+func itemToDeadLetter(item map[string]*aws_dynamodb.AttributeValue) (*DeadLetter, error) {
+
+	var dl *DeadLetter
+
+	err := aws_dynamodbattribute.UnmarshalMap(item, &dl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if dl == nil || dl.Address == "" {
+		return nil, new(database.NoRecordError)
+	}
+
+	return dl, nil
+}
@@ -2,24 +2,85 @@ package dynamodb
 
 import (
 	"context"
-	"errors"
-	"github.com/aaronland/go-aws-session"
+	"fmt"
 	"github.com/aaronland/go-mailinglist/database"
 	"github.com/aaronland/go-mailinglist/delivery"
 	aws "github.com/aws/aws-sdk-go/aws"
 	aws_session "github.com/aws/aws-sdk-go/aws/session"
 	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
 	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	_ "log"
+	"net/http"
 	_ "strconv"
 )
 
 const DELIVERIES_DEFAULT_TABLENAME string = "deliveries"
 
+// DELIVERIES_MESSAGE_INDEX is the default name of the deliveries index keyed on message ID and address.
+const DELIVERIES_MESSAGE_INDEX string = "message_id"
+
+// DELIVERIES_LEGACY_MESSAGE_INDEX is the name of the index keyed on message ID in deliveries tables created by
+// earlier versions of this package.
+const DELIVERIES_LEGACY_MESSAGE_INDEX string = "status"
+
 type DynamoDBDeliveriesDatabaseOptions struct {
 	TableName   string
+	TablePrefix string
+	TableSuffix string
 	BillingMode string
 	CreateTable bool
+	// DeletionProtection enables deletion protection when the table is created.
+	DeletionProtection bool
+	// TableClass is the table class (STANDARD or STANDARD_INFREQUENT_ACCESS) used when the table is created.
+	// If empty STANDARD is used.
+	TableClass string
+	// ContributorInsights enables CloudWatch Contributor Insights for the table and its indexes when the table is created.
+	ContributorInsights bool
+	// KinesisStreamArn is the ARN of an optional Kinesis data stream to which changes to the table are streamed,
+	// enabled when the table is created. See the changes package for decoding the resulting records.
+	KinesisStreamArn string
+	// Retention is an optional policy declaring the maximum age of deliveries. Deliveries have no status so only its
+	// RETENTION_ANY rule applies. It is enforced using TTL if RetentionAttribute is set and by `EnforceRetention`
+	// (see cmd/enforce-retention) otherwise.
+	Retention RetentionPolicy
+	// RetentionAttribute is the name of the attribute each delivery's expiry time, under Retention, is written to
+	// and for which TTL is enabled when the table is created. See RETENTION_DEFAULT_ATTRIBUTE.
+	RetentionAttribute string
+	// MessageIndex is the name of the index used to query deliveries by message ID. Use DELIVERIES_LEGACY_MESSAGE_INDEX
+	// for tables created by earlier versions of this package. If empty DELIVERIES_MESSAGE_INDEX is used.
+	MessageIndex string
+	// PageSize is the maximum number of items to evaluate in each page of results when listing deliveries.
+	// If zero DynamoDB's default (1MB of data) is used.
+	PageSize int64
+	// ReturnConsumedCapacity is the level of consumed capacity detail (TOTAL or INDEXES) to request when
+	// ConsumedCapacityFunc is set. If empty TOTAL is used.
+	ReturnConsumedCapacity string
+	// ConsumedCapacityFunc is an optional callback invoked with the capacity consumed by each request.
+	ConsumedCapacityFunc ConsumedCapacityFunc
+	// CapacityLimiter is an optional `CapacityLimiter` which caps the read and write capacity consumed per second.
+	CapacityLimiter *CapacityLimiter
+	// Middleware is an optional chain of `Middleware` invoked around each request to DynamoDB, the first of which is outermost.
+	Middleware []Middleware
+	// ReadOnly rejects every request which would write to the table with ErrReadOnly, before it is sent. It may not
+	// be used with CreateTable.
+	ReadOnly bool
+	// HTTPClient is an optional HTTP client used by the session and DSN constructors in place of the session's
+	// default client. See `NewHTTPClient`.
+	HTTPClient *http.Client
+	// Region is the AWS region of the table, used in place of the session's region by the session and DSN constructors.
+	// If empty the region of the table's ARN, if TableName is an ARN, and otherwise the session's region is used.
+	Region string
+	// Endpoint is the URL of the DynamoDB endpoint, for example "http://localhost:8000" for DynamoDB Local, used in place
+	// of the session's endpoint by the session and DSN constructors. It takes precedence over UseFIPSEndpoint and
+	// UseDualStackEndpoint. If empty the session's endpoint is used.
+	Endpoint string
+	// UseFIPSEndpoint selects the FIPS 140-2 validated DynamoDB endpoint for the session's region.
+	UseFIPSEndpoint bool
+	// UseDualStackEndpoint selects the dual-stack (IPv4 and IPv6) DynamoDB endpoint for the session's region.
+	UseDualStackEndpoint bool
+	// Retry is an optional `RetryOptions` used to retry failed requests in place of the AWS SDK's default retryer.
+	Retry *RetryOptions
 }
 
 func DefaultDynamoDBDeliveriesDatabaseOptions() *DynamoDBDeliveriesDatabaseOptions {
@@ -33,26 +94,97 @@ func DefaultDynamoDBDeliveriesDatabaseOptions() *DynamoDBDeliveriesDatabaseOptio
 	return &opts
 }
 
+// FullTableName returns the name of the table with the TablePrefix and TableSuffix options applied.
+func (opts *DynamoDBDeliveriesDatabaseOptions) FullTableName() string {
+	return fullTableName(opts.TablePrefix, opts.TableName, opts.TableSuffix)
+}
+
+// MessageIndexName returns the name of the index keyed on message ID.
+func (opts *DynamoDBDeliveriesDatabaseOptions) MessageIndexName() string {
+
+	if opts.MessageIndex != "" {
+		return opts.MessageIndex
+	}
+
+	return DELIVERIES_MESSAGE_INDEX
+}
+
 type DynamoDBDeliveriesDatabase struct {
 	database.DeliveriesDatabase
-	client  *aws_dynamodb.DynamoDB
+	client  aws_dynamodbiface.DynamoDBAPI
 	options *DynamoDBDeliveriesDatabaseOptions
 }
 
+// NewDynamoDBDeliveriesDatabaseWithDSN returns a new `database.DeliveriesDatabase` for 'dsn'. See
+// `NewDeliveriesDatabaseWithDSN` for a constructor which returns the concrete `DynamoDBDeliveriesDatabase`.
 func NewDynamoDBDeliveriesDatabaseWithDSN(dsn string, opts *DynamoDBDeliveriesDatabaseOptions) (database.DeliveriesDatabase, error) {
 
-	sess, err := session.NewSessionWithDSN(dsn)
+	db, err := NewDeliveriesDatabaseWithDSN(dsn, opts)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return NewDynamoDBDeliveriesDatabaseWithSession(sess, opts)
+	return db, nil
 }
 
+// NewDynamoDBDeliveriesDatabaseWithSession returns a new `database.DeliveriesDatabase` for 'sess'. See
+// `NewDeliveriesDatabaseWithSession` for a constructor which returns the concrete `DynamoDBDeliveriesDatabase`.
 func NewDynamoDBDeliveriesDatabaseWithSession(sess *aws_session.Session, opts *DynamoDBDeliveriesDatabaseOptions) (database.DeliveriesDatabase, error) {
 
-	client := aws_dynamodb.New(sess)
+	db, err := NewDeliveriesDatabaseWithSession(sess, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewDynamoDBDeliveriesDatabaseWithClient returns a new `database.DeliveriesDatabase` that uses 'client' to talk to
+// DynamoDB. See `NewDeliveriesDatabaseWithClient` for a constructor which returns the concrete `DynamoDBDeliveriesDatabase`.
+func NewDynamoDBDeliveriesDatabaseWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBDeliveriesDatabaseOptions) (database.DeliveriesDatabase, error) {
+
+	db, err := NewDeliveriesDatabaseWithClient(client, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewDeliveriesDatabaseWithDSN returns a new `DynamoDBDeliveriesDatabase` instance for 'dsn'. Table names and
+// endpoint settings assigned in 'dsn' are assigned to 'opts'.
+func NewDeliveriesDatabaseWithDSN(dsn string, opts *DynamoDBDeliveriesDatabaseOptions) (*DynamoDBDeliveriesDatabase, error) {
+
+	sess, err := newSessionWithDSNSettings(dsn, DSN_DELIVERIES_TABLE_KEY, opts.settings())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDeliveriesDatabaseWithSession(sess, opts)
+}
+
+// NewDeliveriesDatabaseWithSession returns a new `DynamoDBDeliveriesDatabase` instance for 'sess'.
+func NewDeliveriesDatabaseWithSession(sess *aws_session.Session, opts *DynamoDBDeliveriesDatabaseOptions) (*DynamoDBDeliveriesDatabase, error) {
+
+	client := opts.settings().newClient(sess)
+
+	return NewDeliveriesDatabaseWithClient(client, opts)
+}
+
+// NewDeliveriesDatabaseWithClient returns a new `DynamoDBDeliveriesDatabase` instance that uses 'client' to talk to DynamoDB.
+func NewDeliveriesDatabaseWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBDeliveriesDatabaseOptions) (*DynamoDBDeliveriesDatabase, error) {
+
+	err := opts.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	client = withMiddleware(client, opts.settings().middleware())
 
 	if opts.CreateTable {
 
@@ -72,9 +204,20 @@ func NewDynamoDBDeliveriesDatabaseWithSession(sess *aws_session.Session, opts *D
 }
 
 func (db *DynamoDBDeliveriesDatabase) GetDeliveryWithAddressAndMessageId(addr string, message_id string) (*delivery.Delivery, error) {
+	return db.GetDeliveryWithAddressAndMessageIdWithContext(context.Background(), addr, message_id)
+}
+
+// GetDeliveryWithAddressAndMessageIdWithContext is the context-first equivalent of `GetDeliveryWithAddressAndMessageId`.
+func (db *DynamoDBDeliveriesDatabase) GetDeliveryWithAddressAndMessageIdWithContext(ctx context.Context, addr string, message_id string) (*delivery.Delivery, error) {
+
+	ctx = withOperation(ctx, "GetDeliveryWithAddressAndMessageId")
+	return db.getDeliveryWithAddressAndMessageId(ctx, addr, message_id)
+}
+
+func (db *DynamoDBDeliveriesDatabase) getDeliveryWithAddressAndMessageId(ctx context.Context, addr string, message_id string) (*delivery.Delivery, error) {
 
 	req := &aws_dynamodb.GetItemInput{
-		TableName: aws.String(db.options.TableName),
+		TableName: aws.String(db.options.FullTableName()),
 		Key: map[string]*aws_dynamodb.AttributeValue{
 			"address": {
 				S: aws.String(addr),
@@ -85,58 +228,122 @@ func (db *DynamoDBDeliveriesDatabase) GetDeliveryWithAddressAndMessageId(addr st
 		},
 	}
 
-	rsp, err := db.client.GetItem(req)
+	rsp, err := db.client.GetItemWithContext(ctx, req)
 
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
 	return itemToDelivery(rsp.Item)
 }
 
 func (db *DynamoDBDeliveriesDatabase) AddDelivery(d *delivery.Delivery) error {
+	return db.AddDeliveryWithContext(context.Background(), d)
+}
+
+// AddDeliveryWithContext is the context-first equivalent of `AddDelivery`.
+func (db *DynamoDBDeliveriesDatabase) AddDeliveryWithContext(ctx context.Context, d *delivery.Delivery) error {
+
+	ctx = withOperation(ctx, "AddDelivery")
+	return db.addDelivery(ctx, d)
+}
+
+func (db *DynamoDBDeliveriesDatabase) addDelivery(ctx context.Context, d *delivery.Delivery) error {
+
+	err := validateDelivery(d)
 
-	existing_d, err := db.GetDeliveryWithAddressAndMessageId(d.Address, d.MessageId)
+	if err != nil {
+		return err
+	}
 
-	if err != nil && !database.IsNotExist(err) {
+	existing_d, err := db.getDeliveryWithAddressAndMessageId(ctx, d.Address, d.MessageId)
+
+	if err != nil && !IsNotExist(err) {
 		return err
 	}
 
 	if existing_d != nil {
-		return errors.New("Delivery already exists")
+		return fmt.Errorf("Failed to add delivery for %s (%s), %w", d.Address, d.MessageId, ErrAlreadyExists)
 	}
 
-	return putDelivery(db.client, db.options, d)
+	return putDelivery(ctx, db.client, db.options, d)
 }
 
-/*
 func (db *DynamoDBDeliveriesDatabase) ListDeliveries(ctx context.Context, callback database.ListDeliveriesFunc) error {
 
-		req := &aws_dynamodb.QueryInput{
-			ProjectionExpression: aws.String("#confirmed, address"),
-			KeyConditionExpression: aws.String("#confirmed > :zero"),
-			ExpressionAttributeNames: map[string]*string{
-				"#confirmed": aws.String("confirmed"),
-			},
-			ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
-				":zero": {
-					N: aws.String("0"),
-				},
-			},
-			TableName: aws.String(db.options.TableName),
-		}
-
-		return queryDeliveries(ctx, db.client, req, callback)
+	ctx = withOperation(ctx, "ListDeliveries")
 
 	req := &aws_dynamodb.ScanInput{
-		TableName: aws.String(db.options.TableName),
+		TableName: aws.String(db.options.FullTableName()),
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
 	}
 
 	return scanDeliveries(ctx, db.client, req, callback)
 }
-*/
 
-func putDelivery(client *aws_dynamodb.DynamoDB, opts *DynamoDBDeliveriesDatabaseOptions, sub *delivery.Delivery) error {
+// ListDeliveriesForMessage invokes 'callback' for each delivery of 'message_id', in address order, by querying
+// the message index.
+func (db *DynamoDBDeliveriesDatabase) ListDeliveriesForMessage(ctx context.Context, message_id string, callback database.ListDeliveriesFunc) error {
+
+	ctx = withOperation(ctx, "ListDeliveriesForMessage")
+
+	req := &aws_dynamodb.QueryInput{
+		TableName:              aws.String(db.options.FullTableName()),
+		IndexName:              aws.String(db.options.MessageIndexName()),
+		KeyConditionExpression: aws.String("#message_id = :message_id"),
+		ExpressionAttributeNames: map[string]*string{
+			"#message_id": aws.String("message_id"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":message_id": {
+				S: aws.String(message_id),
+			},
+		},
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
+	}
+
+	return queryDeliveries(ctx, db.client, req, callback)
+}
+
+// ListDeliveriesForAddress invokes 'callback' for each delivery to 'addr', in message ID order, by querying
+// the table's key.
+func (db *DynamoDBDeliveriesDatabase) ListDeliveriesForAddress(ctx context.Context, addr string, callback database.ListDeliveriesFunc) error {
+
+	ctx = withOperation(ctx, "ListDeliveriesForAddress")
+
+	req := &aws_dynamodb.QueryInput{
+		TableName:              aws.String(db.options.FullTableName()),
+		KeyConditionExpression: aws.String("#address = :address"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address": aws.String("address"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":address": {
+				S: aws.String(addr),
+			},
+		},
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
+	}
+
+	return queryDeliveries(ctx, db.client, req, callback)
+}
+
+func putDelivery(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBDeliveriesDatabaseOptions, sub *delivery.Delivery) error {
+
+	err := validateDelivery(sub)
+
+	if err != nil {
+		return err
+	}
 
 	item, err := aws_dynamodbattribute.MarshalMap(sub)
 
@@ -144,15 +351,17 @@ func putDelivery(client *aws_dynamodb.DynamoDB, opts *DynamoDBDeliveriesDatabase
 		return err
 	}
 
+	setRetentionAttribute(item, opts.RetentionAttribute, opts.Retention, RETENTION_ANY, deliveryRetentionTime(sub))
+
 	req := &aws_dynamodb.PutItemInput{
 		Item:      item,
-		TableName: aws.String(opts.TableName),
+		TableName: aws.String(opts.FullTableName()),
 	}
 
-	_, err = client.PutItem(req)
+	_, err = client.PutItemWithContext(ctx, req)
 
 	if err != nil {
-		return err
+		return wrapError(err)
 	}
 
 	return nil
@@ -175,18 +384,30 @@ func itemToDelivery(item map[string]*aws_dynamodb.AttributeValue) (*delivery.Del
 	return sub, nil
 }
 
-func scanDeliveries(ctx context.Context, client *aws_dynamodb.DynamoDB, req *aws_dynamodb.ScanInput, callback database.ListDeliveriesFunc) error {
+func scanDeliveries(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, req *aws_dynamodb.ScanInput, callback database.ListDeliveriesFunc) error {
 
 	for {
 
-		rsp, err := client.Scan(req)
+		err := ctx.Err()
 
 		if err != nil {
 			return err
 		}
 
+		rsp, err := client.ScanWithContext(ctx, req)
+
+		if err != nil {
+			return wrapError(err)
+		}
+
 		for _, item := range rsp.Items {
 
+			err := ctx.Err()
+
+			if err != nil {
+				return err
+			}
+
 			sub, err := itemToDelivery(item)
 
 			if err != nil {
@@ -209,3 +430,50 @@ func scanDeliveries(ctx context.Context, client *aws_dynamodb.DynamoDB, req *aws
 
 	return nil
 }
+
+func queryDeliveries(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, req *aws_dynamodb.QueryInput, callback database.ListDeliveriesFunc) error {
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return err
+		}
+
+		rsp, err := client.QueryWithContext(ctx, req)
+
+		if err != nil {
+			return wrapError(err)
+		}
+
+		for _, item := range rsp.Items {
+
+			err := ctx.Err()
+
+			if err != nil {
+				return err
+			}
+
+			d, err := itemToDelivery(item)
+
+			if err != nil {
+				return err
+			}
+
+			err = callback(d)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return nil
+}
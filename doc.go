@@ -0,0 +1,16 @@
+// package dynamodb implements the go-mailinglist database interfaces (subscriptions, confirmations, event logs and
+// deliveries) using Amazon DynamoDB, along with the tables, tools and helpers needed to run a mailing list on it.
+//
+// Databases are created with a DSN string of the form `region={REGION} credentials={CREDENTIALS}`, as defined by
+// the aaronland/go-aws-session package, and functional options. For example:
+//
+//	subs_db, err := dynamodb.NewSubscriptionsDatabase(ctx,
+//		dynamodb.WithDSN("region=us-east-1 credentials=session"),
+//		dynamodb.WithTablePrefix("prod_"),
+//	)
+//
+// The tables each database expects are described by `TableDefinition` and may be created with the database's
+// `CreateTable` option, the `setup-tables` tool or the templates emitted by `emit-cloudformation`.
+//
+// Longer discussions of the package's features, grouped by topic, are in the docs directory.
+package dynamodb
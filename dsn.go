@@ -0,0 +1,534 @@
+package dynamodb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-aws-session"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DSN_TABLE_KEY is the DSN key used to assign a table name to whichever database the DSN is being used to create.
+const DSN_TABLE_KEY string = "table"
+
+// DSN_SUBSCRIPTIONS_TABLE_KEY is the DSN key used to assign the name of the subscriptions table.
+const DSN_SUBSCRIPTIONS_TABLE_KEY string = "subscriptions-table"
+
+// DSN_CONFIRMATIONS_TABLE_KEY is the DSN key used to assign the name of the confirmations table.
+const DSN_CONFIRMATIONS_TABLE_KEY string = "confirmations-table"
+
+// DSN_EVENTLOGS_TABLE_KEY is the DSN key used to assign the name of the event logs table.
+const DSN_EVENTLOGS_TABLE_KEY string = "eventlogs-table"
+
+// DSN_UNSUBSCRIBE_TOKENS_TABLE_KEY is the DSN key used to assign the name of the unsubscribe tokens table.
+const DSN_UNSUBSCRIBE_TOKENS_TABLE_KEY string = "unsubscribe-tokens-table"
+
+// DSN_DELIVERIES_TABLE_KEY is the DSN key used to assign the name of the deliveries table.
+const DSN_DELIVERIES_TABLE_KEY string = "deliveries-table"
+
+// DSN_SEND_QUEUE_TABLE_KEY is the DSN key used to assign the name of the send queue table.
+const DSN_SEND_QUEUE_TABLE_KEY string = "send-queue-table"
+
+// DSN_DEAD_LETTERS_TABLE_KEY is the DSN key used to assign the name of the dead letters table.
+const DSN_DEAD_LETTERS_TABLE_KEY string = "dead-letters-table"
+
+// DSN_HISTORY_TABLE_KEY is the DSN key used to assign the name of the subscription history table.
+const DSN_HISTORY_TABLE_KEY string = "history-table"
+
+// DSN_STATS_TABLE_KEY is the DSN key used to assign the name of the subscription stats table.
+const DSN_STATS_TABLE_KEY string = "stats-table"
+
+// DSN_FIPS_KEY is the DSN key used to enable (or disable) FIPS endpoints. Its value is parsed with `strconv.ParseBool`.
+const DSN_FIPS_KEY string = "fips"
+
+// DSN_DUAL_STACK_KEY is the DSN key used to enable (or disable) dual-stack endpoints. Its value is parsed with `strconv.ParseBool`.
+const DSN_DUAL_STACK_KEY string = "dual-stack"
+
+// DSN_PROFILE_KEY is the DSN key used to create a session from a named profile in the shared AWS configuration
+// files, for example an AWS SSO (IAM Identity Center) profile, in place of the DSN_CREDENTIALS_KEY key.
+const DSN_PROFILE_KEY string = "profile"
+
+// CONFIG_URI_SCHEME is the scheme of config strings, of the form aws://{REGION}?credentials={CREDENTIALS}, which
+// may be used in place of DSN strings. See `ParseDSN`.
+const CONFIG_URI_SCHEME string = "aws"
+
+// DSN_REGION_KEY is the DSN key used to assign the AWS region.
+const DSN_REGION_KEY string = "region"
+
+// DSN_CREDENTIALS_KEY is the DSN key used to assign credentials, in one of the forms defined by the
+// aaronland/go-aws-session package.
+const DSN_CREDENTIALS_KEY string = "credentials"
+
+// CONFIG_URI_ANON_CREDENTIALS are the anonymous credentials allowed by aaronland/go-aws-auth config strings, which
+// are rejected since DynamoDB requires signed requests.
+const CONFIG_URI_ANON_CREDENTIALS string = "anon:"
+
+// DSN_ENDPOINT_KEY is the DSN key used to assign the URL of the DynamoDB endpoint. See the Endpoint option.
+const DSN_ENDPOINT_KEY string = "endpoint"
+
+// dsnTableKeys are the DSN keys which assign table names.
+var dsnTableKeys = []string{
+	DSN_TABLE_KEY,
+	DSN_SUBSCRIPTIONS_TABLE_KEY,
+	DSN_CONFIRMATIONS_TABLE_KEY,
+	DSN_EVENTLOGS_TABLE_KEY,
+	DSN_UNSUBSCRIBE_TOKENS_TABLE_KEY,
+	DSN_DELIVERIES_TABLE_KEY,
+	DSN_SEND_QUEUE_TABLE_KEY,
+	DSN_DEAD_LETTERS_TABLE_KEY,
+	DSN_HISTORY_TABLE_KEY,
+	DSN_STATS_TABLE_KEY,
+}
+
+// re_region matches the characters allowed in AWS region names.
+var re_region = regexp.MustCompile(`^[a-z0-9\-]+$`)
+
+// ErrInvalidDSN is returned (wrapped, by a `DSNError`) when a DSN string can not be parsed.
+var ErrInvalidDSN = errors.New("Invalid DSN")
+
+// DSNError describes why a DSN string failed to parse. It wraps ErrInvalidDSN.
+type DSNError struct {
+	// Key is the DSN key which is missing or malformed, for example "region". It is empty if the DSN string
+	// itself is malformed.
+	Key string
+	// Value is the malformed value, if any.
+	Value string
+	// Reason describes what is wrong with the key or value.
+	Reason string
+}
+
+func (e *DSNError) Error() string {
+
+	if e.Key == "" {
+		return fmt.Sprintf("Invalid DSN, %s", e.Reason)
+	}
+
+	if e.Value == "" {
+		return fmt.Sprintf("Invalid DSN key '%s', %s", e.Key, e.Reason)
+	}
+
+	return fmt.Sprintf("Invalid DSN key '%s' value '%s', %s", e.Key, e.Value, e.Reason)
+}
+
+func (e *DSNError) Unwrap() error {
+	return ErrInvalidDSN
+}
+
+func dsnError(key string, value string, reason string) error {
+
+	return &DSNError{
+		Key:    key,
+		Value:  value,
+		Reason: reason,
+	}
+}
+
+// DSN is a parsed DSN string. See `ParseDSN`.
+type DSN struct {
+	// Region is the value of the DSN_REGION_KEY key.
+	Region string
+	// Credentials is the value of the DSN_CREDENTIALS_KEY key.
+	Credentials string
+	// Profile is the value of the DSN_PROFILE_KEY key.
+	Profile string
+	// Endpoint is the value of the DSN_ENDPOINT_KEY key.
+	Endpoint string
+	// FIPS is the value of the DSN_FIPS_KEY key, or nil if it is absent.
+	FIPS *bool
+	// DualStack is the value of the DSN_DUAL_STACK_KEY key, or nil if it is absent.
+	DualStack *bool
+	// Tables are the table names, or ARNs, assigned in the DSN keyed by their DSN key, for example DSN_SUBSCRIPTIONS_TABLE_KEY.
+	Tables map[string]string
+	// Unknown are the keys, sorted, which are not used by this package, for example keys shared with other consumers
+	// of the same DSN string. They are otherwise ignored.
+	Unknown []string
+}
+
+// ParseDSN parses and validates 'str_dsn', a space-separated list of key=value pairs or a config string of the form
+// aws://{REGION}?credentials={CREDENTIALS}&{KEY}={VALUE}, as used by the aaronland/go-aws-auth package, whose query
+// parameters are the same keys as a DSN's, returning a `DSNError` which
+// names the key that is missing or malformed if it is invalid. Keys which are not used by this package are ignored,
+// as they are by the aaronland/go-aws-session package, and listed in the Unknown property. Either DSN_CREDENTIALS_KEY or DSN_PROFILE_KEY
+// must be assigned, but not both, and DSN_REGION_KEY is required unless a profile (which may define its region) is
+// used. It can be used to validate configuration at startup, before any database is created.
+func ParseDSN(str_dsn string) (*DSN, error) {
+
+	var values map[string]string
+	var err error
+
+	if strings.HasPrefix(strings.TrimSpace(str_dsn), CONFIG_URI_SCHEME+"://") {
+		values, err = configURIValues(strings.TrimSpace(str_dsn))
+	} else {
+		values, err = dsnValues(str_dsn)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DSN{
+		Tables: make(map[string]string),
+	}
+
+	for _, k := range sortedKeys(values) {
+
+		v := values[k]
+
+		switch k {
+		case DSN_REGION_KEY:
+
+			if !re_region.MatchString(v) {
+				return nil, dsnError(k, v, "expected an AWS region, for example us-east-1")
+			}
+
+			d.Region = v
+
+		case DSN_CREDENTIALS_KEY:
+
+			err = validateDSNCredentials(v)
+
+			if err != nil {
+				return nil, err
+			}
+
+			d.Credentials = v
+
+		case DSN_PROFILE_KEY:
+			d.Profile = v
+
+		case DSN_ENDPOINT_KEY:
+
+			u, err := url.Parse(v)
+
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, dsnError(k, v, "expected an http or https URL, for example http://localhost:8000")
+			}
+
+			d.Endpoint = v
+
+		case DSN_FIPS_KEY, DSN_DUAL_STACK_KEY:
+
+			b, err := strconv.ParseBool(v)
+
+			if err != nil {
+				return nil, dsnError(k, v, "expected true or false")
+			}
+
+			if k == DSN_FIPS_KEY {
+				d.FIPS = &b
+			} else {
+				d.DualStack = &b
+			}
+
+		default:
+
+			if !isDSNTableKey(k) {
+				d.Unknown = append(d.Unknown, k)
+				continue
+			}
+
+			err = validateDSNTable(k, v)
+
+			if err != nil {
+				return nil, err
+			}
+
+			d.Tables[k] = v
+		}
+	}
+
+	if d.Credentials == "" && d.Profile == "" {
+		return nil, dsnError(DSN_CREDENTIALS_KEY, "", fmt.Sprintf("key is missing, assign credentials or a '%s'", DSN_PROFILE_KEY))
+	}
+
+	if d.Credentials != "" && d.Profile != "" {
+		return nil, dsnError(DSN_PROFILE_KEY, "", fmt.Sprintf("the '%s' and '%s' keys can not both be assigned", DSN_PROFILE_KEY, DSN_CREDENTIALS_KEY))
+	}
+
+	if d.Region == "" && d.Profile == "" {
+		return nil, dsnError(DSN_REGION_KEY, "", "key is missing")
+	}
+
+	return d, nil
+}
+
+// dsnValues returns the keys and values in 'str_dsn', a space-separated list of key=value pairs.
+func dsnValues(str_dsn string) (map[string]string, error) {
+
+	pairs := strings.Fields(str_dsn)
+
+	if len(pairs) == 0 {
+		return nil, dsnError("", "", "DSN string is empty")
+	}
+
+	values := make(map[string]string)
+
+	for _, pair := range pairs {
+
+		kv := strings.SplitN(pair, "=", 2)
+
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, dsnError("", "", fmt.Sprintf("'%s' is not a key=value pair", pair))
+		}
+
+		err := addDSNValue(values, kv[0], kv[1])
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// configURIValues returns the keys and values in 'str_uri', a config string of the form
+// aws://{REGION}?credentials={CREDENTIALS}&{KEY}={VALUE} as used by the aaronland/go-aws-auth package. The region
+// is assigned to the DSN_REGION_KEY key and each query parameter to the DSN key of the same name.
+func configURIValues(str_uri string) (map[string]string, error) {
+
+	u, err := url.Parse(str_uri)
+
+	if err != nil {
+		return nil, dsnError("", "", fmt.Sprintf("failed to parse config string, %v", err))
+	}
+
+	if u.Path != "" && u.Path != "/" {
+		return nil, dsnError("", "", fmt.Sprintf("expected a config string of the form %s://{REGION}?%s={CREDENTIALS}", CONFIG_URI_SCHEME, DSN_CREDENTIALS_KEY))
+	}
+
+	values := make(map[string]string)
+
+	if u.Host != "" {
+
+		err := addDSNValue(values, DSN_REGION_KEY, u.Host)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	q, err := url.ParseQuery(u.RawQuery)
+
+	if err != nil {
+		return nil, dsnError("", "", fmt.Sprintf("failed to parse config string query, %v", err))
+	}
+
+	for k, vs := range q {
+
+		if k == "" {
+			return nil, dsnError("", "", "config string has a query parameter without a name")
+		}
+
+		for _, v := range vs {
+
+			err := addDSNValue(values, k, v)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, dsnError("", "", "config string is empty")
+	}
+
+	return values, nil
+}
+
+// addDSNValue assigns 'v' to 'k' in 'values' unless it is empty or 'k' has already been assigned.
+func addDSNValue(values map[string]string, k string, v string) error {
+
+	_, ok := values[k]
+
+	if ok {
+		return dsnError(k, "", "key is assigned more than once")
+	}
+
+	if v == "" {
+		return dsnError(k, "", "value is empty")
+	}
+
+	values[k] = v
+	return nil
+}
+
+// TableName returns the table name assigned by 'key', for example DSN_SUBSCRIPTIONS_TABLE_KEY, or failing that by
+// DSN_TABLE_KEY. The boolean return value is false if neither key is present.
+func (d *DSN) TableName(key string) (string, bool) {
+
+	for _, k := range []string{key, DSN_TABLE_KEY} {
+
+		name, ok := d.Tables[k]
+
+		if ok {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+func validateDSNCredentials(v string) error {
+
+	switch {
+	case v == CONFIG_URI_ANON_CREDENTIALS:
+		return dsnError(DSN_CREDENTIALS_KEY, v, "DynamoDB does not accept anonymous requests")
+	case strings.HasPrefix(v, session.StaticCredentialsPrefix):
+
+		if len(strings.Split(v, ":")) != 4 {
+			return dsnError(DSN_CREDENTIALS_KEY, "", fmt.Sprintf("expected %s", session.StaticCredentialsTemplate))
+		}
+
+	case strings.HasPrefix(v, session.STSCredentialsPrefix):
+
+		if !strings.HasPrefix(strings.TrimPrefix(v, session.STSCredentialsPrefix), "arn:") {
+			return dsnError(DSN_CREDENTIALS_KEY, v, fmt.Sprintf("expected %s{ROLE_ARN}", session.STSCredentialsPrefix))
+		}
+	}
+
+	return nil
+}
+
+func validateDSNTable(key string, v string) error {
+
+	name := v
+
+	if isTableArn(v) {
+
+		arn, err := parseTableArn(v)
+
+		if err != nil {
+			return dsnError(key, v, "expected the ARN of a DynamoDB table")
+		}
+
+		name = arn.Table
+	}
+
+	// lengths are checked, once the TablePrefix and TableSuffix options are applied, when the options are validated
+
+	if !re_tablename.MatchString(name) {
+		return dsnError(key, v, "expected a table name of letters, numbers, '_', '-' and '.'")
+	}
+
+	return nil
+}
+
+func isDSNTableKey(key string) bool {
+
+	for _, k := range dsnTableKeys {
+
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(values map[string]string) []string {
+
+	keys := make([]string, 0, len(values))
+
+	for k := range values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// NewSessionWithDSN returns a new AWS session for 'str_dsn', which is parsed with `ParseDSN`. If the DSN has a
+// DSN_PROFILE_KEY key the session is created from that profile in the shared AWS configuration files (~/.aws/config
+// and ~/.aws/credentials), which supports AWS SSO (IAM Identity Center) profiles, refreshing their tokens as needed,
+// as well as assumed roles and credential processes, and the profile's region is used unless the DSN has a "region"
+// key. Otherwise the session is created by the aaronland/go-aws-session package from the DSN's credentials and region.
+func NewSessionWithDSN(str_dsn string) (*aws_session.Session, error) {
+
+	d, err := ParseDSN(str_dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return d.newSession()
+}
+
+// newSessionWithDSNSettings returns a new AWS session for 'str_dsn', as `NewSessionWithDSN` does, and assigns the
+// table name for 'key' and the endpoint settings in 'str_dsn' to 's'. See `applySettings`.
+func newSessionWithDSNSettings(str_dsn string, key string, s *tableSettings) (*aws_session.Session, error) {
+
+	d, err := ParseDSN(str_dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d.applySettings(key, s)
+
+	return d.newSession()
+}
+
+// newSession returns a new AWS session for 'd'. See `NewSessionWithDSN`.
+func (d *DSN) newSession() (*aws_session.Session, error) {
+
+	if d.Profile == "" {
+		return session.NewSessionWithCredentials(d.Credentials, d.Region)
+	}
+
+	cfg := aws.NewConfig()
+
+	if d.Region != "" {
+		cfg = cfg.WithRegion(d.Region)
+	}
+
+	sess, err := aws_session.NewSessionWithOptions(aws_session.Options{
+		Config:            *cfg,
+		Profile:           d.Profile,
+		SharedConfigState: aws_session.SharedConfigEnable,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create session for profile '%s', %w", d.Profile, err)
+	}
+
+	// credentials are derived now, as they are by go-aws-session, so that an expired SSO login (which is
+	// renewed with `aws sso login`) is reported when the database is created rather than by its first request
+
+	_, err = sess.Config.Credentials.Get()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive credentials for profile '%s', %w", d.Profile, err)
+	}
+
+	return sess, nil
+}
+
+// applySettings assigns the table name defined in 'd' by 'key' or, failing that, by the generic DSN_TABLE_KEY and
+// the DSN_ENDPOINT_KEY, DSN_FIPS_KEY and DSN_DUAL_STACK_KEY values to 's', the settings of the caller's options, so
+// that the options report the table and endpoint that are actually used. Values absent from 'd' are left unchanged.
+func (d *DSN) applySettings(key string, s *tableSettings) {
+
+	name, ok := d.TableName(key)
+
+	if ok {
+		*s.TableName = name
+	}
+
+	if d.Endpoint != "" {
+		*s.Endpoint = d.Endpoint
+	}
+
+	if d.FIPS != nil {
+		*s.UseFIPSEndpoint = *d.FIPS
+	}
+
+	if d.DualStack != nil {
+		*s.UseDualStackEndpoint = *d.DualStack
+	}
+}
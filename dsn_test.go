@@ -0,0 +1,165 @@
+package dynamodb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseDSN(t *testing.T) {
+
+	tests := []struct {
+		name string
+		dsn  string
+		// key is the DSNError.Key expected if 'dsn' is invalid
+		key     string
+		invalid bool
+	}{
+		{name: "valid", dsn: "region=us-east-1 credentials=iam:"},
+		{name: "valid profile without region", dsn: "profile=sso"},
+		{name: "valid static credentials", dsn: "region=us-east-1 credentials=static:id:key:secret"},
+		{name: "valid endpoint", dsn: "region=us-east-1 credentials=iam: endpoint=http://localhost:8000"},
+		{name: "valid tables", dsn: "region=us-east-1 credentials=iam: table=subs subscriptions-table=arn:aws:dynamodb:us-west-2:123456789012:table/subs"},
+		{name: "valid flags", dsn: "region=us-east-1 credentials=iam: fips=true dual-stack=0"},
+		{name: "valid config uri", dsn: "aws://us-east-1?credentials=iam:&table=subs"},
+		{name: "empty", dsn: " ", invalid: true},
+		{name: "not a pair", dsn: "region=us-east-1 credentials", invalid: true},
+		{name: "unknown key", dsn: "region=us-east-1 credentials=iam: colour=blue"},
+		{name: "duplicate key", dsn: "region=us-east-1 region=us-west-2 credentials=iam:", key: DSN_REGION_KEY, invalid: true},
+		{name: "empty value", dsn: "region= credentials=iam:", key: DSN_REGION_KEY, invalid: true},
+		{name: "bad region", dsn: "region=US_EAST_1 credentials=iam:", key: DSN_REGION_KEY, invalid: true},
+		{name: "missing region", dsn: "credentials=iam:", key: DSN_REGION_KEY, invalid: true},
+		{name: "missing credentials", dsn: "region=us-east-1", key: DSN_CREDENTIALS_KEY, invalid: true},
+		{name: "credentials and profile", dsn: "region=us-east-1 credentials=iam: profile=sso", key: DSN_PROFILE_KEY, invalid: true},
+		{name: "anonymous credentials", dsn: "region=us-east-1 credentials=anon:", key: DSN_CREDENTIALS_KEY, invalid: true},
+		{name: "short static credentials", dsn: "region=us-east-1 credentials=static:id:key", key: DSN_CREDENTIALS_KEY, invalid: true},
+		{name: "sts credentials without arn", dsn: "region=us-east-1 credentials=sts:role", key: DSN_CREDENTIALS_KEY, invalid: true},
+		{name: "endpoint without scheme", dsn: "region=us-east-1 credentials=iam: endpoint=localhost:8000", key: DSN_ENDPOINT_KEY, invalid: true},
+		{name: "endpoint with bad scheme", dsn: "region=us-east-1 credentials=iam: endpoint=ftp://localhost", key: DSN_ENDPOINT_KEY, invalid: true},
+		{name: "endpoint without host", dsn: "region=us-east-1 credentials=iam: endpoint=http://", key: DSN_ENDPOINT_KEY, invalid: true},
+		{name: "bad flag", dsn: "region=us-east-1 credentials=iam: fips=maybe", key: DSN_FIPS_KEY, invalid: true},
+		{name: "bad table name", dsn: "region=us-east-1 credentials=iam: table=subs!", key: DSN_TABLE_KEY, invalid: true},
+		{name: "bad table arn", dsn: "region=us-east-1 credentials=iam: history-table=arn:aws:s3:::bucket", key: DSN_HISTORY_TABLE_KEY, invalid: true},
+		{name: "config uri with path", dsn: "aws://us-east-1/path?credentials=iam:", invalid: true},
+		{name: "config uri without credentials", dsn: "aws://us-east-1", key: DSN_CREDENTIALS_KEY, invalid: true},
+		{name: "config uri with anonymous credentials", dsn: "aws://us-east-1?credentials=anon:", key: DSN_CREDENTIALS_KEY, invalid: true},
+		{name: "config uri with unknown key", dsn: "aws://us-east-1?credentials=iam:&colour=blue"},
+		{name: "config uri with duplicate key", dsn: "aws://us-east-1?credentials=iam:&region=us-west-2", key: DSN_REGION_KEY, invalid: true},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			_, err := ParseDSN(test.dsn)
+
+			if !test.invalid {
+
+				if err != nil {
+					t.Fatalf("Failed to parse '%s', %v", test.dsn, err)
+				}
+
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Expected '%s' to be invalid", test.dsn)
+			}
+
+			if !errors.Is(err, ErrInvalidDSN) {
+				t.Fatalf("Expected ErrInvalidDSN parsing '%s', got %v", test.dsn, err)
+			}
+
+			var dsn_err *DSNError
+
+			if !errors.As(err, &dsn_err) {
+				t.Fatalf("Expected DSNError parsing '%s', got %T", test.dsn, err)
+			}
+
+			if dsn_err.Key != test.key {
+				t.Fatalf("Expected error for key '%s' parsing '%s', got '%s' (%v)", test.key, test.dsn, dsn_err.Key, err)
+			}
+		})
+	}
+}
+
+func TestParseDSNValues(t *testing.T) {
+
+	d, err := ParseDSN("aws://us-west-2?credentials=iam:&endpoint=http://localhost:8000&fips=true&table=default&subscriptions-table=subs")
+
+	if err != nil {
+		t.Fatalf("Failed to parse config string, %v", err)
+	}
+
+	if d.Region != "us-west-2" || d.Credentials != "iam:" || d.Endpoint != "http://localhost:8000" {
+		t.Fatalf("Unexpected DSN %v", d)
+	}
+
+	if d.FIPS == nil || !*d.FIPS || d.DualStack != nil {
+		t.Fatalf("Unexpected endpoint flags %v, %v", d.FIPS, d.DualStack)
+	}
+
+	tests := map[string]string{
+		DSN_SUBSCRIPTIONS_TABLE_KEY: "subs",
+		DSN_HISTORY_TABLE_KEY:       "default",
+	}
+
+	for key, expected := range tests {
+
+		name, ok := d.TableName(key)
+
+		if !ok || name != expected {
+			t.Fatalf("Expected table name %s for %s, got %s", expected, key, name)
+		}
+	}
+}
+
+func TestParseDSNUnknown(t *testing.T) {
+
+	// keys shared with other consumers of the same DSN are ignored, as they are by go-aws-session
+
+	d, err := ParseDSN("region=us-east-1 credentials=iam: table=subs size=2 colour=blue")
+
+	if err != nil {
+		t.Fatalf("Failed to parse DSN with unknown keys, %v", err)
+	}
+
+	if len(d.Unknown) != 2 || d.Unknown[0] != "colour" || d.Unknown[1] != "size" {
+		t.Fatalf("Unexpected unknown keys %v", d.Unknown)
+	}
+
+	if len(d.Tables) != 1 {
+		t.Fatalf("Unexpected tables %v", d.Tables)
+	}
+}
+
+func TestDSNApplySettings(t *testing.T) {
+
+	d, err := ParseDSN("region=us-east-1 credentials=iam: table=other subscriptions-table=subs endpoint=http://localhost:8000 fips=true")
+
+	if err != nil {
+		t.Fatalf("Failed to parse DSN, %v", err)
+	}
+
+	opts := DefaultDynamoDBSubscriptionsDatabaseOptions()
+	opts.TablePrefix = "prod_"
+
+	d.applySettings(DSN_SUBSCRIPTIONS_TABLE_KEY, opts.settings())
+
+	// the DSN's settings are assigned to the caller's options so that they report the table actually used
+
+	if opts.FullTableName() != "prod_subs" {
+		t.Fatalf("Unexpected table name %s", opts.FullTableName())
+	}
+
+	if opts.Endpoint != "http://localhost:8000" || !opts.UseFIPSEndpoint || opts.UseDualStackEndpoint {
+		t.Fatalf("Unexpected endpoint settings %s, %t, %t", opts.Endpoint, opts.UseFIPSEndpoint, opts.UseDualStackEndpoint)
+	}
+
+	conf_opts := DefaultDynamoDBConfirmationsDatabaseOptions()
+
+	d.applySettings(DSN_CONFIRMATIONS_TABLE_KEY, conf_opts.settings())
+
+	if conf_opts.FullTableName() != "other" {
+		t.Fatalf("Expected the generic table key to be used, got %s", conf_opts.FullTableName())
+	}
+}
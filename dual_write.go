@@ -0,0 +1,159 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/database"
+	"github.com/aaronland/go-mailinglist/subscription"
+)
+
+// MismatchFunc is a callback function invoked when the subscription for 'addr' read from the secondary database
+// of a `DualWriteSubscriptionsDatabase` differs from the one read from the primary database. Either subscription
+// is nil if there is no subscription for 'addr' in that database.
+type MismatchFunc func(addr string, primary *subscription.Subscription, secondary *subscription.Subscription)
+
+// SecondaryErrorFunc is a callback function invoked when writing 'sub' to the secondary database of a
+// `DualWriteSubscriptionsDatabase` with the method 'op', for example "AddSubscription", fails with 'err'.
+type SecondaryErrorFunc func(op string, sub *subscription.Subscription, err error)
+
+type DualWriteOptions struct {
+	// CompareReads reads each subscription requested with `GetSubscriptionWithAddress` from the secondary database
+	// as well, invoking MismatchFunc if they differ.
+	CompareReads bool
+	// MismatchFunc is an optional callback invoked, if CompareReads is set, when a subscription differs between the
+	// databases, for example to log it.
+	MismatchFunc MismatchFunc
+	// SecondaryErrorFunc is an optional callback invoked when a write to the secondary database fails. If set the
+	// error is passed to it instead of being returned, so that the secondary database can not disrupt the primary.
+	SecondaryErrorFunc SecondaryErrorFunc
+}
+
+// DualWriteSubscriptionsDatabase is a `database.SubscriptionsDatabase` which writes every change to two databases,
+// for example a SQL database being migrated from and a `DynamoDBSubscriptionsDatabase` being migrated to, and
+// reads from the primary one. Changes are written to the primary database first and, only if that succeeds, to
+// the secondary database. Once the secondary database has been backfilled (see cmd/migrate-from-sql) and reads
+// no longer differ the databases can be swapped, and eventually the old one dropped, without downtime.
+type DualWriteSubscriptionsDatabase struct {
+	database.SubscriptionsDatabase
+	primary   database.SubscriptionsDatabase
+	secondary database.SubscriptionsDatabase
+	options   *DualWriteOptions
+}
+
+// NewDualWriteSubscriptionsDatabase returns a new `DualWriteSubscriptionsDatabase` which writes to 'primary' and
+// 'secondary' and reads from 'primary'. 'opts' may be nil.
+func NewDualWriteSubscriptionsDatabase(primary database.SubscriptionsDatabase, secondary database.SubscriptionsDatabase, opts *DualWriteOptions) (*DualWriteSubscriptionsDatabase, error) {
+
+	if primary == nil || secondary == nil {
+		return nil, errors.New("Both a primary and a secondary database are required")
+	}
+
+	if opts == nil {
+		opts = &DualWriteOptions{}
+	}
+
+	db := &DualWriteSubscriptionsDatabase{
+		primary:   primary,
+		secondary: secondary,
+		options:   opts,
+	}
+
+	return db, nil
+}
+
+func (db *DualWriteSubscriptionsDatabase) AddSubscription(sub *subscription.Subscription) error {
+
+	err := db.primary.AddSubscription(sub)
+
+	if err != nil {
+		return err
+	}
+
+	return db.secondaryError("AddSubscription", sub, db.secondary.AddSubscription(sub))
+}
+
+func (db *DualWriteSubscriptionsDatabase) UpdateSubscription(sub *subscription.Subscription) error {
+
+	err := db.primary.UpdateSubscription(sub)
+
+	if err != nil {
+		return err
+	}
+
+	return db.secondaryError("UpdateSubscription", sub, db.secondary.UpdateSubscription(sub))
+}
+
+func (db *DualWriteSubscriptionsDatabase) RemoveSubscription(sub *subscription.Subscription) error {
+
+	err := db.primary.RemoveSubscription(sub)
+
+	if err != nil {
+		return err
+	}
+
+	return db.secondaryError("RemoveSubscription", sub, db.secondary.RemoveSubscription(sub))
+}
+
+func (db *DualWriteSubscriptionsDatabase) GetSubscriptionWithAddress(addr string) (*subscription.Subscription, error) {
+
+	sub, err := db.primary.GetSubscriptionWithAddress(addr)
+
+	if err != nil && !database.IsNotExist(err) {
+		return nil, err
+	}
+
+	if db.options.CompareReads {
+
+		// comparisons are best-effort so a failure to read the secondary database is not an error
+
+		other, other_err := db.secondary.GetSubscriptionWithAddress(addr)
+
+		if other_err == nil || database.IsNotExist(other_err) {
+			db.compare(addr, sub, other)
+		}
+	}
+
+	return sub, err
+}
+
+func (db *DualWriteSubscriptionsDatabase) ListSubscriptions(ctx context.Context, callback database.ListSubscriptionsFunc) error {
+	return db.primary.ListSubscriptions(ctx, callback)
+}
+
+func (db *DualWriteSubscriptionsDatabase) ListSubscriptionsWithStatus(ctx context.Context, callback database.ListSubscriptionsFunc, status ...int) error {
+	return db.primary.ListSubscriptionsWithStatus(ctx, callback, status...)
+}
+
+func (db *DualWriteSubscriptionsDatabase) secondaryError(op string, sub *subscription.Subscription, err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	if db.options.SecondaryErrorFunc != nil {
+		db.options.SecondaryErrorFunc(op, sub, err)
+		return nil
+	}
+
+	return fmt.Errorf("Failed to write subscription for %s to secondary database, %w", sub.Address, err)
+}
+
+func (db *DualWriteSubscriptionsDatabase) compare(addr string, primary *subscription.Subscription, secondary *subscription.Subscription) {
+
+	if db.options.MismatchFunc == nil || subscriptionsEqual(primary, secondary) {
+		return
+	}
+
+	db.options.MismatchFunc(addr, primary, secondary)
+}
+
+// subscriptionsEqual reports whether 'a' and 'b', either of which may be nil, have the same properties.
+func subscriptionsEqual(a *subscription.Subscription, b *subscription.Subscription) bool {
+
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Address == b.Address && a.Status == b.Status && a.Created == b.Created && a.Confirmed == b.Confirmed && a.LastModified == b.LastModified
+}
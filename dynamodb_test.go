@@ -0,0 +1,13 @@
+package dynamodb_test
+
+import (
+	"github.com/aaronland/go-mailinglist-database-dynamodb/dynamodbtest"
+	"testing"
+)
+
+// TestDynamoDB runs the dynamodbtest suite against DynamoDB Local. It is skipped if there is no DynamoDB Local
+// endpoint, DynamoDBLocal.jar or docker available; see the dynamodbtest package for details. The package's other
+// tests are unit tests which use fake clients and always run.
+func TestDynamoDB(t *testing.T) {
+	dynamodbtest.RunSuite(t, dynamodbtest.New(t))
+}
@@ -0,0 +1,471 @@
+// package dynamodbtest provides a harness for running the go-mailinglist-database-dynamodb databases against
+// DynamoDB Local, and a suite of integration tests exercising them, for use in tests.
+//
+// DynamoDB Local is located, in order of preference, using:
+//
+//   - An existing endpoint defined by the DYNAMODB_LOCAL_ENDPOINT environment variable (or Options.Endpoint).
+//   - A local copy of DynamoDBLocal.jar defined by the DYNAMODB_LOCAL_JAR environment variable (or Options.JarPath),
+//     which is run using `java`.
+//   - The amazon/dynamodb-local Docker image, which is run using `docker`.
+//
+// For example:
+//
+//	func TestDatabases(t *testing.T) {
+//		h := dynamodbtest.New(t)
+//		dynamodbtest.RunSuite(t, h)
+//	}
+package dynamodbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// DEFAULT_IMAGE is the Docker image used to run DynamoDB Local.
+const DEFAULT_IMAGE string = "amazon/dynamodb-local:latest"
+
+// ENDPOINT_ENV is the environment variable used to define an existing DynamoDB Local endpoint.
+const ENDPOINT_ENV string = "DYNAMODB_LOCAL_ENDPOINT"
+
+// JAR_ENV is the environment variable used to define the path to a local copy of DynamoDBLocal.jar.
+const JAR_ENV string = "DYNAMODB_LOCAL_JAR"
+
+// ErrUnavailable is returned (wrapped) when there is no way to run DynamoDB Local.
+var ErrUnavailable = errors.New("DynamoDB Local is not available")
+
+// Options defines options for starting a `Harness`.
+type Options struct {
+	// Endpoint is the URL of an existing DynamoDB Local instance. If empty the ENDPOINT_ENV environment variable is checked.
+	Endpoint string
+	// JarPath is the path to DynamoDBLocal.jar. If empty the JAR_ENV environment variable is checked.
+	JarPath string
+	// Image is the Docker image used to run DynamoDB Local. If empty DEFAULT_IMAGE is used.
+	Image string
+	// TablePrefix is prepended to every table name. If empty a random prefix is used so that harnesses sharing
+	// an endpoint do not collide with one another.
+	TablePrefix string
+	// StartTimeout is how long to wait for DynamoDB Local to start accepting requests. If zero 30 seconds is used.
+	StartTimeout time.Duration
+}
+
+// Harness is a running DynamoDB Local instance with the tables for each database created.
+type Harness struct {
+	Endpoint          string
+	Session           *aws_session.Session
+	Subscriptions     *dynamodb.DynamoDBSubscriptionsDatabase
+	Confirmations     *dynamodb.DynamoDBConfirmationsDatabase
+	EventLogs         *dynamodb.DynamoDBEventLogsDatabase
+	Deliveries        *dynamodb.DynamoDBDeliveriesDatabase
+	UnsubscribeTokens *dynamodb.DynamoDBUnsubscribeTokensDatabase
+	SendQueue         *dynamodb.DynamoDBSendQueue
+	DeadLetters       *dynamodb.DynamoDBDeadLettersDatabase
+	History           *dynamodb.DynamoDBHistoryDatabase
+	Stats             *dynamodb.DynamoDBStatsDatabase
+	TablePrefix       string
+	stop              func() error
+}
+
+// New starts a new `Harness` with default options, skipping the test if DynamoDB Local is not available and
+// stopping the harness when the test completes.
+func New(t testing.TB) *Harness {
+
+	t.Helper()
+
+	h, err := Start(context.Background(), &Options{})
+
+	if errors.Is(err, ErrUnavailable) {
+		t.Skipf("Skipping DynamoDB Local tests, %v", err)
+	}
+
+	if err != nil {
+		t.Fatalf("Failed to start DynamoDB Local harness, %v", err)
+	}
+
+	t.Cleanup(func() {
+
+		err := h.Close()
+
+		if err != nil {
+			t.Logf("Failed to stop DynamoDB Local harness, %v", err)
+		}
+	})
+
+	return h
+}
+
+// Start starts (or connects to) DynamoDB Local, creates the tables for each database and returns a new `Harness`.
+func Start(ctx context.Context, opts *Options) (*Harness, error) {
+
+	endpoint, stop, err := startDynamoDBLocal(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := newHarness(ctx, endpoint, opts)
+
+	if err != nil {
+		stop()
+		return nil, err
+	}
+
+	h.stop = stop
+	return h, nil
+}
+
+// Close deletes the harness's tables and stops DynamoDB Local if the harness started it.
+func (h *Harness) Close() error {
+
+	client := aws_dynamodb.New(h.Session)
+
+	for _, name := range h.tableNames() {
+
+		_, err := client.DeleteTable(&aws_dynamodb.DeleteTableInput{
+			TableName: aws.String(h.TablePrefix + name),
+		})
+
+		if err != nil {
+
+			aws_err, ok := err.(awserr.Error)
+
+			if !ok || aws_err.Code() != aws_dynamodb.ErrCodeResourceNotFoundException {
+				return fmt.Errorf("Failed to delete %s table, %w", name, err)
+			}
+		}
+	}
+
+	if h.stop != nil {
+		return h.stop()
+	}
+
+	return nil
+}
+
+func (h *Harness) tableNames() []string {
+
+	return []string{
+		dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME,
+		dynamodb.CONFIRMATIONS_DEFAULT_TABLENAME,
+		dynamodb.EVENTLOGS_DEFAULT_TABLENAME,
+		dynamodb.DELIVERIES_DEFAULT_TABLENAME,
+		dynamodb.UNSUBSCRIBE_TOKENS_DEFAULT_TABLENAME,
+		dynamodb.SEND_QUEUE_DEFAULT_TABLENAME,
+		dynamodb.DEAD_LETTERS_DEFAULT_TABLENAME,
+		dynamodb.HISTORY_DEFAULT_TABLENAME,
+		dynamodb.STATS_DEFAULT_TABLENAME,
+	}
+}
+
+func newHarness(ctx context.Context, endpoint string, opts *Options) (*Harness, error) {
+
+	cfg := aws.NewConfig().
+		WithEndpoint(endpoint).
+		WithRegion("us-east-1").
+		WithCredentials(credentials.NewStaticCredentials("local", "local", ""))
+
+	sess, err := aws_session.NewSession(cfg)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create session, %w", err)
+	}
+
+	timeout := opts.StartTimeout
+
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	err = waitForEndpoint(ctx, sess, timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := opts.TablePrefix
+
+	if prefix == "" {
+
+		b := make([]byte, 4)
+
+		_, err := rand.Read(b)
+
+		if err != nil {
+			return nil, err
+		}
+
+		prefix = fmt.Sprintf("test_%s_", hex.EncodeToString(b))
+	}
+
+	h := &Harness{
+		Endpoint:    endpoint,
+		Session:     sess,
+		TablePrefix: prefix,
+	}
+
+	subs_opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	subs_opts.TablePrefix = prefix
+	subs_opts.CreateTable = true
+
+	conf_opts := dynamodb.DefaultDynamoDBConfirmationsDatabaseOptions()
+	conf_opts.TablePrefix = prefix
+	conf_opts.CreateTable = true
+
+	logs_opts := dynamodb.DefaultDynamoDBEventLogsDatabaseOptions()
+	logs_opts.TablePrefix = prefix
+	logs_opts.CreateTable = true
+
+	dlvr_opts := dynamodb.DefaultDynamoDBDeliveriesDatabaseOptions()
+	dlvr_opts.TablePrefix = prefix
+	dlvr_opts.CreateTable = true
+
+	tokens_opts := dynamodb.DefaultDynamoDBUnsubscribeTokensDatabaseOptions()
+	tokens_opts.TablePrefix = prefix
+	tokens_opts.CreateTable = true
+
+	queue_opts := dynamodb.DefaultDynamoDBSendQueueOptions()
+	queue_opts.TablePrefix = prefix
+	queue_opts.CreateTable = true
+
+	dead_opts := dynamodb.DefaultDynamoDBDeadLettersDatabaseOptions()
+	dead_opts.TablePrefix = prefix
+	dead_opts.CreateTable = true
+
+	history_opts := dynamodb.DefaultDynamoDBHistoryDatabaseOptions()
+	history_opts.TablePrefix = prefix
+	history_opts.CreateTable = true
+
+	stats_opts := dynamodb.DefaultDynamoDBStatsDatabaseOptions()
+	stats_opts.TablePrefix = prefix
+	stats_opts.CreateTable = true
+
+	h.UnsubscribeTokens, err = dynamodb.NewDynamoDBUnsubscribeTokensDatabaseWithSession(sess, tokens_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create unsubscribe tokens database, %w", err)
+	}
+
+	h.History, err = dynamodb.NewDynamoDBHistoryDatabaseWithSession(sess, history_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create history database, %w", err)
+	}
+
+	h.Confirmations, err = dynamodb.NewConfirmationsDatabaseWithSession(sess, conf_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create confirmations database, %w", err)
+	}
+
+	subs_opts.UnsubscribeTokens = h.UnsubscribeTokens
+	subs_opts.Confirmations = h.Confirmations
+	subs_opts.History = h.History
+
+	h.Subscriptions, err = dynamodb.NewSubscriptionsDatabaseWithSession(sess, subs_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create subscriptions database, %w", err)
+	}
+
+	h.EventLogs, err = dynamodb.NewEventLogsDatabaseWithSession(sess, logs_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create event logs database, %w", err)
+	}
+
+	h.Deliveries, err = dynamodb.NewDeliveriesDatabaseWithSession(sess, dlvr_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create deliveries database, %w", err)
+	}
+
+	h.SendQueue, err = dynamodb.NewDynamoDBSendQueueWithSession(sess, queue_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create send queue, %w", err)
+	}
+
+	h.DeadLetters, err = dynamodb.NewDynamoDBDeadLettersDatabaseWithSession(sess, dead_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create dead letters database, %w", err)
+	}
+
+	h.Stats, err = dynamodb.NewDynamoDBStatsDatabaseWithSession(sess, stats_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create stats database, %w", err)
+	}
+
+	client := aws_dynamodb.New(sess)
+
+	for _, name := range h.tableNames() {
+
+		err := client.WaitUntilTableExistsWithContext(ctx, &aws_dynamodb.DescribeTableInput{
+			TableName: aws.String(prefix + name),
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed waiting for %s table, %w", prefix+name, err)
+		}
+	}
+
+	return h, nil
+}
+
+// startDynamoDBLocal returns the endpoint of a DynamoDB Local instance and a function to stop it.
+func startDynamoDBLocal(opts *Options) (string, func() error, error) {
+
+	noop := func() error { return nil }
+
+	endpoint := opts.Endpoint
+
+	if endpoint == "" {
+		endpoint = os.Getenv(ENDPOINT_ENV)
+	}
+
+	if endpoint != "" {
+		return endpoint, noop, nil
+	}
+
+	jar := opts.JarPath
+
+	if jar == "" {
+		jar = os.Getenv(JAR_ENV)
+	}
+
+	if jar != "" {
+		return startJar(jar)
+	}
+
+	image := opts.Image
+
+	if image == "" {
+		image = DEFAULT_IMAGE
+	}
+
+	return startDocker(image)
+}
+
+func startJar(jar string) (string, func() error, error) {
+
+	java, err := exec.LookPath("java")
+
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to find java to run %s, %w", jar, ErrUnavailable)
+	}
+
+	port, err := freePort()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	abs_jar, err := filepath.Abs(jar)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	lib := filepath.Join(filepath.Dir(abs_jar), "DynamoDBLocal_lib")
+
+	cmd := exec.Command(java, "-Djava.library.path="+lib, "-jar", abs_jar, "-inMemory", "-port", fmt.Sprintf("%d", port))
+
+	err = cmd.Start()
+
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to start DynamoDB Local, %w", err)
+	}
+
+	stop := func() error {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil
+	}
+
+	return fmt.Sprintf("http://127.0.0.1:%d", port), stop, nil
+}
+
+func startDocker(image string) (string, func() error, error) {
+
+	docker, err := exec.LookPath("docker")
+
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to find docker, %w", ErrUnavailable)
+	}
+
+	out, err := exec.Command(docker, "run", "-d", "--rm", "-p", "127.0.0.1::8000", image, "-jar", "DynamoDBLocal.jar", "-inMemory").Output()
+
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to start %s container (%v), %w", image, err, ErrUnavailable)
+	}
+
+	id := strings.TrimSpace(string(out))
+
+	stop := func() error {
+		return exec.Command(docker, "stop", id).Run()
+	}
+
+	out, err = exec.Command(docker, "port", id, "8000/tcp").Output()
+
+	if err != nil {
+		stop()
+		return "", nil, fmt.Errorf("Failed to determine port for container %s, %w", id, err)
+	}
+
+	// docker port may report more than one binding, one per line
+	addr := strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)[0]
+
+	return "http://" + addr, stop, nil
+}
+
+func freePort() (int, error) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func waitForEndpoint(ctx context.Context, sess *aws_session.Session, timeout time.Duration) error {
+
+	client := aws_dynamodb.New(sess, aws.NewConfig().WithMaxRetries(0))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+
+		_, err := client.ListTablesWithContext(ctx, &aws_dynamodb.ListTablesInput{})
+
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Timed out waiting for DynamoDB Local, %w", err)
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
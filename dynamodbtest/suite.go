@@ -0,0 +1,1513 @@
+package dynamodbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	"github.com/aaronland/go-mailinglist/delivery"
+	"github.com/aaronland/go-mailinglist/eventlog"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"sort"
+	"testing"
+	"time"
+)
+
+// RunSuite runs the integration test suite against the databases in 'h', exercising each of their methods.
+// Each database's tests are run as a subtest. The suite writes records to, and removes them from, the
+// harness's tables so it should be run against a freshly started `Harness`.
+func RunSuite(t *testing.T, h *Harness) {
+
+	t.Run("Subscriptions", func(t *testing.T) { TestSubscriptions(t, h) })
+	t.Run("Confirmations", func(t *testing.T) { TestConfirmations(t, h) })
+	t.Run("EventLogs", func(t *testing.T) { TestEventLogs(t, h) })
+	t.Run("Deliveries", func(t *testing.T) { TestDeliveries(t, h) })
+	t.Run("UnsubscribeTokens", func(t *testing.T) { TestUnsubscribeTokens(t, h) })
+	t.Run("SendQueue", func(t *testing.T) { TestSendQueue(t, h) })
+	t.Run("DeadLetters", func(t *testing.T) { TestDeadLetters(t, h) })
+	t.Run("History", func(t *testing.T) { TestHistory(t, h) })
+	t.Run("Stats", func(t *testing.T) { TestStats(t, h) })
+	t.Run("BatchWriter", func(t *testing.T) { TestBatchWriter(t, h) })
+}
+
+// TestSubscriptions exercises the methods of the subscriptions database in 'h'.
+func TestSubscriptions(t *testing.T, h *Harness) {
+
+	ctx := context.Background()
+	db := h.Subscriptions
+
+	addrs := []string{
+		"alice@example.com",
+		"bob@example.com",
+		"carol@example.com",
+	}
+
+	for _, addr := range addrs {
+
+		sub := mustSubscription(t, addr)
+
+		err := db.AddSubscription(sub)
+
+		if err != nil {
+			t.Fatalf("Failed to add subscription for %s, %v", addr, err)
+		}
+	}
+
+	err := db.AddSubscription(mustSubscription(t, addrs[0]))
+
+	if !errors.Is(err, dynamodb.ErrAlreadyExists) {
+		t.Fatalf("Expected ErrAlreadyExists adding duplicate subscription, got %v", err)
+	}
+
+	invalid := mustSubscription(t, "erin@example.com")
+	invalid.Address = "Erin <erin@example.com>"
+
+	err = db.AddSubscription(invalid)
+
+	if !errors.Is(err, dynamodb.ErrInvalid) {
+		t.Fatalf("Expected ErrInvalid adding subscription with invalid address, got %v", err)
+	}
+
+	retried := mustSubscription(t, "dave@example.com")
+
+	for i := 0; i < 2; i++ {
+
+		err := db.AddSubscriptionWithIdempotencyToken(ctx, retried, "token-1")
+
+		if err != nil {
+			t.Fatalf("Failed to add subscription with idempotency token (attempt %d), %v", i+1, err)
+		}
+	}
+
+	err = db.AddSubscriptionWithIdempotencyToken(ctx, retried, "token-2")
+
+	if !errors.Is(err, dynamodb.ErrAlreadyExists) {
+		t.Fatalf("Expected ErrAlreadyExists adding subscription with a different idempotency token, got %v", err)
+	}
+
+	err = db.RemoveSubscription(retried)
+
+	if err != nil {
+		t.Fatalf("Failed to remove subscription for %s, %v", retried.Address, err)
+	}
+
+	sub, err := db.GetSubscriptionWithAddress(addrs[0])
+
+	if err != nil {
+		t.Fatalf("Failed to get subscription for %s, %v", addrs[0], err)
+	}
+
+	if sub.Address != addrs[0] {
+		t.Fatalf("Unexpected address %s, expected %s", sub.Address, addrs[0])
+	}
+
+	_, err = db.GetSubscriptionWithAddress("nobody@example.com")
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error for missing subscription, got %v", err)
+	}
+
+	sub.Confirm()
+
+	err = db.UpdateSubscription(sub)
+
+	if err != nil {
+		t.Fatalf("Failed to update subscription for %s, %v", sub.Address, err)
+	}
+
+	sub, err = db.GetSubscriptionWithAddress(addrs[0])
+
+	if err != nil {
+		t.Fatalf("Failed to get updated subscription for %s, %v", addrs[0], err)
+	}
+
+	if sub.Status != subscription.SUBSCRIPTION_STATUS_ENABLED || sub.Confirmed == 0 {
+		t.Fatalf("Subscription for %s was not updated", addrs[0])
+	}
+
+	err = db.UpdateSubscriptionIfUnchanged(ctx, sub, sub.LastModified)
+
+	if err != nil {
+		t.Fatalf("Failed to update unchanged subscription for %s, %v", sub.Address, err)
+	}
+
+	err = db.UpdateSubscriptionIfUnchanged(ctx, sub, sub.LastModified-1)
+
+	if !errors.Is(err, dynamodb.ErrConflict) {
+		t.Fatalf("Expected ErrConflict updating subscription with a stale lastmodified time, got %v", err)
+	}
+
+	missing := mustSubscription(t, "nobody@example.com")
+
+	err = db.UpdateSubscriptionIfUnchanged(ctx, missing, missing.LastModified)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error updating missing subscription, got %v", err)
+	}
+
+	opened := time.Now()
+
+	err = db.RecordActivity(ctx, addrs[0], dynamodb.ACTIVITY_OPEN, opened)
+
+	if err != nil {
+		t.Fatalf("Failed to record activity for %s, %v", addrs[0], err)
+	}
+
+	err = db.RecordActivity(ctx, "nobody@example.com", dynamodb.ACTIVITY_OPEN, opened)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error recording activity for missing subscription, got %v", err)
+	}
+
+	err = db.UpdateSubscription(sub)
+
+	if err != nil {
+		t.Fatalf("Failed to update subscription for %s, %v", sub.Address, err)
+	}
+
+	activity, err := db.GetSubscriptionActivity(ctx, addrs[0])
+
+	if err != nil {
+		t.Fatalf("Failed to get activity for %s, %v", addrs[0], err)
+	}
+
+	if activity.LastOpen != opened.Unix() {
+		t.Fatalf("Unexpected last open time %d for %s, expected %d", activity.LastOpen, addrs[0], opened.Unix())
+	}
+
+	disabled := subscription.SUBSCRIPTION_STATUS_DISABLED
+
+	err = db.UpdateSubscriptionFields(ctx, addrs[0], &dynamodb.SubscriptionUpdate{Status: &disabled})
+
+	if err != nil {
+		t.Fatalf("Failed to update subscription fields for %s, %v", addrs[0], err)
+	}
+
+	updated, err := db.GetSubscriptionWithAddress(addrs[0])
+
+	if err != nil {
+		t.Fatalf("Failed to get updated subscription for %s, %v", addrs[0], err)
+	}
+
+	if updated.Status != disabled || updated.Created != sub.Created {
+		t.Fatalf("Unexpected subscription after updating fields for %s, %v", addrs[0], updated)
+	}
+
+	enabled_status := subscription.SUBSCRIPTION_STATUS_ENABLED
+
+	err = db.UpdateSubscriptionFields(ctx, addrs[0], &dynamodb.SubscriptionUpdate{Status: &enabled_status})
+
+	if err != nil {
+		t.Fatalf("Failed to restore subscription status for %s, %v", addrs[0], err)
+	}
+
+	err = db.UpdateSubscriptionFields(ctx, "nobody@example.com", &dynamodb.SubscriptionUpdate{Status: &disabled})
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error updating fields for missing subscription, got %v", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+
+		count, err := db.IncrementBounceCount(ctx, addrs[0])
+
+		if err != nil {
+			t.Fatalf("Failed to increment bounce count for %s, %v", addrs[0], err)
+		}
+
+		if count != int64(i) {
+			t.Fatalf("Unexpected bounce count %d for %s, expected %d", count, addrs[0], i)
+		}
+	}
+
+	_, err = db.IncrementBounceCount(ctx, "nobody@example.com")
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error incrementing bounce count for missing subscription, got %v", err)
+	}
+
+	err = db.ResetCounter(ctx, addrs[0], dynamodb.COUNTER_BOUNCE)
+
+	if err != nil {
+		t.Fatalf("Failed to reset bounce count for %s, %v", addrs[0], err)
+	}
+
+	counters, err := db.GetSubscriptionCounters(ctx, addrs[0])
+
+	if err != nil {
+		t.Fatalf("Failed to get counters for %s, %v", addrs[0], err)
+	}
+
+	if counters.Bounces != 0 {
+		t.Fatalf("Unexpected bounce count %d for %s after reset", counters.Bounces, addrs[0])
+	}
+
+	err = db.AddSubscriptionTags(ctx, addrs[0], "news", "beta", "news")
+
+	if err != nil {
+		t.Fatalf("Failed to add tags for %s, %v", addrs[0], err)
+	}
+
+	err = db.RemoveSubscriptionTags(ctx, addrs[0], "beta")
+
+	if err != nil {
+		t.Fatalf("Failed to remove tags for %s, %v", addrs[0], err)
+	}
+
+	tags, err := db.GetSubscriptionTags(ctx, addrs[0])
+
+	if err != nil {
+		t.Fatalf("Failed to get tags for %s, %v", addrs[0], err)
+	}
+
+	if len(tags) != 1 || tags[0] != "news" {
+		t.Fatalf("Unexpected tags %v for %s, expected [news]", tags, addrs[0])
+	}
+
+	tagged := make([]string, 0)
+
+	err = db.ListSubscriptionsWithTag(ctx, "news", func(sub *subscription.Subscription) error {
+		tagged = append(tagged, sub.Address)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to list subscriptions with tag, %v", err)
+	}
+
+	assertAddresses(t, "ListSubscriptionsWithTag", tagged, addrs[0:1])
+
+	segmented := make([]string, 0)
+
+	seg_it := db.SubscriptionsInSegment(ctx, &dynamodb.Segment{Tags: []string{"news"}, Domain: "EXAMPLE.com"})
+
+	for seg_it.Next() {
+		segmented = append(segmented, seg_it.Subscription().Address)
+	}
+
+	if seg_it.Err() != nil {
+		t.Fatalf("Failed to iterate over subscriptions in segment, %v", seg_it.Err())
+	}
+
+	assertAddresses(t, "SubscriptionsInSegment", segmented, addrs[0:1])
+
+	err = db.AddSubscriptionTags(ctx, "nobody@example.com", "news")
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error adding tags for missing subscription, got %v", err)
+	}
+
+	err = db.SetSubscriptionMetadata(ctx, addrs[0], map[string]string{"name": "Alice", "source": "website"})
+
+	if err != nil {
+		t.Fatalf("Failed to set metadata for %s, %v", addrs[0], err)
+	}
+
+	err = db.SetSubscriptionMetadata(ctx, addrs[0], map[string]string{"source": "import"})
+
+	if err != nil {
+		t.Fatalf("Failed to update metadata for %s, %v", addrs[0], err)
+	}
+
+	err = db.RemoveSubscriptionMetadata(ctx, addrs[0], "name")
+
+	if err != nil {
+		t.Fatalf("Failed to remove metadata for %s, %v", addrs[0], err)
+	}
+
+	metadata, err := db.GetSubscriptionMetadata(ctx, addrs[0])
+
+	if err != nil {
+		t.Fatalf("Failed to get metadata for %s, %v", addrs[0], err)
+	}
+
+	if len(metadata) != 1 || metadata["source"] != "import" {
+		t.Fatalf("Unexpected metadata %v for %s", metadata, addrs[0])
+	}
+
+	err = db.SetSubscriptionMetadata(ctx, "nobody@example.com", map[string]string{"name": "Nobody"})
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error setting metadata for missing subscription, got %v", err)
+	}
+
+	err = db.SetSubscriptionStatus(ctx, addrs[1], dynamodb.STATUS_BOUNCED)
+
+	if err != nil {
+		t.Fatalf("Failed to set subscription status for %s, %v", addrs[1], err)
+	}
+
+	status, err := db.GetSubscriptionStatus(ctx, addrs[1])
+
+	if err != nil {
+		t.Fatalf("Failed to get subscription status for %s, %v", addrs[1], err)
+	}
+
+	if status != dynamodb.STATUS_BOUNCED {
+		t.Fatalf("Unexpected subscription status '%s' for %s, expected '%s'", status, addrs[1], dynamodb.STATUS_BOUNCED)
+	}
+
+	confirmed := mustSubscription(t, "frank@example.com")
+
+	err = db.AddSubscription(confirmed)
+
+	if err != nil {
+		t.Fatalf("Failed to add subscription for %s, %v", confirmed.Address, err)
+	}
+
+	err = db.UpdateSubscriptionStatus(ctx, confirmed.Address, dynamodb.STATUS_ACTIVE)
+
+	if err != nil {
+		t.Fatalf("Failed to update subscription status for %s, %v", confirmed.Address, err)
+	}
+
+	confirmed, err = db.GetSubscriptionWithAddress(confirmed.Address)
+
+	if err != nil {
+		t.Fatalf("Failed to get subscription for %s, %v", "frank@example.com", err)
+	}
+
+	if confirmed.Status != subscription.SUBSCRIPTION_STATUS_ENABLED || confirmed.Confirmed == 0 {
+		t.Fatalf("Subscription for %s was not confirmed", confirmed.Address)
+	}
+
+	err = db.RemoveSubscription(confirmed)
+
+	if err != nil {
+		t.Fatalf("Failed to remove subscription for %s, %v", confirmed.Address, err)
+	}
+
+	err = db.UpdateSubscriptionStatus(ctx, "nobody@example.com", dynamodb.STATUS_UNSUBSCRIBED)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error updating status of missing subscription, got %v", err)
+	}
+
+	bounced := make([]string, 0)
+	unsubscribed := make([]string, 0)
+
+	err = db.ListSubscriptionsWithSubscriptionStatus(ctx, dynamodb.STATUS_BOUNCED, func(sub *subscription.Subscription) error {
+		bounced = append(bounced, sub.Address)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to list bounced subscriptions, %v", err)
+	}
+
+	assertAddresses(t, "ListSubscriptionsWithSubscriptionStatus (bounced)", bounced, addrs[1:2])
+
+	err = db.ListSubscriptionsWithSubscriptionStatus(ctx, dynamodb.STATUS_UNSUBSCRIBED, func(sub *subscription.Subscription) error {
+		unsubscribed = append(unsubscribed, sub.Address)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to list unsubscribed subscriptions, %v", err)
+	}
+
+	assertAddresses(t, "ListSubscriptionsWithSubscriptionStatus (unsubscribed)", unsubscribed, []string{})
+
+	err = db.SetSubscriptionStatus(ctx, addrs[1], dynamodb.STATUS_PENDING)
+
+	if err != nil {
+		t.Fatalf("Failed to restore subscription status for %s, %v", addrs[1], err)
+	}
+
+	subs, err := db.GetSubscriptionsWithAddresses(ctx, []string{addrs[2], "nobody@example.com", addrs[0], addrs[2]})
+
+	if err != nil {
+		t.Fatalf("Failed to get subscriptions with addresses, %v", err)
+	}
+
+	if len(subs) != 2 || subs[0].Address != addrs[2] || subs[1].Address != addrs[0] {
+		t.Fatalf("Unexpected subscriptions returned for addresses, %v", subscriptionAddresses(subs))
+	}
+
+	listed := make([]string, 0)
+
+	err = db.ListSubscriptions(ctx, func(sub *subscription.Subscription) error {
+		listed = append(listed, sub.Address)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to list subscriptions, %v", err)
+	}
+
+	assertAddresses(t, "ListSubscriptions", listed, addrs)
+
+	cancel_ctx, cancel := context.WithCancel(ctx)
+	cancelled := 0
+
+	err = db.ListSubscriptions(cancel_ctx, func(sub *subscription.Subscription) error {
+		cancelled += 1
+		cancel()
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected cancelled listing to fail with context.Canceled, got %v", err)
+	}
+
+	if cancelled != 1 {
+		t.Fatalf("Expected cancelled listing to stop after one subscription, got %d", cancelled)
+	}
+
+	enabled := make([]string, 0)
+
+	err = db.ListSubscriptionsWithStatus(ctx, func(sub *subscription.Subscription) error {
+		enabled = append(enabled, sub.Address)
+		return nil
+	}, subscription.SUBSCRIPTION_STATUS_ENABLED)
+
+	if err != nil {
+		t.Fatalf("Failed to list subscriptions with status, %v", err)
+	}
+
+	assertAddresses(t, "ListSubscriptionsWithStatus", enabled, addrs[0:1])
+
+	it := db.Subscriptions(ctx, &dynamodb.SubscriptionsIteratorOptions{
+		PageSize: 1,
+	})
+
+	iterated := make([]string, 0)
+
+	for it.Next() {
+		iterated = append(iterated, it.Subscription().Address)
+	}
+
+	err = it.Err()
+
+	if err != nil {
+		t.Fatalf("Failed to iterate subscriptions, %v", err)
+	}
+
+	it.Close()
+
+	assertAddresses(t, "Subscriptions", iterated, addrs)
+
+	it = db.Subscriptions(ctx, &dynamodb.SubscriptionsIteratorOptions{
+		PageSize: 1,
+	})
+
+	if !it.Next() {
+		t.Fatalf("Failed to read first subscription, %v", it.Err())
+	}
+
+	resumed := []string{it.Subscription().Address}
+
+	token, err := it.Token()
+
+	if err != nil {
+		t.Fatalf("Failed to get continuation token, %v", err)
+	}
+
+	it.Close()
+
+	it = db.Subscriptions(ctx, &dynamodb.SubscriptionsIteratorOptions{
+		PageSize:   1,
+		StartToken: token,
+	})
+
+	for it.Next() {
+		resumed = append(resumed, it.Subscription().Address)
+	}
+
+	err = it.Err()
+
+	if err != nil {
+		t.Fatalf("Failed to resume iterating subscriptions, %v", err)
+	}
+
+	it.Close()
+
+	assertAddresses(t, "Subscriptions (resumed)", resumed, addrs)
+
+	filtered := make([]string, 0)
+
+	filter := &dynamodb.SubscriptionsFilter{
+		Expression: "begins_with(#address, :prefix)",
+		Names: map[string]*string{
+			"#address": aws.String("address"),
+		},
+		Values: map[string]*aws_dynamodb.AttributeValue{
+			":prefix": {S: aws.String("bob@")},
+		},
+	}
+
+	err = db.ListSubscriptionsWithFilter(ctx, filter, func(sub *subscription.Subscription) error {
+		filtered = append(filtered, sub.Address)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to list subscriptions with filter, %v", err)
+	}
+
+	assertAddresses(t, "ListSubscriptionsWithFilter", filtered, []string{"bob@example.com"})
+
+	queried := make([]string, 0)
+
+	err = db.Query().WhereDomain("EXAMPLE.com").CreatedAfter(time.Unix(0, 0)).List(ctx, func(sub *subscription.Subscription) error {
+		queried = append(queried, sub.Address)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to query subscriptions, %v", err)
+	}
+
+	assertAddresses(t, "Query", queried, addrs)
+
+	err = db.Query().WhereDomain("example.org").List(ctx, func(sub *subscription.Subscription) error {
+		return fmt.Errorf("Unexpected subscription %s for example.org", sub.Address)
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to query subscriptions by domain, %v", err)
+	}
+
+	for _, addr := range addrs {
+
+		sub, err := db.GetSubscriptionWithAddress(addr)
+
+		if err != nil {
+			t.Fatalf("Failed to get subscription for %s, %v", addr, err)
+		}
+
+		err = db.RemoveSubscription(sub)
+
+		if err != nil {
+			t.Fatalf("Failed to remove subscription for %s, %v", addr, err)
+		}
+
+		_, err = db.GetSubscriptionWithAddress(addr)
+
+		if !dynamodb.IsNotExist(err) {
+			t.Fatalf("Expected not exist error for removed subscription %s, got %v", addr, err)
+		}
+	}
+
+	stale := mustSubscription(t, "frank@example.com")
+	stale.Created = time.Now().Add(-30 * 24 * time.Hour).Unix()
+
+	err = db.AddSubscription(stale)
+
+	if err != nil {
+		t.Fatalf("Failed to add stale subscription, %v", err)
+	}
+
+	count, err := db.RemoveUnconfirmedSubscriptions(ctx, time.Unix(stale.Created+1, 0), false)
+
+	if err != nil {
+		t.Fatalf("Failed to remove unconfirmed subscriptions, %v", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Expected to remove 1 unconfirmed subscription, removed %d", count)
+	}
+
+	_, err = db.GetSubscriptionWithAddress(stale.Address)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error for removed unconfirmed subscription, got %v", err)
+	}
+
+	removable := mustSubscription(t, "heidi@example.com")
+
+	err = db.AddSubscription(removable)
+
+	if err != nil {
+		t.Fatalf("Failed to add subscription for %s, %v", removable.Address, err)
+	}
+
+	removed, err := db.RemoveSubscriptionWithAddress(ctx, removable.Address)
+
+	if err != nil {
+		t.Fatalf("Failed to remove subscription for %s, %v", removable.Address, err)
+	}
+
+	if removed.Address != removable.Address || removed.Created != removable.Created {
+		t.Fatalf("Expected removed subscription to be %s created at %d, got %s created at %d", removable.Address, removable.Created, removed.Address, removed.Created)
+	}
+
+	_, err = db.RemoveSubscriptionWithAddress(ctx, removable.Address)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error removing missing subscription, got %v", err)
+	}
+
+	testSchemaUpgrade(t, h)
+}
+
+// testSchemaUpgrade checks that a subscription item written without a schema version is upgraded when it is read
+// and, with the RewriteUpgradedItems option, written back to the table.
+func testSchemaUpgrade(t *testing.T, h *Harness) {
+
+	ctx := context.Background()
+
+	client := aws_dynamodb.New(h.Session)
+	table := h.TablePrefix + dynamodb.SUBSCRIPTIONS_DEFAULT_TABLENAME
+
+	opts := dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()
+	opts.TablePrefix = h.TablePrefix
+	opts.RewriteUpgradedItems = true
+
+	db, err := dynamodb.NewSubscriptionsDatabaseWithSession(h.Session, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create subscriptions database, %v", err)
+	}
+
+	sub := mustSubscription(t, "grace@example.com")
+
+	err = db.AddSubscription(sub)
+
+	if err != nil {
+		t.Fatalf("Failed to add subscription, %v", err)
+	}
+
+	key := map[string]*aws_dynamodb.AttributeValue{
+		"address": {S: aws.String(sub.Address)},
+	}
+
+	get := func() map[string]*aws_dynamodb.AttributeValue {
+
+		rsp, err := client.GetItemWithContext(ctx, &aws_dynamodb.GetItemInput{
+			TableName:      aws.String(table),
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+		})
+
+		if err != nil {
+			t.Fatalf("Failed to get subscription item, %v", err)
+		}
+
+		return rsp.Item
+	}
+
+	item := get()
+
+	version, err := dynamodb.SchemaVersion(item)
+
+	if err != nil || version != dynamodb.SUBSCRIPTION_SCHEMA_VERSION {
+		t.Fatalf("Expected schema version %d for new subscription, got %d (%v)", dynamodb.SUBSCRIPTION_SCHEMA_VERSION, version, err)
+	}
+
+	delete(item, dynamodb.SCHEMA_VERSION_ATTRIBUTE)
+
+	_, err = client.PutItemWithContext(ctx, &aws_dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item:      item,
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to write unversioned subscription item, %v", err)
+	}
+
+	_, err = db.GetSubscriptionWithAddress(sub.Address)
+
+	if err != nil {
+		t.Fatalf("Failed to get unversioned subscription, %v", err)
+	}
+
+	version, err = dynamodb.SchemaVersion(get())
+
+	if err != nil || version != dynamodb.SUBSCRIPTION_SCHEMA_VERSION {
+		t.Fatalf("Expected upgraded subscription to be rewritten with schema version %d, got %d (%v)", dynamodb.SUBSCRIPTION_SCHEMA_VERSION, version, err)
+	}
+
+	item = get()
+	delete(item, dynamodb.SCHEMA_VERSION_ATTRIBUTE)
+
+	_, err = client.PutItemWithContext(ctx, &aws_dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item:      item,
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to write unversioned subscription item, %v", err)
+	}
+
+	m, err := db.MigrateSchema(ctx, &dynamodb.MigrateSchemaOptions{PageSize: 1}, nil)
+
+	if err != nil {
+		t.Fatalf("Failed to migrate schema, %v", err)
+	}
+
+	if m.Upgraded != 1 {
+		t.Fatalf("Expected to upgrade 1 subscription, upgraded %d", m.Upgraded)
+	}
+
+	version, err = dynamodb.SchemaVersion(get())
+
+	if err != nil || version != dynamodb.SUBSCRIPTION_SCHEMA_VERSION {
+		t.Fatalf("Expected migrated subscription to have schema version %d, got %d (%v)", dynamodb.SUBSCRIPTION_SCHEMA_VERSION, version, err)
+	}
+
+	err = db.RemoveSubscription(sub)
+
+	if err != nil {
+		t.Fatalf("Failed to remove subscription, %v", err)
+	}
+}
+
+// TestConfirmations exercises the methods of the confirmations database in 'h'.
+func TestConfirmations(t *testing.T, h *Harness) {
+
+	ctx := context.Background()
+	db := h.Confirmations
+
+	sub := mustSubscription(t, "dave@example.com")
+
+	conf, err := confirmation.NewConfirmationForSubscription(sub, "subscribe")
+
+	if err != nil {
+		t.Fatalf("Failed to create confirmation, %v", err)
+	}
+
+	err = db.AddConfirmation(conf)
+
+	if err != nil {
+		t.Fatalf("Failed to add confirmation, %v", err)
+	}
+
+	c, err := db.GetConfirmationWithCode(conf.Code)
+
+	if err != nil {
+		t.Fatalf("Failed to get confirmation with code, %v", err)
+	}
+
+	if c.Address != conf.Address || c.Action != conf.Action {
+		t.Fatalf("Unexpected confirmation %v, expected %v", c, conf)
+	}
+
+	confs, err := db.GetConfirmationsWithCodes(ctx, []string{conf.Code, "missing", conf.Code})
+
+	if err != nil {
+		t.Fatalf("Failed to get confirmations with codes, %v", err)
+	}
+
+	if len(confs) != 1 || confs[0].Code != conf.Code {
+		t.Fatalf("Expected only confirmation %s from GetConfirmationsWithCodes, got %v", conf.Code, confs)
+	}
+
+	confs, err = db.GetConfirmationsForAddress(ctx, sub.Address)
+
+	if err != nil {
+		t.Fatalf("Failed to get confirmations for address, %v", err)
+	}
+
+	if len(confs) == 0 || confs[0].Code != conf.Code {
+		t.Fatalf("Expected confirmation %s from GetConfirmationsForAddress, got %v", conf.Code, confs)
+	}
+
+	listed := false
+
+	err = db.ListConfirmations(ctx, func(c *confirmation.Confirmation) error {
+
+		if c.Code == conf.Code {
+			listed = true
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to list confirmations, %v", err)
+	}
+
+	if !listed {
+		t.Fatalf("ListConfirmations did not return confirmation %s", conf.Code)
+	}
+
+	c, err = db.ConsumeConfirmation(ctx, conf.Code)
+
+	if err != nil {
+		t.Fatalf("Failed to consume confirmation, %v", err)
+	}
+
+	if c.Code != conf.Code {
+		t.Fatalf("Consumed confirmation has unexpected code %s", c.Code)
+	}
+
+	_, err = db.ConsumeConfirmation(ctx, conf.Code)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error consuming confirmation twice, got %v", err)
+	}
+
+	other, err := confirmation.NewConfirmationForSubscription(sub, "unsubscribe")
+
+	if err != nil {
+		t.Fatalf("Failed to create confirmation, %v", err)
+	}
+
+	err = db.AddConfirmation(other)
+
+	if err != nil {
+		t.Fatalf("Failed to add confirmation, %v", err)
+	}
+
+	_, err = db.ConsumeConfirmationWithAction(ctx, other.Code, "subscribe")
+
+	if !errors.Is(err, dynamodb.ErrConfirmationAction) {
+		t.Fatalf("Expected ErrConfirmationAction consuming confirmation for another action, got %v", err)
+	}
+
+	c, err = db.ConsumeConfirmationWithAction(ctx, other.Code, "unsubscribe")
+
+	if err != nil {
+		t.Fatalf("Failed to consume confirmation left in place for another action, %v", err)
+	}
+
+	if c.Code != other.Code {
+		t.Fatalf("Consumed confirmation has unexpected code %s", c.Code)
+	}
+
+	expired, err := confirmation.NewConfirmationForSubscription(sub, "subscribe")
+
+	if err != nil {
+		t.Fatalf("Failed to create confirmation, %v", err)
+	}
+
+	expired.Created = time.Now().Add(-2 * dynamodb.CONFIRMATIONS_DEFAULT_MAX_AGE).Unix()
+
+	expires, err := db.AddConfirmationWithExpiry(ctx, expired)
+
+	if err != nil {
+		t.Fatalf("Failed to add expired confirmation, %v", err)
+	}
+
+	if !expires.Equal(db.ConfirmationExpires(expired)) || !expires.Before(time.Now()) {
+		t.Fatalf("Unexpected expiry time %v for expired confirmation", expires)
+	}
+
+	_, err = db.ConsumeConfirmation(ctx, expired.Code)
+
+	if !errors.Is(err, dynamodb.ErrConfirmationExpired) {
+		t.Fatalf("Expected ErrConfirmationExpired consuming expired confirmation, got %v", err)
+	}
+
+	_, err = db.GetConfirmationWithCode(expired.Code)
+
+	if !errors.Is(err, dynamodb.ErrConfirmationExpired) || !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected ErrConfirmationExpired and not exist error getting expired confirmation, got %v", err)
+	}
+
+	removed, err := db.RemoveConfirmationWithCode(ctx, expired.Code)
+
+	if err != nil {
+		t.Fatalf("Failed to remove confirmation, %v", err)
+	}
+
+	if removed.Code != expired.Code || removed.Created != expired.Created {
+		t.Fatalf("Expected removed confirmation %s created at %d, got %s created at %d", expired.Code, expired.Created, removed.Code, removed.Created)
+	}
+
+	_, err = db.GetConfirmationWithCode(expired.Code)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error for removed confirmation, got %v", err)
+	}
+
+	_, err = db.RemoveConfirmationWithCode(ctx, expired.Code)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error removing missing confirmation, got %v", err)
+	}
+
+	err = db.RemoveConfirmation(expired)
+
+	if err != nil {
+		t.Fatalf("Failed to remove missing confirmation, %v", err)
+	}
+
+	codes := make([]string, 0)
+
+	for i := 0; i < 2; i++ {
+
+		c, err := confirmation.NewConfirmationForSubscription(sub, "subscribe")
+
+		if err != nil {
+			t.Fatalf("Failed to create confirmation, %v", err)
+		}
+
+		err = db.AddConfirmation(c)
+
+		if err != nil {
+			t.Fatalf("Failed to add confirmation, %v", err)
+		}
+
+		codes = append(codes, c.Code)
+	}
+
+	err = db.RemoveConfirmationsForAddress(ctx, sub.Address)
+
+	if err != nil {
+		t.Fatalf("Failed to remove confirmations for address, %v", err)
+	}
+
+	for _, code := range codes {
+
+		_, err = db.GetConfirmationWithCode(code)
+
+		if !dynamodb.IsNotExist(err) {
+			t.Fatalf("Expected not exist error for confirmation %s removed with address, got %v", code, err)
+		}
+	}
+}
+
+// TestEventLogs exercises the methods of the event logs database in 'h'.
+func TestEventLogs(t *testing.T, h *Harness) {
+
+	sub := mustSubscription(t, "erin@example.com")
+
+	l, err := eventlog.NewEventLogWithSubscription(sub, eventlog.EVENTLOG_SUBSCRIBE_EVENT, "Subscribed")
+
+	if err != nil {
+		t.Fatalf("Failed to create event log, %v", err)
+	}
+
+	err = h.EventLogs.AddEventLog(l)
+
+	if err != nil {
+		t.Fatalf("Failed to add event log, %v", err)
+	}
+}
+
+// TestDeliveries exercises the methods of the deliveries database in 'h'.
+func TestDeliveries(t *testing.T, h *Harness) {
+
+	ctx := context.Background()
+	db := h.Deliveries
+
+	d := &delivery.Delivery{
+		MessageId: "message-1",
+		Address:   "frank@example.com",
+		Delivered: time.Now().Unix(),
+	}
+
+	err := db.AddDelivery(d)
+
+	if err != nil {
+		t.Fatalf("Failed to add delivery, %v", err)
+	}
+
+	err = db.AddDelivery(d)
+
+	if !errors.Is(err, dynamodb.ErrAlreadyExists) {
+		t.Fatalf("Expected ErrAlreadyExists adding duplicate delivery, got %v", err)
+	}
+
+	got, err := db.GetDeliveryWithAddressAndMessageId(d.Address, d.MessageId)
+
+	if err != nil {
+		t.Fatalf("Failed to get delivery, %v", err)
+	}
+
+	if got.Delivered != d.Delivered {
+		t.Fatalf("Unexpected delivered time %d, expected %d", got.Delivered, d.Delivered)
+	}
+
+	_, err = db.GetDeliveryWithAddressAndMessageId(d.Address, "message-2")
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error for missing delivery, got %v", err)
+	}
+
+	others := []*delivery.Delivery{
+		{MessageId: "message-1", Address: "heidi@example.com", Delivered: d.Delivered},
+		{MessageId: "message-2", Address: d.Address, Delivered: d.Delivered},
+	}
+
+	for _, o := range others {
+
+		err := db.AddDelivery(o)
+
+		if err != nil {
+			t.Fatalf("Failed to add delivery of %s to %s, %v", o.MessageId, o.Address, err)
+		}
+	}
+
+	recipients := make([]string, 0)
+
+	err = db.ListDeliveriesForMessage(ctx, "message-1", func(d *delivery.Delivery) error {
+		recipients = append(recipients, d.Address)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to list deliveries for message, %v", err)
+	}
+
+	assertAddresses(t, "ListDeliveriesForMessage", recipients, []string{d.Address, "heidi@example.com"})
+
+	messages := make([]string, 0)
+
+	err = db.ListDeliveriesForAddress(ctx, d.Address, func(d *delivery.Delivery) error {
+		messages = append(messages, d.MessageId)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to list deliveries for address, %v", err)
+	}
+
+	assertAddresses(t, "ListDeliveriesForAddress", messages, []string{"message-1", "message-2"})
+}
+
+// TestSendQueue exercises the methods of the send queue in 'h'.
+func TestSendQueue(t *testing.T, h *Harness) {
+
+	ctx := context.Background()
+	q := h.SendQueue
+
+	item, err := q.Enqueue(ctx, "message-1", "ivan@example.com")
+
+	if err != nil {
+		t.Fatalf("Failed to enqueue item, %v", err)
+	}
+
+	_, err = q.Enqueue(ctx, item.MessageId, item.Address)
+
+	if !errors.Is(err, dynamodb.ErrAlreadyExists) {
+		t.Fatalf("Expected ErrAlreadyExists enqueuing duplicate item, got %v", err)
+	}
+
+	// the lease index is eventually consistent so allow for a short delay before the item is visible
+
+	var leased []*dynamodb.SendQueueItem
+
+	for i := 0; i < 10 && len(leased) == 0; i++ {
+
+		leased, err = q.Lease(ctx, "sender-1", 10)
+
+		if err != nil {
+			t.Fatalf("Failed to lease items, %v", err)
+		}
+
+		if len(leased) == 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	if len(leased) != 1 || leased[0].Id != item.Id || leased[0].LeaseOwner != "sender-1" || leased[0].Attempts != 1 {
+		t.Fatalf("Unexpected leased items %v", leased)
+	}
+
+	again, err := q.Lease(ctx, "sender-2", 10)
+
+	if err != nil {
+		t.Fatalf("Failed to lease items a second time, %v", err)
+	}
+
+	if len(again) != 0 {
+		t.Fatalf("Leased an item which is already leased")
+	}
+
+	stale := *leased[0]
+	stale.LeaseOwner = "sender-2"
+
+	err = q.Complete(ctx, &stale)
+
+	if !errors.Is(err, dynamodb.ErrLeaseLost) {
+		t.Fatalf("Expected ErrLeaseLost completing an item leased by another sender, got %v", err)
+	}
+
+	err = q.Extend(ctx, leased[0])
+
+	if err != nil {
+		t.Fatalf("Failed to extend lease, %v", err)
+	}
+
+	err = q.Complete(ctx, leased[0])
+
+	if err != nil {
+		t.Fatalf("Failed to complete item, %v", err)
+	}
+}
+
+// TestDeadLetters exercises the methods of the dead letters database in 'h', and dead-lettering send queue items.
+func TestDeadLetters(t *testing.T, h *Harness) {
+
+	ctx := context.Background()
+	q := h.SendQueue
+	db := h.DeadLetters
+
+	item, err := q.Enqueue(ctx, "message-2", "judy@example.com")
+
+	if err != nil {
+		t.Fatalf("Failed to enqueue item, %v", err)
+	}
+
+	var leased []*dynamodb.SendQueueItem
+
+	for i := 0; i < 10 && len(leased) == 0; i++ {
+
+		leased, err = q.Lease(ctx, "sender-1", 10)
+
+		if err != nil {
+			t.Fatalf("Failed to lease items, %v", err)
+		}
+
+		if len(leased) == 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	if len(leased) != 1 || leased[0].Id != item.Id {
+		t.Fatalf("Unexpected leased items %v", leased)
+	}
+
+	err = q.DeadLetter(ctx, leased[0], db, errors.New("550 mailbox unavailable"), "s3://bucket/message-2.eml")
+
+	if err != nil {
+		t.Fatalf("Failed to dead letter item, %v", err)
+	}
+
+	dl, err := db.GetDeadLetter(ctx, item.Address, item.MessageId)
+
+	if err != nil {
+		t.Fatalf("Failed to get dead letter, %v", err)
+	}
+
+	if dl.Error != "550 mailbox unavailable" || dl.MessageURI != "s3://bucket/message-2.eml" || dl.Attempts != 1 || dl.Queue != item.Queue {
+		t.Fatalf("Unexpected dead letter %v", dl)
+	}
+
+	count := 0
+
+	err = db.ListDeadLetters(ctx, func(dl *dynamodb.DeadLetter) error {
+		count += 1
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to list dead letters, %v", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Expected 1 dead letter, got %d", count)
+	}
+
+	// the item was removed from the queue so it can be enqueued again when the dead letter is replayed
+
+	_, err = q.Enqueue(ctx, dl.MessageId, dl.Address)
+
+	if err != nil {
+		t.Fatalf("Failed to enqueue dead lettered item again, %v", err)
+	}
+
+	err = db.RemoveDeadLetter(ctx, dl)
+
+	if err != nil {
+		t.Fatalf("Failed to remove dead letter, %v", err)
+	}
+
+	_, err = db.GetDeadLetter(ctx, dl.Address, dl.MessageId)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected dead letter to be removed, got %v", err)
+	}
+}
+
+// TestHistory exercises the history database in 'h', which is assigned to the History option of its subscriptions database.
+func TestHistory(t *testing.T, h *Harness) {
+
+	ctx := context.Background()
+	db := h.Subscriptions
+
+	addr := "mallory@example.com"
+	sub := mustSubscription(t, addr)
+
+	err := db.AddSubscription(sub)
+
+	if err != nil {
+		t.Fatalf("Failed to add subscription, %v", err)
+	}
+
+	err = db.SetSubscriptionStatus(ctx, addr, dynamodb.STATUS_BOUNCED)
+
+	if err != nil {
+		t.Fatalf("Failed to set subscription status, %v", err)
+	}
+
+	err = db.RemoveSubscription(sub)
+
+	if err != nil {
+		t.Fatalf("Failed to remove subscription, %v", err)
+	}
+
+	entries, err := h.History.GetSubscriptionHistory(ctx, addr)
+
+	if err != nil {
+		t.Fatalf("Failed to get subscription history, %v", err)
+	}
+
+	expected := [][]string{
+		{dynamodb.HISTORY_CHANGE_ADDED, "AddSubscription", string(dynamodb.STATUS_PENDING)},
+		{dynamodb.HISTORY_CHANGE_UPDATED, "SetSubscriptionStatus", string(dynamodb.STATUS_BOUNCED)},
+		{dynamodb.HISTORY_CHANGE_REMOVED, "RemoveSubscription", ""},
+	}
+
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d history entries, got %d", len(expected), len(entries))
+	}
+
+	for i, e := range entries {
+
+		if e.Address != addr || e.Change != expected[i][0] || e.Operation != expected[i][1] || string(e.State) != expected[i][2] {
+			t.Fatalf("Unexpected history entry %d, %v", i, e)
+		}
+
+		if i > 0 && e.Recorded <= entries[i-1].Recorded {
+			t.Fatalf("Expected history entries to be ordered by time")
+		}
+	}
+
+	entries, err = h.History.GetSubscriptionHistory(ctx, "nobody@example.com")
+
+	if err != nil {
+		t.Fatalf("Failed to get history for unknown address, %v", err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("Expected no history for unknown address, got %d entries", len(entries))
+	}
+}
+
+// TestStats exercises the methods of the stats database in 'h' against the subscriptions database in 'h'.
+func TestStats(t *testing.T, h *Harness) {
+
+	ctx := context.Background()
+	now := time.Now()
+
+	sub := mustSubscription(t, "niaj@example.com")
+
+	err := h.Subscriptions.AddSubscription(sub)
+
+	if err != nil {
+		t.Fatalf("Failed to add subscription, %v", err)
+	}
+
+	s, err := h.Stats.WriteSnapshot(ctx, h.Subscriptions, now)
+
+	if err != nil {
+		t.Fatalf("Failed to write snapshot, %v", err)
+	}
+
+	if s.Total < 1 || s.New < 1 {
+		t.Fatalf("Expected snapshot to count new subscription, %v", s)
+	}
+
+	stored, err := h.Stats.GetStatsSnapshot(ctx, now)
+
+	if err != nil {
+		t.Fatalf("Failed to get snapshot, %v", err)
+	}
+
+	if stored.Date != s.Date || stored.Total != s.Total || stored.New != s.New {
+		t.Fatalf("Unexpected snapshot, %v", stored)
+	}
+
+	count := 0
+
+	err = h.Stats.ListStatsSnapshots(ctx, now.AddDate(0, 0, -1), now, func(s *dynamodb.StatsSnapshot) error {
+		count += 1
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to list snapshots, %v", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Expected 1 snapshot, got %d", count)
+	}
+
+	_, err = h.Stats.GetStatsSnapshot(ctx, now.AddDate(0, 0, -7))
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected missing snapshot to not exist, got %v", err)
+	}
+}
+
+// TestBatchWriter exercises a `BatchWriter` for the subscriptions database in 'h'.
+func TestBatchWriter(t *testing.T, h *Harness) {
+
+	ctx := context.Background()
+	db := h.Subscriptions
+
+	opts := dynamodb.DefaultBatchWriterOptions()
+	opts.MaxItems = 10
+
+	w, err := dynamodb.NewBatchWriter(db, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create batch writer, %v", err)
+	}
+
+	subs := make([]*subscription.Subscription, 0)
+
+	for i := 0; i < 15; i++ {
+
+		sub := mustSubscription(t, fmt.Sprintf("batch%d@example.com", i))
+		subs = append(subs, sub)
+
+		err := w.Put(ctx, sub)
+
+		if err != nil {
+			t.Fatalf("Failed to put subscription, %v", err)
+		}
+	}
+
+	err = w.Delete(ctx, subs[0])
+
+	if err != nil {
+		t.Fatalf("Failed to delete subscription, %v", err)
+	}
+
+	err = w.Close(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to close batch writer, %v", err)
+	}
+
+	_, err = db.GetSubscriptionWithAddress(subs[0].Address)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected deleted subscription to not exist, got %v", err)
+	}
+
+	for _, sub := range subs[1:] {
+
+		_, err := db.GetSubscriptionWithAddress(sub.Address)
+
+		if err != nil {
+			t.Fatalf("Failed to get subscription for %s, %v", sub.Address, err)
+		}
+	}
+
+	_, err = dynamodb.NewBatchWriter(db, &dynamodb.BatchWriterOptions{MaxItems: 100})
+
+	if err == nil {
+		t.Fatalf("Expected batch writer with too many items to fail")
+	}
+}
+
+// TestUnsubscribeTokens exercises the methods of the unsubscribe tokens database in 'h'.
+func TestUnsubscribeTokens(t *testing.T, h *Harness) {
+
+	ctx := context.Background()
+	db := h.UnsubscribeTokens
+
+	addr := "grace@example.com"
+
+	token, err := db.EnsureUnsubscribeToken(ctx, addr)
+
+	if err != nil {
+		t.Fatalf("Failed to ensure unsubscribe token, %v", err)
+	}
+
+	again, err := db.EnsureUnsubscribeToken(ctx, addr)
+
+	if err != nil {
+		t.Fatalf("Failed to ensure unsubscribe token a second time, %v", err)
+	}
+
+	if again.Token != token.Token {
+		t.Fatalf("EnsureUnsubscribeToken returned a new token for an address that already has one")
+	}
+
+	got, err := db.GetUnsubscribeTokenWithToken(ctx, token.Token)
+
+	if err != nil {
+		t.Fatalf("Failed to get unsubscribe token with token, %v", err)
+	}
+
+	if got.Address != addr {
+		t.Fatalf("Unexpected address %s for unsubscribe token, expected %s", got.Address, addr)
+	}
+
+	rotated, err := db.RotateUnsubscribeToken(ctx, addr)
+
+	if err != nil {
+		t.Fatalf("Failed to rotate unsubscribe token, %v", err)
+	}
+
+	if rotated.Token == token.Token {
+		t.Fatalf("RotateUnsubscribeToken did not issue a new token")
+	}
+
+	_, err = db.GetUnsubscribeTokenWithToken(ctx, token.Token)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error for rotated token, got %v", err)
+	}
+
+	got, err = db.GetUnsubscribeTokenWithAddress(ctx, addr)
+
+	if err != nil {
+		t.Fatalf("Failed to get unsubscribe token with address, %v", err)
+	}
+
+	if got.Token != rotated.Token {
+		t.Fatalf("GetUnsubscribeTokenWithAddress did not return the rotated token")
+	}
+
+	err = db.RemoveUnsubscribeTokensForAddress(ctx, addr)
+
+	if err != nil {
+		t.Fatalf("Failed to remove unsubscribe tokens, %v", err)
+	}
+
+	_, err = db.GetUnsubscribeTokenWithAddress(ctx, addr)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error for removed tokens, got %v", err)
+	}
+}
+
+func mustSubscription(t *testing.T, addr string) *subscription.Subscription {
+
+	t.Helper()
+
+	sub, err := subscription.NewSubscription(addr)
+
+	if err != nil {
+		t.Fatalf("Failed to create subscription for %s, %v", addr, err)
+	}
+
+	return sub
+}
+
+func subscriptionAddresses(subs []*subscription.Subscription) []string {
+
+	addrs := make([]string, len(subs))
+
+	for i, sub := range subs {
+		addrs[i] = sub.Address
+	}
+
+	return addrs
+}
+
+func assertAddresses(t *testing.T, label string, got []string, expected []string) {
+
+	t.Helper()
+
+	got = append([]string(nil), got...)
+	expected = append([]string(nil), expected...)
+
+	sort.Strings(got)
+	sort.Strings(expected)
+
+	if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", expected) {
+		t.Fatalf("%s returned %v, expected %v", label, got, expected)
+	}
+}
@@ -0,0 +1,29 @@
+package dynamodbtest
+
+import (
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+)
+
+// TableDefinitions returns the definitions of every table this package expects, using their default options, for
+// testing the packages which provision them. If 'expires_attribute' is not empty TTL is enabled for that attribute
+// in the confirmations and unsubscribe tokens tables.
+func TableDefinitions(expires_attribute string) []*dynamodb.TableDefinition {
+
+	conf_opts := dynamodb.DefaultDynamoDBConfirmationsDatabaseOptions()
+	conf_opts.ExpiresAttribute = expires_attribute
+
+	tokens_opts := dynamodb.DefaultDynamoDBUnsubscribeTokensDatabaseOptions()
+	tokens_opts.ExpiresAttribute = expires_attribute
+
+	return []*dynamodb.TableDefinition{
+		dynamodb.SubscriptionsTableDefinition(dynamodb.DefaultDynamoDBSubscriptionsDatabaseOptions()),
+		dynamodb.ConfirmationsTableDefinition(conf_opts),
+		dynamodb.EventLogsTableDefinition(dynamodb.DefaultDynamoDBEventLogsDatabaseOptions()),
+		dynamodb.DeliveriesTableDefinition(dynamodb.DefaultDynamoDBDeliveriesDatabaseOptions()),
+		dynamodb.UnsubscribeTokensTableDefinition(tokens_opts),
+		dynamodb.SendQueueTableDefinition(dynamodb.DefaultDynamoDBSendQueueOptions()),
+		dynamodb.DeadLettersTableDefinition(dynamodb.DefaultDynamoDBDeadLettersDatabaseOptions()),
+		dynamodb.HistoryTableDefinition(dynamodb.DefaultDynamoDBHistoryDatabaseOptions()),
+		dynamodb.StatsTableDefinition(dynamodb.DefaultDynamoDBStatsDatabaseOptions()),
+	}
+}
@@ -0,0 +1,154 @@
+package dynamodb
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"io"
+)
+
+// Encryptor encrypts and decrypts attribute values client-side, before they are written to DynamoDB. 'aad' is
+// additional authenticated data binding a ciphertext to the record and attribute it was written for, and must
+// be the same when decrypting.
+type Encryptor interface {
+	Encrypt(ctx context.Context, plaintext []byte, aad []byte) ([]byte, error)
+	Decrypt(ctx context.Context, ciphertext []byte, aad []byte) ([]byte, error)
+}
+
+// AESEncryptor is an `Encryptor` using AES-GCM with a locally held key. Ciphertexts are the random nonce
+// followed by the sealed plaintext.
+type AESEncryptor struct {
+	aead cipher.AEAD
+}
+
+// NewAESEncryptor returns a new `AESEncryptor` for 'key', which must be a 16, 24 or 32 byte AES key.
+func NewAESEncryptor(key []byte) (*AESEncryptor, error) {
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid encryption key, %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create cipher, %w", err)
+	}
+
+	e := &AESEncryptor{
+		aead: aead,
+	}
+
+	return e, nil
+}
+
+// Encrypt encrypts 'plaintext', authenticating 'aad'.
+func (e *AESEncryptor) Encrypt(ctx context.Context, plaintext []byte, aad []byte) ([]byte, error) {
+
+	nonce := make([]byte, e.aead.NonceSize())
+
+	_, err := io.ReadFull(rand.Reader, nonce)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e.aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// Decrypt decrypts 'ciphertext', verifying 'aad'.
+func (e *AESEncryptor) Decrypt(ctx context.Context, ciphertext []byte, aad []byte) ([]byte, error) {
+
+	size := e.aead.NonceSize()
+
+	if len(ciphertext) < size {
+		return nil, errors.New("Ciphertext is too short")
+	}
+
+	return e.aead.Open(nil, ciphertext[:size], ciphertext[size:], aad)
+}
+
+// attributeAAD returns the additional data used to encrypt the attribute 'name' of the record with 'key', so that
+// an encrypted value can not be copied to another record or attribute.
+func attributeAAD(key string, name string) []byte {
+	return []byte(key + "#" + name)
+}
+
+// encryptAttributes replaces each of the attributes named 'attrs' in 'item' with a binary attribute containing
+// its value, encrypted by 'e'. 'key' is the value of the record's key. It does nothing if 'e' is nil.
+func encryptAttributes(ctx context.Context, e Encryptor, attrs []string, key string, item map[string]*aws_dynamodb.AttributeValue) error {
+
+	if e == nil {
+		return nil
+	}
+
+	for _, name := range attrs {
+
+		v, ok := item[name]
+
+		if !ok {
+			continue
+		}
+
+		body, err := json.Marshal(v)
+
+		if err != nil {
+			return err
+		}
+
+		enc, err := e.Encrypt(ctx, body, attributeAAD(key, name))
+
+		if err != nil {
+			return fmt.Errorf("Failed to encrypt %s attribute, %w", name, err)
+		}
+
+		item[name] = &aws_dynamodb.AttributeValue{
+			B: enc,
+		}
+	}
+
+	return nil
+}
+
+// decryptAttributes restores the attributes named 'attrs' in 'item' encrypted by `encryptAttributes`. Attributes
+// which are not binary, for example because they were written before encryption was enabled, are left as-is.
+// It does nothing if 'e' is nil.
+func decryptAttributes(ctx context.Context, e Encryptor, attrs []string, key string, item map[string]*aws_dynamodb.AttributeValue) error {
+
+	if e == nil || item == nil {
+		return nil
+	}
+
+	for _, name := range attrs {
+
+		v, ok := item[name]
+
+		if !ok || v.B == nil {
+			continue
+		}
+
+		body, err := e.Decrypt(ctx, v.B, attributeAAD(key, name))
+
+		if err != nil {
+			return fmt.Errorf("Failed to decrypt %s attribute, %w", name, err)
+		}
+
+		var dec *aws_dynamodb.AttributeValue
+
+		err = json.Unmarshal(body, &dec)
+
+		if err != nil {
+			return fmt.Errorf("Failed to decode %s attribute, %w", name, err)
+		}
+
+		item[name] = dec
+	}
+
+	return nil
+}
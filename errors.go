@@ -0,0 +1,106 @@
+package dynamodb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/database"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ErrThrottled is returned (wrapped) when a request is rejected because it exceeded the table's
+// provisioned throughput or the account's request limits.
+var ErrThrottled = errors.New("Request was throttled")
+
+// ErrTableNotFound is returned (wrapped) when a request references a table that does not exist.
+var ErrTableNotFound = errors.New("Table not found")
+
+// ErrConditionFailed is returned (wrapped) when a conditional request fails its condition check.
+var ErrConditionFailed = errors.New("Condition check failed")
+
+// ErrAlreadyExists is returned (wrapped) when adding a record, or creating a table, that already exists.
+var ErrAlreadyExists = errors.New("Record already exists")
+
+// ErrReadOnly is returned (wrapped) when a database with the ReadOnly option is asked to write to its table.
+var ErrReadOnly = errors.New("Database is read-only")
+
+// ErrConfirmationExpired is returned (wrapped, by a `ConfirmationExpiredError`) when a confirmation exists but is
+// older than its maximum age.
+var ErrConfirmationExpired = errors.New("Confirmation has expired")
+
+// ErrConfirmationAction is returned (wrapped) by `ConsumeConfirmationWithAction` when a confirmation exists but is
+// for a different action.
+var ErrConfirmationAction = errors.New("Confirmation is for a different action")
+
+// ConfirmationExpiredError describes a confirmation which exists but is older than the MaxAge option. Since expired
+// confirmations should be treated as missing it wraps both ErrConfirmationExpired and a `database.NoRecordError`, so
+// `IsNotExist` reports true for it.
+type ConfirmationExpiredError struct {
+	// Code is the code of the confirmation.
+	Code string
+	// Created is the Unix time the confirmation was created.
+	Created int64
+}
+
+func (e *ConfirmationExpiredError) Error() string {
+	return fmt.Sprintf("Confirmation %s, %v", e.Code, ErrConfirmationExpired)
+}
+
+func (e *ConfirmationExpiredError) Unwrap() []error {
+	return []error{ErrConfirmationExpired, new(database.NoRecordError)}
+}
+
+// IsNotExist reports whether 'err', or any error it wraps, is a `database.NoRecordError`. Unlike
+// `database.IsNotExist` it inspects the entire chain of wrapped errors.
+func IsNotExist(err error) bool {
+
+	if err == nil {
+		return false
+	}
+
+	if database.IsNotExist(err) {
+		return true
+	}
+
+	var ptr_err *database.NoRecordError
+
+	if errors.As(err, &ptr_err) {
+		return true
+	}
+
+	var err_value database.NoRecordError
+	return errors.As(err, &err_value)
+}
+
+// wrapError maps errors returned by the AWS SDK on to the package error types above, preserving the
+// original error so that callers can still use `errors.As` to retrieve the underlying `awserr.Error`.
+// Errors that don't map to a package error type are returned as-is.
+func wrapError(err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	var aws_err awserr.Error
+
+	if !errors.As(err, &aws_err) {
+		return err
+	}
+
+	var kind error
+
+	switch aws_err.Code() {
+	case aws_dynamodb.ErrCodeProvisionedThroughputExceededException, aws_dynamodb.ErrCodeRequestLimitExceeded, "ThrottlingException":
+		kind = ErrThrottled
+	case aws_dynamodb.ErrCodeResourceNotFoundException, aws_dynamodb.ErrCodeTableNotFoundException:
+		kind = ErrTableNotFound
+	case aws_dynamodb.ErrCodeConditionalCheckFailedException:
+		kind = ErrConditionFailed
+	case aws_dynamodb.ErrCodeResourceInUseException, aws_dynamodb.ErrCodeTableAlreadyExistsException:
+		kind = ErrAlreadyExists
+	default:
+		return err
+	}
+
+	return fmt.Errorf("%w, %w", kind, err)
+}
@@ -1,24 +1,71 @@
 package dynamodb
 
 import (
-	// "context"
+	"context"
 	// "errors"
-	"github.com/aaronland/go-aws-session"
 	"github.com/aaronland/go-mailinglist/database"
 	"github.com/aaronland/go-mailinglist/eventlog"
 	aws "github.com/aws/aws-sdk-go/aws"
 	aws_session "github.com/aws/aws-sdk-go/aws/session"
 	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
 	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	_ "log"
+	"net/http"
 )
 
 const EVENTLOGS_DEFAULT_TABLENAME string = "eventlogs"
 
 type DynamoDBEventLogsDatabaseOptions struct {
 	TableName   string
+	TablePrefix string
+	TableSuffix string
 	BillingMode string
 	CreateTable bool
+	// DeletionProtection enables deletion protection when the table is created.
+	DeletionProtection bool
+	// TableClass is the table class (STANDARD or STANDARD_INFREQUENT_ACCESS) used when the table is created.
+	// If empty STANDARD is used.
+	TableClass string
+	// ContributorInsights enables CloudWatch Contributor Insights for the table and its indexes when the table is created.
+	ContributorInsights bool
+	// KinesisStreamArn is the ARN of an optional Kinesis data stream to which changes to the table are streamed,
+	// enabled when the table is created. See the changes package for decoding the resulting records.
+	KinesisStreamArn string
+	// Retention is an optional policy declaring the maximum age of event logs by event. It is enforced using TTL if
+	// RetentionAttribute is set and by `EnforceRetention` (see cmd/enforce-retention) otherwise.
+	Retention RetentionPolicy
+	// RetentionAttribute is the name of the attribute each event log's expiry time, under Retention, is written to
+	// and for which TTL is enabled when the table is created. See RETENTION_DEFAULT_ATTRIBUTE.
+	RetentionAttribute string
+	// ReturnConsumedCapacity is the level of consumed capacity detail (TOTAL or INDEXES) to request when
+	// ConsumedCapacityFunc is set. If empty TOTAL is used.
+	ReturnConsumedCapacity string
+	// ConsumedCapacityFunc is an optional callback invoked with the capacity consumed by each request.
+	ConsumedCapacityFunc ConsumedCapacityFunc
+	// CapacityLimiter is an optional `CapacityLimiter` which caps the read and write capacity consumed per second.
+	CapacityLimiter *CapacityLimiter
+	// Middleware is an optional chain of `Middleware` invoked around each request to DynamoDB, the first of which is outermost.
+	Middleware []Middleware
+	// ReadOnly rejects every request which would write to the table with ErrReadOnly, before it is sent. It may not
+	// be used with CreateTable.
+	ReadOnly bool
+	// HTTPClient is an optional HTTP client used by the session and DSN constructors in place of the session's
+	// default client. See `NewHTTPClient`.
+	HTTPClient *http.Client
+	// Region is the AWS region of the table, used in place of the session's region by the session and DSN constructors.
+	// If empty the region of the table's ARN, if TableName is an ARN, and otherwise the session's region is used.
+	Region string
+	// Endpoint is the URL of the DynamoDB endpoint, for example "http://localhost:8000" for DynamoDB Local, used in place
+	// of the session's endpoint by the session and DSN constructors. It takes precedence over UseFIPSEndpoint and
+	// UseDualStackEndpoint. If empty the session's endpoint is used.
+	Endpoint string
+	// UseFIPSEndpoint selects the FIPS 140-2 validated DynamoDB endpoint for the session's region.
+	UseFIPSEndpoint bool
+	// UseDualStackEndpoint selects the dual-stack (IPv4 and IPv6) DynamoDB endpoint for the session's region.
+	UseDualStackEndpoint bool
+	// Retry is an optional `RetryOptions` used to retry failed requests in place of the AWS SDK's default retryer.
+	Retry *RetryOptions
 }
 
 func DefaultDynamoDBEventLogsDatabaseOptions() *DynamoDBEventLogsDatabaseOptions {
@@ -32,26 +79,87 @@ func DefaultDynamoDBEventLogsDatabaseOptions() *DynamoDBEventLogsDatabaseOptions
 	return &opts
 }
 
+// FullTableName returns the name of the table with the TablePrefix and TableSuffix options applied.
+func (opts *DynamoDBEventLogsDatabaseOptions) FullTableName() string {
+	return fullTableName(opts.TablePrefix, opts.TableName, opts.TableSuffix)
+}
+
 type DynamoDBEventLogsDatabase struct {
 	database.EventLogsDatabase
-	client  *aws_dynamodb.DynamoDB
+	client  aws_dynamodbiface.DynamoDBAPI
 	options *DynamoDBEventLogsDatabaseOptions
 }
 
+// NewDynamoDBEventLogsDatabaseWithDSN returns a new `database.EventLogsDatabase` for 'dsn'. See
+// `NewEventLogsDatabaseWithDSN` for a constructor which returns the concrete `DynamoDBEventLogsDatabase`.
 func NewDynamoDBEventLogsDatabaseWithDSN(dsn string, opts *DynamoDBEventLogsDatabaseOptions) (database.EventLogsDatabase, error) {
 
-	sess, err := session.NewSessionWithDSN(dsn)
+	db, err := NewEventLogsDatabaseWithDSN(dsn, opts)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return NewDynamoDBEventLogsDatabaseWithSession(sess, opts)
+	return db, nil
 }
 
+// NewDynamoDBEventLogsDatabaseWithSession returns a new `database.EventLogsDatabase` for 'sess'. See
+// `NewEventLogsDatabaseWithSession` for a constructor which returns the concrete `DynamoDBEventLogsDatabase`.
 func NewDynamoDBEventLogsDatabaseWithSession(sess *aws_session.Session, opts *DynamoDBEventLogsDatabaseOptions) (database.EventLogsDatabase, error) {
 
-	client := aws_dynamodb.New(sess)
+	db, err := NewEventLogsDatabaseWithSession(sess, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewDynamoDBEventLogsDatabaseWithClient returns a new `database.EventLogsDatabase` that uses 'client' to talk to
+// DynamoDB. See `NewEventLogsDatabaseWithClient` for a constructor which returns the concrete `DynamoDBEventLogsDatabase`.
+func NewDynamoDBEventLogsDatabaseWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBEventLogsDatabaseOptions) (database.EventLogsDatabase, error) {
+
+	db, err := NewEventLogsDatabaseWithClient(client, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewEventLogsDatabaseWithDSN returns a new `DynamoDBEventLogsDatabase` instance for 'dsn'. Table names and
+// endpoint settings assigned in 'dsn' are assigned to 'opts'.
+func NewEventLogsDatabaseWithDSN(dsn string, opts *DynamoDBEventLogsDatabaseOptions) (*DynamoDBEventLogsDatabase, error) {
+
+	sess, err := newSessionWithDSNSettings(dsn, DSN_EVENTLOGS_TABLE_KEY, opts.settings())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEventLogsDatabaseWithSession(sess, opts)
+}
+
+// NewEventLogsDatabaseWithSession returns a new `DynamoDBEventLogsDatabase` instance for 'sess'.
+func NewEventLogsDatabaseWithSession(sess *aws_session.Session, opts *DynamoDBEventLogsDatabaseOptions) (*DynamoDBEventLogsDatabase, error) {
+
+	client := opts.settings().newClient(sess)
+
+	return NewEventLogsDatabaseWithClient(client, opts)
+}
+
+// NewEventLogsDatabaseWithClient returns a new `DynamoDBEventLogsDatabase` instance that uses 'client' to talk to DynamoDB.
+func NewEventLogsDatabaseWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBEventLogsDatabaseOptions) (*DynamoDBEventLogsDatabase, error) {
+
+	err := opts.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	client = withMiddleware(client, opts.settings().middleware())
 
 	if opts.CreateTable {
 		_, err := CreateEventLogsTable(client, opts)
@@ -70,6 +178,23 @@ func NewDynamoDBEventLogsDatabaseWithSession(sess *aws_session.Session, opts *Dy
 }
 
 func (db *DynamoDBEventLogsDatabase) AddEventLog(l *eventlog.EventLog) error {
+	return db.AddEventLogWithContext(context.Background(), l)
+}
+
+// AddEventLogWithContext is the context-first equivalent of `AddEventLog`.
+func (db *DynamoDBEventLogsDatabase) AddEventLogWithContext(ctx context.Context, l *eventlog.EventLog) error {
+
+	ctx = withOperation(ctx, "AddEventLog")
+	return db.addEventLog(ctx, l)
+}
+
+func (db *DynamoDBEventLogsDatabase) addEventLog(ctx context.Context, l *eventlog.EventLog) error {
+
+	err := validateEventLog(l)
+
+	if err != nil {
+		return err
+	}
 
 	item, err := aws_dynamodbattribute.MarshalMap(l)
 
@@ -77,15 +202,81 @@ func (db *DynamoDBEventLogsDatabase) AddEventLog(l *eventlog.EventLog) error {
 		return err
 	}
 
+	setRetentionAttribute(item, db.options.RetentionAttribute, db.options.Retention, l.Event, eventLogRetentionTime(l))
+
 	req := &aws_dynamodb.PutItemInput{
 		Item:      item,
-		TableName: aws.String(db.options.TableName),
+		TableName: aws.String(db.options.FullTableName()),
 	}
 
-	_, err = db.client.PutItem(req)
+	_, err = db.client.PutItemWithContext(ctx, req)
 
 	if err != nil {
-		return err
+		return wrapError(err)
+	}
+
+	return nil
+}
+
+func itemToEventLog(item map[string]*aws_dynamodb.AttributeValue) (*eventlog.EventLog, error) {
+
+	var l *eventlog.EventLog
+
+	err := aws_dynamodbattribute.UnmarshalMap(item, &l)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if l.Address == "" {
+		return nil, new(database.NoRecordError)
+	}
+
+	return l, nil
+}
+
+func scanEventLogs(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, req *aws_dynamodb.ScanInput, callback database.ListEventLogsFunc) error {
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return err
+		}
+
+		rsp, err := client.ScanWithContext(ctx, req)
+
+		if err != nil {
+			return wrapError(err)
+		}
+
+		for _, item := range rsp.Items {
+
+			err := ctx.Err()
+
+			if err != nil {
+				return err
+			}
+
+			l, err := itemToEventLog(item)
+
+			if err != nil {
+				return err
+			}
+
+			err = callback(l)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
 	}
 
 	return nil
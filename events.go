@@ -0,0 +1,193 @@
+package dynamodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_eventbridge "github.com/aws/aws-sdk-go/service/eventbridge"
+	aws_eventbridgeiface "github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+	"time"
+)
+
+// EVENTBRIDGE_DEFAULT_SOURCE is the source of the events emitted by `EventBridgePublisher` unless another is assigned.
+const EVENTBRIDGE_DEFAULT_SOURCE string = "mailinglist.subscriptions"
+
+// ChangePublisher publishes a change to a subscription, described by the same `HistoryEntry` appended to the
+// History option, to other systems. It is invoked by the subscriptions database, if assigned to its Publisher
+// option, after each change has been written.
+type ChangePublisher interface {
+	PublishChange(ctx context.Context, e *HistoryEntry) error
+}
+
+// EventBridgePublisher is a `ChangePublisher` which emits an event to an Amazon EventBridge event bus for each
+// change. The detail type of each event is "Subscription Added", "Subscription Updated" or "Subscription
+// Removed" and its detail is the JSON encoding of the `HistoryEntry` for the change.
+type EventBridgePublisher struct {
+	client aws_eventbridgeiface.EventBridgeAPI
+	bus    string
+	source string
+}
+
+func NewEventBridgePublisherWithDSN(dsn string, bus string, source string) (*EventBridgePublisher, error) {
+
+	sess, err := NewSessionWithDSN(dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEventBridgePublisherWithSession(sess, bus, source)
+}
+
+func NewEventBridgePublisherWithSession(sess *aws_session.Session, bus string, source string) (*EventBridgePublisher, error) {
+	return NewEventBridgePublisherWithClient(aws_eventbridge.New(sess), bus, source)
+}
+
+// NewEventBridgePublisherWithClient returns a new `EventBridgePublisher` that uses 'client' to emit events to the
+// event bus 'bus', which may be a name or an ARN, with 'source'. If 'bus' is empty the account's default event bus
+// is used and if 'source' is empty EVENTBRIDGE_DEFAULT_SOURCE is used.
+func NewEventBridgePublisherWithClient(client aws_eventbridgeiface.EventBridgeAPI, bus string, source string) (*EventBridgePublisher, error) {
+
+	if source == "" {
+		source = EVENTBRIDGE_DEFAULT_SOURCE
+	}
+
+	p := &EventBridgePublisher{
+		client: client,
+		bus:    bus,
+		source: source,
+	}
+
+	return p, nil
+}
+
+// PublishChange emits an event for 'e' to the publisher's event bus.
+func (p *EventBridgePublisher) PublishChange(ctx context.Context, e *HistoryEntry) error {
+
+	detail, err := json.Marshal(e)
+
+	if err != nil {
+		return err
+	}
+
+	entry := &aws_eventbridge.PutEventsRequestEntry{
+		Source:     aws.String(p.source),
+		DetailType: aws.String(eventBridgeDetailType(e.Change)),
+		Detail:     aws.String(string(detail)),
+		Time:       aws.Time(time.Unix(0, e.Recorded)),
+	}
+
+	if p.bus != "" {
+		entry.EventBusName = aws.String(p.bus)
+	}
+
+	req := &aws_eventbridge.PutEventsInput{
+		Entries: []*aws_eventbridge.PutEventsRequestEntry{
+			entry,
+		},
+	}
+
+	rsp, err := p.client.PutEventsWithContext(ctx, req)
+
+	if err != nil {
+		return err
+	}
+
+	// PutEvents reports failures for individual entries in the response rather than as an error
+
+	if aws.Int64Value(rsp.FailedEntryCount) > 0 && len(rsp.Entries) > 0 {
+
+		failed := rsp.Entries[0]
+		return fmt.Errorf("Failed to put event, %s: %s", aws.StringValue(failed.ErrorCode), aws.StringValue(failed.ErrorMessage))
+	}
+
+	return nil
+}
+
+func eventBridgeDetailType(change string) string {
+
+	switch change {
+	case HISTORY_CHANGE_ADDED:
+		return "Subscription Added"
+	case HISTORY_CHANGE_REMOVED:
+		return "Subscription Removed"
+	default:
+		return "Subscription Updated"
+	}
+}
+
+// recordChange records a 'change' to 'sub' with the History and Publisher options of 'opts', if set.
+func recordChange(ctx context.Context, opts *DynamoDBSubscriptionsDatabaseOptions, change string, sub *subscription.Subscription) error {
+
+	if opts.History == nil && opts.Publisher == nil {
+		return nil
+	}
+
+	e := newHistoryEntry(ctx, sub.Address, change)
+
+	if change != HISTORY_CHANGE_REMOVED {
+
+		status := sub.Status
+		confirmed := sub.Confirmed
+
+		e.Status = &status
+		e.Confirmed = &confirmed
+
+		// a disabled subscription may be either unsubscribed or bounced, and `updateSubscription`
+		// preserves whichever it was, so its state is not known here
+
+		if status != subscription.SUBSCRIPTION_STATUS_DISABLED {
+			e.State, _ = SubscriptionStatusFromLegacy(status)
+		}
+	}
+
+	return recordEntry(ctx, opts, e)
+}
+
+// recordUpdate records the partial 'update' of the subscription for 'addr' with the History and Publisher
+// options of 'opts', if set.
+func recordUpdate(ctx context.Context, opts *DynamoDBSubscriptionsDatabaseOptions, addr string, update *SubscriptionUpdate) error {
+
+	if opts.History == nil && opts.Publisher == nil {
+		return nil
+	}
+
+	e := newHistoryEntry(ctx, addr, HISTORY_CHANGE_UPDATED)
+	e.Status = update.Status
+	e.State = update.state
+	e.Confirmed = update.Confirmed
+
+	// the state attribute is removed when the status is updated without one (see `updateSubscriptionFields`)
+
+	if e.Status != nil && e.State == "" {
+		e.State, _ = SubscriptionStatusFromLegacy(*e.Status)
+	}
+
+	return recordEntry(ctx, opts, e)
+}
+
+func recordEntry(ctx context.Context, opts *DynamoDBSubscriptionsDatabaseOptions, e *HistoryEntry) error {
+
+	if opts.History != nil {
+
+		err := opts.History.AddHistoryEntry(ctx, e)
+
+		if err != nil {
+			return fmt.Errorf("Failed to record history for %s, %w", e.Address, err)
+		}
+	}
+
+	if opts.Publisher != nil {
+
+		err := opts.Publisher.PublishChange(ctx, e)
+
+		if err != nil {
+			return fmt.Errorf("Failed to publish change for %s, %w", e.Address, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package dynamodb
+
+import (
+	"context"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strings"
+)
+
+// SubscriptionsFilter is a DynamoDB filter expression, and the expression attribute names and values it refers
+// to, passed verbatim to the Scan requests of `ListSubscriptionsWithFilter`. For example:
+//
+//	filter := &dynamodb.SubscriptionsFilter{
+//		Expression: "#plan = :plan AND #status = :status",
+//		Names: map[string]*string{
+//			"#plan":   aws.String("plan"),
+//			"#status": aws.String("status"),
+//		},
+//		Values: map[string]*aws_dynamodb.AttributeValue{
+//			":plan":   {S: aws.String("premium")},
+//			":status": {N: aws.String("1")},
+//		},
+//	}
+type SubscriptionsFilter struct {
+	// Expression is the filter expression, for example "attribute_exists(#plan)".
+	Expression string
+	// Names maps the expression attribute name placeholders, which must start with "#", in Expression to attribute names.
+	Names map[string]*string
+	// Values maps the expression attribute value placeholders, which must start with ":", in Expression to values.
+	Values map[string]*aws_dynamodb.AttributeValue
+}
+
+// filterReservedPlaceholders are the expression attribute placeholders this package adds to listing filters. They
+// may not be used by a `SubscriptionsFilter`.
+var filterReservedPlaceholders = []string{
+	"#tenant_address",
+	":tenant",
+}
+
+// ListSubscriptionsWithFilter invokes 'callback' for each subscription which matches 'filter', for custom
+// attributes, or combinations of conditions, which no other listing method supports. The filter is passed to
+// DynamoDB as is, combined with the filter for the Tenant option if it is set, so its syntax is only checked by
+// DynamoDB, whose validation errors are returned. Filters are applied to items as they are stored, so they can not
+// match the cleartext address of pseudonymized subscriptions or the values of EncryptedAttributes. This is a
+// filtered scan of the entire table and, like every filter, is billed for every item read rather than every item
+// returned.
+func (db *DynamoDBSubscriptionsDatabase) ListSubscriptionsWithFilter(ctx context.Context, filter *SubscriptionsFilter, callback database.ListSubscriptionsFunc) error {
+
+	ctx = withOperation(ctx, "ListSubscriptionsWithFilter")
+
+	err := validateSubscriptionsFilter(filter)
+
+	if err != nil {
+		return err
+	}
+
+	// the names and values are copied since the tenant filter adds to them
+
+	req := &aws_dynamodb.ScanInput{
+		TableName:        aws.String(db.options.FullTableName()),
+		FilterExpression: aws.String(filter.Expression),
+	}
+
+	if len(filter.Names) > 0 {
+
+		req.ExpressionAttributeNames = make(map[string]*string, len(filter.Names))
+
+		for k, v := range filter.Names {
+			req.ExpressionAttributeNames[k] = v
+		}
+	}
+
+	if len(filter.Values) > 0 {
+
+		req.ExpressionAttributeValues = make(map[string]*aws_dynamodb.AttributeValue, len(filter.Values))
+
+		for k, v := range filter.Values {
+			req.ExpressionAttributeValues[k] = v
+		}
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
+	}
+
+	callback = limitSubscriptionsCallback(db.options.MaxResults, callback)
+
+	err = scanSubscriptions(ctx, db.client, db.options, req, callback)
+	return stopListingError(err)
+}
+
+// validateSubscriptionsFilter returns a `ValidationError` if 'filter' is empty, has malformed placeholders or
+// uses a placeholder reserved by this package.
+func validateSubscriptionsFilter(filter *SubscriptionsFilter) error {
+
+	if filter == nil || strings.TrimSpace(filter.Expression) == "" {
+		return validationError("filter", "Expression", "", "expression is empty")
+	}
+
+	for k, v := range filter.Names {
+
+		if !strings.HasPrefix(k, "#") || v == nil {
+			return validationError("filter", "Names", k, "names must start with '#' and have an attribute name")
+		}
+	}
+
+	for k, v := range filter.Values {
+
+		if !strings.HasPrefix(k, ":") || v == nil {
+			return validationError("filter", "Values", k, "values must start with ':' and have a value")
+		}
+	}
+
+	for _, k := range filterReservedPlaceholders {
+
+		_, ok := filter.Names[k]
+
+		if ok {
+			return validationError("filter", "Names", k, "placeholder is reserved")
+		}
+
+		_, ok = filter.Values[k]
+
+		if ok {
+			return validationError("filter", "Values", k, "placeholder is reserved")
+		}
+	}
+
+	return nil
+}
@@ -5,10 +5,12 @@ go 1.21
 require (
 	github.com/aaronland/go-aws-session v0.2.1
 	github.com/aaronland/go-mailinglist v0.0.16
+	github.com/aaronland/go-string v1.0.0
 	github.com/aws/aws-sdk-go v1.45.13
+	golang.org/x/net v0.26.0
 )
 
 require (
-	github.com/aaronland/go-string v1.0.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
 )
@@ -0,0 +1,6 @@
+// package grpc provides gRPC services, defined in mailinglist.proto, mirroring the go-mailinglist database
+// interfaces so that services written in other languages can read and modify subscriptions, confirmations,
+// event logs and deliveries through a typed API. See cmd/grpc-server for a server using the DynamoDB databases.
+package grpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative mailinglist.proto
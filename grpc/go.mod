@@ -0,0 +1,23 @@
+module github.com/aaronland/go-mailinglist-database-dynamodb/grpc
+
+go 1.21
+
+replace github.com/aaronland/go-mailinglist-database-dynamodb => ../
+
+require (
+	github.com/aaronland/go-mailinglist v0.0.16
+	github.com/aaronland/go-mailinglist-database-dynamodb v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	github.com/aaronland/go-aws-session v0.2.1 // indirect
+	github.com/aaronland/go-string v1.0.0 // indirect
+	github.com/aws/aws-sdk-go v1.45.13 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
@@ -0,0 +1,328 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	"github.com/aaronland/go-mailinglist/database"
+	"github.com/aaronland/go-mailinglist/delivery"
+	"github.com/aaronland/go-mailinglist/eventlog"
+	"github.com/aaronland/go-mailinglist/subscription"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// SubscriptionsService implements the Subscriptions gRPC service using a `database.SubscriptionsDatabase`.
+type SubscriptionsService struct {
+	UnimplementedSubscriptionsServer
+	db database.SubscriptionsDatabase
+}
+
+// NewSubscriptionsService returns a new `SubscriptionsService` which reads from, and writes to, 'db'.
+func NewSubscriptionsService(db database.SubscriptionsDatabase) *SubscriptionsService {
+
+	s := &SubscriptionsService{
+		db: db,
+	}
+
+	return s
+}
+
+func (s *SubscriptionsService) AddSubscription(ctx context.Context, req *Subscription) (*emptypb.Empty, error) {
+
+	err := s.db.AddSubscription(subscriptionFromMessage(req))
+	return empty(err)
+}
+
+func (s *SubscriptionsService) RemoveSubscription(ctx context.Context, req *Subscription) (*emptypb.Empty, error) {
+
+	err := s.db.RemoveSubscription(subscriptionFromMessage(req))
+	return empty(err)
+}
+
+func (s *SubscriptionsService) UpdateSubscription(ctx context.Context, req *Subscription) (*emptypb.Empty, error) {
+
+	err := s.db.UpdateSubscription(subscriptionFromMessage(req))
+	return empty(err)
+}
+
+func (s *SubscriptionsService) GetSubscriptionWithAddress(ctx context.Context, req *GetSubscriptionWithAddressRequest) (*Subscription, error) {
+
+	sub, err := s.db.GetSubscriptionWithAddress(req.Address)
+
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return subscriptionToMessage(sub), nil
+}
+
+func (s *SubscriptionsService) ListSubscriptions(req *ListSubscriptionsRequest, stream Subscriptions_ListSubscriptionsServer) error {
+
+	cb := func(sub *subscription.Subscription) error {
+		return stream.Send(subscriptionToMessage(sub))
+	}
+
+	err := s.db.ListSubscriptions(stream.Context(), cb)
+	return statusError(err)
+}
+
+func (s *SubscriptionsService) ListSubscriptionsWithStatus(req *ListSubscriptionsWithStatusRequest, stream Subscriptions_ListSubscriptionsWithStatusServer) error {
+
+	cb := func(sub *subscription.Subscription) error {
+		return stream.Send(subscriptionToMessage(sub))
+	}
+
+	statuses := make([]int, len(req.Status))
+
+	for i, st := range req.Status {
+		statuses[i] = int(st)
+	}
+
+	err := s.db.ListSubscriptionsWithStatus(stream.Context(), cb, statuses...)
+	return statusError(err)
+}
+
+// ConfirmationsService implements the Confirmations gRPC service using a `database.ConfirmationsDatabase`.
+type ConfirmationsService struct {
+	UnimplementedConfirmationsServer
+	db database.ConfirmationsDatabase
+}
+
+// NewConfirmationsService returns a new `ConfirmationsService` which reads from, and writes to, 'db'.
+func NewConfirmationsService(db database.ConfirmationsDatabase) *ConfirmationsService {
+
+	s := &ConfirmationsService{
+		db: db,
+	}
+
+	return s
+}
+
+func (s *ConfirmationsService) AddConfirmation(ctx context.Context, req *Confirmation) (*emptypb.Empty, error) {
+
+	err := s.db.AddConfirmation(confirmationFromMessage(req))
+	return empty(err)
+}
+
+func (s *ConfirmationsService) RemoveConfirmation(ctx context.Context, req *Confirmation) (*emptypb.Empty, error) {
+
+	err := s.db.RemoveConfirmation(confirmationFromMessage(req))
+	return empty(err)
+}
+
+func (s *ConfirmationsService) GetConfirmationWithCode(ctx context.Context, req *GetConfirmationWithCodeRequest) (*Confirmation, error) {
+
+	conf, err := s.db.GetConfirmationWithCode(req.Code)
+
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return confirmationToMessage(conf), nil
+}
+
+func (s *ConfirmationsService) ListConfirmations(req *ListConfirmationsRequest, stream Confirmations_ListConfirmationsServer) error {
+
+	cb := func(conf *confirmation.Confirmation) error {
+		return stream.Send(confirmationToMessage(conf))
+	}
+
+	err := s.db.ListConfirmations(stream.Context(), cb)
+	return statusError(err)
+}
+
+// EventLogsService implements the EventLogs gRPC service using a `database.EventLogsDatabase`.
+type EventLogsService struct {
+	UnimplementedEventLogsServer
+	db database.EventLogsDatabase
+}
+
+// NewEventLogsService returns a new `EventLogsService` which reads from, and writes to, 'db'.
+func NewEventLogsService(db database.EventLogsDatabase) *EventLogsService {
+
+	s := &EventLogsService{
+		db: db,
+	}
+
+	return s
+}
+
+func (s *EventLogsService) AddEventLog(ctx context.Context, req *EventLog) (*emptypb.Empty, error) {
+
+	l := &eventlog.EventLog{
+		Address: req.Address,
+		Created: req.Created,
+		Event:   int(req.Event),
+		Message: req.Message,
+	}
+
+	err := s.db.AddEventLog(l)
+	return empty(err)
+}
+
+func (s *EventLogsService) ListEventLogs(req *ListEventLogsRequest, stream EventLogs_ListEventLogsServer) error {
+
+	cb := func(l *eventlog.EventLog) error {
+
+		return stream.Send(&EventLog{
+			Address: l.Address,
+			Created: l.Created,
+			Event:   int32(l.Event),
+			Message: l.Message,
+		})
+	}
+
+	err := s.db.ListEventLogs(stream.Context(), cb)
+	return statusError(err)
+}
+
+// DeliveriesService implements the Deliveries gRPC service using a `database.DeliveriesDatabase`.
+type DeliveriesService struct {
+	UnimplementedDeliveriesServer
+	db database.DeliveriesDatabase
+}
+
+// NewDeliveriesService returns a new `DeliveriesService` which reads from, and writes to, 'db'.
+func NewDeliveriesService(db database.DeliveriesDatabase) *DeliveriesService {
+
+	s := &DeliveriesService{
+		db: db,
+	}
+
+	return s
+}
+
+func (s *DeliveriesService) AddDelivery(ctx context.Context, req *Delivery) (*emptypb.Empty, error) {
+
+	d := &delivery.Delivery{
+		MessageId: req.MessageId,
+		Address:   req.Address,
+		Delivered: req.Delivered,
+	}
+
+	err := s.db.AddDelivery(d)
+	return empty(err)
+}
+
+func (s *DeliveriesService) ListDeliveries(req *ListDeliveriesRequest, stream Deliveries_ListDeliveriesServer) error {
+
+	cb := func(d *delivery.Delivery) error {
+		return stream.Send(deliveryToMessage(d))
+	}
+
+	err := s.db.ListDeliveries(stream.Context(), cb)
+	return statusError(err)
+}
+
+func (s *DeliveriesService) GetDeliveryWithAddressAndMessageId(ctx context.Context, req *GetDeliveryWithAddressAndMessageIdRequest) (*Delivery, error) {
+
+	d, err := s.db.GetDeliveryWithAddressAndMessageId(req.Address, req.MessageId)
+
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return deliveryToMessage(d), nil
+}
+
+// statusError returns 'err' as a gRPC status error with the code for its kind, or nil if 'err' is nil.
+func statusError(err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	// errors returned by stream.Send are already status errors
+
+	_, ok := status.FromError(err)
+
+	if ok {
+		return err
+	}
+
+	code := codes.Internal
+
+	switch {
+	case dynamodb.IsNotExist(err):
+		code = codes.NotFound
+	case errors.Is(err, dynamodb.ErrAlreadyExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, dynamodb.ErrInvalid), errors.Is(err, dynamodb.ErrInvalidTransition):
+		code = codes.InvalidArgument
+	case errors.Is(err, dynamodb.ErrConflict):
+		code = codes.Aborted
+	case errors.Is(err, dynamodb.ErrReadOnly):
+		code = codes.FailedPrecondition
+	case errors.Is(err, dynamodb.ErrThrottled):
+		code = codes.Unavailable
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+
+	return status.Error(code, err.Error())
+}
+
+func empty(err error) (*emptypb.Empty, error) {
+
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func subscriptionFromMessage(m *Subscription) *subscription.Subscription {
+
+	return &subscription.Subscription{
+		Address:      m.Address,
+		Created:      m.Created,
+		Confirmed:    m.Confirmed,
+		LastModified: m.Lastmodified,
+		Status:       int(m.Status),
+	}
+}
+
+func subscriptionToMessage(sub *subscription.Subscription) *Subscription {
+
+	return &Subscription{
+		Address:      sub.Address,
+		Created:      sub.Created,
+		Confirmed:    sub.Confirmed,
+		Lastmodified: sub.LastModified,
+		Status:       int32(sub.Status),
+	}
+}
+
+func confirmationFromMessage(m *Confirmation) *confirmation.Confirmation {
+
+	return &confirmation.Confirmation{
+		Code:    m.Code,
+		Address: m.Address,
+		Action:  m.Action,
+		Created: m.Created,
+	}
+}
+
+func confirmationToMessage(conf *confirmation.Confirmation) *Confirmation {
+
+	return &Confirmation{
+		Code:    conf.Code,
+		Address: conf.Address,
+		Action:  conf.Action,
+		Created: conf.Created,
+	}
+}
+
+func deliveryToMessage(d *delivery.Delivery) *Delivery {
+
+	return &Delivery{
+		MessageId: d.MessageId,
+		Address:   d.Address,
+		Delivered: d.Delivered,
+	}
+}
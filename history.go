@@ -0,0 +1,323 @@
+package dynamodb
+
+import (
+	"context"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"net/http"
+	"time"
+)
+
+const HISTORY_DEFAULT_TABLENAME string = "subscription_history"
+
+// HISTORY_CHANGE_ADDED is the `HistoryEntry` change recorded when a subscription is added.
+const HISTORY_CHANGE_ADDED string = "added"
+
+// HISTORY_CHANGE_UPDATED is the `HistoryEntry` change recorded when a subscription is updated.
+const HISTORY_CHANGE_UPDATED string = "updated"
+
+// HISTORY_CHANGE_REMOVED is the `HistoryEntry` change recorded when a subscription is removed.
+const HISTORY_CHANGE_REMOVED string = "removed"
+
+// HistoryEntry records a single change to a subscription.
+type HistoryEntry struct {
+	Address string `json:"address"`
+	// Recorded is the Unix time, in nanoseconds, at which the change was recorded.
+	Recorded int64 `json:"recorded"`
+	// Change is the kind of change: HISTORY_CHANGE_ADDED, HISTORY_CHANGE_UPDATED or HISTORY_CHANGE_REMOVED.
+	Change string `json:"change"`
+	// Operation is the name of the database method which made the change, for example "SetSubscriptionStatus".
+	Operation string `json:"operation,omitempty"`
+	// Status is the go-mailinglist status of the subscription following the change, if known.
+	Status *int `json:"status,omitempty"`
+	// State is the `SubscriptionStatus` of the subscription following the change, if known.
+	State SubscriptionStatus `json:"state,omitempty"`
+	// Confirmed is the Unix time the subscription was confirmed, following the change, if known.
+	Confirmed *int64 `json:"confirmed,omitempty"`
+}
+
+// ListHistoryFunc is a callback function invoked for each entry when listing the history of a subscription.
+type ListHistoryFunc func(*HistoryEntry) error
+
+type DynamoDBHistoryDatabaseOptions struct {
+	TableName   string
+	TablePrefix string
+	TableSuffix string
+	BillingMode string
+	CreateTable bool
+	// DeletionProtection enables deletion protection when the table is created.
+	DeletionProtection bool
+	// TableClass is the table class (STANDARD or STANDARD_INFREQUENT_ACCESS) used when the table is created.
+	// If empty STANDARD is used.
+	TableClass string
+	// ContributorInsights enables CloudWatch Contributor Insights for the table and its indexes when the table is created.
+	ContributorInsights bool
+	// Pseudonymizer is an optional `AddressPseudonymizer` used to replace addresses with pseudonyms at rest. It
+	// should be the same as the Pseudonymizer option of the subscriptions database whose history is recorded.
+	Pseudonymizer *AddressPseudonymizer
+	// Tenant is an optional identifier prefixed onto the "address" key of every entry. It should be the same as
+	// the Tenant option of the subscriptions database whose history is recorded.
+	Tenant string
+	// PageSize is the maximum number of items to evaluate in each page of results when listing history.
+	// If zero DynamoDB's default (1MB of data) is used.
+	PageSize int64
+	// ReturnConsumedCapacity is the level of consumed capacity detail (TOTAL or INDEXES) to request when
+	// ConsumedCapacityFunc is set. If empty TOTAL is used.
+	ReturnConsumedCapacity string
+	// ConsumedCapacityFunc is an optional callback invoked with the capacity consumed by each request.
+	ConsumedCapacityFunc ConsumedCapacityFunc
+	// CapacityLimiter is an optional `CapacityLimiter` which caps the read and write capacity consumed per second.
+	CapacityLimiter *CapacityLimiter
+	// Middleware is an optional chain of `Middleware` invoked around each request to DynamoDB, the first of which is outermost.
+	Middleware []Middleware
+	// ReadOnly rejects every request which would write to the table with ErrReadOnly, before it is sent. It may not
+	// be used with CreateTable.
+	ReadOnly bool
+	// HTTPClient is an optional HTTP client used by the session and DSN constructors in place of the session's
+	// default client. See `NewHTTPClient`.
+	HTTPClient *http.Client
+	// Region is the AWS region of the table, used in place of the session's region by the session and DSN constructors.
+	// If empty the region of the table's ARN, if TableName is an ARN, and otherwise the session's region is used.
+	Region string
+	// Endpoint is the URL of the DynamoDB endpoint, for example "http://localhost:8000" for DynamoDB Local, used in place
+	// of the session's endpoint by the session and DSN constructors. It takes precedence over UseFIPSEndpoint and
+	// UseDualStackEndpoint. If empty the session's endpoint is used.
+	Endpoint string
+	// UseFIPSEndpoint selects the FIPS 140-2 validated DynamoDB endpoint for the session's region.
+	UseFIPSEndpoint bool
+	// UseDualStackEndpoint selects the dual-stack (IPv4 and IPv6) DynamoDB endpoint for the session's region.
+	UseDualStackEndpoint bool
+	// Retry is an optional `RetryOptions` used to retry failed requests in place of the AWS SDK's default retryer.
+	Retry *RetryOptions
+}
+
+func DefaultDynamoDBHistoryDatabaseOptions() *DynamoDBHistoryDatabaseOptions {
+
+	opts := DynamoDBHistoryDatabaseOptions{
+		TableName:   HISTORY_DEFAULT_TABLENAME,
+		BillingMode: "PAY_PER_REQUEST",
+		CreateTable: false,
+	}
+
+	return &opts
+}
+
+// FullTableName returns the name of the table with the TablePrefix and TableSuffix options applied.
+func (opts *DynamoDBHistoryDatabaseOptions) FullTableName() string {
+	return fullTableName(opts.TablePrefix, opts.TableName, opts.TableSuffix)
+}
+
+// DynamoDBHistoryDatabase is an append-only record of every change to each subscription, keyed on address and
+// the time of the change. Changes are recorded by a subscriptions database whose History option is set.
+type DynamoDBHistoryDatabase struct {
+	client  aws_dynamodbiface.DynamoDBAPI
+	options *DynamoDBHistoryDatabaseOptions
+}
+
+func NewDynamoDBHistoryDatabaseWithDSN(dsn string, opts *DynamoDBHistoryDatabaseOptions) (*DynamoDBHistoryDatabase, error) {
+
+	sess, err := newSessionWithDSNSettings(dsn, DSN_HISTORY_TABLE_KEY, opts.settings())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDynamoDBHistoryDatabaseWithSession(sess, opts)
+}
+
+func NewDynamoDBHistoryDatabaseWithSession(sess *aws_session.Session, opts *DynamoDBHistoryDatabaseOptions) (*DynamoDBHistoryDatabase, error) {
+
+	client := opts.settings().newClient(sess)
+
+	return NewDynamoDBHistoryDatabaseWithClient(client, opts)
+}
+
+// NewDynamoDBHistoryDatabaseWithClient returns a new `DynamoDBHistoryDatabase` instance that uses 'client'
+// to talk to DynamoDB.
+func NewDynamoDBHistoryDatabaseWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBHistoryDatabaseOptions) (*DynamoDBHistoryDatabase, error) {
+
+	err := opts.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	client = withMiddleware(client, opts.settings().middleware())
+
+	if opts.CreateTable {
+
+		_, err := CreateHistoryTable(client, opts)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db := DynamoDBHistoryDatabase{
+		client:  client,
+		options: opts,
+	}
+
+	return &db, nil
+}
+
+// AddHistoryEntry appends 'e' to the history of its subscription. If the Recorded property is zero the current
+// time is used.
+func (db *DynamoDBHistoryDatabase) AddHistoryEntry(ctx context.Context, e *HistoryEntry) error {
+
+	ctx = withOperation(ctx, "AddHistoryEntry")
+
+	err := validateAddress("history entry", e.Address)
+
+	if err != nil {
+		return err
+	}
+
+	if e.Recorded == 0 {
+		e.Recorded = time.Now().UnixNano()
+	}
+
+	item, err := aws_dynamodbattribute.MarshalMap(e)
+
+	if err != nil {
+		return err
+	}
+
+	item["address"] = &aws_dynamodb.AttributeValue{
+		S: aws.String(db.options.addressKey(e.Address)),
+	}
+
+	// entries are never overwritten so that the history remains append-only
+
+	req := &aws_dynamodb.PutItemInput{
+		Item:                item,
+		TableName:           aws.String(db.options.FullTableName()),
+		ConditionExpression: aws.String("attribute_not_exists(#address)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address": aws.String("address"),
+		},
+	}
+
+	_, err = db.client.PutItemWithContext(ctx, req)
+
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return nil
+}
+
+// GetSubscriptionHistory returns every recorded change to the subscription for 'addr', oldest first.
+func (db *DynamoDBHistoryDatabase) GetSubscriptionHistory(ctx context.Context, addr string) ([]*HistoryEntry, error) {
+
+	ctx = withOperation(ctx, "GetSubscriptionHistory")
+
+	entries := make([]*HistoryEntry, 0)
+
+	err := db.ListSubscriptionHistory(ctx, addr, func(e *HistoryEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// ListSubscriptionHistory invokes 'callback' for each recorded change to the subscription for 'addr', oldest first.
+func (db *DynamoDBHistoryDatabase) ListSubscriptionHistory(ctx context.Context, addr string, callback ListHistoryFunc) error {
+
+	ctx = withOperation(ctx, "ListSubscriptionHistory")
+
+	req := &aws_dynamodb.QueryInput{
+		TableName:              aws.String(db.options.FullTableName()),
+		KeyConditionExpression: aws.String("#address = :address"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address": aws.String("address"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":address": {
+				S: aws.String(db.options.addressKey(addr)),
+			},
+		},
+		ScanIndexForward: aws.Bool(true),
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
+	}
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return err
+		}
+
+		rsp, err := db.client.QueryWithContext(ctx, req)
+
+		if err != nil {
+			return wrapError(err)
+		}
+
+		for _, item := range rsp.Items {
+
+			err := ctx.Err()
+
+			if err != nil {
+				return err
+			}
+
+			var e *HistoryEntry
+
+			err = aws_dynamodbattribute.UnmarshalMap(item, &e)
+
+			if err != nil {
+				return err
+			}
+
+			// the stored address is a pseudonym if the Pseudonymizer option is set
+
+			e.Address = addr
+
+			err = callback(e)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+	}
+
+	return nil
+}
+
+// newHistoryEntry returns a new `HistoryEntry` for a 'change' to the subscription for 'addr', attributed to the
+// database operation 'ctx' is labeled with.
+func newHistoryEntry(ctx context.Context, addr string, change string) *HistoryEntry {
+
+	e := &HistoryEntry{
+		Address:  addr,
+		Recorded: time.Now().UnixNano(),
+		Change:   change,
+	}
+
+	op, ok := operationFromContext(ctx)
+
+	if ok {
+		e.Operation = op
+	}
+
+	return e
+}
@@ -0,0 +1,65 @@
+package dynamodb
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPClientOptions defines the timeout and connection settings used by `NewHTTPClient`.
+type HTTPClientOptions struct {
+	// Timeout is the overall time limit for a request, including reading the response body. If zero there is no limit.
+	Timeout time.Duration
+	// DialTimeout is the time limit for establishing a TCP connection.
+	DialTimeout time.Duration
+	// KeepAlive is the interval between TCP keep-alive probes. If negative keep-alives are disabled.
+	KeepAlive time.Duration
+	// TLSHandshakeTimeout is the time limit for completing a TLS handshake.
+	TLSHandshakeTimeout time.Duration
+	// IdleConnTimeout is how long an idle connection is kept in the pool before being closed.
+	IdleConnTimeout time.Duration
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept in the pool for each host.
+	MaxIdleConnsPerHost int
+}
+
+// DefaultHTTPClientOptions returns `HTTPClientOptions` with shorter connection timeouts than the Go defaults, so
+// that requests fail fast (and are retried by the SDK) rather than hanging during, say, a Lambda cold start.
+func DefaultHTTPClientOptions() *HTTPClientOptions {
+
+	opts := HTTPClientOptions{
+		Timeout:             30 * time.Second,
+		DialTimeout:         3 * time.Second,
+		KeepAlive:           30 * time.Second,
+		TLSHandshakeTimeout: 3 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+		MaxIdleConnsPerHost: 16,
+	}
+
+	return &opts
+}
+
+// NewHTTPClient returns a new `http.Client` configured by 'opts', suitable for assigning to the HTTPClient
+// option of any of the databases.
+func NewHTTPClient(opts *HTTPClientOptions) *http.Client {
+
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: opts.KeepAlive,
+	}
+
+	tr := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+
+	return &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: tr,
+	}
+}
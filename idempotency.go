@@ -0,0 +1,129 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strconv"
+	"time"
+)
+
+// IDEMPOTENCY_TOKEN_ATTRIBUTE is the name of the attribute the idempotency token a subscription was added with is stored in.
+const IDEMPOTENCY_TOKEN_ATTRIBUTE string = "idempotency_token"
+
+// IDEMPOTENCY_CREATED_ATTRIBUTE is the name of the attribute recording the Unix time a subscription was added with
+// an idempotency token.
+const IDEMPOTENCY_CREATED_ATTRIBUTE string = "idempotency_created"
+
+// SUBSCRIPTIONS_DEFAULT_IDEMPOTENCY_WINDOW is the default length of time during which retrying
+// `AddSubscriptionWithIdempotencyToken` with the same token succeeds.
+const SUBSCRIPTIONS_DEFAULT_IDEMPOTENCY_WINDOW time.Duration = 24 * time.Hour
+
+// AddSubscriptionWithIdempotencyToken adds 'sub', storing the client-supplied 'token' with it. If a subscription
+// for the same address already exists, and was added with the same token within the IdempotencyWindow option,
+// the request is treated as a retry and nil is returned without modifying the existing subscription. Otherwise
+// it returns ErrAlreadyExists, like `AddSubscription`. If 'token' is empty it behaves like `AddSubscription`.
+func (db *DynamoDBSubscriptionsDatabase) AddSubscriptionWithIdempotencyToken(ctx context.Context, sub *subscription.Subscription, token string) error {
+
+	ctx = withOperation(ctx, "AddSubscriptionWithIdempotencyToken")
+
+	if token == "" {
+		return db.addSubscription(ctx, sub)
+	}
+
+	now := time.Now()
+
+	item, err := subscriptionToItem(ctx, db.options, sub)
+
+	if err != nil {
+		return err
+	}
+
+	item[IDEMPOTENCY_TOKEN_ATTRIBUTE] = &aws_dynamodb.AttributeValue{
+		S: aws.String(token),
+	}
+
+	item[IDEMPOTENCY_CREATED_ATTRIBUTE] = &aws_dynamodb.AttributeValue{
+		N: aws.String(strconv.FormatInt(now.Unix(), 10)),
+	}
+
+	req := &aws_dynamodb.PutItemInput{
+		Item:                item,
+		TableName:           aws.String(db.options.FullTableName()),
+		ConditionExpression: aws.String("attribute_not_exists(#address)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address": aws.String("address"),
+		},
+	}
+
+	_, err = db.client.PutItemWithContext(ctx, req)
+
+	if err == nil {
+		return recordChange(ctx, db.options, HISTORY_CHANGE_ADDED, sub)
+	}
+
+	err = wrapError(err)
+
+	if !errors.Is(err, ErrConditionFailed) {
+		return err
+	}
+
+	// the existing subscription is left untouched, rather than matched in the condition and overwritten,
+	// so that a retry does not undo a confirmation made since the original request
+
+	retry, err := db.isIdempotentRetry(ctx, sub.Address, token, now)
+
+	if err != nil {
+		return err
+	}
+
+	if retry {
+		return nil
+	}
+
+	return fmt.Errorf("Failed to add subscription for %s, %w", sub.Address, ErrAlreadyExists)
+}
+
+// isIdempotentRetry reports whether the subscription for 'addr' was added with 'token' within the IdempotencyWindow option of 'now'.
+func (db *DynamoDBSubscriptionsDatabase) isIdempotentRetry(ctx context.Context, addr string, token string, now time.Time) (bool, error) {
+
+	req := &aws_dynamodb.GetItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"address": {
+				S: aws.String(db.options.addressKey(addr)),
+			},
+		},
+		ConsistentRead:       aws.Bool(true),
+		ProjectionExpression: aws.String("#token, #created"),
+		ExpressionAttributeNames: map[string]*string{
+			"#token":   aws.String(IDEMPOTENCY_TOKEN_ATTRIBUTE),
+			"#created": aws.String(IDEMPOTENCY_CREATED_ATTRIBUTE),
+		},
+	}
+
+	rsp, err := db.client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return false, wrapError(err)
+	}
+
+	v, ok := rsp.Item[IDEMPOTENCY_TOKEN_ATTRIBUTE]
+
+	if !ok || aws.StringValue(v.S) != token {
+		return false, nil
+	}
+
+	window := db.options.IdempotencyWindow
+
+	if window == 0 {
+		window = SUBSCRIPTIONS_DEFAULT_IDEMPOTENCY_WINDOW
+	}
+
+	created := activityTime(rsp.Item, IDEMPOTENCY_CREATED_ATTRIBUTE)
+
+	return created >= now.Add(-window).Unix(), nil
+}
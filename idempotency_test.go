@@ -0,0 +1,160 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// itemsClient keeps items in memory, keyed by their "address" attribute, and records the operation of each request.
+// Puts with a condition are treated as "attribute_not_exists(#address)".
+type itemsClient struct {
+	aws_dynamodbiface.DynamoDBAPI
+	items      map[string]map[string]*aws_dynamodb.AttributeValue
+	operations []string
+}
+
+func newItemsClient() *itemsClient {
+
+	return &itemsClient{
+		items: make(map[string]map[string]*aws_dynamodb.AttributeValue),
+	}
+}
+
+func (c *itemsClient) record(ctx context.Context) {
+	op, _ := operationFromContext(ctx)
+	c.operations = append(c.operations, op)
+}
+
+func (c *itemsClient) GetItemWithContext(ctx context.Context, req *aws_dynamodb.GetItemInput, opts ...request.Option) (*aws_dynamodb.GetItemOutput, error) {
+
+	c.record(ctx)
+
+	rsp := &aws_dynamodb.GetItemOutput{
+		Item: c.items[*req.Key["address"].S],
+	}
+
+	return rsp, nil
+}
+
+func (c *itemsClient) PutItemWithContext(ctx context.Context, req *aws_dynamodb.PutItemInput, opts ...request.Option) (*aws_dynamodb.PutItemOutput, error) {
+
+	c.record(ctx)
+
+	key := *req.Item["address"].S
+
+	_, exists := c.items[key]
+
+	if exists && req.ConditionExpression != nil {
+		return nil, awserr.New(aws_dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+
+	c.items[key] = req.Item
+	return &aws_dynamodb.PutItemOutput{}, nil
+}
+
+func TestAddSubscriptionWithIdempotencyToken(t *testing.T) {
+
+	ctx := context.Background()
+
+	client := newItemsClient()
+
+	db := &DynamoDBSubscriptionsDatabase{
+		client:  client,
+		options: DefaultDynamoDBSubscriptionsDatabaseOptions(),
+	}
+
+	sub, err := subscription.NewSubscription("bob@example.com")
+
+	if err != nil {
+		t.Fatalf("Failed to create subscription, %v", err)
+	}
+
+	err = db.AddSubscriptionWithIdempotencyToken(ctx, sub, "abc")
+
+	if err != nil {
+		t.Fatalf("Failed to add subscription, %v", err)
+	}
+
+	err = db.AddSubscriptionWithIdempotencyToken(ctx, sub, "abc")
+
+	if err != nil {
+		t.Fatalf("Expected retry with the same token to succeed, got %v", err)
+	}
+
+	err = db.AddSubscriptionWithIdempotencyToken(ctx, sub, "def")
+
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("Expected ErrAlreadyExists for another token, got %v", err)
+	}
+
+	// move the original request outside of the window
+
+	created := time.Now().Add(-SUBSCRIPTIONS_DEFAULT_IDEMPOTENCY_WINDOW - time.Minute).Unix()
+
+	client.items["bob@example.com"][IDEMPOTENCY_CREATED_ATTRIBUTE] = &aws_dynamodb.AttributeValue{
+		N: aws.String(strconv.FormatInt(created, 10)),
+	}
+
+	err = db.AddSubscriptionWithIdempotencyToken(ctx, sub, "abc")
+
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("Expected ErrAlreadyExists for a token outside of the window, got %v", err)
+	}
+}
+
+func TestAddSubscriptionWithoutIdempotencyToken(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newItemsClient()
+
+	db := &DynamoDBSubscriptionsDatabase{
+		client:  client,
+		options: DefaultDynamoDBSubscriptionsDatabaseOptions(),
+	}
+
+	sub, err := subscription.NewSubscription("alice@example.com")
+
+	if err != nil {
+		t.Fatalf("Failed to create subscription, %v", err)
+	}
+
+	err = db.AddSubscriptionWithIdempotencyToken(ctx, sub, "")
+
+	if err != nil {
+		t.Fatalf("Failed to add subscription, %v", err)
+	}
+
+	if len(client.operations) == 0 {
+		t.Fatalf("Expected subscription to be written")
+	}
+
+	for _, op := range client.operations {
+
+		if op != "AddSubscriptionWithIdempotencyToken" {
+			t.Fatalf("Expected requests to be made for AddSubscriptionWithIdempotencyToken, got %s", op)
+		}
+	}
+
+	_, ok := client.items["alice@example.com"][IDEMPOTENCY_TOKEN_ATTRIBUTE]
+
+	if ok {
+		t.Fatalf("Expected no idempotency token to be stored")
+	}
+
+	err = db.AddSubscriptionWithIdempotencyToken(ctx, sub, "")
+
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("Expected ErrAlreadyExists, got %v", err)
+	}
+}
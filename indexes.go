@@ -0,0 +1,194 @@
+package dynamodb
+
+import (
+	"fmt"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// SecondaryIndex describes an additional, user-defined, global secondary index to include when a table is created.
+type SecondaryIndex struct {
+	// Name is the name of the index.
+	Name string
+	// PartitionKey is the name of the attribute the index is partitioned by.
+	PartitionKey string
+	// PartitionKeyType is the type (S, N or B) of PartitionKey. If empty S is used.
+	PartitionKeyType string
+	// SortKey is the name of an optional attribute the index is sorted by.
+	SortKey string
+	// SortKeyType is the type (S, N or B) of SortKey. If empty S is used.
+	SortKeyType string
+	// Projection is the set of attributes (ALL, KEYS_ONLY or INCLUDE) copied in to the index. If empty ALL is used.
+	Projection string
+	// NonKeyAttributes are the names of the attributes copied in to the index when Projection is INCLUDE.
+	NonKeyAttributes []string
+}
+
+func (idx SecondaryIndex) partitionKeyType() string {
+
+	if idx.PartitionKeyType == "" {
+		return aws_dynamodb.ScalarAttributeTypeS
+	}
+
+	return idx.PartitionKeyType
+}
+
+func (idx SecondaryIndex) sortKeyType() string {
+
+	if idx.SortKeyType == "" {
+		return aws_dynamodb.ScalarAttributeTypeS
+	}
+
+	return idx.SortKeyType
+}
+
+func (idx SecondaryIndex) projection() string {
+
+	if idx.Projection == "" {
+		return aws_dynamodb.ProjectionTypeAll
+	}
+
+	return idx.Projection
+}
+
+// addSecondaryIndexes appends 'indexes', and the definitions of any key attributes not already defined, to 'req'.
+func addSecondaryIndexes(req *aws_dynamodb.CreateTableInput, indexes []SecondaryIndex) {
+
+	defined := make(map[string]bool)
+
+	for _, a := range req.AttributeDefinitions {
+		defined[aws.StringValue(a.AttributeName)] = true
+	}
+
+	define := func(name string, attr_type string) {
+
+		if defined[name] {
+			return
+		}
+
+		req.AttributeDefinitions = append(req.AttributeDefinitions, &aws_dynamodb.AttributeDefinition{
+			AttributeName: aws.String(name),
+			AttributeType: aws.String(attr_type),
+		})
+
+		defined[name] = true
+	}
+
+	for _, idx := range indexes {
+
+		define(idx.PartitionKey, idx.partitionKeyType())
+
+		key_schema := []*aws_dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String(idx.PartitionKey),
+				KeyType:       aws.String("HASH"),
+			},
+		}
+
+		if idx.SortKey != "" {
+
+			define(idx.SortKey, idx.sortKeyType())
+
+			key_schema = append(key_schema, &aws_dynamodb.KeySchemaElement{
+				AttributeName: aws.String(idx.SortKey),
+				KeyType:       aws.String("RANGE"),
+			})
+		}
+
+		projection := &aws_dynamodb.Projection{
+			ProjectionType: aws.String(idx.projection()),
+		}
+
+		if len(idx.NonKeyAttributes) > 0 {
+			projection.NonKeyAttributes = aws.StringSlice(idx.NonKeyAttributes)
+		}
+
+		req.GlobalSecondaryIndexes = append(req.GlobalSecondaryIndexes, &aws_dynamodb.GlobalSecondaryIndex{
+			IndexName:  aws.String(idx.Name),
+			KeySchema:  key_schema,
+			Projection: projection,
+		})
+	}
+}
+
+// validateSecondaryIndexes returns an `OptionsError` if any of 'indexes' are invalid, or conflict with the other
+// indexes and attribute definitions in 'def', which must already include them.
+func validateSecondaryIndexes(database string, indexes []SecondaryIndex, def *TableDefinition) error {
+
+	names := make(map[string]int)
+
+	for _, gsi := range def.Input.GlobalSecondaryIndexes {
+		names[aws.StringValue(gsi.IndexName)] += 1
+	}
+
+	types := make(map[string]string)
+
+	for _, a := range def.Input.AttributeDefinitions {
+		types[aws.StringValue(a.AttributeName)] = aws.StringValue(a.AttributeType)
+	}
+
+	checkKey := func(idx SecondaryIndex, option string, name string, attr_type string) error {
+
+		switch attr_type {
+		case aws_dynamodb.ScalarAttributeTypeS, aws_dynamodb.ScalarAttributeTypeN, aws_dynamodb.ScalarAttributeTypeB:
+			// pass
+		default:
+			return optionsError(database, "Indexes", idx.Name, fmt.Sprintf("%s type must be S, N or B", option))
+		}
+
+		if types[name] != attr_type {
+			return optionsError(database, "Indexes", idx.Name, fmt.Sprintf("%s %s is already defined with type %s", option, name, types[name]))
+		}
+
+		return nil
+	}
+
+	for _, idx := range indexes {
+
+		if len(idx.Name) < 3 || len(idx.Name) > 255 || !re_tablename.MatchString(idx.Name) {
+			return optionsError(database, "Indexes", idx.Name, "index names must be between 3 and 255 letters, numbers, '_', '-' or '.'")
+		}
+
+		if names[idx.Name] > 1 {
+			return optionsError(database, "Indexes", idx.Name, "index name is already used")
+		}
+
+		if idx.PartitionKey == "" {
+			return optionsError(database, "Indexes", idx.Name, "partition key is empty")
+		}
+
+		err := checkKey(idx, "partition key", idx.PartitionKey, idx.partitionKeyType())
+
+		if err != nil {
+			return err
+		}
+
+		if idx.SortKey != "" {
+
+			err := checkKey(idx, "sort key", idx.SortKey, idx.sortKeyType())
+
+			if err != nil {
+				return err
+			}
+		}
+
+		switch idx.projection() {
+		case aws_dynamodb.ProjectionTypeAll, aws_dynamodb.ProjectionTypeKeysOnly:
+
+			if len(idx.NonKeyAttributes) > 0 {
+				return optionsError(database, "Indexes", idx.Name, "non-key attributes require the INCLUDE projection")
+			}
+
+		case aws_dynamodb.ProjectionTypeInclude:
+
+			if len(idx.NonKeyAttributes) == 0 {
+				return optionsError(database, "Indexes", idx.Name, "the INCLUDE projection requires non-key attributes")
+			}
+
+		default:
+			return optionsError(database, "Indexes", idx.Name, "projection must be ALL, KEYS_ONLY or INCLUDE")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package dynamodb
+
+import (
+	"context"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// SubscriptionsIteratorOptions defines options for iterating over subscriptions.
+type SubscriptionsIteratorOptions struct {
+	// Status limits results to subscriptions with these statuses. If empty all subscriptions are returned.
+	Status []int
+	// PageSize is the maximum number of items to evaluate in each page of results. If zero the database's PageSize
+	// option is used.
+	PageSize int64
+	// MaxResults is the maximum number of subscriptions to return. If zero the database's MaxResults option is used.
+	MaxResults int
+	// StartToken is a continuation token, returned by the `Token` method of an earlier iterator with the same
+	// options, to resume from. If empty iteration starts at the beginning of the table.
+	StartToken string
+}
+
+// SubscriptionsIterator provides an alternative to the callback-based `ListSubscriptions` methods. For example:
+//
+//	it := db.Subscriptions(ctx, nil)
+//	defer it.Close()
+//
+//	for it.Next() {
+//		sub := it.Subscription()
+//	}
+//
+//	err := it.Err()
+type SubscriptionsIterator struct {
+	ctx         context.Context
+	client      aws_dynamodbiface.DynamoDBAPI
+	options     *DynamoDBSubscriptionsDatabaseOptions
+	req         *aws_dynamodb.ScanInput
+	query       *aws_dynamodb.QueryInput
+	match       func(*subscription.Subscription) bool
+	key_attrs   []string
+	start_key   map[string]*aws_dynamodb.AttributeValue
+	backoff     *pageBackoff
+	items       []map[string]*aws_dynamodb.AttributeValue
+	offset      int
+	page        int
+	page_start  bool
+	page_seen   bool
+	exhausted   bool
+	count       int
+	max         int
+	closed      bool
+	current     *subscription.Subscription
+	current_key map[string]*aws_dynamodb.AttributeValue
+	err         error
+}
+
+// Subscriptions returns a new `SubscriptionsIterator` for the subscriptions in 'db'. If 'opts' is nil
+// all subscriptions are returned. Pages are only fetched from DynamoDB as they are needed.
+func (db *DynamoDBSubscriptionsDatabase) Subscriptions(ctx context.Context, opts *SubscriptionsIteratorOptions) *SubscriptionsIterator {
+
+	it := &SubscriptionsIterator{
+		ctx:     withOperation(ctx, "Subscriptions"),
+		client:  db.client,
+		options: db.options,
+	}
+
+	table := db.options.FullTableName()
+
+	page_size := db.options.PageSize
+	it.max = db.options.MaxResults
+
+	if opts != nil && opts.PageSize > 0 {
+		page_size = opts.PageSize
+	}
+
+	if opts != nil && opts.MaxResults > 0 {
+		it.max = opts.MaxResults
+	}
+
+	if opts != nil && len(opts.Status) > 0 {
+
+		req, err := subscriptionsWithStatusScanInput(table, opts.Status...)
+
+		if err != nil {
+			it.err = err
+			return it
+		}
+
+		it.req = req
+
+	} else {
+
+		it.req = &aws_dynamodb.ScanInput{
+			TableName: aws.String(table),
+		}
+	}
+
+	withTenantFilter(db.options.Tenant, &it.req.FilterExpression, &it.req.ExpressionAttributeNames, &it.req.ExpressionAttributeValues)
+
+	if page_size > 0 {
+		it.req.Limit = aws.Int64(page_size)
+	}
+
+	if opts != nil {
+		it.resume(opts.StartToken)
+	}
+
+	return it
+}
+
+// Next advances the iterator to the next subscription, fetching a new page of results if necessary.
+// It returns false when there are no more subscriptions, when an error occurs or after `Close` has been called.
+func (it *SubscriptionsIterator) Next() bool {
+
+	if it.err != nil || it.closed {
+		return false
+	}
+
+	if it.max > 0 && it.count >= it.max {
+		return false
+	}
+
+	for {
+
+		for it.offset >= len(it.items) {
+
+			if it.exhausted {
+				return false
+			}
+
+			err := it.ctx.Err()
+
+			if err != nil {
+				it.err = err
+				return false
+			}
+
+			items, last_key, err := it.fetch()
+
+			if err != nil {
+				it.err = wrapError(err)
+				return false
+			}
+
+			it.items = items
+			it.offset = 0
+			it.page += 1
+			it.page_seen = false
+
+			if last_key == nil {
+				it.exhausted = true
+			}
+		}
+
+		// the context is checked for every item, not just for every page, so that a cancelled listing stops
+		// promptly rather than working through the rest of a page
+
+		err := it.ctx.Err()
+
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		key := it.itemKey(it.items[it.offset])
+
+		err = upgradeSubscriptionItem(it.ctx, it.client, it.options, it.items[it.offset], it.complete())
+
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		err = restoreSubscriptionItem(it.ctx, it.options, it.items[it.offset])
+
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		sub, err := itemToSubscription(it.items[it.offset])
+
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.offset += 1
+
+		if it.match != nil && !it.match(sub) {
+			continue
+		}
+
+		// the first subscription returned from a page starts it, even if the matcher skipped the items before it
+
+		it.page_start = !it.page_seen
+		it.page_seen = true
+
+		it.count += 1
+		it.current = sub
+		it.current_key = key
+
+		return true
+	}
+}
+
+// fetch reads the next page of results, using a Query request if the iterator has one and a Scan request otherwise,
+// retrying throttled pages under the database's ScanBackoff option.
+func (it *SubscriptionsIterator) fetch() ([]map[string]*aws_dynamodb.AttributeValue, map[string]*aws_dynamodb.AttributeValue, error) {
+
+	var limit **int64
+
+	if it.query != nil {
+		limit = &it.query.Limit
+	} else {
+		limit = &it.req.Limit
+	}
+
+	if it.backoff == nil {
+		it.backoff = newPageBackoff(it.options.ScanBackoff, *limit)
+	}
+
+	for {
+
+		items, last_key, scanned, err := it.fetchPage()
+
+		if err == nil {
+			it.backoff.succeeded(scanned, limit)
+			return items, last_key, nil
+		}
+
+		err = it.backoff.retry(it.ctx, err, limit)
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+func (it *SubscriptionsIterator) fetchPage() ([]map[string]*aws_dynamodb.AttributeValue, map[string]*aws_dynamodb.AttributeValue, int64, error) {
+
+	if it.query != nil {
+
+		rsp, err := it.client.QueryWithContext(it.ctx, it.query)
+
+		if err != nil {
+			return nil, nil, 0, err
+		}
+
+		it.query.ExclusiveStartKey = rsp.LastEvaluatedKey
+		return rsp.Items, rsp.LastEvaluatedKey, aws.Int64Value(rsp.ScannedCount), nil
+	}
+
+	rsp, err := it.client.ScanWithContext(it.ctx, it.req)
+
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	it.req.ExclusiveStartKey = rsp.LastEvaluatedKey
+	return rsp.Items, rsp.LastEvaluatedKey, aws.Int64Value(rsp.ScannedCount), nil
+}
+
+// complete reports whether items are read in full, rather than with a projection, and so may be rewritten once
+// they have been upgraded.
+func (it *SubscriptionsIterator) complete() bool {
+
+	if it.query != nil {
+		return it.query.ProjectionExpression == nil
+	}
+
+	return it.req.ProjectionExpression == nil
+}
+
+// Subscription returns the current subscription.
+func (it *SubscriptionsIterator) Subscription() *subscription.Subscription {
+	return it.current
+}
+
+// Page returns the (1-based) number of the page of results the current subscription was read from.
+func (it *SubscriptionsIterator) Page() int {
+	return it.page
+}
+
+// PageStart reports whether the current subscription is the first subscription in a new page of results.
+func (it *SubscriptionsIterator) PageStart() bool {
+	return it.page_start
+}
+
+// Err returns the first error encountered while iterating, if any.
+func (it *SubscriptionsIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iterator; no further pages will be fetched and subsequent calls to `Next` return false.
+func (it *SubscriptionsIterator) Close() error {
+	it.closed = true
+	it.items = nil
+	return nil
+}
@@ -0,0 +1,180 @@
+package dynamodb
+
+import (
+	"context"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// pagedScanClient serves scans from pages, one page per request.
+type pagedScanClient struct {
+	aws_dynamodbiface.DynamoDBAPI
+	pages [][]map[string]*aws_dynamodb.AttributeValue
+	scans int
+}
+
+func (c *pagedScanClient) ScanWithContext(ctx context.Context, req *aws_dynamodb.ScanInput, opts ...request.Option) (*aws_dynamodb.ScanOutput, error) {
+
+	page := 0
+
+	if req.ExclusiveStartKey != nil {
+		page, _ = strconv.Atoi(*req.ExclusiveStartKey["page"].N)
+	}
+
+	c.scans += 1
+
+	rsp := &aws_dynamodb.ScanOutput{
+		Items:        c.pages[page],
+		ScannedCount: aws.Int64(int64(len(c.pages[page]))),
+	}
+
+	if page+1 < len(c.pages) {
+		rsp.LastEvaluatedKey = map[string]*aws_dynamodb.AttributeValue{
+			"page": {N: aws.String(strconv.Itoa(page + 1))},
+		}
+	}
+
+	return rsp, nil
+}
+
+func newPagedScanClient(t *testing.T, opts *DynamoDBSubscriptionsDatabaseOptions, pages ...[]string) *pagedScanClient {
+
+	ctx := context.Background()
+
+	client := &pagedScanClient{}
+
+	for _, addrs := range pages {
+
+		items := make([]map[string]*aws_dynamodb.AttributeValue, len(addrs))
+
+		for i, addr := range addrs {
+
+			sub := &subscription.Subscription{
+				Address: addr,
+				Created: time.Now().Unix(),
+				Status:  subscription.SUBSCRIPTION_STATUS_ENABLED,
+			}
+
+			item, err := subscriptionToItem(ctx, opts, sub)
+
+			if err != nil {
+				t.Fatalf("Failed to create item, %v", err)
+			}
+
+			items[i] = item
+		}
+
+		client.pages = append(client.pages, items)
+	}
+
+	return client
+}
+
+func TestSubscriptionsIteratorPageStart(t *testing.T) {
+
+	ctx := context.Background()
+
+	opts := DefaultDynamoDBSubscriptionsDatabaseOptions()
+
+	client := newPagedScanClient(t, opts,
+		[]string{"skip1@example.com", "a@example.com", "b@example.com"},
+		[]string{"skip2@example.com", "skip3@example.com"},
+		[]string{"c@example.com", "skip4@example.com", "d@example.com"},
+	)
+
+	db := &DynamoDBSubscriptionsDatabase{
+		client:  client,
+		options: opts,
+	}
+
+	it := db.Subscriptions(ctx, nil)
+
+	it.match = func(sub *subscription.Subscription) bool {
+		return sub.Address[:4] != "skip"
+	}
+
+	type result struct {
+		address    string
+		page       int
+		page_start bool
+	}
+
+	expected := []result{
+		{"a@example.com", 1, true},
+		{"b@example.com", 1, false},
+		{"c@example.com", 3, true},
+		{"d@example.com", 3, false},
+	}
+
+	results := make([]result, 0)
+
+	for it.Next() {
+		results = append(results, result{it.Subscription().Address, it.Page(), it.PageStart()})
+	}
+
+	if it.Err() != nil {
+		t.Fatalf("Failed to iterate subscriptions, %v", it.Err())
+	}
+
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, results)
+	}
+
+	for i, r := range results {
+
+		if r != expected[i] {
+			t.Fatalf("Expected %v at position %d, got %v", expected[i], i, r)
+		}
+	}
+}
+
+func TestSubscriptionsIteratorPaging(t *testing.T) {
+
+	ctx := context.Background()
+
+	opts := DefaultDynamoDBSubscriptionsDatabaseOptions()
+
+	client := newPagedScanClient(t, opts,
+		[]string{"a@example.com", "b@example.com"},
+		[]string{},
+		[]string{"c@example.com", "d@example.com"},
+		[]string{"e@example.com"},
+	)
+
+	db := &DynamoDBSubscriptionsDatabase{
+		client:  client,
+		options: opts,
+	}
+
+	it := db.Subscriptions(ctx, &SubscriptionsIteratorOptions{MaxResults: 3})
+
+	addrs := make([]string, 0)
+
+	for it.Next() {
+		addrs = append(addrs, it.Subscription().Address)
+	}
+
+	if it.Err() != nil {
+		t.Fatalf("Failed to iterate subscriptions, %v", it.Err())
+	}
+
+	if len(addrs) != 3 || addrs[0] != "a@example.com" || addrs[2] != "c@example.com" {
+		t.Fatalf("Unexpected subscriptions %v", addrs)
+	}
+
+	// pages are only fetched as they are needed so the last page is never read
+
+	if client.scans != 3 {
+		t.Fatalf("Expected 3 pages to be scanned, got %d", client.scans)
+	}
+
+	if it.Page() != 3 {
+		t.Fatalf("Expected last subscription to be read from page 3, got %d", it.Page())
+	}
+}
@@ -0,0 +1,91 @@
+package dynamodb
+
+import (
+	"context"
+	"encoding/base64"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_kms "github.com/aws/aws-sdk-go/service/kms"
+	aws_kmsiface "github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// KMS_ENCRYPTION_CONTEXT_KEY is the key of the KMS encryption context entry carrying the additional
+// authenticated data passed to `KMSEncryptor`.
+const KMS_ENCRYPTION_CONTEXT_KEY string = "aad"
+
+// KMSEncryptor is an `Encryptor` which encrypts values with an AWS KMS key, so that the key itself never leaves
+// KMS and every decryption is authorized, and logged, by KMS. Values are limited to 4KB.
+type KMSEncryptor struct {
+	client aws_kmsiface.KMSAPI
+	key_id string
+}
+
+func NewKMSEncryptorWithDSN(dsn string, key_id string) (*KMSEncryptor, error) {
+
+	sess, err := NewSessionWithDSN(dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKMSEncryptorWithSession(sess, key_id)
+}
+
+func NewKMSEncryptorWithSession(sess *aws_session.Session, key_id string) (*KMSEncryptor, error) {
+	return NewKMSEncryptorWithClient(aws_kms.New(sess), key_id)
+}
+
+// NewKMSEncryptorWithClient returns a new `KMSEncryptor` that uses 'client' to encrypt values with the KMS key
+// 'key_id', which may be a key ID, key ARN, alias name or alias ARN.
+func NewKMSEncryptorWithClient(client aws_kmsiface.KMSAPI, key_id string) (*KMSEncryptor, error) {
+
+	e := &KMSEncryptor{
+		client: client,
+		key_id: key_id,
+	}
+
+	return e, nil
+}
+
+// Encrypt encrypts 'plaintext', passing 'aad' as the KMS encryption context.
+func (e *KMSEncryptor) Encrypt(ctx context.Context, plaintext []byte, aad []byte) ([]byte, error) {
+
+	req := &aws_kms.EncryptInput{
+		KeyId:             aws.String(e.key_id),
+		Plaintext:         plaintext,
+		EncryptionContext: kmsEncryptionContext(aad),
+	}
+
+	rsp, err := e.client.EncryptWithContext(ctx, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rsp.CiphertextBlob, nil
+}
+
+// Decrypt decrypts 'ciphertext', which must have been encrypted with the same key and 'aad'.
+func (e *KMSEncryptor) Decrypt(ctx context.Context, ciphertext []byte, aad []byte) ([]byte, error) {
+
+	req := &aws_kms.DecryptInput{
+		KeyId:             aws.String(e.key_id),
+		CiphertextBlob:    ciphertext,
+		EncryptionContext: kmsEncryptionContext(aad),
+	}
+
+	rsp, err := e.client.DecryptWithContext(ctx, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rsp.Plaintext, nil
+}
+
+func kmsEncryptionContext(aad []byte) map[string]*string {
+
+	return map[string]*string{
+		KMS_ENCRYPTION_CONTEXT_KEY: aws.String(base64.StdEncoding.EncodeToString(aad)),
+	}
+}
@@ -0,0 +1,350 @@
+// package lambda provides AWS Lambda handlers, for subscribing, confirming, unsubscribing and processing SES
+// feedback notifications, wired to the DynamoDB databases so that a mailing list can be run without servers.
+//
+// `HandleRequest` serves API Gateway HTTP API (or Lambda function URL) requests, dispatching on the last element of the
+// path: `subscribe` starts a double opt-in for the `address` parameter and sends the confirmation code using
+// `SendConfirmation`, `confirm` redeems the `code` parameter and `unsubscribe` marks the subscription for the
+// unsubscribe `token` parameter as unsubscribed, including RFC 8058 one-click requests. Parameters are read from the
+// query string and from form-encoded or JSON bodies. `SESFeedback` processes SES bounce and complaint notifications
+// delivered by SNS, incrementing the subscription's counters and marking it as bounced or suppressed.
+//
+//	import (
+//		aws_lambda "github.com/aws/aws-lambda-go/lambda"
+//		"github.com/aaronland/go-mailinglist-database-dynamodb/lambda"
+//	)
+//
+//	h, err := lambda.NewHandlers(&lambda.HandlersOptions{
+//		Subscriptions:     subs_db,
+//		Confirmations:     conf_db,
+//		UnsubscribeTokens: tokens_db,
+//		SendConfirmation:  send_confirmation,
+//		SoftBounceLimit:   5,
+//	})
+//
+//	aws_lambda.Start(h.HandleRequest)	// or h.SESFeedback, for a function subscribed to the SES feedback topic
+//
+// Only permanent bounces mark a subscription as bounced unless `SoftBounceLimit` is set, in which case any subscription
+// with that many bounces is. Errors are returned as JSON with a status code for their kind, for example 404 for unknown
+// codes and tokens, 410 for expired confirmations and 403 for blocked addresses.
+package lambda
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist-database-dynamodb/optin"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	"github.com/aaronland/go-mailinglist/subscription"
+	"github.com/aws/aws-lambda-go/events"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// SendConfirmationFunc is a function used to send the code of the opt-in confirmation 'conf' to the subscriber for 'sub'.
+// Use `DynamoDBConfirmationsDatabase.ConfirmationExpires` for the time after which the code no longer works.
+type SendConfirmationFunc func(context.Context, *subscription.Subscription, *confirmation.Confirmation) error
+
+// HandlersOptions defines the databases and settings used by `Handlers`.
+type HandlersOptions struct {
+	// Subscriptions is the subscriptions database. It is required.
+	Subscriptions *dynamodb.DynamoDBSubscriptionsDatabase
+	// Confirmations is the confirmations database used for opt-in confirmations. It is required by the subscribe
+	// and confirm handlers.
+	Confirmations *dynamodb.DynamoDBConfirmationsDatabase
+	// UnsubscribeTokens is the unsubscribe tokens database used to resolve the "token" parameter of unsubscribe
+	// requests. It is required by the unsubscribe handler.
+	UnsubscribeTokens *dynamodb.DynamoDBUnsubscribeTokensDatabase
+	// SendConfirmation is the function used to send opt-in confirmation codes. It is required by the subscribe handler.
+	SendConfirmation SendConfirmationFunc
+	// SoftBounceLimit is the number of bounces, including transient bounces, after which SES feedback marks a
+	// subscription as bounced. If zero only permanent bounces mark a subscription as bounced.
+	SoftBounceLimit int64
+}
+
+// Handlers provides AWS Lambda handlers for API Gateway HTTP API (and Lambda function URL) requests and for
+// SES feedback notifications delivered by SNS.
+type Handlers struct {
+	options *HandlersOptions
+	optin   *optin.OptIn
+}
+
+// NewHandlers returns a new `Handlers` instance configured by 'opts'.
+func NewHandlers(opts *HandlersOptions) (*Handlers, error) {
+
+	if opts.Subscriptions == nil {
+		return nil, fmt.Errorf("Missing subscriptions database")
+	}
+
+	h := &Handlers{
+		options: opts,
+	}
+
+	if opts.Confirmations != nil {
+		h.optin = optin.NewOptIn(opts.Subscriptions, opts.Confirmations)
+	}
+
+	return h, nil
+}
+
+// HandleRequest dispatches 'req' to `Subscribe`, `Confirm` or `Unsubscribe` according to the last element of its
+// path ("subscribe", "confirm" or "unsubscribe"), so that a single function can serve every route.
+func (h *Handlers) HandleRequest(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+
+	switch path.Base(req.RawPath) {
+	case "subscribe":
+		return h.Subscribe(ctx, req)
+	case "confirm":
+		return h.Confirm(ctx, req)
+	case "unsubscribe":
+		return h.Unsubscribe(ctx, req)
+	default:
+		return errorResponse(http.StatusNotFound, fmt.Errorf("Not found"))
+	}
+}
+
+// Subscribe starts the opt-in process for the "address" parameter of 'req', creating an unconfirmed subscription
+// and a confirmation whose code is sent using the SendConfirmation option. Requests for addresses which are
+// already subscribed succeed without sending anything.
+func (h *Handlers) Subscribe(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+
+	if h.optin == nil || h.options.SendConfirmation == nil {
+		return errorResponse(http.StatusNotImplemented, fmt.Errorf("Subscriptions are not enabled"))
+	}
+
+	params, err := requestParameters(req)
+
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err)
+	}
+
+	addr := params.Get("address")
+
+	_, err = subscription.NewSubscription(addr)
+
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, fmt.Errorf("Invalid address, %w", err))
+	}
+
+	sub, conf, err := h.optin.Start(ctx, addr)
+
+	if errors.Is(err, optin.ErrAlreadySubscribed) {
+		return jsonResponse(http.StatusOK, map[string]string{"status": string(dynamodb.STATUS_ACTIVE)})
+	}
+
+	if err != nil {
+		return databaseErrorResponse(err)
+	}
+
+	err = h.options.SendConfirmation(ctx, sub, conf)
+
+	if err != nil {
+		return databaseErrorResponse(fmt.Errorf("Failed to send confirmation, %w", err))
+	}
+
+	return jsonResponse(http.StatusAccepted, map[string]string{"status": string(dynamodb.STATUS_PENDING)})
+}
+
+// Confirm completes the opt-in process for the confirmation matching the "code" parameter of 'req'.
+func (h *Handlers) Confirm(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+
+	if h.optin == nil {
+		return errorResponse(http.StatusNotImplemented, fmt.Errorf("Confirmations are not enabled"))
+	}
+
+	params, err := requestParameters(req)
+
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err)
+	}
+
+	code := params.Get("code")
+
+	if code == "" {
+		return errorResponse(http.StatusBadRequest, fmt.Errorf("Missing code"))
+	}
+
+	_, err = h.optin.Complete(ctx, code)
+
+	if err != nil {
+		return databaseErrorResponse(err)
+	}
+
+	return jsonResponse(http.StatusOK, map[string]string{"status": string(dynamodb.STATUS_ACTIVE)})
+}
+
+// Unsubscribe marks the subscription for the unsubscribe token in the "token" parameter of 'req' as unsubscribed.
+// It accepts both unsubscribe links and RFC 8058 one-click (List-Unsubscribe-Post) requests. Subscriptions which
+// are already unsubscribed, bounced or suppressed are left unchanged.
+func (h *Handlers) Unsubscribe(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+
+	if h.options.UnsubscribeTokens == nil {
+		return errorResponse(http.StatusNotImplemented, fmt.Errorf("Unsubscribe tokens are not enabled"))
+	}
+
+	params, err := requestParameters(req)
+
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err)
+	}
+
+	token := params.Get("token")
+
+	if token == "" {
+		return errorResponse(http.StatusBadRequest, fmt.Errorf("Missing token"))
+	}
+
+	t, err := h.options.UnsubscribeTokens.GetUnsubscribeTokenWithToken(ctx, token)
+
+	if err != nil {
+		return databaseErrorResponse(err)
+	}
+
+	status, err := h.options.Subscriptions.GetSubscriptionStatus(ctx, t.Address)
+
+	if err != nil {
+		return databaseErrorResponse(err)
+	}
+
+	switch status {
+	case dynamodb.STATUS_UNSUBSCRIBED, dynamodb.STATUS_BOUNCED, dynamodb.STATUS_SUPPRESSED:
+		// pass
+	default:
+
+		err = h.options.Subscriptions.UpdateSubscriptionStatus(ctx, t.Address, dynamodb.STATUS_UNSUBSCRIBED)
+
+		if err != nil {
+			return databaseErrorResponse(err)
+		}
+	}
+
+	return jsonResponse(http.StatusOK, map[string]string{"status": string(dynamodb.STATUS_UNSUBSCRIBED)})
+}
+
+// requestParameters returns the query string parameters of 'req' followed by those in its body, which may be
+// either form-encoded or a JSON object of strings.
+func requestParameters(req events.APIGatewayV2HTTPRequest) (url.Values, error) {
+
+	params := url.Values{}
+
+	for k, v := range req.QueryStringParameters {
+		params.Add(k, v)
+	}
+
+	body := req.Body
+
+	if req.IsBase64Encoded {
+
+		b, err := base64.StdEncoding.DecodeString(body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode body, %w", err)
+		}
+
+		body = string(b)
+	}
+
+	if strings.TrimSpace(body) == "" {
+		return params, nil
+	}
+
+	content_type := ""
+
+	for k, v := range req.Headers {
+
+		if strings.EqualFold(k, "content-type") {
+			content_type = v
+			break
+		}
+	}
+
+	if strings.HasPrefix(content_type, "application/json") {
+
+		var values map[string]string
+
+		err := json.Unmarshal([]byte(body), &values)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode body, %w", err)
+		}
+
+		for k, v := range values {
+			params.Add(k, v)
+		}
+
+		return params, nil
+	}
+
+	values, err := url.ParseQuery(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse body, %w", err)
+	}
+
+	for k, v := range values {
+		params[k] = append(params[k], v...)
+	}
+
+	return params, nil
+}
+
+func databaseErrorResponse(err error) (events.APIGatewayV2HTTPResponse, error) {
+
+	status := http.StatusInternalServerError
+
+	// expired confirmations are also reported as missing records so check for them first
+
+	switch {
+	case errors.Is(err, dynamodb.ErrConfirmationExpired):
+		status = http.StatusGone
+	case dynamodb.IsNotExist(err):
+		status = http.StatusNotFound
+	case errors.Is(err, dynamodb.ErrInvalid), errors.Is(err, optin.ErrInvalidAction):
+		status = http.StatusBadRequest
+	case errors.Is(err, optin.ErrBlocked):
+		status = http.StatusForbidden
+	case errors.Is(err, dynamodb.ErrInvalidTransition), errors.Is(err, dynamodb.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, dynamodb.ErrThrottled):
+		status = http.StatusServiceUnavailable
+	}
+
+	if status == http.StatusInternalServerError {
+		log.Printf("Failed to handle request, %v", err)
+	}
+
+	return errorResponse(status, err)
+}
+
+func errorResponse(status int, err error) (events.APIGatewayV2HTTPResponse, error) {
+
+	body := map[string]string{
+		"error": err.Error(),
+	}
+
+	return jsonResponse(status, body)
+}
+
+func jsonResponse(status int, body interface{}) (events.APIGatewayV2HTTPResponse, error) {
+
+	enc, err := json.Marshal(body)
+
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("Failed to encode response, %w", err)
+	}
+
+	rsp := events.APIGatewayV2HTTPResponse{
+		StatusCode: status,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: string(enc),
+	}
+
+	return rsp, nil
+}
@@ -0,0 +1,149 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// sesNotification is the subset of an SES bounce or complaint notification, or of an SES event published to
+// SNS by a configuration set, used by `SESFeedback`.
+type sesNotification struct {
+	NotificationType string        `json:"notificationType"`
+	EventType        string        `json:"eventType"`
+	Bounce           *sesBounce    `json:"bounce"`
+	Complaint        *sesComplaint `json:"complaint"`
+}
+
+type sesBounce struct {
+	BounceType        string         `json:"bounceType"`
+	BouncedRecipients []sesRecipient `json:"bouncedRecipients"`
+}
+
+type sesComplaint struct {
+	ComplainedRecipients []sesRecipient `json:"complainedRecipients"`
+}
+
+type sesRecipient struct {
+	EmailAddress string `json:"emailAddress"`
+}
+
+// SESFeedback processes the SES bounce and complaint notifications in 'ev'. Every bounce increments the bounce
+// counter of the recipient's subscription and permanent bounces (or, if the SoftBounceLimit option is set, enough
+// bounces of any kind) mark it as bounced. Complaints increment the complaint counter and mark the subscription
+// as suppressed. Recipients without a subscription, and other notification types, are ignored. As with the
+// sync-ses-suppression tool a complaint outranks a bounce, so suppressed subscriptions are never marked as bounced.
+func (h *Handlers) SESFeedback(ctx context.Context, ev events.SNSEvent) error {
+
+	for _, r := range ev.Records {
+
+		var n sesNotification
+
+		err := json.Unmarshal([]byte(r.SNS.Message), &n)
+
+		if err != nil {
+			return fmt.Errorf("Failed to decode SES notification %s, %w", r.SNS.MessageID, err)
+		}
+
+		kind := n.NotificationType
+
+		if kind == "" {
+			kind = n.EventType
+		}
+
+		switch kind {
+		case "Bounce":
+
+			if n.Bounce == nil {
+				continue
+			}
+
+			for _, rcpt := range n.Bounce.BouncedRecipients {
+
+				err := h.recordBounce(ctx, rcpt.EmailAddress, n.Bounce.BounceType == "Permanent")
+
+				if err != nil {
+					return err
+				}
+			}
+
+		case "Complaint":
+
+			if n.Complaint == nil {
+				continue
+			}
+
+			for _, rcpt := range n.Complaint.ComplainedRecipients {
+
+				err := h.recordComplaint(ctx, rcpt.EmailAddress)
+
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (h *Handlers) recordBounce(ctx context.Context, addr string, permanent bool) error {
+
+	count, err := h.options.Subscriptions.IncrementBounceCount(ctx, addr)
+
+	if dynamodb.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to increment bounce count for %s, %w", addr, err)
+	}
+
+	if !permanent && (h.options.SoftBounceLimit <= 0 || count < h.options.SoftBounceLimit) {
+		return nil
+	}
+
+	return h.setStatus(ctx, addr, dynamodb.STATUS_BOUNCED)
+}
+
+func (h *Handlers) recordComplaint(ctx context.Context, addr string) error {
+
+	_, err := h.options.Subscriptions.IncrementComplaintCount(ctx, addr)
+
+	if dynamodb.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to increment complaint count for %s, %w", addr, err)
+	}
+
+	return h.setStatus(ctx, addr, dynamodb.STATUS_SUPPRESSED)
+}
+
+func (h *Handlers) setStatus(ctx context.Context, addr string, status dynamodb.SubscriptionStatus) error {
+
+	current, err := h.options.Subscriptions.GetSubscriptionStatus(ctx, addr)
+
+	if dynamodb.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to get subscription status for %s, %w", addr, err)
+	}
+
+	if current == status || current == dynamodb.STATUS_SUPPRESSED {
+		return nil
+	}
+
+	err = h.options.Subscriptions.SetSubscriptionStatus(ctx, addr, status)
+
+	if err != nil {
+		return fmt.Errorf("Failed to set subscription status for %s, %w", addr, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package dynamodb
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws/request"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"math"
+	"sync"
+	"time"
+)
+
+// CapacityLimiter is a client-side token-bucket limiter which caps the read and write capacity units consumed per
+// second by the databases it is assigned to (see the CapacityLimiter option) so that background jobs, like purges
+// and exports, can not starve interactive requests of a provisioned table's capacity. Since the capacity a request
+// consumes is only known once it completes, each request waits until its bucket is no longer in debt and then its
+// consumed capacity is deducted, which may put the bucket into debt again. A limiter may be shared by several
+// databases, in which case their combined consumption is capped, and is safe for concurrent use.
+type CapacityLimiter struct {
+	mu    sync.Mutex
+	read  *capacityBucket
+	write *capacityBucket
+}
+
+type capacityBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// NewCapacityLimiter returns a new `CapacityLimiter` which allows 'read_units' read capacity units and 'write_units'
+// write capacity units to be consumed per second, with bursts of up to one second's worth of each. Zero allows
+// unlimited capacity of that kind.
+func NewCapacityLimiter(read_units float64, write_units float64) *CapacityLimiter {
+
+	l := &CapacityLimiter{
+		read:  newCapacityBucket(read_units),
+		write: newCapacityBucket(write_units),
+	}
+
+	return l
+}
+
+func newCapacityBucket(rate float64) *capacityBucket {
+
+	if rate <= 0 {
+		return nil
+	}
+
+	b := &capacityBucket{
+		rate:   rate,
+		tokens: rate,
+		last:   time.Now(),
+	}
+
+	return b
+}
+
+// refill adds the tokens accrued since the bucket was last refilled, up to one second's worth.
+func (b *capacityBucket) refill(now time.Time) {
+
+	b.tokens = math.Min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// Wait blocks until a request of the kind described by 'write' may be sent, or 'ctx' is cancelled.
+func (l *CapacityLimiter) Wait(ctx context.Context, write bool) error {
+
+	for {
+
+		delay := l.delay(write)
+
+		if delay <= 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// delay returns how long a request must wait for the debt in its bucket to be repaid.
+func (l *CapacityLimiter) delay(write bool) time.Duration {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(write)
+
+	if b == nil {
+		return 0
+	}
+
+	b.refill(time.Now())
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Consume deducts 'units' of read or write capacity, described by 'write', from the limiter.
+func (l *CapacityLimiter) Consume(write bool, units float64) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(write)
+
+	if b == nil {
+		return
+	}
+
+	b.refill(time.Now())
+	b.tokens -= units
+}
+
+func (l *CapacityLimiter) bucket(write bool) *capacityBucket {
+
+	if write {
+		return l.write
+	}
+
+	return l.read
+}
+
+// addCapacityLimiterHandlers configures 'client' to wait for 'l' before sending (or retrying) each request and
+// to deduct the capacity each successful request consumed from it. Consumed capacity is requested, at the TOTAL
+// level of detail, for every request which does not already ask for it.
+func addCapacityLimiterHandlers(client *aws_dynamodb.DynamoDB, l *CapacityLimiter) {
+
+	client.Handlers.Build.PushBack(func(r *request.Request) {
+
+		if !hasReturnConsumedCapacity(r.Params) {
+			setReturnConsumedCapacity(r.Params, aws_dynamodb.ReturnConsumedCapacityTotal)
+		}
+	})
+
+	client.Handlers.Sign.PushFront(func(r *request.Request) {
+
+		err := l.Wait(r.Context(), isWriteOperation(r.Operation.Name))
+
+		if err != nil {
+			r.Error = err
+		}
+	})
+
+	client.Handlers.Complete.PushBack(func(r *request.Request) {
+
+		if r.Error != nil {
+			return
+		}
+
+		write := isWriteOperation(r.Operation.Name)
+
+		for _, c := range consumedCapacity(r.Data) {
+
+			switch {
+			case c.ReadCapacityUnits != nil || c.WriteCapacityUnits != nil:
+
+				if c.ReadCapacityUnits != nil {
+					l.Consume(false, *c.ReadCapacityUnits)
+				}
+
+				if c.WriteCapacityUnits != nil {
+					l.Consume(true, *c.WriteCapacityUnits)
+				}
+
+			case c.CapacityUnits != nil:
+				l.Consume(write, *c.CapacityUnits)
+			}
+		}
+	})
+}
+
+// isWriteOperation reports whether the DynamoDB API operation 'name' consumes write, rather than read, capacity.
+func isWriteOperation(name string) bool {
+
+	switch name {
+	case "PutItem", "UpdateItem", "DeleteItem", "BatchWriteItem", "TransactWriteItems":
+		return true
+	default:
+		return false
+	}
+}
+
+func hasReturnConsumedCapacity(params interface{}) bool {
+
+	switch req := params.(type) {
+	case *aws_dynamodb.GetItemInput:
+		return req.ReturnConsumedCapacity != nil
+	case *aws_dynamodb.PutItemInput:
+		return req.ReturnConsumedCapacity != nil
+	case *aws_dynamodb.UpdateItemInput:
+		return req.ReturnConsumedCapacity != nil
+	case *aws_dynamodb.DeleteItemInput:
+		return req.ReturnConsumedCapacity != nil
+	case *aws_dynamodb.QueryInput:
+		return req.ReturnConsumedCapacity != nil
+	case *aws_dynamodb.ScanInput:
+		return req.ReturnConsumedCapacity != nil
+	case *aws_dynamodb.BatchGetItemInput:
+		return req.ReturnConsumedCapacity != nil
+	case *aws_dynamodb.BatchWriteItemInput:
+		return req.ReturnConsumedCapacity != nil
+	case *aws_dynamodb.TransactGetItemsInput:
+		return req.ReturnConsumedCapacity != nil
+	case *aws_dynamodb.TransactWriteItemsInput:
+		return req.ReturnConsumedCapacity != nil
+	default:
+		return true
+	}
+}
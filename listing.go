@@ -0,0 +1,41 @@
+package dynamodb
+
+import (
+	"errors"
+	"github.com/aaronland/go-mailinglist/database"
+	"github.com/aaronland/go-mailinglist/subscription"
+)
+
+// errStopListing is returned by callbacks created by limitSubscriptionsCallback to stop a listing early.
+var errStopListing = errors.New("Stop listing")
+
+// limitSubscriptionsCallback wraps 'cb' so that the listing stops, with errStopListing, after 'max' subscriptions
+// have been processed. If 'max' is less than one 'cb' is returned as-is.
+func limitSubscriptionsCallback(max int, cb database.ListSubscriptionsFunc) database.ListSubscriptionsFunc {
+
+	if max < 1 {
+		return cb
+	}
+
+	count := 0
+
+	return func(sub *subscription.Subscription) error {
+
+		if count >= max {
+			return errStopListing
+		}
+
+		count += 1
+		return cb(sub)
+	}
+}
+
+// stopListingError returns nil if 'err' is errStopListing, otherwise it returns 'err'.
+func stopListingError(err error) error {
+
+	if errors.Is(err, errStopListing) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,261 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"sort"
+	"strings"
+)
+
+// METADATA_ATTRIBUTE is the name of the map attribute recording arbitrary metadata, for example a subscriber's
+// name or signup source, for a subscription.
+const METADATA_ATTRIBUTE string = "metadata"
+
+// GetSubscriptionMetadata returns the metadata for the subscription for 'addr'. The map is empty if no metadata
+// has been set.
+func (db *DynamoDBSubscriptionsDatabase) GetSubscriptionMetadata(ctx context.Context, addr string) (map[string]string, error) {
+
+	ctx = withOperation(ctx, "GetSubscriptionMetadata")
+
+	req := &aws_dynamodb.GetItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"address": {
+				S: aws.String(db.options.addressKey(addr)),
+			},
+		},
+		ProjectionExpression: aws.String("#address, #metadata"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address":  aws.String("address"),
+			"#metadata": aws.String(METADATA_ATTRIBUTE),
+		},
+	}
+
+	rsp, err := db.client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	if rsp.Item == nil {
+		return nil, new(database.NoRecordError)
+	}
+
+	metadata := make(map[string]string)
+
+	v, ok := rsp.Item[METADATA_ATTRIBUTE]
+
+	if ok {
+
+		err := aws_dynamodbattribute.Unmarshal(v, &metadata)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal metadata, %w", err)
+		}
+	}
+
+	return metadata, nil
+}
+
+// SetSubscriptionMetadata sets the keys in 'metadata' for the subscription for 'addr', leaving any other keys
+// unchanged. Each key is updated individually, using UpdateItem requests with document paths, rather than by
+// rewriting the item or the whole map. It returns a `database.NoRecordError` if there is no subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) SetSubscriptionMetadata(ctx context.Context, addr string, metadata map[string]string) error {
+
+	ctx = withOperation(ctx, "SetSubscriptionMetadata")
+
+	keys, err := metadataKeys(metadata)
+
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	key := map[string]*aws_dynamodb.AttributeValue{
+		"address": {
+			S: aws.String(db.options.addressKey(addr)),
+		},
+	}
+
+	// document paths can only be set in a map which already exists so the first metadata for a subscription
+	// is written as a whole map, conditional on there still being no map, and the loop retried if another
+	// request created one first
+
+	for attempt := 0; attempt < 2; attempt++ {
+
+		names := map[string]*string{
+			"#address":  aws.String("address"),
+			"#metadata": aws.String(METADATA_ATTRIBUTE),
+		}
+
+		values := make(map[string]*aws_dynamodb.AttributeValue)
+		set := make([]string, len(keys))
+
+		for i, k := range keys {
+
+			name := fmt.Sprintf("#k%d", i)
+			value := fmt.Sprintf(":v%d", i)
+
+			names[name] = aws.String(k)
+			values[value] = &aws_dynamodb.AttributeValue{
+				S: aws.String(metadata[k]),
+			}
+
+			set[i] = fmt.Sprintf("#metadata.%s = %s", name, value)
+		}
+
+		req := &aws_dynamodb.UpdateItemInput{
+			TableName:                 aws.String(db.options.FullTableName()),
+			Key:                       key,
+			UpdateExpression:          aws.String("SET " + strings.Join(set, ", ")),
+			ConditionExpression:       aws.String("attribute_exists(#address) AND attribute_exists(#metadata)"),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		}
+
+		_, err := db.client.UpdateItemWithContext(ctx, req)
+
+		if err == nil {
+			return nil
+		}
+
+		err = wrapError(err)
+
+		if !errors.Is(err, ErrConditionFailed) {
+			return err
+		}
+
+		enc, err := aws_dynamodbattribute.Marshal(metadata)
+
+		if err != nil {
+			return fmt.Errorf("Failed to marshal metadata, %w", err)
+		}
+
+		req = &aws_dynamodb.UpdateItemInput{
+			TableName:           aws.String(db.options.FullTableName()),
+			Key:                 key,
+			UpdateExpression:    aws.String("SET #metadata = :metadata"),
+			ConditionExpression: aws.String("attribute_exists(#address) AND attribute_not_exists(#metadata)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#address":  aws.String("address"),
+				"#metadata": aws.String(METADATA_ATTRIBUTE),
+			},
+			ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+				":metadata": enc,
+			},
+		}
+
+		_, err = db.client.UpdateItemWithContext(ctx, req)
+
+		if err == nil {
+			return nil
+		}
+
+		err = wrapError(err)
+
+		if !errors.Is(err, ErrConditionFailed) {
+			return err
+		}
+
+		_, get_err := db.getSubscriptionWithAddress(ctx, addr)
+
+		if get_err != nil {
+			return get_err
+		}
+	}
+
+	return fmt.Errorf("Failed to set metadata for %s, %w", addr, ErrConflict)
+}
+
+// RemoveSubscriptionMetadata removes 'keys' from the metadata for the subscription for 'addr', leaving any other
+// keys unchanged. Keys which are not set are ignored. It returns a `database.NoRecordError` if there is no
+// subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) RemoveSubscriptionMetadata(ctx context.Context, addr string, keys ...string) error {
+
+	ctx = withOperation(ctx, "RemoveSubscriptionMetadata")
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	names := map[string]*string{
+		"#address":  aws.String("address"),
+		"#metadata": aws.String(METADATA_ATTRIBUTE),
+	}
+
+	remove := make([]string, len(keys))
+
+	for i, k := range keys {
+
+		if k == "" {
+			return validationError("subscription", METADATA_ATTRIBUTE, k, "key is empty")
+		}
+
+		name := fmt.Sprintf("#k%d", i)
+		names[name] = aws.String(k)
+
+		remove[i] = "#metadata." + name
+	}
+
+	req := &aws_dynamodb.UpdateItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"address": {
+				S: aws.String(db.options.addressKey(addr)),
+			},
+		},
+		UpdateExpression:         aws.String("REMOVE " + strings.Join(remove, ", ")),
+		ConditionExpression:      aws.String("attribute_exists(#address) AND attribute_exists(#metadata)"),
+		ExpressionAttributeNames: names,
+	}
+
+	_, err := db.client.UpdateItemWithContext(ctx, req)
+
+	if err == nil {
+		return nil
+	}
+
+	err = wrapError(err)
+
+	if !errors.Is(err, ErrConditionFailed) {
+		return err
+	}
+
+	// the condition fails both when there is no subscription and when it has no metadata to remove
+	// so check which it was
+
+	_, get_err := db.getSubscriptionWithAddress(ctx, addr)
+
+	if get_err != nil {
+		return get_err
+	}
+
+	return nil
+}
+
+// metadataKeys returns the keys of 'metadata', sorted so that requests are deterministic. It returns a
+// `ValidationError` if any key is empty.
+func metadataKeys(metadata map[string]string) ([]string, error) {
+
+	keys := make([]string, 0, len(metadata))
+
+	for k := range metadata {
+
+		if k == "" {
+			return nil, validationError("subscription", METADATA_ATTRIBUTE, k, "key is empty")
+		}
+
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,230 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// Operation describes a DynamoDB request issued by a database method.
+type Operation struct {
+	// Name is the name of the database method, for example "AddSubscription", that issued the request or the
+	// name of the DynamoDB API operation if the request wasn't issued by a database method.
+	Name string
+	// API is the name of the DynamoDB API operation, for example "PutItem".
+	API string
+	// Table is the name of the table the request reads from or writes to. It is empty for batch and transactional
+	// requests, which may span several tables.
+	Table string
+	// Input is the request's input, for example a `*dynamodb.PutItemInput`. Middleware may inspect, but should
+	// not modify, it.
+	Input interface{}
+}
+
+// Handler performs, or continues performing, a database operation.
+type Handler func(ctx context.Context) error
+
+// Middleware wraps the Handler 'next' for the operation 'op', for example to validate, audit or rate limit
+// requests. Returning an error without invoking 'next' prevents the request from being sent.
+type Middleware func(op Operation, next Handler) Handler
+
+// middlewareClient is a DynamoDB client that invokes a chain of middleware around each of the data plane
+// requests issued by the databases in this package.
+type middlewareClient struct {
+	aws_dynamodbiface.DynamoDBAPI
+	middleware []Middleware
+}
+
+// withMiddleware returns 'client' wrapped so that each request is passed through 'middleware', the first of which
+// is outermost. If 'middleware' is empty 'client' is returned as-is.
+func withMiddleware(client aws_dynamodbiface.DynamoDBAPI, middleware []Middleware) aws_dynamodbiface.DynamoDBAPI {
+
+	if len(middleware) == 0 {
+		return client
+	}
+
+	return &middlewareClient{
+		DynamoDBAPI: client,
+		middleware:  middleware,
+	}
+}
+
+// middleware returns the chain of `Middleware` for 's': its Middleware setting followed, if the ReadOnly setting is
+// true, by `readOnlyMiddleware` so that every other middleware still sees the rejected requests.
+func (s *tableSettings) middleware() []Middleware {
+
+	if !*s.ReadOnly {
+		return *s.Middleware
+	}
+
+	middleware := make([]Middleware, 0, len(*s.Middleware)+1)
+	middleware = append(middleware, *s.Middleware...)
+
+	return append(middleware, readOnlyMiddleware)
+}
+
+// readOnlyMiddleware is a `Middleware` which rejects every request which would write to a table with ErrReadOnly.
+func readOnlyMiddleware(op Operation, next Handler) Handler {
+
+	switch op.API {
+	case "PutItem", "UpdateItem", "DeleteItem", "BatchWriteItem", "TransactWriteItems":
+
+		return func(ctx context.Context) error {
+			return fmt.Errorf("Failed to %s (%s), %w", op.API, op.Name, ErrReadOnly)
+		}
+
+	default:
+		return next
+	}
+}
+
+func (c *middlewareClient) run(ctx context.Context, api string, table *string, input interface{}, h Handler) error {
+
+	name, ok := operationFromContext(ctx)
+
+	if !ok {
+		name = api
+	}
+
+	op := Operation{
+		Name:  name,
+		API:   api,
+		Table: aws.StringValue(table),
+		Input: input,
+	}
+
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		h = c.middleware[i](op, h)
+	}
+
+	return h(ctx)
+}
+
+func (c *middlewareClient) GetItemWithContext(ctx aws.Context, input *aws_dynamodb.GetItemInput, opts ...request.Option) (*aws_dynamodb.GetItemOutput, error) {
+
+	var rsp *aws_dynamodb.GetItemOutput
+
+	err := c.run(ctx, "GetItem", input.TableName, input, func(ctx context.Context) error {
+
+		var err error
+		rsp, err = c.DynamoDBAPI.GetItemWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return rsp, err
+}
+
+func (c *middlewareClient) PutItemWithContext(ctx aws.Context, input *aws_dynamodb.PutItemInput, opts ...request.Option) (*aws_dynamodb.PutItemOutput, error) {
+
+	var rsp *aws_dynamodb.PutItemOutput
+
+	err := c.run(ctx, "PutItem", input.TableName, input, func(ctx context.Context) error {
+
+		var err error
+		rsp, err = c.DynamoDBAPI.PutItemWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return rsp, err
+}
+
+func (c *middlewareClient) UpdateItemWithContext(ctx aws.Context, input *aws_dynamodb.UpdateItemInput, opts ...request.Option) (*aws_dynamodb.UpdateItemOutput, error) {
+
+	var rsp *aws_dynamodb.UpdateItemOutput
+
+	err := c.run(ctx, "UpdateItem", input.TableName, input, func(ctx context.Context) error {
+
+		var err error
+		rsp, err = c.DynamoDBAPI.UpdateItemWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return rsp, err
+}
+
+func (c *middlewareClient) DeleteItemWithContext(ctx aws.Context, input *aws_dynamodb.DeleteItemInput, opts ...request.Option) (*aws_dynamodb.DeleteItemOutput, error) {
+
+	var rsp *aws_dynamodb.DeleteItemOutput
+
+	err := c.run(ctx, "DeleteItem", input.TableName, input, func(ctx context.Context) error {
+
+		var err error
+		rsp, err = c.DynamoDBAPI.DeleteItemWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return rsp, err
+}
+
+func (c *middlewareClient) QueryWithContext(ctx aws.Context, input *aws_dynamodb.QueryInput, opts ...request.Option) (*aws_dynamodb.QueryOutput, error) {
+
+	var rsp *aws_dynamodb.QueryOutput
+
+	err := c.run(ctx, "Query", input.TableName, input, func(ctx context.Context) error {
+
+		var err error
+		rsp, err = c.DynamoDBAPI.QueryWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return rsp, err
+}
+
+func (c *middlewareClient) ScanWithContext(ctx aws.Context, input *aws_dynamodb.ScanInput, opts ...request.Option) (*aws_dynamodb.ScanOutput, error) {
+
+	var rsp *aws_dynamodb.ScanOutput
+
+	err := c.run(ctx, "Scan", input.TableName, input, func(ctx context.Context) error {
+
+		var err error
+		rsp, err = c.DynamoDBAPI.ScanWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return rsp, err
+}
+
+func (c *middlewareClient) BatchGetItemWithContext(ctx aws.Context, input *aws_dynamodb.BatchGetItemInput, opts ...request.Option) (*aws_dynamodb.BatchGetItemOutput, error) {
+
+	var rsp *aws_dynamodb.BatchGetItemOutput
+
+	err := c.run(ctx, "BatchGetItem", nil, input, func(ctx context.Context) error {
+
+		var err error
+		rsp, err = c.DynamoDBAPI.BatchGetItemWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return rsp, err
+}
+
+func (c *middlewareClient) BatchWriteItemWithContext(ctx aws.Context, input *aws_dynamodb.BatchWriteItemInput, opts ...request.Option) (*aws_dynamodb.BatchWriteItemOutput, error) {
+
+	var rsp *aws_dynamodb.BatchWriteItemOutput
+
+	err := c.run(ctx, "BatchWriteItem", nil, input, func(ctx context.Context) error {
+
+		var err error
+		rsp, err = c.DynamoDBAPI.BatchWriteItemWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return rsp, err
+}
+
+func (c *middlewareClient) TransactWriteItemsWithContext(ctx aws.Context, input *aws_dynamodb.TransactWriteItemsInput, opts ...request.Option) (*aws_dynamodb.TransactWriteItemsOutput, error) {
+
+	var rsp *aws_dynamodb.TransactWriteItemsOutput
+
+	err := c.run(ctx, "TransactWriteItems", nil, input, func(ctx context.Context) error {
+
+		var err error
+		rsp, err = c.DynamoDBAPI.TransactWriteItemsWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return rsp, err
+}
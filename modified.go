@@ -0,0 +1,117 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strconv"
+	"time"
+)
+
+// SUBSCRIPTIONS_MODIFIED_INDEX is the name of the global secondary index used by `ListSubscriptionsModifiedSince`.
+const SUBSCRIPTIONS_MODIFIED_INDEX string = "modified"
+
+// MODIFIED_DAY_ATTRIBUTE is the name of the attribute containing the UTC day, as YYYY-MM-DD, a subscription was
+// last modified and its write shard (see `shardKey`), for example "2024-05-01#3". It is the partition key of the
+// SUBSCRIPTIONS_MODIFIED_INDEX index, whose sort key is "lastmodified".
+const MODIFIED_DAY_ATTRIBUTE string = "lastmodified_day"
+
+// MODIFIED_DAY_FORMAT is the layout, as used by `time.Format`, of MODIFIED_DAY_ATTRIBUTE values.
+const MODIFIED_DAY_FORMAT string = "2006-01-02"
+
+// ErrModifiedIndexDisabled is returned when `ListSubscriptionsModifiedSince` is called for a database without the
+// ModifiedIndex option.
+var ErrModifiedIndexDisabled = errors.New("Modified index is not enabled")
+
+// modifiedDayAttribute returns the value of the MODIFIED_DAY_ATTRIBUTE attribute for the subscription for 'addr'
+// last modified at 'lastmodified', prefixed with the Tenant option if set so that each tenant's days are
+// partitioned separately.
+func (opts *DynamoDBSubscriptionsDatabaseOptions) modifiedDayAttribute(addr string, lastmodified int64) string {
+
+	day := time.Unix(lastmodified, 0).UTC().Format(MODIFIED_DAY_FORMAT)
+	return tenantKey(opts.Tenant, shardKey(day, writeShard(addr, opts.writeShards())))
+}
+
+// modifiedDayKeys returns the values of the MODIFIED_DAY_ATTRIBUTE attribute for every write shard of 'day'.
+func (opts *DynamoDBSubscriptionsDatabaseOptions) modifiedDayKeys(day time.Time) []string {
+	return shardKeys(tenantKey(opts.Tenant, day.UTC().Format(MODIFIED_DAY_FORMAT)), opts.writeShards())
+}
+
+// setModifiedDayAttribute assigns the MODIFIED_DAY_ATTRIBUTE attribute of 'item', the subscription for 'addr',
+// for 'lastmodified' if the ModifiedIndex option of 'opts' is set.
+func setModifiedDayAttribute(opts *DynamoDBSubscriptionsDatabaseOptions, item map[string]*aws_dynamodb.AttributeValue, addr string, lastmodified int64) {
+
+	if !opts.ModifiedIndex {
+		return
+	}
+
+	item[MODIFIED_DAY_ATTRIBUTE] = &aws_dynamodb.AttributeValue{
+		S: aws.String(opts.modifiedDayAttribute(addr, lastmodified)),
+	}
+}
+
+// ListSubscriptionsModifiedSince invokes 'callback' for each subscription last modified at or after 'since', in the
+// order they were modified, for example so that incremental syncs to a CRM only process subscriptions which have
+// changed since the last sync. It queries every write shard (see the WriteShards option) of the
+// SUBSCRIPTIONS_MODIFIED_INDEX index once for each UTC day from 'since' until today, merging the shards of each
+// day, so 'since' should be recent. It requires the ModifiedIndex option and only finds subscriptions written
+// since it was enabled. Removed subscriptions are not listed; see `DynamoDBHistoryDatabase` for them.
+func (db *DynamoDBSubscriptionsDatabase) ListSubscriptionsModifiedSince(ctx context.Context, since time.Time, callback database.ListSubscriptionsFunc) error {
+
+	ctx = withOperation(ctx, "ListSubscriptionsModifiedSince")
+
+	if !db.options.ModifiedIndex {
+		return ErrModifiedIndexDisabled
+	}
+
+	if since.IsZero() {
+		return validationError("subscription", "lastmodified", since, "time is zero")
+	}
+
+	callback = limitSubscriptionsCallback(db.options.MaxResults, callback)
+
+	today := time.Now().UTC().Format(MODIFIED_DAY_FORMAT)
+
+	for day := since.UTC(); day.Format(MODIFIED_DAY_FORMAT) <= today; day = day.AddDate(0, 0, 1) {
+
+		keys := db.options.modifiedDayKeys(day)
+		reqs := make([]*aws_dynamodb.QueryInput, len(keys))
+
+		for i, key := range keys {
+
+			req := &aws_dynamodb.QueryInput{
+				TableName:              aws.String(db.options.FullTableName()),
+				IndexName:              aws.String(SUBSCRIPTIONS_MODIFIED_INDEX),
+				KeyConditionExpression: aws.String("#day = :day AND #lastmodified >= :since"),
+				ExpressionAttributeNames: map[string]*string{
+					"#day":          aws.String(MODIFIED_DAY_ATTRIBUTE),
+					"#lastmodified": aws.String("lastmodified"),
+				},
+				ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+					":day": {
+						S: aws.String(key),
+					},
+					":since": {
+						N: aws.String(strconv.FormatInt(since.Unix(), 10)),
+					},
+				},
+			}
+
+			if db.options.PageSize > 0 {
+				req.Limit = aws.Int64(db.options.PageSize)
+			}
+
+			reqs[i] = req
+		}
+
+		err := queryShardedSubscriptions(ctx, db.client, db.options, reqs, "lastmodified", callback)
+
+		if err != nil {
+			return stopListingError(err)
+		}
+	}
+
+	return nil
+}
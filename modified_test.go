@@ -0,0 +1,147 @@
+package dynamodb
+
+import (
+	"context"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// modifiedIndexClient serves queries of the modified index from items, keyed by their MODIFIED_DAY_ATTRIBUTE
+// value, one item per page so that the merge has to page through every shard.
+type modifiedIndexClient struct {
+	aws_dynamodbiface.DynamoDBAPI
+	items   map[string][]map[string]*aws_dynamodb.AttributeValue
+	queried []string
+}
+
+func (c *modifiedIndexClient) QueryWithContext(ctx context.Context, req *aws_dynamodb.QueryInput, opts ...request.Option) (*aws_dynamodb.QueryOutput, error) {
+
+	day := *req.ExpressionAttributeValues[":day"].S
+
+	offset := 0
+
+	if req.ExclusiveStartKey == nil {
+		c.queried = append(c.queried, day)
+	} else {
+		offset, _ = strconv.Atoi(*req.ExclusiveStartKey["offset"].N)
+	}
+
+	rsp := &aws_dynamodb.QueryOutput{}
+
+	items := c.items[day]
+
+	if offset < len(items) {
+
+		rsp.Items = items[offset : offset+1]
+		rsp.ScannedCount = aws.Int64(1)
+
+		if offset+1 < len(items) {
+			rsp.LastEvaluatedKey = map[string]*aws_dynamodb.AttributeValue{
+				"offset": {N: aws.String(strconv.Itoa(offset + 1))},
+			}
+		}
+	}
+
+	return rsp, nil
+}
+
+func TestListSubscriptionsModifiedSince(t *testing.T) {
+
+	ctx := context.Background()
+
+	opts := DefaultDynamoDBSubscriptionsDatabaseOptions()
+	opts.ModifiedIndex = true
+	opts.WriteShards = 4
+
+	now := time.Now()
+
+	client := &modifiedIndexClient{
+		items: make(map[string][]map[string]*aws_dynamodb.AttributeValue),
+	}
+
+	// subscriptions are added in order of modification so that each shard's items are sorted, as they are in the index
+
+	var expected []string
+
+	for i := 0; i < 12; i++ {
+
+		sub := &subscription.Subscription{
+			Address:      "user" + strconv.Itoa(i) + "@example.com",
+			Created:      now.Unix(),
+			LastModified: now.Unix() - int64(12-i),
+			Status:       subscription.SUBSCRIPTION_STATUS_ENABLED,
+		}
+
+		item, err := subscriptionToItem(ctx, opts, sub)
+
+		if err != nil {
+			t.Fatalf("Failed to create item, %v", err)
+		}
+
+		day := *item[MODIFIED_DAY_ATTRIBUTE].S
+
+		if !strings.HasPrefix(day, now.UTC().Format(MODIFIED_DAY_FORMAT)+SHARD_SEPARATOR) {
+			t.Fatalf("Unexpected %s attribute %s", MODIFIED_DAY_ATTRIBUTE, day)
+		}
+
+		client.items[day] = append(client.items[day], item)
+		expected = append(expected, sub.Address)
+	}
+
+	if len(client.items) < 2 {
+		t.Fatalf("Expected subscriptions to be written to several shards, got %d", len(client.items))
+	}
+
+	db := &DynamoDBSubscriptionsDatabase{
+		client:  client,
+		options: opts,
+	}
+
+	var listed []string
+
+	err := db.ListSubscriptionsModifiedSince(ctx, now.Add(-time.Minute), func(sub *subscription.Subscription) error {
+		listed = append(listed, sub.Address)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to list subscriptions, %v", err)
+	}
+
+	if strings.Join(listed, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected subscriptions in modification order %v, got %v", expected, listed)
+	}
+
+	if len(client.queried) < opts.WriteShards {
+		t.Fatalf("Expected every shard to be queried, got %v", client.queried)
+	}
+}
+
+func TestWriteShard(t *testing.T) {
+
+	for _, addr := range []string{"a@example.com", "b@example.com", "c@example.org"} {
+
+		shard := writeShard(addr, 8)
+
+		if shard < 0 || shard >= 8 {
+			t.Fatalf("Invalid shard %d for %s", shard, addr)
+		}
+
+		if writeShard(addr, 8) != shard {
+			t.Fatalf("Shard for %s is not stable", addr)
+		}
+	}
+
+	keys := shardKeys("2024-05-01", 3)
+
+	if strings.Join(keys, ",") != "2024-05-01#0,2024-05-01#1,2024-05-01#2" {
+		t.Fatalf("Unexpected shard keys %v", keys)
+	}
+}
@@ -0,0 +1,32 @@
+package dynamodb
+
+import (
+	"context"
+)
+
+type operationKey struct{}
+
+// withOperation returns a copy of 'ctx' labeled with the name of the database operation, for example
+// "AddSubscription", being performed. If 'ctx' is already labeled it is returned as-is so that nested
+// calls are attributed to the outermost operation.
+func withOperation(ctx context.Context, name string) context.Context {
+
+	_, ok := operationFromContext(ctx)
+
+	if ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, operationKey{}, name)
+}
+
+// operationFromContext returns the name of the database operation 'ctx' was labeled with, if any.
+func operationFromContext(ctx context.Context) (string, bool) {
+
+	if ctx == nil {
+		return "", false
+	}
+
+	name, ok := ctx.Value(operationKey{}).(string)
+	return name, ok
+}
@@ -0,0 +1,302 @@
+// package optin provides a double opt-in workflow composed from the DynamoDB subscriptions and confirmations databases.
+package optin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	"github.com/aaronland/go-mailinglist/database"
+	"github.com/aaronland/go-mailinglist/subscription"
+)
+
+// CONFIRMATION_ACTION is the confirmation action used for opt-in confirmations.
+const CONFIRMATION_ACTION string = "subscribe"
+
+// ErrAlreadySubscribed is returned (wrapped) when starting an opt-in for an address that is already confirmed.
+var ErrAlreadySubscribed = errors.New("Address is already subscribed")
+
+// ErrBlocked is returned (wrapped) when starting or completing an opt-in for a blocked address.
+var ErrBlocked = errors.New("Address is blocked")
+
+// ErrInvalidAction is returned (wrapped) when completing an opt-in with a confirmation for a different action. It
+// is the same error as `dynamodb.ErrConfirmationAction`.
+var ErrInvalidAction = dynamodb.ErrConfirmationAction
+
+// subscriptionsDatabase are the methods of `dynamodb.DynamoDBSubscriptionsDatabase` used by `OptIn`.
+type subscriptionsDatabase interface {
+	GetSubscriptionWithAddressWithContext(context.Context, string) (*subscription.Subscription, error)
+	GetSubscriptionsWithAddresses(context.Context, []string) ([]*subscription.Subscription, error)
+	AddSubscriptionWithContext(context.Context, *subscription.Subscription) error
+	UpdateSubscriptionStatus(context.Context, string, dynamodb.SubscriptionStatus) error
+}
+
+// confirmationsDatabase are the methods of `dynamodb.DynamoDBConfirmationsDatabase` used by `OptIn`.
+type confirmationsDatabase interface {
+	GetConfirmationWithCodeWithContext(context.Context, string) (*confirmation.Confirmation, error)
+	GetConfirmationsWithCodes(context.Context, []string) ([]*confirmation.Confirmation, error)
+	GetConfirmationsForAddress(context.Context, string) ([]*confirmation.Confirmation, error)
+	AddConfirmationWithContext(context.Context, *confirmation.Confirmation) error
+	ConsumeConfirmationWithAction(context.Context, string, string) (*confirmation.Confirmation, error)
+}
+
+// OptIn implements a double opt-in workflow: `Start` creates an unconfirmed subscription and a confirmation
+// whose code is sent to the subscriber, and `Complete` redeems that code and confirms the subscription.
+type OptIn struct {
+	subscriptions subscriptionsDatabase
+	confirmations confirmationsDatabase
+}
+
+// NewOptIn returns a new `OptIn` instance using 'subs' and 'confs'.
+func NewOptIn(subs *dynamodb.DynamoDBSubscriptionsDatabase, confs *dynamodb.DynamoDBConfirmationsDatabase) *OptIn {
+
+	o := &OptIn{
+		subscriptions: subs,
+		confirmations: confs,
+	}
+
+	return o
+}
+
+// Start begins the opt-in process for 'addr'. If there is no subscription for 'addr' a new, unconfirmed, subscription
+// is created; an existing unconfirmed subscription is reused so that calling `Start` again acts as a "resend", in which
+// case the most recent pending opt-in confirmation for 'addr' is returned rather than a new one. A subscription which
+// was confirmed and later disabled, for example by unsubscribing, is marked as unconfirmed so that the subscriber
+// can opt in again. Otherwise a new confirmation is created and returned. Either way its code is what should be
+// sent to the subscriber.
+func (o *OptIn) Start(ctx context.Context, addr string) (*subscription.Subscription, *confirmation.Confirmation, error) {
+
+	new_sub, err := subscription.NewSubscription(addr)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to create subscription, %w", err)
+	}
+
+	sub, err := o.subscriptions.GetSubscriptionWithAddressWithContext(ctx, new_sub.Address)
+
+	if err != nil && !dynamodb.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("Failed to retrieve subscription, %w", err)
+	}
+
+	if sub == nil {
+
+		err = o.subscriptions.AddSubscriptionWithContext(ctx, new_sub)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to add subscription, %w", err)
+		}
+
+		sub = new_sub
+	}
+
+	if sub.IsBlocked() {
+		return nil, nil, fmt.Errorf("Failed to start opt-in for %s, %w", sub.Address, ErrBlocked)
+	}
+
+	if sub.IsConfirmed() {
+
+		if sub.IsEnabled() {
+			return nil, nil, fmt.Errorf("Failed to start opt-in for %s, %w", sub.Address, ErrAlreadySubscribed)
+		}
+
+		err = o.subscriptions.UpdateSubscriptionStatus(ctx, sub.Address, dynamodb.STATUS_PENDING)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to mark subscription as unconfirmed, %w", err)
+		}
+
+		// mirror the changes made by UpdateSubscriptionStatus rather than reading the subscription again
+
+		err = sub.Unconfirm()
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to mark subscription as unconfirmed, %w", err)
+		}
+	}
+
+	pending, err := o.confirmations.GetConfirmationsForAddress(ctx, sub.Address)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to retrieve pending confirmations, %w", err)
+	}
+
+	for _, conf := range pending {
+
+		if conf.Action == CONFIRMATION_ACTION {
+			return sub, conf, nil
+		}
+	}
+
+	conf, err := confirmation.NewConfirmationForSubscription(sub, CONFIRMATION_ACTION)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to create confirmation, %w", err)
+	}
+
+	err = o.confirmations.AddConfirmationWithContext(ctx, conf)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to add confirmation, %w", err)
+	}
+
+	return sub, conf, nil
+}
+
+// Complete finishes the opt-in process for the confirmation matching 'code'. The confirmation is consumed
+// atomically, so a code can only be redeemed once, and the corresponding subscription is confirmed and enabled.
+// Confirmations for actions other than CONFIRMATION_ACTION, and those for blocked addresses, are left in place and
+// ErrInvalidAction or ErrBlocked is returned.
+func (o *OptIn) Complete(ctx context.Context, code string) (*subscription.Subscription, error) {
+
+	conf, err := o.confirmations.GetConfirmationWithCodeWithContext(ctx, code)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve confirmation, %w", err)
+	}
+
+	confs := map[string]*confirmation.Confirmation{
+		code: conf,
+	}
+
+	subs := make(map[string]*subscription.Subscription)
+
+	if conf.Action == CONFIRMATION_ACTION {
+
+		sub, err := o.subscriptions.GetSubscriptionWithAddressWithContext(ctx, conf.Address)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to retrieve subscription for %s, %w", conf.Address, err)
+		}
+
+		subs[conf.Address] = sub
+	}
+
+	return o.confirmSubscription(ctx, code, confs, subs)
+}
+
+// ConfirmResult is the outcome of confirming the subscription for one of the codes passed to `ConfirmSubscriptions`.
+type ConfirmResult struct {
+	// Code is the confirmation code.
+	Code string
+	// Subscription is the confirmed subscription, or nil if Err is set.
+	Subscription *subscription.Subscription
+	// Err is the reason the subscription for Code could not be confirmed, with the same errors `Complete` returns.
+	Err error
+}
+
+// ConfirmSubscriptions completes the opt-in process for each of 'codes', for example in import flows which
+// pre-generate confirmations, and returns a `ConfirmResult` for each code in the order they were passed. The
+// confirmations and their subscriptions are read using BatchGetItem requests and then each confirmation is
+// consumed, so that a code can only be redeemed once, and its subscription confirmed with a single UpdateItem
+// request. Failures for individual codes are reported in their result; an error is only returned if the batch
+// reads fail or 'ctx' is cancelled, in which case the results for the codes processed so far are returned too.
+func (o *OptIn) ConfirmSubscriptions(ctx context.Context, codes []string) ([]*ConfirmResult, error) {
+
+	results := make([]*ConfirmResult, 0, len(codes))
+
+	confs, err := o.confirmations.GetConfirmationsWithCodes(ctx, codes)
+
+	if err != nil {
+		return results, fmt.Errorf("Failed to retrieve confirmations, %w", err)
+	}
+
+	confs_lookup := make(map[string]*confirmation.Confirmation)
+	addrs := make([]string, 0)
+
+	for _, conf := range confs {
+
+		confs_lookup[conf.Code] = conf
+
+		if conf.Action == CONFIRMATION_ACTION {
+			addrs = append(addrs, conf.Address)
+		}
+	}
+
+	subs, err := o.subscriptions.GetSubscriptionsWithAddresses(ctx, addrs)
+
+	if err != nil {
+		return results, fmt.Errorf("Failed to retrieve subscriptions, %w", err)
+	}
+
+	subs_lookup := make(map[string]*subscription.Subscription)
+
+	for _, sub := range subs {
+		subs_lookup[sub.Address] = sub
+	}
+
+	for _, code := range codes {
+
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+
+		sub, err := o.confirmSubscription(ctx, code, confs_lookup, subs_lookup)
+
+		results = append(results, &ConfirmResult{
+			Code:         code,
+			Subscription: sub,
+			Err:          err,
+		})
+	}
+
+	return results, nil
+}
+
+func (o *OptIn) confirmSubscription(ctx context.Context, code string, confs map[string]*confirmation.Confirmation, subs map[string]*subscription.Subscription) (*subscription.Subscription, error) {
+
+	conf, ok := confs[code]
+
+	if !ok {
+
+		// codes are omitted from the batch if they are missing or expired so distinguish between them
+
+		_, err := o.confirmations.GetConfirmationWithCodeWithContext(ctx, code)
+
+		if err == nil {
+			err = fmt.Errorf("Confirmation %s was added after it was read", code)
+		}
+
+		return nil, fmt.Errorf("Failed to retrieve confirmation, %w", err)
+	}
+
+	if conf.Action != CONFIRMATION_ACTION {
+		return nil, fmt.Errorf("Confirmation has action '%s', %w", conf.Action, ErrInvalidAction)
+	}
+
+	sub, ok := subs[conf.Address]
+
+	if !ok {
+		return nil, fmt.Errorf("Failed to retrieve subscription for %s, %w", conf.Address, new(database.NoRecordError))
+	}
+
+	if sub.IsBlocked() {
+		return nil, fmt.Errorf("Failed to complete opt-in for %s, %w", sub.Address, ErrBlocked)
+	}
+
+	_, err := o.confirmations.ConsumeConfirmationWithAction(ctx, code, CONFIRMATION_ACTION)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to consume confirmation, %w", err)
+	}
+
+	if sub.IsConfirmed() {
+		return sub, nil
+	}
+
+	err = o.subscriptions.UpdateSubscriptionStatus(ctx, sub.Address, dynamodb.STATUS_ACTIVE)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update subscription, %w", err)
+	}
+
+	// mirror the changes made by UpdateSubscriptionStatus rather than reading the subscription again
+
+	err = sub.Confirm()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to confirm subscription, %w", err)
+	}
+
+	return sub, nil
+}
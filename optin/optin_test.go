@@ -0,0 +1,303 @@
+package optin
+
+import (
+	"context"
+	"errors"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	"github.com/aaronland/go-mailinglist/database"
+	"github.com/aaronland/go-mailinglist/subscription"
+	"testing"
+)
+
+// memorySubscriptions is an in-memory subscriptionsDatabase.
+type memorySubscriptions struct {
+	subs map[string]*subscription.Subscription
+}
+
+func (db *memorySubscriptions) GetSubscriptionWithAddressWithContext(ctx context.Context, addr string) (*subscription.Subscription, error) {
+
+	sub, ok := db.subs[addr]
+
+	if !ok {
+		return nil, new(database.NoRecordError)
+	}
+
+	copy := *sub
+	return &copy, nil
+}
+
+func (db *memorySubscriptions) GetSubscriptionsWithAddresses(ctx context.Context, addrs []string) ([]*subscription.Subscription, error) {
+
+	subs := make([]*subscription.Subscription, 0)
+
+	for _, addr := range addrs {
+
+		sub, err := db.GetSubscriptionWithAddressWithContext(ctx, addr)
+
+		if err == nil {
+			subs = append(subs, sub)
+		}
+	}
+
+	return subs, nil
+}
+
+func (db *memorySubscriptions) AddSubscriptionWithContext(ctx context.Context, sub *subscription.Subscription) error {
+
+	copy := *sub
+	db.subs[sub.Address] = &copy
+	return nil
+}
+
+func (db *memorySubscriptions) UpdateSubscriptionStatus(ctx context.Context, addr string, status dynamodb.SubscriptionStatus) error {
+
+	sub, ok := db.subs[addr]
+
+	if !ok {
+		return new(database.NoRecordError)
+	}
+
+	switch status {
+	case dynamodb.STATUS_ACTIVE:
+		return sub.Confirm()
+	case dynamodb.STATUS_PENDING:
+		return sub.Unconfirm()
+	default:
+		return sub.Disable()
+	}
+}
+
+// memoryConfirmations is an in-memory confirmationsDatabase.
+type memoryConfirmations struct {
+	confs map[string]*confirmation.Confirmation
+}
+
+func (db *memoryConfirmations) GetConfirmationWithCodeWithContext(ctx context.Context, code string) (*confirmation.Confirmation, error) {
+
+	conf, ok := db.confs[code]
+
+	if !ok {
+		return nil, new(database.NoRecordError)
+	}
+
+	return conf, nil
+}
+
+func (db *memoryConfirmations) GetConfirmationsWithCodes(ctx context.Context, codes []string) ([]*confirmation.Confirmation, error) {
+
+	confs := make([]*confirmation.Confirmation, 0)
+
+	for _, code := range codes {
+
+		conf, ok := db.confs[code]
+
+		if ok {
+			confs = append(confs, conf)
+		}
+	}
+
+	return confs, nil
+}
+
+func (db *memoryConfirmations) GetConfirmationsForAddress(ctx context.Context, addr string) ([]*confirmation.Confirmation, error) {
+
+	confs := make([]*confirmation.Confirmation, 0)
+
+	for _, conf := range db.confs {
+
+		if conf.Address == addr {
+			confs = append(confs, conf)
+		}
+	}
+
+	return confs, nil
+}
+
+func (db *memoryConfirmations) AddConfirmationWithContext(ctx context.Context, conf *confirmation.Confirmation) error {
+	db.confs[conf.Code] = conf
+	return nil
+}
+
+func (db *memoryConfirmations) ConsumeConfirmationWithAction(ctx context.Context, code string, action string) (*confirmation.Confirmation, error) {
+
+	conf, ok := db.confs[code]
+
+	if !ok {
+		return nil, new(database.NoRecordError)
+	}
+
+	if conf.Action != action {
+		return nil, dynamodb.ErrConfirmationAction
+	}
+
+	delete(db.confs, code)
+	return conf, nil
+}
+
+func newMemoryOptIn() (*OptIn, *memorySubscriptions, *memoryConfirmations) {
+
+	subs := &memorySubscriptions{
+		subs: make(map[string]*subscription.Subscription),
+	}
+
+	confs := &memoryConfirmations{
+		confs: make(map[string]*confirmation.Confirmation),
+	}
+
+	o := &OptIn{
+		subscriptions: subs,
+		confirmations: confs,
+	}
+
+	return o, subs, confs
+}
+
+func TestOptIn(t *testing.T) {
+
+	ctx := context.Background()
+
+	o, subs, _ := newMemoryOptIn()
+
+	sub, conf, err := o.Start(ctx, "bob@example.com")
+
+	if err != nil {
+		t.Fatalf("Failed to start opt-in, %v", err)
+	}
+
+	if sub.IsConfirmed() || conf.Action != CONFIRMATION_ACTION {
+		t.Fatalf("Unexpected opt-in %v, %v", sub, conf)
+	}
+
+	_, resent, err := o.Start(ctx, "bob@example.com")
+
+	if err != nil {
+		t.Fatalf("Failed to restart opt-in, %v", err)
+	}
+
+	if resent.Code != conf.Code {
+		t.Fatalf("Expected the pending confirmation to be resent, got %s", resent.Code)
+	}
+
+	sub, err = o.Complete(ctx, conf.Code)
+
+	if err != nil {
+		t.Fatalf("Failed to complete opt-in, %v", err)
+	}
+
+	if !sub.IsConfirmed() || !subs.subs["bob@example.com"].IsEnabled() {
+		t.Fatalf("Expected subscription to be confirmed and enabled, %v", subs.subs["bob@example.com"])
+	}
+
+	_, err = o.Complete(ctx, conf.Code)
+
+	if !dynamodb.IsNotExist(err) {
+		t.Fatalf("Expected not exist error completing opt-in twice, got %v", err)
+	}
+
+	_, _, err = o.Start(ctx, "bob@example.com")
+
+	if !errors.Is(err, ErrAlreadySubscribed) {
+		t.Fatalf("Expected ErrAlreadySubscribed, got %v", err)
+	}
+}
+
+func TestOptInAfterUnsubscribe(t *testing.T) {
+
+	ctx := context.Background()
+
+	o, subs, _ := newMemoryOptIn()
+
+	sub, err := subscription.NewSubscription("alice@example.com")
+
+	if err != nil {
+		t.Fatalf("Failed to create subscription, %v", err)
+	}
+
+	sub.Confirm()
+	sub.Disable()
+
+	subs.AddSubscriptionWithContext(ctx, sub)
+
+	sub, conf, err := o.Start(ctx, "alice@example.com")
+
+	if err != nil {
+		t.Fatalf("Failed to start opt-in for unsubscribed address, %v", err)
+	}
+
+	if sub.IsConfirmed() || subs.subs["alice@example.com"].IsConfirmed() {
+		t.Fatalf("Expected unsubscribed subscription to be marked as unconfirmed")
+	}
+
+	sub, err = o.Complete(ctx, conf.Code)
+
+	if err != nil {
+		t.Fatalf("Failed to complete opt-in, %v", err)
+	}
+
+	if !sub.IsEnabled() || !subs.subs["alice@example.com"].IsEnabled() {
+		t.Fatalf("Expected subscription to be enabled again")
+	}
+}
+
+func TestCompleteBlocked(t *testing.T) {
+
+	ctx := context.Background()
+
+	o, subs, confs := newMemoryOptIn()
+
+	_, conf, err := o.Start(ctx, "mallory@example.com")
+
+	if err != nil {
+		t.Fatalf("Failed to start opt-in, %v", err)
+	}
+
+	subs.subs["mallory@example.com"].Block()
+
+	_, err = o.Complete(ctx, conf.Code)
+
+	if !errors.Is(err, ErrBlocked) {
+		t.Fatalf("Expected ErrBlocked, got %v", err)
+	}
+
+	_, ok := confs.confs[conf.Code]
+
+	if !ok {
+		t.Fatalf("Expected confirmation for blocked address to be left in place")
+	}
+}
+
+func TestCompleteInvalidAction(t *testing.T) {
+
+	ctx := context.Background()
+
+	o, subs, confs := newMemoryOptIn()
+
+	sub, err := subscription.NewSubscription("eve@example.com")
+
+	if err != nil {
+		t.Fatalf("Failed to create subscription, %v", err)
+	}
+
+	subs.AddSubscriptionWithContext(ctx, sub)
+
+	conf, err := confirmation.NewConfirmationForSubscription(sub, "unsubscribe")
+
+	if err != nil {
+		t.Fatalf("Failed to create confirmation, %v", err)
+	}
+
+	confs.AddConfirmationWithContext(ctx, conf)
+
+	_, err = o.Complete(ctx, conf.Code)
+
+	if !errors.Is(err, ErrInvalidAction) {
+		t.Fatalf("Expected ErrInvalidAction, got %v", err)
+	}
+
+	_, ok := confs.confs[conf.Code]
+
+	if !ok {
+		t.Fatalf("Expected confirmation for another action to be left in place")
+	}
+}
@@ -0,0 +1,533 @@
+package dynamodb
+
+import (
+	"errors"
+	"fmt"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidOptions is returned (wrapped, by an `OptionsError`) when a database is created with invalid options.
+var ErrInvalidOptions = errors.New("Invalid options")
+
+// OptionsError describes why a database's options failed validation. It wraps ErrInvalidOptions.
+type OptionsError struct {
+	// Database is the kind of database, for example "subscriptions", whose options failed validation.
+	Database string
+	// Option is the name of the invalid option, for example "BillingMode".
+	Option string
+	// Value is the invalid value.
+	Value interface{}
+	// Reason describes why the value is invalid.
+	Reason string
+}
+
+func (e *OptionsError) Error() string {
+	return fmt.Sprintf("Invalid %s database %s option '%v', %s", e.Database, e.Option, e.Value, e.Reason)
+}
+
+func (e *OptionsError) Unwrap() error {
+	return ErrInvalidOptions
+}
+
+func optionsError(database string, option string, value interface{}, reason string) error {
+
+	return &OptionsError{
+		Database: database,
+		Option:   option,
+		Value:    value,
+		Reason:   reason,
+	}
+}
+
+// re_tablename matches the characters DynamoDB allows in table names.
+var re_tablename = regexp.MustCompile(`^[a-zA-Z0-9_.\-]+$`)
+
+// validateTableSettings returns an `OptionsError` if any of the settings shared by every database are invalid.
+func validateTableSettings(database string, s *tableSettings) error {
+
+	if *s.TableName == "" {
+		return optionsError(database, "TableName", *s.TableName, "table name is empty")
+	}
+
+	name := fullTableName(*s.TablePrefix, *s.TableName, *s.TableSuffix)
+
+	if isTableArn(*s.TableName) {
+
+		arn, err := parseTableArn(*s.TableName)
+
+		if err != nil {
+			return optionsError(database, "TableName", *s.TableName, "expected the ARN of a DynamoDB table")
+		}
+
+		// tables in other accounts are managed by their owners so they can not be created
+
+		if *s.CreateTable {
+			return optionsError(database, "TableName", *s.TableName, "tables identified by an ARN can not be created by CreateTable")
+		}
+
+		name = fullTableName(*s.TablePrefix, arn.Table, *s.TableSuffix)
+	}
+
+	if len(name) < 3 || len(name) > 255 {
+		return optionsError(database, "TableName", name, "table names must be between 3 and 255 characters long")
+	}
+
+	if !re_tablename.MatchString(name) {
+		return optionsError(database, "TableName", name, "table names may only contain letters, numbers, '_', '-' and '.'")
+	}
+
+	switch *s.BillingMode {
+	case aws_dynamodb.BillingModePayPerRequest:
+		// pass
+	case aws_dynamodb.BillingModeProvisioned:
+
+		// tables are created without provisioned throughput, which DynamoDB requires for this mode
+
+		if *s.CreateTable {
+			return optionsError(database, "BillingMode", *s.BillingMode, "tables with provisioned capacity can not be created by CreateTable, create the table separately")
+		}
+
+	default:
+		return optionsError(database, "BillingMode", *s.BillingMode, "expected PAY_PER_REQUEST or PROVISIONED")
+	}
+
+	switch *s.TableClass {
+	case "", aws_dynamodb.TableClassStandard, aws_dynamodb.TableClassStandardInfrequentAccess:
+		// pass
+	default:
+		return optionsError(database, "TableClass", *s.TableClass, "expected STANDARD or STANDARD_INFREQUENT_ACCESS")
+	}
+
+	switch *s.ReturnConsumedCapacity {
+	case "", aws_dynamodb.ReturnConsumedCapacityTotal, aws_dynamodb.ReturnConsumedCapacityIndexes:
+		// pass
+	default:
+		return optionsError(database, "ReturnConsumedCapacity", *s.ReturnConsumedCapacity, "expected TOTAL or INDEXES")
+	}
+
+	for i, mw := range *s.Middleware {
+
+		if mw == nil {
+			return optionsError(database, "Middleware", i, "middleware is nil")
+		}
+	}
+
+	if *s.ReadOnly && *s.CreateTable {
+		return optionsError(database, "ReadOnly", *s.ReadOnly, "tables can not be created in read-only mode")
+	}
+
+	if *s.Endpoint != "" {
+
+		u, err := url.Parse(*s.Endpoint)
+
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return optionsError(database, "Endpoint", *s.Endpoint, "expected an http or https URL")
+		}
+	}
+
+	return validateRetryOptions(database, *s.Retry)
+}
+
+func validateKinesisStreamArn(database string, arn string) error {
+
+	if arn == "" {
+		return nil
+	}
+
+	if !strings.HasPrefix(arn, "arn:") || !strings.Contains(arn, ":kinesis:") || !strings.Contains(arn, ":stream/") {
+		return optionsError(database, "KinesisStreamArn", arn, "expected the ARN of a Kinesis data stream")
+	}
+
+	return nil
+}
+
+func validateRetention(database string, p RetentionPolicy) error {
+
+	for status, d := range p {
+
+		if d < 0 {
+			return optionsError(database, "Retention", fmt.Sprintf("%d=%v", status, d), "maximum age is negative")
+		}
+	}
+
+	return nil
+}
+
+func validateNotNegative(database string, option string, value int64) error {
+
+	if value < 0 {
+		return optionsError(database, option, value, "value is negative")
+	}
+
+	return nil
+}
+
+func validateScanBackoff(database string, opts *ScanBackoffOptions) error {
+
+	if opts == nil {
+		return nil
+	}
+
+	err := validateNotNegative(database, "ScanBackoff.MaxRetries", int64(opts.MaxRetries))
+
+	if err != nil {
+		return err
+	}
+
+	err = validateNotNegative(database, "ScanBackoff.MinDelay", int64(opts.MinDelay))
+
+	if err != nil {
+		return err
+	}
+
+	err = validateNotNegative(database, "ScanBackoff.MinPageSize", opts.MinPageSize)
+
+	if err != nil {
+		return err
+	}
+
+	if opts.MaxDelay < opts.MinDelay {
+		return optionsError(database, "ScanBackoff.MaxDelay", opts.MaxDelay, "maximum delay is less than MinDelay")
+	}
+
+	return nil
+}
+
+func validateRetryOptions(database string, opts *RetryOptions) error {
+
+	if opts == nil {
+		return nil
+	}
+
+	switch opts.Strategy {
+	case "", RETRY_STRATEGY_FULL_JITTER, RETRY_STRATEGY_EQUAL_JITTER, RETRY_STRATEGY_FIXED:
+		// pass
+	default:
+		return optionsError(database, "Retry.Strategy", opts.Strategy, fmt.Sprintf("expected %s, %s or %s", RETRY_STRATEGY_FULL_JITTER, RETRY_STRATEGY_EQUAL_JITTER, RETRY_STRATEGY_FIXED))
+	}
+
+	err := validateNotNegative(database, "Retry.MaxRetries", int64(opts.MaxRetries))
+
+	if err != nil {
+		return err
+	}
+
+	err = validateNotNegative(database, "Retry.MinDelay", int64(opts.MinDelay))
+
+	if err != nil {
+		return err
+	}
+
+	err = validateNotNegative(database, "Retry.MaxDelay", int64(opts.MaxDelay))
+
+	if err != nil {
+		return err
+	}
+
+	err = validateNotNegative(database, "Retry.MaxElapsed", int64(opts.MaxElapsed))
+
+	if err != nil {
+		return err
+	}
+
+	for op, d := range opts.OperationMaxElapsed {
+
+		if d < 0 {
+			return optionsError(database, "Retry.OperationMaxElapsed", fmt.Sprintf("%s=%v", op, d), "maximum elapsed time is negative")
+		}
+	}
+
+	return nil
+}
+
+// Validate returns an `OptionsError` if 'opts' are invalid. It is called by `NewSubscriptionsDatabaseWithClient`.
+func (opts *DynamoDBSubscriptionsDatabaseOptions) Validate() error {
+
+	database := "subscriptions"
+
+	err := validateTableSettings(database, opts.settings())
+
+	if err != nil {
+		return err
+	}
+
+	err = validateKinesisStreamArn(database, opts.KinesisStreamArn)
+
+	if err != nil {
+		return err
+	}
+
+	switch opts.StreamViewType {
+	case "", aws_dynamodb.StreamViewTypeNewImage, aws_dynamodb.StreamViewTypeOldImage, aws_dynamodb.StreamViewTypeNewAndOldImages, aws_dynamodb.StreamViewTypeKeysOnly:
+		// pass
+	default:
+		return optionsError(database, "StreamViewType", opts.StreamViewType, "expected NEW_IMAGE, OLD_IMAGE, NEW_AND_OLD_IMAGES or KEYS_ONLY")
+	}
+
+	err = validateRetention(database, opts.Retention)
+
+	if err != nil {
+		return err
+	}
+
+	switch opts.RetentionAttribute {
+	case "address", "status":
+		return optionsError(database, "RetentionAttribute", opts.RetentionAttribute, "attribute is reserved")
+	}
+
+	err = validateNotNegative(database, "PageSize", opts.PageSize)
+
+	if err != nil {
+		return err
+	}
+
+	err = validateNotNegative(database, "MaxResults", int64(opts.MaxResults))
+
+	if err != nil {
+		return err
+	}
+
+	err = validateScanBackoff(database, opts.ScanBackoff)
+
+	if err != nil {
+		return err
+	}
+
+	err = validateNotNegative(database, "IdempotencyWindow", int64(opts.IdempotencyWindow))
+
+	if err != nil {
+		return err
+	}
+
+	err = validateTenant(database, opts.Tenant)
+
+	if err != nil {
+		return err
+	}
+
+	if opts.WriteShards < 0 || opts.WriteShards > SUBSCRIPTIONS_MAX_WRITE_SHARDS {
+		return optionsError(database, "WriteShards", opts.WriteShards, fmt.Sprintf("must be between 0 and %d", SUBSCRIPTIONS_MAX_WRITE_SHARDS))
+	}
+
+	if opts.PrefixSearch && opts.Pseudonymizer != nil {
+		return optionsError(database, "PrefixSearch", opts.PrefixSearch, "prefix search can not be used with Pseudonymizer")
+	}
+
+	err = validateSecondaryIndexes(database, opts.Indexes, SubscriptionsTableDefinition(opts))
+
+	if err != nil {
+		return err
+	}
+
+	for from, to := range opts.Transitions {
+
+		for _, s := range append([]SubscriptionStatus{from}, to...) {
+
+			_, err := s.LegacyStatus()
+
+			if err != nil {
+				return optionsError(database, "Transitions", s, "unknown status")
+			}
+		}
+	}
+
+	if len(opts.EncryptedAttributes) > 0 && opts.Encryptor == nil {
+		return optionsError(database, "EncryptedAttributes", opts.EncryptedAttributes, "EncryptedAttributes requires an Encryptor")
+	}
+
+	return validateEncryptedAttributes(opts)
+}
+
+// Validate returns an `OptionsError` if 'opts' are invalid. It is called by `NewConfirmationsDatabaseWithClient`.
+func (opts *DynamoDBConfirmationsDatabaseOptions) Validate() error {
+
+	database := "confirmations"
+
+	err := validateTableSettings(database, opts.settings())
+
+	if err != nil {
+		return err
+	}
+
+	err = validateKinesisStreamArn(database, opts.KinesisStreamArn)
+
+	if err != nil {
+		return err
+	}
+
+	err = validateNotNegative(database, "MaxAge", int64(opts.MaxAge))
+
+	if err != nil {
+		return err
+	}
+
+	switch opts.KeyAttribute {
+	case "address", "created", "type":
+		return optionsError(database, "KeyAttribute", opts.KeyAttribute, "attribute is reserved")
+	}
+
+	switch opts.ExpiresAttribute {
+	case "address", "created", "type", opts.keyAttribute():
+		return optionsError(database, "ExpiresAttribute", opts.ExpiresAttribute, "attribute is reserved")
+	}
+
+	return validateSecondaryIndexes(database, opts.Indexes, ConfirmationsTableDefinition(opts))
+}
+
+// Validate returns an `OptionsError` if 'opts' are invalid. It is called by `NewEventLogsDatabaseWithClient`.
+func (opts *DynamoDBEventLogsDatabaseOptions) Validate() error {
+
+	database := "event logs"
+
+	err := validateTableSettings(database, opts.settings())
+
+	if err != nil {
+		return err
+	}
+
+	err = validateKinesisStreamArn(database, opts.KinesisStreamArn)
+
+	if err != nil {
+		return err
+	}
+
+	err = validateRetention(database, opts.Retention)
+
+	if err != nil {
+		return err
+	}
+
+	switch opts.RetentionAttribute {
+	case "address", "created":
+		return optionsError(database, "RetentionAttribute", opts.RetentionAttribute, "attribute is reserved")
+	}
+
+	return nil
+}
+
+// Validate returns an `OptionsError` if 'opts' are invalid. It is called by `NewDeliveriesDatabaseWithClient`.
+func (opts *DynamoDBDeliveriesDatabaseOptions) Validate() error {
+
+	database := "deliveries"
+
+	err := validateTableSettings(database, opts.settings())
+
+	if err != nil {
+		return err
+	}
+
+	err = validateKinesisStreamArn(database, opts.KinesisStreamArn)
+
+	if err != nil {
+		return err
+	}
+
+	err = validateRetention(database, opts.Retention)
+
+	if err != nil {
+		return err
+	}
+
+	switch opts.RetentionAttribute {
+	case "address", "message_id":
+		return optionsError(database, "RetentionAttribute", opts.RetentionAttribute, "attribute is reserved")
+	}
+
+	return validateNotNegative(database, "PageSize", opts.PageSize)
+}
+
+// Validate returns an `OptionsError` if 'opts' are invalid. It is called by `NewDynamoDBUnsubscribeTokensDatabaseWithClient`.
+func (opts *DynamoDBUnsubscribeTokensDatabaseOptions) Validate() error {
+
+	database := "unsubscribe tokens"
+
+	err := validateTableSettings(database, opts.settings())
+
+	if err != nil {
+		return err
+	}
+
+	err = validateKinesisStreamArn(database, opts.KinesisStreamArn)
+
+	if err != nil {
+		return err
+	}
+
+	err = validateNotNegative(database, "MaxAge", int64(opts.MaxAge))
+
+	if err != nil {
+		return err
+	}
+
+	switch opts.ExpiresAttribute {
+	case "token", "address", "created":
+		return optionsError(database, "ExpiresAttribute", opts.ExpiresAttribute, "attribute is reserved")
+	}
+
+	return nil
+}
+
+// Validate returns an `OptionsError` if 'opts' are invalid. It is called by `NewDynamoDBSendQueueWithClient`.
+func (opts *DynamoDBSendQueueOptions) Validate() error {
+
+	database := "send queue"
+
+	err := validateTableSettings(database, opts.settings())
+
+	if err != nil {
+		return err
+	}
+
+	return validateNotNegative(database, "LeaseTimeout", int64(opts.LeaseTimeout))
+}
+
+// Validate returns an `OptionsError` if 'opts' are invalid. It is called by `NewDynamoDBDeadLettersDatabaseWithClient`.
+func (opts *DynamoDBDeadLettersDatabaseOptions) Validate() error {
+
+	database := "dead letters"
+
+	err := validateTableSettings(database, opts.settings())
+
+	if err != nil {
+		return err
+	}
+
+	return validateNotNegative(database, "PageSize", opts.PageSize)
+}
+
+// Validate returns an `OptionsError` if 'opts' are invalid. It is called by `NewDynamoDBHistoryDatabaseWithClient`.
+func (opts *DynamoDBHistoryDatabaseOptions) Validate() error {
+
+	database := "history"
+
+	err := validateTableSettings(database, opts.settings())
+
+	if err != nil {
+		return err
+	}
+
+	err = validateTenant(database, opts.Tenant)
+
+	if err != nil {
+		return err
+	}
+
+	return validateNotNegative(database, "PageSize", opts.PageSize)
+}
+
+// Validate returns an `OptionsError` if 'opts' are invalid. It is called by `NewDynamoDBStatsDatabaseWithClient`.
+func (opts *DynamoDBStatsDatabaseOptions) Validate() error {
+
+	database := "stats"
+
+	err := validateTableSettings(database, opts.settings())
+
+	if err != nil {
+		return err
+	}
+
+	return validateTenant(database, opts.Tenant)
+}
@@ -0,0 +1,183 @@
+package dynamodb
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strings"
+)
+
+// PSEUDONYM_PREFIX is prepended to the pseudonyms created by `AddressPseudonymizer` so they can be told apart from
+// cleartext addresses.
+const PSEUDONYM_PREFIX string = "hmac-sha256:"
+
+// ENCRYPTED_ADDRESS_ATTRIBUTE is the name of the attribute an encrypted copy of a pseudonymized address is stored in.
+const ENCRYPTED_ADDRESS_ATTRIBUTE string = "address_encrypted"
+
+// PSEUDONYM_MIN_KEY_LENGTH is the minimum length, in bytes, of the key used to derive pseudonyms.
+const PSEUDONYM_MIN_KEY_LENGTH int = 32
+
+// AddressPseudonymizer replaces the addresses used as subscription keys with an HMAC of the address, so that a copy
+// of the subscriptions table does not expose subscribers' addresses. The cleartext address is optionally stored
+// encrypted, using AES-GCM or another `Encryptor`, so that it can be recovered when listing subscriptions. Without
+// an encryptor the cleartext address is not stored at all and listings return the pseudonym in place of the address.
+type AddressPseudonymizer struct {
+	hmac_key  []byte
+	encryptor Encryptor
+}
+
+// NewAddressPseudonymizer returns a new `AddressPseudonymizer` which derives pseudonyms using 'hmac_key', which must
+// be at least PSEUDONYM_MIN_KEY_LENGTH bytes. If 'encryption_key' is not empty it must be a 16, 24 or 32 byte AES key
+// used to encrypt the cleartext address. Changing either key makes existing records unreadable.
+func NewAddressPseudonymizer(hmac_key []byte, encryption_key []byte) (*AddressPseudonymizer, error) {
+
+	if len(encryption_key) == 0 {
+		return NewAddressPseudonymizerWithEncryptor(hmac_key, nil)
+	}
+
+	e, err := NewAESEncryptor(encryption_key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAddressPseudonymizerWithEncryptor(hmac_key, e)
+}
+
+// NewAddressPseudonymizerWithEncryptor returns a new `AddressPseudonymizer` which derives pseudonyms using 'hmac_key',
+// which must be at least PSEUDONYM_MIN_KEY_LENGTH bytes, and encrypts the cleartext address using 'e', for example
+// a `KMSEncryptor`. If 'e' is nil the cleartext address is not stored.
+func NewAddressPseudonymizerWithEncryptor(hmac_key []byte, e Encryptor) (*AddressPseudonymizer, error) {
+
+	if len(hmac_key) < PSEUDONYM_MIN_KEY_LENGTH {
+		return nil, fmt.Errorf("HMAC key must be at least %d bytes", PSEUDONYM_MIN_KEY_LENGTH)
+	}
+
+	p := &AddressPseudonymizer{
+		hmac_key:  hmac_key,
+		encryptor: e,
+	}
+
+	return p, nil
+}
+
+// Pseudonym returns the pseudonym for 'addr'. If 'addr' is already a pseudonym it is returned unchanged.
+func (p *AddressPseudonymizer) Pseudonym(addr string) string {
+
+	if IsPseudonym(addr) {
+		return addr
+	}
+
+	mac := hmac.New(sha256.New, p.hmac_key)
+	mac.Write([]byte(addr))
+
+	return PSEUDONYM_PREFIX + hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsPseudonym reports whether 'addr' is a pseudonym rather than a cleartext address.
+func IsPseudonym(addr string) bool {
+	return strings.HasPrefix(addr, PSEUDONYM_PREFIX)
+}
+
+// the pseudonym is used as additional data so an encrypted address can not be copied to another record
+
+func (p *AddressPseudonymizer) encrypt(ctx context.Context, addr string) ([]byte, error) {
+	return p.encryptor.Encrypt(ctx, []byte(addr), []byte(p.Pseudonym(addr)))
+}
+
+func (p *AddressPseudonymizer) decrypt(ctx context.Context, pseudonym string, body []byte) (string, error) {
+
+	addr, err := p.encryptor.Decrypt(ctx, body, []byte(pseudonym))
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(addr), nil
+}
+
+// pseudonymize replaces the "address" attribute in 'item' with its pseudonym, adding an encrypted copy of the
+// address if 'p' has an encryptor. It does nothing if 'p' is nil.
+func (p *AddressPseudonymizer) pseudonymize(ctx context.Context, item map[string]*aws_dynamodb.AttributeValue) error {
+
+	if p == nil {
+		return nil
+	}
+
+	v, ok := item["address"]
+
+	if !ok || v.S == nil || IsPseudonym(*v.S) {
+		return nil
+	}
+
+	addr := *v.S
+
+	item["address"] = &aws_dynamodb.AttributeValue{
+		S: aws.String(p.Pseudonym(addr)),
+	}
+
+	if p.encryptor == nil {
+		return nil
+	}
+
+	enc, err := p.encrypt(ctx, addr)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encrypt address, %w", err)
+	}
+
+	item[ENCRYPTED_ADDRESS_ATTRIBUTE] = &aws_dynamodb.AttributeValue{
+		B: enc,
+	}
+
+	return nil
+}
+
+// restore replaces the pseudonymous "address" attribute in 'item' with the decrypted cleartext address, if
+// present, and removes the encrypted copy. It does nothing if 'p' is nil.
+func (p *AddressPseudonymizer) restore(ctx context.Context, item map[string]*aws_dynamodb.AttributeValue) error {
+
+	if p == nil || item == nil {
+		return nil
+	}
+
+	enc, ok := item[ENCRYPTED_ADDRESS_ATTRIBUTE]
+
+	if !ok {
+		return nil
+	}
+
+	delete(item, ENCRYPTED_ADDRESS_ATTRIBUTE)
+
+	v, ok := item["address"]
+
+	if !ok || v.S == nil || p.encryptor == nil {
+		return nil
+	}
+
+	addr, err := p.decrypt(ctx, *v.S, enc.B)
+
+	if err != nil {
+		return fmt.Errorf("Failed to decrypt address, %w", err)
+	}
+
+	item["address"] = &aws_dynamodb.AttributeValue{
+		S: aws.String(addr),
+	}
+
+	return nil
+}
+
+// addressKey returns the value of the "address" key for 'addr', which is its pseudonym if 'p' is not nil.
+func (p *AddressPseudonymizer) addressKey(addr string) string {
+
+	if p == nil {
+		return addr
+	}
+
+	return p.Pseudonym(addr)
+}
@@ -0,0 +1,333 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// TRANSACT_WRITE_MAX_ITEMS is the maximum number of items DynamoDB allows in a single TransactWriteItems request.
+const TRANSACT_WRITE_MAX_ITEMS int = 100
+
+// PurgeOptions defines the databases a `Purger` removes records from. Any of the databases may be nil, in which
+// case that table is not purged. The tables must all be in the same account and region.
+type PurgeOptions struct {
+	Subscriptions     *DynamoDBSubscriptionsDatabase
+	Confirmations     *DynamoDBConfirmationsDatabase
+	EventLogs         *DynamoDBEventLogsDatabase
+	Deliveries        *DynamoDBDeliveriesDatabase
+	UnsubscribeTokens *DynamoDBUnsubscribeTokensDatabase
+	History           *DynamoDBHistoryDatabase
+}
+
+// Purger removes every record associated with an address, for example to honour a GDPR erasure request.
+type Purger struct {
+	client  aws_dynamodbiface.DynamoDBAPI
+	options *PurgeOptions
+}
+
+// PurgeReport describes the records associated with an address, and whether they were removed transactionally.
+type PurgeReport struct {
+	Address           string
+	Subscriptions     int
+	Confirmations     int
+	EventLogs         int
+	Deliveries        int
+	UnsubscribeTokens int
+	History           int
+	// Transactional is true if the records were removed in a single transaction. Addresses with more than
+	// TRANSACT_WRITE_MAX_ITEMS records are removed in batches, with the subscription removed last.
+	Transactional bool
+	records       []*purgeRecord
+}
+
+// Total returns the total number of records in 'r'.
+func (r *PurgeReport) Total() int {
+	return len(r.records)
+}
+
+type purgeRecord struct {
+	table string
+	key   map[string]*aws_dynamodb.AttributeValue
+}
+
+// NewPurger returns a new `Purger` for the databases in 'opts'. Requests are made using the client of the first
+// database defined in 'opts'.
+func NewPurger(opts *PurgeOptions) (*Purger, error) {
+
+	var client aws_dynamodbiface.DynamoDBAPI
+
+	switch {
+	case opts.Subscriptions != nil:
+		client = opts.Subscriptions.client
+	case opts.Confirmations != nil:
+		client = opts.Confirmations.client
+	case opts.EventLogs != nil:
+		client = opts.EventLogs.client
+	case opts.Deliveries != nil:
+		client = opts.Deliveries.client
+	case opts.UnsubscribeTokens != nil:
+		client = opts.UnsubscribeTokens.client
+	case opts.History != nil:
+		client = opts.History.client
+	default:
+		return nil, errors.New("No databases to purge")
+	}
+
+	p := &Purger{
+		client:  client,
+		options: opts,
+	}
+
+	return p, nil
+}
+
+// Records returns a report of the records associated with 'addr' without removing them.
+func (p *Purger) Records(ctx context.Context, addr string) (*PurgeReport, error) {
+
+	ctx = withOperation(ctx, "Records")
+
+	r := &PurgeReport{
+		Address: addr,
+		records: make([]*purgeRecord, 0),
+	}
+
+	opts := p.options
+
+	if opts.Confirmations != nil {
+
+		table := opts.Confirmations.options.FullTableName()
+		keys, err := queryKeys(ctx, p.client, table, "address", addr, opts.Confirmations.options.keyAttribute())
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find confirmations, %w", err)
+		}
+
+		r.Confirmations = len(keys)
+		r.addRecords(table, keys)
+	}
+
+	if opts.EventLogs != nil {
+
+		table := opts.EventLogs.options.FullTableName()
+		keys, err := queryKeys(ctx, p.client, table, "", addr, "address", "created")
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find event logs, %w", err)
+		}
+
+		r.EventLogs = len(keys)
+		r.addRecords(table, keys)
+	}
+
+	if opts.Deliveries != nil {
+
+		table := opts.Deliveries.options.FullTableName()
+		keys, err := queryKeys(ctx, p.client, table, "", addr, "address", "message_id")
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find deliveries, %w", err)
+		}
+
+		r.Deliveries = len(keys)
+		r.addRecords(table, keys)
+	}
+
+	if opts.UnsubscribeTokens != nil {
+
+		table := opts.UnsubscribeTokens.options.FullTableName()
+		keys, err := queryKeys(ctx, p.client, table, "address", addr, "token")
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find unsubscribe tokens, %w", err)
+		}
+
+		r.UnsubscribeTokens = len(keys)
+		r.addRecords(table, keys)
+	}
+
+	if opts.History != nil {
+
+		table := opts.History.options.FullTableName()
+		keys, err := queryKeys(ctx, p.client, table, "", opts.History.options.addressKey(addr), "address", "recorded")
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find subscription history, %w", err)
+		}
+
+		r.History = len(keys)
+		r.addRecords(table, keys)
+	}
+
+	// the subscription is always last so that if a non-transactional purge fails part way through
+	// the address is still found, and the remaining records removed, when the purge is retried
+
+	if opts.Subscriptions != nil {
+
+		_, err := opts.Subscriptions.getSubscriptionWithAddress(ctx, addr)
+
+		if err != nil && !IsNotExist(err) {
+			return nil, fmt.Errorf("Failed to find subscription, %w", err)
+		}
+
+		if err == nil {
+
+			key := map[string]*aws_dynamodb.AttributeValue{
+				"address": {
+					S: aws.String(opts.Subscriptions.options.addressKey(addr)),
+				},
+			}
+
+			r.Subscriptions = 1
+			r.addRecords(opts.Subscriptions.options.FullTableName(), []map[string]*aws_dynamodb.AttributeValue{key})
+		}
+	}
+
+	return r, nil
+}
+
+// PurgeAddress removes every record associated with 'addr' from the subscriptions, confirmations, event logs,
+// deliveries, unsubscribe tokens and subscription history tables, returning a report of what was removed. Records are removed in a
+// single transaction where possible.
+func (p *Purger) PurgeAddress(ctx context.Context, addr string) (*PurgeReport, error) {
+
+	ctx = withOperation(ctx, "PurgeAddress")
+
+	r, err := p.Records(ctx, addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.records) == 0 {
+		return r, nil
+	}
+
+	if len(r.records) <= TRANSACT_WRITE_MAX_ITEMS {
+
+		items := make([]*aws_dynamodb.TransactWriteItem, len(r.records))
+
+		for i, rec := range r.records {
+			items[i] = &aws_dynamodb.TransactWriteItem{
+				Delete: &aws_dynamodb.Delete{
+					TableName: aws.String(rec.table),
+					Key:       rec.key,
+				},
+			}
+		}
+
+		_, err := p.client.TransactWriteItemsWithContext(ctx, &aws_dynamodb.TransactWriteItemsInput{
+			TransactItems: items,
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to purge %s, %w", addr, wrapError(err))
+		}
+
+		r.Transactional = true
+		return r, nil
+	}
+
+	for i := 0; i < len(r.records); i += BATCH_WRITE_MAX_ITEMS {
+
+		j := i + BATCH_WRITE_MAX_ITEMS
+
+		if j > len(r.records) {
+			j = len(r.records)
+		}
+
+		requests := make(map[string][]*aws_dynamodb.WriteRequest)
+
+		for _, rec := range r.records[i:j] {
+			requests[rec.table] = append(requests[rec.table], &aws_dynamodb.WriteRequest{
+				DeleteRequest: &aws_dynamodb.DeleteRequest{
+					Key: rec.key,
+				},
+			})
+		}
+
+		err := batchWriteItems(ctx, p.client, requests)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to purge %s, %w", addr, err)
+		}
+	}
+
+	return r, nil
+}
+
+func (r *PurgeReport) addRecords(table string, keys []map[string]*aws_dynamodb.AttributeValue) {
+
+	for _, k := range keys {
+		r.records = append(r.records, &purgeRecord{table: table, key: k})
+	}
+}
+
+// queryKeys returns the values of the 'keys' attributes of every item in 'table' (or 'index' if not empty)
+// whose "address" attribute is 'addr'.
+func queryKeys(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, table string, index string, addr string, keys ...string) ([]map[string]*aws_dynamodb.AttributeValue, error) {
+
+	names := map[string]*string{
+		"#address": aws.String("address"),
+	}
+
+	projection := ""
+
+	for i, k := range keys {
+
+		alias := fmt.Sprintf("#k%d", i)
+		names[alias] = aws.String(k)
+
+		if i > 0 {
+			projection += ", "
+		}
+
+		projection += alias
+	}
+
+	req := &aws_dynamodb.QueryInput{
+		TableName:                aws.String(table),
+		KeyConditionExpression:   aws.String("#address = :address"),
+		ProjectionExpression:     aws.String(projection),
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":address": {
+				S: aws.String(addr),
+			},
+		},
+	}
+
+	if index != "" {
+		req.IndexName = aws.String(index)
+	}
+
+	results := make([]map[string]*aws_dynamodb.AttributeValue, 0)
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return nil, err
+		}
+
+		rsp, err := client.QueryWithContext(ctx, req)
+
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		results = append(results, rsp.Items...)
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return results, nil
+}
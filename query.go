@@ -0,0 +1,120 @@
+package dynamodb
+
+import (
+	"context"
+	"github.com/aaronland/go-mailinglist/database"
+	"time"
+)
+
+// SubscriptionsQuery builds a `Segment`, one condition at a time, and reads the subscriptions which match all of
+// its conditions with `SubscriptionsInSegment`, which compiles it to the cheapest Query or Scan request available.
+// For example:
+//
+//	it := db.Query().
+//		WhereStatus(dynamodb.STATUS_ACTIVE).
+//		WhereDomain("example.org").
+//		CreatedAfter(t).
+//		Iterator(ctx)
+//
+// Each method returns the query itself so that calls can be chained. Methods for a single-valued condition, like
+// `WhereStatus`, replace any earlier value for it.
+type SubscriptionsQuery struct {
+	db      *DynamoDBSubscriptionsDatabase
+	segment Segment
+}
+
+// Query returns a new `SubscriptionsQuery` for the subscriptions in 'db'. Without any conditions it matches every
+// subscription.
+func (db *DynamoDBSubscriptionsDatabase) Query() *SubscriptionsQuery {
+
+	q := &SubscriptionsQuery{
+		db: db,
+	}
+
+	return q
+}
+
+// WhereStatus limits the query to subscriptions with 'status'.
+func (q *SubscriptionsQuery) WhereStatus(status SubscriptionStatus) *SubscriptionsQuery {
+	q.segment.Status = status
+	return q
+}
+
+// WhereTags limits the query to subscriptions which have been assigned all of 'tags', in addition to the tags
+// of any earlier calls.
+func (q *SubscriptionsQuery) WhereTags(tags ...string) *SubscriptionsQuery {
+	q.segment.Tags = append(q.segment.Tags, tags...)
+	return q
+}
+
+// WhereDomain limits the query to subscriptions whose address is in 'domain', for example "example.org", ignoring case.
+func (q *SubscriptionsQuery) WhereDomain(domain string) *SubscriptionsQuery {
+	q.segment.Domain = domain
+	return q
+}
+
+// CreatedAfter limits the query to subscriptions created at or after 't'.
+func (q *SubscriptionsQuery) CreatedAfter(t time.Time) *SubscriptionsQuery {
+	q.segment.CreatedAfter = t
+	return q
+}
+
+// CreatedBefore limits the query to subscriptions created before 't'.
+func (q *SubscriptionsQuery) CreatedBefore(t time.Time) *SubscriptionsQuery {
+	q.segment.CreatedBefore = t
+	return q
+}
+
+// PageSize sets the maximum number of items to evaluate in each page of results. If zero the database's PageSize
+// option is used.
+func (q *SubscriptionsQuery) PageSize(size int64) *SubscriptionsQuery {
+	q.segment.PageSize = size
+	return q
+}
+
+// Limit sets the maximum number of subscriptions to return. If zero the database's MaxResults option is used.
+func (q *SubscriptionsQuery) Limit(max int) *SubscriptionsQuery {
+	q.segment.MaxResults = max
+	return q
+}
+
+// StartToken resumes the query from 'token', returned by the `Token` method of an iterator for an earlier query
+// with the same conditions.
+func (q *SubscriptionsQuery) StartToken(token string) *SubscriptionsQuery {
+	q.segment.StartToken = token
+	return q
+}
+
+// Segment returns the `Segment` the query compiles to.
+func (q *SubscriptionsQuery) Segment() *Segment {
+
+	seg := q.segment
+	seg.Tags = append([]string(nil), q.segment.Tags...)
+
+	return &seg
+}
+
+// Iterator returns a new `SubscriptionsIterator` for the subscriptions which match the query. See
+// `SubscriptionsInSegment`.
+func (q *SubscriptionsQuery) Iterator(ctx context.Context) *SubscriptionsIterator {
+	return q.db.SubscriptionsInSegment(ctx, q.Segment())
+}
+
+// List invokes 'callback' for each subscription which matches the query, stopping with the first error returned
+// by 'callback'.
+func (q *SubscriptionsQuery) List(ctx context.Context, callback database.ListSubscriptionsFunc) error {
+
+	it := q.Iterator(ctx)
+	defer it.Close()
+
+	for it.Next() {
+
+		err := callback(it.Subscription())
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return it.Err()
+}
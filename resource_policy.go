@@ -0,0 +1,129 @@
+package dynamodb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// RESOURCE_POLICY_READ_ONLY_ACTIONS are the actions allowed by a table resource policy if none are specified,
+// enough to read (but not change) the table and its indexes, for example for analytics.
+var RESOURCE_POLICY_READ_ONLY_ACTIONS = []string{
+	"dynamodb:DescribeTable",
+	"dynamodb:GetItem",
+	"dynamodb:BatchGetItem",
+	"dynamodb:Query",
+	"dynamodb:Scan",
+}
+
+// ResourcePolicyOptions are the settings used to attach a resource-based policy to a table.
+type ResourcePolicyOptions struct {
+	// Principals are the AWS principals, for example account IDs or the ARNs of roles in other accounts, allowed
+	// to perform Actions on the table and its indexes.
+	Principals []string
+	// Actions are the DynamoDB actions, for example "dynamodb:Query", the Principals are allowed to perform. If
+	// empty RESOURCE_POLICY_READ_ONLY_ACTIONS are used.
+	Actions []string
+}
+
+// putResourcePolicyInput and putResourcePolicyOutput are the subset of the DynamoDB PutResourcePolicy API's
+// input and output this package uses. The API is newer than the version of the AWS SDK this package uses, so
+// requests are built with the DynamoDB client's JSON-RPC handlers directly.
+type putResourcePolicyInput struct {
+	_           struct{} `type:"structure"`
+	ResourceArn *string  `min:"1" type:"string" required:"true"`
+	Policy      *string  `type:"string" required:"true"`
+}
+
+type putResourcePolicyOutput struct {
+	_          struct{} `type:"structure"`
+	RevisionId *string  `min:"1" type:"string"`
+}
+
+// PutTableResourcePolicy attaches, or replaces, the resource-based policy returned by `TableResourcePolicy` to the
+// table in 'def', which must already exist. It returns the revision ID of the policy.
+func PutTableResourcePolicy(client *aws_dynamodb.DynamoDB, def *TableDefinition, opts *ResourcePolicyOptions) (string, error) {
+
+	rsp, err := client.DescribeTable(&aws_dynamodb.DescribeTableInput{
+		TableName: def.Input.TableName,
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to describe %s table, %w", *def.Input.TableName, wrapError(err))
+	}
+
+	table_arn := aws.StringValue(rsp.Table.TableArn)
+
+	policy, err := TableResourcePolicy(table_arn, opts)
+
+	if err != nil {
+		return "", err
+	}
+
+	op := &request.Operation{
+		Name:       "PutResourcePolicy",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+
+	input := &putResourcePolicyInput{
+		ResourceArn: aws.String(table_arn),
+		Policy:      aws.String(policy),
+	}
+
+	output := &putResourcePolicyOutput{}
+
+	req := client.NewRequest(op, input, output)
+
+	err = req.Send()
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to put resource policy for %s table, %w", *def.Input.TableName, wrapError(err))
+	}
+
+	return aws.StringValue(output.RevisionId), nil
+}
+
+// TableResourcePolicy returns a resource-based policy document, as JSON, allowing the Principals in 'opts' to
+// perform its Actions on the table 'table_arn' and its indexes.
+func TableResourcePolicy(table_arn string, opts *ResourcePolicyOptions) (string, error) {
+
+	if len(opts.Principals) == 0 {
+		return "", errors.New("Resource policies require at least one principal")
+	}
+
+	actions := opts.Actions
+
+	if len(actions) == 0 {
+		actions = RESOURCE_POLICY_READ_ONLY_ACTIONS
+	}
+
+	doc := map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Sid":    "MailingListTableAccess",
+				"Effect": "Allow",
+				"Principal": map[string]interface{}{
+					"AWS": opts.Principals,
+				},
+				"Action": actions,
+				"Resource": []string{
+					table_arn,
+					table_arn + "/index/*",
+				},
+			},
+		},
+	}
+
+	enc, err := json.Marshal(doc)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode resource policy, %w", err)
+	}
+
+	return string(enc), nil
+}
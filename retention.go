@@ -0,0 +1,332 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/delivery"
+	"github.com/aaronland/go-mailinglist/eventlog"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RETENTION_ANY is the `RetentionPolicy` key whose maximum age applies to records without a rule for their own status.
+const RETENTION_ANY int = -1
+
+// RETENTION_DEFAULT_ATTRIBUTE is the conventional name of the attribute records' expiry times are written to
+// when a retention policy is enforced using TTL.
+const RETENTION_DEFAULT_ATTRIBUTE string = "expires"
+
+// RetentionPolicy maps a record's status to the maximum age of records with that status. For subscriptions
+// the key is the subscription status and age is measured from the time the subscription was last modified. For
+// event logs the key is the event and age is measured from the time the event was created. Deliveries have
+// no status so only the RETENTION_ANY rule applies to them, measured from the time of delivery.
+type RetentionPolicy map[int]time.Duration
+
+// MaxAge returns the maximum age of records with 'status', and whether 'p' declares one.
+func (p RetentionPolicy) MaxAge(status int) (time.Duration, bool) {
+
+	d, ok := p[status]
+
+	if !ok {
+		d, ok = p[RETENTION_ANY]
+	}
+
+	if !ok || d <= 0 {
+		return 0, false
+	}
+
+	return d, true
+}
+
+// Expires returns the time at which a record with 'status' last changed at 't' expires, and whether it expires
+// at all.
+func (p RetentionPolicy) Expires(status int, t time.Time) (time.Time, bool) {
+
+	d, ok := p.MaxAge(status)
+
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return t.Add(d), true
+}
+
+// ParseRetentionPolicy parses a comma-separated list of status=duration rules, for example "0=720h,*=8760h", in to
+// a `RetentionPolicy`. Statuses are integers, or "*" for RETENTION_ANY. In addition to the units understood by
+// `time.ParseDuration` durations may be expressed in days, for example "30d".
+func ParseRetentionPolicy(str string) (RetentionPolicy, error) {
+
+	p := make(RetentionPolicy)
+
+	str = strings.TrimSpace(str)
+
+	if str == "" {
+		return p, nil
+	}
+
+	for _, rule := range strings.Split(str, ",") {
+
+		parts := strings.SplitN(strings.TrimSpace(rule), "=", 2)
+
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid retention rule '%s'", rule)
+		}
+
+		status := RETENTION_ANY
+
+		if parts[0] != "*" {
+
+			i, err := strconv.Atoi(parts[0])
+
+			if err != nil {
+				return nil, fmt.Errorf("Invalid status in retention rule '%s', %w", rule, err)
+			}
+
+			status = i
+		}
+
+		d, err := parseRetentionDuration(parts[1])
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid duration in retention rule '%s', %w", rule, err)
+		}
+
+		p[status] = d
+	}
+
+	return p, nil
+}
+
+func parseRetentionDuration(str string) (time.Duration, error) {
+
+	if strings.HasSuffix(str, "d") {
+
+		days, err := strconv.Atoi(strings.TrimSuffix(str, "d"))
+
+		if err != nil {
+			return 0, err
+		}
+
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(str)
+}
+
+// setRetentionAttribute adds 'attr' to 'item' with the Unix time at which a record with 'status' last changed at 't'
+// expires under 'p'. It does nothing if 'attr' is empty or the record does not expire.
+func setRetentionAttribute(item map[string]*aws_dynamodb.AttributeValue, attr string, p RetentionPolicy, status int, t time.Time) {
+
+	if attr == "" {
+		return
+	}
+
+	expires, ok := p.Expires(status, t)
+
+	if !ok {
+		return
+	}
+
+	item[attr] = &aws_dynamodb.AttributeValue{
+		N: aws.String(strconv.FormatInt(expires.Unix(), 10)),
+	}
+}
+
+func subscriptionRetentionTime(sub *subscription.Subscription) time.Time {
+
+	if sub.LastModified > 0 {
+		return time.Unix(sub.LastModified, 0)
+	}
+
+	return time.Unix(sub.Created, 0)
+}
+
+func eventLogRetentionTime(l *eventlog.EventLog) time.Time {
+
+	// eventlog.NewEventLogWithSubscription records nanoseconds but older records, and those created
+	// by hand, may be in seconds. Anything before 2001-09-09 in milliseconds is assumed to be seconds.
+
+	if l.Created < 1e12 {
+		return time.Unix(l.Created, 0)
+	}
+
+	return time.Unix(0, l.Created)
+}
+
+func deliveryRetentionTime(d *delivery.Delivery) time.Time {
+	return time.Unix(d.Delivered, 0)
+}
+
+// EnforceRetention removes every subscription older than the maximum age for its status, returning the number of
+// subscriptions removed. If 'dry_run' is true subscriptions are counted but not removed. Subscriptions are removed
+// using `RemoveSubscription` so their unsubscribe tokens are also invalidated.
+func (db *DynamoDBSubscriptionsDatabase) EnforceRetention(ctx context.Context, now time.Time, dry_run bool) (int, error) {
+
+	ctx = withOperation(ctx, "EnforceRetention")
+
+	if len(db.options.Retention) == 0 {
+		return 0, nil
+	}
+
+	expired := make([]*subscription.Subscription, 0)
+
+	cb := func(sub *subscription.Subscription) error {
+
+		expires, ok := db.options.Retention.Expires(sub.Status, subscriptionRetentionTime(sub))
+
+		if ok && expires.Before(now) {
+			expired = append(expired, sub)
+		}
+
+		return nil
+	}
+
+	req := &aws_dynamodb.ScanInput{
+		TableName: aws.String(db.options.FullTableName()),
+	}
+
+	err := scanSubscriptions(ctx, db.client, db.options, req, cb)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if dry_run {
+		return len(expired), nil
+	}
+
+	for i, sub := range expired {
+
+		err := db.RemoveSubscription(sub)
+
+		if err != nil {
+			return i, fmt.Errorf("Failed to remove %s, %w", sub.Address, err)
+		}
+	}
+
+	return len(expired), nil
+}
+
+// EnforceRetention removes every event log older than the maximum age for its event, returning the number of
+// event logs removed. If 'dry_run' is true event logs are counted but not removed.
+func (db *DynamoDBEventLogsDatabase) EnforceRetention(ctx context.Context, now time.Time, dry_run bool) (int, error) {
+
+	ctx = withOperation(ctx, "EnforceRetention")
+
+	if len(db.options.Retention) == 0 {
+		return 0, nil
+	}
+
+	table := db.options.FullTableName()
+	keys := make([]map[string]*aws_dynamodb.AttributeValue, 0)
+
+	cb := func(l *eventlog.EventLog) error {
+
+		expires, ok := db.options.Retention.Expires(l.Event, eventLogRetentionTime(l))
+
+		if ok && expires.Before(now) {
+			keys = append(keys, map[string]*aws_dynamodb.AttributeValue{
+				"address": {S: aws.String(l.Address)},
+				"created": {N: aws.String(strconv.FormatInt(l.Created, 10))},
+			})
+		}
+
+		return nil
+	}
+
+	req := &aws_dynamodb.ScanInput{
+		TableName: aws.String(table),
+	}
+
+	err := scanEventLogs(ctx, db.client, req, cb)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if dry_run {
+		return len(keys), nil
+	}
+
+	return deleteKeys(ctx, db.client, table, keys)
+}
+
+// EnforceRetention removes every delivery older than the maximum age declared by the RETENTION_ANY rule, returning
+// the number of deliveries removed. If 'dry_run' is true deliveries are counted but not removed.
+func (db *DynamoDBDeliveriesDatabase) EnforceRetention(ctx context.Context, now time.Time, dry_run bool) (int, error) {
+
+	ctx = withOperation(ctx, "EnforceRetention")
+
+	if len(db.options.Retention) == 0 {
+		return 0, nil
+	}
+
+	table := db.options.FullTableName()
+	keys := make([]map[string]*aws_dynamodb.AttributeValue, 0)
+
+	cb := func(d *delivery.Delivery) error {
+
+		expires, ok := db.options.Retention.Expires(RETENTION_ANY, deliveryRetentionTime(d))
+
+		if ok && expires.Before(now) {
+			keys = append(keys, map[string]*aws_dynamodb.AttributeValue{
+				"address":    {S: aws.String(d.Address)},
+				"message_id": {S: aws.String(d.MessageId)},
+			})
+		}
+
+		return nil
+	}
+
+	req := &aws_dynamodb.ScanInput{
+		TableName: aws.String(table),
+	}
+
+	err := scanDeliveries(ctx, db.client, req, cb)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if dry_run {
+		return len(keys), nil
+	}
+
+	return deleteKeys(ctx, db.client, table, keys)
+}
+
+// deleteKeys removes the items with 'keys' from 'table' in batches, returning the number of items removed.
+func deleteKeys(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, table string, keys []map[string]*aws_dynamodb.AttributeValue) (int, error) {
+
+	for i := 0; i < len(keys); i += BATCH_WRITE_MAX_ITEMS {
+
+		j := i + BATCH_WRITE_MAX_ITEMS
+
+		if j > len(keys) {
+			j = len(keys)
+		}
+
+		requests := make([]*aws_dynamodb.WriteRequest, 0, j-i)
+
+		for _, k := range keys[i:j] {
+			requests = append(requests, &aws_dynamodb.WriteRequest{
+				DeleteRequest: &aws_dynamodb.DeleteRequest{
+					Key: k,
+				},
+			})
+		}
+
+		err := batchWriteItems(ctx, client, map[string][]*aws_dynamodb.WriteRequest{table: requests})
+
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(keys), nil
+}
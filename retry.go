@@ -0,0 +1,166 @@
+package dynamodb
+
+import (
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"math/rand"
+	"time"
+)
+
+// RETRY_STRATEGY_FULL_JITTER waits for a random delay between zero and the exponential backoff delay before each retry.
+const RETRY_STRATEGY_FULL_JITTER string = "full"
+
+// RETRY_STRATEGY_EQUAL_JITTER waits for half of the exponential backoff delay plus a random delay of up to the other
+// half before each retry.
+const RETRY_STRATEGY_EQUAL_JITTER string = "equal"
+
+// RETRY_STRATEGY_FIXED waits for the MinDelay option, without jitter, before each retry.
+const RETRY_STRATEGY_FIXED string = "fixed"
+
+// RETRY_DEFAULT_MAX_RETRIES is the default number of times a request is retried, the same as the AWS SDK's default for DynamoDB.
+const RETRY_DEFAULT_MAX_RETRIES int = 10
+
+// RETRY_DEFAULT_MIN_DELAY is the default delay from which the exponential backoff delay is doubled for each retry.
+const RETRY_DEFAULT_MIN_DELAY time.Duration = 50 * time.Millisecond
+
+// RETRY_DEFAULT_MAX_DELAY is the default maximum delay before any retry.
+const RETRY_DEFAULT_MAX_DELAY time.Duration = 5 * time.Second
+
+// RetryOptions are the settings used to retry requests to DynamoDB which fail with a retryable error, in place of
+// the AWS SDK's default retryer. Exponential backoff delays start at MinDelay, are doubled for each retry and are
+// capped at MaxDelay.
+type RetryOptions struct {
+	// Strategy is how long to wait before each retry: RETRY_STRATEGY_FULL_JITTER, RETRY_STRATEGY_EQUAL_JITTER or
+	// RETRY_STRATEGY_FIXED. If empty RETRY_STRATEGY_FULL_JITTER is used.
+	Strategy string
+	// MaxRetries is the maximum number of times a request is retried. If zero RETRY_DEFAULT_MAX_RETRIES is used.
+	MaxRetries int
+	// MinDelay is the exponential backoff delay before the first retry, and the delay before every retry with
+	// RETRY_STRATEGY_FIXED. If zero RETRY_DEFAULT_MIN_DELAY is used.
+	MinDelay time.Duration
+	// MaxDelay is the maximum delay before any retry. If zero RETRY_DEFAULT_MAX_DELAY is used.
+	MaxDelay time.Duration
+	// MaxElapsed is the maximum time, since a request was first attempted, during which it is retried. If zero
+	// requests are retried until MaxRetries is reached.
+	MaxElapsed time.Duration
+	// OperationMaxElapsed overrides MaxElapsed for requests issued by the database methods it names, for example
+	// {"ConsumeConfirmation": 500 * time.Millisecond} to fail fast when a confirmation link is clicked while
+	// bulk jobs keep retrying for longer. Requests made on behalf of another method, like the removal of tokens
+	// when a subscription is removed, are attributed to the outermost method.
+	OperationMaxElapsed map[string]time.Duration
+}
+
+// retryer implements the AWS SDK's `request.Retryer` interface for `RetryOptions`.
+type retryer struct {
+	client.DefaultRetryer
+	options *RetryOptions
+}
+
+// newRetryer returns a new `request.Retryer` for 'opts'.
+func newRetryer(opts *RetryOptions) request.Retryer {
+
+	max_retries := opts.MaxRetries
+
+	if max_retries == 0 {
+		max_retries = RETRY_DEFAULT_MAX_RETRIES
+	}
+
+	r := &retryer{
+		DefaultRetryer: client.DefaultRetryer{
+			NumMaxRetries: max_retries,
+		},
+		options: opts,
+	}
+
+	return r
+}
+
+// ShouldRetry reports whether the failed request 'r' is retryable, using the AWS SDK's rules, and has not been
+// retried for longer than its maximum elapsed time.
+func (rt *retryer) ShouldRetry(r *request.Request) bool {
+
+	if !rt.DefaultRetryer.ShouldRetry(r) {
+		return false
+	}
+
+	max_elapsed := rt.maxElapsed(r)
+
+	if max_elapsed > 0 && time.Since(r.Time) >= max_elapsed {
+		return false
+	}
+
+	return true
+}
+
+// RetryRules returns the delay before the failed request 'r' is retried, which is never longer than the remainder
+// of its maximum elapsed time.
+func (rt *retryer) RetryRules(r *request.Request) time.Duration {
+
+	min_delay := rt.options.MinDelay
+
+	if min_delay == 0 {
+		min_delay = RETRY_DEFAULT_MIN_DELAY
+	}
+
+	max_delay := rt.options.MaxDelay
+
+	if max_delay == 0 {
+		max_delay = RETRY_DEFAULT_MAX_DELAY
+	}
+
+	backoff := min_delay
+
+	for i := 0; i < r.RetryCount && backoff < max_delay; i++ {
+		backoff = backoff * 2
+	}
+
+	if backoff > max_delay {
+		backoff = max_delay
+	}
+
+	var delay time.Duration
+
+	switch rt.options.Strategy {
+	case RETRY_STRATEGY_FIXED:
+		delay = min_delay
+	case RETRY_STRATEGY_EQUAL_JITTER:
+		delay = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	default:
+		delay = time.Duration(rand.Int63n(int64(backoff) + 1))
+	}
+
+	max_elapsed := rt.maxElapsed(r)
+
+	if max_elapsed > 0 {
+
+		remaining := max_elapsed - time.Since(r.Time)
+
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		if delay > remaining {
+			delay = remaining
+		}
+	}
+
+	return delay
+}
+
+// maxElapsed returns the maximum elapsed time for 'r', using the OperationMaxElapsed option for the database
+// method which issued it, if set, and the MaxElapsed option otherwise.
+func (rt *retryer) maxElapsed(r *request.Request) time.Duration {
+
+	op, ok := operationFromContext(r.Context())
+
+	if ok {
+
+		d, ok := rt.options.OperationMaxElapsed[op]
+
+		if ok {
+			return d
+		}
+	}
+
+	return rt.options.MaxElapsed
+}
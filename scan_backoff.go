@@ -0,0 +1,175 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	aws "github.com/aws/aws-sdk-go/aws"
+	"math/rand"
+	"time"
+)
+
+// SCAN_BACKOFF_DEFAULT_MAX_RETRIES is the default number of times a throttled page of results is retried.
+const SCAN_BACKOFF_DEFAULT_MAX_RETRIES int = 8
+
+// SCAN_BACKOFF_DEFAULT_MIN_DELAY is the default delay before the first retry of a throttled page of results.
+const SCAN_BACKOFF_DEFAULT_MIN_DELAY time.Duration = 100 * time.Millisecond
+
+// SCAN_BACKOFF_DEFAULT_MAX_DELAY is the default maximum delay before retrying a throttled page of results.
+const SCAN_BACKOFF_DEFAULT_MAX_DELAY time.Duration = 10 * time.Second
+
+// SCAN_BACKOFF_DEFAULT_MIN_PAGE_SIZE is the default smallest page size a throttled listing is reduced to.
+const SCAN_BACKOFF_DEFAULT_MIN_PAGE_SIZE int64 = 10
+
+// SCAN_BACKOFF_DEFAULT_PAGE_SIZE is the page size halved by the first throttled page of a listing which has no
+// page size, and has not yet read a page from which to infer one.
+const SCAN_BACKOFF_DEFAULT_PAGE_SIZE int64 = 1000
+
+// ScanBackoffOptions are the settings used to retry pages of results, when listing subscriptions, which are
+// rejected because they exceeded the table's throughput. Each retry halves the page size, so that fewer items
+// are read per request, and waits for a random delay (full jitter) of up to MinDelay doubled for each attempt,
+// capped at MaxDelay. Once pages succeed again the page size is doubled, per page, back to its original size.
+type ScanBackoffOptions struct {
+	// MaxRetries is the maximum number of consecutive times a throttled page is retried before the listing fails.
+	MaxRetries int
+	// MinDelay is the maximum delay before the first retry.
+	MinDelay time.Duration
+	// MaxDelay is the upper bound of the delay before any retry.
+	MaxDelay time.Duration
+	// MinPageSize is the smallest page size a throttled listing is reduced to.
+	MinPageSize int64
+}
+
+// DefaultScanBackoffOptions returns a `ScanBackoffOptions` which retries a throttled page up to
+// SCAN_BACKOFF_DEFAULT_MAX_RETRIES times.
+func DefaultScanBackoffOptions() *ScanBackoffOptions {
+
+	opts := &ScanBackoffOptions{
+		MaxRetries:  SCAN_BACKOFF_DEFAULT_MAX_RETRIES,
+		MinDelay:    SCAN_BACKOFF_DEFAULT_MIN_DELAY,
+		MaxDelay:    SCAN_BACKOFF_DEFAULT_MAX_DELAY,
+		MinPageSize: SCAN_BACKOFF_DEFAULT_MIN_PAGE_SIZE,
+	}
+
+	return opts
+}
+
+// pageBackoff tracks the retries and page size of a single listing. A nil pageBackoff never retries.
+type pageBackoff struct {
+	options  *ScanBackoffOptions
+	original *int64
+	ceiling  int64
+	reduced  bool
+	attempt  int
+}
+
+// newPageBackoff returns a new `pageBackoff` for a listing whose requests have the page size 'limit', or nil
+// if 'opts' is nil.
+func newPageBackoff(opts *ScanBackoffOptions, limit *int64) *pageBackoff {
+
+	if opts == nil {
+		return nil
+	}
+
+	b := &pageBackoff{
+		options:  opts,
+		original: limit,
+		ceiling:  SCAN_BACKOFF_DEFAULT_PAGE_SIZE,
+	}
+
+	if limit != nil {
+		b.ceiling = *limit
+	}
+
+	return b
+}
+
+// retry reduces the page size in 'limit' and waits before a request which failed with 'err' is retried. It
+// returns 'err' if the request was not throttled or has been retried MaxRetries times already, and the context
+// error if 'ctx' is cancelled while waiting.
+func (b *pageBackoff) retry(ctx context.Context, err error, limit **int64) error {
+
+	if b == nil || b.attempt >= b.options.MaxRetries {
+		return err
+	}
+
+	if !errors.Is(wrapError(err), ErrThrottled) {
+		return err
+	}
+
+	current := b.ceiling
+
+	if *limit != nil {
+		current = **limit
+	}
+
+	min_size := b.options.MinPageSize
+
+	if min_size < 1 {
+		min_size = 1
+	}
+
+	size := current / 2
+
+	if size < min_size {
+		size = min_size
+	}
+
+	*limit = aws.Int64(size)
+	b.reduced = true
+
+	delay := b.options.MinDelay
+
+	for i := 0; i < b.attempt && delay < b.options.MaxDelay; i++ {
+		delay = delay * 2
+	}
+
+	if delay > b.options.MaxDelay {
+		delay = b.options.MaxDelay
+	}
+
+	b.attempt += 1
+
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Duration(rand.Int63n(int64(delay)) + 1)):
+		return nil
+	}
+}
+
+// succeeded records a page of 'scanned' items which was read without being throttled, doubling the page size
+// in 'limit' if it was reduced until it is restored to its original size.
+func (b *pageBackoff) succeeded(scanned int64, limit **int64) {
+
+	if b == nil {
+		return
+	}
+
+	b.attempt = 0
+
+	if !b.reduced {
+
+		// with no page size DynamoDB reads up to 1MB of data so the size of the last full page is
+		// the best guess at the page size to halve
+
+		if b.original == nil && scanned > 0 {
+			b.ceiling = scanned
+		}
+
+		return
+	}
+
+	size := **limit * 2
+
+	if size >= b.ceiling {
+		*limit = b.original
+		b.reduced = false
+		return
+	}
+
+	*limit = aws.Int64(size)
+}
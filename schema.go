@@ -0,0 +1,173 @@
+package dynamodb
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Schema is a machine-readable description of the tables this package expects, derived from one or more
+// `TableDefinition` instances, for use by external provisioning tools and drift checkers.
+type Schema struct {
+	Tables []*TableSchema `json:"tables"`
+}
+
+// TableSchema is a machine-readable description of a single table.
+type TableSchema struct {
+	// TableName is the full name of the table, including any prefix and suffix.
+	TableName string `json:"table_name"`
+	// BillingMode is the billing mode of the table, either PAY_PER_REQUEST or PROVISIONED.
+	BillingMode string `json:"billing_mode,omitempty"`
+	// TableClass is the table class of the table. If empty STANDARD is used.
+	TableClass string `json:"table_class,omitempty"`
+	// Attributes maps the name of each key attribute, of the table and its indexes, to its type (S, N or B).
+	Attributes map[string]string `json:"attributes"`
+	// Key is the primary key of the table.
+	Key *KeySchema `json:"key"`
+	// ProvisionedThroughput is the throughput of the table if its billing mode is PROVISIONED.
+	ProvisionedThroughput *ThroughputSchema `json:"provisioned_throughput,omitempty"`
+	// GlobalSecondaryIndexes are the global secondary indexes of the table.
+	GlobalSecondaryIndexes []*IndexSchema `json:"global_secondary_indexes,omitempty"`
+	// TimeToLiveAttribute is the name of the attribute used to expire items. If empty TTL is not enabled.
+	TimeToLiveAttribute string `json:"time_to_live_attribute,omitempty"`
+	// Stream describes the DynamoDB stream of the table. If nil no stream is enabled.
+	Stream *StreamSchema `json:"stream,omitempty"`
+	// KinesisStreamArn is the ARN of a Kinesis data stream to which changes to the table are streamed.
+	KinesisStreamArn string `json:"kinesis_stream_arn,omitempty"`
+	// PointInTimeRecovery reports whether point-in-time recovery is enabled.
+	PointInTimeRecovery bool `json:"point_in_time_recovery"`
+	// DeletionProtection reports whether deletion protection is enabled.
+	DeletionProtection bool `json:"deletion_protection"`
+	// ContributorInsights reports whether CloudWatch Contributor Insights is enabled for the table and its indexes.
+	ContributorInsights bool `json:"contributor_insights"`
+	// Tags are the tags assigned to the table.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// KeySchema describes the primary key of a table or index.
+type KeySchema struct {
+	// PartitionKey is the name of the partition (HASH) key attribute.
+	PartitionKey string `json:"partition_key"`
+	// SortKey is the name of the sort (RANGE) key attribute. If empty there is no sort key.
+	SortKey string `json:"sort_key,omitempty"`
+}
+
+// IndexSchema describes a global secondary index.
+type IndexSchema struct {
+	IndexName             string            `json:"index_name"`
+	Key                   *KeySchema        `json:"key"`
+	ProjectionType        string            `json:"projection_type"`
+	NonKeyAttributes      []string          `json:"non_key_attributes,omitempty"`
+	ProvisionedThroughput *ThroughputSchema `json:"provisioned_throughput,omitempty"`
+}
+
+// ThroughputSchema describes the provisioned throughput of a table or index.
+type ThroughputSchema struct {
+	ReadCapacityUnits  int64 `json:"read_capacity_units"`
+	WriteCapacityUnits int64 `json:"write_capacity_units"`
+}
+
+// StreamSchema describes the DynamoDB stream of a table.
+type StreamSchema struct {
+	// ViewType is the information written to the stream for each change, for example NEW_AND_OLD_IMAGES.
+	ViewType string `json:"view_type"`
+}
+
+// NewSchema returns a new `Schema` describing each of 'defs', in order.
+func NewSchema(defs ...*TableDefinition) *Schema {
+
+	s := &Schema{
+		Tables: make([]*TableSchema, len(defs)),
+	}
+
+	for i, def := range defs {
+		s.Tables[i] = NewTableSchema(def)
+	}
+
+	return s
+}
+
+// NewTableSchema returns a new `TableSchema` describing 'def'.
+func NewTableSchema(def *TableDefinition) *TableSchema {
+
+	in := def.Input
+
+	s := &TableSchema{
+		TableName:             aws.StringValue(in.TableName),
+		BillingMode:           aws.StringValue(in.BillingMode),
+		TableClass:            aws.StringValue(in.TableClass),
+		Attributes:            make(map[string]string),
+		Key:                   newKeySchema(in.KeySchema),
+		ProvisionedThroughput: newThroughputSchema(in.ProvisionedThroughput),
+		TimeToLiveAttribute:   def.TimeToLiveAttribute,
+		KinesisStreamArn:      def.KinesisStreamArn,
+		PointInTimeRecovery:   def.PointInTimeRecovery,
+		DeletionProtection:    aws.BoolValue(in.DeletionProtectionEnabled),
+		ContributorInsights:   def.ContributorInsights,
+	}
+
+	for _, a := range in.AttributeDefinitions {
+		s.Attributes[aws.StringValue(a.AttributeName)] = aws.StringValue(a.AttributeType)
+	}
+
+	for _, idx := range in.GlobalSecondaryIndexes {
+
+		i := &IndexSchema{
+			IndexName:             aws.StringValue(idx.IndexName),
+			Key:                   newKeySchema(idx.KeySchema),
+			ProvisionedThroughput: newThroughputSchema(idx.ProvisionedThroughput),
+		}
+
+		if idx.Projection != nil {
+			i.ProjectionType = aws.StringValue(idx.Projection.ProjectionType)
+			i.NonKeyAttributes = aws.StringValueSlice(idx.Projection.NonKeyAttributes)
+		}
+
+		s.GlobalSecondaryIndexes = append(s.GlobalSecondaryIndexes, i)
+	}
+
+	if in.StreamSpecification != nil && aws.BoolValue(in.StreamSpecification.StreamEnabled) {
+		s.Stream = &StreamSchema{
+			ViewType: aws.StringValue(in.StreamSpecification.StreamViewType),
+		}
+	}
+
+	if len(in.Tags) > 0 {
+
+		s.Tags = make(map[string]string)
+
+		for _, t := range in.Tags {
+			s.Tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+		}
+	}
+
+	return s
+}
+
+func newKeySchema(elements []*aws_dynamodb.KeySchemaElement) *KeySchema {
+
+	k := &KeySchema{}
+
+	for _, el := range elements {
+
+		switch aws.StringValue(el.KeyType) {
+		case aws_dynamodb.KeyTypeHash:
+			k.PartitionKey = aws.StringValue(el.AttributeName)
+		case aws_dynamodb.KeyTypeRange:
+			k.SortKey = aws.StringValue(el.AttributeName)
+		}
+	}
+
+	return k
+}
+
+func newThroughputSchema(t *aws_dynamodb.ProvisionedThroughput) *ThroughputSchema {
+
+	if t == nil {
+		return nil
+	}
+
+	return &ThroughputSchema{
+		ReadCapacityUnits:  aws.Int64Value(t.ReadCapacityUnits),
+		WriteCapacityUnits: aws.Int64Value(t.WriteCapacityUnits),
+	}
+}
@@ -0,0 +1,323 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"strconv"
+)
+
+// SCHEMA_VERSION_ATTRIBUTE is the name of the attribute containing the layout version of a subscription item.
+// Items written before versions were recorded do not have it and are version 0.
+const SCHEMA_VERSION_ATTRIBUTE string = "schema"
+
+// SUBSCRIPTION_SCHEMA_VERSION is the layout version of the subscription items written by this package.
+const SUBSCRIPTION_SCHEMA_VERSION int = 1
+
+// subscriptionUpgrades are the functions which upgrade a subscription item in place, for example by renaming an
+// attribute, from the version at their index to the next version. There must be SUBSCRIPTION_SCHEMA_VERSION of them.
+var subscriptionUpgrades = []func(item map[string]*aws_dynamodb.AttributeValue) error{
+	// version 0 items have the same layout as version 1 items, they are only missing the version attribute
+	func(item map[string]*aws_dynamodb.AttributeValue) error {
+		return nil
+	},
+}
+
+// SchemaVersion returns the layout version of the DynamoDB item 'item'. Items without a SCHEMA_VERSION_ATTRIBUTE
+// attribute are version 0.
+func SchemaVersion(item map[string]*aws_dynamodb.AttributeValue) (int, error) {
+
+	v, ok := item[SCHEMA_VERSION_ATTRIBUTE]
+
+	if !ok || v.N == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(*v.N)
+
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s attribute '%s', %w", SCHEMA_VERSION_ATTRIBUTE, *v.N, err)
+	}
+
+	return version, nil
+}
+
+// setSchemaVersion assigns 'version' to the SCHEMA_VERSION_ATTRIBUTE attribute of 'item'.
+func setSchemaVersion(item map[string]*aws_dynamodb.AttributeValue, version int) {
+
+	item[SCHEMA_VERSION_ATTRIBUTE] = &aws_dynamodb.AttributeValue{
+		N: aws.String(strconv.Itoa(version)),
+	}
+}
+
+// UpgradeSubscriptionItem upgrades the subscription item 'item', as stored in DynamoDB, in place from its layout
+// version to SUBSCRIPTION_SCHEMA_VERSION. It returns false if 'item' was already current, or was written by a newer
+// version of this package in which case it is left unchanged.
+func UpgradeSubscriptionItem(item map[string]*aws_dynamodb.AttributeValue) (bool, error) {
+
+	version, err := SchemaVersion(item)
+
+	if err != nil {
+		return false, err
+	}
+
+	if version >= SUBSCRIPTION_SCHEMA_VERSION {
+		return false, nil
+	}
+
+	for v := version; v < SUBSCRIPTION_SCHEMA_VERSION; v++ {
+
+		err := subscriptionUpgrades[v](item)
+
+		if err != nil {
+			return false, fmt.Errorf("Failed to upgrade subscription item from schema version %d, %w", v, err)
+		}
+	}
+
+	setSchemaVersion(item, SUBSCRIPTION_SCHEMA_VERSION)
+	return true, nil
+}
+
+// upgradeSubscriptionItem upgrades 'item', as read from the table, before it is restored by `restoreSubscriptionItem`.
+// If the RewriteUpgradedItems option of 'opts' is set, and 'complete' reports that the item was read in full rather
+// than with a projection, an upgraded item is also written back to the table.
+func upgradeSubscriptionItem(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSubscriptionsDatabaseOptions, item map[string]*aws_dynamodb.AttributeValue, complete bool) error {
+
+	if item == nil {
+		return nil
+	}
+
+	upgraded, err := UpgradeSubscriptionItem(item)
+
+	if err != nil {
+		return err
+	}
+
+	if !upgraded || !complete || !opts.RewriteUpgradedItems || opts.ReadOnly {
+		return nil
+	}
+
+	_, err = rewriteSubscriptionItem(ctx, client, opts.FullTableName(), item)
+	return err
+}
+
+// rewriteSubscriptionItem writes the upgraded subscription item 'item' to 'table' unless the stored item has been
+// changed, or upgraded, since it was read. Those items are left for whoever changed them and false, rather than
+// an error, is returned.
+func rewriteSubscriptionItem(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, table string, item map[string]*aws_dynamodb.AttributeValue) (bool, error) {
+
+	lastmod, ok := item["lastmodified"]
+
+	if !ok {
+		return false, nil
+	}
+
+	version := item[SCHEMA_VERSION_ATTRIBUTE]
+
+	// the item is copied since it is restored, and so changed, once this returns
+
+	rewrite := make(map[string]*aws_dynamodb.AttributeValue, len(item))
+
+	for k, v := range item {
+		rewrite[k] = v
+	}
+
+	req := &aws_dynamodb.PutItemInput{
+		TableName:           aws.String(table),
+		Item:                rewrite,
+		ConditionExpression: aws.String("#lastmodified = :lastmodified AND (attribute_not_exists(#schema) OR #schema < :schema)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#lastmodified": aws.String("lastmodified"),
+			"#schema":       aws.String(SCHEMA_VERSION_ATTRIBUTE),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":lastmodified": lastmod,
+			":schema":       version,
+		},
+	}
+
+	_, err := client.PutItemWithContext(ctx, req)
+
+	if err != nil {
+
+		err = wrapError(err)
+
+		if errors.Is(err, ErrConditionFailed) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("Failed to rewrite upgraded subscription item, %w", err)
+	}
+
+	return true, nil
+}
+
+// MigrateSchemaOptions defines options for `MigrateSchema`.
+type MigrateSchemaOptions struct {
+	// PageSize is the maximum number of items read per Scan request. If zero SCAN_BACKOFF_DEFAULT_PAGE_SIZE is used.
+	PageSize int64
+	// StartToken is the Token of the `SchemaMigration` passed to the callback of an earlier, interrupted, migration
+	// to resume from. If empty the migration starts at the beginning of the table.
+	StartToken string
+	// DryRun counts the items which would be upgraded without writing them.
+	DryRun bool
+}
+
+// SchemaMigration describes the progress of a `MigrateSchema` migration.
+type SchemaMigration struct {
+	// Scanned is the number of items read so far.
+	Scanned int64
+	// Upgraded is the number of items upgraded, or which would be upgraded with the DryRun option, so far.
+	Upgraded int
+	// Skipped is the number of items which were changed, and so will be upgraded by whoever changed them, after
+	// they were read.
+	Skipped int
+	// Token is a continuation token for the position of the migration, which may be assigned to the StartToken
+	// option to resume it. It is empty once the entire table has been read.
+	Token string
+}
+
+// MigrateSchema scans the table of 'db', one page at a time, and rewrites each item with a schema version older than
+// SUBSCRIPTION_SCHEMA_VERSION with the current layout, in the same way as the RewriteUpgradedItems option, so
+// that the whole table can be upgraded ahead of a release which no longer reads the old layout. If 'callback'
+// is not nil it is invoked with the progress of the migration after each page, for example to report it or to
+// record its Token so that an interrupted migration can be resumed. Pages are throttled by the ScanBackoff and
+// CapacityLimiter options. Items are upgraded as they are stored, so the items of every tenant are upgraded
+// regardless of the Tenant option.
+func (db *DynamoDBSubscriptionsDatabase) MigrateSchema(ctx context.Context, opts *MigrateSchemaOptions, callback func(*SchemaMigration) error) (*SchemaMigration, error) {
+
+	ctx = withOperation(ctx, "MigrateSchema")
+
+	if opts.PageSize < 0 {
+		return nil, optionsError("subscriptions", "PageSize", strconv.FormatInt(opts.PageSize, 10), "must not be negative")
+	}
+
+	page_size := opts.PageSize
+
+	if page_size == 0 {
+		page_size = SCAN_BACKOFF_DEFAULT_PAGE_SIZE
+	}
+
+	req := &aws_dynamodb.ScanInput{
+		TableName:        aws.String(db.options.FullTableName()),
+		Limit:            aws.Int64(page_size),
+		FilterExpression: aws.String("attribute_not_exists(#schema) OR #schema < :schema"),
+		ExpressionAttributeNames: map[string]*string{
+			"#schema": aws.String(SCHEMA_VERSION_ATTRIBUTE),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":schema": {
+				N: aws.String(strconv.Itoa(SUBSCRIPTION_SCHEMA_VERSION)),
+			},
+		},
+	}
+
+	if opts.StartToken != "" {
+
+		key, err := decodeContinuationToken(opts.StartToken)
+
+		if err != nil {
+			return nil, optionsError("subscriptions", "StartToken", opts.StartToken, err.Error())
+		}
+
+		req.ExclusiveStartKey = key
+	}
+
+	migration := &SchemaMigration{}
+
+	backoff := newPageBackoff(db.options.ScanBackoff, req.Limit)
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return migration, err
+		}
+
+		rsp, err := db.client.ScanWithContext(ctx, req)
+
+		if err != nil {
+
+			err = backoff.retry(ctx, err, &req.Limit)
+
+			if err != nil {
+				return migration, wrapError(err)
+			}
+
+			continue
+		}
+
+		backoff.succeeded(aws.Int64Value(rsp.ScannedCount), &req.Limit)
+
+		for _, item := range rsp.Items {
+
+			err := ctx.Err()
+
+			if err != nil {
+				return migration, err
+			}
+
+			upgraded, err := UpgradeSubscriptionItem(item)
+
+			if err != nil {
+				return migration, err
+			}
+
+			if !upgraded {
+				continue
+			}
+
+			if opts.DryRun {
+				migration.Upgraded += 1
+				continue
+			}
+
+			ok, err := rewriteSubscriptionItem(ctx, db.client, db.options.FullTableName(), item)
+
+			if err != nil {
+				return migration, err
+			}
+
+			if ok {
+				migration.Upgraded += 1
+			} else {
+				migration.Skipped += 1
+			}
+		}
+
+		migration.Scanned += aws.Int64Value(rsp.ScannedCount)
+		migration.Token = ""
+
+		if rsp.LastEvaluatedKey != nil {
+
+			token, err := encodeContinuationToken(rsp.LastEvaluatedKey)
+
+			if err != nil {
+				return migration, err
+			}
+
+			migration.Token = token
+		}
+
+		if callback != nil {
+
+			err := callback(migration)
+
+			if err != nil {
+				return migration, err
+			}
+		}
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return migration, nil
+}
@@ -0,0 +1,101 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strings"
+	"unicode/utf8"
+)
+
+// SUBSCRIPTIONS_PREFIX_INDEX is the name of the global secondary index used by `ListSubscriptionsMatching`.
+const SUBSCRIPTIONS_PREFIX_INDEX string = "address_prefix"
+
+// SEARCH_INITIAL_ATTRIBUTE is the name of the attribute containing the (lower-cased) first character of an address.
+// It is the partition key of the SUBSCRIPTIONS_PREFIX_INDEX index.
+const SEARCH_INITIAL_ATTRIBUTE string = "search_initial"
+
+// SEARCH_ADDRESS_ATTRIBUTE is the name of the attribute containing the lower-cased address. It is the sort key of
+// the SUBSCRIPTIONS_PREFIX_INDEX index.
+const SEARCH_ADDRESS_ATTRIBUTE string = "search_address"
+
+// ErrPrefixSearchDisabled is returned when `ListSubscriptionsMatching` is called for a database without the PrefixSearch option.
+var ErrPrefixSearchDisabled = errors.New("Prefix search is not enabled")
+
+// ListSubscriptionsMatching invokes 'callback' for each subscription whose address starts with 'prefix', ignoring
+// case, in address order. It requires the PrefixSearch option and only finds subscriptions written since it was
+// enabled.
+func (db *DynamoDBSubscriptionsDatabase) ListSubscriptionsMatching(ctx context.Context, prefix string, callback database.ListSubscriptionsFunc) error {
+
+	ctx = withOperation(ctx, "ListSubscriptionsMatching")
+
+	if !db.options.PrefixSearch || db.options.Pseudonymizer != nil {
+		return ErrPrefixSearchDisabled
+	}
+
+	initial, search := searchAttributes(prefix)
+
+	if initial == "" {
+		return errors.New("Missing prefix")
+	}
+
+	req := &aws_dynamodb.QueryInput{
+		TableName:              aws.String(db.options.FullTableName()),
+		IndexName:              aws.String(SUBSCRIPTIONS_PREFIX_INDEX),
+		KeyConditionExpression: aws.String("#initial = :initial AND begins_with(#search, :search)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#initial": aws.String(SEARCH_INITIAL_ATTRIBUTE),
+			"#search":  aws.String(SEARCH_ADDRESS_ATTRIBUTE),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":initial": {
+				S: aws.String(initial),
+			},
+			":search": {
+				S: aws.String(search),
+			},
+		},
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
+	}
+
+	callback = limitSubscriptionsCallback(db.options.MaxResults, callback)
+
+	err := querySubscriptions(ctx, db.client, db.options, req, callback)
+	return stopListingError(err)
+}
+
+// searchAttributes returns the values of the SEARCH_INITIAL_ATTRIBUTE and SEARCH_ADDRESS_ATTRIBUTE attributes for 'addr'.
+func searchAttributes(addr string) (string, string) {
+
+	search := strings.ToLower(strings.TrimSpace(addr))
+
+	if search == "" {
+		return "", ""
+	}
+
+	r, _ := utf8.DecodeRuneInString(search)
+	return string(r), search
+}
+
+// setSearchAttributes adds the attributes indexed by SUBSCRIPTIONS_PREFIX_INDEX to 'item'.
+func setSearchAttributes(item map[string]*aws_dynamodb.AttributeValue, addr string) {
+
+	initial, search := searchAttributes(addr)
+
+	if initial == "" {
+		return
+	}
+
+	item[SEARCH_INITIAL_ATTRIBUTE] = &aws_dynamodb.AttributeValue{
+		S: aws.String(initial),
+	}
+
+	item[SEARCH_ADDRESS_ATTRIBUTE] = &aws_dynamodb.AttributeValue{
+		S: aws.String(search),
+	}
+}
@@ -0,0 +1,286 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Segment describes a subset of subscriptions, for example the recipients of a targeted send. Criteria which
+// are not set match every subscription; criteria which are set must all match.
+type Segment struct {
+	// Status limits the segment to subscriptions with this status. If empty subscriptions with any status are included.
+	Status SubscriptionStatus
+	// Tags limits the segment to subscriptions which have been assigned all of these tags. See `AddSubscriptionTags`.
+	Tags []string
+	// Domain limits the segment to subscriptions whose address is in this domain, for example "example.com",
+	// ignoring case.
+	Domain string
+	// CreatedAfter limits the segment to subscriptions created at or after this time. If zero there is no lower bound.
+	CreatedAfter time.Time
+	// CreatedBefore limits the segment to subscriptions created before this time. If zero there is no upper bound.
+	CreatedBefore time.Time
+	// PageSize is the maximum number of items to evaluate in each page of results. If zero the database's PageSize
+	// option is used.
+	PageSize int64
+	// MaxResults is the maximum number of subscriptions to return. If zero the database's MaxResults option is used.
+	MaxResults int
+	// StartToken is a continuation token, returned by the `Token` method of an earlier iterator for the same
+	// segment, to resume from. If empty the segment is read from the beginning.
+	StartToken string
+}
+
+// SubscriptionsInSegment returns a new `SubscriptionsIterator` for the subscriptions in 'seg'. Segments with a
+// Status are read by querying an index keyed on "status": a user-defined index (see `SecondaryIndex`) whose sort
+// key is "created" if there is one, in which case the created range is part of the key condition, and the
+// package's own "status" index otherwise. Segments without a Status are read with a filtered scan of the entire
+// table. Domains are matched using the search attributes if the PrefixSearch option is enabled and by the
+// iterator otherwise.
+func (db *DynamoDBSubscriptionsDatabase) SubscriptionsInSegment(ctx context.Context, seg *Segment) *SubscriptionsIterator {
+
+	it := &SubscriptionsIterator{
+		ctx:     withOperation(ctx, "SubscriptionsInSegment"),
+		client:  db.client,
+		options: db.options,
+	}
+
+	page_size := db.options.PageSize
+	it.max = db.options.MaxResults
+
+	if seg.PageSize > 0 {
+		page_size = seg.PageSize
+	}
+
+	if seg.MaxResults > 0 {
+		it.max = seg.MaxResults
+	}
+
+	if seg.Domain != "" && db.options.Pseudonymizer != nil {
+		it.err = errors.New("Domain segments are not supported for pseudonymous addresses")
+		return it
+	}
+
+	for _, t := range seg.Tags {
+
+		if t == "" {
+			it.err = validationError("subscription", TAGS_ATTRIBUTE, t, "tag is empty")
+			return it
+		}
+	}
+
+	names := make(map[string]*string)
+	values := make(map[string]*aws_dynamodb.AttributeValue)
+	filters := make([]string, 0)
+
+	key_condition := ""
+	index := ""
+
+	if seg.Status != "" {
+
+		legacy, err := seg.Status.LegacyStatus()
+
+		if err != nil {
+			it.err = err
+			return it
+		}
+
+		names["#status"] = aws.String("status")
+
+		values[":status"] = &aws_dynamodb.AttributeValue{
+			N: aws.String(strconv.Itoa(legacy)),
+		}
+
+		key_condition = "#status = :status"
+		index = "status"
+
+		filter := subscriptionStatusFilter(seg.Status, names, values)
+
+		if filter != "" {
+			filters = append(filters, "("+filter+")")
+		}
+	}
+
+	after := !seg.CreatedAfter.IsZero()
+	before := !seg.CreatedBefore.IsZero()
+
+	if after || before {
+
+		names["#created"] = aws.String("created")
+
+		if after {
+			values[":created_after"] = &aws_dynamodb.AttributeValue{
+				N: aws.String(strconv.FormatInt(seg.CreatedAfter.Unix(), 10)),
+			}
+		}
+
+		if before {
+			values[":created_before"] = &aws_dynamodb.AttributeValue{
+				N: aws.String(strconv.FormatInt(seg.CreatedBefore.Unix(), 10)),
+			}
+		}
+
+		created_index := db.options.segmentIndex()
+
+		switch {
+		case key_condition != "" && created_index != "" && after && before:
+
+			// key conditions allow only one comparison per key so the (exclusive) upper bound is expressed as the
+			// last second before it, since created times are whole seconds
+
+			values[":created_before"] = &aws_dynamodb.AttributeValue{
+				N: aws.String(strconv.FormatInt(seg.CreatedBefore.Unix()-1, 10)),
+			}
+
+			index = created_index
+			key_condition = key_condition + " AND #created BETWEEN :created_after AND :created_before"
+
+		case key_condition != "" && created_index != "" && after:
+
+			index = created_index
+			key_condition = key_condition + " AND #created >= :created_after"
+
+		case key_condition != "" && created_index != "":
+
+			index = created_index
+			key_condition = key_condition + " AND #created < :created_before"
+
+		default:
+
+			if after {
+				filters = append(filters, "#created >= :created_after")
+			}
+
+			if before {
+				filters = append(filters, "#created < :created_before")
+			}
+		}
+	}
+
+	for i, t := range seg.Tags {
+
+		value := fmt.Sprintf(":tag%d", i)
+
+		values[value] = &aws_dynamodb.AttributeValue{
+			S: aws.String(t),
+		}
+
+		filters = append(filters, fmt.Sprintf("contains(#tags, %s)", value))
+	}
+
+	if len(seg.Tags) > 0 {
+		names["#tags"] = aws.String(TAGS_ATTRIBUTE)
+	}
+
+	domain := strings.ToLower(strings.TrimPrefix(seg.Domain, "@"))
+
+	if domain != "" {
+
+		if db.options.PrefixSearch {
+
+			names["#search"] = aws.String(SEARCH_ADDRESS_ATTRIBUTE)
+
+			values[":domain"] = &aws_dynamodb.AttributeValue{
+				S: aws.String("@" + domain),
+			}
+
+			// subscriptions written before PrefixSearch was enabled have no search attributes so they are left to the iterator
+
+			filters = append(filters, "(attribute_not_exists(#search) OR contains(#search, :domain))")
+		}
+
+		it.match = func(sub *subscription.Subscription) bool {
+			return strings.HasSuffix(strings.ToLower(sub.Address), "@"+domain)
+		}
+	}
+
+	var filter *string
+
+	if len(filters) > 0 {
+		filter = aws.String(strings.Join(filters, " AND "))
+	}
+
+	if len(names) == 0 {
+		names = nil
+	}
+
+	if len(values) == 0 {
+		values = nil
+	}
+
+	table := aws.String(db.options.FullTableName())
+
+	if key_condition != "" {
+
+		it.query = &aws_dynamodb.QueryInput{
+			TableName:                 table,
+			IndexName:                 aws.String(index),
+			KeyConditionExpression:    aws.String(key_condition),
+			FilterExpression:          filter,
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		}
+
+		withTenantFilter(db.options.Tenant, &it.query.FilterExpression, &it.query.ExpressionAttributeNames, &it.query.ExpressionAttributeValues)
+
+		if page_size > 0 {
+			it.query.Limit = aws.Int64(page_size)
+		}
+
+		// the exclusive start key for a query of an index includes the index's keys as well as the table's
+
+		it.key_attrs = []string{"address", "status"}
+
+		if index != "status" {
+			it.key_attrs = append(it.key_attrs, "created")
+		}
+
+		it.resume(seg.StartToken)
+		return it
+	}
+
+	it.req = &aws_dynamodb.ScanInput{
+		TableName:                 table,
+		FilterExpression:          filter,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+
+	withTenantFilter(db.options.Tenant, &it.req.FilterExpression, &it.req.ExpressionAttributeNames, &it.req.ExpressionAttributeValues)
+
+	if page_size > 0 {
+		it.req.Limit = aws.Int64(page_size)
+	}
+
+	it.resume(seg.StartToken)
+	return it
+}
+
+// segmentIndex returns the name of the first user-defined index partitioned by "status" and sorted by "created"
+// which projects every attribute, or an empty string if there is none.
+func (opts *DynamoDBSubscriptionsDatabaseOptions) segmentIndex() string {
+
+	for _, idx := range opts.Indexes {
+
+		if idx.PartitionKey != "status" || idx.partitionKeyType() != aws_dynamodb.ScalarAttributeTypeN {
+			continue
+		}
+
+		if idx.SortKey != "created" || idx.sortKeyType() != aws_dynamodb.ScalarAttributeTypeN {
+			continue
+		}
+
+		if idx.projection() != aws_dynamodb.ProjectionTypeAll {
+			continue
+		}
+
+		return idx.Name
+	}
+
+	return ""
+}
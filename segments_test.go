@@ -0,0 +1,346 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// expressionValues returns 'values' as strings of the form "N:1" or "S:news", for comparison.
+func expressionValues(values map[string]*aws_dynamodb.AttributeValue) map[string]string {
+
+	if values == nil {
+		return nil
+	}
+
+	str_values := make(map[string]string)
+
+	for k, v := range values {
+
+		switch {
+		case v.N != nil:
+			str_values[k] = "N:" + *v.N
+		case v.S != nil:
+			str_values[k] = "S:" + *v.S
+		default:
+			str_values[k] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	return str_values
+}
+
+func TestSubscriptionsQuerySegments(t *testing.T) {
+
+	after := time.Unix(1700000000, 0)
+	before := time.Unix(1800000000, 0)
+
+	created_index := SecondaryIndex{
+		Name:             "status_created",
+		PartitionKey:     "status",
+		PartitionKeyType: aws_dynamodb.ScalarAttributeTypeN,
+		SortKey:          "created",
+		SortKeyType:      aws_dynamodb.ScalarAttributeTypeN,
+	}
+
+	enabled := "N:" + strconv.Itoa(subscription.SUBSCRIPTION_STATUS_ENABLED)
+	disabled := "N:" + strconv.Itoa(subscription.SUBSCRIPTION_STATUS_DISABLED)
+
+	tests := []struct {
+		name    string
+		options func(*DynamoDBSubscriptionsDatabaseOptions)
+		query   func(*SubscriptionsQuery) *SubscriptionsQuery
+		// index is the name of the index queried, or empty if the table is scanned
+		index         string
+		key_condition string
+		filter        string
+		names         map[string]string
+		values        map[string]string
+	}{
+		{
+			name:  "everything",
+			query: func(q *SubscriptionsQuery) *SubscriptionsQuery { return q },
+		},
+		{
+			name:          "status",
+			query:         func(q *SubscriptionsQuery) *SubscriptionsQuery { return q.WhereStatus(STATUS_ACTIVE) },
+			index:         "status",
+			key_condition: "#status = :status",
+			names:         map[string]string{"#status": "status"},
+			values:        map[string]string{":status": enabled},
+		},
+		{
+			name:          "bounced",
+			query:         func(q *SubscriptionsQuery) *SubscriptionsQuery { return q.WhereStatus(STATUS_BOUNCED) },
+			index:         "status",
+			key_condition: "#status = :status",
+			filter:        "(#state = :bounced)",
+			names:         map[string]string{"#status": "status", "#state": SUBSCRIPTION_STATE_ATTRIBUTE},
+			values:        map[string]string{":status": disabled, ":bounced": "S:bounced"},
+		},
+		{
+			name:          "unsubscribed",
+			query:         func(q *SubscriptionsQuery) *SubscriptionsQuery { return q.WhereStatus(STATUS_UNSUBSCRIBED) },
+			index:         "status",
+			key_condition: "#status = :status",
+			filter:        "(attribute_not_exists(#state) OR #state <> :bounced)",
+			names:         map[string]string{"#status": "status", "#state": SUBSCRIPTION_STATE_ATTRIBUTE},
+			values:        map[string]string{":status": disabled, ":bounced": "S:bounced"},
+		},
+		{
+			name:   "created range without status",
+			query:  func(q *SubscriptionsQuery) *SubscriptionsQuery { return q.CreatedAfter(after).CreatedBefore(before) },
+			filter: "#created >= :created_after AND #created < :created_before",
+			names:  map[string]string{"#created": "created"},
+			values: map[string]string{":created_after": "N:1700000000", ":created_before": "N:1800000000"},
+		},
+		{
+			name: "status and created range without index",
+			query: func(q *SubscriptionsQuery) *SubscriptionsQuery {
+				return q.WhereStatus(STATUS_ACTIVE).CreatedAfter(after).CreatedBefore(before)
+			},
+			index:         "status",
+			key_condition: "#status = :status",
+			filter:        "#created >= :created_after AND #created < :created_before",
+			names:         map[string]string{"#status": "status", "#created": "created"},
+			values:        map[string]string{":status": enabled, ":created_after": "N:1700000000", ":created_before": "N:1800000000"},
+		},
+		{
+			name:    "status and created range with index",
+			options: func(opts *DynamoDBSubscriptionsDatabaseOptions) { opts.Indexes = []SecondaryIndex{created_index} },
+			query: func(q *SubscriptionsQuery) *SubscriptionsQuery {
+				return q.WhereStatus(STATUS_ACTIVE).CreatedAfter(after).CreatedBefore(before)
+			},
+			index:         "status_created",
+			key_condition: "#status = :status AND #created BETWEEN :created_after AND :created_before",
+			names:         map[string]string{"#status": "status", "#created": "created"},
+			values:        map[string]string{":status": enabled, ":created_after": "N:1700000000", ":created_before": "N:1799999999"},
+		},
+		{
+			name:    "status and created after with index",
+			options: func(opts *DynamoDBSubscriptionsDatabaseOptions) { opts.Indexes = []SecondaryIndex{created_index} },
+			query: func(q *SubscriptionsQuery) *SubscriptionsQuery {
+				return q.WhereStatus(STATUS_ACTIVE).CreatedAfter(after)
+			},
+			index:         "status_created",
+			key_condition: "#status = :status AND #created >= :created_after",
+			names:         map[string]string{"#status": "status", "#created": "created"},
+			values:        map[string]string{":status": enabled, ":created_after": "N:1700000000"},
+		},
+		{
+			name:    "status and created before with index",
+			options: func(opts *DynamoDBSubscriptionsDatabaseOptions) { opts.Indexes = []SecondaryIndex{created_index} },
+			query: func(q *SubscriptionsQuery) *SubscriptionsQuery {
+				return q.WhereStatus(STATUS_ACTIVE).CreatedBefore(before)
+			},
+			index:         "status_created",
+			key_condition: "#status = :status AND #created < :created_before",
+			names:         map[string]string{"#status": "status", "#created": "created"},
+			values:        map[string]string{":status": enabled, ":created_before": "N:1800000000"},
+		},
+		{
+			name: "index which does not project every attribute",
+			options: func(opts *DynamoDBSubscriptionsDatabaseOptions) {
+				created_index := created_index
+				created_index.Projection = aws_dynamodb.ProjectionTypeKeysOnly
+				opts.Indexes = []SecondaryIndex{created_index}
+			},
+			query: func(q *SubscriptionsQuery) *SubscriptionsQuery {
+				return q.WhereStatus(STATUS_ACTIVE).CreatedAfter(after)
+			},
+			index:         "status",
+			key_condition: "#status = :status",
+			filter:        "#created >= :created_after",
+			names:         map[string]string{"#status": "status", "#created": "created"},
+			values:        map[string]string{":status": enabled, ":created_after": "N:1700000000"},
+		},
+		{
+			name:   "tags",
+			query:  func(q *SubscriptionsQuery) *SubscriptionsQuery { return q.WhereTags("news").WhereTags("events") },
+			filter: "contains(#tags, :tag0) AND contains(#tags, :tag1)",
+			names:  map[string]string{"#tags": TAGS_ATTRIBUTE},
+			values: map[string]string{":tag0": "S:news", ":tag1": "S:events"},
+		},
+		{
+			name:  "domain without prefix search",
+			query: func(q *SubscriptionsQuery) *SubscriptionsQuery { return q.WhereDomain("Example.org") },
+		},
+		{
+			name:    "domain with prefix search",
+			options: func(opts *DynamoDBSubscriptionsDatabaseOptions) { opts.PrefixSearch = true },
+			query:   func(q *SubscriptionsQuery) *SubscriptionsQuery { return q.WhereDomain("@Example.org") },
+			filter:  "(attribute_not_exists(#search) OR contains(#search, :domain))",
+			names:   map[string]string{"#search": SEARCH_ADDRESS_ATTRIBUTE},
+			values:  map[string]string{":domain": "S:@example.org"},
+		},
+		{
+			name:          "tenant",
+			options:       func(opts *DynamoDBSubscriptionsDatabaseOptions) { opts.Tenant = "acme" },
+			query:         func(q *SubscriptionsQuery) *SubscriptionsQuery { return q.WhereStatus(STATUS_BOUNCED) },
+			index:         "status",
+			key_condition: "#status = :status",
+			filter:        "((#state = :bounced)) AND begins_with(#tenant_address, :tenant)",
+			names:         map[string]string{"#status": "status", "#state": SUBSCRIPTION_STATE_ATTRIBUTE, "#tenant_address": "address"},
+			values:        map[string]string{":status": disabled, ":bounced": "S:bounced", ":tenant": "S:acme" + TENANT_SEPARATOR},
+		},
+		{
+			name: "everything combined",
+			options: func(opts *DynamoDBSubscriptionsDatabaseOptions) {
+				opts.PrefixSearch = true
+				opts.Indexes = []SecondaryIndex{created_index}
+			},
+			query: func(q *SubscriptionsQuery) *SubscriptionsQuery {
+				return q.WhereStatus(STATUS_UNSUBSCRIBED).CreatedAfter(after).WhereTags("news").WhereDomain("example.org")
+			},
+			index:         "status_created",
+			key_condition: "#status = :status AND #created >= :created_after",
+			filter:        "(attribute_not_exists(#state) OR #state <> :bounced) AND contains(#tags, :tag0) AND (attribute_not_exists(#search) OR contains(#search, :domain))",
+			names: map[string]string{
+				"#status": "status", "#state": SUBSCRIPTION_STATE_ATTRIBUTE, "#created": "created", "#tags": TAGS_ATTRIBUTE, "#search": SEARCH_ADDRESS_ATTRIBUTE,
+			},
+			values: map[string]string{
+				":status": disabled, ":bounced": "S:bounced", ":created_after": "N:1700000000", ":tag0": "S:news", ":domain": "S:@example.org",
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			opts := DefaultDynamoDBSubscriptionsDatabaseOptions()
+
+			if test.options != nil {
+				test.options(opts)
+			}
+
+			db := &DynamoDBSubscriptionsDatabase{
+				options: opts,
+			}
+
+			it := test.query(db.Query()).Iterator(context.Background())
+
+			if it.err != nil {
+				t.Fatalf("Failed to compile query, %v", it.err)
+			}
+
+			var index string
+			var key_condition string
+			var filter string
+			var names map[string]string
+			var values map[string]string
+
+			if test.index != "" {
+
+				if it.query == nil {
+					t.Fatalf("Expected a query of %s, got a scan", test.index)
+				}
+
+				index = aws.StringValue(it.query.IndexName)
+				key_condition = aws.StringValue(it.query.KeyConditionExpression)
+				filter = aws.StringValue(it.query.FilterExpression)
+				names = aws.StringValueMap(it.query.ExpressionAttributeNames)
+				values = expressionValues(it.query.ExpressionAttributeValues)
+
+			} else {
+
+				if it.req == nil {
+					t.Fatalf("Expected a scan, got a query of %s", aws.StringValue(it.query.IndexName))
+				}
+
+				filter = aws.StringValue(it.req.FilterExpression)
+				names = aws.StringValueMap(it.req.ExpressionAttributeNames)
+				values = expressionValues(it.req.ExpressionAttributeValues)
+			}
+
+			if index != test.index {
+				t.Fatalf("Expected index %s, got %s", test.index, index)
+			}
+
+			if key_condition != test.key_condition {
+				t.Fatalf("Expected key condition '%s', got '%s'", test.key_condition, key_condition)
+			}
+
+			if filter != test.filter {
+				t.Fatalf("Expected filter '%s', got '%s'", test.filter, filter)
+			}
+
+			if len(names) == 0 {
+				names = nil
+			}
+
+			if !reflect.DeepEqual(names, test.names) {
+				t.Fatalf("Expected names %v, got %v", test.names, names)
+			}
+
+			if !reflect.DeepEqual(values, test.values) {
+				t.Fatalf("Expected values %v, got %v", test.values, values)
+			}
+		})
+	}
+}
+
+func TestSubscriptionsQueryInvalid(t *testing.T) {
+
+	tests := map[string]func(*DynamoDBSubscriptionsDatabaseOptions, *SubscriptionsQuery){
+		"empty tag":      func(opts *DynamoDBSubscriptionsDatabaseOptions, q *SubscriptionsQuery) { q.WhereTags("news", "") },
+		"invalid status": func(opts *DynamoDBSubscriptionsDatabaseOptions, q *SubscriptionsQuery) { q.WhereStatus("lapsed") },
+		"pseudonymous domain": func(opts *DynamoDBSubscriptionsDatabaseOptions, q *SubscriptionsQuery) {
+			opts.Pseudonymizer = &AddressPseudonymizer{}
+			q.WhereDomain("example.org")
+		},
+	}
+
+	for name, fn := range tests {
+
+		opts := DefaultDynamoDBSubscriptionsDatabaseOptions()
+
+		db := &DynamoDBSubscriptionsDatabase{
+			options: opts,
+		}
+
+		q := db.Query()
+		fn(opts, q)
+
+		it := q.Iterator(context.Background())
+
+		if it.err == nil {
+			t.Fatalf("Expected %s query to fail", name)
+		}
+	}
+}
+
+func TestSubscriptionsQuerySegment(t *testing.T) {
+
+	db := &DynamoDBSubscriptionsDatabase{
+		options: DefaultDynamoDBSubscriptionsDatabaseOptions(),
+	}
+
+	q := db.Query().WhereStatus(STATUS_PENDING).WhereStatus(STATUS_ACTIVE).WhereTags("news").PageSize(10).Limit(5)
+
+	seg := q.Segment()
+
+	if seg.Status != STATUS_ACTIVE {
+		t.Fatalf("Expected later WhereStatus to replace earlier one, got %s", seg.Status)
+	}
+
+	// the segment is a copy so changing it does not change the query
+
+	seg.Tags[0] = "changed"
+
+	if q.Segment().Tags[0] != "news" {
+		t.Fatalf("Expected Segment to return a copy of the query's tags")
+	}
+
+	it := q.Iterator(context.Background())
+
+	if aws.Int64Value(it.query.Limit) != 10 || it.max != 5 {
+		t.Fatalf("Unexpected page size %d and limit %d", aws.Int64Value(it.query.Limit), it.max)
+	}
+}
@@ -0,0 +1,510 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const SEND_QUEUE_DEFAULT_TABLENAME string = "send_queue"
+
+// SEND_QUEUE_DEFAULT_QUEUE is the name of the queue items are added to if the Queue option is empty.
+const SEND_QUEUE_DEFAULT_QUEUE string = "default"
+
+// SEND_QUEUE_LEASE_INDEX is the name of the send queue index keyed on queue name and lease expiry time, used to
+// find items which are available to lease.
+const SEND_QUEUE_LEASE_INDEX string = "lease"
+
+// SEND_QUEUE_DEFAULT_LEASE_TIMEOUT is the default length of the lease on items returned by `Lease`.
+const SEND_QUEUE_DEFAULT_LEASE_TIMEOUT time.Duration = 5 * time.Minute
+
+// ErrLeaseLost is returned (wrapped) when completing, extending or releasing an item whose lease has expired
+// or been taken by another sender.
+var ErrLeaseLost = errors.New("Lease has expired or is held by another sender")
+
+// SendQueueItem is a pending delivery of a message to an address.
+type SendQueueItem struct {
+	Id        string `json:"id"`
+	Queue     string `json:"queue"`
+	MessageId string `json:"message_id"`
+	Address   string `json:"address"`
+	Created   int64  `json:"created"`
+	// LeasedUntil is the Unix time at which the current lease expires. Items whose lease has expired, or which
+	// have never been leased, are available to `Lease`.
+	LeasedUntil int64  `json:"leased_until"`
+	LeaseOwner  string `json:"lease_owner,omitempty"`
+	// Attempts is the number of times the item has been leased.
+	Attempts int `json:"attempts"`
+}
+
+type DynamoDBSendQueueOptions struct {
+	TableName   string
+	TablePrefix string
+	TableSuffix string
+	BillingMode string
+	CreateTable bool
+	// DeletionProtection enables deletion protection when the table is created.
+	DeletionProtection bool
+	// TableClass is the table class (STANDARD or STANDARD_INFREQUENT_ACCESS) used when the table is created.
+	// If empty STANDARD is used.
+	TableClass string
+	// ContributorInsights enables CloudWatch Contributor Insights for the table and its indexes when the table is created.
+	ContributorInsights bool
+	// Queue is the name of the queue items are added to and leased from, allowing several queues to share a table.
+	// If empty SEND_QUEUE_DEFAULT_QUEUE is used.
+	Queue string
+	// LeaseTimeout is the length of the lease on items returned by `Lease`. If zero SEND_QUEUE_DEFAULT_LEASE_TIMEOUT is used.
+	LeaseTimeout time.Duration
+	// ReturnConsumedCapacity is the level of consumed capacity detail (TOTAL or INDEXES) to request when
+	// ConsumedCapacityFunc is set. If empty TOTAL is used.
+	ReturnConsumedCapacity string
+	// ConsumedCapacityFunc is an optional callback invoked with the capacity consumed by each request.
+	ConsumedCapacityFunc ConsumedCapacityFunc
+	// CapacityLimiter is an optional `CapacityLimiter` which caps the read and write capacity consumed per second.
+	CapacityLimiter *CapacityLimiter
+	// Middleware is an optional chain of `Middleware` invoked around each request to DynamoDB, the first of which is outermost.
+	Middleware []Middleware
+	// ReadOnly rejects every request which would write to the table with ErrReadOnly, before it is sent. It may not
+	// be used with CreateTable.
+	ReadOnly bool
+	// HTTPClient is an optional HTTP client used by the session and DSN constructors in place of the session's
+	// default client. See `NewHTTPClient`.
+	HTTPClient *http.Client
+	// Region is the AWS region of the table, used in place of the session's region by the session and DSN constructors.
+	// If empty the region of the table's ARN, if TableName is an ARN, and otherwise the session's region is used.
+	Region string
+	// Endpoint is the URL of the DynamoDB endpoint, for example "http://localhost:8000" for DynamoDB Local, used in place
+	// of the session's endpoint by the session and DSN constructors. It takes precedence over UseFIPSEndpoint and
+	// UseDualStackEndpoint. If empty the session's endpoint is used.
+	Endpoint string
+	// UseFIPSEndpoint selects the FIPS 140-2 validated DynamoDB endpoint for the session's region.
+	UseFIPSEndpoint bool
+	// UseDualStackEndpoint selects the dual-stack (IPv4 and IPv6) DynamoDB endpoint for the session's region.
+	UseDualStackEndpoint bool
+	// Retry is an optional `RetryOptions` used to retry failed requests in place of the AWS SDK's default retryer.
+	Retry *RetryOptions
+}
+
+func DefaultDynamoDBSendQueueOptions() *DynamoDBSendQueueOptions {
+
+	opts := DynamoDBSendQueueOptions{
+		TableName:   SEND_QUEUE_DEFAULT_TABLENAME,
+		BillingMode: "PAY_PER_REQUEST",
+		CreateTable: false,
+	}
+
+	return &opts
+}
+
+// FullTableName returns the name of the table with the TablePrefix and TableSuffix options applied.
+func (opts *DynamoDBSendQueueOptions) FullTableName() string {
+	return fullTableName(opts.TablePrefix, opts.TableName, opts.TableSuffix)
+}
+
+// DynamoDBSendQueue stores pending deliveries which several senders may safely pull work from. Each item is
+// leased to a single sender, using conditional updates on its leased_until attribute, and becomes available
+// to other senders again if it is not completed before the lease expires.
+type DynamoDBSendQueue struct {
+	client  aws_dynamodbiface.DynamoDBAPI
+	options *DynamoDBSendQueueOptions
+}
+
+func NewDynamoDBSendQueueWithDSN(dsn string, opts *DynamoDBSendQueueOptions) (*DynamoDBSendQueue, error) {
+
+	sess, err := newSessionWithDSNSettings(dsn, DSN_SEND_QUEUE_TABLE_KEY, opts.settings())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDynamoDBSendQueueWithSession(sess, opts)
+}
+
+func NewDynamoDBSendQueueWithSession(sess *aws_session.Session, opts *DynamoDBSendQueueOptions) (*DynamoDBSendQueue, error) {
+
+	client := opts.settings().newClient(sess)
+
+	return NewDynamoDBSendQueueWithClient(client, opts)
+}
+
+// NewDynamoDBSendQueueWithClient returns a new `DynamoDBSendQueue` instance that uses 'client' to talk to DynamoDB.
+func NewDynamoDBSendQueueWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSendQueueOptions) (*DynamoDBSendQueue, error) {
+
+	err := opts.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	client = withMiddleware(client, opts.settings().middleware())
+
+	if opts.CreateTable {
+
+		_, err := CreateSendQueueTable(client, opts)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	q := DynamoDBSendQueue{
+		client:  client,
+		options: opts,
+	}
+
+	return &q, nil
+}
+
+func (q *DynamoDBSendQueue) queue() string {
+
+	if q.options.Queue != "" {
+		return q.options.Queue
+	}
+
+	return SEND_QUEUE_DEFAULT_QUEUE
+}
+
+func (q *DynamoDBSendQueue) leaseTimeout() time.Duration {
+
+	if q.options.LeaseTimeout > 0 {
+		return q.options.LeaseTimeout
+	}
+
+	return SEND_QUEUE_DEFAULT_LEASE_TIMEOUT
+}
+
+// Enqueue adds a pending delivery of 'message_id' to 'addr' to the queue, available to lease immediately. Items
+// are identified by queue, message ID and address so enqueuing the same delivery twice returns ErrAlreadyExists.
+func (q *DynamoDBSendQueue) Enqueue(ctx context.Context, message_id string, addr string) (*SendQueueItem, error) {
+
+	ctx = withOperation(ctx, "Enqueue")
+
+	queue := q.queue()
+
+	item := &SendQueueItem{
+		Id:        queue + "#" + message_id + "#" + addr,
+		Queue:     queue,
+		MessageId: message_id,
+		Address:   addr,
+		Created:   time.Now().Unix(),
+	}
+
+	attrs, err := aws_dynamodbattribute.MarshalMap(item)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req := &aws_dynamodb.PutItemInput{
+		TableName:           aws.String(q.options.FullTableName()),
+		Item:                attrs,
+		ConditionExpression: aws.String("attribute_not_exists(#id)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id": aws.String("id"),
+		},
+	}
+
+	_, err = q.client.PutItemWithContext(ctx, req)
+
+	if err != nil {
+
+		err = wrapError(err)
+
+		if errors.Is(err, ErrConditionFailed) {
+			return nil, fmt.Errorf("Failed to enqueue %s for %s, %w", message_id, addr, ErrAlreadyExists)
+		}
+
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// Lease returns up to 'max' available items, each leased to 'owner' for the LeaseTimeout option. Items must be
+// completed with `Complete` before their lease expires, otherwise they become available to other senders. The
+// lease index is eventually consistent so fewer than 'max' items may be returned even if more are available.
+func (q *DynamoDBSendQueue) Lease(ctx context.Context, owner string, max int) ([]*SendQueueItem, error) {
+
+	ctx = withOperation(ctx, "Lease")
+
+	now := time.Now()
+	str_now := strconv.FormatInt(now.Unix(), 10)
+
+	req := &aws_dynamodb.QueryInput{
+		TableName:              aws.String(q.options.FullTableName()),
+		IndexName:              aws.String(SEND_QUEUE_LEASE_INDEX),
+		KeyConditionExpression: aws.String("#queue = :queue AND #leased_until <= :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#queue":        aws.String("queue"),
+			"#leased_until": aws.String("leased_until"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":queue": {
+				S: aws.String(q.queue()),
+			},
+			":now": {
+				N: aws.String(str_now),
+			},
+		},
+	}
+
+	if max > 0 {
+		req.Limit = aws.Int64(int64(max))
+	}
+
+	leased := make([]*SendQueueItem, 0)
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return nil, err
+		}
+
+		rsp, err := q.client.QueryWithContext(ctx, req)
+
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		for _, attrs := range rsp.Items {
+
+			var candidate *SendQueueItem
+
+			err := aws_dynamodbattribute.UnmarshalMap(attrs, &candidate)
+
+			if err != nil {
+				return nil, err
+			}
+
+			item, err := q.lease(ctx, candidate.Id, owner, now)
+
+			if errors.Is(err, ErrLeaseLost) {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			leased = append(leased, item)
+
+			if max > 0 && len(leased) >= max {
+				return leased, nil
+			}
+		}
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return leased, nil
+}
+
+// lease leases the item with 'id' to 'owner', provided its current lease has expired at 'now'.
+func (q *DynamoDBSendQueue) lease(ctx context.Context, id string, owner string, now time.Time) (*SendQueueItem, error) {
+
+	until := now.Add(q.leaseTimeout()).Unix()
+
+	req := &aws_dynamodb.UpdateItemInput{
+		TableName: aws.String(q.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(id),
+			},
+		},
+		UpdateExpression:    aws.String("SET #leased_until = :until, #lease_owner = :owner ADD #attempts :one"),
+		ConditionExpression: aws.String("attribute_exists(#id) AND #leased_until <= :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id":           aws.String("id"),
+			"#leased_until": aws.String("leased_until"),
+			"#lease_owner":  aws.String("lease_owner"),
+			"#attempts":     aws.String("attempts"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":until": {
+				N: aws.String(strconv.FormatInt(until, 10)),
+			},
+			":now": {
+				N: aws.String(strconv.FormatInt(now.Unix(), 10)),
+			},
+			":owner": {
+				S: aws.String(owner),
+			},
+			":one": {
+				N: aws.String("1"),
+			},
+		},
+		ReturnValues: aws.String(aws_dynamodb.ReturnValueAllNew),
+	}
+
+	rsp, err := q.client.UpdateItemWithContext(ctx, req)
+
+	if err != nil {
+		return nil, leaseError(id, err)
+	}
+
+	var item *SendQueueItem
+
+	err = aws_dynamodbattribute.UnmarshalMap(rsp.Attributes, &item)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// Extend extends the lease on 'item' by the LeaseTimeout option, updating its LeasedUntil property. It returns
+// ErrLeaseLost if the lease has already expired or been taken by another sender.
+func (q *DynamoDBSendQueue) Extend(ctx context.Context, item *SendQueueItem) error {
+
+	ctx = withOperation(ctx, "Extend")
+
+	until := time.Now().Add(q.leaseTimeout()).Unix()
+
+	req := &aws_dynamodb.UpdateItemInput{
+		TableName:           aws.String(q.options.FullTableName()),
+		Key:                 sendQueueKey(item),
+		UpdateExpression:    aws.String("SET #leased_until = :until"),
+		ConditionExpression: leaseCondition(),
+		ExpressionAttributeNames: map[string]*string{
+			"#leased_until": aws.String("leased_until"),
+			"#lease_owner":  aws.String("lease_owner"),
+		},
+		ExpressionAttributeValues: leaseValues(item, map[string]*aws_dynamodb.AttributeValue{
+			":until": {
+				N: aws.String(strconv.FormatInt(until, 10)),
+			},
+		}),
+	}
+
+	_, err := q.client.UpdateItemWithContext(ctx, req)
+
+	if err != nil {
+		return leaseError(item.Id, err)
+	}
+
+	item.LeasedUntil = until
+	return nil
+}
+
+// Complete removes 'item' from the queue once it has been sent. It returns ErrLeaseLost if the lease has
+// already expired or been taken by another sender, in which case the item may be sent twice.
+func (q *DynamoDBSendQueue) Complete(ctx context.Context, item *SendQueueItem) error {
+
+	ctx = withOperation(ctx, "Complete")
+
+	req := &aws_dynamodb.DeleteItemInput{
+		TableName:           aws.String(q.options.FullTableName()),
+		Key:                 sendQueueKey(item),
+		ConditionExpression: leaseCondition(),
+		ExpressionAttributeNames: map[string]*string{
+			"#leased_until": aws.String("leased_until"),
+			"#lease_owner":  aws.String("lease_owner"),
+		},
+		ExpressionAttributeValues: leaseValues(item, nil),
+	}
+
+	_, err := q.client.DeleteItemWithContext(ctx, req)
+
+	if err != nil {
+		return leaseError(item.Id, err)
+	}
+
+	return nil
+}
+
+// Release gives up the lease on 'item', making it available to other senders immediately, for example after
+// a failed send that should be retried.
+func (q *DynamoDBSendQueue) Release(ctx context.Context, item *SendQueueItem) error {
+
+	ctx = withOperation(ctx, "Release")
+
+	req := &aws_dynamodb.UpdateItemInput{
+		TableName:           aws.String(q.options.FullTableName()),
+		Key:                 sendQueueKey(item),
+		UpdateExpression:    aws.String("SET #leased_until = :zero REMOVE #lease_owner"),
+		ConditionExpression: leaseCondition(),
+		ExpressionAttributeNames: map[string]*string{
+			"#leased_until": aws.String("leased_until"),
+			"#lease_owner":  aws.String("lease_owner"),
+		},
+		ExpressionAttributeValues: leaseValues(item, map[string]*aws_dynamodb.AttributeValue{
+			":zero": {
+				N: aws.String("0"),
+			},
+		}),
+	}
+
+	_, err := q.client.UpdateItemWithContext(ctx, req)
+
+	if err != nil {
+		return leaseError(item.Id, err)
+	}
+
+	item.LeasedUntil = 0
+	item.LeaseOwner = ""
+
+	return nil
+}
+
+func sendQueueKey(item *SendQueueItem) map[string]*aws_dynamodb.AttributeValue {
+
+	return map[string]*aws_dynamodb.AttributeValue{
+		"id": {
+			S: aws.String(item.Id),
+		},
+	}
+}
+
+// leaseCondition returns the condition that the lease on an item is still held by the sender that leased it.
+// The lease expiry time acts as a fencing token: it changes each time the item is leased so a sender whose
+// lease expired, and was taken by another sender, can not act on the item even if it reuses the same owner.
+func leaseCondition() *string {
+	return aws.String("#lease_owner = :owner AND #leased_until = :leased_until AND #leased_until > :now")
+}
+
+func leaseValues(item *SendQueueItem, values map[string]*aws_dynamodb.AttributeValue) map[string]*aws_dynamodb.AttributeValue {
+
+	if values == nil {
+		values = make(map[string]*aws_dynamodb.AttributeValue)
+	}
+
+	values[":owner"] = &aws_dynamodb.AttributeValue{
+		S: aws.String(item.LeaseOwner),
+	}
+
+	values[":leased_until"] = &aws_dynamodb.AttributeValue{
+		N: aws.String(strconv.FormatInt(item.LeasedUntil, 10)),
+	}
+
+	values[":now"] = &aws_dynamodb.AttributeValue{
+		N: aws.String(strconv.FormatInt(time.Now().Unix(), 10)),
+	}
+
+	return values
+}
+
+func leaseError(id string, err error) error {
+
+	err = wrapError(err)
+
+	if errors.Is(err, ErrConditionFailed) {
+		return fmt.Errorf("Failed to update lease for %s, %w", id, ErrLeaseLost)
+	}
+
+	return err
+}
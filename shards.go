@@ -0,0 +1,193 @@
+package dynamodb
+
+import (
+	"context"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"hash/fnv"
+	"strconv"
+)
+
+// SHARD_SEPARATOR separates a key from the write shard suffixed onto it by `shardKey`.
+const SHARD_SEPARATOR string = "#"
+
+// SUBSCRIPTIONS_DEFAULT_WRITE_SHARDS is the number of write shards hot keys are split across unless the
+// WriteShards option is set.
+const SUBSCRIPTIONS_DEFAULT_WRITE_SHARDS int = 8
+
+// SUBSCRIPTIONS_MAX_WRITE_SHARDS is the maximum value of the WriteShards option. Every shard is queried on read
+// so large values make reads proportionally more expensive.
+const SUBSCRIPTIONS_MAX_WRITE_SHARDS int = 100
+
+// writeShards returns the WriteShards option or SUBSCRIPTIONS_DEFAULT_WRITE_SHARDS if it is not set.
+func (opts *DynamoDBSubscriptionsDatabaseOptions) writeShards() int {
+
+	if opts.WriteShards <= 0 {
+		return SUBSCRIPTIONS_DEFAULT_WRITE_SHARDS
+	}
+
+	return opts.WriteShards
+}
+
+// writeShard returns the write shard, between 0 and 'shards' - 1, for the item whose "address" key is 'addr'.
+// Shards are chosen by hashing the key so that an item always writes to the same shard.
+func writeShard(addr string, shards int) int {
+
+	h := fnv.New32a()
+	h.Write([]byte(addr))
+
+	return int(h.Sum32() % uint32(shards))
+}
+
+// shardKey returns 'key' suffixed with 'shard', for example "2024-05-01#3".
+func shardKey(key string, shard int) string {
+	return key + SHARD_SEPARATOR + strconv.Itoa(shard)
+}
+
+// shardKeys returns 'key' suffixed with each of 'shards' write shards, in order.
+func shardKeys(key string, shards int) []string {
+
+	keys := make([]string, shards)
+
+	for i := 0; i < shards; i++ {
+		keys[i] = shardKey(key, i)
+	}
+
+	return keys
+}
+
+// shardCursor reads the pages of results of a query of one write shard as they are needed.
+type shardCursor struct {
+	req     *aws_dynamodb.QueryInput
+	backoff *pageBackoff
+	items   []map[string]*aws_dynamodb.AttributeValue
+	offset  int
+	done    bool
+}
+
+// peek returns the next item from the shard, fetching its next page first if necessary, or nil once the shard
+// has been read.
+func (c *shardCursor) peek(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI) (map[string]*aws_dynamodb.AttributeValue, error) {
+
+	for c.offset >= len(c.items) {
+
+		if c.done {
+			return nil, nil
+		}
+
+		err := ctx.Err()
+
+		if err != nil {
+			return nil, err
+		}
+
+		rsp, err := client.QueryWithContext(ctx, c.req)
+
+		if err != nil {
+
+			err = c.backoff.retry(ctx, err, &c.req.Limit)
+
+			if err != nil {
+				return nil, wrapError(err)
+			}
+
+			continue
+		}
+
+		c.backoff.succeeded(aws.Int64Value(rsp.ScannedCount), &c.req.Limit)
+
+		c.items = rsp.Items
+		c.offset = 0
+
+		c.req.ExclusiveStartKey = rsp.LastEvaluatedKey
+		c.done = rsp.LastEvaluatedKey == nil
+	}
+
+	return c.items[c.offset], nil
+}
+
+// queryShardedSubscriptions runs each of 'reqs', one per write shard of a sharded index whose sort key is the
+// numeric attribute 'sort_attr', and invokes 'callback' for the subscriptions they return merged in ascending
+// order of that attribute, as though the index were not sharded.
+func queryShardedSubscriptions(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSubscriptionsDatabaseOptions, reqs []*aws_dynamodb.QueryInput, sort_attr string, callback database.ListSubscriptionsFunc) error {
+
+	cursors := make([]*shardCursor, len(reqs))
+
+	for i, req := range reqs {
+
+		withTenantFilter(opts.Tenant, &req.FilterExpression, &req.ExpressionAttributeNames, &req.ExpressionAttributeValues)
+
+		cursors[i] = &shardCursor{
+			req:     req,
+			backoff: newPageBackoff(opts.ScanBackoff, req.Limit),
+		}
+	}
+
+	for {
+
+		var next *shardCursor
+		var next_item map[string]*aws_dynamodb.AttributeValue
+		var next_sort int64
+
+		// ties are broken by shard so that the merged order is stable
+
+		for _, c := range cursors {
+
+			item, err := c.peek(ctx, client)
+
+			if err != nil {
+				return err
+			}
+
+			if item == nil {
+				continue
+			}
+
+			v := int64(0)
+
+			attr, ok := item[sort_attr]
+
+			if ok && attr.N != nil {
+				v, _ = strconv.ParseInt(*attr.N, 10, 64)
+			}
+
+			if next == nil || v < next_sort {
+				next = c
+				next_item = item
+				next_sort = v
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+
+		next.offset += 1
+
+		err := upgradeSubscriptionItem(ctx, client, opts, next_item, next.req.ProjectionExpression == nil)
+
+		if err != nil {
+			return err
+		}
+
+		err = restoreSubscriptionItem(ctx, opts, next_item)
+
+		if err != nil {
+			return err
+		}
+
+		sub, err := itemToSubscription(next_item)
+
+		if err != nil {
+			return err
+		}
+
+		err = callback(sub)
+
+		if err != nil {
+			return err
+		}
+	}
+}
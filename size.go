@@ -0,0 +1,115 @@
+package dynamodb
+
+import (
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strings"
+)
+
+// ItemSize returns the approximate size in bytes of 'item' as DynamoDB calculates it for the purposes of
+// capacity consumption and the 400KB item size limit: the length of each attribute name plus the size of
+// its value.
+//
+// https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/CapacityUnitCalculations.html
+func ItemSize(item map[string]*aws_dynamodb.AttributeValue) int {
+
+	size := 0
+
+	for k, v := range item {
+		size += len(k) + attributeValueSize(v)
+	}
+
+	return size
+}
+
+func attributeValueSize(v *aws_dynamodb.AttributeValue) int {
+
+	if v == nil {
+		return 0
+	}
+
+	switch {
+	case v.S != nil:
+		return len(*v.S)
+	case v.N != nil:
+		return numberSize(*v.N)
+	case v.B != nil:
+		return len(v.B)
+	case v.BOOL != nil, v.NULL != nil:
+		return 1
+	case v.SS != nil:
+
+		size := 0
+
+		for _, s := range v.SS {
+			size += len(*s)
+		}
+
+		return size
+
+	case v.NS != nil:
+
+		size := 0
+
+		for _, n := range v.NS {
+			size += numberSize(*n)
+		}
+
+		return size
+
+	case v.BS != nil:
+
+		size := 0
+
+		for _, b := range v.BS {
+			size += len(b)
+		}
+
+		return size
+
+	case v.M != nil:
+
+		// 3 bytes overhead for the map plus 1 byte per element
+		size := 3
+
+		for k, el := range v.M {
+			size += len(k) + attributeValueSize(el) + 1
+		}
+
+		return size
+
+	case v.L != nil:
+
+		// 3 bytes overhead for the list plus 1 byte per element
+		size := 3
+
+		for _, el := range v.L {
+			size += attributeValueSize(el) + 1
+		}
+
+		return size
+	}
+
+	return 0
+}
+
+// numberSize approximates the size of a number: roughly one byte per two significant digits, plus one byte.
+// Leading and trailing zeroes, the sign, the decimal point and any exponent are not significant.
+func numberSize(n string) int {
+
+	idx := strings.IndexAny(n, "eE")
+
+	if idx != -1 {
+		n = n[:idx]
+	}
+
+	digits := strings.Replace(strings.TrimLeft(n, "+-"), ".", "", 1)
+	digits = strings.Trim(digits, "0")
+
+	size := (len(digits)+1)/2 + 1
+
+	if size > 21 {
+		size = 21
+	}
+
+	return size
+}
@@ -0,0 +1,141 @@
+package dynamodb
+
+import (
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strings"
+	"testing"
+)
+
+func TestNumberSize(t *testing.T) {
+
+	tests := []struct {
+		n        string
+		expected int
+	}{
+		{"0", 1},
+		{"1", 2},
+		{"12", 2},
+		{"123", 3},
+		{"-123", 3},
+		{"+123", 3},
+		// leading and trailing zeroes are not significant
+		{"000123", 3},
+		{"1000", 2},
+		{"0.001", 2},
+		{"1.50", 2},
+		{"10.5", 3},
+		// exponents are not significant digits
+		{"1.5E+10", 2},
+		{"-2e-3", 2},
+		// numbers have at most 38 significant digits, which is 21 bytes
+		{"12345678901234567890123456789012345678", 20},
+		{"123456789012345678901234567890123456789012", 21},
+	}
+
+	for _, test := range tests {
+
+		size := numberSize(test.n)
+
+		if size != test.expected {
+			t.Fatalf("Expected size of %s to be %d, got %d", test.n, test.expected, size)
+		}
+	}
+}
+
+func TestItemSize(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		item     map[string]*aws_dynamodb.AttributeValue
+		expected int
+	}{
+		{
+			name:     "empty",
+			item:     map[string]*aws_dynamodb.AttributeValue{},
+			expected: 0,
+		},
+		{
+			// attribute names and strings are counted in UTF-8 bytes
+			name: "string",
+			item: map[string]*aws_dynamodb.AttributeValue{
+				"address": {S: aws.String("bücher@example.com")},
+			},
+			expected: 7 + 19,
+		},
+		{
+			name: "number",
+			item: map[string]*aws_dynamodb.AttributeValue{
+				"created": {N: aws.String("1700000000")},
+			},
+			expected: 7 + 2,
+		},
+		{
+			// binary values are counted in raw, not base64-encoded, bytes
+			name: "binary",
+			item: map[string]*aws_dynamodb.AttributeValue{
+				"b": {B: []byte{0x00, 0x01, 0x02, 0x03}},
+			},
+			expected: 1 + 4,
+		},
+		{
+			name: "bool and null",
+			item: map[string]*aws_dynamodb.AttributeValue{
+				"ok":  {BOOL: aws.Bool(true)},
+				"nil": {NULL: aws.Bool(true)},
+			},
+			expected: 2 + 1 + 3 + 1,
+		},
+		{
+			name: "sets",
+			item: map[string]*aws_dynamodb.AttributeValue{
+				"ss": {SS: []*string{aws.String("a"), aws.String("bc")}},
+				"ns": {NS: []*string{aws.String("1"), aws.String("123")}},
+				"bs": {BS: [][]byte{{0x01}, {0x02, 0x03}}},
+			},
+			expected: (2 + 3) + (2 + 2 + 3) + (2 + 3),
+		},
+		{
+			// maps and lists are 3 bytes plus 1 byte per element, even if they are empty
+			name: "empty map and list",
+			item: map[string]*aws_dynamodb.AttributeValue{
+				"m": {M: map[string]*aws_dynamodb.AttributeValue{}},
+				"l": {L: []*aws_dynamodb.AttributeValue{}},
+			},
+			expected: (1 + 3) + (1 + 3),
+		},
+		{
+			name: "nested",
+			item: map[string]*aws_dynamodb.AttributeValue{
+				"meta": {M: map[string]*aws_dynamodb.AttributeValue{
+					"tags": {L: []*aws_dynamodb.AttributeValue{
+						{S: aws.String("news")},
+						{N: aws.String("12")},
+						{M: map[string]*aws_dynamodb.AttributeValue{
+							"x": {B: []byte{0xff}},
+						}},
+					}},
+				}},
+			},
+			// meta: 4 + map(3 + "tags" 4 + list + 1)
+			// list: 3 + (4 + 1) + (2 + 1) + (map(3 + 1 + 1 + 1) + 1)
+			expected: 4 + (3 + 4 + (3 + 5 + 3 + 7) + 1),
+		},
+		{
+			name: "large string",
+			item: map[string]*aws_dynamodb.AttributeValue{
+				"body": {S: aws.String(strings.Repeat("x", 1024))},
+			},
+			expected: 4 + 1024,
+		},
+	}
+
+	for _, test := range tests {
+
+		size := ItemSize(test.item)
+
+		if size != test.expected {
+			t.Fatalf("Expected size of %s item to be %d, got %d", test.name, test.expected, size)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package dynamodb
+
+import (
+	"context"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"net/http"
+	"time"
+)
+
+const STATS_DEFAULT_TABLENAME string = "subscription_stats"
+
+// STATS_DEFAULT_LIST is the value of the "list" key of the snapshots written by a stats database without a Tenant option.
+const STATS_DEFAULT_LIST string = "default"
+
+// STATS_DATE_FORMAT is the layout of the "date" key of each snapshot.
+const STATS_DATE_FORMAT string = "2006-01-02"
+
+// StatsSnapshot is a daily roll-up of the subscriptions in a list.
+type StatsSnapshot struct {
+	// Date is the (UTC) day the snapshot was taken, formatted with STATS_DATE_FORMAT.
+	Date string `json:"date"`
+	// Recorded is the Unix time the snapshot was taken.
+	Recorded int64 `json:"recorded"`
+	// Total is the number of subscriptions.
+	Total int64 `json:"total"`
+	// Confirmed is the number of subscriptions which have been confirmed.
+	Confirmed int64 `json:"confirmed"`
+	// New is the number of subscriptions created during Date.
+	New int64 `json:"new"`
+	// Unsubscribed is the number of subscriptions with the STATUS_UNSUBSCRIBED status.
+	Unsubscribed int64 `json:"unsubscribed"`
+	// Bounced is the number of subscriptions with the STATUS_BOUNCED status.
+	Bounced int64 `json:"bounced"`
+}
+
+// ListStatsSnapshotsFunc is a callback function invoked for each snapshot when listing snapshots.
+type ListStatsSnapshotsFunc func(*StatsSnapshot) error
+
+type DynamoDBStatsDatabaseOptions struct {
+	TableName   string
+	TablePrefix string
+	TableSuffix string
+	BillingMode string
+	CreateTable bool
+	// DeletionProtection enables deletion protection when the table is created.
+	DeletionProtection bool
+	// TableClass is the table class (STANDARD or STANDARD_INFREQUENT_ACCESS) used when the table is created.
+	// If empty STANDARD is used.
+	TableClass string
+	// ContributorInsights enables CloudWatch Contributor Insights for the table and its indexes when the table is created.
+	ContributorInsights bool
+	// Tenant is an optional identifier used as the "list" key of every snapshot, so that the snapshots for
+	// several lists can share a table. It should be the same as the Tenant option of the subscriptions database
+	// whose snapshots are written. If empty STATS_DEFAULT_LIST is used.
+	Tenant string
+	// ReturnConsumedCapacity is the level of consumed capacity detail (TOTAL or INDEXES) to request when
+	// ConsumedCapacityFunc is set. If empty TOTAL is used.
+	ReturnConsumedCapacity string
+	// ConsumedCapacityFunc is an optional callback invoked with the capacity consumed by each request.
+	ConsumedCapacityFunc ConsumedCapacityFunc
+	// CapacityLimiter is an optional `CapacityLimiter` which caps the read and write capacity consumed per second.
+	CapacityLimiter *CapacityLimiter
+	// Middleware is an optional chain of `Middleware` invoked around each request to DynamoDB, the first of which is outermost.
+	Middleware []Middleware
+	// ReadOnly rejects every request which would write to the table with ErrReadOnly, before it is sent. It may not
+	// be used with CreateTable.
+	ReadOnly bool
+	// HTTPClient is an optional HTTP client used by the session and DSN constructors in place of the session's
+	// default client. See `NewHTTPClient`.
+	HTTPClient *http.Client
+	// Region is the AWS region of the table, used in place of the session's region by the session and DSN constructors.
+	// If empty the region of the table's ARN, if TableName is an ARN, and otherwise the session's region is used.
+	Region string
+	// Endpoint is the URL of the DynamoDB endpoint, for example "http://localhost:8000" for DynamoDB Local, used in place
+	// of the session's endpoint by the session and DSN constructors. It takes precedence over UseFIPSEndpoint and
+	// UseDualStackEndpoint. If empty the session's endpoint is used.
+	Endpoint string
+	// UseFIPSEndpoint selects the FIPS 140-2 validated DynamoDB endpoint for the session's region.
+	UseFIPSEndpoint bool
+	// UseDualStackEndpoint selects the dual-stack (IPv4 and IPv6) DynamoDB endpoint for the session's region.
+	UseDualStackEndpoint bool
+	// Retry is an optional `RetryOptions` used to retry failed requests in place of the AWS SDK's default retryer.
+	Retry *RetryOptions
+}
+
+func DefaultDynamoDBStatsDatabaseOptions() *DynamoDBStatsDatabaseOptions {
+
+	opts := DynamoDBStatsDatabaseOptions{
+		TableName:   STATS_DEFAULT_TABLENAME,
+		BillingMode: "PAY_PER_REQUEST",
+		CreateTable: false,
+	}
+
+	return &opts
+}
+
+// FullTableName returns the name of the table with the TablePrefix and TableSuffix options applied.
+func (opts *DynamoDBStatsDatabaseOptions) FullTableName() string {
+	return fullTableName(opts.TablePrefix, opts.TableName, opts.TableSuffix)
+}
+
+// list returns the value of the "list" key of the snapshots written with 'opts'.
+func (opts *DynamoDBStatsDatabaseOptions) list() string {
+
+	if opts.Tenant == "" {
+		return STATS_DEFAULT_LIST
+	}
+
+	return opts.Tenant
+}
+
+// DynamoDBStatsDatabase stores a daily `StatsSnapshot` for a list, keyed on the list and the date, so that list
+// growth can be graphed without scanning the subscriptions table for each point.
+type DynamoDBStatsDatabase struct {
+	client  aws_dynamodbiface.DynamoDBAPI
+	options *DynamoDBStatsDatabaseOptions
+}
+
+func NewDynamoDBStatsDatabaseWithDSN(dsn string, opts *DynamoDBStatsDatabaseOptions) (*DynamoDBStatsDatabase, error) {
+
+	sess, err := newSessionWithDSNSettings(dsn, DSN_STATS_TABLE_KEY, opts.settings())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDynamoDBStatsDatabaseWithSession(sess, opts)
+}
+
+func NewDynamoDBStatsDatabaseWithSession(sess *aws_session.Session, opts *DynamoDBStatsDatabaseOptions) (*DynamoDBStatsDatabase, error) {
+
+	client := opts.settings().newClient(sess)
+
+	return NewDynamoDBStatsDatabaseWithClient(client, opts)
+}
+
+// NewDynamoDBStatsDatabaseWithClient returns a new `DynamoDBStatsDatabase` instance that uses 'client'
+// to talk to DynamoDB.
+func NewDynamoDBStatsDatabaseWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBStatsDatabaseOptions) (*DynamoDBStatsDatabase, error) {
+
+	err := opts.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	client = withMiddleware(client, opts.settings().middleware())
+
+	if opts.CreateTable {
+
+		_, err := CreateStatsTable(client, opts)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db := DynamoDBStatsDatabase{
+		client:  client,
+		options: opts,
+	}
+
+	return &db, nil
+}
+
+// WriteSnapshot takes a snapshot of the subscriptions in 'subs', for the (UTC) day containing 'now', and writes
+// it to the table, replacing any snapshot already written for that day. It scans the subscriptions table once.
+func (db *DynamoDBStatsDatabase) WriteSnapshot(ctx context.Context, subs *DynamoDBSubscriptionsDatabase, now time.Time) (*StatsSnapshot, error) {
+
+	ctx = withOperation(ctx, "WriteSnapshot")
+
+	s, err := subs.StatsSnapshot(ctx, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.PutStatsSnapshot(ctx, s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// PutStatsSnapshot writes 's' to the table, replacing any snapshot already written for its date.
+func (db *DynamoDBStatsDatabase) PutStatsSnapshot(ctx context.Context, s *StatsSnapshot) error {
+
+	ctx = withOperation(ctx, "PutStatsSnapshot")
+
+	_, err := time.Parse(STATS_DATE_FORMAT, s.Date)
+
+	if err != nil {
+		return validationError("stats snapshot", "date", s.Date, err.Error())
+	}
+
+	item, err := aws_dynamodbattribute.MarshalMap(s)
+
+	if err != nil {
+		return err
+	}
+
+	item["list"] = &aws_dynamodb.AttributeValue{
+		S: aws.String(db.options.list()),
+	}
+
+	req := &aws_dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(db.options.FullTableName()),
+	}
+
+	_, err = db.client.PutItemWithContext(ctx, req)
+
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return nil
+}
+
+// GetStatsSnapshot returns the snapshot for the (UTC) day containing 't'. It returns a `database.NoRecordError`
+// if no snapshot was written that day.
+func (db *DynamoDBStatsDatabase) GetStatsSnapshot(ctx context.Context, t time.Time) (*StatsSnapshot, error) {
+
+	ctx = withOperation(ctx, "GetStatsSnapshot")
+
+	req := &aws_dynamodb.GetItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"list": {
+				S: aws.String(db.options.list()),
+			},
+			"date": {
+				S: aws.String(t.UTC().Format(STATS_DATE_FORMAT)),
+			},
+		},
+	}
+
+	rsp, err := db.client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	if rsp.Item == nil {
+		return nil, new(database.NoRecordError)
+	}
+
+	var s *StatsSnapshot
+
+	err = aws_dynamodbattribute.UnmarshalMap(rsp.Item, &s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// ListStatsSnapshots invokes 'callback' for each snapshot taken between the (UTC) days containing 'from' and
+// 'to', inclusive, oldest first.
+func (db *DynamoDBStatsDatabase) ListStatsSnapshots(ctx context.Context, from time.Time, to time.Time, callback ListStatsSnapshotsFunc) error {
+
+	ctx = withOperation(ctx, "ListStatsSnapshots")
+
+	req := &aws_dynamodb.QueryInput{
+		TableName:              aws.String(db.options.FullTableName()),
+		KeyConditionExpression: aws.String("#list = :list AND #date BETWEEN :from AND :to"),
+		ExpressionAttributeNames: map[string]*string{
+			"#list": aws.String("list"),
+			"#date": aws.String("date"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":list": {
+				S: aws.String(db.options.list()),
+			},
+			":from": {
+				S: aws.String(from.UTC().Format(STATS_DATE_FORMAT)),
+			},
+			":to": {
+				S: aws.String(to.UTC().Format(STATS_DATE_FORMAT)),
+			},
+		},
+		ScanIndexForward: aws.Bool(true),
+	}
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return err
+		}
+
+		rsp, err := db.client.QueryWithContext(ctx, req)
+
+		if err != nil {
+			return wrapError(err)
+		}
+
+		for _, item := range rsp.Items {
+
+			err := ctx.Err()
+
+			if err != nil {
+				return err
+			}
+
+			var s *StatsSnapshot
+
+			err = aws_dynamodbattribute.UnmarshalMap(item, &s)
+
+			if err != nil {
+				return err
+			}
+
+			err = callback(s)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+	}
+
+	return nil
+}
+
+// StatsSnapshot returns a `StatsSnapshot` of the subscriptions in 'db' for the (UTC) day containing 'now'. This
+// is a scan of the entire table which only reads the attributes it counts.
+func (db *DynamoDBSubscriptionsDatabase) StatsSnapshot(ctx context.Context, now time.Time) (*StatsSnapshot, error) {
+
+	ctx = withOperation(ctx, "StatsSnapshot")
+
+	y, m, d := now.UTC().Date()
+	day_start := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	day_end := day_start.AddDate(0, 0, 1)
+
+	s := &StatsSnapshot{
+		Date:     day_start.Format(STATS_DATE_FORMAT),
+		Recorded: now.Unix(),
+	}
+
+	req := &aws_dynamodb.ScanInput{
+		TableName:            aws.String(db.options.FullTableName()),
+		ProjectionExpression: aws.String("#status, #state, #created, #confirmed"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status":    aws.String("status"),
+			"#state":     aws.String(SUBSCRIPTION_STATE_ATTRIBUTE),
+			"#created":   aws.String("created"),
+			"#confirmed": aws.String("confirmed"),
+		},
+	}
+
+	withTenantFilter(db.options.Tenant, &req.FilterExpression, &req.ExpressionAttributeNames, &req.ExpressionAttributeValues)
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
+	}
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return nil, err
+		}
+
+		rsp, err := db.client.ScanWithContext(ctx, req)
+
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		for _, item := range rsp.Items {
+
+			s.Total += 1
+
+			if activityTime(item, "confirmed") > 0 {
+				s.Confirmed += 1
+			}
+
+			created := activityTime(item, "created")
+
+			if created >= day_start.Unix() && created < day_end.Unix() {
+				s.New += 1
+			}
+
+			status, err := subscriptionStatusFromItem(item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			switch status {
+			case STATUS_UNSUBSCRIBED:
+				s.Unsubscribed += 1
+			case STATUS_BOUNCED:
+				s.Bounced += 1
+			}
+		}
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return s, nil
+}
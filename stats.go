@@ -0,0 +1,117 @@
+package dynamodb
+
+import (
+	"context"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strconv"
+	"time"
+)
+
+// CountSubscriptionsWithStatus returns the number of subscriptions with 'status', using a COUNT query of the
+// "status" index rather than a scan of the table.
+func (db *DynamoDBSubscriptionsDatabase) CountSubscriptionsWithStatus(ctx context.Context, status int) (int64, error) {
+
+	ctx = withOperation(ctx, "CountSubscriptionsWithStatus")
+
+	req := &aws_dynamodb.QueryInput{
+		TableName:              aws.String(db.options.FullTableName()),
+		IndexName:              aws.String("status"),
+		Select:                 aws.String(aws_dynamodb.SelectCount),
+		KeyConditionExpression: aws.String("#status = :status"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":status": {
+				N: aws.String(strconv.Itoa(status)),
+			},
+		},
+	}
+
+	withTenantFilter(db.options.Tenant, &req.FilterExpression, &req.ExpressionAttributeNames, &req.ExpressionAttributeValues)
+
+	count := int64(0)
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return 0, err
+		}
+
+		rsp, err := db.client.QueryWithContext(ctx, req)
+
+		if err != nil {
+			return 0, wrapError(err)
+		}
+
+		count += aws.Int64Value(rsp.Count)
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return count, nil
+}
+
+// CountConfirmations returns the number of outstanding confirmations, created within the MaxAge option of 'now',
+// and the number of expired confirmations. There is no index suitable for range queries on creation time so
+// this is a COUNT scan of the table.
+func (db *DynamoDBConfirmationsDatabase) CountConfirmations(ctx context.Context, now time.Time) (int64, int64, error) {
+
+	ctx = withOperation(ctx, "CountConfirmations")
+
+	min_created := int64(0)
+
+	if db.options.MaxAge > 0 {
+		min_created = now.Add(-db.options.MaxAge).Unix()
+	}
+
+	req := &aws_dynamodb.ScanInput{
+		TableName:        aws.String(db.options.FullTableName()),
+		Select:           aws.String(aws_dynamodb.SelectCount),
+		FilterExpression: aws.String("#created >= :min_created"),
+		ExpressionAttributeNames: map[string]*string{
+			"#created": aws.String("created"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":min_created": {
+				N: aws.String(strconv.FormatInt(min_created, 10)),
+			},
+		},
+	}
+
+	outstanding := int64(0)
+	scanned := int64(0)
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		rsp, err := db.client.ScanWithContext(ctx, req)
+
+		if err != nil {
+			return 0, 0, wrapError(err)
+		}
+
+		outstanding += aws.Int64Value(rsp.Count)
+		scanned += aws.Int64Value(rsp.ScannedCount)
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return outstanding, scanned - outstanding, nil
+}
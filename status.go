@@ -0,0 +1,262 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/database"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strconv"
+	"time"
+)
+
+// SUBSCRIPTION_STATE_ATTRIBUTE is the name of the attribute a subscription's `SubscriptionStatus` is stored in,
+// alongside the go-mailinglist "status" attribute.
+const SUBSCRIPTION_STATE_ATTRIBUTE string = "state"
+
+// SubscriptionStatus is the lifecycle status of a subscription. It is a richer version of the go-mailinglist
+// subscription status, to which each value maps (see `LegacyStatus`) so that both can be stored together.
+type SubscriptionStatus string
+
+// STATUS_PENDING is the status of a subscription which has not been confirmed yet.
+const STATUS_PENDING SubscriptionStatus = "pending"
+
+// STATUS_ACTIVE is the status of a confirmed subscription to which messages are delivered.
+const STATUS_ACTIVE SubscriptionStatus = "active"
+
+// STATUS_UNSUBSCRIBED is the status of a subscription the subscriber has unsubscribed from.
+const STATUS_UNSUBSCRIBED SubscriptionStatus = "unsubscribed"
+
+// STATUS_BOUNCED is the status of a subscription disabled because messages to it bounced.
+const STATUS_BOUNCED SubscriptionStatus = "bounced"
+
+// STATUS_SUPPRESSED is the status of a subscription to which messages must never be sent, for example
+// following a complaint.
+const STATUS_SUPPRESSED SubscriptionStatus = "suppressed"
+
+// LegacyStatus returns the go-mailinglist subscription status 's' is stored as. Both STATUS_UNSUBSCRIBED and
+// STATUS_BOUNCED are stored as SUBSCRIPTION_STATUS_DISABLED.
+func (s SubscriptionStatus) LegacyStatus() (int, error) {
+
+	switch s {
+	case STATUS_PENDING:
+		return subscription.SUBSCRIPTION_STATUS_PENDING, nil
+	case STATUS_ACTIVE:
+		return subscription.SUBSCRIPTION_STATUS_ENABLED, nil
+	case STATUS_UNSUBSCRIBED, STATUS_BOUNCED:
+		return subscription.SUBSCRIPTION_STATUS_DISABLED, nil
+	case STATUS_SUPPRESSED:
+		return subscription.SUBSCRIPTION_STATUS_BLOCKED, nil
+	default:
+		return 0, fmt.Errorf("Invalid subscription status '%s'", s)
+	}
+}
+
+// SubscriptionStatusFromLegacy returns the `SubscriptionStatus` for the go-mailinglist subscription 'status', for
+// subscriptions written without one. SUBSCRIPTION_STATUS_DISABLED is mapped to STATUS_UNSUBSCRIBED.
+func SubscriptionStatusFromLegacy(status int) (SubscriptionStatus, error) {
+
+	switch status {
+	case subscription.SUBSCRIPTION_STATUS_PENDING:
+		return STATUS_PENDING, nil
+	case subscription.SUBSCRIPTION_STATUS_ENABLED:
+		return STATUS_ACTIVE, nil
+	case subscription.SUBSCRIPTION_STATUS_DISABLED:
+		return STATUS_UNSUBSCRIBED, nil
+	case subscription.SUBSCRIPTION_STATUS_BLOCKED:
+		return STATUS_SUPPRESSED, nil
+	default:
+		return "", fmt.Errorf("Invalid status %d", status)
+	}
+}
+
+// subscriptionStatusFromItem returns the `SubscriptionStatus` of 'item'. The SUBSCRIPTION_STATE_ATTRIBUTE attribute
+// is only used if it agrees with the "status" attribute, which may have been changed since by an older version of
+// this package or another tool, otherwise the status is mapped from the "status" attribute.
+func subscriptionStatusFromItem(item map[string]*aws_dynamodb.AttributeValue) (SubscriptionStatus, error) {
+
+	v, ok := item["status"]
+
+	if !ok || v.N == nil {
+		return "", fmt.Errorf("Item is missing status attribute")
+	}
+
+	legacy, err := strconv.Atoi(aws.StringValue(v.N))
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse status attribute, %w", err)
+	}
+
+	state, ok := item[SUBSCRIPTION_STATE_ATTRIBUTE]
+
+	if ok && state.S != nil {
+
+		s := SubscriptionStatus(aws.StringValue(state.S))
+		s_legacy, err := s.LegacyStatus()
+
+		if err == nil && s_legacy == legacy {
+			return s, nil
+		}
+	}
+
+	return SubscriptionStatusFromLegacy(legacy)
+}
+
+// GetSubscriptionStatus returns the `SubscriptionStatus` of the subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) GetSubscriptionStatus(ctx context.Context, addr string) (SubscriptionStatus, error) {
+
+	ctx = withOperation(ctx, "GetSubscriptionStatus")
+
+	req := &aws_dynamodb.GetItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"address": {
+				S: aws.String(db.options.addressKey(addr)),
+			},
+		},
+		ProjectionExpression: aws.String("#status, #state"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+			"#state":  aws.String(SUBSCRIPTION_STATE_ATTRIBUTE),
+		},
+	}
+
+	rsp, err := db.client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return "", wrapError(err)
+	}
+
+	if rsp.Item == nil {
+		return "", new(database.NoRecordError)
+	}
+
+	return subscriptionStatusFromItem(rsp.Item)
+}
+
+// SetSubscriptionStatus sets the status of the subscription for 'addr' to 'status', updating both the
+// SUBSCRIPTION_STATE_ATTRIBUTE attribute and the go-mailinglist "status" attribute (see `LegacyStatus`), and its
+// last modified time. It returns a `database.NoRecordError` if there is no subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) SetSubscriptionStatus(ctx context.Context, addr string, status SubscriptionStatus) error {
+
+	ctx = withOperation(ctx, "SetSubscriptionStatus")
+
+	legacy, err := status.LegacyStatus()
+
+	if err != nil {
+		return err
+	}
+
+	update := &SubscriptionUpdate{
+		Status: &legacy,
+		state:  status,
+	}
+
+	return db.updateSubscriptionFields(ctx, addr, update)
+}
+
+// UpdateSubscriptionStatus sets the status of the subscription for 'addr' to 'status', like `SetSubscriptionStatus`,
+// along with the confirmed time that goes with it, using a single UpdateItem request, so that confirmation and
+// unsubscribe handlers need not read and rewrite the entire subscription. As with `subscription.Subscription.Confirm`
+// and `Unconfirm` the confirmed time is set to the current time for STATUS_ACTIVE and to zero for STATUS_PENDING;
+// it is left unchanged for every other status. It returns a `database.NoRecordError` if there is no subscription
+// for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) UpdateSubscriptionStatus(ctx context.Context, addr string, status SubscriptionStatus) error {
+
+	ctx = withOperation(ctx, "UpdateSubscriptionStatus")
+
+	legacy, err := status.LegacyStatus()
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+
+	update := &SubscriptionUpdate{
+		Status:       &legacy,
+		LastModified: &now,
+		state:        status,
+	}
+
+	switch status {
+	case STATUS_ACTIVE:
+		update.Confirmed = &now
+	case STATUS_PENDING:
+		unconfirmed := int64(0)
+		update.Confirmed = &unconfirmed
+	}
+
+	return db.updateSubscriptionFields(ctx, addr, update)
+}
+
+// subscriptionStatusFilter returns the filter expression which distinguishes subscriptions with 'status' from those
+// with other statuses sharing the same legacy status, adding the names and values it uses to 'names' and 'values'.
+// It returns an empty string if no filter is needed.
+func subscriptionStatusFilter(status SubscriptionStatus, names map[string]*string, values map[string]*aws_dynamodb.AttributeValue) string {
+
+	// unsubscribed and bounced subscriptions share the same legacy status so distinguish between them
+	// using the state attribute, which is absent for unsubscribed subscriptions written by older versions
+
+	var filter string
+
+	switch status {
+	case STATUS_BOUNCED:
+		filter = "#state = :bounced"
+	case STATUS_UNSUBSCRIBED:
+		filter = "attribute_not_exists(#state) OR #state <> :bounced"
+	default:
+		return ""
+	}
+
+	names["#state"] = aws.String(SUBSCRIPTION_STATE_ATTRIBUTE)
+
+	values[":bounced"] = &aws_dynamodb.AttributeValue{
+		S: aws.String(string(STATUS_BOUNCED)),
+	}
+
+	return filter
+}
+
+// ListSubscriptionsWithSubscriptionStatus invokes 'callback' for each subscription with 'status', querying the
+// "status" index. Subscriptions written without a `SubscriptionStatus` are matched using `SubscriptionStatusFromLegacy`.
+func (db *DynamoDBSubscriptionsDatabase) ListSubscriptionsWithSubscriptionStatus(ctx context.Context, status SubscriptionStatus, callback database.ListSubscriptionsFunc) error {
+
+	ctx = withOperation(ctx, "ListSubscriptionsWithSubscriptionStatus")
+
+	legacy, err := status.LegacyStatus()
+
+	if err != nil {
+		return err
+	}
+
+	req := &aws_dynamodb.QueryInput{
+		TableName:              aws.String(db.options.FullTableName()),
+		IndexName:              aws.String("status"),
+		KeyConditionExpression: aws.String("#status = :status"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":status": {
+				N: aws.String(strconv.Itoa(legacy)),
+			},
+		},
+	}
+
+	filter := subscriptionStatusFilter(status, req.ExpressionAttributeNames, req.ExpressionAttributeValues)
+
+	if filter != "" {
+		req.FilterExpression = aws.String(filter)
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
+	}
+
+	callback = limitSubscriptionsCallback(db.options.MaxResults, callback)
+
+	err = querySubscriptions(ctx, db.client, db.options, req, callback)
+	return stopListingError(err)
+}
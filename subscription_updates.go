@@ -0,0 +1,295 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/database"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SubscriptionUpdate describes a partial update to a subscription, applied by `UpdateSubscriptionFields`. Fields
+// which are nil are left unchanged.
+type SubscriptionUpdate struct {
+	// Confirmed is the Unix time the subscription was confirmed, or zero to mark it as unconfirmed.
+	Confirmed *int64
+	// Status is the new status of the subscription.
+	Status *int
+	// LastModified is the Unix time the subscription was last modified. If nil the current time is used.
+	LastModified *int64
+	// state is the `SubscriptionStatus` written with Status, by `SetSubscriptionStatus`. If empty, and Status is
+	// set, the SUBSCRIPTION_STATE_ATTRIBUTE attribute is removed.
+	state SubscriptionStatus
+}
+
+func (u *SubscriptionUpdate) validate() error {
+
+	if u == nil || (u.Confirmed == nil && u.Status == nil && u.LastModified == nil) {
+		return validationError("subscription update", "fields", nil, "there is nothing to update")
+	}
+
+	if u.Confirmed != nil && *u.Confirmed < 0 {
+		return validationError("subscription update", "confirmed", *u.Confirmed, "timestamp is negative")
+	}
+
+	if u.LastModified != nil && *u.LastModified < 0 {
+		return validationError("subscription update", "lastmodified", *u.LastModified, "timestamp is negative")
+	}
+
+	if u.Status != nil {
+
+		switch *u.Status {
+		case subscription.SUBSCRIPTION_STATUS_PENDING, subscription.SUBSCRIPTION_STATUS_ENABLED, subscription.SUBSCRIPTION_STATUS_DISABLED, subscription.SUBSCRIPTION_STATUS_BLOCKED:
+			// pass
+		default:
+			return validationError("subscription update", "status", *u.Status, "unknown status")
+		}
+	}
+
+	return nil
+}
+
+// UpdateSubscriptionFields applies 'update' to the subscription for 'addr' using a single UpdateItem request which
+// only modifies the fields it sets (and the attributes derived from them), unlike `UpdateSubscription` which
+// writes every field of a `subscription.Subscription` and so may overwrite changes made by other tools since it was
+// read. It returns a `database.NoRecordError` if there is no subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) UpdateSubscriptionFields(ctx context.Context, addr string, update *SubscriptionUpdate) error {
+
+	ctx = withOperation(ctx, "UpdateSubscriptionFields")
+	return db.updateSubscriptionFields(ctx, addr, update)
+}
+
+func (db *DynamoDBSubscriptionsDatabase) updateSubscriptionFields(ctx context.Context, addr string, update *SubscriptionUpdate) error {
+
+	err := validateAddress("subscription", addr)
+
+	if err != nil {
+		return err
+	}
+
+	err = update.validate()
+
+	if err != nil {
+		return err
+	}
+
+	last_modified := time.Now().Unix()
+
+	if update.LastModified != nil {
+		last_modified = *update.LastModified
+	}
+
+	fields := map[string]*aws_dynamodb.AttributeValue{
+		"lastmodified": {
+			N: aws.String(strconv.FormatInt(last_modified, 10)),
+		},
+	}
+
+	setModifiedDayAttribute(db.options, fields, addr, last_modified)
+
+	if update.Confirmed != nil {
+
+		fields["confirmed"] = &aws_dynamodb.AttributeValue{
+			N: aws.String(strconv.FormatInt(*update.Confirmed, 10)),
+		}
+	}
+
+	if update.Status != nil {
+
+		fields["status"] = &aws_dynamodb.AttributeValue{
+			N: aws.String(strconv.Itoa(*update.Status)),
+		}
+	}
+
+	key := map[string]*aws_dynamodb.AttributeValue{
+		"address": {
+			S: aws.String(db.options.addressKey(addr)),
+		},
+	}
+
+	conditions := []string{
+		"attribute_exists(#address)",
+	}
+
+	names := map[string]*string{
+		"#address": aws.String("address"),
+	}
+
+	values := make(map[string]*aws_dynamodb.AttributeValue)
+
+	remove := make([]string, 0)
+
+	if update.Status != nil {
+
+		if update.state != "" {
+
+			fields[SUBSCRIPTION_STATE_ATTRIBUTE] = &aws_dynamodb.AttributeValue{
+				S: aws.String(string(update.state)),
+			}
+
+		} else {
+			names["#state"] = aws.String(SUBSCRIPTION_STATE_ATTRIBUTE)
+			remove = append(remove, "#state")
+		}
+	}
+
+	// the expiry time depends on both the status and the time of the last modification so if the status is
+	// not being updated read it and make the update conditional on it not having changed in the meantime
+
+	if db.options.RetentionAttribute != "" {
+
+		var status int
+
+		if update.Status != nil {
+			status = *update.Status
+		} else {
+
+			current, err := db.currentSubscriptionStatus(ctx, key)
+
+			if err != nil {
+				return err
+			}
+
+			status = current
+
+			conditions = append(conditions, "#status = :current_status")
+			names["#status"] = aws.String("status")
+
+			values[":current_status"] = &aws_dynamodb.AttributeValue{
+				N: aws.String(strconv.Itoa(current)),
+			}
+		}
+
+		setRetentionAttribute(fields, db.options.RetentionAttribute, db.options.Retention, status, time.Unix(last_modified, 0))
+
+		_, ok := fields[db.options.RetentionAttribute]
+
+		if !ok {
+			names["#retention"] = aws.String(db.options.RetentionAttribute)
+			remove = append(remove, "#retention")
+		}
+	}
+
+	var to SubscriptionStatus
+
+	enforce := db.options.EnforceTransitions && update.Status != nil
+
+	if enforce {
+
+		to = update.state
+
+		if to == "" {
+
+			to, err = SubscriptionStatusFromLegacy(*update.Status)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		conditions = append(conditions, transitionCondition(db.options.transitions(), to, names, values))
+	}
+
+	err = encryptAttributes(ctx, db.options.Encryptor, db.options.EncryptedAttributes, db.options.addressKey(addr), fields)
+
+	if err != nil {
+		return err
+	}
+
+	attrs := make([]string, 0)
+
+	for k := range fields {
+		attrs = append(attrs, k)
+	}
+
+	sort.Strings(attrs)
+
+	set := make([]string, 0)
+
+	for i, k := range attrs {
+
+		name := fmt.Sprintf("#a%d", i)
+		value := fmt.Sprintf(":v%d", i)
+
+		names[name] = aws.String(k)
+		values[value] = fields[k]
+
+		set = append(set, fmt.Sprintf("%s = %s", name, value))
+	}
+
+	expr := "SET " + strings.Join(set, ", ")
+
+	if len(remove) > 0 {
+		expr = expr + " REMOVE " + strings.Join(remove, ", ")
+	}
+
+	req := &aws_dynamodb.UpdateItemInput{
+		TableName:                 aws.String(db.options.FullTableName()),
+		Key:                       key,
+		UpdateExpression:          aws.String(expr),
+		ConditionExpression:       aws.String(strings.Join(conditions, " AND ")),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+
+	_, err = db.client.UpdateItemWithContext(ctx, req)
+
+	if err == nil {
+		return recordUpdate(ctx, db.options, addr, update)
+	}
+
+	err = wrapError(err)
+
+	if !errors.Is(err, ErrConditionFailed) {
+		return err
+	}
+
+	if enforce {
+		return transitionError(ctx, db.client, db.options, addr, key, to, err)
+	}
+
+	// the condition fails both when there is no subscription and when its status changed since it
+	// was read so check which it was
+
+	_, get_err := db.getSubscriptionWithAddress(ctx, addr)
+
+	if get_err != nil {
+		return get_err
+	}
+
+	return fmt.Errorf("Failed to update subscription for %s, %w", addr, err)
+}
+
+// currentSubscriptionStatus returns the status of the subscription with 'key', using a consistent read.
+func (db *DynamoDBSubscriptionsDatabase) currentSubscriptionStatus(ctx context.Context, key map[string]*aws_dynamodb.AttributeValue) (int, error) {
+
+	req := &aws_dynamodb.GetItemInput{
+		TableName:            aws.String(db.options.FullTableName()),
+		Key:                  key,
+		ConsistentRead:       aws.Bool(true),
+		ProjectionExpression: aws.String("#status"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+	}
+
+	rsp, err := db.client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return 0, wrapError(err)
+	}
+
+	v, ok := rsp.Item["status"]
+
+	if !ok || v.N == nil {
+		return 0, new(database.NoRecordError)
+	}
+
+	return strconv.Atoi(aws.StringValue(v.N))
+}
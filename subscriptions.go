@@ -3,23 +3,139 @@ package dynamodb
 import (
 	"context"
 	"errors"
-	"github.com/aaronland/go-aws-session"
+	"fmt"
 	"github.com/aaronland/go-mailinglist/database"
 	"github.com/aaronland/go-mailinglist/subscription"
 	aws "github.com/aws/aws-sdk-go/aws"
 	aws_session "github.com/aws/aws-sdk-go/aws/session"
 	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
 	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	_ "log"
+	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const SUBSCRIPTIONS_DEFAULT_TABLENAME string = "subscriptions"
 
 type DynamoDBSubscriptionsDatabaseOptions struct {
 	TableName   string
+	TablePrefix string
+	TableSuffix string
 	BillingMode string
 	CreateTable bool
+	// DeletionProtection enables deletion protection when the table is created.
+	DeletionProtection bool
+	// TableClass is the table class (STANDARD or STANDARD_INFREQUENT_ACCESS) used when the table is created.
+	// If empty STANDARD is used.
+	TableClass string
+	// ContributorInsights enables CloudWatch Contributor Insights for the table and its indexes when the table is created.
+	ContributorInsights bool
+	// KinesisStreamArn is the ARN of an optional Kinesis data stream to which changes to the table are streamed,
+	// enabled when the table is created. See the changes package for decoding the resulting records.
+	KinesisStreamArn string
+	// StreamViewType enables a DynamoDB stream, with this view type (for example NEW_AND_OLD_IMAGES), when the table
+	// is created. See `ChangeFeedReader` for reading it. If empty no stream is enabled.
+	StreamViewType string
+	// Retention is an optional policy declaring the maximum age of subscriptions by status. It is enforced using TTL if
+	// RetentionAttribute is set and by `EnforceRetention` (see cmd/enforce-retention) otherwise.
+	Retention RetentionPolicy
+	// RetentionAttribute is the name of the attribute each subscription's expiry time, under Retention, is written to
+	// and for which TTL is enabled when the table is created. See RETENTION_DEFAULT_ATTRIBUTE.
+	RetentionAttribute string
+	// PageSize is the maximum number of items to evaluate in each page of results when listing subscriptions.
+	// Note that for filtered listings, like ListSubscriptionsWithStatus, this limits the number of items read
+	// rather than the number of items returned. If zero DynamoDB's default (1MB of data) is used.
+	PageSize int64
+	// MaxResults is the maximum number of subscriptions a listing will return. If zero there is no limit.
+	MaxResults int
+	// ScanBackoff retries pages of results which are throttled while listing subscriptions, reducing the page size
+	// and backing off with jitter, rather than failing the listing. If nil throttled pages fail the listing.
+	ScanBackoff *ScanBackoffOptions
+	// PrefixSearch adds the SUBSCRIPTIONS_PREFIX_INDEX index, used by `ListSubscriptionsMatching`, when the table
+	// is created and writes the attributes it indexes with each subscription. It may not be used with Pseudonymizer.
+	PrefixSearch bool
+	// Canonicalize adds the SUBSCRIPTIONS_CANONICAL_INDEX index, used by `ListSubscriptionsWithCanonicalAddress`, when
+	// the table is created and writes the canonical form of the address (see `CanonicalAddress`) with each subscription.
+	Canonicalize bool
+	// ModifiedIndex records the UTC day each subscription was last modified in the MODIFIED_DAY_ATTRIBUTE attribute
+	// and includes the SUBSCRIPTIONS_MODIFIED_INDEX index, keyed on that day and the "lastmodified" attribute, when
+	// the table is created. It is required by `ListSubscriptionsModifiedSince`.
+	ModifiedIndex bool
+	// WriteShards is the number of shards the keys of hot, aggregate, items and index partitions (for example the
+	// days of the SUBSCRIPTIONS_MODIFIED_INDEX index) are split across, each read querying every shard. It may be
+	// increased but not reduced once items have been written. If zero SUBSCRIPTIONS_DEFAULT_WRITE_SHARDS is used.
+	WriteShards int
+	// Indexes are additional, user-defined, global secondary indexes to include when the table is created.
+	Indexes []SecondaryIndex
+	// Pseudonymizer is an optional `AddressPseudonymizer` used to replace subscription addresses with pseudonyms
+	// at rest. It must be assigned before any subscriptions are written and never removed.
+	Pseudonymizer *AddressPseudonymizer
+	// Tenant is an optional identifier, for example a customer ID, prefixed onto the "address" key of every
+	// subscription, and stripped when it is read, so that the lists of several tenants can share a table. Listings
+	// only return the tenant's subscriptions but still read, and are billed for, those of every tenant.
+	Tenant string
+	// Encryptor is an optional `Encryptor` used to encrypt the attributes listed in EncryptedAttributes client-side
+	// before they are written. To encrypt addresses assign an encryptor to Pseudonymizer instead.
+	Encryptor Encryptor
+	// EncryptedAttributes are the names of the attributes encrypted by Encryptor. Encrypted attributes can not be
+	// used in key conditions, indexes or filters so the "address" and "status" attributes may not be encrypted.
+	EncryptedAttributes []string
+	// IdempotencyWindow is the length of time during which retrying `AddSubscriptionWithIdempotencyToken` with the
+	// same token succeeds. If zero SUBSCRIPTIONS_DEFAULT_IDEMPOTENCY_WINDOW is used.
+	IdempotencyWindow time.Duration
+	// EnforceTransitions applies status changes using conditional updates which assert that a subscription may
+	// change from its current status to the new one, under Transitions, returning a `TransitionError` otherwise.
+	EnforceTransitions bool
+	// Transitions are the status changes allowed under EnforceTransitions. If nil DefaultSubscriptionTransitions is used.
+	Transitions SubscriptionTransitions
+	// RewriteUpgradedItems writes subscription items read with an older layout (see SCHEMA_VERSION_ATTRIBUTE) back to
+	// the table once they have been upgraded, so that they are only upgraded once. Otherwise items are upgraded
+	// every time they are read until they are next written.
+	RewriteUpgradedItems bool
+	// UnsubscribeTokens is an optional unsubscribe tokens database whose tokens for an address are invalidated
+	// when the subscription for that address is removed.
+	UnsubscribeTokens *DynamoDBUnsubscribeTokensDatabase
+	// Confirmations is an optional confirmations database whose outstanding confirmations for an address are removed
+	// when the subscription for that address is removed, so that they can not confirm it once it is added again.
+	Confirmations *DynamoDBConfirmationsDatabase
+	// History is an optional history database to which an entry is appended for every change to a subscription.
+	// See `DynamoDBHistoryDatabase.GetSubscriptionHistory`.
+	History *DynamoDBHistoryDatabase
+	// Publisher is an optional `ChangePublisher`, for example an `EventBridgePublisher`, invoked for every change
+	// to a subscription after it has been written.
+	Publisher ChangePublisher
+	// ReturnConsumedCapacity is the level of consumed capacity detail (TOTAL or INDEXES) to request when
+	// ConsumedCapacityFunc is set. If empty TOTAL is used.
+	ReturnConsumedCapacity string
+	// ConsumedCapacityFunc is an optional callback invoked with the capacity consumed by each request.
+	ConsumedCapacityFunc ConsumedCapacityFunc
+	// CapacityLimiter is an optional `CapacityLimiter` which caps the read and write capacity consumed per second.
+	CapacityLimiter *CapacityLimiter
+	// Middleware is an optional chain of `Middleware` invoked around each request to DynamoDB, the first of which is outermost.
+	Middleware []Middleware
+	// ReadOnly rejects every request which would write to the table with ErrReadOnly, before it is sent. It may not
+	// be used with CreateTable.
+	ReadOnly bool
+	// HTTPClient is an optional HTTP client used by the session and DSN constructors in place of the session's
+	// default client. See `NewHTTPClient`.
+	HTTPClient *http.Client
+	// Region is the AWS region of the table, used in place of the session's region by the session and DSN constructors.
+	// If empty the region of the table's ARN, if TableName is an ARN, and otherwise the session's region is used.
+	Region string
+	// Endpoint is the URL of the DynamoDB endpoint, for example "http://localhost:8000" for DynamoDB Local, used in place
+	// of the session's endpoint by the session and DSN constructors. It takes precedence over UseFIPSEndpoint and
+	// UseDualStackEndpoint. If empty the session's endpoint is used.
+	Endpoint string
+	// UseFIPSEndpoint selects the FIPS 140-2 validated DynamoDB endpoint for the session's region.
+	UseFIPSEndpoint bool
+	// UseDualStackEndpoint selects the dual-stack (IPv4 and IPv6) DynamoDB endpoint for the session's region.
+	UseDualStackEndpoint bool
+	// Retry is an optional `RetryOptions` used to retry failed requests in place of the AWS SDK's default retryer.
+	Retry *RetryOptions
 }
 
 func DefaultDynamoDBSubscriptionsDatabaseOptions() *DynamoDBSubscriptionsDatabaseOptions {
@@ -28,31 +144,96 @@ func DefaultDynamoDBSubscriptionsDatabaseOptions() *DynamoDBSubscriptionsDatabas
 		TableName:   SUBSCRIPTIONS_DEFAULT_TABLENAME,
 		BillingMode: "PAY_PER_REQUEST",
 		CreateTable: false,
+		ScanBackoff: DefaultScanBackoffOptions(),
 	}
 
 	return &opts
 }
 
+// FullTableName returns the name of the table with the TablePrefix and TableSuffix options applied.
+func (opts *DynamoDBSubscriptionsDatabaseOptions) FullTableName() string {
+	return fullTableName(opts.TablePrefix, opts.TableName, opts.TableSuffix)
+}
+
 type DynamoDBSubscriptionsDatabase struct {
 	database.SubscriptionsDatabase
-	client  *aws_dynamodb.DynamoDB
+	client  aws_dynamodbiface.DynamoDBAPI
 	options *DynamoDBSubscriptionsDatabaseOptions
 }
 
+// NewDynamoDBSubscriptionsDatabaseWithDSN returns a new `database.SubscriptionsDatabase` for 'dsn'. See
+// `NewSubscriptionsDatabaseWithDSN` for a constructor which returns the concrete `DynamoDBSubscriptionsDatabase`.
 func NewDynamoDBSubscriptionsDatabaseWithDSN(dsn string, opts *DynamoDBSubscriptionsDatabaseOptions) (database.SubscriptionsDatabase, error) {
 
-	sess, err := session.NewSessionWithDSN(dsn)
+	db, err := NewSubscriptionsDatabaseWithDSN(dsn, opts)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return NewDynamoDBSubscriptionsDatabaseWithSession(sess, opts)
+	return db, nil
 }
 
+// NewDynamoDBSubscriptionsDatabaseWithSession returns a new `database.SubscriptionsDatabase` for 'sess'. See
+// `NewSubscriptionsDatabaseWithSession` for a constructor which returns the concrete `DynamoDBSubscriptionsDatabase`.
 func NewDynamoDBSubscriptionsDatabaseWithSession(sess *aws_session.Session, opts *DynamoDBSubscriptionsDatabaseOptions) (database.SubscriptionsDatabase, error) {
 
-	client := aws_dynamodb.New(sess)
+	db, err := NewSubscriptionsDatabaseWithSession(sess, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewDynamoDBSubscriptionsDatabaseWithClient returns a new `database.SubscriptionsDatabase` that uses 'client' to talk to
+// DynamoDB. See `NewSubscriptionsDatabaseWithClient` for a constructor which returns the concrete `DynamoDBSubscriptionsDatabase`.
+func NewDynamoDBSubscriptionsDatabaseWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSubscriptionsDatabaseOptions) (database.SubscriptionsDatabase, error) {
+
+	db, err := NewSubscriptionsDatabaseWithClient(client, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewSubscriptionsDatabaseWithDSN returns a new `DynamoDBSubscriptionsDatabase` instance for 'dsn'. Table names and
+// endpoint settings assigned in 'dsn' are assigned to 'opts'.
+func NewSubscriptionsDatabaseWithDSN(dsn string, opts *DynamoDBSubscriptionsDatabaseOptions) (*DynamoDBSubscriptionsDatabase, error) {
+
+	sess, err := newSessionWithDSNSettings(dsn, DSN_SUBSCRIPTIONS_TABLE_KEY, opts.settings())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSubscriptionsDatabaseWithSession(sess, opts)
+}
+
+// NewSubscriptionsDatabaseWithSession returns a new `DynamoDBSubscriptionsDatabase` instance for 'sess'.
+func NewSubscriptionsDatabaseWithSession(sess *aws_session.Session, opts *DynamoDBSubscriptionsDatabaseOptions) (*DynamoDBSubscriptionsDatabase, error) {
+
+	client := opts.settings().newClient(sess)
+
+	return NewSubscriptionsDatabaseWithClient(client, opts)
+}
+
+// NewSubscriptionsDatabaseWithClient returns a new `DynamoDBSubscriptionsDatabase` instance that uses 'client'
+// to talk to DynamoDB, for example a mock or an instrumented client. `ConsumedCapacityFunc`, `CapacityLimiter`, `Retry`,
+// `Region` and `Endpoint` are only wired up by the session and DSN constructors since they rely on the concrete
+// client's request handlers and configuration.
+func NewSubscriptionsDatabaseWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSubscriptionsDatabaseOptions) (*DynamoDBSubscriptionsDatabase, error) {
+
+	err := opts.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	client = withMiddleware(client, opts.settings().middleware())
 
 	if opts.CreateTable {
 		_, err := CreateSubscriptionsTable(client, opts)
@@ -71,63 +252,392 @@ func NewDynamoDBSubscriptionsDatabaseWithSession(sess *aws_session.Session, opts
 }
 
 func (db *DynamoDBSubscriptionsDatabase) GetSubscriptionWithAddress(addr string) (*subscription.Subscription, error) {
+	return db.GetSubscriptionWithAddressWithContext(context.Background(), addr)
+}
+
+// GetSubscriptionWithAddressWithContext is the context-first equivalent of `GetSubscriptionWithAddress`.
+func (db *DynamoDBSubscriptionsDatabase) GetSubscriptionWithAddressWithContext(ctx context.Context, addr string) (*subscription.Subscription, error) {
+
+	ctx = withOperation(ctx, "GetSubscriptionWithAddress")
+	return db.getSubscriptionWithAddress(ctx, addr)
+}
+
+func (db *DynamoDBSubscriptionsDatabase) getSubscriptionWithAddress(ctx context.Context, addr string) (*subscription.Subscription, error) {
 
 	req := &aws_dynamodb.GetItemInput{
-		TableName: aws.String(db.options.TableName),
+		TableName: aws.String(db.options.FullTableName()),
 		Key: map[string]*aws_dynamodb.AttributeValue{
 			"address": {
-				S: aws.String(addr),
+				S: aws.String(db.options.addressKey(addr)),
 			},
 		},
 	}
 
-	rsp, err := db.client.GetItem(req)
+	rsp, err := db.client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	err = upgradeSubscriptionItem(ctx, db.client, db.options, rsp.Item, true)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return itemToSubscription(rsp.Item)
+	err = restoreSubscriptionItem(ctx, db.options, rsp.Item)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := itemToSubscription(rsp.Item)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// without an encryption key the cleartext address is not stored but it is known here
+
+	sub.Address = addr
+	return sub, nil
+}
+
+// GetSubscriptionsWithAddresses returns the subscriptions for 'addrs', in the order they were requested,
+// using BatchGetItem requests of up to BATCH_GET_MAX_KEYS keys each. Duplicate addresses are only
+// requested once and addresses without a subscription are omitted from the results.
+func (db *DynamoDBSubscriptionsDatabase) GetSubscriptionsWithAddresses(ctx context.Context, addrs []string) ([]*subscription.Subscription, error) {
+
+	ctx = withOperation(ctx, "GetSubscriptionsWithAddresses")
+
+	seen := make(map[string]bool)
+	unique := make([]string, 0)
+
+	for _, addr := range addrs {
+
+		if seen[addr] {
+			continue
+		}
+
+		seen[addr] = true
+		unique = append(unique, addr)
+	}
+
+	lookup := make(map[string]*subscription.Subscription)
+
+	for start := 0; start < len(unique); start += BATCH_GET_MAX_KEYS {
+
+		end := start + BATCH_GET_MAX_KEYS
+
+		if end > len(unique) {
+			end = len(unique)
+		}
+
+		keys := make([]map[string]*aws_dynamodb.AttributeValue, 0)
+
+		for _, addr := range unique[start:end] {
+
+			k := map[string]*aws_dynamodb.AttributeValue{
+				"address": {
+					S: aws.String(db.options.addressKey(addr)),
+				},
+			}
+
+			keys = append(keys, k)
+		}
+
+		items, err := batchGetItems(ctx, db.client, db.options.FullTableName(), keys)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+
+			key := aws.StringValue(item["address"].S)
+
+			err := upgradeSubscriptionItem(ctx, db.client, db.options, item, true)
+
+			if err != nil {
+				return nil, err
+			}
+
+			err = restoreSubscriptionItem(ctx, db.options, item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			sub, err := itemToSubscription(item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			lookup[key] = sub
+		}
+	}
+
+	subs := make([]*subscription.Subscription, 0)
+
+	for _, addr := range unique {
+
+		sub, ok := lookup[db.options.addressKey(addr)]
+
+		if !ok {
+			continue
+		}
+
+		sub.Address = addr
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
 }
 
 func (db *DynamoDBSubscriptionsDatabase) AddSubscription(sub *subscription.Subscription) error {
+	return db.AddSubscriptionWithContext(context.Background(), sub)
+}
+
+// AddSubscriptionWithContext is the context-first equivalent of `AddSubscription`.
+func (db *DynamoDBSubscriptionsDatabase) AddSubscriptionWithContext(ctx context.Context, sub *subscription.Subscription) error {
+
+	ctx = withOperation(ctx, "AddSubscription")
+	return db.addSubscription(ctx, sub)
+}
+
+func (db *DynamoDBSubscriptionsDatabase) addSubscription(ctx context.Context, sub *subscription.Subscription) error {
+
+	// validate before looking up the existing subscription so that an empty address is reported as
+	// a ValidationError rather than a failed read
+
+	err := validateSubscription(sub)
+
+	if err != nil {
+		return err
+	}
 
-	existing_sub, err := db.GetSubscriptionWithAddress(sub.Address)
+	existing_sub, err := db.getSubscriptionWithAddress(ctx, sub.Address)
 
-	if err != nil && !database.IsNotExist(err) {
+	if err != nil && !IsNotExist(err) {
 		return err
 	}
 
 	if existing_sub != nil {
-		return errors.New("Subscription already exists")
+		return fmt.Errorf("Failed to add subscription for %s, %w", sub.Address, ErrAlreadyExists)
+	}
+
+	err = putSubscription(ctx, db.client, db.options, sub)
+
+	if err != nil {
+		return err
 	}
 
-	return putSubscription(db.client, db.options, sub)
+	return recordChange(ctx, db.options, HISTORY_CHANGE_ADDED, sub)
 }
 
 func (db *DynamoDBSubscriptionsDatabase) RemoveSubscription(sub *subscription.Subscription) error {
+	return db.RemoveSubscriptionWithContext(context.Background(), sub)
+}
+
+// RemoveSubscriptionWithContext is the context-first equivalent of `RemoveSubscription`.
+func (db *DynamoDBSubscriptionsDatabase) RemoveSubscriptionWithContext(ctx context.Context, sub *subscription.Subscription) error {
+
+	ctx = withOperation(ctx, "RemoveSubscription")
+	return db.removeSubscription(ctx, sub)
+}
+
+func (db *DynamoDBSubscriptionsDatabase) removeSubscription(ctx context.Context, sub *subscription.Subscription) error {
+
+	removed, err := db.deleteSubscription(ctx, sub.Address)
+
+	if err != nil {
+		return err
+	}
+
+	err = db.removeRelated(ctx, sub.Address)
+
+	if err != nil {
+		return err
+	}
+
+	if removed != nil {
+		sub = removed
+	}
+
+	return recordChange(ctx, db.options, HISTORY_CHANGE_REMOVED, sub)
+}
+
+// RemoveSubscriptionWithAddress removes the subscription for 'addr', and its related records like
+// `RemoveSubscription`, returning the subscription as it was when it was removed so that callers can log or archive
+// it. It returns a `database.NoRecordError` if there was no subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) RemoveSubscriptionWithAddress(ctx context.Context, addr string) (*subscription.Subscription, error) {
+
+	ctx = withOperation(ctx, "RemoveSubscriptionWithAddress")
+
+	removed, err := db.deleteSubscription(ctx, addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// tokens and confirmations may outlive, or predate, a subscription so they are removed either way
+
+	err = db.removeRelated(ctx, addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if removed == nil {
+		return nil, new(database.NoRecordError)
+	}
+
+	err = recordChange(ctx, db.options, HISTORY_CHANGE_REMOVED, removed)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return removed, nil
+}
+
+// deleteSubscription deletes the subscription for 'addr' using a DeleteItem request which returns the deleted
+// item. It returns the subscription as it was before it was deleted, or nil if there was no subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) deleteSubscription(ctx context.Context, addr string) (*subscription.Subscription, error) {
 
 	req := &aws_dynamodb.DeleteItemInput{
-		TableName: aws.String(db.options.TableName),
+		TableName: aws.String(db.options.FullTableName()),
 		Key: map[string]*aws_dynamodb.AttributeValue{
 			"address": {
-				S: aws.String(sub.Address),
+				S: aws.String(db.options.addressKey(addr)),
 			},
 		},
+		ReturnValues: aws.String(aws_dynamodb.ReturnValueAllOld),
 	}
 
-	_, err := db.client.DeleteItem(req)
+	rsp, err := db.client.DeleteItemWithContext(ctx, req)
 
 	if err != nil {
-		return err
+		return nil, wrapError(err)
+	}
+
+	if len(rsp.Attributes) == 0 {
+		return nil, nil
+	}
+
+	// the item no longer exists so it is upgraded, but never rewritten
+
+	err = upgradeSubscriptionItem(ctx, db.client, db.options, rsp.Attributes, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = restoreSubscriptionItem(ctx, db.options, rsp.Attributes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := itemToSubscription(rsp.Attributes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// without an encryption key the cleartext address is not stored but it is known here
+
+	sub.Address = addr
+	return sub, nil
+}
+
+// removeRelated removes the unsubscribe tokens and confirmations for 'addr', if the UnsubscribeTokens and
+// Confirmations options are set, once its subscription has been removed.
+func (db *DynamoDBSubscriptionsDatabase) removeRelated(ctx context.Context, addr string) error {
+
+	if db.options.UnsubscribeTokens != nil {
+
+		err := db.options.UnsubscribeTokens.RemoveUnsubscribeTokensForAddress(ctx, addr)
+
+		if err != nil {
+			return fmt.Errorf("Failed to invalidate unsubscribe tokens for %s, %w", addr, err)
+		}
+	}
+
+	if db.options.Confirmations != nil {
+
+		err := db.options.Confirmations.RemoveConfirmationsForAddress(ctx, addr)
+
+		if err != nil {
+			return fmt.Errorf("Failed to remove confirmations for %s, %w", addr, err)
+		}
 	}
 
 	return nil
 }
 
+// RemoveUnconfirmedSubscriptions removes every subscription created before 'before' which has never been confirmed,
+// returning the number of subscriptions removed. Blocked subscriptions are left in place so that their addresses stay
+// blocked. Their confirmations are removed too if the Confirmations option is set. If 'dry_run' is true subscriptions
+// are counted but not removed.
+func (db *DynamoDBSubscriptionsDatabase) RemoveUnconfirmedSubscriptions(ctx context.Context, before time.Time, dry_run bool) (int, error) {
+
+	ctx = withOperation(ctx, "RemoveUnconfirmedSubscriptions")
+
+	stale := make([]*subscription.Subscription, 0)
+
+	cb := func(sub *subscription.Subscription) error {
+
+		if !sub.IsConfirmed() && !sub.IsBlocked() && sub.Created < before.Unix() {
+			stale = append(stale, sub)
+		}
+
+		return nil
+	}
+
+	req := &aws_dynamodb.ScanInput{
+		TableName: aws.String(db.options.FullTableName()),
+	}
+
+	err := scanSubscriptions(ctx, db.client, db.options, req, cb)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if dry_run {
+		return len(stale), nil
+	}
+
+	for i, sub := range stale {
+
+		err := db.removeSubscription(ctx, sub)
+
+		if err != nil {
+			return i, fmt.Errorf("Failed to remove %s, %w", sub.Address, err)
+		}
+	}
+
+	return len(stale), nil
+}
+
 func (db *DynamoDBSubscriptionsDatabase) UpdateSubscription(sub *subscription.Subscription) error {
+	return db.UpdateSubscriptionWithContext(context.Background(), sub)
+}
+
+// UpdateSubscriptionWithContext is the context-first equivalent of `UpdateSubscription`.
+func (db *DynamoDBSubscriptionsDatabase) UpdateSubscriptionWithContext(ctx context.Context, sub *subscription.Subscription) error {
+
+	ctx = withOperation(ctx, "UpdateSubscription")
+
+	err := updateSubscription(ctx, db.client, db.options, sub, nil)
+
+	if err != nil {
+		return err
+	}
 
-	return putSubscription(db.client, db.options, sub)
+	return recordChange(ctx, db.options, HISTORY_CHANGE_UPDATED, sub)
 }
 
 // https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/DynamoDBMapper.QueryScanExample.html
@@ -137,6 +647,8 @@ func (db *DynamoDBSubscriptionsDatabase) UpdateSubscription(sub *subscription.Su
 
 func (db *DynamoDBSubscriptionsDatabase) ListSubscriptions(ctx context.Context, callback database.ListSubscriptionsFunc) error {
 
+	ctx = withOperation(ctx, "ListSubscriptions")
+
 	/*
 		req := &aws_dynamodb.QueryInput{
 			ProjectionExpression: aws.String("#confirmed, address"),
@@ -149,27 +661,54 @@ func (db *DynamoDBSubscriptionsDatabase) ListSubscriptions(ctx context.Context,
 					N: aws.String("0"),
 				},
 			},
-			TableName: aws.String(db.options.TableName),
+			TableName: aws.String(db.options.FullTableName()),
 		}
 
 		return querySubscriptions(ctx, db.client, req, callback)
 	*/
 
 	req := &aws_dynamodb.ScanInput{
-		TableName: aws.String(db.options.TableName),
+		TableName: aws.String(db.options.FullTableName()),
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
 	}
 
-	return scanSubscriptions(ctx, db.client, req, callback)
+	callback = limitSubscriptionsCallback(db.options.MaxResults, callback)
+
+	err := scanSubscriptions(ctx, db.client, db.options, req, callback)
+	return stopListingError(err)
 }
 
 func (db *DynamoDBSubscriptionsDatabase) ListSubscriptionsWithStatus(ctx context.Context, callback database.ListSubscriptionsFunc, status ...int) error {
 
+	ctx = withOperation(ctx, "ListSubscriptionsWithStatus")
+
+	req, err := subscriptionsWithStatusScanInput(db.options.FullTableName(), status...)
+
+	if err != nil {
+		return err
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
+	}
+
+	callback = limitSubscriptionsCallback(db.options.MaxResults, callback)
+
+	err = scanSubscriptions(ctx, db.client, db.options, req, callback)
+	return stopListingError(err)
+}
+
+func subscriptionsWithStatusScanInput(table string, status ...int) (*aws_dynamodb.ScanInput, error) {
+
 	if len(status) == 0 {
-		return errors.New("Missing status(es)")
+		return nil, errors.New("Missing status(es)")
 	}
 
 	if len(status) > 1 {
-		return errors.New("Multiple status(es) are not supported yet.")
+		return nil, errors.New("Multiple status(es) are not supported yet.")
 	}
 
 	// only supporting one status is not a feature - it just hasn't been implemented yet...
@@ -189,16 +728,16 @@ func (db *DynamoDBSubscriptionsDatabase) ListSubscriptionsWithStatus(ctx context
 			},
 		},
 		FilterExpression:     aws.String("#status = :state"),
-		ProjectionExpression: aws.String("#status, address"),
-		TableName:            aws.String(db.options.TableName),
+		ProjectionExpression: aws.String("#status, address, " + ENCRYPTED_ADDRESS_ATTRIBUTE),
+		TableName:            aws.String(table),
 	}
 
-	return scanSubscriptions(ctx, db.client, req, callback)
+	return req, nil
 }
 
-func putSubscription(client *aws_dynamodb.DynamoDB, opts *DynamoDBSubscriptionsDatabaseOptions, sub *subscription.Subscription) error {
+func putSubscription(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSubscriptionsDatabaseOptions, sub *subscription.Subscription) error {
 
-	item, err := aws_dynamodbattribute.MarshalMap(sub)
+	item, err := subscriptionToItem(ctx, opts, sub)
 
 	if err != nil {
 		return err
@@ -206,18 +745,314 @@ func putSubscription(client *aws_dynamodb.DynamoDB, opts *DynamoDBSubscriptionsD
 
 	req := &aws_dynamodb.PutItemInput{
 		Item:      item,
-		TableName: aws.String(opts.TableName),
+		TableName: aws.String(opts.FullTableName()),
+	}
+
+	_, err = client.PutItemWithContext(ctx, req)
+
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return nil
+}
+
+// updateSubscription writes 'sub' using an UpdateItem request, rather than replacing the entire item, so that
+// attributes which are not part of `subscription.Subscription`, like activity times, are preserved. Attributes
+// derived from the subscription which no longer apply, like an expiry time, are removed. If 'expected' is not nil
+// the update is conditional on the subscription's current lastmodified time being equal to it.
+func updateSubscription(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSubscriptionsDatabaseOptions, sub *subscription.Subscription, expected *int64) error {
+
+	item, err := subscriptionToItem(ctx, opts, sub)
+
+	if err != nil {
+		return err
+	}
+
+	key := map[string]*aws_dynamodb.AttributeValue{
+		"address": item["address"],
+	}
+
+	names := make(map[string]*string)
+	values := make(map[string]*aws_dynamodb.AttributeValue)
+
+	set := make([]string, 0)
+	remove := make([]string, 0)
+
+	attrs := make([]string, 0)
+
+	for k := range item {
+
+		if k != "address" {
+			attrs = append(attrs, k)
+		}
+	}
+
+	sort.Strings(attrs)
+
+	for i, k := range attrs {
+
+		name := fmt.Sprintf("#a%d", i)
+		value := fmt.Sprintf(":v%d", i)
+
+		names[name] = aws.String(k)
+		values[value] = item[k]
+
+		set = append(set, fmt.Sprintf("%s = %s", name, value))
+	}
+
+	for i, k := range derivedSubscriptionAttributes(opts) {
+
+		_, ok := item[k]
+
+		if ok {
+			continue
+		}
+
+		name := fmt.Sprintf("#r%d", i)
+		names[name] = aws.String(k)
+
+		remove = append(remove, name)
+	}
+
+	// the state attribute only distinguishes between kinds of disabled subscription (see `SubscriptionStatus`)
+	// so it is preserved while a subscription remains disabled and removed otherwise
+
+	if sub.Status != subscription.SUBSCRIPTION_STATUS_DISABLED {
+		names["#state"] = aws.String(SUBSCRIPTION_STATE_ATTRIBUTE)
+		remove = append(remove, "#state")
+	}
+
+	expr := "SET " + strings.Join(set, ", ")
+
+	if len(remove) > 0 {
+		expr = expr + " REMOVE " + strings.Join(remove, ", ")
+	}
+
+	req := &aws_dynamodb.UpdateItemInput{
+		TableName:                 aws.String(opts.FullTableName()),
+		Key:                       key,
+		UpdateExpression:          aws.String(expr),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+
+	var to SubscriptionStatus
+
+	if opts.EnforceTransitions {
+
+		to, err = SubscriptionStatusFromLegacy(sub.Status)
+
+		if err != nil {
+			return err
+		}
+
+		condition := transitionCondition(opts.transitions(), to, names, values)
+
+		// a bounced subscription remains bounced when it is updated as disabled (see above)
+
+		if sub.Status == subscription.SUBSCRIPTION_STATUS_DISABLED {
+
+			values[":disabled"] = &aws_dynamodb.AttributeValue{
+				N: aws.String(strconv.Itoa(sub.Status)),
+			}
+
+			names["#state"] = aws.String(SUBSCRIPTION_STATE_ATTRIBUTE)
+
+			values[":bounced"] = &aws_dynamodb.AttributeValue{
+				S: aws.String(string(STATUS_BOUNCED)),
+			}
+
+			condition = condition + " OR (#status = :disabled AND #state = :bounced)"
+		}
+
+		req.ConditionExpression = aws.String(condition)
+	}
+
+	if expected != nil {
+
+		names["#lastmodified"] = aws.String("lastmodified")
+
+		values[":expected_lastmodified"] = &aws_dynamodb.AttributeValue{
+			N: aws.String(strconv.FormatInt(*expected, 10)),
+		}
+
+		condition := "#lastmodified = :expected_lastmodified"
+
+		if req.ConditionExpression != nil {
+			condition = fmt.Sprintf("(%s) AND %s", *req.ConditionExpression, condition)
+		}
+
+		req.ConditionExpression = aws.String(condition)
+	}
+
+	_, err = client.UpdateItemWithContext(ctx, req)
+
+	if err != nil {
+
+		err = wrapError(err)
+
+		if !errors.Is(err, ErrConditionFailed) {
+			return err
+		}
+
+		// the lastmodified condition is checked first since a conflicting change may also have changed the status
+
+		if expected != nil {
+
+			conflict_err := conflictError(ctx, client, opts, sub.Address, key, *expected)
+
+			if conflict_err != nil {
+				return conflict_err
+			}
+		}
+
+		if opts.EnforceTransitions {
+			return transitionError(ctx, client, opts, sub.Address, key, to, err)
+		}
+
+		return fmt.Errorf("Failed to update subscription for %s, %w", sub.Address, err)
+	}
+
+	return nil
+}
+
+// subscriptionToItem returns the DynamoDB item for 'sub', including the attributes derived from it by 'opts'.
+func subscriptionToItem(ctx context.Context, opts *DynamoDBSubscriptionsDatabaseOptions, sub *subscription.Subscription) (map[string]*aws_dynamodb.AttributeValue, error) {
+
+	err := validateSubscription(sub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := aws_dynamodbattribute.MarshalMap(sub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	setSchemaVersion(item, SUBSCRIPTION_SCHEMA_VERSION)
+	setRetentionAttribute(item, opts.RetentionAttribute, opts.Retention, sub.Status, subscriptionRetentionTime(sub))
+
+	// the search attributes expose the cleartext address so they are never written alongside pseudonyms
+
+	if opts.PrefixSearch && opts.Pseudonymizer == nil {
+		setSearchAttributes(item, sub.Address)
+	}
+
+	setModifiedDayAttribute(opts, item, sub.Address, sub.LastModified)
+
+	if opts.Canonicalize {
+
+		item[CANONICAL_ADDRESS_ATTRIBUTE] = &aws_dynamodb.AttributeValue{
+			S: aws.String(opts.canonicalAttribute(sub.Address)),
+		}
+	}
+
+	err = encryptAttributes(ctx, opts.Encryptor, opts.EncryptedAttributes, opts.addressKey(sub.Address), item)
+
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = client.PutItem(req)
+	err = opts.Pseudonymizer.pseudonymize(ctx, item)
+
+	if err != nil {
+		return nil, err
+	}
+
+	item["address"] = &aws_dynamodb.AttributeValue{
+		S: aws.String(tenantKey(opts.Tenant, aws.StringValue(item["address"].S))),
+	}
+
+	return item, nil
+}
+
+// restoreSubscriptionItem decrypts the encrypted attributes of 'item', and restores its cleartext address, as
+// written by `subscriptionToItem`. It returns an error if 'item' does not belong to the Tenant option of 'opts'.
+func restoreSubscriptionItem(ctx context.Context, opts *DynamoDBSubscriptionsDatabaseOptions, item map[string]*aws_dynamodb.AttributeValue) error {
+
+	if item == nil {
+		return nil
+	}
+
+	v, ok := item["address"]
+
+	if ok && v.S != nil {
+
+		err := decryptAttributes(ctx, opts.Encryptor, opts.EncryptedAttributes, *v.S, item)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// the encrypted address is bound to the pseudonym, without the tenant, so the tenant is stripped first
+
+	err := stripTenant(opts.Tenant, item)
 
 	if err != nil {
 		return err
 	}
 
+	return opts.Pseudonymizer.restore(ctx, item)
+}
+
+// validateEncryptedAttributes returns an error if any of the attributes in the EncryptedAttributes option of
+// 'opts' can not be encrypted.
+func validateEncryptedAttributes(opts *DynamoDBSubscriptionsDatabaseOptions) error {
+
+	for _, name := range opts.EncryptedAttributes {
+
+		switch name {
+		case "address", "status", SCHEMA_VERSION_ATTRIBUTE, SEARCH_INITIAL_ATTRIBUTE, SEARCH_ADDRESS_ATTRIBUTE, CANONICAL_ADDRESS_ATTRIBUTE, ENCRYPTED_ADDRESS_ATTRIBUTE, COUNTER_BOUNCE, COUNTER_COMPLAINT, TAGS_ATTRIBUTE, METADATA_ATTRIBUTE, SUBSCRIPTION_STATE_ATTRIBUTE, MODIFIED_DAY_ATTRIBUTE, opts.RetentionAttribute:
+			return optionsError("subscriptions", "EncryptedAttributes", name, "attribute can not be encrypted")
+		}
+
+		if opts.ModifiedIndex && name == "lastmodified" {
+			return optionsError("subscriptions", "EncryptedAttributes", name, fmt.Sprintf("attribute is a key of the %s index", SUBSCRIPTIONS_MODIFIED_INDEX))
+		}
+
+		for _, idx := range opts.Indexes {
+
+			if name == idx.PartitionKey || name == idx.SortKey {
+				return optionsError("subscriptions", "EncryptedAttributes", name, fmt.Sprintf("attribute is a key of the %s index", idx.Name))
+			}
+		}
+	}
+
 	return nil
 }
 
+// derivedSubscriptionAttributes returns the names of the attributes 'opts' may derive from a subscription.
+func derivedSubscriptionAttributes(opts *DynamoDBSubscriptionsDatabaseOptions) []string {
+
+	attrs := make([]string, 0)
+
+	if opts.RetentionAttribute != "" {
+		attrs = append(attrs, opts.RetentionAttribute)
+	}
+
+	if opts.PrefixSearch {
+		attrs = append(attrs, SEARCH_INITIAL_ATTRIBUTE, SEARCH_ADDRESS_ATTRIBUTE)
+	}
+
+	if opts.Canonicalize {
+		attrs = append(attrs, CANONICAL_ADDRESS_ATTRIBUTE)
+	}
+
+	if opts.ModifiedIndex {
+		attrs = append(attrs, MODIFIED_DAY_ATTRIBUTE)
+	}
+
+	if opts.Pseudonymizer != nil {
+		attrs = append(attrs, ENCRYPTED_ADDRESS_ATTRIBUTE)
+	}
+
+	return attrs
+}
+
 func itemToSubscription(item map[string]*aws_dynamodb.AttributeValue) (*subscription.Subscription, error) {
 
 	var sub *subscription.Subscription
@@ -235,18 +1070,55 @@ func itemToSubscription(item map[string]*aws_dynamodb.AttributeValue) (*subscrip
 	return sub, nil
 }
 
-func querySubscriptions(ctx context.Context, client *aws_dynamodb.DynamoDB, req *aws_dynamodb.QueryInput, callback database.ListSubscriptionsFunc) error {
+func querySubscriptions(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSubscriptionsDatabaseOptions, req *aws_dynamodb.QueryInput, callback database.ListSubscriptionsFunc) error {
+
+	withTenantFilter(opts.Tenant, &req.FilterExpression, &req.ExpressionAttributeNames, &req.ExpressionAttributeValues)
+
+	backoff := newPageBackoff(opts.ScanBackoff, req.Limit)
 
 	for {
 
-		rsp, err := client.Query(req)
+		err := ctx.Err()
 
 		if err != nil {
 			return err
 		}
 
+		rsp, err := client.QueryWithContext(ctx, req)
+
+		if err != nil {
+
+			err = backoff.retry(ctx, err, &req.Limit)
+
+			if err != nil {
+				return wrapError(err)
+			}
+
+			continue
+		}
+
+		backoff.succeeded(aws.Int64Value(rsp.ScannedCount), &req.Limit)
+
 		for _, item := range rsp.Items {
 
+			err := ctx.Err()
+
+			if err != nil {
+				return err
+			}
+
+			err = upgradeSubscriptionItem(ctx, client, opts, item, req.ProjectionExpression == nil)
+
+			if err != nil {
+				return err
+			}
+
+			err = restoreSubscriptionItem(ctx, opts, item)
+
+			if err != nil {
+				return err
+			}
+
 			sub, err := itemToSubscription(item)
 
 			if err != nil {
@@ -270,18 +1142,55 @@ func querySubscriptions(ctx context.Context, client *aws_dynamodb.DynamoDB, req
 	return nil
 }
 
-func scanSubscriptions(ctx context.Context, client *aws_dynamodb.DynamoDB, req *aws_dynamodb.ScanInput, callback database.ListSubscriptionsFunc) error {
+func scanSubscriptions(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSubscriptionsDatabaseOptions, req *aws_dynamodb.ScanInput, callback database.ListSubscriptionsFunc) error {
+
+	withTenantFilter(opts.Tenant, &req.FilterExpression, &req.ExpressionAttributeNames, &req.ExpressionAttributeValues)
+
+	backoff := newPageBackoff(opts.ScanBackoff, req.Limit)
 
 	for {
 
-		rsp, err := client.Scan(req)
+		err := ctx.Err()
 
 		if err != nil {
 			return err
 		}
 
+		rsp, err := client.ScanWithContext(ctx, req)
+
+		if err != nil {
+
+			err = backoff.retry(ctx, err, &req.Limit)
+
+			if err != nil {
+				return wrapError(err)
+			}
+
+			continue
+		}
+
+		backoff.succeeded(aws.Int64Value(rsp.ScannedCount), &req.Limit)
+
 		for _, item := range rsp.Items {
 
+			err := ctx.Err()
+
+			if err != nil {
+				return err
+			}
+
+			err = upgradeSubscriptionItem(ctx, client, opts, item, req.ProjectionExpression == nil)
+
+			if err != nil {
+				return err
+			}
+
+			err = restoreSubscriptionItem(ctx, opts, item)
+
+			if err != nil {
+				return err
+			}
+
 			sub, err := itemToSubscription(item)
 
 			if err != nil {
@@ -0,0 +1,89 @@
+package dynamodb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tableArn is the parsed form of a DynamoDB table ARN, for example
+// "arn:aws:dynamodb:us-east-1:123456789012:table/subscriptions".
+type tableArn struct {
+	Partition string
+	Region    string
+	Account   string
+	Table     string
+}
+
+// isTableArn reports whether 'name' is an ARN, rather than a table name.
+func isTableArn(name string) bool {
+	return strings.HasPrefix(name, "arn:")
+}
+
+// parseTableArn parses 'name' as a DynamoDB table ARN.
+func parseTableArn(name string) (*tableArn, error) {
+
+	parts := strings.SplitN(name, ":", 6)
+
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "dynamodb" {
+		return nil, fmt.Errorf("Invalid table ARN '%s', expected arn:{PARTITION}:dynamodb:{REGION}:{ACCOUNT}:table/{NAME}", name)
+	}
+
+	if parts[1] == "" || parts[3] == "" || parts[4] == "" {
+		return nil, fmt.Errorf("Invalid table ARN '%s', missing partition, region or account", name)
+	}
+
+	if !strings.HasPrefix(parts[5], "table/") || strings.Count(parts[5], "/") != 1 {
+		return nil, fmt.Errorf("Invalid table ARN '%s', expected a table resource", name)
+	}
+
+	arn := &tableArn{
+		Partition: parts[1],
+		Region:    parts[3],
+		Account:   parts[4],
+		Table:     strings.TrimPrefix(parts[5], "table/"),
+	}
+
+	return arn, nil
+}
+
+// withTableName returns the ARN of the table 'name' in the same partition, region and account as 'arn'.
+func (arn *tableArn) withTableName(name string) string {
+	return fmt.Sprintf("arn:%s:dynamodb:%s:%s:table/%s", arn.Partition, arn.Region, arn.Account, name)
+}
+
+// tableNameFromArn returns the name of the table in 'name' if it is an ARN and 'name' otherwise.
+func tableNameFromArn(name string) string {
+
+	if !isTableArn(name) {
+		return name
+	}
+
+	arn, err := parseTableArn(name)
+
+	if err != nil {
+		return name
+	}
+
+	return arn.Table
+}
+
+// region returns the Region option, if set, or else the region of the table if TableName is an ARN, so that a
+// client for a table in another region (and account) talks to that region's endpoint.
+func (s *tableSettings) region() string {
+
+	if *s.Region != "" {
+		return *s.Region
+	}
+
+	if !isTableArn(*s.TableName) {
+		return ""
+	}
+
+	arn, err := parseTableArn(*s.TableName)
+
+	if err != nil {
+		return ""
+	}
+
+	return arn.Region
+}
@@ -0,0 +1,152 @@
+package dynamodb
+
+import (
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"net/http"
+)
+
+// tableSettings holds pointers to the settings shared by every database options struct, for example
+// `DynamoDBSubscriptionsDatabaseOptions`, so that they can be assigned and validated without knowing which database
+// they belong to.
+type tableSettings struct {
+	TableName              *string
+	TablePrefix            *string
+	TableSuffix            *string
+	BillingMode            *string
+	CreateTable            *bool
+	DeletionProtection     *bool
+	TableClass             *string
+	ContributorInsights    *bool
+	ReturnConsumedCapacity *string
+	ConsumedCapacityFunc   *ConsumedCapacityFunc
+	Middleware             *[]Middleware
+	ReadOnly               *bool
+	HTTPClient             **http.Client
+	UseFIPSEndpoint        *bool
+	UseDualStackEndpoint   *bool
+	CapacityLimiter        **CapacityLimiter
+	Retry                  **RetryOptions
+	Region                 *string
+	Endpoint               *string
+}
+
+func (opts *DynamoDBSubscriptionsDatabaseOptions) settings() *tableSettings {
+
+	return &tableSettings{
+		&opts.TableName, &opts.TablePrefix, &opts.TableSuffix, &opts.BillingMode, &opts.CreateTable,
+		&opts.DeletionProtection, &opts.TableClass, &opts.ContributorInsights, &opts.ReturnConsumedCapacity,
+		&opts.ConsumedCapacityFunc, &opts.Middleware, &opts.ReadOnly, &opts.HTTPClient, &opts.UseFIPSEndpoint, &opts.UseDualStackEndpoint,
+		&opts.CapacityLimiter, &opts.Retry, &opts.Region, &opts.Endpoint,
+	}
+}
+
+func (opts *DynamoDBConfirmationsDatabaseOptions) settings() *tableSettings {
+
+	return &tableSettings{
+		&opts.TableName, &opts.TablePrefix, &opts.TableSuffix, &opts.BillingMode, &opts.CreateTable,
+		&opts.DeletionProtection, &opts.TableClass, &opts.ContributorInsights, &opts.ReturnConsumedCapacity,
+		&opts.ConsumedCapacityFunc, &opts.Middleware, &opts.ReadOnly, &opts.HTTPClient, &opts.UseFIPSEndpoint, &opts.UseDualStackEndpoint,
+		&opts.CapacityLimiter, &opts.Retry, &opts.Region, &opts.Endpoint,
+	}
+}
+
+func (opts *DynamoDBEventLogsDatabaseOptions) settings() *tableSettings {
+
+	return &tableSettings{
+		&opts.TableName, &opts.TablePrefix, &opts.TableSuffix, &opts.BillingMode, &opts.CreateTable,
+		&opts.DeletionProtection, &opts.TableClass, &opts.ContributorInsights, &opts.ReturnConsumedCapacity,
+		&opts.ConsumedCapacityFunc, &opts.Middleware, &opts.ReadOnly, &opts.HTTPClient, &opts.UseFIPSEndpoint, &opts.UseDualStackEndpoint,
+		&opts.CapacityLimiter, &opts.Retry, &opts.Region, &opts.Endpoint,
+	}
+}
+
+func (opts *DynamoDBDeliveriesDatabaseOptions) settings() *tableSettings {
+
+	return &tableSettings{
+		&opts.TableName, &opts.TablePrefix, &opts.TableSuffix, &opts.BillingMode, &opts.CreateTable,
+		&opts.DeletionProtection, &opts.TableClass, &opts.ContributorInsights, &opts.ReturnConsumedCapacity,
+		&opts.ConsumedCapacityFunc, &opts.Middleware, &opts.ReadOnly, &opts.HTTPClient, &opts.UseFIPSEndpoint, &opts.UseDualStackEndpoint,
+		&opts.CapacityLimiter, &opts.Retry, &opts.Region, &opts.Endpoint,
+	}
+}
+
+func (opts *DynamoDBUnsubscribeTokensDatabaseOptions) settings() *tableSettings {
+
+	return &tableSettings{
+		&opts.TableName, &opts.TablePrefix, &opts.TableSuffix, &opts.BillingMode, &opts.CreateTable,
+		&opts.DeletionProtection, &opts.TableClass, &opts.ContributorInsights, &opts.ReturnConsumedCapacity,
+		&opts.ConsumedCapacityFunc, &opts.Middleware, &opts.ReadOnly, &opts.HTTPClient, &opts.UseFIPSEndpoint, &opts.UseDualStackEndpoint,
+		&opts.CapacityLimiter, &opts.Retry, &opts.Region, &opts.Endpoint,
+	}
+}
+
+func (opts *DynamoDBSendQueueOptions) settings() *tableSettings {
+
+	return &tableSettings{
+		&opts.TableName, &opts.TablePrefix, &opts.TableSuffix, &opts.BillingMode, &opts.CreateTable,
+		&opts.DeletionProtection, &opts.TableClass, &opts.ContributorInsights, &opts.ReturnConsumedCapacity,
+		&opts.ConsumedCapacityFunc, &opts.Middleware, &opts.ReadOnly, &opts.HTTPClient, &opts.UseFIPSEndpoint, &opts.UseDualStackEndpoint,
+		&opts.CapacityLimiter, &opts.Retry, &opts.Region, &opts.Endpoint,
+	}
+}
+
+func (opts *DynamoDBDeadLettersDatabaseOptions) settings() *tableSettings {
+
+	return &tableSettings{
+		&opts.TableName, &opts.TablePrefix, &opts.TableSuffix, &opts.BillingMode, &opts.CreateTable,
+		&opts.DeletionProtection, &opts.TableClass, &opts.ContributorInsights, &opts.ReturnConsumedCapacity,
+		&opts.ConsumedCapacityFunc, &opts.Middleware, &opts.ReadOnly, &opts.HTTPClient, &opts.UseFIPSEndpoint, &opts.UseDualStackEndpoint,
+		&opts.CapacityLimiter, &opts.Retry, &opts.Region, &opts.Endpoint,
+	}
+}
+
+func (opts *DynamoDBHistoryDatabaseOptions) settings() *tableSettings {
+
+	return &tableSettings{
+		&opts.TableName, &opts.TablePrefix, &opts.TableSuffix, &opts.BillingMode, &opts.CreateTable,
+		&opts.DeletionProtection, &opts.TableClass, &opts.ContributorInsights, &opts.ReturnConsumedCapacity,
+		&opts.ConsumedCapacityFunc, &opts.Middleware, &opts.ReadOnly, &opts.HTTPClient, &opts.UseFIPSEndpoint, &opts.UseDualStackEndpoint,
+		&opts.CapacityLimiter, &opts.Retry, &opts.Region, &opts.Endpoint,
+	}
+}
+
+func (opts *DynamoDBStatsDatabaseOptions) settings() *tableSettings {
+
+	return &tableSettings{
+		&opts.TableName, &opts.TablePrefix, &opts.TableSuffix, &opts.BillingMode, &opts.CreateTable,
+		&opts.DeletionProtection, &opts.TableClass, &opts.ContributorInsights, &opts.ReturnConsumedCapacity,
+		&opts.ConsumedCapacityFunc, &opts.Middleware, &opts.ReadOnly, &opts.HTTPClient, &opts.UseFIPSEndpoint, &opts.UseDualStackEndpoint,
+		&opts.CapacityLimiter, &opts.Retry, &opts.Region, &opts.Endpoint,
+	}
+}
+
+// clientOptions returns the `clientOptions` for 's'.
+func (s *tableSettings) clientOptions() *clientOptions {
+
+	return &clientOptions{
+		HTTPClient:           *s.HTTPClient,
+		Region:               s.region(),
+		Endpoint:             *s.Endpoint,
+		UseFIPSEndpoint:      *s.UseFIPSEndpoint,
+		UseDualStackEndpoint: *s.UseDualStackEndpoint,
+		Retry:                *s.Retry,
+	}
+}
+
+// newClient returns a new DynamoDB client for 'sess' configured by 's', recording consumed capacity with
+// ConsumedCapacityFunc and limiting it with CapacityLimiter if they are set.
+func (s *tableSettings) newClient(sess *aws_session.Session) *aws_dynamodb.DynamoDB {
+
+	client := newDynamoDBClient(sess, s.clientOptions())
+
+	if *s.ConsumedCapacityFunc != nil {
+		addConsumedCapacityHandlers(client, *s.ReturnConsumedCapacity, *s.ConsumedCapacityFunc)
+	}
+
+	if *s.CapacityLimiter != nil {
+		addCapacityLimiterHandlers(client, *s.CapacityLimiter)
+	}
+
+	return client
+}
@@ -0,0 +1,27 @@
+package dynamodb
+
+import (
+	"testing"
+)
+
+func TestOptionsCompositeLiteral(t *testing.T) {
+
+	// the shared settings are fields of each options struct, rather than of an embedded struct, so that keyed
+	// composite literals written against earlier releases still compile
+
+	opts := &DynamoDBSubscriptionsDatabaseOptions{
+		TableName:   "subscriptions",
+		TablePrefix: "prod_",
+		BillingMode: "PAY_PER_REQUEST",
+	}
+
+	if opts.FullTableName() != "prod_subscriptions" {
+		t.Fatalf("Unexpected table name %s", opts.FullTableName())
+	}
+
+	err := validateTableSettings("subscriptions", opts.settings())
+
+	if err != nil {
+		t.Fatalf("Failed to validate options, %v", err)
+	}
+}
@@ -1,21 +1,34 @@
 package dynamodb
 
 import (
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
-func CreateSubscriptionsTable(client *aws_dynamodb.DynamoDB, opts *DynamoDBSubscriptionsDatabaseOptions) (bool, error) {
+// TableDefinition describes a table this package expects, independent of how that table is provisioned.
+type TableDefinition struct {
+	// Input is the request used to create the table.
+	Input *aws_dynamodb.CreateTableInput
+	// TimeToLiveAttribute is the name of the attribute used to expire items. If empty TTL is not enabled.
+	TimeToLiveAttribute string
+	// PointInTimeRecovery reports whether point-in-time recovery should be enabled for the table.
+	PointInTimeRecovery bool
+	// ContributorInsights reports whether CloudWatch Contributor Insights should be enabled for the table and
+	// each of its global secondary indexes.
+	ContributorInsights bool
+	// KinesisStreamArn is the ARN of a Kinesis data stream to which changes to the table should be streamed.
+	// If empty no streaming destination is enabled.
+	KinesisStreamArn string
+}
 
-	has_table, err := hasTable(client, opts.TableName)
+func CreateSubscriptionsTable(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSubscriptionsDatabaseOptions) (bool, error) {
+	return createTable(client, SubscriptionsTableDefinition(opts))
+}
 
-	if err != nil {
-		return false, err
-	}
-
-	if has_table {
-		return true, nil
-	}
+// SubscriptionsTableDefinition returns the definition of the subscriptions table described by 'opts'.
+func SubscriptionsTableDefinition(opts *DynamoDBSubscriptionsDatabaseOptions) *TableDefinition {
 
 	req := &aws_dynamodb.CreateTableInput{
 		AttributeDefinitions: []*aws_dynamodb.AttributeDefinition{
@@ -50,30 +63,126 @@ func CreateSubscriptionsTable(client *aws_dynamodb.DynamoDB, opts *DynamoDBSubsc
 			},
 		},
 		BillingMode: aws.String(opts.BillingMode),
-		TableName:   aws.String(opts.TableName),
+		TableName:   aws.String(opts.FullTableName()),
 	}
 
-	_, err = client.CreateTable(req)
+	if opts.PrefixSearch {
 
-	if err != nil {
-		return false, err
+		req.AttributeDefinitions = append(req.AttributeDefinitions,
+			&aws_dynamodb.AttributeDefinition{
+				AttributeName: aws.String(SEARCH_INITIAL_ATTRIBUTE),
+				AttributeType: aws.String("S"),
+			},
+			&aws_dynamodb.AttributeDefinition{
+				AttributeName: aws.String(SEARCH_ADDRESS_ATTRIBUTE),
+				AttributeType: aws.String("S"),
+			},
+		)
+
+		req.GlobalSecondaryIndexes = append(req.GlobalSecondaryIndexes, &aws_dynamodb.GlobalSecondaryIndex{
+			IndexName: aws.String(SUBSCRIPTIONS_PREFIX_INDEX),
+			KeySchema: []*aws_dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String(SEARCH_INITIAL_ATTRIBUTE),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String(SEARCH_ADDRESS_ATTRIBUTE),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+			Projection: &aws_dynamodb.Projection{
+				ProjectionType: aws.String("ALL"),
+			},
+		})
 	}
 
-	return true, nil
-}
+	if opts.Canonicalize {
+
+		req.AttributeDefinitions = append(req.AttributeDefinitions, &aws_dynamodb.AttributeDefinition{
+			AttributeName: aws.String(CANONICAL_ADDRESS_ATTRIBUTE),
+			AttributeType: aws.String("S"),
+		})
 
-func CreateEventLogsTable(client *aws_dynamodb.DynamoDB, opts *DynamoDBEventLogsDatabaseOptions) (bool, error) {
+		req.GlobalSecondaryIndexes = append(req.GlobalSecondaryIndexes, &aws_dynamodb.GlobalSecondaryIndex{
+			IndexName: aws.String(SUBSCRIPTIONS_CANONICAL_INDEX),
+			KeySchema: []*aws_dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String(CANONICAL_ADDRESS_ATTRIBUTE),
+					KeyType:       aws.String("HASH"),
+				},
+			},
+			Projection: &aws_dynamodb.Projection{
+				ProjectionType: aws.String("ALL"),
+			},
+		})
+	}
 
-	has_table, err := hasTable(client, opts.TableName)
+	if opts.ModifiedIndex {
 
-	if err != nil {
-		return false, err
+		req.AttributeDefinitions = append(req.AttributeDefinitions,
+			&aws_dynamodb.AttributeDefinition{
+				AttributeName: aws.String(MODIFIED_DAY_ATTRIBUTE),
+				AttributeType: aws.String("S"),
+			},
+			&aws_dynamodb.AttributeDefinition{
+				AttributeName: aws.String("lastmodified"),
+				AttributeType: aws.String("N"),
+			},
+		)
+
+		req.GlobalSecondaryIndexes = append(req.GlobalSecondaryIndexes, &aws_dynamodb.GlobalSecondaryIndex{
+			IndexName: aws.String(SUBSCRIPTIONS_MODIFIED_INDEX),
+			KeySchema: []*aws_dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String(MODIFIED_DAY_ATTRIBUTE),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("lastmodified"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+			Projection: &aws_dynamodb.Projection{
+				ProjectionType: aws.String("ALL"),
+			},
+		})
 	}
 
-	if has_table {
-		return true, nil
+	addSecondaryIndexes(req, opts.Indexes)
+
+	if opts.DeletionProtection {
+		req.DeletionProtectionEnabled = aws.Bool(true)
+	}
+
+	if opts.TableClass != "" {
+		req.TableClass = aws.String(opts.TableClass)
+	}
+
+	if opts.StreamViewType != "" {
+		req.StreamSpecification = &aws_dynamodb.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: aws.String(opts.StreamViewType),
+		}
 	}
 
+	def := &TableDefinition{
+		Input:               req,
+		ContributorInsights: opts.ContributorInsights,
+		KinesisStreamArn:    opts.KinesisStreamArn,
+		TimeToLiveAttribute: opts.RetentionAttribute,
+	}
+
+	return def
+}
+
+func CreateEventLogsTable(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBEventLogsDatabaseOptions) (bool, error) {
+	return createTable(client, EventLogsTableDefinition(opts))
+}
+
+// EventLogsTableDefinition returns the definition of the event logs table described by 'opts'.
+func EventLogsTableDefinition(opts *DynamoDBEventLogsDatabaseOptions) *TableDefinition {
+
 	req := &aws_dynamodb.CreateTableInput{
 		AttributeDefinitions: []*aws_dynamodb.AttributeDefinition{
 			{
@@ -128,34 +237,38 @@ func CreateEventLogsTable(client *aws_dynamodb.DynamoDB, opts *DynamoDBEventLogs
 			},
 		},
 		BillingMode: aws.String(opts.BillingMode),
-		TableName:   aws.String(opts.TableName),
+		TableName:   aws.String(opts.FullTableName()),
 	}
 
-	_, err = client.CreateTable(req)
-
-	if err != nil {
-		return false, err
+	if opts.DeletionProtection {
+		req.DeletionProtectionEnabled = aws.Bool(true)
 	}
 
-	return true, nil
-}
+	if opts.TableClass != "" {
+		req.TableClass = aws.String(opts.TableClass)
+	}
 
-func CreateConfirmationsTable(client *aws_dynamodb.DynamoDB, opts *DynamoDBConfirmationsDatabaseOptions) (bool, error) {
+	def := &TableDefinition{
+		Input:               req,
+		ContributorInsights: opts.ContributorInsights,
+		KinesisStreamArn:    opts.KinesisStreamArn,
+		TimeToLiveAttribute: opts.RetentionAttribute,
+	}
 
-	has_table, err := hasTable(client, opts.TableName)
+	return def
+}
 
-	if err != nil {
-		return false, err
-	}
+func CreateConfirmationsTable(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBConfirmationsDatabaseOptions) (bool, error) {
+	return createTable(client, ConfirmationsTableDefinition(opts))
+}
 
-	if has_table {
-		return true, nil
-	}
+// ConfirmationsTableDefinition returns the definition of the confirmations table described by 'opts'.
+func ConfirmationsTableDefinition(opts *DynamoDBConfirmationsDatabaseOptions) *TableDefinition {
 
 	req := &aws_dynamodb.CreateTableInput{
 		AttributeDefinitions: []*aws_dynamodb.AttributeDefinition{
 			{
-				AttributeName: aws.String("code"),
+				AttributeName: aws.String(opts.keyAttribute()),
 				AttributeType: aws.String("S"),
 			},
 			{
@@ -169,7 +282,7 @@ func CreateConfirmationsTable(client *aws_dynamodb.DynamoDB, opts *DynamoDBConfi
 		},
 		KeySchema: []*aws_dynamodb.KeySchemaElement{
 			{
-				AttributeName: aws.String("code"),
+				AttributeName: aws.String(opts.keyAttribute()),
 				KeyType:       aws.String("HASH"),
 			},
 		},
@@ -197,35 +310,41 @@ func CreateConfirmationsTable(client *aws_dynamodb.DynamoDB, opts *DynamoDBConfi
 				Projection: &aws_dynamodb.Projection{
 					ProjectionType: aws.String("INCLUDE"),
 					NonKeyAttributes: []*string{
-						aws.String("code"),
+						aws.String(opts.keyAttribute()),
 					},
 				},
 			},
 		},
 		BillingMode: aws.String(opts.BillingMode),
-		TableName:   aws.String(opts.TableName),
+		TableName:   aws.String(opts.FullTableName()),
 	}
 
-	_, err = client.CreateTable(req)
+	addSecondaryIndexes(req, opts.Indexes)
 
-	if err != nil {
-		return false, err
+	if opts.DeletionProtection {
+		req.DeletionProtectionEnabled = aws.Bool(true)
 	}
 
-	return true, nil
-}
+	if opts.TableClass != "" {
+		req.TableClass = aws.String(opts.TableClass)
+	}
 
-func CreateDeliveriesTable(client *aws_dynamodb.DynamoDB, opts *DynamoDBDeliveriesDatabaseOptions) (bool, error) {
+	def := &TableDefinition{
+		Input:               req,
+		ContributorInsights: opts.ContributorInsights,
+		KinesisStreamArn:    opts.KinesisStreamArn,
+		TimeToLiveAttribute: opts.ExpiresAttribute,
+	}
 
-	has_table, err := hasTable(client, opts.TableName)
+	return def
+}
 
-	if err != nil {
-		return false, err
-	}
+func CreateDeliveriesTable(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBDeliveriesDatabaseOptions) (bool, error) {
+	return createTable(client, DeliveriesTableDefinition(opts))
+}
 
-	if has_table {
-		return true, nil
-	}
+// DeliveriesTableDefinition returns the definition of the deliveries table described by 'opts'.
+func DeliveriesTableDefinition(opts *DynamoDBDeliveriesDatabaseOptions) *TableDefinition {
 
 	req := &aws_dynamodb.CreateTableInput{
 		AttributeDefinitions: []*aws_dynamodb.AttributeDefinition{
@@ -248,26 +367,241 @@ func CreateDeliveriesTable(client *aws_dynamodb.DynamoDB, opts *DynamoDBDeliveri
 				KeyType:       aws.String("RANGE"),
 			},
 		},
+		// the table's key answers "all messages sent to address Y" and the message index, keyed
+		// on message_id and address, answers "all recipients of message X"
 		GlobalSecondaryIndexes: []*aws_dynamodb.GlobalSecondaryIndex{
 			{
-				IndexName: aws.String("status"),
+				IndexName: aws.String(opts.MessageIndexName()),
 				KeySchema: []*aws_dynamodb.KeySchemaElement{
 					{
 						AttributeName: aws.String("message_id"),
 						KeyType:       aws.String("HASH"),
 					},
+					{
+						AttributeName: aws.String("address"),
+						KeyType:       aws.String("RANGE"),
+					},
+				},
+				Projection: &aws_dynamodb.Projection{
+					ProjectionType: aws.String("ALL"),
+				},
+			},
+		},
+		BillingMode: aws.String(opts.BillingMode),
+		TableName:   aws.String(opts.FullTableName()),
+	}
+
+	if opts.DeletionProtection {
+		req.DeletionProtectionEnabled = aws.Bool(true)
+	}
+
+	if opts.TableClass != "" {
+		req.TableClass = aws.String(opts.TableClass)
+	}
+
+	def := &TableDefinition{
+		Input:               req,
+		ContributorInsights: opts.ContributorInsights,
+		KinesisStreamArn:    opts.KinesisStreamArn,
+		TimeToLiveAttribute: opts.RetentionAttribute,
+	}
+
+	return def
+}
+
+func CreateUnsubscribeTokensTable(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBUnsubscribeTokensDatabaseOptions) (bool, error) {
+	return createTable(client, UnsubscribeTokensTableDefinition(opts))
+}
+
+// UnsubscribeTokensTableDefinition returns the definition of the unsubscribe tokens table described by 'opts'.
+func UnsubscribeTokensTableDefinition(opts *DynamoDBUnsubscribeTokensDatabaseOptions) *TableDefinition {
+
+	req := &aws_dynamodb.CreateTableInput{
+		AttributeDefinitions: []*aws_dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("token"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("address"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*aws_dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("token"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		GlobalSecondaryIndexes: []*aws_dynamodb.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String("address"),
+				KeySchema: []*aws_dynamodb.KeySchemaElement{
+					{
+						AttributeName: aws.String("address"),
+						KeyType:       aws.String("HASH"),
+					},
 				},
 				Projection: &aws_dynamodb.Projection{
-					// maybe just address...?
 					ProjectionType: aws.String("ALL"),
 				},
 			},
 		},
 		BillingMode: aws.String(opts.BillingMode),
-		TableName:   aws.String(opts.TableName),
+		TableName:   aws.String(opts.FullTableName()),
+	}
+
+	if opts.DeletionProtection {
+		req.DeletionProtectionEnabled = aws.Bool(true)
+	}
+
+	if opts.TableClass != "" {
+		req.TableClass = aws.String(opts.TableClass)
+	}
+
+	def := &TableDefinition{
+		Input:               req,
+		ContributorInsights: opts.ContributorInsights,
+		KinesisStreamArn:    opts.KinesisStreamArn,
+		TimeToLiveAttribute: opts.ExpiresAttribute,
+	}
+
+	return def
+}
+
+func CreateSendQueueTable(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSendQueueOptions) (bool, error) {
+	return createTable(client, SendQueueTableDefinition(opts))
+}
+
+// SendQueueTableDefinition returns the definition of the send queue table described by 'opts'.
+func SendQueueTableDefinition(opts *DynamoDBSendQueueOptions) *TableDefinition {
+
+	req := &aws_dynamodb.CreateTableInput{
+		AttributeDefinitions: []*aws_dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("id"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("queue"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("leased_until"),
+				AttributeType: aws.String("N"),
+			},
+		},
+		KeySchema: []*aws_dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("id"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		GlobalSecondaryIndexes: []*aws_dynamodb.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String(SEND_QUEUE_LEASE_INDEX),
+				KeySchema: []*aws_dynamodb.KeySchemaElement{
+					{
+						AttributeName: aws.String("queue"),
+						KeyType:       aws.String("HASH"),
+					},
+					{
+						AttributeName: aws.String("leased_until"),
+						KeyType:       aws.String("RANGE"),
+					},
+				},
+				Projection: &aws_dynamodb.Projection{
+					ProjectionType: aws.String("KEYS_ONLY"),
+				},
+			},
+		},
+		BillingMode: aws.String(opts.BillingMode),
+		TableName:   aws.String(opts.FullTableName()),
 	}
 
-	_, err = client.CreateTable(req)
+	if opts.DeletionProtection {
+		req.DeletionProtectionEnabled = aws.Bool(true)
+	}
+
+	if opts.TableClass != "" {
+		req.TableClass = aws.String(opts.TableClass)
+	}
+
+	def := &TableDefinition{
+		Input:               req,
+		ContributorInsights: opts.ContributorInsights,
+	}
+
+	return def
+}
+
+func CreateDeadLettersTable(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBDeadLettersDatabaseOptions) (bool, error) {
+	return createTable(client, DeadLettersTableDefinition(opts))
+}
+
+// DeadLettersTableDefinition returns the definition of the dead letters table described by 'opts'.
+func DeadLettersTableDefinition(opts *DynamoDBDeadLettersDatabaseOptions) *TableDefinition {
+
+	req := &aws_dynamodb.CreateTableInput{
+		AttributeDefinitions: []*aws_dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("address"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("message_id"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*aws_dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("address"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("message_id"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		BillingMode: aws.String(opts.BillingMode),
+		TableName:   aws.String(opts.FullTableName()),
+	}
+
+	if opts.DeletionProtection {
+		req.DeletionProtectionEnabled = aws.Bool(true)
+	}
+
+	if opts.TableClass != "" {
+		req.TableClass = aws.String(opts.TableClass)
+	}
+
+	def := &TableDefinition{
+		Input:               req,
+		ContributorInsights: opts.ContributorInsights,
+	}
+
+	return def
+}
+
+func createTable(client aws_dynamodbiface.DynamoDBAPI, def *TableDefinition) (bool, error) {
+
+	has_table, err := hasTable(client, *def.Input.TableName)
+
+	if err != nil {
+		return false, err
+	}
+
+	if has_table {
+		return true, nil
+	}
+
+	_, err = client.CreateTable(def.Input)
+
+	if err != nil {
+		return false, wrapError(err)
+	}
+
+	err = ConfigureTable(client, def)
 
 	if err != nil {
 		return false, err
@@ -276,7 +610,122 @@ func CreateDeliveriesTable(client *aws_dynamodb.DynamoDB, opts *DynamoDBDeliveri
 	return true, nil
 }
 
-func hasTable(client *aws_dynamodb.DynamoDB, table string) (bool, error) {
+// ConfigureTable applies the settings in 'def' which can not be specified in a CreateTable request,
+// waiting for the table to become active first if there is anything to do.
+func ConfigureTable(client aws_dynamodbiface.DynamoDBAPI, def *TableDefinition) error {
+
+	if def.TimeToLiveAttribute == "" && !def.PointInTimeRecovery && !def.ContributorInsights && def.KinesisStreamArn == "" {
+		return nil
+	}
+
+	table := def.Input.TableName
+
+	err := client.WaitUntilTableExists(&aws_dynamodb.DescribeTableInput{
+		TableName: table,
+	})
+
+	if err != nil {
+		return wrapError(err)
+	}
+
+	if def.TimeToLiveAttribute != "" {
+
+		req := &aws_dynamodb.UpdateTimeToLiveInput{
+			TableName: table,
+			TimeToLiveSpecification: &aws_dynamodb.TimeToLiveSpecification{
+				AttributeName: aws.String(def.TimeToLiveAttribute),
+				Enabled:       aws.Bool(true),
+			},
+		}
+
+		_, err := client.UpdateTimeToLive(req)
+
+		if err != nil {
+			return fmt.Errorf("Failed to enable TTL for %s, %w", *table, wrapError(err))
+		}
+	}
+
+	if def.PointInTimeRecovery {
+
+		req := &aws_dynamodb.UpdateContinuousBackupsInput{
+			TableName: table,
+			PointInTimeRecoverySpecification: &aws_dynamodb.PointInTimeRecoverySpecification{
+				PointInTimeRecoveryEnabled: aws.Bool(true),
+			},
+		}
+
+		_, err := client.UpdateContinuousBackups(req)
+
+		if err != nil {
+			return fmt.Errorf("Failed to enable point-in-time recovery for %s, %w", *table, wrapError(err))
+		}
+	}
+
+	if def.ContributorInsights {
+
+		// a nil index name enables Contributor Insights for the table itself
+
+		indexes := []*string{nil}
+
+		for _, idx := range def.Input.GlobalSecondaryIndexes {
+			indexes = append(indexes, idx.IndexName)
+		}
+
+		for _, idx := range indexes {
+
+			req := &aws_dynamodb.UpdateContributorInsightsInput{
+				TableName:                 table,
+				IndexName:                 idx,
+				ContributorInsightsAction: aws.String(aws_dynamodb.ContributorInsightsActionEnable),
+			}
+
+			_, err := client.UpdateContributorInsights(req)
+
+			if err != nil {
+				return fmt.Errorf("Failed to enable Contributor Insights for %s, %w", *table, wrapError(err))
+			}
+		}
+	}
+
+	if def.KinesisStreamArn != "" {
+
+		req := &aws_dynamodb.EnableKinesisStreamingDestinationInput{
+			TableName: table,
+			StreamArn: aws.String(def.KinesisStreamArn),
+		}
+
+		_, err := client.EnableKinesisStreamingDestination(req)
+
+		if err != nil {
+			return fmt.Errorf("Failed to enable Kinesis streaming destination for %s, %w", *table, wrapError(err))
+		}
+	}
+
+	return nil
+}
+
+// fullTableName returns 'name' with 'prefix' and 'suffix' applied verbatim, so a prefix of "prod_"
+// and a name of "subscriptions" yields "prod_subscriptions".
+func fullTableName(prefix string, name string, suffix string) string {
+
+	// the prefix and suffix of a table ARN are applied to the name of the table it identifies; invalid
+	// ARNs are left as-is to be reported by the options' Validate method
+
+	if isTableArn(name) {
+
+		arn, err := parseTableArn(name)
+
+		if err != nil {
+			return name
+		}
+
+		return arn.withTableName(prefix + arn.Table + suffix)
+	}
+
+	return prefix + name + suffix
+}
+
+func hasTable(client aws_dynamodbiface.DynamoDBAPI, table string) (bool, error) {
 
 	tables, err := listTables(client)
 
@@ -297,7 +746,7 @@ func hasTable(client *aws_dynamodb.DynamoDB, table string) (bool, error) {
 	return has_table, nil
 }
 
-func listTables(client *aws_dynamodb.DynamoDB) ([]string, error) {
+func listTables(client aws_dynamodbiface.DynamoDBAPI) ([]string, error) {
 
 	tables := make([]string, 0)
 
@@ -308,7 +757,7 @@ func listTables(client *aws_dynamodb.DynamoDB) ([]string, error) {
 		rsp, err := client.ListTables(input)
 
 		if err != nil {
-			return nil, err
+			return nil, wrapError(err)
 		}
 
 		for _, n := range rsp.TableNames {
@@ -324,3 +773,99 @@ func listTables(client *aws_dynamodb.DynamoDB) ([]string, error) {
 
 	return tables, nil
 }
+
+func CreateHistoryTable(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBHistoryDatabaseOptions) (bool, error) {
+	return createTable(client, HistoryTableDefinition(opts))
+}
+
+// HistoryTableDefinition returns the definition of the subscription history table described by 'opts'.
+func HistoryTableDefinition(opts *DynamoDBHistoryDatabaseOptions) *TableDefinition {
+
+	req := &aws_dynamodb.CreateTableInput{
+		AttributeDefinitions: []*aws_dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("address"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("recorded"),
+				AttributeType: aws.String("N"),
+			},
+		},
+		KeySchema: []*aws_dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("address"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("recorded"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		BillingMode: aws.String(opts.BillingMode),
+		TableName:   aws.String(opts.FullTableName()),
+	}
+
+	if opts.DeletionProtection {
+		req.DeletionProtectionEnabled = aws.Bool(true)
+	}
+
+	if opts.TableClass != "" {
+		req.TableClass = aws.String(opts.TableClass)
+	}
+
+	def := &TableDefinition{
+		Input:               req,
+		ContributorInsights: opts.ContributorInsights,
+	}
+
+	return def
+}
+
+func CreateStatsTable(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBStatsDatabaseOptions) (bool, error) {
+	return createTable(client, StatsTableDefinition(opts))
+}
+
+// StatsTableDefinition returns the definition of the subscription stats table described by 'opts'.
+func StatsTableDefinition(opts *DynamoDBStatsDatabaseOptions) *TableDefinition {
+
+	req := &aws_dynamodb.CreateTableInput{
+		AttributeDefinitions: []*aws_dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("list"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("date"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*aws_dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("list"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("date"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		BillingMode: aws.String(opts.BillingMode),
+		TableName:   aws.String(opts.FullTableName()),
+	}
+
+	if opts.DeletionProtection {
+		req.DeletionProtectionEnabled = aws.Bool(true)
+	}
+
+	if opts.TableClass != "" {
+		req.TableClass = aws.String(opts.TableClass)
+	}
+
+	def := &TableDefinition{
+		Input:               req,
+		ContributorInsights: opts.ContributorInsights,
+	}
+
+	return def
+}
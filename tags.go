@@ -0,0 +1,177 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"sort"
+)
+
+// TAGS_ATTRIBUTE is the name of the string set attribute recording the tags, or labels, assigned to a subscription.
+const TAGS_ATTRIBUTE string = "tags"
+
+// AddSubscriptionTags adds 'tags' to the tags for the subscription for 'addr' using a single UpdateItem request
+// with an ADD expression, so that concurrent changes to a subscription's tags are never lost. Tags which are
+// already assigned are ignored. It returns a `database.NoRecordError` if there is no subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) AddSubscriptionTags(ctx context.Context, addr string, tags ...string) error {
+
+	ctx = withOperation(ctx, "AddSubscriptionTags")
+	return db.updateTags(ctx, addr, "ADD", tags)
+}
+
+// RemoveSubscriptionTags removes 'tags' from the tags for the subscription for 'addr' using a single UpdateItem
+// request with a DELETE expression. Tags which are not assigned are ignored. It returns a `database.NoRecordError`
+// if there is no subscription for 'addr'.
+func (db *DynamoDBSubscriptionsDatabase) RemoveSubscriptionTags(ctx context.Context, addr string, tags ...string) error {
+
+	ctx = withOperation(ctx, "RemoveSubscriptionTags")
+	return db.updateTags(ctx, addr, "DELETE", tags)
+}
+
+func (db *DynamoDBSubscriptionsDatabase) updateTags(ctx context.Context, addr string, action string, tags []string) error {
+
+	set, err := tagSet(tags)
+
+	if err != nil {
+		return err
+	}
+
+	req := &aws_dynamodb.UpdateItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"address": {
+				S: aws.String(db.options.addressKey(addr)),
+			},
+		},
+		UpdateExpression:    aws.String(action + " #tags :tags"),
+		ConditionExpression: aws.String("attribute_exists(#address)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address": aws.String("address"),
+			"#tags":    aws.String(TAGS_ATTRIBUTE),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":tags": {
+				SS: aws.StringSlice(set),
+			},
+		},
+	}
+
+	_, err = db.client.UpdateItemWithContext(ctx, req)
+
+	if err != nil {
+
+		err = wrapError(err)
+
+		if errors.Is(err, ErrConditionFailed) {
+			return new(database.NoRecordError)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// GetSubscriptionTags returns the tags for the subscription for 'addr', sorted alphabetically.
+func (db *DynamoDBSubscriptionsDatabase) GetSubscriptionTags(ctx context.Context, addr string) ([]string, error) {
+
+	ctx = withOperation(ctx, "GetSubscriptionTags")
+
+	req := &aws_dynamodb.GetItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"address": {
+				S: aws.String(db.options.addressKey(addr)),
+			},
+		},
+		ProjectionExpression: aws.String("#address, #tags"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address": aws.String("address"),
+			"#tags":    aws.String(TAGS_ATTRIBUTE),
+		},
+	}
+
+	rsp, err := db.client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	if rsp.Item == nil {
+		return nil, new(database.NoRecordError)
+	}
+
+	tags := make([]string, 0)
+
+	v, ok := rsp.Item[TAGS_ATTRIBUTE]
+
+	if ok {
+		tags = aws.StringValueSlice(v.SS)
+	}
+
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// ListSubscriptionsWithTag invokes 'callback' for each subscription which has been assigned 'tag'. This is a
+// filtered scan of the entire table.
+func (db *DynamoDBSubscriptionsDatabase) ListSubscriptionsWithTag(ctx context.Context, tag string, callback database.ListSubscriptionsFunc) error {
+
+	ctx = withOperation(ctx, "ListSubscriptionsWithTag")
+
+	if tag == "" {
+		return validationError("subscription", TAGS_ATTRIBUTE, tag, "tag is empty")
+	}
+
+	req := &aws_dynamodb.ScanInput{
+		TableName:        aws.String(db.options.FullTableName()),
+		FilterExpression: aws.String("contains(#tags, :tag)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#tags": aws.String(TAGS_ATTRIBUTE),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":tag": {
+				S: aws.String(tag),
+			},
+		},
+	}
+
+	if db.options.PageSize > 0 {
+		req.Limit = aws.Int64(db.options.PageSize)
+	}
+
+	callback = limitSubscriptionsCallback(db.options.MaxResults, callback)
+
+	err := scanSubscriptions(ctx, db.client, db.options, req, callback)
+	return stopListingError(err)
+}
+
+// tagSet returns 'tags' without duplicates, since DynamoDB rejects string sets with duplicate values. It returns
+// a `ValidationError` if there are no tags or any tag is empty.
+func tagSet(tags []string) ([]string, error) {
+
+	if len(tags) == 0 {
+		return nil, validationError("subscription", TAGS_ATTRIBUTE, tags, "no tags")
+	}
+
+	seen := make(map[string]bool)
+	set := make([]string, 0)
+
+	for _, t := range tags {
+
+		if t == "" {
+			return nil, validationError("subscription", TAGS_ATTRIBUTE, t, "tag is empty")
+		}
+
+		if seen[t] {
+			continue
+		}
+
+		seen[t] = true
+		set = append(set, t)
+	}
+
+	return set, nil
+}
@@ -0,0 +1,106 @@
+package dynamodb
+
+import (
+	"fmt"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"strings"
+)
+
+// TENANT_SEPARATOR separates the Tenant option from the address in the "address" keys of a tenant's items.
+const TENANT_SEPARATOR string = "#"
+
+// tenantKey returns 'key' prefixed with 'tenant', or 'key' as-is if 'tenant' is empty.
+func tenantKey(tenant string, key string) string {
+
+	if tenant == "" {
+		return key
+	}
+
+	return tenant + TENANT_SEPARATOR + key
+}
+
+// addressKey returns the value of the "address" key for 'addr', which is its pseudonym if addresses are
+// pseudonymized, prefixed with the Tenant option if set.
+func (opts *DynamoDBSubscriptionsDatabaseOptions) addressKey(addr string) string {
+	return tenantKey(opts.Tenant, opts.Pseudonymizer.addressKey(addr))
+}
+
+// addressKey returns the value of the "address" key for 'addr', which is its pseudonym if addresses are
+// pseudonymized, prefixed with the Tenant option if set.
+func (opts *DynamoDBHistoryDatabaseOptions) addressKey(addr string) string {
+	return tenantKey(opts.Tenant, opts.Pseudonymizer.addressKey(addr))
+}
+
+// stripTenant removes the prefix added by `tenantKey` from the "address" attribute of 'item'. It returns an error
+// if the address does not belong to 'tenant', which would mean the item was read without a tenant filter.
+func stripTenant(tenant string, item map[string]*aws_dynamodb.AttributeValue) error {
+
+	if tenant == "" {
+		return nil
+	}
+
+	v, ok := item["address"]
+
+	if !ok || v.S == nil {
+		return nil
+	}
+
+	addr, ok := strings.CutPrefix(*v.S, tenant+TENANT_SEPARATOR)
+
+	if !ok {
+		return fmt.Errorf("Item with address %s does not belong to tenant %s", *v.S, tenant)
+	}
+
+	item["address"] = &aws_dynamodb.AttributeValue{
+		S: aws.String(addr),
+	}
+
+	return nil
+}
+
+// withTenantFilter adds a condition matching the items belonging to 'tenant' to the filter expression 'filter',
+// and the names and values it uses to 'names' and 'values', which are created if nil. It does nothing if
+// 'tenant' is empty.
+func withTenantFilter(tenant string, filter **string, names *map[string]*string, values *map[string]*aws_dynamodb.AttributeValue) {
+
+	if tenant == "" {
+		return
+	}
+
+	if *names == nil {
+		*names = make(map[string]*string)
+	}
+
+	if *values == nil {
+		*values = make(map[string]*aws_dynamodb.AttributeValue)
+	}
+
+	(*names)["#tenant_address"] = aws.String("address")
+
+	(*values)[":tenant"] = &aws_dynamodb.AttributeValue{
+		S: aws.String(tenant + TENANT_SEPARATOR),
+	}
+
+	condition := "begins_with(#tenant_address, :tenant)"
+
+	if *filter != nil {
+		condition = fmt.Sprintf("(%s) AND %s", aws.StringValue(*filter), condition)
+	}
+
+	*filter = aws.String(condition)
+}
+
+// validateTenant returns an `OptionsError` if 'tenant' can not be used as the Tenant option.
+func validateTenant(database string, tenant string) error {
+
+	if strings.Contains(tenant, TENANT_SEPARATOR) {
+		return optionsError(database, "Tenant", tenant, fmt.Sprintf("tenant may not contain '%s'", TENANT_SEPARATOR))
+	}
+
+	if strings.TrimSpace(tenant) != tenant {
+		return optionsError(database, "Tenant", tenant, "tenant may not have leading or trailing whitespace")
+	}
+
+	return nil
+}
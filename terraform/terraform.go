@@ -0,0 +1,295 @@
+// package terraform renders the table definitions expected by the go-mailinglist-database-dynamodb
+// package as Terraform `aws_dynamodb_table` resources.
+package terraform
+
+import (
+	"fmt"
+	"github.com/aaronland/go-mailinglist-database-dynamodb"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const DYNAMODB_TABLE_RESOURCE string = "aws_dynamodb_table"
+
+const DYNAMODB_CONTRIBUTOR_INSIGHTS_RESOURCE string = "aws_dynamodb_contributor_insights"
+
+const DYNAMODB_KINESIS_STREAMING_DESTINATION_RESOURCE string = "aws_dynamodb_kinesis_streaming_destination"
+
+var re_resource_name = regexp.MustCompile(`[^a-zA-Z0-9_\-]+`)
+
+// attribute is a single "key = value" pair in a block, where value has already been encoded as HCL.
+type attribute struct {
+	key   string
+	value string
+}
+
+// Write writes an `aws_dynamodb_table` resource for each of 'defs' to 'wr'.
+func Write(wr io.Writer, defs ...*dynamodb.TableDefinition) error {
+
+	seen := make(map[string]bool)
+
+	for i, def := range defs {
+
+		if def.Input == nil || def.Input.TableName == nil {
+			return fmt.Errorf("Table definition is missing a table name")
+		}
+
+		name := ResourceName(*def.Input.TableName)
+
+		if seen[name] {
+			return fmt.Errorf("Table %s results in a duplicate resource name (%s)", *def.Input.TableName, name)
+		}
+
+		seen[name] = true
+
+		if i > 0 {
+
+			_, err := io.WriteString(wr, "\n")
+
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := io.WriteString(wr, Resource(name, def))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResourceName derives a Terraform resource name from 'table_name'.
+func ResourceName(table_name string) string {
+
+	name := re_resource_name.ReplaceAllString(table_name, "_")
+
+	if name == "" || !isLetter(name[0]) && name[0] != '_' {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// Resource returns the HCL for an `aws_dynamodb_table` resource named 'name' describing 'def', followed by
+// any `aws_dynamodb_contributor_insights` or `aws_dynamodb_kinesis_streaming_destination` resources the definition requires.
+func Resource(name string, def *dynamodb.TableDefinition) string {
+
+	in := def.Input
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "resource %s %s {\n", strconv.Quote(DYNAMODB_TABLE_RESOURCE), strconv.Quote(name))
+
+	attrs := []attribute{
+		{"name", quote(in.TableName)},
+		{"billing_mode", quote(in.BillingMode)},
+	}
+
+	attrs = append(attrs, keyAttributes(in.KeySchema)...)
+
+	if in.ProvisionedThroughput != nil {
+		attrs = append(attrs, capacityAttributes(in.ProvisionedThroughput)...)
+	}
+
+	if in.TableClass != nil {
+		attrs = append(attrs, attribute{"table_class", quote(in.TableClass)})
+	}
+
+	if aws.BoolValue(in.DeletionProtectionEnabled) {
+		attrs = append(attrs, attribute{"deletion_protection_enabled", "true"})
+	}
+
+	if in.StreamSpecification != nil && aws.BoolValue(in.StreamSpecification.StreamEnabled) {
+		attrs = append(attrs, attribute{"stream_enabled", "true"})
+		attrs = append(attrs, attribute{"stream_view_type", quote(in.StreamSpecification.StreamViewType)})
+	}
+
+	writeAttributes(&b, "  ", attrs)
+
+	for _, a := range in.AttributeDefinitions {
+
+		writeBlock(&b, "attribute", []attribute{
+			{"name", quote(a.AttributeName)},
+			{"type", quote(a.AttributeType)},
+		})
+	}
+
+	for _, idx := range in.GlobalSecondaryIndexes {
+
+		gsi_attrs := []attribute{
+			{"name", quote(idx.IndexName)},
+		}
+
+		gsi_attrs = append(gsi_attrs, keyAttributes(idx.KeySchema)...)
+
+		if idx.Projection != nil {
+
+			gsi_attrs = append(gsi_attrs, attribute{"projection_type", quote(idx.Projection.ProjectionType)})
+
+			if len(idx.Projection.NonKeyAttributes) > 0 {
+
+				non_key := make([]string, len(idx.Projection.NonKeyAttributes))
+
+				for i, a := range idx.Projection.NonKeyAttributes {
+					non_key[i] = quote(a)
+				}
+
+				gsi_attrs = append(gsi_attrs, attribute{"non_key_attributes", "[" + strings.Join(non_key, ", ") + "]"})
+			}
+		}
+
+		if idx.ProvisionedThroughput != nil {
+			gsi_attrs = append(gsi_attrs, capacityAttributes(idx.ProvisionedThroughput)...)
+		}
+
+		writeBlock(&b, "global_secondary_index", gsi_attrs)
+	}
+
+	if def.TimeToLiveAttribute != "" {
+
+		writeBlock(&b, "ttl", []attribute{
+			{"attribute_name", strconv.Quote(def.TimeToLiveAttribute)},
+			{"enabled", "true"},
+		})
+	}
+
+	if def.PointInTimeRecovery {
+
+		writeBlock(&b, "point_in_time_recovery", []attribute{
+			{"enabled", "true"},
+		})
+	}
+
+	if len(in.Tags) > 0 {
+
+		tags := make([]attribute, 0)
+
+		for _, t := range in.Tags {
+			tags = append(tags, attribute{strconv.Quote(aws.StringValue(t.Key)), quote(t.Value)})
+		}
+
+		sort.Slice(tags, func(i, j int) bool {
+			return tags[i].key < tags[j].key
+		})
+
+		b.WriteString("\n  tags = {\n")
+		writeAttributes(&b, "    ", tags)
+		b.WriteString("  }\n")
+	}
+
+	b.WriteString("}\n")
+
+	if def.ContributorInsights {
+		writeContributorInsights(&b, name, def)
+	}
+
+	if def.KinesisStreamArn != "" {
+
+		fmt.Fprintf(&b, "\nresource %s %s {\n", strconv.Quote(DYNAMODB_KINESIS_STREAMING_DESTINATION_RESOURCE), strconv.Quote(name))
+
+		writeAttributes(&b, "  ", []attribute{
+			{"stream_arn", strconv.Quote(def.KinesisStreamArn)},
+			{"table_name", fmt.Sprintf("%s.%s.name", DYNAMODB_TABLE_RESOURCE, name)},
+		})
+
+		b.WriteString("}\n")
+	}
+
+	return b.String()
+}
+
+// writeContributorInsights writes an `aws_dynamodb_contributor_insights` resource for the table named 'name'
+// and for each of its global secondary indexes.
+func writeContributorInsights(b *strings.Builder, name string, def *dynamodb.TableDefinition) {
+
+	table_ref := fmt.Sprintf("%s.%s.name", DYNAMODB_TABLE_RESOURCE, name)
+
+	indexes := []*string{nil}
+
+	for _, idx := range def.Input.GlobalSecondaryIndexes {
+		indexes = append(indexes, idx.IndexName)
+	}
+
+	for _, idx := range indexes {
+
+		attrs := []attribute{
+			{"table_name", table_ref},
+		}
+
+		resource_name := name
+
+		if idx != nil {
+			attrs = append(attrs, attribute{"index_name", quote(idx)})
+			resource_name = ResourceName(name + "_" + *idx)
+		}
+
+		fmt.Fprintf(b, "\nresource %s %s {\n", strconv.Quote(DYNAMODB_CONTRIBUTOR_INSIGHTS_RESOURCE), strconv.Quote(resource_name))
+		writeAttributes(b, "  ", attrs)
+		b.WriteString("}\n")
+	}
+}
+
+func keyAttributes(schema []*aws_dynamodb.KeySchemaElement) []attribute {
+
+	attrs := make([]attribute, 0)
+
+	for _, k := range schema {
+
+		switch aws.StringValue(k.KeyType) {
+		case aws_dynamodb.KeyTypeHash:
+			attrs = append(attrs, attribute{"hash_key", quote(k.AttributeName)})
+		case aws_dynamodb.KeyTypeRange:
+			attrs = append(attrs, attribute{"range_key", quote(k.AttributeName)})
+		}
+	}
+
+	return attrs
+}
+
+func capacityAttributes(pt *aws_dynamodb.ProvisionedThroughput) []attribute {
+
+	return []attribute{
+		{"read_capacity", strconv.FormatInt(aws.Int64Value(pt.ReadCapacityUnits), 10)},
+		{"write_capacity", strconv.FormatInt(aws.Int64Value(pt.WriteCapacityUnits), 10)},
+	}
+}
+
+func writeBlock(b *strings.Builder, block string, attrs []attribute) {
+
+	fmt.Fprintf(b, "\n  %s {\n", block)
+	writeAttributes(b, "    ", attrs)
+	b.WriteString("  }\n")
+}
+
+// writeAttributes writes 'attrs' aligning the "=" signs the way `terraform fmt` does.
+func writeAttributes(b *strings.Builder, indent string, attrs []attribute) {
+
+	width := 0
+
+	for _, a := range attrs {
+
+		if len(a.key) > width {
+			width = len(a.key)
+		}
+	}
+
+	for _, a := range attrs {
+		fmt.Fprintf(b, "%s%-*s = %s\n", indent, width, a.key, a.value)
+	}
+}
+
+func quote(s *string) string {
+	return strconv.Quote(aws.StringValue(s))
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,60 @@
+package terraform
+
+import (
+	"bytes"
+	"flag"
+	"github.com/aaronland/go-mailinglist-database-dynamodb/dynamodbtest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files in testdata with the current output.")
+
+func TestWrite(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	err := Write(&buf, dynamodbtest.TableDefinitions("expires")...)
+
+	if err != nil {
+		t.Fatalf("Failed to write resources, %v", err)
+	}
+
+	path := filepath.Join("testdata", "tables.tf")
+
+	if *update {
+
+		err = os.WriteFile(path, buf.Bytes(), 0644)
+
+		if err != nil {
+			t.Fatalf("Failed to write %s, %v", path, err)
+		}
+	}
+
+	expected, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("Failed to read %s, %v", path, err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("Resources do not match %s, got:\n%s", path, buf.String())
+	}
+}
+
+func TestWriteWithoutTimeToLive(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	err := Write(&buf, dynamodbtest.TableDefinitions("")...)
+
+	if err != nil {
+		t.Fatalf("Failed to write resources, %v", err)
+	}
+
+	if strings.Contains(buf.String(), "ttl {") {
+		t.Fatalf("Expected no ttl block, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,224 @@
+resource "aws_dynamodb_table" "subscriptions" {
+  name         = "subscriptions"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "address"
+
+  attribute {
+    name = "address"
+    type = "S"
+  }
+
+  attribute {
+    name = "status"
+    type = "N"
+  }
+
+  global_secondary_index {
+    name            = "status"
+    hash_key        = "status"
+    projection_type = "ALL"
+  }
+}
+
+resource "aws_dynamodb_table" "confirmations" {
+  name         = "confirmations"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "code"
+
+  attribute {
+    name = "code"
+    type = "S"
+  }
+
+  attribute {
+    name = "address"
+    type = "S"
+  }
+
+  attribute {
+    name = "created"
+    type = "N"
+  }
+
+  global_secondary_index {
+    name            = "address"
+    hash_key        = "address"
+    projection_type = "ALL"
+  }
+
+  global_secondary_index {
+    name               = "created"
+    hash_key           = "created"
+    projection_type    = "INCLUDE"
+    non_key_attributes = ["code"]
+  }
+
+  ttl {
+    attribute_name = "expires"
+    enabled        = true
+  }
+}
+
+resource "aws_dynamodb_table" "eventlogs" {
+  name         = "eventlogs"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "address"
+  range_key    = "created"
+
+  attribute {
+    name = "address"
+    type = "S"
+  }
+
+  attribute {
+    name = "event"
+    type = "N"
+  }
+
+  attribute {
+    name = "created"
+    type = "N"
+  }
+
+  global_secondary_index {
+    name            = "address"
+    hash_key        = "address"
+    projection_type = "ALL"
+  }
+
+  global_secondary_index {
+    name            = "event"
+    hash_key        = "event"
+    projection_type = "ALL"
+  }
+}
+
+resource "aws_dynamodb_table" "deliveries" {
+  name         = "deliveries"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "address"
+  range_key    = "message_id"
+
+  attribute {
+    name = "address"
+    type = "S"
+  }
+
+  attribute {
+    name = "message_id"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "message_id"
+    hash_key        = "message_id"
+    range_key       = "address"
+    projection_type = "ALL"
+  }
+}
+
+resource "aws_dynamodb_table" "unsubscribe_tokens" {
+  name         = "unsubscribe_tokens"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "token"
+
+  attribute {
+    name = "token"
+    type = "S"
+  }
+
+  attribute {
+    name = "address"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "address"
+    hash_key        = "address"
+    projection_type = "ALL"
+  }
+
+  ttl {
+    attribute_name = "expires"
+    enabled        = true
+  }
+}
+
+resource "aws_dynamodb_table" "send_queue" {
+  name         = "send_queue"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  attribute {
+    name = "queue"
+    type = "S"
+  }
+
+  attribute {
+    name = "leased_until"
+    type = "N"
+  }
+
+  global_secondary_index {
+    name            = "lease"
+    hash_key        = "queue"
+    range_key       = "leased_until"
+    projection_type = "KEYS_ONLY"
+  }
+}
+
+resource "aws_dynamodb_table" "dead_letters" {
+  name         = "dead_letters"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "address"
+  range_key    = "message_id"
+
+  attribute {
+    name = "address"
+    type = "S"
+  }
+
+  attribute {
+    name = "message_id"
+    type = "S"
+  }
+}
+
+resource "aws_dynamodb_table" "subscription_history" {
+  name         = "subscription_history"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "address"
+  range_key    = "recorded"
+
+  attribute {
+    name = "address"
+    type = "S"
+  }
+
+  attribute {
+    name = "recorded"
+    type = "N"
+  }
+}
+
+resource "aws_dynamodb_table" "subscription_stats" {
+  name         = "subscription_stats"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "list"
+  range_key    = "date"
+
+  attribute {
+    name = "list"
+    type = "S"
+  }
+
+  attribute {
+    name = "date"
+    type = "S"
+  }
+}
@@ -0,0 +1,185 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidTransition is returned (wrapped, by a `TransitionError`) when the EnforceTransitions option is set and
+// a subscription's status can not be changed from its current status to the requested one.
+var ErrInvalidTransition = errors.New("Invalid status transition")
+
+// TransitionError describes a status change rejected under the EnforceTransitions option. It wraps ErrInvalidTransition.
+type TransitionError struct {
+	// Address is the address of the subscription.
+	Address string
+	// From is the current status of the subscription.
+	From SubscriptionStatus
+	// To is the requested status.
+	To SubscriptionStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("Subscription for %s can not change from '%s' to '%s'", e.Address, e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// SubscriptionTransitions maps a `SubscriptionStatus` to the statuses a subscription may change to from it. A
+// subscription may always "change" to its current status.
+type SubscriptionTransitions map[SubscriptionStatus][]SubscriptionStatus
+
+// DefaultSubscriptionTransitions are the status changes allowed under the EnforceTransitions option, unless the
+// Transitions option is set. Unsubscribed and bounced subscriptions can only become active again by being
+// confirmed afresh, by way of STATUS_PENDING, and suppressed subscriptions can not change at all.
+var DefaultSubscriptionTransitions = SubscriptionTransitions{
+	STATUS_PENDING:      {STATUS_ACTIVE, STATUS_UNSUBSCRIBED, STATUS_BOUNCED, STATUS_SUPPRESSED},
+	STATUS_ACTIVE:       {STATUS_UNSUBSCRIBED, STATUS_BOUNCED, STATUS_SUPPRESSED},
+	STATUS_UNSUBSCRIBED: {STATUS_PENDING, STATUS_SUPPRESSED},
+	STATUS_BOUNCED:      {STATUS_PENDING, STATUS_UNSUBSCRIBED, STATUS_SUPPRESSED},
+	STATUS_SUPPRESSED:   {},
+}
+
+// Allowed reports whether a subscription may change from 'from' to 'to'.
+func (t SubscriptionTransitions) Allowed(from SubscriptionStatus, to SubscriptionStatus) bool {
+
+	if from == to {
+		return true
+	}
+
+	for _, s := range t[from] {
+
+		if s == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sources returns the statuses from which a subscription may change to 'to', in a fixed order so that the
+// conditions derived from them are stable.
+func (t SubscriptionTransitions) sources(to SubscriptionStatus) []SubscriptionStatus {
+
+	sources := []SubscriptionStatus{to}
+
+	for _, from := range []SubscriptionStatus{STATUS_PENDING, STATUS_ACTIVE, STATUS_UNSUBSCRIBED, STATUS_BOUNCED, STATUS_SUPPRESSED} {
+
+		if from != to && t.Allowed(from, to) {
+			sources = append(sources, from)
+		}
+	}
+
+	return sources
+}
+
+func (opts *DynamoDBSubscriptionsDatabaseOptions) transitions() SubscriptionTransitions {
+
+	if opts.Transitions != nil {
+		return opts.Transitions
+	}
+
+	return DefaultSubscriptionTransitions
+}
+
+// transitionCondition returns a condition expression which is true if the current status of a subscription, as
+// determined by `subscriptionStatusFromItem`, is one from which it may change to 'to'. The names and values it
+// uses are added to 'names' and 'values'.
+func transitionCondition(t SubscriptionTransitions, to SubscriptionStatus, names map[string]*string, values map[string]*aws_dynamodb.AttributeValue) string {
+
+	names["#status"] = aws.String("status")
+
+	// DynamoDB rejects requests with unused names or values so the state attribute is only added when needed
+
+	use_state := func() {
+
+		names["#state"] = aws.String(SUBSCRIPTION_STATE_ATTRIBUTE)
+
+		values[":bounced"] = &aws_dynamodb.AttributeValue{
+			S: aws.String(string(STATUS_BOUNCED)),
+		}
+	}
+
+	clauses := make([]string, 0)
+
+	for i, from := range t.sources(to) {
+
+		legacy, err := from.LegacyStatus()
+
+		if err != nil {
+			continue
+		}
+
+		value := fmt.Sprintf(":from%d", i)
+
+		values[value] = &aws_dynamodb.AttributeValue{
+			N: aws.String(strconv.Itoa(legacy)),
+		}
+
+		switch from {
+		case STATUS_BOUNCED:
+			use_state()
+			clauses = append(clauses, fmt.Sprintf("(#status = %s AND #state = :bounced)", value))
+		case STATUS_UNSUBSCRIBED:
+			use_state()
+			clauses = append(clauses, fmt.Sprintf("(#status = %s AND (attribute_not_exists(#state) OR #state <> :bounced))", value))
+		default:
+			clauses = append(clauses, fmt.Sprintf("#status = %s", value))
+		}
+	}
+
+	return "(" + strings.Join(clauses, " OR ") + ")"
+}
+
+// transitionError returns the error for an update of the subscription with 'key' (for 'addr') to 'to' whose
+// condition failed with 'err': a `database.NoRecordError` if there is no subscription, a `TransitionError` if
+// the change is not allowed or 'err' if the condition failed for another reason.
+func transitionError(ctx context.Context, client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBSubscriptionsDatabaseOptions, addr string, key map[string]*aws_dynamodb.AttributeValue, to SubscriptionStatus, err error) error {
+
+	req := &aws_dynamodb.GetItemInput{
+		TableName:            aws.String(opts.FullTableName()),
+		Key:                  key,
+		ConsistentRead:       aws.Bool(true),
+		ProjectionExpression: aws.String("#status, #state"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+			"#state":  aws.String(SUBSCRIPTION_STATE_ATTRIBUTE),
+		},
+	}
+
+	rsp, get_err := client.GetItemWithContext(ctx, req)
+
+	if get_err != nil {
+		return wrapError(get_err)
+	}
+
+	if rsp.Item == nil {
+		return new(database.NoRecordError)
+	}
+
+	from, get_err := subscriptionStatusFromItem(rsp.Item)
+
+	if get_err != nil {
+		return get_err
+	}
+
+	if !opts.transitions().Allowed(from, to) {
+
+		return &TransitionError{
+			Address: addr,
+			From:    from,
+			To:      to,
+		}
+	}
+
+	return fmt.Errorf("Failed to update subscription for %s, %w", addr, err)
+}
@@ -0,0 +1,190 @@
+package dynamodb
+
+import (
+	"errors"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var allStatuses = []SubscriptionStatus{STATUS_PENDING, STATUS_ACTIVE, STATUS_UNSUBSCRIBED, STATUS_BOUNCED, STATUS_SUPPRESSED}
+
+// re_transition_clause matches each of the clauses of a condition returned by `transitionCondition`.
+var re_transition_clause = regexp.MustCompile(`\(#status = (:from\d+) AND #state = :bounced\)|\(#status = (:from\d+) AND \(attribute_not_exists\(#state\) OR #state <> :bounced\)\)|#status = (:from\d+)`)
+
+// evalTransitionCondition reports whether 'cond', as returned by `transitionCondition`, is true for 'item'.
+func evalTransitionCondition(t *testing.T, cond string, values map[string]*aws_dynamodb.AttributeValue, item map[string]*aws_dynamodb.AttributeValue) bool {
+
+	status := aws.StringValue(item["status"].N)
+
+	state, has_state := item[SUBSCRIPTION_STATE_ATTRIBUTE]
+	bounced := has_state && aws.StringValue(state.S) == string(STATUS_BOUNCED)
+
+	if values[":bounced"] != nil && aws.StringValue(values[":bounced"].S) != string(STATUS_BOUNCED) {
+		t.Fatalf("Unexpected :bounced value %v", values[":bounced"])
+	}
+
+	matches := re_transition_clause.FindAllStringSubmatch(cond, -1)
+
+	if len(matches) == 0 {
+		t.Fatalf("Failed to parse condition %s", cond)
+	}
+
+	for _, m := range matches {
+
+		switch {
+		case m[1] != "":
+
+			if aws.StringValue(values[m[1]].N) == status && bounced {
+				return true
+			}
+
+		case m[2] != "":
+
+			if aws.StringValue(values[m[2]].N) == status && !bounced {
+				return true
+			}
+
+		default:
+
+			if aws.StringValue(values[m[3]].N) == status {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// statusItem returns a subscription item with the status 'status', without the SUBSCRIPTION_STATE_ATTRIBUTE
+// attribute if 'legacy' is true.
+func statusItem(t *testing.T, status SubscriptionStatus, legacy bool) map[string]*aws_dynamodb.AttributeValue {
+
+	n, err := status.LegacyStatus()
+
+	if err != nil {
+		t.Fatalf("Failed to derive legacy status for %s, %v", status, err)
+	}
+
+	item := map[string]*aws_dynamodb.AttributeValue{
+		"status": {N: aws.String(strconv.Itoa(n))},
+	}
+
+	if !legacy {
+		item[SUBSCRIPTION_STATE_ATTRIBUTE] = &aws_dynamodb.AttributeValue{S: aws.String(string(status))}
+	}
+
+	return item
+}
+
+func TestDefaultSubscriptionTransitions(t *testing.T) {
+
+	allowed := map[SubscriptionStatus]map[SubscriptionStatus]bool{
+		STATUS_PENDING: {
+			STATUS_PENDING: true, STATUS_ACTIVE: true, STATUS_UNSUBSCRIBED: true, STATUS_BOUNCED: true, STATUS_SUPPRESSED: true,
+		},
+		STATUS_ACTIVE: {
+			STATUS_PENDING: false, STATUS_ACTIVE: true, STATUS_UNSUBSCRIBED: true, STATUS_BOUNCED: true, STATUS_SUPPRESSED: true,
+		},
+		STATUS_UNSUBSCRIBED: {
+			STATUS_PENDING: true, STATUS_ACTIVE: false, STATUS_UNSUBSCRIBED: true, STATUS_BOUNCED: false, STATUS_SUPPRESSED: true,
+		},
+		STATUS_BOUNCED: {
+			STATUS_PENDING: true, STATUS_ACTIVE: false, STATUS_UNSUBSCRIBED: true, STATUS_BOUNCED: true, STATUS_SUPPRESSED: true,
+		},
+		STATUS_SUPPRESSED: {
+			STATUS_PENDING: false, STATUS_ACTIVE: false, STATUS_UNSUBSCRIBED: false, STATUS_BOUNCED: false, STATUS_SUPPRESSED: true,
+		},
+	}
+
+	for _, from := range allStatuses {
+
+		for _, to := range allStatuses {
+
+			expected := allowed[from][to]
+
+			if DefaultSubscriptionTransitions.Allowed(from, to) != expected {
+				t.Fatalf("Expected transition from %s to %s allowed to be %t", from, to, expected)
+			}
+
+			names := make(map[string]*string)
+			values := make(map[string]*aws_dynamodb.AttributeValue)
+
+			cond := transitionCondition(DefaultSubscriptionTransitions, to, names, values)
+
+			if evalTransitionCondition(t, cond, values, statusItem(t, from, false)) != expected {
+				t.Fatalf("Expected condition %s for transition from %s to %s to be %t", cond, from, to, expected)
+			}
+
+			// subscriptions written without a state are unsubscribed, rather than bounced, if they are disabled
+
+			if from != STATUS_BOUNCED && evalTransitionCondition(t, cond, values, statusItem(t, from, true)) != expected {
+				t.Fatalf("Expected condition %s for transition from legacy %s to %s to be %t", cond, from, to, expected)
+			}
+
+			// DynamoDB rejects requests with unused names so the state attribute is only named if it is used
+
+			_, has_state := names["#state"]
+			_, has_bounced := values[":bounced"]
+
+			uses_state := strings.Contains(cond, "#state")
+
+			if has_state != uses_state || has_bounced != uses_state {
+				t.Fatalf("Unexpected names %v and values %v for condition %s", names, values, cond)
+			}
+		}
+	}
+}
+
+func TestSubscriptionTransitionsCustom(t *testing.T) {
+
+	transitions := SubscriptionTransitions{
+		STATUS_ACTIVE: {STATUS_PENDING},
+	}
+
+	if !transitions.Allowed(STATUS_ACTIVE, STATUS_PENDING) {
+		t.Fatalf("Expected custom transition from active to pending to be allowed")
+	}
+
+	if transitions.Allowed(STATUS_PENDING, STATUS_ACTIVE) {
+		t.Fatalf("Expected transition from pending to active to be rejected when it is not listed")
+	}
+
+	if !transitions.Allowed(STATUS_SUPPRESSED, STATUS_SUPPRESSED) {
+		t.Fatalf("Expected a subscription to always be allowed to keep its current status")
+	}
+
+	sources := transitions.sources(STATUS_PENDING)
+
+	if len(sources) != 2 || sources[0] != STATUS_PENDING || sources[1] != STATUS_ACTIVE {
+		t.Fatalf("Unexpected sources %v for pending", sources)
+	}
+
+	opts := DefaultDynamoDBSubscriptionsDatabaseOptions()
+
+	if opts.transitions().Allowed(STATUS_ACTIVE, STATUS_PENDING) {
+		t.Fatalf("Expected default transitions when the Transitions option is not set")
+	}
+
+	opts.Transitions = transitions
+
+	if !opts.transitions().Allowed(STATUS_ACTIVE, STATUS_PENDING) {
+		t.Fatalf("Expected the Transitions option to be used")
+	}
+}
+
+func TestTransitionError(t *testing.T) {
+
+	var err error = &TransitionError{
+		Address: "test@example.com",
+		From:    STATUS_SUPPRESSED,
+		To:      STATUS_ACTIVE,
+	}
+
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Expected TransitionError to wrap ErrInvalidTransition")
+	}
+}
@@ -0,0 +1,450 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/database"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_dynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	aws_dynamodbattribute "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	aws_dynamodbiface "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const UNSUBSCRIBE_TOKENS_DEFAULT_TABLENAME string = "unsubscribe_tokens"
+
+// UNSUBSCRIBE_TOKEN_LENGTH is the length of unsubscribe tokens created by the default token generator.
+const UNSUBSCRIBE_TOKEN_LENGTH int = 43
+
+// UnsubscribeToken is a durable token that identifies a subscriber in unsubscribe links, for example in
+// a List-Unsubscribe header, without exposing their address.
+type UnsubscribeToken struct {
+	Token   string `json:"token"`
+	Address string `json:"address"`
+	Created int64  `json:"created"`
+}
+
+type DynamoDBUnsubscribeTokensDatabaseOptions struct {
+	TableName   string
+	TablePrefix string
+	TableSuffix string
+	BillingMode string
+	CreateTable bool
+	// DeletionProtection enables deletion protection when the table is created.
+	DeletionProtection bool
+	// TableClass is the table class (STANDARD or STANDARD_INFREQUENT_ACCESS) used when the table is created.
+	// If empty STANDARD is used.
+	TableClass string
+	// ContributorInsights enables CloudWatch Contributor Insights for the table and its indexes when the table is created.
+	ContributorInsights bool
+	// KinesisStreamArn is the ARN of an optional Kinesis data stream to which changes to the table are streamed,
+	// enabled when the table is created. See the changes package for decoding the resulting records.
+	KinesisStreamArn string
+	// TokenGenerator is an optional function used to generate tokens. If nil tokens are UNSUBSCRIBE_TOKEN_LENGTH
+	// characters chosen from CODE_ALPHABET_URL_SAFE.
+	TokenGenerator CodeGeneratorFunc
+	// MaxAge is the age after which a token expires and is treated as if it does not exist, so that unsubscribe
+	// links in old messages stop working. If zero tokens never expire.
+	MaxAge time.Duration
+	// ExpiresAttribute is the name of an optional attribute each token's expiry time (its created time plus MaxAge,
+	// as a Unix timestamp) is written to, for use with DynamoDB TTL. TTL is enabled for it when the table is
+	// created. If empty, or if MaxAge is zero, no expiry time is written.
+	ExpiresAttribute string
+	// ReturnConsumedCapacity is the level of consumed capacity detail (TOTAL or INDEXES) to request when
+	// ConsumedCapacityFunc is set. If empty TOTAL is used.
+	ReturnConsumedCapacity string
+	// ConsumedCapacityFunc is an optional callback invoked with the capacity consumed by each request.
+	ConsumedCapacityFunc ConsumedCapacityFunc
+	// CapacityLimiter is an optional `CapacityLimiter` which caps the read and write capacity consumed per second.
+	CapacityLimiter *CapacityLimiter
+	// Middleware is an optional chain of `Middleware` invoked around each request to DynamoDB, the first of which is outermost.
+	Middleware []Middleware
+	// ReadOnly rejects every request which would write to the table with ErrReadOnly, before it is sent. It may not
+	// be used with CreateTable.
+	ReadOnly bool
+	// HTTPClient is an optional HTTP client used by the session and DSN constructors in place of the session's
+	// default client. See `NewHTTPClient`.
+	HTTPClient *http.Client
+	// Region is the AWS region of the table, used in place of the session's region by the session and DSN constructors.
+	// If empty the region of the table's ARN, if TableName is an ARN, and otherwise the session's region is used.
+	Region string
+	// Endpoint is the URL of the DynamoDB endpoint, for example "http://localhost:8000" for DynamoDB Local, used in place
+	// of the session's endpoint by the session and DSN constructors. It takes precedence over UseFIPSEndpoint and
+	// UseDualStackEndpoint. If empty the session's endpoint is used.
+	Endpoint string
+	// UseFIPSEndpoint selects the FIPS 140-2 validated DynamoDB endpoint for the session's region.
+	UseFIPSEndpoint bool
+	// UseDualStackEndpoint selects the dual-stack (IPv4 and IPv6) DynamoDB endpoint for the session's region.
+	UseDualStackEndpoint bool
+	// Retry is an optional `RetryOptions` used to retry failed requests in place of the AWS SDK's default retryer.
+	Retry *RetryOptions
+}
+
+func DefaultDynamoDBUnsubscribeTokensDatabaseOptions() *DynamoDBUnsubscribeTokensDatabaseOptions {
+
+	opts := DynamoDBUnsubscribeTokensDatabaseOptions{
+		TableName:   UNSUBSCRIBE_TOKENS_DEFAULT_TABLENAME,
+		BillingMode: "PAY_PER_REQUEST",
+		CreateTable: false,
+	}
+
+	return &opts
+}
+
+// FullTableName returns the name of the table with the TablePrefix and TableSuffix options applied.
+func (opts *DynamoDBUnsubscribeTokensDatabaseOptions) FullTableName() string {
+	return fullTableName(opts.TablePrefix, opts.TableName, opts.TableSuffix)
+}
+
+// expired returns true if 't' is older than the MaxAge option.
+func (opts *DynamoDBUnsubscribeTokensDatabaseOptions) expired(t *UnsubscribeToken) bool {
+
+	if opts.MaxAge <= 0 {
+		return false
+	}
+
+	return t.Created <= time.Now().Add(-opts.MaxAge).Unix()
+}
+
+type DynamoDBUnsubscribeTokensDatabase struct {
+	client    aws_dynamodbiface.DynamoDBAPI
+	options   *DynamoDBUnsubscribeTokensDatabaseOptions
+	generator CodeGeneratorFunc
+}
+
+func NewDynamoDBUnsubscribeTokensDatabaseWithDSN(dsn string, opts *DynamoDBUnsubscribeTokensDatabaseOptions) (*DynamoDBUnsubscribeTokensDatabase, error) {
+
+	sess, err := newSessionWithDSNSettings(dsn, DSN_UNSUBSCRIBE_TOKENS_TABLE_KEY, opts.settings())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDynamoDBUnsubscribeTokensDatabaseWithSession(sess, opts)
+}
+
+func NewDynamoDBUnsubscribeTokensDatabaseWithSession(sess *aws_session.Session, opts *DynamoDBUnsubscribeTokensDatabaseOptions) (*DynamoDBUnsubscribeTokensDatabase, error) {
+
+	client := opts.settings().newClient(sess)
+
+	return NewDynamoDBUnsubscribeTokensDatabaseWithClient(client, opts)
+}
+
+// NewDynamoDBUnsubscribeTokensDatabaseWithClient returns a new `DynamoDBUnsubscribeTokensDatabase` instance that uses 'client' to talk to DynamoDB.
+func NewDynamoDBUnsubscribeTokensDatabaseWithClient(client aws_dynamodbiface.DynamoDBAPI, opts *DynamoDBUnsubscribeTokensDatabaseOptions) (*DynamoDBUnsubscribeTokensDatabase, error) {
+
+	err := opts.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	client = withMiddleware(client, opts.settings().middleware())
+
+	if opts.CreateTable {
+
+		_, err := CreateUnsubscribeTokensTable(client, opts)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	generator := opts.TokenGenerator
+
+	if generator == nil {
+
+		g, err := NewAlphabetCodeGenerator(UNSUBSCRIBE_TOKEN_LENGTH, CODE_ALPHABET_URL_SAFE)
+
+		if err != nil {
+			return nil, err
+		}
+
+		generator = g
+	}
+
+	db := DynamoDBUnsubscribeTokensDatabase{
+		client:    client,
+		options:   opts,
+		generator: generator,
+	}
+
+	return &db, nil
+}
+
+// GetUnsubscribeTokenWithToken returns the `UnsubscribeToken` record for 'token'.
+func (db *DynamoDBUnsubscribeTokensDatabase) GetUnsubscribeTokenWithToken(ctx context.Context, token string) (*UnsubscribeToken, error) {
+
+	ctx = withOperation(ctx, "GetUnsubscribeTokenWithToken")
+
+	req := &aws_dynamodb.GetItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"token": {
+				S: aws.String(token),
+			},
+		},
+	}
+
+	rsp, err := db.client.GetItemWithContext(ctx, req)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	t, err := itemToUnsubscribeToken(rsp.Item)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if db.options.expired(t) {
+		return nil, new(database.NoRecordError)
+	}
+
+	return t, nil
+}
+
+// GetUnsubscribeTokenWithAddress returns the most recent `UnsubscribeToken` record for 'addr', unless it has expired.
+func (db *DynamoDBUnsubscribeTokensDatabase) GetUnsubscribeTokenWithAddress(ctx context.Context, addr string) (*UnsubscribeToken, error) {
+
+	ctx = withOperation(ctx, "GetUnsubscribeTokenWithAddress")
+
+	tokens, err := db.unsubscribeTokensWithAddress(ctx, addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 || db.options.expired(tokens[0]) {
+		return nil, new(database.NoRecordError)
+	}
+
+	return tokens[0], nil
+}
+
+// EnsureUnsubscribeToken returns the existing unsubscribe token for 'addr' or creates a new one if none exists.
+func (db *DynamoDBUnsubscribeTokensDatabase) EnsureUnsubscribeToken(ctx context.Context, addr string) (*UnsubscribeToken, error) {
+
+	ctx = withOperation(ctx, "EnsureUnsubscribeToken")
+
+	t, err := db.GetUnsubscribeTokenWithAddress(ctx, addr)
+
+	if err == nil {
+		return t, nil
+	}
+
+	if !IsNotExist(err) {
+		return nil, err
+	}
+
+	return db.addUnsubscribeToken(ctx, addr)
+}
+
+// RotateUnsubscribeToken creates a new unsubscribe token for 'addr' and invalidates all of its previous tokens.
+func (db *DynamoDBUnsubscribeTokensDatabase) RotateUnsubscribeToken(ctx context.Context, addr string) (*UnsubscribeToken, error) {
+
+	ctx = withOperation(ctx, "RotateUnsubscribeToken")
+
+	previous, err := db.unsubscribeTokensWithAddress(ctx, addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := db.addUnsubscribeToken(ctx, addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, old := range previous {
+
+		err := db.removeUnsubscribeToken(ctx, old.Token)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to remove previous token, %w", err)
+		}
+	}
+
+	return t, nil
+}
+
+// RemoveUnsubscribeTokensForAddress invalidates every unsubscribe token for 'addr'.
+func (db *DynamoDBUnsubscribeTokensDatabase) RemoveUnsubscribeTokensForAddress(ctx context.Context, addr string) error {
+
+	ctx = withOperation(ctx, "RemoveUnsubscribeTokensForAddress")
+
+	tokens, err := db.unsubscribeTokensWithAddress(ctx, addr)
+
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tokens {
+
+		err := db.removeUnsubscribeToken(ctx, t.Token)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *DynamoDBUnsubscribeTokensDatabase) addUnsubscribeToken(ctx context.Context, addr string) (*UnsubscribeToken, error) {
+
+	for attempt := 1; ; attempt++ {
+
+		token, err := db.generator()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate unsubscribe token, %w", err)
+		}
+
+		t := &UnsubscribeToken{
+			Token:   token,
+			Address: addr,
+			Created: time.Now().Unix(),
+		}
+
+		item, err := aws_dynamodbattribute.MarshalMap(t)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if db.options.ExpiresAttribute != "" && db.options.MaxAge > 0 {
+
+			item[db.options.ExpiresAttribute] = &aws_dynamodb.AttributeValue{
+				N: aws.String(strconv.FormatInt(t.Created+int64(db.options.MaxAge/time.Second), 10)),
+			}
+		}
+
+		req := &aws_dynamodb.PutItemInput{
+			Item:                item,
+			TableName:           aws.String(db.options.FullTableName()),
+			ConditionExpression: aws.String("attribute_not_exists(#token)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#token": aws.String("token"),
+			},
+		}
+
+		_, err = db.client.PutItemWithContext(ctx, req)
+
+		if err == nil {
+			return t, nil
+		}
+
+		err = wrapError(err)
+
+		if !errors.Is(err, ErrConditionFailed) {
+			return nil, err
+		}
+
+		if attempt >= CONFIRMATION_CODE_MAX_ATTEMPTS {
+			return nil, fmt.Errorf("Failed to generate a unique unsubscribe token after %d attempts, %w", attempt, ErrAlreadyExists)
+		}
+	}
+}
+
+func (db *DynamoDBUnsubscribeTokensDatabase) removeUnsubscribeToken(ctx context.Context, token string) error {
+
+	req := &aws_dynamodb.DeleteItemInput{
+		TableName: aws.String(db.options.FullTableName()),
+		Key: map[string]*aws_dynamodb.AttributeValue{
+			"token": {
+				S: aws.String(token),
+			},
+		},
+	}
+
+	_, err := db.client.DeleteItemWithContext(ctx, req)
+
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return nil
+}
+
+// unsubscribeTokensWithAddress returns all the tokens for 'addr', most recent first.
+func (db *DynamoDBUnsubscribeTokensDatabase) unsubscribeTokensWithAddress(ctx context.Context, addr string) ([]*UnsubscribeToken, error) {
+
+	req := &aws_dynamodb.QueryInput{
+		TableName:              aws.String(db.options.FullTableName()),
+		IndexName:              aws.String("address"),
+		KeyConditionExpression: aws.String("#address = :address"),
+		ExpressionAttributeNames: map[string]*string{
+			"#address": aws.String("address"),
+		},
+		ExpressionAttributeValues: map[string]*aws_dynamodb.AttributeValue{
+			":address": {
+				S: aws.String(addr),
+			},
+		},
+	}
+
+	tokens := make([]*UnsubscribeToken, 0)
+
+	for {
+
+		err := ctx.Err()
+
+		if err != nil {
+			return nil, err
+		}
+
+		rsp, err := db.client.QueryWithContext(ctx, req)
+
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		for _, item := range rsp.Items {
+
+			t, err := itemToUnsubscribeToken(item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			tokens = append(tokens, t)
+		}
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+
+		if rsp.LastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Created > tokens[j].Created
+	})
+
+	return tokens, nil
+}
+
+func itemToUnsubscribeToken(item map[string]*aws_dynamodb.AttributeValue) (*UnsubscribeToken, error) {
+
+	var t *UnsubscribeToken
+
+	err := aws_dynamodbattribute.UnmarshalMap(item, &t)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Token == "" {
+		return nil, new(database.NoRecordError)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,62 @@
+package dynamodb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnsubscribeTokenExpired(t *testing.T) {
+
+	opts := DefaultDynamoDBUnsubscribeTokensDatabaseOptions()
+
+	old := &UnsubscribeToken{Token: "old", Created: time.Now().Add(-48 * time.Hour).Unix()}
+	recent := &UnsubscribeToken{Token: "recent", Created: time.Now().Add(-1 * time.Hour).Unix()}
+
+	if opts.expired(old) {
+		t.Fatalf("Expected tokens to never expire when MaxAge is zero")
+	}
+
+	opts.MaxAge = 24 * time.Hour
+
+	if !opts.expired(old) {
+		t.Fatalf("Expected token older than MaxAge to be expired")
+	}
+
+	if opts.expired(recent) {
+		t.Fatalf("Expected token younger than MaxAge to not be expired")
+	}
+}
+
+func TestUnsubscribeTokensOptionsValidate(t *testing.T) {
+
+	for _, attr := range []string{"token", "address", "created"} {
+
+		opts := DefaultDynamoDBUnsubscribeTokensDatabaseOptions()
+		opts.ExpiresAttribute = attr
+
+		if opts.Validate() == nil {
+			t.Fatalf("Expected reserved ExpiresAttribute %s to be rejected", attr)
+		}
+	}
+
+	opts := DefaultDynamoDBUnsubscribeTokensDatabaseOptions()
+	opts.MaxAge = -1 * time.Hour
+
+	if opts.Validate() == nil {
+		t.Fatalf("Expected negative MaxAge to be rejected")
+	}
+
+	opts = DefaultDynamoDBUnsubscribeTokensDatabaseOptions()
+	opts.MaxAge = 24 * time.Hour
+	opts.ExpiresAttribute = "expires"
+
+	err := opts.Validate()
+
+	if err != nil {
+		t.Fatalf("Failed to validate options, %v", err)
+	}
+
+	if UnsubscribeTokensTableDefinition(opts).TimeToLiveAttribute != "expires" {
+		t.Fatalf("Expected TTL to be enabled for the ExpiresAttribute option")
+	}
+}
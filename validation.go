@@ -0,0 +1,153 @@
+package dynamodb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/confirmation"
+	"github.com/aaronland/go-mailinglist/delivery"
+	"github.com/aaronland/go-mailinglist/eventlog"
+	"github.com/aaronland/go-mailinglist/subscription"
+	"net/mail"
+)
+
+// ErrInvalid is returned (wrapped, by a `ValidationError`) when a record fails validation before being written.
+var ErrInvalid = errors.New("Invalid record")
+
+// ValidationError describes why a record failed validation. It wraps ErrInvalid.
+type ValidationError struct {
+	// Record is the kind of record, for example "subscription", that failed validation.
+	Record string
+	// Field is the name of the invalid field, for example "address".
+	Field string
+	// Value is the invalid value.
+	Value interface{}
+	// Reason describes why the value is invalid.
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("Invalid %s %s '%v', %s", e.Record, e.Field, e.Value, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalid
+}
+
+func validationError(record string, field string, value interface{}, reason string) error {
+
+	return &ValidationError{
+		Record: record,
+		Field:  field,
+		Value:  value,
+		Reason: reason,
+	}
+}
+
+// validateAddress returns a `ValidationError` if 'addr' is empty or is not a bare email address.
+func validateAddress(record string, addr string) error {
+
+	if addr == "" {
+		return validationError(record, "address", addr, "address is empty")
+	}
+
+	parsed, err := mail.ParseAddress(addr)
+
+	if err != nil {
+		return validationError(record, "address", addr, err.Error())
+	}
+
+	// reject display names, for example "Bob <bob@example.com>", which parse successfully but are not keys
+
+	if parsed.Address != addr {
+		return validationError(record, "address", addr, "expected a bare address")
+	}
+
+	return nil
+}
+
+func validateSubscription(sub *subscription.Subscription) error {
+
+	err := validateAddress("subscription", sub.Address)
+
+	if err != nil {
+		return err
+	}
+
+	if sub.Created <= 0 {
+		return validationError("subscription", "created", sub.Created, "timestamp is not set")
+	}
+
+	if sub.LastModified < 0 {
+		return validationError("subscription", "lastmodified", sub.LastModified, "timestamp is negative")
+	}
+
+	if sub.Confirmed < 0 {
+		return validationError("subscription", "confirmed", sub.Confirmed, "timestamp is negative")
+	}
+
+	switch sub.Status {
+	case subscription.SUBSCRIPTION_STATUS_PENDING, subscription.SUBSCRIPTION_STATUS_ENABLED, subscription.SUBSCRIPTION_STATUS_DISABLED, subscription.SUBSCRIPTION_STATUS_BLOCKED:
+		// pass
+	default:
+		return validationError("subscription", "status", sub.Status, "unknown status")
+	}
+
+	return nil
+}
+
+func validateConfirmation(conf *confirmation.Confirmation) error {
+
+	if conf.Code == "" {
+		return validationError("confirmation", "code", conf.Code, "code is empty")
+	}
+
+	err := validateAddress("confirmation", conf.Address)
+
+	if err != nil {
+		return err
+	}
+
+	if conf.Created <= 0 {
+		return validationError("confirmation", "created", conf.Created, "timestamp is not set")
+	}
+
+	return nil
+}
+
+func validateEventLog(l *eventlog.EventLog) error {
+
+	err := validateAddress("event log", l.Address)
+
+	if err != nil {
+		return err
+	}
+
+	if l.Created <= 0 {
+		return validationError("event log", "created", l.Created, "timestamp is not set")
+	}
+
+	if l.Event < eventlog.EVENTLOG_CUSTOM_EVENT || l.Event > eventlog.EVENTLOG_CONFIRM_EVENT {
+		return validationError("event log", "event", l.Event, "unknown event")
+	}
+
+	return nil
+}
+
+func validateDelivery(d *delivery.Delivery) error {
+
+	err := validateAddress("delivery", d.Address)
+
+	if err != nil {
+		return err
+	}
+
+	if d.MessageId == "" {
+		return validationError("delivery", "message_id", d.MessageId, "message ID is empty")
+	}
+
+	if d.Delivered <= 0 {
+		return validationError("delivery", "delivered", d.Delivered, "timestamp is not set")
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package dynamodb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-mailinglist/subscription"
+	aws "github.com/aws/aws-sdk-go/aws"
+	aws_session "github.com/aws/aws-sdk-go/aws/session"
+	aws_sqs "github.com/aws/aws-sdk-go/service/sqs"
+	aws_sqsiface "github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"strings"
+	"time"
+)
+
+// WRITE_BEHIND_ADD is the `WriteBehindMutation` operation for `AddSubscription`.
+const WRITE_BEHIND_ADD string = "add"
+
+// WRITE_BEHIND_UPDATE is the `WriteBehindMutation` operation for `UpdateSubscription`.
+const WRITE_BEHIND_UPDATE string = "update"
+
+// WRITE_BEHIND_REMOVE is the `WriteBehindMutation` operation for `RemoveSubscription`.
+const WRITE_BEHIND_REMOVE string = "remove"
+
+// WRITE_BEHIND_WAIT_SECONDS is the number of seconds `Apply` waits for messages to arrive in an empty queue.
+const WRITE_BEHIND_WAIT_SECONDS int64 = 20
+
+// WriteBehindMutation is a change to a subscription enqueued, as JSON, by `WriteBehindSubscriptionsDatabase`.
+type WriteBehindMutation struct {
+	Operation    string                     `json:"operation"`
+	Subscription *subscription.Subscription `json:"subscription"`
+	// Enqueued is the Unix time, in nanoseconds, at which the mutation was enqueued.
+	Enqueued int64 `json:"enqueued"`
+}
+
+// WriteBehindSubscriptionsDatabase is a subscriptions database whose `AddSubscription`, `UpdateSubscription`
+// and `RemoveSubscription` methods enqueue the change to an Amazon SQS queue, rather than writing it, so that
+// spikes in writes are buffered by the queue. The changes are written to the underlying database by `Apply`
+// (see cmd/apply-queue). Every other method, including reads, uses the underlying database directly, so reads
+// do not reflect changes which are still queued.
+type WriteBehindSubscriptionsDatabase struct {
+	*DynamoDBSubscriptionsDatabase
+	client    aws_sqsiface.SQSAPI
+	queue_url string
+}
+
+func NewWriteBehindSubscriptionsDatabaseWithDSN(db *DynamoDBSubscriptionsDatabase, dsn string, queue_url string) (*WriteBehindSubscriptionsDatabase, error) {
+
+	sess, err := NewSessionWithDSN(dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriteBehindSubscriptionsDatabaseWithSession(db, sess, queue_url)
+}
+
+func NewWriteBehindSubscriptionsDatabaseWithSession(db *DynamoDBSubscriptionsDatabase, sess *aws_session.Session, queue_url string) (*WriteBehindSubscriptionsDatabase, error) {
+	return NewWriteBehindSubscriptionsDatabaseWithClient(db, aws_sqs.New(sess), queue_url)
+}
+
+// NewWriteBehindSubscriptionsDatabaseWithClient returns a new `WriteBehindSubscriptionsDatabase` that uses 'client'
+// to enqueue changes to 'db' to the queue with 'queue_url'. If the queue is a FIFO queue changes to each address
+// are applied in the order they were made, otherwise they may be applied in any order.
+func NewWriteBehindSubscriptionsDatabaseWithClient(db *DynamoDBSubscriptionsDatabase, client aws_sqsiface.SQSAPI, queue_url string) (*WriteBehindSubscriptionsDatabase, error) {
+
+	if queue_url == "" {
+		return nil, errors.New("Missing queue URL")
+	}
+
+	wb := &WriteBehindSubscriptionsDatabase{
+		DynamoDBSubscriptionsDatabase: db,
+		client:                        client,
+		queue_url:                     queue_url,
+	}
+
+	return wb, nil
+}
+
+// AddSubscription enqueues the addition of 'sub'. Since the subscription is added later an existing subscription
+// for the same address is not reported; the addition is discarded when it is applied instead.
+func (db *WriteBehindSubscriptionsDatabase) AddSubscription(sub *subscription.Subscription) error {
+
+	ctx := withOperation(context.Background(), "AddSubscription")
+	return db.enqueue(ctx, WRITE_BEHIND_ADD, sub)
+}
+
+// UpdateSubscription enqueues the update of 'sub'.
+func (db *WriteBehindSubscriptionsDatabase) UpdateSubscription(sub *subscription.Subscription) error {
+
+	ctx := withOperation(context.Background(), "UpdateSubscription")
+	return db.enqueue(ctx, WRITE_BEHIND_UPDATE, sub)
+}
+
+// RemoveSubscription enqueues the removal of 'sub'.
+func (db *WriteBehindSubscriptionsDatabase) RemoveSubscription(sub *subscription.Subscription) error {
+
+	ctx := withOperation(context.Background(), "RemoveSubscription")
+	return db.enqueue(ctx, WRITE_BEHIND_REMOVE, sub)
+}
+
+func (db *WriteBehindSubscriptionsDatabase) enqueue(ctx context.Context, op string, sub *subscription.Subscription) error {
+
+	if db.options.ReadOnly {
+		return fmt.Errorf("Failed to enqueue %s of subscription for %s, %w", op, sub.Address, ErrReadOnly)
+	}
+
+	// validate now, rather than when the change is applied, so that the caller is told about invalid subscriptions
+
+	err := validateSubscription(sub)
+
+	if err != nil {
+		return err
+	}
+
+	m := &WriteBehindMutation{
+		Operation:    op,
+		Subscription: sub,
+		Enqueued:     time.Now().UnixNano(),
+	}
+
+	body, err := json.Marshal(m)
+
+	if err != nil {
+		return err
+	}
+
+	req := &aws_sqs.SendMessageInput{
+		QueueUrl:    aws.String(db.queue_url),
+		MessageBody: aws.String(string(body)),
+	}
+
+	if strings.HasSuffix(db.queue_url, ".fifo") {
+
+		hash := sha256.Sum256(body)
+
+		req.MessageGroupId = aws.String(db.options.addressKey(sub.Address))
+		req.MessageDeduplicationId = aws.String(hex.EncodeToString(hash[:]))
+	}
+
+	_, err = db.client.SendMessageWithContext(ctx, req)
+
+	if err != nil {
+		return fmt.Errorf("Failed to enqueue %s of subscription for %s, %w", op, sub.Address, err)
+	}
+
+	return nil
+}
+
+// Apply receives up to 10 queued changes, waiting up to WRITE_BEHIND_WAIT_SECONDS for them to arrive, writes each
+// to the underlying database and removes it from the queue. It returns the number of changes applied. Changes
+// which fail are left on the queue to be retried once their visibility timeout expires, so the queue should have
+// a redrive policy to move changes which fail repeatedly to a dead-letter queue.
+func (db *WriteBehindSubscriptionsDatabase) Apply(ctx context.Context) (int, error) {
+
+	req := &aws_sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(db.queue_url),
+		MaxNumberOfMessages: aws.Int64(10),
+		WaitTimeSeconds:     aws.Int64(WRITE_BEHIND_WAIT_SECONDS),
+	}
+
+	rsp, err := db.client.ReceiveMessageWithContext(ctx, req)
+
+	if err != nil {
+		return 0, fmt.Errorf("Failed to receive messages, %w", err)
+	}
+
+	count := 0
+	errs := make([]error, 0)
+
+	for _, msg := range rsp.Messages {
+
+		err := ctx.Err()
+
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		err = db.apply(ctx, aws.StringValue(msg.Body))
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Failed to apply message %s, %w", aws.StringValue(msg.MessageId), err))
+			continue
+		}
+
+		_, err = db.client.DeleteMessageWithContext(ctx, &aws_sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(db.queue_url),
+			ReceiptHandle: msg.ReceiptHandle,
+		})
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Failed to delete message %s, %w", aws.StringValue(msg.MessageId), err))
+			continue
+		}
+
+		count += 1
+	}
+
+	return count, errors.Join(errs...)
+}
+
+func (db *WriteBehindSubscriptionsDatabase) apply(ctx context.Context, body string) error {
+
+	var m *WriteBehindMutation
+
+	err := json.Unmarshal([]byte(body), &m)
+
+	if err != nil {
+		return fmt.Errorf("Failed to decode mutation, %w", err)
+	}
+
+	if m == nil || m.Subscription == nil {
+		return errors.New("Mutation is missing subscription")
+	}
+
+	underlying := db.DynamoDBSubscriptionsDatabase
+
+	switch m.Operation {
+	case WRITE_BEHIND_ADD:
+
+		err := underlying.addSubscription(withOperation(ctx, "AddSubscription"), m.Subscription)
+
+		// SQS delivers messages at least once so an existing subscription may well have been added by
+		// an earlier delivery of the same message
+
+		if errors.Is(err, ErrAlreadyExists) {
+			return nil
+		}
+
+		return err
+
+	case WRITE_BEHIND_UPDATE:
+		return underlying.UpdateSubscription(m.Subscription)
+	case WRITE_BEHIND_REMOVE:
+		return underlying.removeSubscription(withOperation(ctx, "RemoveSubscription"), m.Subscription)
+	default:
+		return fmt.Errorf("Invalid operation '%s'", m.Operation)
+	}
+}